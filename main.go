@@ -1,14 +1,15 @@
 package main
 
 import (
+	"errors"
 	"io"
 	"os"
 	"runtime"
-	"syscall"
 
 	nested "github.com/antonfisher/nested-logrus-formatter"
 	"github.com/cnrancher/hangar/pkg/commands"
-	"github.com/moby/term"
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/cnrancher/hangar/pkg/logger"
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/writer"
 )
@@ -16,8 +17,25 @@ import (
 func main() {
 	setup()
 	if err := commands.Execute(os.Args[1:]); err != nil {
-		logrus.Error(err)
-		os.Exit(1)
+		code := exitCode(err)
+		if code == 1 {
+			logrus.Error(err)
+		}
+		os.Exit(code)
+	}
+}
+
+// exitCode returns the exit code of the error returned by the command.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, hangar.ErrChangesDetected):
+		// Exit code 2 is used by '--detect-changes' to indicate that
+		// the destination does not match the desired state.
+		return 2
+	default:
+		return 1
 	}
 }
 
@@ -25,13 +43,11 @@ func setup() {
 	formatter := &nested.Formatter{
 		HideKeys:        false,
 		TimestampFormat: "[15:04:05]", // hour, time, sec only
-		FieldsOrder:     []string{"IMG"},
-	}
-	if !term.IsTerminal(uintptr(syscall.Stdout)) || !term.IsTerminal(uintptr(syscall.Stderr)) {
-		// Disable if the output is not terminal.
-		formatter.NoColors = true
+		FieldsOrder:     logger.FieldsOrder,
 	}
 	logrus.SetFormatter(formatter)
+	// Disable color if the output is not terminal.
+	logger.SetColor(logger.ColorAuto)
 	logrus.SetOutput(io.Discard)
 	logrus.AddHook(&writer.Hook{
 		// Send logs with level higher than warning to stderr.
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_exitCode(t *testing.T) {
+	assert.Equal(t, 0, exitCode(nil))
+	assert.Equal(t, 2, exitCode(hangar.ErrChangesDetected))
+	assert.Equal(t, 2, exitCode(fmt.Errorf("mirror: %w", hangar.ErrChangesDetected)))
+	assert.Equal(t, 1, exitCode(errors.New("failed")))
+	assert.Equal(t, 1, exitCode(hangar.ErrValidateFailed))
+}
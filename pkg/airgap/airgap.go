@@ -0,0 +1,173 @@
+// Package airgap renders the artifacts of the Rancher air-gap install
+// workflow (image list, load script and RKE2/K3s registries.yaml) from the
+// saved images.
+package airgap
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/utils"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ImagesFile is the consolidated manifest of the saved images.
+	ImagesFile = "images.yaml"
+	// ImageListFile is the plain image list of the saved images.
+	ImageListFile = "images.txt"
+	// LoadScriptFile is the script to load the archives into the private
+	// registry.
+	LoadScriptFile = "load-images.sh"
+	// RegistriesFile is the RKE2/K3s registries.yaml pointing the source
+	// registries at the private registry.
+	RegistriesFile = "registries.yaml"
+)
+
+// Options is the option to render the air-gap artifacts.
+type Options struct {
+	// Registry is the private registry the images will be loaded into.
+	Registry string
+	// Archives are the saved archive file names.
+	Archives []string
+	// Images are the saved source images.
+	Images []string
+}
+
+// Images is the consolidated manifest of the saved images.
+type Images struct {
+	Registry string   `json:"registry"`
+	Archives []string `json:"archives,omitempty"`
+	Images   []Image  `json:"images"`
+}
+
+// Image is the source image and its location in the private registry.
+type Image struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// Write renders the air-gap artifacts into the directory.
+func Write(dir string, o *Options) error {
+	if o == nil || o.Registry == "" {
+		return fmt.Errorf("airgap: private registry is empty")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("airgap: %w", err)
+	}
+	// The archive paths are relative to the artifact directory.
+	archives := make([]string, 0, len(o.Archives))
+	for _, a := range o.Archives {
+		archives = append(archives, relativePath(dir, a))
+	}
+	o = &Options{
+		Registry: o.Registry,
+		Archives: archives,
+		Images:   o.Images,
+	}
+	images := newImages(o)
+	files := map[string][]byte{
+		ImageListFile:  imageList(images),
+		LoadScriptFile: loadScript(o),
+	}
+	var err error
+	if files[ImagesFile], err = yaml.Marshal(images); err != nil {
+		return fmt.Errorf("airgap: %w", err)
+	}
+	mappings := make([]Mapping, 0, len(images.Images))
+	for _, img := range images.Images {
+		repo := utils.GetProjectName(img.Source) + "/" + utils.GetImageName(img.Source)
+		mappings = append(mappings, Mapping{
+			SourceRegistry:        utils.GetRegistryName(img.Source),
+			SourceRepository:      repo,
+			DestinationRepository: repo,
+		})
+	}
+	if files[RegistriesFile], err = yaml.Marshal(NewRegistries(o.Registry, mappings)); err != nil {
+		return fmt.Errorf("airgap: %w", err)
+	}
+	for name, b := range files {
+		mode := os.FileMode(0644)
+		if name == LoadScriptFile {
+			mode = 0755
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), b, mode); err != nil {
+			return fmt.Errorf("airgap: %w", err)
+		}
+	}
+	return nil
+}
+
+func newImages(o *Options) *Images {
+	images := &Images{
+		Registry: o.Registry,
+		Archives: o.Archives,
+		Images:   make([]Image, 0, len(o.Images)),
+	}
+	set := map[string]bool{}
+	for _, img := range o.Images {
+		source := utils.ConstructRegistry(img, "")
+		if set[source] {
+			continue
+		}
+		set[source] = true
+		images.Images = append(images.Images, Image{
+			Source:      source,
+			Destination: utils.ConstructRegistry(img, o.Registry),
+		})
+	}
+	sort.Slice(images.Images, func(i, j int) bool {
+		return images.Images[i].Source < images.Images[j].Source
+	})
+	return images
+}
+
+// imageList returns the image list in the format of the Rancher
+// rancher-images.txt (without the default docker.io registry).
+func imageList(images *Images) []byte {
+	var b bytes.Buffer
+	for _, img := range images.Images {
+		name := img.Source
+		if utils.GetRegistryName(name) == utils.DockerHubRegistry {
+			name = strings.TrimPrefix(name, utils.DockerHubRegistry+"/")
+		}
+		b.WriteString(name + "\n")
+	}
+	return b.Bytes()
+}
+
+func loadScript(o *Options) []byte {
+	var b bytes.Buffer
+	b.WriteString("#!/usr/bin/env bash\n")
+	b.WriteString("# Load the saved images into the private registry, usage:\n")
+	b.WriteString("#   REGISTRY=" + o.Registry + " ./" + LoadScriptFile + "\n\n")
+	b.WriteString("set -euo pipefail\n\n")
+	b.WriteString(fmt.Sprintf("REGISTRY=\"${REGISTRY:-%s}\"\n", o.Registry))
+	b.WriteString("cd \"$(dirname \"$0\")\"\n\n")
+	for _, a := range o.Archives {
+		b.WriteString(fmt.Sprintf("hangar load --source %q --destination \"${REGISTRY}\" \"$@\"\n", a))
+	}
+	return b.Bytes()
+}
+
+// relativePath returns the path relative to the base directory, returns
+// the absolute path if failed.
+func relativePath(base, path string) string {
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return path
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(absBase, absPath)
+	if err != nil {
+		return absPath
+	}
+	return rel
+}
@@ -0,0 +1,82 @@
+package airgap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Write(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "airgap")
+	err := Write(out, &Options{
+		Registry: "registry.example.io",
+		Archives: []string{filepath.Join(dir, "saved-images.zip")},
+		Images: []string{
+			"rancher/rancher:v2.8.0",
+			"quay.io/skopeo/stable:latest",
+			"docker.io/rancher/rancher:v2.8.0",
+		},
+	})
+	assert.Nil(t, err)
+
+	b, err := os.ReadFile(filepath.Join(out, ImageListFile))
+	assert.Nil(t, err)
+	assert.Equal(t, "rancher/rancher:v2.8.0\nquay.io/skopeo/stable:latest\n", string(b))
+
+	b, err = os.ReadFile(filepath.Join(out, ImagesFile))
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), "registry.example.io/rancher/rancher:v2.8.0")
+	assert.Contains(t, string(b), "registry.example.io/skopeo/stable:latest")
+
+	b, err = os.ReadFile(filepath.Join(out, RegistriesFile))
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), "docker.io")
+	assert.Contains(t, string(b), "quay.io")
+	assert.Contains(t, string(b), "https://registry.example.io")
+
+	b, err = os.ReadFile(filepath.Join(out, LoadScriptFile))
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(b), `--source "../saved-images.zip"`))
+
+	assert.NotNil(t, Write(out, &Options{}))
+}
+
+func Test_WriteMirrorConfig(t *testing.T) {
+	dir := t.TempDir()
+	mappings := []Mapping{
+		{
+			SourceRegistry:        "docker.io",
+			SourceRepository:      "rancher/rancher",
+			DestinationRepository: "rancher/rancher",
+		},
+		{
+			SourceRegistry:        "quay.io",
+			SourceRepository:      "skopeo/stable",
+			DestinationRepository: "mirror/skopeo-stable",
+		},
+	}
+	r := NewRegistries("registry.example.io", mappings)
+	assert.Equal(t, 2, len(r.Mirrors))
+	assert.Equal(t, []string{"https://registry.example.io"}, r.Mirrors["docker.io"].Endpoint)
+	assert.Equal(t, 0, len(r.Mirrors["docker.io"].Rewrite))
+	assert.Equal(t, map[string]string{`^skopeo/stable$`: "mirror/skopeo-stable"},
+		r.Mirrors["quay.io"].Rewrite)
+
+	assert.Nil(t, WriteMirrorConfig(dir, "registry.example.io", mappings))
+	_, err := os.Stat(filepath.Join(dir, RegistriesFile))
+	assert.Nil(t, err)
+	b, err := os.ReadFile(filepath.Join(dir, HostsDir, "docker.io", HostsFile))
+	assert.Nil(t, err)
+	assert.Equal(t, "server = \"https://registry-1.docker.io\"\n\n"+
+		"[host.\"https://registry.example.io\"]\n"+
+		"  capabilities = [\"pull\", \"resolve\"]\n", string(b))
+	b, err = os.ReadFile(filepath.Join(dir, HostsDir, "quay.io", HostsFile))
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), "WARNING")
+
+	assert.NotNil(t, WriteMirrorConfig(dir, "", mappings))
+}
@@ -0,0 +1,140 @@
+package airgap
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// HostsDir is the containerd registry config directory (config_path)
+	// contains the 'REGISTRY/hosts.toml' files.
+	HostsDir = "certs.d"
+	// HostsFile is the containerd registry host config file name.
+	HostsFile = "hosts.toml"
+)
+
+// Mapping is the repository of the source image and the repository it
+// was pushed into the destination registry.
+type Mapping struct {
+	SourceRegistry string
+	// SourceRepository is the repository path without registry,
+	// example: library/nginx
+	SourceRepository string
+	// DestinationRepository is the repository path without registry.
+	DestinationRepository string
+}
+
+// Registries is the registries.yaml of RKE2/K3s.
+type Registries struct {
+	Mirrors map[string]Mirror `json:"mirrors"`
+}
+
+// Mirror is the mirror endpoints of the registry.
+type Mirror struct {
+	Endpoint []string `json:"endpoint"`
+	// Rewrite is the map[regexp]replacement of the repository path.
+	Rewrite map[string]string `json:"rewrite,omitempty"`
+}
+
+// NewRegistries returns the registries.yaml of RKE2/K3s mirroring the
+// source registries to the destination registry, the rewrite rules are
+// added for the repositories renamed in the destination.
+func NewRegistries(registry string, mappings []Mapping) *Registries {
+	r := &Registries{
+		Mirrors: map[string]Mirror{},
+	}
+	endpoint := []string{"https://" + registry}
+	for source, rewrite := range rewriteRules(mappings) {
+		m := Mirror{
+			Endpoint: endpoint,
+		}
+		if len(rewrite) > 0 {
+			m.Rewrite = rewrite
+		}
+		r.Mirrors[source] = m
+	}
+	return r
+}
+
+// rewriteRules returns the map[source registry]map[regexp]replacement of
+// the renamed repositories.
+func rewriteRules(mappings []Mapping) map[string]map[string]string {
+	rules := map[string]map[string]string{}
+	for _, m := range mappings {
+		if rules[m.SourceRegistry] == nil {
+			rules[m.SourceRegistry] = map[string]string{}
+		}
+		if m.SourceRepository == m.DestinationRepository {
+			continue
+		}
+		rules[m.SourceRegistry]["^"+regexp.QuoteMeta(m.SourceRepository)+"$"] =
+			m.DestinationRepository
+	}
+	return rules
+}
+
+// WriteMirrorConfig writes the RKE2/K3s registries.yaml and the containerd
+// 'certs.d/REGISTRY/hosts.toml' files mirroring the source registries to
+// the destination registry into the directory.
+func WriteMirrorConfig(dir, registry string, mappings []Mapping) error {
+	if registry == "" {
+		return fmt.Errorf("airgap: destination registry is empty")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("airgap: %w", err)
+	}
+	b, err := yaml.Marshal(NewRegistries(registry, mappings))
+	if err != nil {
+		return fmt.Errorf("airgap: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, RegistriesFile), b, 0644); err != nil {
+		return fmt.Errorf("airgap: %w", err)
+	}
+
+	rules := rewriteRules(mappings)
+	sources := make([]string, 0, len(rules))
+	for source := range rules {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		d := filepath.Join(dir, HostsDir, source)
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return fmt.Errorf("airgap: %w", err)
+		}
+		b := hostsTOML(source, registry, len(rules[source]) > 0)
+		if err := os.WriteFile(filepath.Join(d, HostsFile), b, 0644); err != nil {
+			return fmt.Errorf("airgap: %w", err)
+		}
+		if len(rules[source]) > 0 {
+			logrus.Warnf("Repositories of [%v] are renamed in [%v], "+
+				"use %v instead of %v since containerd does not support rewrite",
+				source, registry, RegistriesFile, HostsFile)
+		}
+	}
+	return nil
+}
+
+// hostsTOML returns the containerd hosts.toml of the source registry.
+func hostsTOML(source, registry string, renamed bool) []byte {
+	server := "https://" + source
+	if source == "docker.io" {
+		server = "https://registry-1.docker.io"
+	}
+	var b bytes.Buffer
+	if renamed {
+		b.WriteString("# WARNING: some repositories are renamed in the mirror registry,\n")
+		b.WriteString("# containerd does not support rewrite, use " + RegistriesFile + " instead.\n")
+	}
+	b.WriteString(fmt.Sprintf("server = %q\n\n", server))
+	b.WriteString(fmt.Sprintf("[host.%q]\n", "https://"+registry))
+	b.WriteString("  capabilities = [\"pull\", \"resolve\"]\n")
+	return b.Bytes()
+}
@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Actions of the audit events.
+const (
+	ActionPush   = "push"
+	ActionDelete = "delete"
+	ActionRetag  = "retag"
+)
+
+// Results of the audit events.
+const (
+	ResultSucceeded = "succeeded"
+	ResultFailed    = "failed"
+)
+
+// Event is the audit event of the write operation to the registry.
+type Event struct {
+	Time time.Time `json:"time"`
+	// User is the OS user running hangar.
+	User string `json:"user"`
+	// Host is the hostname of the machine running hangar.
+	Host    string `json:"host"`
+	Command string `json:"command,omitempty"`
+	Action  string `json:"action"`
+	// Source is the source image of the push/retag action.
+	Source string `json:"source,omitempty"`
+	// Image is the image written (pushed, deleted or retagged) to the registry.
+	Image string `json:"image"`
+	// Digests of the manifests written to the registry.
+	Digests []string `json:"digests,omitempty"`
+	Result  string   `json:"result"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Options is the options of the audit logger.
+type Options struct {
+	// File is the path of the append-only audit log file.
+	File string
+	// Endpoint is the HTTP endpoint the audit events are POSTed to.
+	Endpoint string
+	// Command is the hangar command name recorded in the audit events.
+	Command string
+	// Timeout of the HTTP requests.
+	Timeout time.Duration
+}
+
+// Logger writes the audit events into the audit log file and POSTs the
+// audit events to the HTTP endpoint.
+type Logger struct {
+	file     *os.File
+	endpoint string
+	command  string
+	user     string
+	host     string
+	client   *http.Client
+	mutex    *sync.Mutex
+}
+
+// New creates the audit logger, returns nil if the audit log file and
+// endpoint are both not provided.
+func New(o *Options) (*Logger, error) {
+	if o.File == "" && o.Endpoint == "" {
+		return nil, nil
+	}
+	l := &Logger{
+		endpoint: o.Endpoint,
+		command:  o.Command,
+		mutex:    &sync.Mutex{},
+		client: &http.Client{
+			Timeout: o.Timeout,
+		},
+	}
+	if l.client.Timeout == 0 {
+		l.client.Timeout = time.Second * 10
+	}
+	if u, err := user.Current(); err == nil {
+		l.user = u.Username
+	}
+	l.host, _ = os.Hostname()
+	if o.File != "" {
+		// The audit log file is append-only.
+		f, err := os.OpenFile(o.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+		if err != nil {
+			return nil, fmt.Errorf("audit: failed to open audit log: %w", err)
+		}
+		l.file = f
+	}
+	return l, nil
+}
+
+// Record writes the audit event, the errors are logged as warnings and
+// will not break the operation.
+func (l *Logger) Record(ctx context.Context, e *Event) {
+	if l == nil || e == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.User = l.user
+	e.Host = l.host
+	if e.Command == "" {
+		e.Command = l.command
+	}
+	if e.Result == "" {
+		e.Result = ResultSucceeded
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		logrus.Warnf("audit: failed to encode event: %v", err)
+		return
+	}
+
+	l.mutex.Lock()
+	if l.file != nil {
+		if _, err := l.file.Write(append(b, '\n')); err != nil {
+			logrus.Warnf("audit: failed to write audit log: %v", err)
+		}
+	}
+	l.mutex.Unlock()
+
+	if l.endpoint != "" {
+		if err := l.post(ctx, b); err != nil {
+			logrus.Warnf("audit: failed to send event to %q: %v", l.endpoint, err)
+		}
+	}
+}
+
+func (l *Logger) post(ctx context.Context, b []byte) error {
+	if ctx == nil || ctx.Err() != nil {
+		// Send the event even if the operation context was canceled.
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, l.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %v: %s", resp.Status, string(body))
+	}
+	return nil
+}
+
+// Close closes the audit log file.
+func (l *Logger) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Close()
+}
+
+var defaultLogger *Logger
+
+// SetDefault sets the default audit logger used by Record.
+func SetDefault(l *Logger) {
+	defaultLogger = l
+}
+
+// Record writes the audit event by the default audit logger,
+// no-op if the default audit logger is not set.
+func Record(ctx context.Context, e *Event) {
+	defaultLogger.Record(ctx, e)
+}
@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Logger(t *testing.T) {
+	l, err := New(&Options{})
+	assert.Nil(t, err)
+	assert.Nil(t, l)
+	// Nil logger should be no-op.
+	l.Record(context.TODO(), &Event{})
+	assert.Nil(t, l.Close())
+
+	var received []*Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := &Event{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(e))
+		received = append(received, e)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err = New(&Options{
+		File:     path,
+		Endpoint: server.URL,
+		Command:  "mirror",
+	})
+	assert.Nil(t, err)
+	l.Record(context.TODO(), &Event{
+		Action:  ActionPush,
+		Image:   "harbor.example.io/library/nginx:latest",
+		Digests: []string{"sha256:abc"},
+	})
+	l.Record(context.TODO(), &Event{
+		Action: ActionDelete,
+		Image:  "harbor.example.io/library/nginx:1.0",
+		Result: ResultFailed,
+	})
+	assert.Nil(t, l.Close())
+
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	var events []*Event
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		e := &Event{}
+		assert.Nil(t, json.Unmarshal(sc.Bytes(), e))
+		events = append(events, e)
+	}
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, ActionPush, events[0].Action)
+	assert.Equal(t, "mirror", events[0].Command)
+	assert.Equal(t, ResultSucceeded, events[0].Result)
+	assert.Equal(t, ResultFailed, events[1].Result)
+	assert.Equal(t, 2, len(received))
+	assert.Equal(t, events[1].Image, received[1].Image)
+}
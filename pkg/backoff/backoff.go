@@ -0,0 +1,61 @@
+package backoff
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultDelay is the base delay if the delay of the retry options
+	// is not set.
+	DefaultDelay = time.Second
+	// MaxDelay is the upper limit of the retry delay.
+	MaxDelay = time.Minute
+)
+
+// Delay returns the exponential backoff delay of the attempt (start from 0)
+// with jitter, the delay is a random duration between [d/2, d) where
+// d = base * 2^attempt and limited by the MaxDelay.
+func Delay(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = DefaultDelay
+	}
+	d := base
+	for i := 0; i < attempt && d < MaxDelay; i++ {
+		d *= 2
+	}
+	if d > MaxDelay {
+		d = MaxDelay
+	}
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+// IfNecessary retries the operation in exponential backoff with jitter,
+// the Delay of the retry options is the base delay of the first retry.
+func IfNecessary(ctx context.Context, operation func() error, options *retry.Options) error {
+	isRetryable := retry.IsErrorRetryable
+	if options.IsErrorRetryable != nil {
+		isRetryable = options.IsErrorRetryable
+	}
+	err := operation()
+	for attempt := 0; err != nil && isRetryable(err) && attempt < options.MaxRetry; attempt++ {
+		delay := Delay(options.Delay, attempt)
+		logrus.Warnf("Failed, retrying in %s ... (%d/%d). Error: %v",
+			delay.Round(time.Millisecond), attempt+1, options.MaxRetry, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		err = operation()
+	}
+	return err
+}
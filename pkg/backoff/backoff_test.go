@@ -0,0 +1,85 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/containers/common/pkg/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Delay(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		d := Delay(time.Second, attempt)
+		expected := time.Second << attempt
+		if expected > MaxDelay {
+			expected = MaxDelay
+		}
+		assert.GreaterOrEqual(t, d, expected/2)
+		assert.Less(t, d, expected)
+	}
+	assert.GreaterOrEqual(t, Delay(0, 0), DefaultDelay/2)
+}
+
+func Test_IfNecessary(t *testing.T) {
+	var attempts int
+	err := IfNecessary(context.TODO(), func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("retry")
+		}
+		return nil
+	}, &retry.Options{
+		MaxRetry:         3,
+		Delay:            time.Millisecond,
+		IsErrorRetryable: func(error) bool { return true },
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func Test_IsServerError(t *testing.T) {
+	assert.True(t, IsServerError(errors.New("received unexpected HTTP status: 503 Service Unavailable")))
+	assert.True(t, IsServerError(fmt.Errorf("reading manifest: %w",
+		errors.New(`StatusCode: 502, "<html>"`))))
+	assert.True(t, IsServerError(errors.New("invalid status code from registry 500 (Internal Server Error)")))
+	assert.False(t, IsServerError(errors.New("received unexpected HTTP status: 404 Not Found")))
+	assert.False(t, IsServerError(context.Canceled))
+	assert.False(t, IsServerError(nil))
+}
+
+func Test_Breaker(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+	serverErr := errors.New("reading manifest in harbor.io/library/nginx: " +
+		"received unexpected HTTP status: 503 Service Unavailable")
+
+	b.Record(serverErr, "docker.io", "harbor.io")
+	assert.Equal(t, time.Duration(0), b.allow("harbor.io"))
+	b.Record(serverErr, "docker.io", "harbor.io")
+	assert.Equal(t, time.Minute, b.allow("harbor.io"))
+	// The source registry is not mentioned in the error message.
+	assert.Equal(t, time.Duration(0), b.allow("docker.io"))
+
+	// Half-open after cooldown, only one worker probes the registry.
+	now = now.Add(time.Minute)
+	assert.Equal(t, time.Duration(0), b.allow("harbor.io"))
+	assert.Equal(t, probeInterval, b.allow("harbor.io"))
+	b.Record(serverErr, "harbor.io")
+	assert.Equal(t, time.Minute, b.allow("harbor.io"))
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, time.Duration(0), b.allow("harbor.io"))
+	b.Record(nil, "harbor.io")
+	assert.Equal(t, time.Duration(0), b.allow("harbor.io"))
+	assert.Nil(t, b.Wait(context.TODO(), "harbor.io"))
+
+	var nilBreaker *Breaker
+	nilBreaker.Record(serverErr, "harbor.io")
+	assert.Nil(t, nilBreaker.Wait(context.TODO(), "harbor.io"))
+	assert.Nil(t, NewBreaker(0, 0))
+}
@@ -0,0 +1,190 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultThreshold is the number of consecutive server errors to
+	// open the circuit of the registry.
+	DefaultThreshold = 5
+	// DefaultCooldown is the duration to pause the work targeting the
+	// registry after the circuit opened.
+	DefaultCooldown = time.Minute
+
+	// probeInterval is the interval to check the circuit state when
+	// another worker is probing the registry.
+	probeInterval = time.Second
+)
+
+// serverErrorRegexp matches the HTTP 5xx status code in the registry
+// error messages, example:
+//
+//	received unexpected HTTP status: 503 Service Unavailable
+//	StatusCode: 502, "<html>..."
+//	invalid status code from registry 500 (Internal Server Error)
+var serverErrorRegexp = regexp.MustCompile(
+	`(?i)(http status:|statuscode:|status code from registry|status code) *(5\d\d)\b`)
+
+// IsServerError returns true if the error is caused by the HTTP 5xx
+// response of the registry server.
+func IsServerError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return serverErrorRegexp.MatchString(err.Error())
+}
+
+// Breaker is the per-registry circuit breaker, it pauses the work targeting
+// the registry returning sustained server errors and resumes automatically
+// after the cooldown. The methods are no-op if the breaker is nil.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu     sync.Mutex
+	states map[string]*circuit
+	now    func() time.Time
+}
+
+type circuit struct {
+	// failures is the number of the consecutive server errors
+	failures int
+	// openUntil is the time to resume the work targeting the registry
+	openUntil time.Time
+	// probing is true if a worker is probing the registry after the
+	// cooldown (half-open state)
+	probing bool
+}
+
+// NewBreaker returns a circuit breaker opens after threshold consecutive
+// server errors, returns nil if the threshold is not positive.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		states:    make(map[string]*circuit),
+		now:       time.Now,
+	}
+}
+
+// Wait blocks until the circuits of the registries are closed or the
+// cooldown elapsed, returns the context error if the context is done.
+func (b *Breaker) Wait(ctx context.Context, registries ...string) error {
+	if b == nil {
+		return nil
+	}
+	for _, r := range registries {
+		if r == "" {
+			continue
+		}
+		for {
+			d := b.allow(r)
+			if d <= 0 {
+				break
+			}
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// allow returns the duration to wait before the work targeting the registry,
+// returns 0 if the work is allowed.
+func (b *Breaker) allow(registry string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.states[registry]
+	if c == nil || c.failures < b.threshold {
+		return 0
+	}
+	if d := c.openUntil.Sub(b.now()); d > 0 {
+		return d
+	}
+	if c.probing {
+		return probeInterval
+	}
+	// Half-open, let this worker probe the registry.
+	c.probing = true
+	logrus.Infof("Registry [%v] circuit half-open, resuming", registry)
+	return 0
+}
+
+// Record records the result of the work targeting the registries,
+// the circuit is closed if the work succeed and opened if the registry
+// returns sustained server errors.
+func (b *Breaker) Record(err error, registries ...string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	serverErr := IsServerError(err)
+	if serverErr {
+		registries = failedRegistries(err, registries)
+	}
+	for _, r := range registries {
+		if r == "" {
+			continue
+		}
+		c := b.states[r]
+		if c == nil {
+			c = &circuit{}
+			b.states[r] = c
+		}
+		switch {
+		case err == nil:
+			if c.failures >= b.threshold {
+				logrus.Infof("Registry [%v] circuit closed", r)
+			}
+			c.failures = 0
+			c.probing = false
+		case serverErr:
+			c.failures++
+			c.probing = false
+			if c.failures >= b.threshold {
+				c.openUntil = b.now().Add(b.cooldown)
+				logrus.Warnf("Registry [%v] circuit open after %d consecutive server errors, "+
+					"pausing until %v", r, c.failures, c.openUntil.Format(time.TimeOnly))
+			}
+		default:
+			// Other errors do not change the circuit state, release the
+			// probe to let another worker probe the registry.
+			c.probing = false
+		}
+	}
+}
+
+// failedRegistries returns the registries mentioned in the error message,
+// returns all registries if the error does not mention any of them.
+func failedRegistries(err error, registries []string) []string {
+	var result []string
+	msg := err.Error()
+	for _, r := range registries {
+		if r != "" && strings.Contains(msg, r) {
+			result = append(result, r)
+		}
+	}
+	if len(result) == 0 {
+		return registries
+	}
+	return result
+}
@@ -0,0 +1,106 @@
+package cmdconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the hangar config file.
+//
+// Example:
+//
+//	defaults:
+//	  arch: [amd64]
+//	  os: [linux]
+//	profiles:
+//	  prod-airgap:
+//	    arch: [amd64, arm64]
+//	    os: [linux]
+//	    destination: harbor.example.io
+//	    jobs: 5
+//	    authfile: /etc/hangar/auth.json
+//	    policy: /etc/hangar/policy.json
+type Config struct {
+	// Defaults is the flags applied to every command, the flags of the
+	// profile and the command line have higher priority.
+	Defaults Profile `json:"defaults,omitempty"`
+	// Profiles is the map of profile name and the predefined flags.
+	Profiles map[string]Profile `json:"profiles,omitempty"`
+}
+
+// Profile is the map of flag name and flag value.
+type Profile map[string]any
+
+// DefaultConfigPath returns the default config file path, the HANGAR_CONFIG
+// environment variable overrides the default path.
+func DefaultConfigPath() string {
+	if p := os.Getenv("HANGAR_CONFIG"); p != "" {
+		return p
+	}
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(d, "hangar", "config.yaml")
+}
+
+// LoadConfig loads the config file, unknown keys are not allowed.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %q: %w", path, err)
+	}
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("failed to decode config %q: %w", path, err)
+	}
+	return c, nil
+}
+
+// Profile returns the profile by name.
+func (c *Config) Profile(name string) (Profile, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("profile %q not found, available profiles: [%v]",
+			name, strings.Join(names, ","))
+	}
+	return p, nil
+}
+
+// Flags converts the profile values into flag values in string format,
+// the list values are joined by comma.
+func (p Profile) Flags() (map[string]string, error) {
+	flags := make(map[string]string, len(p))
+	for k, v := range p {
+		switch v := v.(type) {
+		case string:
+			flags[k] = v
+		case bool, float64, int, int64:
+			flags[k] = fmt.Sprintf("%v", v)
+		case []any:
+			s := make([]string, 0, len(v))
+			for _, e := range v {
+				switch e.(type) {
+				case string, bool, float64, int, int64:
+					s = append(s, fmt.Sprintf("%v", e))
+				default:
+					return nil, fmt.Errorf("invalid value of profile key %q: %v", k, v)
+				}
+			}
+			flags[k] = strings.Join(s, ",")
+		default:
+			return nil, fmt.Errorf("invalid value of profile key %q: %v", k, v)
+		}
+	}
+	return flags, nil
+}
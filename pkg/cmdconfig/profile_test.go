@@ -0,0 +1,52 @@
+package cmdconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(`
+defaults:
+  arch: [amd64]
+profiles:
+  prod-airgap:
+    arch: [amd64, arm64]
+    os: [linux]
+    destination: harbor.example.io
+    jobs: 5
+    tls-verify: false
+`), 0644))
+	c, err := cmdconfig.LoadConfig(path)
+	assert.Nil(t, err)
+	p, err := c.Profile("prod-airgap")
+	assert.Nil(t, err)
+	flags, err := p.Flags()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"arch":        "amd64,arm64",
+		"os":          "linux",
+		"destination": "harbor.example.io",
+		"jobs":        "5",
+		"tls-verify":  "false",
+	}, flags)
+
+	flags, err = c.Defaults.Flags()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"arch": "amd64"}, flags)
+
+	_, err = c.Profile("unknown")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, os.WriteFile(path, []byte(`
+profile:
+  test: {}
+`), 0644))
+	_, err = cmdconfig.LoadConfig(path)
+	assert.NotNil(t, err)
+}
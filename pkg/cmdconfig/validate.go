@@ -0,0 +1,140 @@
+package cmdconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	yamlv2 "gopkg.in/yaml.v2"
+)
+
+// FlagSpec describes the command line flag the profile key sets.
+type FlagSpec struct {
+	// Type is the value type of the flag, e.g. 'bool', 'int', 'stringSlice'.
+	Type string
+	// File is true if the flag value is the path of an existing file.
+	File bool
+}
+
+// Issue is a problem found when validating the config file.
+type Issue struct {
+	// Location is the location of the problem in config file,
+	// e.g. 'line 3' or 'profiles.prod.jobs'.
+	Location string
+	Message  string
+}
+
+func (i Issue) String() string {
+	return i.Location + ": " + i.Message
+}
+
+// ValidateConfig checks the config file for the schema errors, the profile
+// keys not matching any flag, the invalid flag values and the files
+// referenced by the profiles which do not exist.
+func ValidateConfig(path string, specs map[string]FlagSpec) ([]Issue, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %q: %w", path, err)
+	}
+	// Decode by the yaml.v2 to get the line numbers of the schema errors.
+	c := &Config{}
+	if err := yamlv2.UnmarshalStrict(b, c); err != nil {
+		var te *yamlv2.TypeError
+		if !errors.As(err, &te) {
+			return []Issue{{Location: "config", Message: err.Error()}}, nil
+		}
+		var issues []Issue
+		for _, e := range te.Errors {
+			location, message, ok := strings.Cut(e, ": ")
+			if !ok {
+				location, message = "config", e
+			}
+			issues = append(issues, Issue{Location: location, Message: message})
+		}
+		return issues, nil
+	}
+
+	issues := validateProfile("defaults", c.Defaults, specs)
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		issues = append(issues, validateProfile(
+			"profiles."+name, c.Profiles[name], specs)...)
+	}
+	return issues, nil
+}
+
+// validateProfile checks the keys and values of the profile,
+// the prefix is the location of the profile in config file.
+func validateProfile(prefix string, profile Profile, specs map[string]FlagSpec) []Issue {
+	var issues []Issue
+	keys := make([]string, 0, len(profile))
+	for k := range profile {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		location := fmt.Sprintf("%s.%s", prefix, k)
+		spec, ok := specs[k]
+		if !ok {
+			issues = append(issues, Issue{
+				Location: location,
+				Message:  "unknown flag",
+			})
+			continue
+		}
+		if err := validateValue(profile[k], spec); err != nil {
+			issues = append(issues, Issue{
+				Location: location,
+				Message:  err.Error(),
+			})
+		}
+	}
+	return issues
+}
+
+// validateValue checks the profile value can be set to the flag.
+func validateValue(v any, spec FlagSpec) error {
+	values, err := Profile{"": v}.Flags()
+	if err != nil {
+		return fmt.Errorf("invalid value %v", v)
+	}
+	value := values[""]
+	if _, ok := v.([]any); ok &&
+		spec.Type != "stringSlice" && spec.Type != "stringArray" {
+		return fmt.Errorf("invalid value %v: %s flag does not accept list", v, spec.Type)
+	}
+	switch spec.Type {
+	case "bool":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid bool value %q", value)
+		}
+	case "int":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("invalid int value %q", value)
+		}
+	case "duration":
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("invalid duration value %q", value)
+		}
+	}
+	if !spec.File {
+		return nil
+	}
+	for _, p := range strings.Split(value, ",") {
+		if p == "" {
+			continue
+		}
+		if _, err := os.Stat(p); err != nil {
+			return fmt.Errorf("file %q not accessible: %w", p, errors.Unwrap(err))
+		}
+	}
+	return nil
+}
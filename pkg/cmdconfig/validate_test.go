@@ -0,0 +1,73 @@
+package cmdconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ValidateConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	authfile := filepath.Join(dir, "auth.json")
+	assert.Nil(t, os.WriteFile(authfile, []byte(`{}`), 0644))
+	specs := map[string]cmdconfig.FlagSpec{
+		"arch":     {Type: "stringSlice"},
+		"jobs":     {Type: "int"},
+		"timeout":  {Type: "duration"},
+		"authfile": {Type: "string", File: true},
+		"policy":   {Type: "string", File: true},
+	}
+
+	assert.Nil(t, os.WriteFile(path, []byte(`
+profiles:
+  prod:
+    arch: [amd64, arm64]
+    jobs: 5
+    timeout: 10m
+    authfile: `+authfile+`
+`), 0644))
+	issues, err := cmdconfig.ValidateConfig(path, specs)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(issues))
+
+	assert.Nil(t, os.WriteFile(path, []byte(`
+defaults:
+  jobs: many
+profiles:
+  prod:
+    arch: amd64
+    jobs: [1, 2]
+    timeout: 10
+    policy: /not/exists/policy.json
+    unknown: true
+`), 0644))
+	issues, err = cmdconfig.ValidateConfig(path, specs)
+	assert.Nil(t, err)
+	locations := []string{}
+	for _, i := range issues {
+		locations = append(locations, i.Location)
+	}
+	assert.Equal(t, []string{
+		"defaults.jobs",
+		"profiles.prod.jobs",
+		"profiles.prod.policy",
+		"profiles.prod.timeout",
+		"profiles.prod.unknown",
+	}, locations)
+
+	assert.Nil(t, os.WriteFile(path, []byte(`
+profile:
+  test: {}
+`), 0644))
+	issues, err = cmdconfig.ValidateConfig(path, specs)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(issues))
+	assert.Equal(t, "line 2", issues[0].Location)
+
+	_, err = cmdconfig.ValidateConfig(filepath.Join(dir, "not-exists.yaml"), specs)
+	assert.NotNil(t, err)
+}
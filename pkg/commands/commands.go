@@ -2,6 +2,7 @@ package commands
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/cnrancher/hangar/pkg/signal"
@@ -17,6 +18,16 @@ var (
 	defaultUserAgent string = "hangar/" + utils.Version
 )
 
+// defaultArch & defaultOS are the default platforms of the '--arch' and
+// '--os' flags, which can be overridden by the 'defaults' of config file.
+func defaultArch() []string {
+	return []string{"amd64", "arm64"}
+}
+
+func defaultOS() []string {
+	return []string{"linux"}
+}
+
 type baseCmd struct {
 	*baseOpts
 	cmd *cobra.Command
@@ -30,6 +41,10 @@ type baseOpts struct {
 	debug          bool   // Enable debug output
 	policyPath     string // Path to a signature verification policy file
 	insecurePolicy bool   // Use an "allow everything" signature verification policy
+	authFile       string // Path to the registry auth file
+
+	insecureRegistries []string // Registries to skip TLS verify & allow HTTP
+	registriesConf     string   // Path to the generated registries.conf
 }
 
 var globalOpts = baseOpts{}
@@ -40,7 +55,9 @@ func (cc *baseCmd) getCommand() *cobra.Command {
 
 func (cc *baseCmd) newSystemContext() *types.SystemContext {
 	ctx := &types.SystemContext{
-		DockerRegistryUserAgent: defaultUserAgent,
+		DockerRegistryUserAgent:  defaultUserAgent,
+		AuthFilePath:             cc.authFile,
+		SystemRegistriesConfPath: cc.registriesConf,
 	}
 	return ctx
 }
@@ -86,6 +103,15 @@ func (cc *baseCmd) ctxWithTimeout(timeout time.Duration) (context.Context, conte
 	return ctx, cancel
 }
 
+// checkBlobConcurrency checks the '--blob-concurrency' flag, the number of
+// the blobs of each image copied in parallel should be at least 1.
+func checkBlobConcurrency(n int) error {
+	if n < 1 {
+		return fmt.Errorf("invalid blob concurrency %v: should be at least 1", n)
+	}
+	return nil
+}
+
 type cmder interface {
 	getCommand() *cobra.Command
 }
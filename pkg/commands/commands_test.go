@@ -0,0 +1,20 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_checkBlobConcurrency(t *testing.T) {
+	assert.Nil(t, checkBlobConcurrency(1))
+	assert.Nil(t, checkBlobConcurrency(8))
+	assert.Error(t, checkBlobConcurrency(0))
+	assert.Error(t, checkBlobConcurrency(-1))
+
+	// The flag value is rejected by the command before the images are read.
+	cc := newMirrorCmd()
+	assert.Nil(t, cc.cmd.Flags().Set("blob-concurrency", "0"))
+	_, err := cc.prepareHangar()
+	assert.ErrorContains(t, err, "invalid blob concurrency 0")
+}
@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/cnrancher/hangar/pkg/hangar"
+	flag "github.com/spf13/pflag"
+)
+
+// compatOpts is the compatibility profile options of the destination
+// registry.
+type compatOpts struct {
+	compat           string
+	compatRepository string
+	compatSearch     bool
+	compatAPI        string
+	compatCreate     bool
+	compatBootstrap  bool
+}
+
+func (o *compatOpts) addFlags(flags *flag.FlagSet) {
+	flags.StringVarP(&o.compat, "compat", "", "",
+		fmt.Sprintf("compatibility profile of the destination registry (%q, %q, %q)",
+			hangar.CompatibilityNexus, hangar.CompatibilityArtifactory, hangar.CompatibilityGitLab))
+	flags.StringVarP(&o.compatRepository, "compat-repository", "", "",
+		"repository name of the path based routing prefixed to the destination repositories (e.g. Nexus docker hosted repository, Artifactory repository key)")
+	flags.BoolVarP(&o.compatSearch, "compat-search", "", false,
+		"check the existence of the destination images by the Artifactory AQL search (requires '--compat-repository')")
+	flags.StringVarP(&o.compatAPI, "compat-api", "", "",
+		"API server URL of the compatibility profile (default: GitLab server URL detected from the registry)")
+	flags.BoolVarP(&o.compatCreate, "compat-create", "", false,
+		"create the missing GitLab projects of the destination repositories instead of reporting them")
+	flags.BoolVarP(&o.compatBootstrap, "compat-bootstrap", "", false,
+		"push the placeholder image tagged 'hangar-bootstrap' to initialize the new destination repositories "+
+			"for the registries rejecting manifest-only pushes into the repositories not exist")
+}
+
+// compatibility parses the compatibility profile of the destination
+// registry.
+func (o *compatOpts) compatibility() (hangar.Compatibility, error) {
+	c, err := hangar.ParseCompatibility(o.compat)
+	if err != nil {
+		return "", err
+	}
+	if o.compatRepository != "" && c == hangar.CompatibilityNone {
+		return "", fmt.Errorf("the '--compat-repository' option requires the '--compat' profile")
+	}
+	if o.compatSearch && (c != hangar.CompatibilityArtifactory || o.compatRepository == "") {
+		return "", fmt.Errorf("the '--compat-search' option requires the %q profile and the '--compat-repository'",
+			hangar.CompatibilityArtifactory)
+	}
+	if o.compatCreate && c != hangar.CompatibilityGitLab {
+		return "", fmt.Errorf("the '--compat-create' option requires the %q profile",
+			hangar.CompatibilityGitLab)
+	}
+	return c, nil
+}
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/types"
+	"github.com/spf13/cobra"
+)
+
+// completionFunc is the dynamic completion function of flags and args.
+type completionFunc func(
+	cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective)
+
+// completeRegistries completes the registry names from the registry
+// auth config file (registries logged in).
+func completeRegistries(
+	cmd *cobra.Command, args []string, toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	sysCtx := &types.SystemContext{}
+	if f := cmd.Flags().Lookup("authfile"); f != nil && f.Value.String() != "" {
+		sysCtx.AuthFilePath = f.Value.String()
+	}
+	auths, err := config.GetAllCredentials(sysCtx)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var registries []string
+	for registry := range auths {
+		if strings.HasPrefix(registry, toComplete) {
+			registries = append(registries, registry)
+		}
+	}
+	sort.Strings(registries)
+	return registries, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeArchiveImages returns the completion function which completes
+// the image names in the archive file provided by the archiveFlag.
+func completeArchiveImages(archiveFlag string) completionFunc {
+	return func(
+		cmd *cobra.Command, args []string, toComplete string,
+	) ([]string, cobra.ShellCompDirective) {
+		f := cmd.Flags().Lookup(archiveFlag)
+		if f == nil || f.Value.String() == "" {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		images, err := archiveImages(f.Value.String())
+		if err != nil {
+			cobra.CompDebugln(err.Error(), true)
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var s []string
+		for _, image := range images {
+			if strings.HasPrefix(image, toComplete) {
+				s = append(s, image)
+			}
+		}
+		return s, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// archiveImages returns the image names in the archive index.
+func archiveImages(name string) ([]string, error) {
+	reader, err := archive.NewReader(name)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	b, err := reader.Index()
+	if err != nil {
+		return nil, err
+	}
+	index := archive.NewIndex()
+	if err := index.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	images := make([]string, 0, len(index.List))
+	for _, image := range index.List {
+		images = append(images, image.Source+":"+image.Tag)
+	}
+	sort.Strings(images)
+	return images, nil
+}
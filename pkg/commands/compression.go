@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/sirupsen/logrus"
+	flag "github.com/spf13/pflag"
+)
+
+// compressionOpts is the options of re-compressing the image layers
+// during copy.
+type compressionOpts struct {
+	layerCompression string
+}
+
+func (o *compressionOpts) addFlags(flags *flag.FlagSet) {
+	flags.StringVarP(&o.layerCompression, "layer-compression", "", "",
+		"re-compress the image layers into 'gzip' or 'zstd' during copy, "+
+			"the digests of the copied images will be changed (copy layers as-is if not specified)")
+}
+
+// newLayerCompression returns the algorithm to re-compress the layers,
+// returns nil if not specified.
+func (o *compressionOpts) newLayerCompression() (*compression.Algorithm, error) {
+	var a compression.Algorithm
+	switch o.layerCompression {
+	case "":
+		return nil, nil
+	case compression.Gzip.Name():
+		a = compression.Gzip
+	case compression.Zstd.Name():
+		a = compression.Zstd
+	default:
+		return nil, fmt.Errorf("invalid layer compression %q: should be %q or %q",
+			o.layerCompression, compression.Gzip.Name(), compression.Zstd.Name())
+	}
+	logrus.Infof("Re-compress image layers into %v during copy", a.Name())
+	return &a, nil
+}
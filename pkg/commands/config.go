@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
 )
@@ -52,3 +54,34 @@ func setValueFromFlag(flags *flag.FlagSet, key string, cfg cmdconfig.Provider, t
 		}
 	}
 }
+
+type configCmd struct {
+	*baseCmd
+}
+
+func newConfigCmd(config *string) *configCmd {
+	cc := &configCmd{}
+
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "config",
+		Short: "Helpers for the Hangar config file",
+		Long:  "",
+		Example: `
+# Validate the config file before running the job:
+hangar config validate --config ./config.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+			return cmd.Help()
+		},
+	})
+
+	addCommands(cc.cmd,
+		newConfigValidateCmd(config),
+	)
+	return cc
+}
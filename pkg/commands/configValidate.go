@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
+	"github.com/containers/image/v5/signature"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// fileFlags are the flags which values are the path of the input files.
+var fileFlags = map[string]bool{
+	"authfile": true,
+	"policy":   true,
+	"file":     true,
+}
+
+type configValidateCmd struct {
+	*baseCmd
+
+	config *string
+}
+
+func newConfigValidateCmd(config *string) *configValidateCmd {
+	cc := &configValidateCmd{
+		config: config,
+	}
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "validate",
+		Short: "Validate the config file, registries config and policy files",
+		Long: `Validate the config file, registries config and policy files before
+running the job.
+
+The config file is checked for the schema errors, the profile keys not
+matching any flag, the invalid flag values and the referenced files
+(authfile, policy, image list) which do not exist.
+The signature policy files and the auth files referenced by the profiles
+and the registries config (registries.conf) are also decoded.`,
+		Example: `
+# Validate the default config file:
+hangar config validate
+
+# Validate the specified config file:
+hangar config validate --config ./config.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+			return cc.run(cmd.Root())
+		},
+	})
+
+	return cc
+}
+
+func (cc *configValidateCmd) run(root *cobra.Command) error {
+	var problems []string
+	report := func(file, location, message string) {
+		p := fmt.Sprintf("%s: %s: %s", file, location, message)
+		fmt.Fprintln(os.Stdout, p)
+		problems = append(problems, p)
+	}
+
+	path := *cc.config
+	if path == "" {
+		path = cmdconfig.DefaultConfigPath()
+	}
+	policies := map[string]bool{}
+	authfiles := map[string]bool{}
+	if cc.policyPath != "" {
+		policies[cc.policyPath] = true
+	}
+	if cc.authFile != "" {
+		authfiles[cc.authFile] = true
+	}
+
+	if _, err := os.Stat(path); err != nil && *cc.config == "" {
+		logrus.Infof("Config file %q not found, skip", path)
+	} else {
+		issues, err := cmdconfig.ValidateConfig(path, flagSpecs(root))
+		if err != nil {
+			return err
+		}
+		for _, i := range issues {
+			report(path, i.Location, i.Message)
+		}
+		if len(issues) == 0 {
+			// Collect the policy & auth files referenced by profiles.
+			config, err := cmdconfig.LoadConfig(path)
+			if err != nil {
+				return err
+			}
+			for _, p := range config.Profiles {
+				if v, ok := p["policy"].(string); ok {
+					policies[v] = true
+				}
+				if v, ok := p["authfile"].(string); ok {
+					authfiles[v] = true
+				}
+			}
+		}
+	}
+
+	for _, p := range sortedKeys(policies) {
+		if _, err := os.Stat(p); err != nil {
+			// Missing files are already reported by profile validation.
+			continue
+		}
+		if _, err := signature.NewPolicyFromFile(p); err != nil {
+			report(p, "policy", err.Error())
+		}
+	}
+	for _, p := range sortedKeys(authfiles) {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		var v map[string]any
+		if err := json.Unmarshal(b, &v); err != nil {
+			report(p, "authfile", err.Error())
+		}
+	}
+
+	sysCtx := cc.baseCmd.newSystemContext()
+	if _, err := sysregistriesv2.GetRegistries(sysCtx); err != nil {
+		file := sysCtx.SystemRegistriesConfPath
+		if file == "" {
+			file = "registries.conf"
+		}
+		report(file, "registries", err.Error())
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found in config", len(problems))
+	}
+	logrus.Infof("Config %q is valid", path)
+	return nil
+}
+
+// flagSpecs returns the flag specs of all commands, which are the
+// available keys of the profile.
+func flagSpecs(root *cobra.Command) map[string]cmdconfig.FlagSpec {
+	specs := map[string]cmdconfig.FlagSpec{}
+	add := func(f *flag.Flag) {
+		if s, ok := specs[f.Name]; ok && (s.Type == "stringSlice" || s.Type == "stringArray") {
+			// The list value is accepted if the flag of any command
+			// accepts the list (e.g. the image list '--file').
+			return
+		}
+		specs[f.Name] = cmdconfig.FlagSpec{
+			Type: f.Value.Type(),
+			File: fileFlags[f.Name],
+		}
+	}
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		cmd.Flags().VisitAll(add)
+		cmd.PersistentFlags().VisitAll(add)
+		for _, c := range cmd.Commands() {
+			walk(c)
+		}
+	}
+	walk(root)
+	return specs
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/cnrancher/hangar/pkg/copy"
+	"github.com/sirupsen/logrus"
+	flag "github.com/spf13/pflag"
+)
+
+// contentStoreAuto detects the content store of the local containerd.
+const contentStoreAuto = "auto"
+
+// contentStoreOpts is the options of reading the blobs from the local
+// containerd content store.
+type contentStoreOpts struct {
+	contentStore string
+}
+
+func (o *contentStoreOpts) addFlags(flags *flag.FlagSet) {
+	flags.StringVarP(&o.contentStore, "content-store", "", "",
+		"read the blobs from the local containerd content store directory when digests match "+
+			"before falling back to the network ('auto' to detect the containerd/RKE2/K3s content store)")
+}
+
+// newContentStore returns the local containerd content store,
+// returns nil if not specified.
+func (o *contentStoreOpts) newContentStore() (*copy.ContentStore, error) {
+	switch o.contentStore {
+	case "":
+		return nil, nil
+	case contentStoreAuto:
+		for _, root := range []string{
+			copy.RKE2ContentStore,
+			copy.K3sContentStore,
+			copy.DefaultContentStore,
+		} {
+			if store, err := copy.NewContentStore(root); err == nil {
+				logrus.Infof("Read blobs from local content store [%v]", root)
+				return store, nil
+			}
+		}
+		return nil, fmt.Errorf("no local containerd content store detected")
+	}
+	store, err := copy.NewContentStore(o.contentStore)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("Read blobs from local content store [%v]", o.contentStore)
+	return store, nil
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"context"
+	"sort"
+
+	"github.com/cnrancher/hangar/pkg/credential"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/types"
+	flag "github.com/spf13/pflag"
+)
+
+// credentialOpts is the option to check the registry credentials are
+// scoped to the minimal permissions.
+type credentialOpts struct {
+	credentialPolicy string
+	// checks is the credential permission checks, map[registry]check.
+	checks map[string]*credential.Check
+}
+
+func (o *credentialOpts) addFlags(flags *flag.FlagSet) {
+	flags.StringVarP(&o.credentialPolicy, "credential-policy", "", credential.PolicyIgnore,
+		"check the source credentials are read-only and destination credentials cannot delete (ignore, warn, fail)")
+}
+
+// addSource adds the read-only check of the source registry credential.
+func (o *credentialOpts) addSource(image string) {
+	o.add("source", image, credential.ActionPush, credential.ActionDelete)
+}
+
+// addDestination adds the no-delete check of the destination registry
+// credential.
+func (o *credentialOpts) addDestination(image string) {
+	o.add("destination", image, credential.ActionDelete)
+}
+
+func (o *credentialOpts) add(role, image string, forbidden ...string) {
+	if o.credentialPolicy == "" || o.credentialPolicy == credential.PolicyIgnore {
+		return
+	}
+	if o.checks == nil {
+		o.checks = map[string]*credential.Check{}
+	}
+	registry := utils.GetRegistryName(image)
+	key := role + "/" + registry
+	if _, ok := o.checks[key]; ok {
+		return
+	}
+	o.checks[key] = &credential.Check{
+		Role:     role,
+		Registry: registry,
+		Repository: utils.GetProjectName(image) + "/" +
+			utils.GetImageName(image),
+		Forbidden: forbidden,
+	}
+}
+
+// checkCredentials checks the credential permissions of the registries
+// added by addSource and addDestination.
+func (o *credentialOpts) checkCredentials(
+	ctx context.Context, sysCtx *types.SystemContext,
+) error {
+	keys := make([]string, 0, len(o.checks))
+	for k := range o.checks {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	checks := make([]*credential.Check, 0, len(keys))
+	for _, k := range keys {
+		checks = append(checks, o.checks[k])
+	}
+	return credential.Enforce(ctx, sysCtx, o.credentialPolicy, checks)
+}
@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/cnrancher/hangar/pkg/utils"
+	commonFlag "github.com/containers/common/pkg/flag"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type deleteCmd struct {
+	*baseCmd
+
+	file        string
+	destination string
+	dryRun      bool
+	report      string
+	failed      string
+	statusFile  string
+	jobs        int
+	timeout     time.Duration
+	skipLogin   bool
+	tlsVerify   commonFlag.OptionalBool
+
+	failureOpts
+}
+
+func newDeleteCmd() *deleteCmd {
+	cc := &deleteCmd{}
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "delete -f LIST.txt -d REGISTRY",
+		Short: "Delete the images in image list from destination registry",
+		Long: `Delete the image tags/manifests in image list from destination registry.
+
+The image list format is '[REGISTRY]/[PROJECT]/[NAME]:[TAG]' per line,
+append '@[DIGEST]' after the tag to delete the image only if the manifest
+digest matches.
+
+The deletion results are written into the report file (JSON format).`,
+		Example: `# Preview the images to be deleted:
+hangar delete \
+	--file DELETE_LIST.txt \
+	--destination harbor.example.io \
+	--dry-run
+
+# Delete images in image list:
+hangar delete \
+	--file DELETE_LIST.txt \
+	--destination harbor.example.io \
+	--report delete-report.json \
+	--jobs 5`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+
+			d, err := cc.prepareHangar()
+			if err != nil {
+				return err
+			}
+			err = run(d)
+			if cc.report != "" {
+				if err := utils.SaveJSON(d.Results(), cc.report); err != nil {
+					return fmt.Errorf("failed to save report: %w", err)
+				}
+				logrus.Infof("Deletion report saved to %q", cc.report)
+			}
+			return err
+		},
+	})
+
+	flags := cc.baseCmd.cmd.Flags()
+	flags.StringVarP(&cc.file, "file", "f", "", "image list file")
+	flags.SetAnnotation("file", cobra.BashCompFilenameExt, []string{"txt"})
+	flags.StringVarP(&cc.destination, "destination", "d", "", "override the registry of the images to be deleted")
+	cc.baseCmd.cmd.RegisterFlagCompletionFunc("destination", completeRegistries)
+	flags.BoolVarP(&cc.dryRun, "dry-run", "", false, "output the images to be deleted without deleting them")
+	flags.StringVarP(&cc.report, "report", "", "delete-report.json", "file name of the deletion report (JSON format)")
+	flags.SetAnnotation("report", cobra.BashCompFilenameExt, []string{"json"})
+	flags.StringVarP(&cc.failed, "failed", "o", "delete-failed.txt", "file name of the delete failed image list")
+	flags.SetAnnotation("failed", cobra.BashCompFilenameExt, []string{"txt"})
+	flags.StringVarP(&cc.statusFile, "status-file", "", "", "write the job progress & failures into the status file continuously (JSON format)")
+	flags.SetAnnotation("status-file", cobra.BashCompFilenameExt, []string{"json"})
+	flags.IntVarP(&cc.jobs, "jobs", "j", 1, "worker number, delete images parallelly (1-20)")
+	flags.DurationVarP(&cc.timeout, "timeout", "", time.Minute*5, "timeout when delete each images")
+	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates")
+	flags.BoolVarP(&cc.skipLogin, "skip-login", "", false,
+		"skip check the registry is logged in (used in shell script)")
+	cc.failureOpts.addFlags(flags)
+
+	return cc
+}
+
+func (cc *deleteCmd) prepareHangar() (*hangar.Deleter, error) {
+	if cc.file == "" {
+		return nil, fmt.Errorf("image list file not provided, use '--file' to provide the image list")
+	}
+	file, err := os.Open(cc.file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %v", cc.file, err)
+	}
+	var lines []string
+	sc := bufio.NewScanner(file)
+	sc.Split(bufio.ScanLines)
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") || strings.HasPrefix(l, "//") {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close %q: %v", cc.file, err)
+	}
+	if cc.debug {
+		logrus.Infof("debug mode enabled, force worker number to 1")
+		cc.jobs = 1
+	} else if cc.jobs > utils.MaxWorkerNum || cc.jobs < utils.MinWorkerNum {
+		logrus.Warnf("invalid worker num: %v, set to 1", cc.jobs)
+		cc.jobs = 1
+	}
+
+	sysCtx := cc.baseCmd.newSystemContext()
+	if cc.tlsVerify.Present() {
+		sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!cc.tlsVerify.Value())
+		sysCtx.OCIInsecureSkipTLSVerify = !cc.tlsVerify.Value()
+	}
+
+	if !cc.skipLogin {
+		registrySet := map[string]bool{}
+		if cc.destination != "" {
+			registrySet[cc.destination] = true
+		} else {
+			for _, l := range lines {
+				image, _, _ := strings.Cut(l, "@")
+				registrySet[utils.GetRegistryName(image)] = true
+			}
+		}
+		if err := prepareLogin(
+			signalContext,
+			registrySet,
+			utils.CopySystemContext(sysCtx),
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	maxFailures, err := cc.failureThreshold()
+	if err != nil {
+		return nil, err
+	}
+	policy, err := cc.getPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %w", err)
+	}
+	d, err := hangar.NewDeleter(&hangar.DeleterOpts{
+		CommonOpts: hangar.CommonOpts{
+			Images:              lines,
+			Timeout:             cc.timeout,
+			Workers:             cc.jobs,
+			FailedImageListName: cc.failed,
+			StatusFile:          cc.statusFile,
+			SystemContext:       sysCtx,
+			Policy:              policy,
+			MaxFailures:         maxFailures,
+			KeepGoing:           cc.keepGoing,
+			BatchSize:           cc.batchSize,
+			BreakerThreshold:    cc.breakerThreshold,
+			BreakerCooldown:     cc.breakerCooldown,
+		},
+		DestinationRegistry: cc.destination,
+		DryRun:              cc.dryRun,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deleter: %v", err)
+	}
+	return d, nil
+}
@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/backoff"
+	"github.com/cnrancher/hangar/pkg/hangar"
+	flag "github.com/spf13/pflag"
+)
+
+// failureOpts is the options to abort the job early on failures.
+type failureOpts struct {
+	maxFailures string
+	keepGoing   bool
+	batchSize   int
+
+	breakerThreshold int
+	breakerCooldown  time.Duration
+
+	timeBudget time.Duration
+}
+
+func (o *failureOpts) addFlags(flags *flag.FlagSet) {
+	flags.StringVarP(&o.maxFailures, "max-failures", "", "",
+		"abort the job early if the failed images exceed the count (e.g. 5) or percent (e.g. 5%)")
+	flags.BoolVarP(&o.keepGoing, "keep-going", "", false,
+		"never abort on failures and continue to process other images and platforms (ignores '--max-failures')")
+	flags.IntVarP(&o.batchSize, "batch-size", "", 0,
+		"flush the failed image list and the partial archive index every N images (auto 1000 for lists over 10000 images, -1 to disable)")
+	flags.IntVarP(&o.breakerThreshold, "breaker-threshold", "", backoff.DefaultThreshold,
+		"pause the work targeting the registry after N consecutive server errors (5xx), 0 to disable")
+	flags.DurationVarP(&o.breakerCooldown, "breaker-cooldown", "", backoff.DefaultCooldown,
+		"duration to pause the work targeting the registry returning sustained server errors")
+	flags.DurationVarP(&o.timeBudget, "time-budget", "", 0,
+		"stop copying the standard and optional tier images after the duration (e.g. 1h), the critical tier images are always copied")
+}
+
+// failureThreshold parses the '--max-failures' option.
+func (o *failureOpts) failureThreshold() (*hangar.FailureThreshold, error) {
+	return hangar.ParseFailureThreshold(o.maxFailures)
+}
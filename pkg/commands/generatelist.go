@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"os"
 	"sort"
 	"strings"
 
 	"github.com/cnrancher/hangar/pkg/cmdconfig"
 	"github.com/cnrancher/hangar/pkg/rancher/chartimages"
 	"github.com/cnrancher/hangar/pkg/rancher/listgenerator"
+	"github.com/cnrancher/hangar/pkg/rancher/productimages"
+	"github.com/cnrancher/hangar/pkg/rancher/workloadimages"
 	"github.com/cnrancher/hangar/pkg/utils"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -21,7 +24,11 @@ type generateListCmd struct {
 
 	isRPMGC        bool
 	rancherVersion string
-	generator      *listgenerator.Generator
+	// sourceOverrides is the registry override of components,
+	// map[component]registry
+	sourceOverrides map[string]string
+	opts            *listgenerator.GeneratorOpts
+	result          *listgenerator.Result
 }
 
 func newGenerateListCmd() *generateListCmd {
@@ -42,7 +49,42 @@ Generate image-list from custom cloned chart repos & KDM data.json file.
         --rancher="v2.8.0" \
         --chart="./chart-repo-dir" \
         --system-chart="./system-chart-repo-dir" \
-        --kdm="./kdm-data.json"`,
+        --kdm="./kdm-data.json"
+
+Include images of deployed workloads from rancher-backup tarball:
+
+    hangar generate-list \
+        --rancher="v2.8.0" \
+        --workload="./rancher-backup.tar.gz"
+
+Include images of the workloads annotated in kubernetes manifests only:
+
+    hangar generate-list \
+        --rancher="v2.8.0" \
+        --workload="./gitops-repo/" \
+        --workload-annotation="hangar.cattle.io/mirror=true"
+
+Merge the RKE2/K3s airgap image lists published upstream:
+
+    hangar generate-list \
+        --rancher="v2.8.0" \
+        --rke2="v1.28.9+rke2r1" \
+        --k3s="v1.28.9+k3s1"
+
+Include the images of co-deployed products at pinned versions:
+
+    hangar generate-list \
+        --rancher="v2.8.0" \
+        --product="longhorn=v1.5.3" \
+        --product="harvester=v1.2.1" \
+        --product-config="./products.yaml"
+
+Override the registry of the images per component (project name or repository):
+
+    hangar generate-list \
+        --rancher="v2.8.0" \
+        --source-override="rancher=registry.rancher.com" \
+        --source-override="neuvector=docker.io"`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
 			if cc.baseCmd.debug {
@@ -68,16 +110,34 @@ Generate image-list from custom cloned chart repos & KDM data.json file.
 		},
 	})
 	cc.cmd.Flags().StringP("registry", "", "", "customize the registry URL of generated image list")
+	cc.cmd.Flags().StringSliceP("source-override", "", nil, "override the registry of the component "+
+		"in format 'COMPONENT=REGISTRY' (takes precedence over '--registry')")
 	cc.cmd.Flags().StringP("kdm", "", "", "KDM file path or URL")
 	cc.cmd.Flags().StringP("output", "o", "", "output generated image list file (default \"[RANCHER_VERSION]-images.txt\")")
 	cc.cmd.Flags().StringP("output-linux", "", "", "generate linux image list")
 	cc.cmd.Flags().StringP("output-windows", "", "", "generate windows image list")
 	cc.cmd.Flags().StringP("output-source", "", "", "generate image list with image source")
+	cc.cmd.Flags().StringP("output-graph", "", "", "generate image origin graph (chart -> subchart -> image, "+
+		"KDM -> k8s version -> component -> image)")
+	cc.cmd.Flags().StringP("graph-format", "", "", "format of the image origin graph: dot, json "+
+		"(default detected by the '--output-graph' file extension)")
 	cc.cmd.Flags().StringP("rancher", "", "", "rancher version (semver with 'v' prefix) "+
 		"(use '-ent' suffix to distinguish with Rancher Prime Manager GC) (required)")
 	cc.cmd.Flags().BoolP("dev", "", false, "switch to dev branch/URL of charts & KDM data")
 	cc.cmd.Flags().StringSliceP("chart", "", nil, "cloned chart repo path (URL is not supported)")
 	cc.cmd.Flags().StringSliceP("system-chart", "", nil, "cloned system chart repo path (URL is not supported)")
+	cc.cmd.Flags().IntP("jobs", "j", listgenerator.DefaultWorkers, "worker number, process charts & KDM data parallelly (1-20)")
+	cc.cmd.Flags().StringP("chart-cache", "", chartimages.DefaultCacheDir(), "directory to cache the chart image "+
+		"extraction results (set to empty string to disable cache)")
+	cc.cmd.Flags().StringSliceP("workload", "", nil, "rancher-backup tarball or kubernetes manifest file/directory "+
+		"to include images of deployed workloads")
+	cc.cmd.Flags().StringP("workload-annotation", "", "", "only include images of the workload resources annotated "+
+		fmt.Sprintf("in format 'KEY[=VALUE]' (example: %s=true)", workloadimages.SelectAnnotation))
+	cc.cmd.Flags().StringSliceP("rke2", "", nil, "RKE2 release version to include its airgap image list (example: v1.28.9+rke2r1)")
+	cc.cmd.Flags().StringSliceP("k3s", "", nil, "K3s release version to include its airgap image list (example: v1.28.9+k3s1)")
+	cc.cmd.Flags().StringSliceP("product", "", nil, "product images to include in format 'NAME=VERSION' "+
+		fmt.Sprintf("(built-in: %v)", productimages.Providers()))
+	cc.cmd.Flags().StringP("product-config", "", "", "config file declaring the products (name, version, url/chart) to include")
 
 	return cc
 }
@@ -102,6 +162,17 @@ func (cc *generateListCmd) setupFlags() error {
 		return fmt.Errorf("%q is not valid semver", cc.rancherVersion)
 	}
 
+	cc.sourceOverrides = make(map[string]string)
+	for _, s := range cmdconfig.GetStringSlice("source-override") {
+		component, registry, ok := strings.Cut(s, "=")
+		component = strings.Trim(strings.TrimSpace(component), "/")
+		registry = strings.TrimSpace(registry)
+		if !ok || component == "" || registry == "" {
+			return fmt.Errorf("invalid source override %q, should be 'COMPONENT=REGISTRY'", s)
+		}
+		cc.sourceOverrides[component] = registry
+	}
+
 	if cmdconfig.GetString("output") == "" {
 		output := cc.rancherVersion + "-images.txt"
 		cmdconfig.Set("output", output)
@@ -111,29 +182,31 @@ func (cc *generateListCmd) setupFlags() error {
 }
 
 func (cc *generateListCmd) prepareGenerator() error {
-	cc.generator = &listgenerator.Generator{
+	cc.opts = &listgenerator.GeneratorOpts{
 		RancherVersion: cc.rancherVersion,
 		MinKubeVersion: "",
 		ChartsPaths:    make(map[string]chartimages.ChartRepoType),
-		ChartURLs: make(map[string]struct {
-			Type   chartimages.ChartRepoType
-			Branch string
-		}),
+		ChartURLs:      make(map[string]listgenerator.ChartURL),
+		Progress: func(e listgenerator.ProgressEvent) {
+			if e.Done {
+				logrus.Debugf("stage %q finished in %v", e.Stage, e.Elapsed)
+			}
+		},
 	}
-	switch {
-	case utils.SemverMajorMinorEqual(cc.rancherVersion, "v2.5"):
-		cc.generator.MinKubeVersion = ""
-	case utils.SemverMajorMinorEqual(cc.rancherVersion, "v2.6"):
-		cc.generator.MinKubeVersion = "v1.21.0"
-	case utils.SemverMajorMinorEqual(cc.rancherVersion, "v2.7"):
-		cc.generator.MinKubeVersion = "v1.21.0"
+	cc.opts.ChartCacheDir = cmdconfig.GetString("chart-cache")
+	cc.opts.Workers = cmdconfig.GetInt("jobs")
+	if cc.opts.Workers > utils.MaxWorkerNum || cc.opts.Workers < utils.MinWorkerNum {
+		logrus.Warnf("invalid worker num: %v, set to %v",
+			cc.opts.Workers, listgenerator.DefaultWorkers)
+		cc.opts.Workers = listgenerator.DefaultWorkers
 	}
+	cc.opts.MinKubeVersion = minKubeVersion(cc.rancherVersion)
 	kdm := cmdconfig.GetString("kdm")
 	if kdm != "" {
 		if _, err := url.ParseRequestURI(kdm); err != nil {
-			cc.generator.KDMPath = kdm
+			cc.opts.KDMPath = kdm
 		} else {
-			cc.generator.KDMURL = kdm
+			cc.opts.KDMURL = kdm
 		}
 	}
 
@@ -142,12 +215,9 @@ func (cc *generateListCmd) prepareGenerator() error {
 		for _, chart := range charts {
 			if _, err := url.ParseRequestURI(chart); err != nil {
 				logrus.Debugf("add chart path to load images: %q", chart)
-				cc.generator.ChartsPaths[chart] = chartimages.RepoTypeDefault
+				cc.opts.ChartsPaths[chart] = chartimages.RepoTypeDefault
 			} else {
-				// cc.generator.ChartURLs[chart] = struct {
-				// 	Type   chartimages.ChartRepoType
-				// 	Branch string
-				// }{
+				// cc.opts.ChartURLs[chart] = listgenerator.ChartURL{
 				// 	Type:   chartimages.RepoTypeDefault,
 				// 	Branch: "", // use default branch
 				// }
@@ -160,12 +230,33 @@ func (cc *generateListCmd) prepareGenerator() error {
 		for _, chart := range systemCharts {
 			if _, err := url.ParseRequestURI(chart); err != nil {
 				logrus.Debugf("add system chart path to load images: %q", chart)
-				cc.generator.ChartsPaths[chart] = chartimages.RepoTypeSystem
+				cc.opts.ChartsPaths[chart] = chartimages.RepoTypeSystem
 			} else {
 				return fmt.Errorf("chart url is not supported, please provide the cloned chart path")
 			}
 		}
 	}
+	cc.opts.WorkloadPaths = cmdconfig.GetStringSlice("workload")
+	cc.opts.WorkloadAnnotation = cmdconfig.GetString("workload-annotation")
+	if cc.opts.WorkloadAnnotation != "" && len(cc.opts.WorkloadPaths) == 0 {
+		return fmt.Errorf("'--workload-annotation' requires '--workload' to be specified")
+	}
+	cc.opts.RKE2Versions = cmdconfig.GetStringSlice("rke2")
+	cc.opts.K3sVersions = cmdconfig.GetStringSlice("k3s")
+	for _, s := range cmdconfig.GetStringSlice("product") {
+		p, err := productimages.Parse(s)
+		if err != nil {
+			return err
+		}
+		cc.opts.Products = append(cc.opts.Products, p)
+	}
+	if c := cmdconfig.GetString("product-config"); c != "" {
+		products, err := productimages.LoadConfig(c)
+		if err != nil {
+			return err
+		}
+		cc.opts.Products = append(cc.opts.Products, products...)
+	}
 	dev := cmdconfig.GetBool("dev")
 	if kdm == "" && len(charts) == 0 && len(systemCharts) == 0 {
 		if dev {
@@ -173,25 +264,19 @@ func (cc *generateListCmd) prepareGenerator() error {
 		} else {
 			logrus.Info("using release branch")
 		}
-		if cc.isRPMGC {
-			logrus.Debugf("add RPM GC charts & KDM to generate list")
-			addRPMCharts(cc.rancherVersion, cc.generator, dev)
-			addRPMGCCharts(cc.rancherVersion, cc.generator, dev)
-			addRPMGCSystemCharts(cc.rancherVersion, cc.generator, dev)
-			addRancherPrimeManagerGCKontainerDriverMetadata(cc.rancherVersion, cc.generator, dev)
-		} else {
-			logrus.Debugf("add RPM charts & KDM to generate list")
-			addRPMCharts(cc.rancherVersion, cc.generator, dev)
-			addRPMSystemCharts(cc.rancherVersion, cc.generator, dev)
-			addRancherPrimeManagerKontainerDriverMetadata(cc.rancherVersion, cc.generator, dev)
-		}
+		addDefaultSources(cc.rancherVersion, cc.opts, cc.isRPMGC, dev)
 	}
 
 	return nil
 }
 
 func (cc *generateListCmd) run(ctx context.Context) error {
-	return cc.generator.Generate(ctx)
+	g, err := listgenerator.NewGenerator(cc.opts)
+	if err != nil {
+		return err
+	}
+	cc.result, err = g.Generate(ctx)
+	return err
 }
 
 func (cc *generateListCmd) finish() error {
@@ -199,29 +284,23 @@ func (cc *generateListCmd) finish() error {
 	imagesLinuxSet := map[string]bool{}
 	imagesWindowsSet := map[string]bool{}
 	var imageSources = make([]string, 0,
-		len(cc.generator.GeneratedLinuxImages)+
-			len(cc.generator.GeneratedWindowsImages))
+		len(cc.result.LinuxImages)+
+			len(cc.result.WindowsImages))
 
 	registry := cmdconfig.GetString("registry")
-	for image := range cc.generator.GeneratedLinuxImages {
-		imgWithRegistry := image
-		if registry != "" {
-			imgWithRegistry = utils.ConstructRegistry(image, registry)
-		}
+	for _, image := range cc.result.LinuxImages {
+		imgWithRegistry := cc.constructRegistry(image.Name, registry)
 		imagesLinuxSet[imgWithRegistry] = true
 		imageSources = append(imageSources,
 			fmt.Sprintf("%s %s", imgWithRegistry,
-				getSourcesList(cc.generator.GeneratedLinuxImages[image])))
+				strings.Join(image.Sources, ",")))
 	}
-	for image := range cc.generator.GeneratedWindowsImages {
-		imgWithRegistry := image
-		if registry != "" {
-			imgWithRegistry = utils.ConstructRegistry(image, registry)
-		}
+	for _, image := range cc.result.WindowsImages {
+		imgWithRegistry := cc.constructRegistry(image.Name, registry)
 		imagesWindowsSet[imgWithRegistry] = true
 		imageSources = append(imageSources,
 			fmt.Sprintf("%s %s", imgWithRegistry,
-				getSourcesList(cc.generator.GeneratedWindowsImages[image])))
+				strings.Join(image.Sources, ",")))
 	}
 	var imagesAllSet = map[string]bool{}
 	var imagesLinuxList = make([]string, 0, len(imagesLinuxSet))
@@ -293,14 +372,49 @@ func (cc *generateListCmd) finish() error {
 			logrus.Error(err)
 		}
 	}
+	outputGraph := cmdconfig.GetString("output-graph")
+	if outputGraph != "" {
+		if err := cc.saveGraph(outputGraph); err != nil {
+			logrus.Error(err)
+		}
+	}
+	return nil
+}
+
+func (cc *generateListCmd) saveGraph(name string) error {
+	format := listgenerator.GraphFormat(strings.ToLower(cmdconfig.GetString("graph-format")))
+	if format == "" {
+		format = listgenerator.GraphFormatDOT
+		if strings.HasSuffix(strings.ToLower(name), ".json") {
+			format = listgenerator.GraphFormatJSON
+		}
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to create %q: %w", name, err)
+	}
+	defer f.Close()
+	if err := cc.result.Graph().Write(f, format); err != nil {
+		return fmt.Errorf("failed to write image origin graph: %w", err)
+	}
+	logrus.Infof("image origin graph saved to %q", name)
 	return nil
 }
 
-func getSourcesList(imageSources map[string]bool) string {
-	var sources []string
-	for source := range imageSources {
-		sources = append(sources, source)
+// constructRegistry sets the registry of the image, the source override of
+// the image repository or project name takes precedence over the registry.
+func (cc *generateListCmd) constructRegistry(image, registry string) string {
+	if len(cc.sourceOverrides) > 0 {
+		repository := utils.GetProjectName(image) + "/" + utils.GetImageName(image)
+		if r, ok := cc.sourceOverrides[repository]; ok {
+			return utils.ConstructRegistry(image, r)
+		}
+		if r, ok := cc.sourceOverrides[utils.GetProjectName(image)]; ok {
+			return utils.ConstructRegistry(image, r)
+		}
+	}
+	if registry == "" {
+		return image
 	}
-	sort.Strings(sources)
-	return strings.Join(sources, ",")
+	return utils.ConstructRegistry(image, registry)
 }
@@ -2,11 +2,25 @@ package commands
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/cnrancher/hangar/pkg/audit"
+	"github.com/cnrancher/hangar/pkg/backoff"
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
 	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/cnrancher/hangar/pkg/history"
+	"github.com/cnrancher/hangar/pkg/incluster"
+	"github.com/cnrancher/hangar/pkg/logger"
+	"github.com/cnrancher/hangar/pkg/oidc"
+	"github.com/cnrancher/hangar/pkg/progress"
+	"github.com/cnrancher/hangar/pkg/rundb"
+	"github.com/cnrancher/hangar/pkg/utils"
 	"github.com/containers/common/pkg/auth"
 	"github.com/containers/common/pkg/retry"
 	"github.com/containers/image/v5/pkg/docker/config"
@@ -19,8 +33,23 @@ func Execute(args []string) error {
 	hangarCmd := newHangarCmd()
 	hangarCmd.addCommands()
 	hangarCmd.cmd.SetArgs(args)
+	if err := execPlugin(hangarCmd.cmd, args); err != nil {
+		return err
+	}
 
 	_, err := hangarCmd.cmd.ExecuteC()
+	if logCloser != nil {
+		logCloser.Close()
+	}
+	if auditCloser != nil {
+		auditCloser.Close()
+	}
+	if proxyAuthCloser != nil {
+		proxyAuthCloser.Close()
+	}
+	if progressCloser != nil {
+		progressCloser.Close()
+	}
 	if err != nil {
 		if signalContext.Err() != nil {
 			return signalContext.Err()
@@ -30,8 +59,52 @@ func Execute(args []string) error {
 	return nil
 }
 
+// logCloser closes the log file after command executed.
+var logCloser io.Closer
+
+// slowestImages is the number of the slowest images output in the
+// timing report after the job finished.
+var slowestImages int
+
+// exportDBFile is the SQLite database to export the run data into.
+var exportDBFile string
+
+// auditCloser closes the audit log file after command executed.
+var auditCloser io.Closer
+
+// progressCloser stops the progress output after command executed.
+var progressCloser io.Closer
+
+// copyCommands is the commands copying the images, the blob progress
+// reporter is only created for these commands.
+var copyCommands = map[string]bool{
+	"mirror":               true,
+	"save":                 true,
+	"load":                 true,
+	"sync":                 true,
+	"rancher upgrade-plan": true,
+	"operator":             true,
+}
+
+// historyOpts is the options to record the run history.
+var historyOpts = struct {
+	// command is the executing command name, e.g. 'mirror', 'save'.
+	command string
+	file    string
+	disable bool
+}{}
+
 type hangarCmd struct {
 	*baseCmd
+
+	logOpts  logger.Options
+	color    string
+	progress string
+	config   string
+	profile  string
+
+	auditOpts audit.Options
+	proxyAuth proxyAuthOpts
 }
 
 func newHangarCmd() *hangarCmd {
@@ -45,6 +118,63 @@ Aiming to simplify the process of copying container images between registries.
 
 https://hangar.cnrancher.com
 `,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := logger.SetColor(cc.color); err != nil {
+				return err
+			}
+			if err := cc.applyConfig(cmd); err != nil {
+				return err
+			}
+			var err error
+			logCloser, err = logger.SetupFile(&cc.logOpts)
+			historyOpts.command = strings.TrimPrefix(
+				cmd.CommandPath(), cc.cmd.Name()+" ")
+			if historyOpts.file == "" {
+				historyOpts.file = history.DefaultPath()
+			}
+			if err != nil {
+				return err
+			}
+			if len(cc.baseCmd.insecureRegistries) > 0 {
+				cc.baseCmd.registriesConf, err = insecureRegistriesConf(
+					cc.baseCmd.insecureRegistries)
+				if err != nil {
+					return err
+				}
+			}
+			if exportDBFile != "" {
+				if err := rundb.Check(); err != nil {
+					return fmt.Errorf("invalid '--export-db': %w", err)
+				}
+			}
+			cc.auditOpts.Command = historyOpts.command
+			auditLogger, err := audit.New(&cc.auditOpts)
+			if err != nil {
+				return err
+			}
+			if auditLogger != nil {
+				audit.SetDefault(auditLogger)
+				auditCloser = auditLogger
+			}
+			if copyCommands[historyOpts.command] {
+				reporter, err := progress.New(cc.progress)
+				if err != nil {
+					return err
+				}
+				if reporter != nil {
+					progress.SetDefault(reporter)
+					logrus.SetOutput(reporter.Writer(logrus.StandardLogger().Out))
+					progressCloser = reporter
+				}
+			}
+			// The proxy environment variables are read once by the HTTP
+			// transport, the connector must start before any request.
+			proxyAuthCloser, err = cc.proxyAuth.start()
+			if err != nil {
+				return err
+			}
+			return nil
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			cmd.Help()
 		},
@@ -56,10 +186,85 @@ https://hangar.cnrancher.com
 	flags := cc.cmd.PersistentFlags()
 	flags.BoolVarP(&cc.baseCmd.debug, "debug", "", false, "enable debug output")
 	flags.BoolVar(&cc.baseCmd.insecurePolicy, "insecure-policy", false, "run Hangar without policy check")
+	flags.StringVar(&cc.baseCmd.policyPath, "policy", "", "path to the signature verification policy file")
+	flags.StringVar(&cc.baseCmd.authFile, "authfile", "", "path to the registry auth file")
+	flags.StringSliceVar(&cc.baseCmd.insecureRegistries, "insecure-registry", nil,
+		"registries to skip the TLS verify and allow plain HTTP (e.g. '10.0.0.5:5000'), can be specified multiple times")
+	flags.StringVar(&cc.config, "config", "", "path to the config file (default \"$XDG_CONFIG_HOME/hangar/config.yaml\")")
+	flags.StringVar(&cc.profile, "profile", "", "use the flags predefined in the profile of the config file")
+	flags.StringVar(&cc.logOpts.File, "log-file", "", "write logs of all levels into the log file")
+	flags.IntVar(&cc.logOpts.MaxSize, "log-max-size", 100, "max size in MiB of the log file before rotation (0: no rotation)")
+	flags.IntVar(&cc.logOpts.MaxBackups, "log-max-backups", 3, "max number of rotated log files to retain")
+	flags.StringVar(&cc.color, "color", logger.ColorAuto, "colorize the output (auto, always, never)")
+	flags.StringVar(&cc.progress, "progress", progress.ModeAuto,
+		"output the blob progress of the image copies (auto: progress bars if the output is terminal or none otherwise, plain: periodic progress logs, none)")
+	flags.StringVar(&historyOpts.file, "history-file", "", "file to record the run history (default \"$XDG_CONFIG_HOME/hangar/history.jsonl\")")
+	flags.BoolVar(&historyOpts.disable, "no-history", false, "do not record the run history")
+	flags.IntVar(&slowestImages, "slowest", 0, "output the timing histogram and the N slowest images with phase breakdown")
+	flags.StringVar(&exportDBFile, "export-db", "",
+		"export the images, platforms, layers, failures and timings of the run into the SQLite database (e.g. run.sqlite), requires hangar built with cgo")
+	flags.StringVar(&cc.auditOpts.File, "audit-log", "", "append the audit events of push, delete and retag operations into the file")
+	flags.StringVar(&cc.auditOpts.Endpoint, "audit-endpoint", "", "HTTP endpoint to POST the audit events to")
+	cc.proxyAuth.addFlags(flags)
 
 	return cc
 }
 
+// applyConfig sets the flags of the executing command by the profile and
+// the defaults in config file, the flags specified in command line are not
+// overridden, and the profile has higher priority than the defaults.
+func (cc *hangarCmd) applyConfig(cmd *cobra.Command) error {
+	path := cc.config
+	if path == "" {
+		path = cmdconfig.DefaultConfigPath()
+		if _, err := os.Stat(path); err != nil && cc.profile == "" {
+			// The default config file is optional.
+			return nil
+		}
+	}
+	config, err := cmdconfig.LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	if cc.profile != "" {
+		profile, err := config.Profile(cc.profile)
+		if err != nil {
+			return err
+		}
+		if err := setProfileFlags(cmd, fmt.Sprintf("profile %q", cc.profile), profile); err != nil {
+			return err
+		}
+		logrus.Debugf("applied profile %q of config %q", cc.profile, path)
+	}
+	return setProfileFlags(cmd, "defaults", config.Defaults)
+}
+
+// setProfileFlags sets the flags of the command not changed yet by the
+// profile values.
+func setProfileFlags(cmd *cobra.Command, name string, profile cmdconfig.Profile) error {
+	values, err := profile.Flags()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	flags := cmd.Flags()
+	for key, value := range values {
+		f := flags.Lookup(key)
+		if f == nil {
+			logrus.Debugf("%s: skip flag %q: not supported by %q",
+				name, key, cmd.CommandPath())
+			continue
+		}
+		if f.Changed {
+			// Flags in command line have higher priority.
+			continue
+		}
+		if err := flags.Set(key, value); err != nil {
+			return fmt.Errorf("%s: invalid value of flag %q: %w", name, key, err)
+		}
+	}
+	return nil
+}
+
 func (cc *hangarCmd) getCommand() *cobra.Command {
 	return cc.cmd
 }
@@ -74,39 +279,335 @@ func (cc *hangarCmd) addCommands() {
 		newSaveCmd(),
 		newLoadCmd(),
 		newSyncCmd(),
+		newRetagCmd(),
+		newDeleteCmd(),
+		newTestPullCmd(),
+		newReportCmd(),
+		newPluginCmd(),
 		newArchiveCmd(),
 		newInspectCmd(),
 		newConvertListCmd(),
 		newGenerateListCmd(),
+		newK8sCmd(),
+		newOperatorCmd(),
+		newRancherCmd(),
+		newConfigCmd(&cc.config),
+		newRegistryCmd(),
+		newTagsCmd(),
+		newReposCmd(),
+		newProxyCmd(),
 	)
 }
 
 // run executes hangar.Run()
 func run(h hangar.Hangar) error {
 	if err := h.Run(signalContext); err != nil {
+		recordHistory(h, err)
+		exportRunDB(h, err)
+		printResult(h, "copied", err)
 		// Error occurred while run, save copy failed image to file.
 		if err := h.SaveFailedImages(); err != nil {
 			return err
 		}
 		return err
 	}
+	recordHistory(h, nil)
+	exportRunDB(h, nil)
+	printResult(h, "copied", nil)
 	logrus.Infof("Done")
 	return nil
 }
 
+// recordHistory appends the run summary into the history file.
+func recordHistory(h hangar.Hangar, runErr error) {
+	if historyOpts.disable || historyOpts.file == "" {
+		return
+	}
+	s, ok := h.(interface{ Summary() *hangar.Summary })
+	if !ok {
+		return
+	}
+	summary := s.Summary()
+	r := &history.Record{
+		Command:      historyOpts.command,
+		RunID:        summary.RunID,
+		Result:       history.ResultSucceeded,
+		StartTime:    summary.StartTime,
+		Duration:     summary.Duration,
+		Total:        summary.Total,
+		Succeeded:    summary.Succeeded,
+		Failed:       summary.Failed,
+		FailedImages: summary.FailedImages,
+		Images:       summary.Images,
+	}
+	if runErr != nil {
+		r.Result = history.ResultFailed
+	}
+	if summary.ImageList != nil {
+		r.ImageList = summary.ImageList.Source
+		r.ImageListCommit = summary.ImageList.Commit
+	}
+	switch h := h.(type) {
+	case *hangar.Saver:
+		r.Archive = h.ArchiveName
+	case *hangar.Syncer:
+		r.Archive = h.ArchiveName
+	case *hangar.Loader:
+		r.Archive = h.ArchiveName
+	}
+	if r.Archive != "" {
+		if info, err := os.Stat(r.Archive); err == nil {
+			r.Size = info.Size()
+		}
+	}
+	if err := history.Append(historyOpts.file, r); err != nil {
+		logrus.Warnf("failed to record run history: %v", err)
+	}
+}
+
+// exportRunDB exports the run data into the SQLite database of
+// '--export-db'.
+func exportRunDB(h hangar.Hangar, runErr error) {
+	if exportDBFile == "" {
+		return
+	}
+	s, ok := h.(interface{ Summary() *hangar.Summary })
+	if !ok {
+		return
+	}
+	result := history.ResultSucceeded
+	if runErr != nil {
+		result = history.ResultFailed
+	}
+	if err := rundb.Export(exportDBFile, historyOpts.command, result, s.Summary()); err != nil {
+		logrus.Warnf("failed to export run data: %v", err)
+		return
+	}
+	logrus.Infof("Run data exported into database [%v]", exportDBFile)
+}
+
 // validate executes hangar.Validate()
 func validate(h hangar.Hangar) error {
 	if err := h.Validate(signalContext); err != nil {
+		exportRunDB(h, err)
+		printResult(h, "passed", err)
 		// Error occurred while validate, save validate failed image to file.
 		if err := h.SaveFailedImages(); err != nil {
 			return err
 		}
 		return err
 	}
+	exportRunDB(h, nil)
+	printResult(h, "passed", nil)
 	logrus.Infof("Done")
 	return nil
 }
 
+// printResult outputs the summary section and the machine-parsable
+// final result line to stdout regardless of the log level:
+//
+//	RESULT command=mirror status=succeeded total=10 copied=9 failed=1 duration=12.3s
+func printResult(h hangar.Hangar, succeededKey string, runErr error) {
+	s, ok := h.(interface{ Summary() *hangar.Summary })
+	if !ok {
+		return
+	}
+	summary := s.Summary()
+	status := history.ResultSucceeded
+	if runErr != nil {
+		status = history.ResultFailed
+	}
+
+	logger.Section("SUMMARY")
+	if summary.ImageList != nil {
+		logrus.Infof("Image list: %v (commit %v)",
+			summary.ImageList.Source, summary.ImageList.Commit)
+	}
+	logrus.Infof("Total: %d", summary.Total)
+	logrus.Infof("%s: %s", strings.ToUpper(succeededKey[:1])+succeededKey[1:],
+		logger.Colorize(fmt.Sprintf("%d", summary.Succeeded), logger.Green))
+	if summary.Failed > 0 {
+		logrus.Infof("Failed: %s",
+			logger.Colorize(fmt.Sprintf("%d", summary.Failed), logger.Bold, logger.Red))
+	} else {
+		logrus.Infof("Failed: 0")
+	}
+	for _, l := range summary.ImageLists {
+		logrus.Infof("  [%v] total %d, failed %d", l.Name, l.Total, l.Failed)
+		for _, f := range l.FailedImages {
+			logrus.Warnf("    failed: %v", f)
+		}
+	}
+	logrus.Infof("Duration: %v", summary.Duration.Round(time.Millisecond))
+	if summary.RunID != "" {
+		logrus.Infof("Run ID: %v", summary.RunID)
+	}
+	if summary.ExcludedAttestations > 0 {
+		logrus.Infof("Excluded attestations: %d (use '--include-attestations' to copy)",
+			summary.ExcludedAttestations)
+	}
+	if summary.ContentStoreBlobs > 0 {
+		logrus.Infof("Blobs read from local content store: %d (%s)",
+			summary.ContentStoreBlobs, utils.FormatSize(summary.ContentStoreBytes))
+	}
+	if len(summary.DigestDrifts) > 0 {
+		logrus.Warnf("Digest drifts: %d (manifests rewritten by the destination registry)",
+			len(summary.DigestDrifts))
+	}
+	if len(summary.PlatformMismatches) > 0 {
+		logrus.Warnf("Platform mismatches: %d (image config does not match the index platform)",
+			len(summary.PlatformMismatches))
+		for _, m := range summary.PlatformMismatches {
+			logrus.Warnf("  %v: index %v, config %v", m.Image, m.Index, m.Config)
+		}
+	}
+	if summary.BudgetSkipped > 0 {
+		logrus.Warnf("Skipped by time budget: %d (non-critical images, exported to the failed image list)",
+			summary.BudgetSkipped)
+	}
+	if summary.Unchanged > 0 {
+		logrus.Infof("Skipped unchanged: %d (source digest not changed since last run)",
+			summary.Unchanged)
+	}
+	if len(summary.SkippedOptional) > 0 {
+		logrus.Infof("Skipped optional: %d", len(summary.SkippedOptional))
+		for _, o := range summary.SkippedOptional {
+			logrus.Infof("  %v: %v", o.Image, o.Reason)
+		}
+	}
+	if len(summary.Suggestions) > 0 {
+		logrus.Warnf("Images not found with suggested corrections: %d", len(summary.Suggestions))
+		for _, s := range summary.Suggestions {
+			logrus.Warnf("  %v => %v", s.Image, strings.Join(s.Suggestions, ", "))
+		}
+	}
+	printTimings(summary.Timings, slowestImages)
+	printCompliance(summary.DeprecatedImages)
+	if g, ok := h.(interface{ PlatformGaps() []*hangar.PlatformGap }); ok {
+		printPlatformGaps(g.PlatformGaps())
+	}
+
+	fmt.Fprintf(os.Stdout, "RESULT command=%s status=%s total=%d %s=%d failed=%d duration=%.1fs\n",
+		strings.ReplaceAll(historyOpts.command, " ", "-"), status,
+		summary.Total, succeededKey, summary.Succeeded, summary.Failed,
+		summary.Duration.Seconds())
+}
+
+// printTimings outputs the image duration histogram and the n slowest
+// images with phase breakdown.
+func printTimings(timings []*hangar.ImageTiming, n int) {
+	if n <= 0 || len(timings) == 0 {
+		return
+	}
+	logger.Section("TIMING")
+	var lower time.Duration
+	for _, b := range hangar.TimingHistogram(timings) {
+		if b.Le == 0 {
+			logrus.Infof("  >= %-6v %d", lower, b.Count)
+			continue
+		}
+		logrus.Infof("  <  %-6v %d", b.Le, b.Count)
+		lower = b.Le
+	}
+	if n > len(timings) {
+		n = len(timings)
+	}
+	logrus.Infof("Slowest %d images:", n)
+	for _, t := range timings[:n] {
+		phases := make([]string, 0, len(t.Phases))
+		for _, p := range []string{
+			hangar.PhaseInspect, hangar.PhasePull, hangar.PhaseCopy,
+			hangar.PhasePush, hangar.PhaseArchive,
+		} {
+			if d, ok := t.Phases[p]; ok {
+				phases = append(phases, fmt.Sprintf("%s=%v", p, d.Round(time.Millisecond)))
+			}
+		}
+		logrus.Infof("  %v [%v] (%v)", t.Duration.Round(time.Millisecond),
+			t.Image, strings.Join(phases, " "))
+	}
+}
+
+// printPlatformGaps outputs the consolidated report of the images
+// missing the requested platforms.
+// printCompliance outputs the images still published as Docker schema1 or
+// with deprecated layer media types, and the media types converted to.
+func printCompliance(images []hangar.DeprecatedImage) {
+	if len(images) == 0 {
+		return
+	}
+	logger.Section("COMPLIANCE")
+	logrus.Warnf("Deprecated media types: %d (ask the upstreams to republish the images)", len(images))
+	for _, d := range images {
+		if d.ConvertedTo == d.MediaType {
+			logrus.Warnf("  [%v] %v: %v (kept as-is)", d.Image, d.Platform, d.MediaType)
+			continue
+		}
+		logrus.Warnf("  [%v] %v: %v => %v", d.Image, d.Platform, d.MediaType, d.ConvertedTo)
+	}
+}
+
+func printPlatformGaps(gaps []*hangar.PlatformGap) {
+	if len(gaps) == 0 {
+		return
+	}
+	logger.Section("PLATFORM FALLBACK")
+	for _, g := range gaps {
+		logrus.Infof("  [%v] missing %s", g.Image, strings.Join(g.Missing, ","))
+		for _, f := range g.Fallbacks {
+			logrus.Infof("    fallback: [%v]", f)
+		}
+		if g.Error != "" {
+			logrus.Warnf("    fallback not copied: %v", g.Error)
+		}
+	}
+}
+
+// detectChanges executes hangar.DetectChanges(), outputs the changes in
+// JSON format and returns hangar.ErrChangesDetected if changes detected.
+func detectChanges(h hangar.Hangar) error {
+	d, ok := h.(hangar.ChangeDetector)
+	if !ok {
+		return fmt.Errorf("detect changes is not supported")
+	}
+	changes, err := d.DetectChanges(signalContext)
+	if err != nil {
+		if err := h.SaveFailedImages(); err != nil {
+			return err
+		}
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	b, err := json.MarshalIndent(changes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal changes: %w", err)
+	}
+	fmt.Println(string(b))
+	return hangar.ErrChangesDetected
+}
+
+// dryRun outputs the platform images would be copied and their total size
+// without performing any writes.
+func dryRun(h hangar.Hangar) error {
+	d, ok := h.(hangar.DryRunner)
+	if !ok {
+		return fmt.Errorf("dry run is not supported")
+	}
+	plan, err := d.DryRun(signalContext)
+	if plan != nil {
+		fmt.Printf("%4s | %-60s | %-16s | %-71s | %10s\n",
+			"#", "SOURCE", "PLATFORM", "DIGEST", "SIZE")
+		for i, img := range plan.Images {
+			fmt.Printf("%4d | %-60s | %-16s | %-71s | %10s\n",
+				i+1, img.Source, img.Platform, img.Digest, utils.FormatSize(img.Size))
+		}
+		fmt.Printf("Total: %d images, %v\n", len(plan.Images), utils.FormatSize(plan.Total))
+	}
+	return err
+}
+
 func prepareLogin(
 	ctx context.Context,
 	registrySet map[string]bool,
@@ -116,6 +617,11 @@ func prepareLogin(
 		sysCtx = &types.SystemContext{}
 	}
 	for registry := range registrySet {
+		// Refresh the access token if logged in by OAuth device flow.
+		if err := oidc.Refresh(ctx, sysCtx, registry); err != nil &&
+			!errors.Is(err, oidc.ErrSessionNotFound) {
+			logrus.Warnf("failed to refresh OAuth token of %q: %v", registry, err)
+		}
 		authConfig, err := config.GetCredentials(sysCtx, registry)
 		if err != nil {
 			return fmt.Errorf("failed to get credential of registry %q: %w",
@@ -124,9 +630,16 @@ func prepareLogin(
 		if authConfig.Password != "" {
 			continue
 		}
+		if incluster.InCluster() {
+			err = incluster.Login(ctx, sysCtx, registry)
+			if err == nil {
+				continue
+			}
+			logrus.Debugf("skip in-cluster login %q: %v", registry, err)
+		}
 
 		logrus.Infof("Logging into %q", registry)
-		err = retry.IfNecessary(ctx, func() error {
+		err = backoff.IfNecessary(ctx, func() error {
 			errCh := make(chan error)
 			go func() {
 				// Use go routine to avoid block when SIGINT.
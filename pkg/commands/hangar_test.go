@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDetector struct {
+	changes []hangar.Change
+	err     error
+}
+
+func (d *fakeDetector) Run(context.Context) error      { return nil }
+func (d *fakeDetector) Validate(context.Context) error { return nil }
+func (d *fakeDetector) SaveFailedImages() error        { return nil }
+
+func (d *fakeDetector) DetectChanges(context.Context) ([]hangar.Change, error) {
+	return d.changes, d.err
+}
+
+func Test_detectChanges(t *testing.T) {
+	assert.Nil(t, detectChanges(&fakeDetector{}))
+	assert.ErrorIs(t, detectChanges(&fakeDetector{
+		changes: []hangar.Change{{Source: "nginx", Reason: hangar.ChangeMissing}},
+	}), hangar.ErrChangesDetected)
+
+	// The validate error is not reported as changes detected.
+	err := detectChanges(&fakeDetector{err: hangar.ErrValidateFailed})
+	assert.ErrorIs(t, err, hangar.ErrValidateFailed)
+	assert.False(t, errors.Is(err, hangar.ErrChangesDetected))
+}
@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// Environment variables passed to the hook commands.
+const (
+	hookEnvCommand     = "HANGAR_COMMAND"
+	hookEnvSource      = "HANGAR_SOURCE"
+	hookEnvDestination = "HANGAR_DESTINATION"
+	hookEnvStatus      = "HANGAR_JOB_STATUS"
+	hookEnvError       = "HANGAR_JOB_ERROR"
+)
+
+// hookOpts is the options of the commands executed before and after the
+// job, e.g. verify the removable drive is mounted before saving and
+// unmount it after the archive written.
+type hookOpts struct {
+	preRun  string
+	postRun string
+}
+
+func (o *hookOpts) addFlags(flags *flag.FlagSet) {
+	flags.StringVarP(&o.preRun, "pre-run", "", "",
+		"shell command executed before the job, the job is not started if the command fails")
+	flags.StringVarP(&o.postRun, "post-run", "", "",
+		"shell command executed after the job even if the job failed "+
+			"(the job result is passed in the HANGAR_JOB_STATUS environment variable)")
+}
+
+// runHooks runs the job between the pre-run and post-run hooks. The
+// source and destination of the job are passed to the hooks by the
+// HANGAR_SOURCE and HANGAR_DESTINATION environment variables.
+func (o *hookOpts) runHooks(
+	cmd *cobra.Command, source, destination string, job func() error,
+) error {
+	env := []string{
+		hookEnvCommand + "=" + cmd.Name(),
+		hookEnvSource + "=" + source,
+		hookEnvDestination + "=" + destination,
+	}
+	if err := runHook(signalContext, "pre-run", o.preRun, env); err != nil {
+		return err
+	}
+
+	err := job()
+	if err != nil {
+		env = append(env, hookEnvStatus+"=failed", hookEnvError+"="+err.Error())
+	} else {
+		env = append(env, hookEnvStatus+"=success")
+	}
+	// The post-run hook is not canceled by the signal context, so the
+	// cleanup still runs after the job interrupted by Ctrl-C.
+	if hookErr := runHook(context.Background(), "post-run", o.postRun, env); hookErr != nil {
+		if err != nil {
+			logrus.Errorf("%v", hookErr)
+			return err
+		}
+		return hookErr
+	}
+	return err
+}
+
+// runHook executes the hook command by the system shell with the output
+// redirected to the stdout and stderr of hangar.
+func runHook(ctx context.Context, name, command string, env []string) error {
+	if strings.TrimSpace(command) == "" {
+		return nil
+	}
+	logrus.Infof("Running %v hook: %v", name, command)
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		c = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	c.Env = append(os.Environ(), env...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("%v hook %q failed: %w", name, command, err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_runHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands are tested by sh")
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	o := &hookOpts{
+		preRun:  `echo "pre $HANGAR_COMMAND $HANGAR_SOURCE $HANGAR_DESTINATION" >> ` + out,
+		postRun: `echo "post $HANGAR_JOB_STATUS $HANGAR_JOB_ERROR" >> ` + out,
+	}
+	cmd := &cobra.Command{Use: "save"}
+	job := func(err error) func() error {
+		return func() error {
+			f, _ := os.OpenFile(out, os.O_APPEND|os.O_WRONLY, 0644)
+			f.WriteString("job\n")
+			f.Close()
+			return err
+		}
+	}
+
+	assert.Nil(t, o.runHooks(cmd, "list.txt", "saved.zip", job(nil)))
+	b, _ := os.ReadFile(out)
+	assert.Equal(t, "pre save list.txt saved.zip\njob\npost success\n", string(b))
+
+	os.Remove(out)
+	err := errors.New("copy failed")
+	assert.Equal(t, err, o.runHooks(cmd, "list.txt", "saved.zip", job(err)))
+	b, _ = os.ReadFile(out)
+	assert.Equal(t, "pre save list.txt saved.zip\njob\npost failed copy failed\n", string(b))
+
+	// The job is not started if the pre-run hook failed.
+	os.Remove(out)
+	o.preRun = "exit 1"
+	assert.NotNil(t, o.runHooks(cmd, "list.txt", "saved.zip", job(nil)))
+	_, err = os.Stat(out)
+	assert.True(t, os.IsNotExist(err))
+
+	// The post-run hook runs after the job interrupted.
+	ctx := signalContext
+	defer func() { signalContext = ctx }()
+	var cancel context.CancelFunc
+	signalContext, cancel = context.WithCancel(context.Background())
+	cancel()
+	o.preRun = ""
+	assert.ErrorIs(t, o.runHooks(cmd, "list.txt", "saved.zip", func() error {
+		return signalContext.Err()
+	}), context.Canceled)
+	b, _ = os.ReadFile(out)
+	assert.Equal(t, "post failed context canceled\n", string(b))
+}
@@ -0,0 +1,323 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/cnrancher/hangar/pkg/hangar/imagelist"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// imageList is the images and the attributes of the image list lines.
+type imageList struct {
+	images []string
+	// tiers is the criticality tiers of the images not in the standard tier
+	tiers map[string]hangar.Tier
+	// optional is the images marked as optional
+	optional map[string]bool
+	// source is the git repository and the commit of the image list
+	// hosted in git (the last one if multiple), nil for the local image
+	// list files
+	source *hangar.ImageListSource
+	// origins is the image list files of the images, only recorded if
+	// multiple image list files are provided
+	origins map[string][]string
+	// added is the images already added to deduplicate the images
+	added map[string]bool
+}
+
+// imageListEntry is the image of the image list file in YAML format:
+//
+//	# images.yaml
+//	- source: docker.io/library/nginx:1.25
+//	  destination: team-a/nginx:1.25
+//	- source: docker.io/library/redis:7
+//	  tier: critical
+//	  optional: true
+type imageListEntry struct {
+	Source string `json:"source"`
+	// Destination is the destination image of the source image (optional)
+	Destination string `json:"destination,omitempty"`
+	Tier        string `json:"tier,omitempty"`
+	Optional    bool   `json:"optional,omitempty"`
+}
+
+// readImageList reads the images from the image list files (optional) and
+// appends the images specified in command line by the '--image' option.
+func readImageList(names []string, inline []string) (*imageList, error) {
+	if len(names) == 0 && len(inline) == 0 {
+		return nil, fmt.Errorf("image list not provided, use '--file' to specify the image list file " +
+			"or '--image' to specify the images")
+	}
+	return loadImageList(names, inline)
+}
+
+// loadImageList reads the images and the attributes of the image list
+// files, the tier directive comment ('# tier: critical') applies to the
+// following lines until the next directive. The images specified in
+// command line are in the standard tier.
+//
+// The image is marked as optional by the '?' prefix or the 'optional=true'
+// attribute after the image:
+//
+//	?docker.io/library/nginx:1.25
+//	docker.io/library/nginx:1.25 optional=true
+//
+// The images in multiple image list files are deduplicated, the most
+// critical tier is used and the image is optional only if it is marked
+// as optional in all image lists.
+func loadImageList(names []string, inline []string) (*imageList, error) {
+	list := &imageList{
+		images:   []string{},
+		tiers:    map[string]hangar.Tier{},
+		optional: map[string]bool{},
+		origins:  map[string][]string{},
+		added:    map[string]bool{},
+	}
+	for _, name := range names {
+		if err := list.load(name); err != nil {
+			return nil, err
+		}
+	}
+	for _, l := range inline {
+		if l = strings.TrimSpace(l); l != "" {
+			if err := list.add(l, hangar.TierStandard, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(names) < 2 {
+		list.origins = nil
+	}
+	return list, nil
+}
+
+// load reads the images of the image list file.
+func (list *imageList) load(name string) error {
+	r, err := list.open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	origin := name
+	if imagelist.IsGitSource(name) && list.source != nil {
+		// Do not record the credential of the git repository.
+		origin = list.source.Source
+	}
+	if isYAMLImageList(name) {
+		return list.loadYAML(r, name, origin)
+	}
+	tier := hangar.TierStandard
+	sc := bufio.NewScanner(r)
+	sc.Split(bufio.ScanLines)
+	for n := 1; sc.Scan(); n++ {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" {
+			continue
+		}
+		if strings.HasPrefix(l, "#") || strings.HasPrefix(l, "//") {
+			v, ok := tierDirective(l)
+			if !ok {
+				continue
+			}
+			if tier, err = hangar.ParseTier(v); err != nil {
+				return fmt.Errorf("%q line %d: %w", name, n, err)
+			}
+			continue
+		}
+		if err := list.add(l, tier, origin); err != nil {
+			return fmt.Errorf("%q line %d: %w", name, n, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("failed to read %q: %w", name, err)
+	}
+	return nil
+}
+
+// isYAMLImageList returns true if the image list file (or the file in the
+// git repository) has the '.yaml' or '.yml' extension.
+func isYAMLImageList(name string) bool {
+	if imagelist.IsGitSource(name) {
+		g, err := imagelist.ParseGitSource(name)
+		if err != nil {
+			return false
+		}
+		name = g.Path
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// loadYAML reads the images of the image list file in YAML format, the
+// entry with the destination is added as the pair line.
+func (list *imageList) loadYAML(r io.Reader, name, origin string) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", name, err)
+	}
+	var entries []imageListEntry
+	if err := yaml.Unmarshal(b, &entries); err != nil {
+		return fmt.Errorf("failed to decode %q: %w", name, err)
+	}
+	for i, e := range entries {
+		if strings.TrimSpace(e.Source) == "" {
+			return fmt.Errorf("%q entry %d: source not specified", name, i+1)
+		}
+		tier := hangar.TierStandard
+		if e.Tier != "" {
+			if tier, err = hangar.ParseTier(e.Tier); err != nil {
+				return fmt.Errorf("%q entry %d: %w", name, i+1, err)
+			}
+		}
+		l := strings.TrimSpace(e.Source)
+		if e.Destination != "" {
+			l = l + " " + strings.TrimSpace(e.Destination)
+		}
+		if e.Optional {
+			l = "?" + l
+		}
+		if err := list.add(l, tier, origin); err != nil {
+			return fmt.Errorf("%q entry %d: %w", name, i+1, err)
+		}
+	}
+	return nil
+}
+
+// open opens the image list file, the image list hosted in git repository
+// ('git+URL//PATH@REF') is fetched at the ref and the resolved commit is
+// recorded. The credential of the git repository is read from the
+// HANGAR_GIT_USERNAME and HANGAR_GIT_PASSWORD environment variables.
+func (list *imageList) open(name string) (io.ReadCloser, error) {
+	if !imagelist.IsGitSource(name) {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %q: %v", name, err)
+		}
+		return file, nil
+	}
+	g, err := imagelist.ParseGitSource(name)
+	if err != nil {
+		return nil, err
+	}
+	b, commit, err := g.Fetch(signalContext,
+		os.Getenv("HANGAR_GIT_USERNAME"), os.Getenv("HANGAR_GIT_PASSWORD"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image list %q: %w", g, err)
+	}
+	logrus.Infof("Image list [%v] fetched at commit %v", g, commit)
+	list.source = &hangar.ImageListSource{
+		Source: g.String(),
+		Commit: commit,
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// add adds the image list line with the optional mark, the origin is the
+// image list file of the line, empty for the images in command line.
+func (list *imageList) add(l string, tier hangar.Tier, origin string) error {
+	optional := false
+	if strings.HasPrefix(l, "?") {
+		optional = true
+		l = strings.TrimSpace(l[1:])
+	}
+	if fields := strings.Fields(l); len(fields) > 1 {
+		// The image list in mirror format has 3 fields, the attributes
+		// are after the images.
+		var attrs []string
+		for len(fields) > 1 && strings.Contains(fields[len(fields)-1], "=") {
+			attrs = append(attrs, fields[len(fields)-1])
+			fields = fields[:len(fields)-1]
+		}
+		for _, attr := range attrs {
+			key, value, _ := strings.Cut(attr, "=")
+			if !strings.EqualFold(key, "optional") {
+				return fmt.Errorf("unknown image attribute %q", attr)
+			}
+			switch strings.ToLower(value) {
+			case "true":
+				optional = true
+			case "false":
+			default:
+				return fmt.Errorf("invalid image attribute %q: should be true or false", attr)
+			}
+		}
+		if len(attrs) > 0 {
+			l = strings.Join(fields, " ")
+		}
+	}
+	if origin != "" && !slices.Contains(list.origins[l], origin) {
+		list.origins[l] = append(list.origins[l], origin)
+	}
+	if list.added[l] {
+		// The image is in multiple image lists.
+		if !optional {
+			delete(list.optional, l)
+		}
+		if tier.MoreCritical(list.tier(l)) {
+			list.setTier(l, tier)
+		}
+		return nil
+	}
+	list.added[l] = true
+	list.images = append(list.images, l)
+	list.setTier(l, tier)
+	if optional {
+		list.optional[l] = true
+	}
+	return nil
+}
+
+func (list *imageList) tier(l string) hangar.Tier {
+	if t, ok := list.tiers[l]; ok {
+		return t
+	}
+	return hangar.TierStandard
+}
+
+func (list *imageList) setTier(l string, tier hangar.Tier) {
+	if tier == hangar.TierStandard {
+		delete(list.tiers, l)
+		return
+	}
+	list.tiers[l] = tier
+}
+
+// tierDirective returns the tier of the directive comment line.
+//
+//	Example:
+//		# tier: critical => critical
+//		// tier: optional => optional
+func tierDirective(l string) (string, bool) {
+	l = strings.TrimSpace(strings.TrimLeft(l, "#/"))
+	key, value, ok := strings.Cut(l, ":")
+	if !ok || !strings.EqualFold(strings.TrimSpace(key), "tier") {
+		return "", false
+	}
+	return strings.TrimSpace(value), true
+}
+
+// sourceImage returns the source image of the image list line with the
+// registry overridden, returns empty string for the docker-archive line
+// since the image is read from the local tarball.
+func sourceImage(line, registry string) string {
+	switch imagelist.Detect(line) {
+	case imagelist.TypeDockerArchive:
+		return ""
+	case imagelist.TypePair:
+		line, _, _ = imagelist.GetPairSpec(line)
+	}
+	return utils.ConstructRegistry(line, registry)
+}
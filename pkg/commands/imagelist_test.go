@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_readImageList(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt": "# comment\n\ndocker.io/library/nginx:1.25\n" +
+			"// tier: critical\ndocker.io/library/redis:7\n  \n?docker.io/library/busybox:latest\n",
+		"b.txt": "docker.io/library/nginx:1.25\n# tier: optional\n" +
+			"docker.io/library/redis:7\ndocker.io/library/busybox:latest optional=true\n",
+		"c.yaml": "- source: docker.io/library/nginx:1.25\n  destination: team-a/nginx:1.25\n" +
+			"- source: docker.io/library/alpine:3.19\n  tier: critical\n  optional: true\n",
+		"invalid.txt": "docker.io/library/nginx:1.25 unknown=true\n",
+	}
+	for name, content := range files {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	file := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	for _, c := range []struct {
+		name     string
+		files    []string
+		inline   []string
+		images   []string
+		tiers    map[string]hangar.Tier
+		optional map[string]bool
+		origins  map[string][]string
+		err      bool
+	}{
+		{
+			name:  "comments and blank lines",
+			files: []string{file("a.txt")},
+			images: []string{
+				"docker.io/library/nginx:1.25",
+				"docker.io/library/redis:7",
+				"docker.io/library/busybox:latest",
+			},
+			// The tier directive applies to the following lines.
+			tiers: map[string]hangar.Tier{
+				"docker.io/library/redis:7":        hangar.TierCritical,
+				"docker.io/library/busybox:latest": hangar.TierCritical,
+			},
+			optional: map[string]bool{"docker.io/library/busybox:latest": true},
+		},
+		{
+			name:  "multiple files deduplicated",
+			files: []string{file("a.txt"), file("b.txt")},
+			images: []string{
+				"docker.io/library/nginx:1.25",
+				"docker.io/library/redis:7",
+				"docker.io/library/busybox:latest",
+			},
+			// The most critical tier is used.
+			tiers: map[string]hangar.Tier{
+				"docker.io/library/redis:7":        hangar.TierCritical,
+				"docker.io/library/busybox:latest": hangar.TierCritical,
+			},
+			// Optional in all the image lists.
+			optional: map[string]bool{"docker.io/library/busybox:latest": true},
+			origins: map[string][]string{
+				"docker.io/library/nginx:1.25":     {file("a.txt"), file("b.txt")},
+				"docker.io/library/redis:7":        {file("a.txt"), file("b.txt")},
+				"docker.io/library/busybox:latest": {file("a.txt"), file("b.txt")},
+			},
+		},
+		{
+			name:   "inline images",
+			inline: []string{"docker.io/library/nginx:1.25", " ", "?docker.io/library/redis:7", "docker.io/library/nginx:1.25"},
+			images: []string{
+				"docker.io/library/nginx:1.25",
+				"docker.io/library/redis:7",
+			},
+			tiers:    map[string]hangar.Tier{},
+			optional: map[string]bool{"docker.io/library/redis:7": true},
+		},
+		{
+			name:   "files and inline images",
+			files:  []string{file("c.yaml")},
+			inline: []string{"docker.io/library/alpine:3.19", "docker.io/library/redis:7"},
+			images: []string{
+				"docker.io/library/nginx:1.25 team-a/nginx:1.25",
+				"docker.io/library/alpine:3.19",
+				"docker.io/library/redis:7",
+			},
+			tiers: map[string]hangar.Tier{"docker.io/library/alpine:3.19": hangar.TierCritical},
+			// The inline image is not optional.
+			optional: map[string]bool{},
+		},
+		{
+			name:  "missing file",
+			files: []string{file("a.txt"), file("missing.txt")},
+			err:   true,
+		},
+		{
+			name:  "invalid attribute",
+			files: []string{file("invalid.txt")},
+			err:   true,
+		},
+		{
+			name: "not provided",
+			err:  true,
+		},
+	} {
+		list, err := readImageList(c.files, c.inline)
+		if c.err {
+			assert.Error(t, err, c.name)
+			continue
+		}
+		if !assert.Nil(t, err, c.name) {
+			continue
+		}
+		assert.Equal(t, c.images, list.images, c.name)
+		assert.Equal(t, c.tiers, list.tiers, c.name)
+		assert.Equal(t, c.optional, list.optional, c.name)
+		assert.Equal(t, c.origins, list.origins, c.name)
+	}
+}
+
+func Test_tierDirective(t *testing.T) {
+	v, ok := tierDirective("# tier: critical")
+	assert.True(t, ok)
+	assert.Equal(t, "critical", v)
+	v, ok = tierDirective("// Tier: optional")
+	assert.True(t, ok)
+	assert.Equal(t, "optional", v)
+	_, ok = tierDirective("# comment")
+	assert.False(t, ok)
+}
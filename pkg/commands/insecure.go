@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+)
+
+// insecureRegistriesConf writes the registries.conf marking the registries
+// insecure (skip TLS verify & allow plain HTTP) into the cache directory,
+// returns the path of the config file.
+//
+// The TLS settings only apply to the listed registries, the global
+// '--tls-verify' option still overrides them if specified.
+func insecureRegistriesConf(registries []string) (string, error) {
+	var b strings.Builder
+	b.WriteString("# Generated by hangar from the '--insecure-registry' option.\n")
+	for _, r := range registries {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if strings.Contains(r, "://") {
+			return "", fmt.Errorf("invalid insecure registry %q: scheme should not be specified", r)
+		}
+		fmt.Fprintf(&b, "\n[[registry]]\nlocation = %q\ninsecure = true\n",
+			strings.TrimSuffix(r, "/"))
+	}
+
+	// The file is named by the content digest to reuse the file with
+	// the same registries.
+	sum := sha256.Sum256([]byte(b.String()))
+	path := filepath.Join(archive.CacheDir(),
+		fmt.Sprintf("registries-%s.conf", hex.EncodeToString(sum[:])[:12]))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	tmp, err := os.CreateTemp(archive.CacheDir(), ".registries-*.conf")
+	if err != nil {
+		return "", fmt.Errorf("failed to create registries.conf: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write registries.conf: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write registries.conf: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to write registries.conf: %w", err)
+	}
+	return path, nil
+}
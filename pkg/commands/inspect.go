@@ -1,15 +1,24 @@
 package commands
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/extension"
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
 	"github.com/cnrancher/hangar/pkg/manifest"
 	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/transports/alltransports"
 	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
 )
 
 type inspectCmd struct {
@@ -20,7 +29,11 @@ type inspectCmd struct {
 	variant   string
 	raw       bool
 	config    bool
+	referrers bool
+	size      bool
 	tlsVerify bool
+	archive   string
+	format    string
 }
 
 func newInspectCmd() *inspectCmd {
@@ -34,7 +47,19 @@ func newInspectCmd() *inspectCmd {
 hangar inspect [image-reference]
 
 # Inspect RAW docker image maniefest:
-hangar inspect docker://docker.io/cnrancher/hangar:latest --raw`,
+hangar inspect docker://docker.io/cnrancher/hangar:latest --raw
+
+# List the referrers (signatures, SBOMs, etc.) of the image:
+hangar inspect docker://registry.example.io/library/nginx:latest --referrers
+
+# Show the compressed size of the image of each platform and the totals:
+hangar inspect docker://docker.io/library/nginx:latest --size
+
+# Show the manifest, config, platforms and layers of the image in table:
+hangar inspect docker://docker.io/library/nginx:latest --format table
+
+# Inspect the image saved in the Hangar archive file:
+hangar inspect docker.io/library/nginx:latest --archive SAVED_ARCHIVE.zip --format yaml`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
 			if cc.baseCmd.debug {
@@ -57,6 +82,12 @@ hangar inspect docker://docker.io/cnrancher/hangar:latest --raw`,
 	flags.BoolVarP(&cc.tlsVerify, "tls-verify", "", true, "require HTTPS and verify certificates")
 	flags.BoolVarP(&cc.raw, "raw", "", false, "output raw manifest")
 	flags.BoolVarP(&cc.config, "config", "", false, "output raw configuration")
+	flags.BoolVarP(&cc.referrers, "referrers", "", false, "output the referrers of the image manifest")
+	flags.BoolVarP(&cc.size, "size", "", false, "output the compressed size of the image of each platform")
+	flags.StringVarP(&cc.archive, "archive", "", "", "inspect the image ('SOURCE:TAG') saved in the Hangar archive file instead of the registry")
+	flags.SetAnnotation("archive", cobra.BashCompFilenameExt, []string{"zip"})
+	flags.StringVarP(&cc.format, "format", "", "",
+		"output the manifest, config, platforms and layers of the image in 'json', 'yaml' or 'table' format")
 
 	return cc
 }
@@ -65,17 +96,34 @@ func (cc *inspectCmd) run(args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("image reference not provided")
 	}
+	switch cc.format {
+	case "", inspectFormatJSON, inspectFormatYAML, inspectFormatTable:
+	default:
+		return fmt.Errorf("invalid format %q: should be %q, %q or %q", cc.format,
+			inspectFormatJSON, inspectFormatYAML, inspectFormatTable)
+	}
+	if cc.archive != "" {
+		if cc.raw || cc.config || cc.referrers || cc.size {
+			return fmt.Errorf("'--raw', '--config', '--referrers' and '--size' are not supported with '--archive'")
+		}
+		detail, err := archiveImageDetail(cc.archive, args[0])
+		if err != nil {
+			return err
+		}
+		return printImageDetail(detail, cc.format)
+	}
 
 	ctx := signalContext
+	sysCtx := &types.SystemContext{
+		ArchitectureChoice:          cc.arch,
+		OSChoice:                    cc.os,
+		VariantChoice:               cc.variant,
+		OCIInsecureSkipTLSVerify:    !cc.tlsVerify,
+		DockerInsecureSkipTLSVerify: types.NewOptionalBool(!cc.tlsVerify),
+	}
 	inspector, err := manifest.NewInspector(ctx, &manifest.InspectorOption{
 		ReferenceName: args[0],
-		SystemContext: &types.SystemContext{
-			ArchitectureChoice:          cc.arch,
-			OSChoice:                    cc.os,
-			VariantChoice:               cc.variant,
-			OCIInsecureSkipTLSVerify:    !cc.tlsVerify,
-			DockerInsecureSkipTLSVerify: types.NewOptionalBool(!cc.tlsVerify),
-		},
+		SystemContext: sysCtx,
 	})
 	if err != nil {
 		return err
@@ -89,12 +137,36 @@ func (cc *inspectCmd) run(args []string) error {
 			return err
 		}
 		fmt.Print(string(b))
+	case cc.referrers:
+		b, _, err := inspector.Raw(ctx)
+		if err != nil {
+			return err
+		}
+		descs, err := listReferrers(ctx, sysCtx, args[0], b)
+		if err != nil {
+			return err
+		}
+		b, _ = json.MarshalIndent(descs, "", "  ")
+		fmt.Println(string(b))
+	case cc.size:
+		info, err := inspector.Size(ctx)
+		if err != nil {
+			return err
+		}
+		b, _ := json.MarshalIndent(info, "", "  ")
+		fmt.Println(string(b))
 	case cc.raw:
 		b, _, err := inspector.Raw(ctx)
 		if err != nil {
 			return err
 		}
 		fmt.Print(string(b))
+	case cc.format != "":
+		detail, err := inspector.Detail(ctx)
+		if err != nil {
+			return err
+		}
+		return printImageDetail(detail, cc.format)
 	default:
 		info, err := inspector.Inspect(ctx)
 		if err != nil {
@@ -106,3 +178,132 @@ func (cc *inspectCmd) run(args []string) error {
 
 	return nil
 }
+
+// listReferrers lists the referrers of the image manifest by the registry
+// referrers API or the referrers tag schema.
+func listReferrers(
+	ctx context.Context, sysCtx *types.SystemContext, referenceName string, b []byte,
+) ([]imgspecv1.Descriptor, error) {
+	ref, err := alltransports.ParseImageName(referenceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", referenceName, err)
+	}
+	named := ref.DockerReference()
+	if named == nil || ref.Transport().Name() != "docker" {
+		return nil, fmt.Errorf("referrers are only supported for docker transport")
+	}
+	dig, err := manifest.Digest(b, manifest.ReferenceAlgorithm(referenceName))
+	if err != nil {
+		return nil, err
+	}
+	registry := reference.Domain(named)
+	return extension.For(ctx, sysCtx, registry).
+		Referrers(ctx, reference.Path(named), dig)
+}
+
+const (
+	inspectFormatJSON  = "json"
+	inspectFormatYAML  = "yaml"
+	inspectFormatTable = "table"
+)
+
+// archiveImageDetail returns the manifest, config, platforms and layers
+// of the image saved in the archive, the name is the 'SOURCE:TAG' of the
+// image in the archive index, or the suffix of it (e.g. 'nginx:1.25').
+func archiveImageDetail(name, image string) (*manifest.ImageDetail, error) {
+	reader, err := archive.NewReader(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", name, err)
+	}
+	defer reader.Close()
+	b, err := reader.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index from archive: %w", err)
+	}
+	index, err := archive.UnmarshalIndex(b)
+	if err != nil {
+		return nil, err
+	}
+	var found []*archive.Image
+	for _, img := range index.List {
+		n := img.Source + ":" + img.Tag
+		if n == image {
+			found = []*archive.Image{img}
+			break
+		}
+		if strings.HasSuffix(n, "/"+image) {
+			found = append(found, img)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("image %q not found in archive %q", image, name)
+	case 1:
+	default:
+		return nil, fmt.Errorf("image %q is ambiguous in archive %q, use the full 'SOURCE:TAG' name",
+			image, name)
+	}
+
+	detail := &manifest.ImageDetail{
+		Name:      found[0].Source + ":" + found[0].Tag,
+		Platforms: []*manifest.PlatformDetail{},
+	}
+	for _, spec := range found[0].Images {
+		b, err := reader.ReadBlob(spec.Digest)
+		if err != nil {
+			return nil, err
+		}
+		p, err := manifest.NewPlatformDetail(b, "", reader.ReadBlob)
+		if err != nil {
+			return nil, fmt.Errorf("manifest %v: %w", spec.Digest, err)
+		}
+		p.Digest = spec.Digest
+		detail.Platforms = append(detail.Platforms, p)
+	}
+	return detail, nil
+}
+
+// printImageDetail outputs the image detail in the format, json if empty.
+func printImageDetail(detail *manifest.ImageDetail, format string) error {
+	switch format {
+	case inspectFormatYAML:
+		b, err := yaml.Marshal(detail)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(b))
+	case inspectFormatTable:
+		fmt.Printf("Name:       %v\n", detail.Name)
+		if detail.Digest != "" {
+			fmt.Printf("Digest:     %v\n", detail.Digest)
+			fmt.Printf("Media type: %v\n", detail.MediaType)
+		}
+		fmt.Printf("%4s | %-16s | %-71s | %6s | %10s\n",
+			"#", "PLATFORM", "DIGEST", "LAYERS", "SIZE")
+		for i, p := range detail.Platforms {
+			fmt.Printf("%4d | %-16s | %-71s | %6d | %10s\n",
+				i+1, p.Platform, p.Digest, len(p.Layers), utils.FormatSize(p.Size))
+		}
+		for _, p := range detail.Platforms {
+			fmt.Printf("\n%v %v\n", p.Platform, p.Digest)
+			fmt.Printf("  Media type: %v\n", p.MediaType)
+			if p.Config != "" {
+				fmt.Printf("  Config:     %v\n", p.Config)
+			}
+			if p.Created != nil {
+				fmt.Printf("  Created:    %v\n", p.Created.Format(time.RFC3339))
+			}
+			for i, l := range p.Layers {
+				size := "-"
+				if l.Size >= 0 {
+					size = utils.FormatSize(l.Size)
+				}
+				fmt.Printf("  %4d | %-71s | %10s | %s\n", i+1, l.Digest, size, l.MediaType)
+			}
+		}
+	default:
+		b, _ := json.MarshalIndent(detail, "", "  ")
+		fmt.Println(string(b))
+	}
+	return nil
+}
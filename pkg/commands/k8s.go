@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type k8sCmd struct {
+	*baseCmd
+}
+
+func newK8sCmd() *k8sCmd {
+	cc := &k8sCmd{}
+
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "k8s",
+		Short: "Helpers for running Hangar inside Kubernetes cluster",
+		Long:  "",
+		Example: `
+# Render the Job manifest to mirror images inside Kubernetes cluster:
+hangar k8s generate-job --name mirror-images -- \
+	mirror -f /etc/hangar/list.txt -d REGISTRY_URL --skip-login`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+			return cmd.Help()
+		},
+	})
+
+	addCommands(cc.cmd,
+		newK8sGenerateJobCmd(),
+	)
+	return cc
+}
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/k8s"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type k8sGenerateJobCmd struct {
+	*baseCmd
+
+	name           string
+	namespace      string
+	image          string
+	schedule       string
+	serviceAccount string
+	registrySecret string
+	configMap      string
+	pvc            string
+	backoffLimit   int
+	output         string
+}
+
+func newK8sGenerateJobCmd() *k8sGenerateJobCmd {
+	cc := &k8sGenerateJobCmd{}
+
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "generate-job [flags] -- HANGAR_COMMAND [args]",
+		Short: "Render Kubernetes Job/CronJob manifest to run Hangar inside cluster",
+		Long: `Render Kubernetes Job/CronJob manifest to run Hangar inside cluster.
+
+The registry credential secret (type kubernetes.io/dockerconfigjson) will be
+mounted as the docker config file, the config map will be mounted to
+'` + k8s.DefaultConfigDir + `' and the PVC will be mounted to the working
+directory '` + k8s.DefaultWorkDir + `'.
+
+When running inside EKS (IRSA) or GKE (Workload Identity) cluster, Hangar
+will get the ECR/GCR credential from the pod service account automatically.`,
+		Example: `# Render Job manifest to mirror images:
+hangar k8s generate-job \
+	--name mirror-images \
+	--registry-secret registry-auth \
+	--config-map image-list -- \
+	mirror -f /etc/hangar/list.txt -d REGISTRY_URL --skip-login
+
+# Render CronJob manifest to sync images into archive stored in PVC:
+hangar k8s generate-job \
+	--name sync-images \
+	--schedule "0 0 * * *" \
+	--config-map image-list \
+	--pvc hangar-data -- \
+	sync -f /etc/hangar/list.txt -d SAVED_ARCHIVE.zip`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+			if err := cc.run(args); err != nil {
+				return err
+			}
+			return nil
+		},
+	})
+
+	flags := cc.baseCmd.cmd.Flags()
+	flags.StringVarP(&cc.name, "name", "", "", "name of the Job/CronJob (default generated by hangar command)")
+	flags.StringVarP(&cc.namespace, "namespace", "n", "", "namespace of the Job/CronJob")
+	flags.StringVarP(&cc.image, "image", "", "cnrancher/hangar:"+utils.Version, "hangar container image")
+	flags.StringVarP(&cc.schedule, "schedule", "", "", "cron schedule, render CronJob instead of Job if specified")
+	flags.StringVarP(&cc.serviceAccount, "service-account", "", "", "service account name of the pod")
+	flags.StringVarP(&cc.registrySecret, "registry-secret", "", "", "name of the dockerconfigjson secret stores registry credentials")
+	flags.StringVarP(&cc.configMap, "config-map", "", "", "name of the config map stores image list files")
+	flags.StringVarP(&cc.pvc, "pvc", "", "", "name of the persistent volume claim to store archive files")
+	flags.IntVarP(&cc.backoffLimit, "backoff-limit", "", 0, "retry number of the Job")
+	flags.StringVarP(&cc.output, "output", "o", "", "output manifest file (default stdout)")
+	flags.SetAnnotation("output", cobra.BashCompFilenameExt, []string{"yaml"})
+
+	return cc
+}
+
+func (cc *k8sGenerateJobCmd) run(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("hangar command not provided, example: 'hangar k8s generate-job -- mirror -f list.txt -d REGISTRY_URL'")
+	}
+	switch args[0] {
+	case "mirror", "sync", "save", "load":
+	default:
+		logrus.Warnf("Command %q may not suitable to run as Kubernetes Job", args[0])
+	}
+	name := cc.name
+	if name == "" {
+		name = k8s.JobName("hangar-" + args[0])
+	}
+	b, err := k8s.GenerateJob(&k8s.JobOptions{
+		Name:           name,
+		Namespace:      cc.namespace,
+		Image:          cc.image,
+		Args:           args,
+		Schedule:       cc.schedule,
+		ServiceAccount: cc.serviceAccount,
+		RegistrySecret: cc.registrySecret,
+		ConfigMap:      cc.configMap,
+		PVC:            cc.pvc,
+		BackoffLimit:   int32(cc.backoffLimit),
+	})
+	if err != nil {
+		return err
+	}
+	if cc.output == "" {
+		fmt.Print(string(b))
+		return nil
+	}
+	if err := os.WriteFile(cc.output, b, 0644); err != nil {
+		return fmt.Errorf("failed to write %q: %w", cc.output, err)
+	}
+	logrus.Infof("Manifest exported to %q", cc.output)
+	return nil
+}
@@ -1,14 +1,13 @@
 package commands
 
 import (
-	"bufio"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/cnrancher/hangar/pkg/cmdconfig"
 	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/cnrancher/hangar/pkg/manifest"
 	"github.com/cnrancher/hangar/pkg/utils"
 	commonFlag "github.com/containers/common/pkg/flag"
 	"github.com/containers/image/v5/types"
@@ -17,19 +16,40 @@ import (
 )
 
 type loadOpts struct {
-	file           string
+	file           []string
 	arch           []string
 	os             []string
 	source         string
 	sourceRegistry string
 	destination    string
 	failed         string
+	statusFile     string
 	repoType       string
 	jobs           int
 	timeout        time.Duration
 	project        string
 	skipLogin      bool
 	tlsVerify      commonFlag.OptionalBool
+	detectChanges  bool
+	adjustQuota    bool
+	passthrough    bool
+	warmUp         bool
+	skipChecksum   bool
+	destIsProxy    bool
+	images         []string
+	skipBlobsFile  string
+	deepVerify     string
+	projectMapping string
+
+	allowDigestChange bool
+	maxMemory         int
+	indexAnnotations  []string
+
+	credentialOpts
+	normalizeOpts
+	failureOpts
+	compatOpts
+	hookOpts
 }
 
 type loadCmd struct {
@@ -47,6 +67,19 @@ func newLoadCmd() *loadCmd {
 		Long: `Load images from zip archive created by 'save' command to registry server.
 
 The load command will create Harbor V2 projects for destination registry automatically.
+The storage quotas of the Harbor V2 projects are checked before loading images,
+use '--adjust-quota' to raise the quotas automatically if they are not enough.
+
+When loading into the projects of a shared Harbor owned by different teams,
+use '--project-mapping' to provide the robot account and the concurrency of
+each project, the images of a project exceeding its quota or failing the
+permission checks are failed without aborting the images of other projects:
+
+  projects:
+    team-a:
+      username: robot$team-a+loader
+      passwordEnv: TEAM_A_ROBOT_SECRET
+      jobs: 2
 `,
 		Example: `# Load images from SAVED_ARCHIVE.zip to REGISTRY SERVER.
 hangar load \
@@ -62,38 +95,86 @@ hangar load \
 				logrus.Debugf("debug output enabled")
 				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
 			}
-
-			h, err := cc.prepareHangar()
-			if err != nil {
-				return err
+			if cc.detectChanges && !cc.baseCmd.debug {
+				// Only output the change list to stdout.
+				logrus.SetLevel(logrus.WarnLevel)
 			}
-			if err := run(h); err != nil {
-				return err
-			}
-			return nil
+
+			return cc.runHooks(cmd, cc.source, cc.destination, func() error {
+				h, err := cc.prepareHangar()
+				if err != nil {
+					return err
+				}
+				if cc.detectChanges {
+					return detectChanges(h)
+				}
+				if err := run(h); err != nil {
+					return err
+				}
+				return nil
+			})
 		},
 	})
 
 	flags := cc.baseCmd.cmd.PersistentFlags()
-	flags.StringVarP(&cc.file, "file", "f", "", "image list file (optional: load all images from archive if not provided)")
+	flags.StringSliceVarP(&cc.file, "file", "f", nil, "image list file, can be specified multiple times (optional: load all images from archive if not provided)")
 	flags.SetAnnotation("file", cobra.BashCompFilenameExt, []string{"txt"})
-	flags.StringSliceVarP(&cc.arch, "arch", "a", []string{"amd64", "arm64"}, "architecture list of images")
-	flags.StringSliceVarP(&cc.os, "os", "", []string{"linux"}, "OS list of images")
-	flags.StringVarP(&cc.source, "source", "s", "", "saved archive filename")
+	flags.StringSliceVarP(&cc.arch, "arch", "a", defaultArch(), "architecture list of images")
+	flags.StringSliceVarP(&cc.os, "os", "", defaultOS(), "OS list of images")
+	flags.StringVarP(&cc.source, "source", "s", "", "saved archive filename or unpacked archive directory")
 	flags.SetAnnotation("source", cobra.BashCompFilenameExt, []string{"zip"})
 	flags.SetAnnotation("source", cobra.BashCompOneRequiredFlag, []string{""})
+	flags.StringSliceVarP(&cc.images, "image", "", nil, "image to load from the archive (can be specified multiple times)")
+	cc.baseCmd.cmd.RegisterFlagCompletionFunc("image", completeArchiveImages("source"))
 	flags.StringVarP(&cc.sourceRegistry, "source-registry", "", "", "override the source registry of image list")
 	flags.StringVarP(&cc.destination, "destination", "d", "", "destination registry url")
 	flags.SetAnnotation("destination", cobra.BashCompOneRequiredFlag, []string{""})
+	cc.baseCmd.cmd.RegisterFlagCompletionFunc("destination", completeRegistries)
 	flags.StringVarP(&cc.failed, "failed", "o", "load-failed.txt", "file name of the load failed image list")
 	flags.SetAnnotation("failed", cobra.BashCompFilenameExt, []string{"txt"})
+	flags.StringVarP(&cc.statusFile, "status-file", "", "", "write the job progress & failures into the status file continuously (JSON format)")
+	flags.SetAnnotation("status-file", cobra.BashCompFilenameExt, []string{"json"})
 	flags.IntVarP(&cc.jobs, "jobs", "j", 1, "worker number,copy images parallelly (1-20)")
 	flags.DurationVarP(&cc.timeout, "timeout", "", time.Minute*10, "timeout when save each images")
 	flags.StringVarP(&cc.project, "project", "", "", "override all destination image projects")
 	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates")
+	flags.BoolVarP(&cc.detectChanges, "detect-changes", "", false,
+		"compare destination with desired state without copying, exit 2 with JSON change list if changed")
+
+	flags.BoolVarP(&cc.adjustQuota, "adjust-quota", "", false,
+		"raise the Harbor V2 project storage quota automatically if not enough to load images")
 
 	flags.BoolVarP(&cc.skipLogin, "skip-login", "", false,
 		"skip check the destination registry is logged in (used in shell script)")
+	flags.BoolVarP(&cc.destIsProxy, "dest-is-proxy", "", false,
+		"the destination registry is a pull-through proxy cache, only check the locally cached content (Harbor, zot or Artifactory)")
+	flags.StringVarP(&cc.skipBlobsFile, "skip-blobs-file", "", "",
+		"file of the layer digests (one per line) already present on the destination registry to skip loading")
+	flags.SetAnnotation("skip-blobs-file", cobra.BashCompFilenameExt, []string{"txt"})
+	flags.BoolVarP(&cc.passthrough, "passthrough", "", true,
+		"stream the layers stored in the archive to the destination verbatim without decompressing them into the cache dir")
+	flags.BoolVarP(&cc.warmUp, "warm-up", "", false,
+		"check the existing manifests and blobs in the destination before loading to print the exact plan and progress")
+	flags.BoolVarP(&cc.skipChecksum, "skip-checksum", "", false,
+		"skip verifying the archive by the checksum file (ARCHIVE.sha256) written on save")
+	flags.StringVarP(&cc.projectMapping, "project-mapping", "", "",
+		"YAML file of the robot accounts and concurrency of the destination projects, "+
+			"the quota and permission failures of a project do not abort other projects")
+	flags.SetAnnotation("project-mapping", cobra.BashCompFilenameExt, []string{"yaml"})
+	cc.baseCmd.cmd.Flags().BoolVarP(&cc.allowDigestChange, "allow-digest-change-on-conflict", "", false,
+		"retry the image with the digest preservation disabled if the destination registry rejects the manifest, "+
+			"the changed digests are recorded in the summary")
+	cc.baseCmd.cmd.Flags().StringSliceVarP(&cc.indexAnnotations, "index-annotation", "", nil,
+		"set the annotation of the destination manifest index in 'KEY=VALUE' format to identify the bundle "+
+			"(e.g. 'org.example.bundle.version=v2.8.0'), the OCI image index is pushed")
+	cc.baseCmd.cmd.Flags().IntVarP(&cc.maxMemory, "max-memory", "", 0,
+		"total size (MiB) of the large layers streamed in parallel by all the workers, "+
+			"the layers exceeding the size are copied one at a time, 0 to disable")
+	cc.credentialOpts.addFlags(flags)
+	cc.normalizeOpts.addFlags(flags)
+	cc.compatOpts.addFlags(flags)
+	cc.failureOpts.addFlags(flags)
+	cc.hookOpts.addFlags(cc.baseCmd.cmd.Flags())
 
 	addCommands(
 		cc.cmd,
@@ -119,25 +200,11 @@ func (cc *loadCmd) prepareHangar() (hangar.Hangar, error) {
 		}
 	}
 
-	var images []string
-	if cc.file != "" {
-		file, err := os.Open(cc.file)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open %q: %v", cc.file, err)
-		}
-		sc := bufio.NewScanner(file)
-		sc.Split(bufio.ScanLines)
-		for sc.Scan() {
-			l := strings.TrimSpace(sc.Text())
-			if l == "" || strings.HasPrefix(l, "#") || strings.HasPrefix(l, "//") {
-				continue
-			}
-			images = append(images, l)
-		}
-		if err := file.Close(); err != nil {
-			return nil, fmt.Errorf("failed to close %q: %v", cc.file, err)
-		}
+	list, err := loadImageList(cc.file, cc.images)
+	if err != nil {
+		return nil, err
 	}
+	images := list.images
 
 	sysCtx := cc.baseCmd.newSystemContext()
 	if cc.tlsVerify.Present() {
@@ -156,6 +223,53 @@ func (cc *loadCmd) prepareHangar() (hangar.Hangar, error) {
 		}
 	}
 
+	// Images in archive are unknown before loading, use the first image
+	// of the image list to check the destination credential.
+	checkImage := "library/hangar"
+	if len(images) > 0 {
+		checkImage = images[0]
+	}
+	checkImage = utils.ConstructRegistry(checkImage, cc.destination)
+	if cc.project != "" {
+		checkImage = utils.ReplaceProjectName(checkImage, cc.project)
+	}
+	cc.addDestination(checkImage)
+	if err := cc.checkCredentials(signalContext, sysCtx); err != nil {
+		return nil, err
+	}
+
+	nameNormalizer, err := cc.newNameNormalizer()
+	if err != nil {
+		return nil, err
+	}
+	rewriteRules, err := cc.loadRewriteRules()
+	if err != nil {
+		return nil, err
+	}
+	indexAnnotations, err := manifest.ParseAnnotations(cc.indexAnnotations)
+	if err != nil {
+		return nil, err
+	}
+	maxFailures, err := cc.failureThreshold()
+	if err != nil {
+		return nil, err
+	}
+	skipBlobs, err := hangar.LoadSkipBlobs(cc.skipBlobsFile)
+	if err != nil {
+		return nil, err
+	}
+	deepVerify, err := hangar.ParseDeepVerify(cc.deepVerify)
+	if err != nil {
+		return nil, err
+	}
+	compatibility, err := cc.compatOpts.compatibility()
+	if err != nil {
+		return nil, err
+	}
+	tenants, err := hangar.LoadProjectTenants(cc.projectMapping)
+	if err != nil {
+		return nil, err
+	}
 	policy, err := cc.getPolicy()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get policy: %w", err)
@@ -169,8 +283,32 @@ func (cc *loadCmd) prepareHangar() (hangar.Hangar, error) {
 			Timeout:             cc.timeout,
 			Workers:             cc.jobs,
 			FailedImageListName: cc.failed,
+			StatusFile:          cc.statusFile,
 			SystemContext:       sysCtx,
 			Policy:              policy,
+			MaxFailures:         maxFailures,
+			KeepGoing:           cc.keepGoing,
+			BatchSize:           cc.batchSize,
+			BreakerThreshold:    cc.breakerThreshold,
+			BreakerCooldown:     cc.breakerCooldown,
+			Tiers:               list.tiers,
+			Optional:            list.optional,
+			ImageListOrigins:    list.origins,
+			ImageListSource:     list.source,
+			TimeBudget:          cc.timeBudget,
+			NameNormalizer:      nameNormalizer,
+			RewriteRules:        rewriteRules,
+			IndexAnnotations:    indexAnnotations,
+			DestinationProxy:    cc.destIsProxy,
+			DeepVerify:          deepVerify,
+			Compatibility:       compatibility,
+			CompatRepository:    cc.compatRepository,
+			CompatSearch:        cc.compatSearch,
+			CompatAPI:           cc.compatAPI,
+			CompatCreate:        cc.compatCreate,
+			CompatBootstrap:     cc.compatBootstrap,
+			AllowDigestChange:   cc.allowDigestChange,
+			MaxMemory:           int64(cc.maxMemory) << 20,
 		},
 
 		SourceRegistry:      cc.sourceRegistry,
@@ -178,6 +316,12 @@ func (cc *loadCmd) prepareHangar() (hangar.Hangar, error) {
 		DestinationProject:  cc.project,
 		SharedBlobDirPath:   "", // Use the default shared blob dir path.
 		ArchiveName:         cc.source,
+		AdjustQuota:         cc.adjustQuota,
+		Passthrough:         cc.passthrough,
+		WarmUp:              cc.warmUp,
+		SkipChecksum:        cc.skipChecksum,
+		SkipBlobs:           skipBlobs,
+		Tenants:             tenants,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create loader: %v", err)
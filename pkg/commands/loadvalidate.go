@@ -46,5 +46,8 @@ hangar load validate \
 		},
 	})
 
+	cc.loadCmd.baseCmd.cmd.Flags().StringVarP(&cc.deepVerify, "deep-verify", "", "",
+		"fetch and hash the destination blobs to detect the storage corruption and check the image config platforms: 'sample' (first & last layers) or 'full' (all layers)")
+
 	return cc
 }
@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// lockOpts is the lock file options to reproduce the bundle.
+type lockOpts struct {
+	lockFile string
+	fromLock string
+
+	// locked is the lock file loaded by '--from-lock'.
+	locked *hangar.Lock
+}
+
+// lockExcludedFlags is the flags not affecting the content of the bundle,
+// which are not recorded into the lock file.
+var lockExcludedFlags = map[string]bool{
+	"file":              true,
+	"image":             true,
+	"destination":       true,
+	"failed":            true,
+	"status-file":       true,
+	"jobs":              true,
+	"timeout":           true,
+	"time-budget":       true,
+	"compress-workers":  true,
+	"staging-buffer":    true,
+	"max-memory":        true,
+	"debug":             true,
+	"yes":               true,
+	"lock-file":         true,
+	"from-lock":         true,
+	"state-file":        true,
+	"export-db":         true,
+	"resume":            true,
+	"proxy-auth":        true,
+	"proxy-auth-helper": true,
+	"pre-run":           true,
+	"post-run":          true,
+	"dry-run":           true,
+}
+
+func (o *lockOpts) addFlags(flags *flag.FlagSet) {
+	flags.StringVarP(&o.lockFile, "lock-file", "", "",
+		"write the resolved source image digests, version and flags into the lock file (e.g. hangar.lock.yaml)")
+	flags.SetAnnotation("lock-file", cobra.BashCompFilenameExt, []string{"yaml"})
+	flags.StringVarP(&o.fromLock, "from-lock", "", "",
+		"reproduce the bundle by the images and flags of the lock file, fail if the source image digests changed")
+	flags.SetAnnotation("from-lock", cobra.BashCompFilenameExt, []string{"yaml"})
+}
+
+// applyLock loads the lock file of '--from-lock', the flags not changed in
+// command line are set by the lock file, and the images of the lock file
+// are used if no image list is provided.
+func (o *lockOpts) applyLock(cmd *cobra.Command, files []string, images *[]string) error {
+	if o.fromLock == "" {
+		return nil
+	}
+	lock, err := hangar.LoadLock(o.fromLock)
+	if err != nil {
+		return err
+	}
+	if lock.HangarVersion != getVersion() {
+		logrus.Warnf("Lock file %q was created by hangar %v, current version %v",
+			o.fromLock, lock.HangarVersion, getVersion())
+	}
+	flags := cmd.Flags()
+	for key, value := range lock.Flags {
+		f := flags.Lookup(key)
+		if f == nil || lockExcludedFlags[key] {
+			logrus.Debugf("lock: skip flag %q: not supported by %q",
+				key, cmd.CommandPath())
+			continue
+		}
+		if f.Changed {
+			// Flags in command line have higher priority.
+			continue
+		}
+		if err := flags.Set(key, value); err != nil {
+			return fmt.Errorf("lock: invalid value of flag %q: %w", key, err)
+		}
+	}
+	if len(files) == 0 && len(*images) == 0 {
+		*images = lock.ImageList()
+	}
+	o.locked = lock
+	return nil
+}
+
+// newLock creates the lock to record the resolved source image digests
+// and the changed flags of the command, returns nil if the lock file is
+// not enabled.
+func (o *lockOpts) newLock(cmd *cobra.Command) *hangar.Lock {
+	if o.lockFile == "" {
+		return nil
+	}
+	flags := map[string]string{}
+	cmd.Flags().Visit(func(f *flag.Flag) {
+		if lockExcludedFlags[f.Name] {
+			return
+		}
+		if v, ok := f.Value.(flag.SliceValue); ok {
+			flags[f.Name] = strings.Join(v.GetSlice(), ",")
+			return
+		}
+		flags[f.Name] = f.Value.String()
+	})
+	return hangar.NewLock(o.lockFile, getVersion(), cmd.CommandPath(), flags)
+}
@@ -1,10 +1,13 @@
 package commands
 
 import (
+	"fmt"
 	"os"
 	"time"
 
+	"github.com/cnrancher/hangar/pkg/backoff"
 	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/oidc"
 	"github.com/containers/common/pkg/auth"
 	commonFlag "github.com/containers/common/pkg/flag"
 	"github.com/containers/common/pkg/retry"
@@ -20,14 +23,29 @@ type loginCmd struct {
 	tlsVerify    commonFlag.OptionalBool // Require HTTPS and verify certificates
 	timeout      time.Duration
 	retryOptions retry.Options
+
+	deviceFlow bool
+	oidcOpts   oidc.LoginOptions
 }
 
 func newLoginCmd() *loginCmd {
 	cc := &loginCmd{}
 	cc.baseCmd = newBaseCmd(&cobra.Command{
-		Use:     "login registry-url",
-		Short:   "Login to registry server",
-		Example: "  hangar login docker.io",
+		Use:               "login registry-url",
+		ValidArgsFunction: completeRegistries,
+		Short:             "Login to registry server",
+		Long: `Login to registry server.
+
+Use '--device-flow' to login by OAuth/OIDC device authorization flow,
+the access token is stored in the auth file and refreshed automatically by
+the refresh token, no password is stored in config files.`,
+		Example: `  hangar login docker.io
+
+  # Login by OAuth device flow:
+  hangar login quay.example.io \
+	--device-flow \
+	--oidc-issuer https://sso.example.io/realms/example \
+	--oidc-client-id hangar`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
 			if cc.baseCmd.debug {
@@ -44,7 +62,14 @@ func newLoginCmd() *loginCmd {
 			if cc.tlsVerify.Present() {
 				sys.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!cc.tlsVerify.Value())
 			}
-			return retry.IfNecessary(ctx, func() error {
+			if cc.deviceFlow {
+				if len(args) != 1 {
+					return fmt.Errorf("registry not provided")
+				}
+				cc.oidcOpts.Stdout = os.Stdout
+				return oidc.Login(ctx, sys, args[0], &cc.oidcOpts)
+			}
+			return backoff.IfNecessary(ctx, func() error {
 				errCh := make(chan error)
 				go func() {
 					// Use go routine to avoid block when SIGINT.
@@ -65,6 +90,11 @@ func newLoginCmd() *loginCmd {
 	flags.IntVar(&cc.retryOptions.MaxRetry, "retry-times", 3, "the number of times to possibly retry")
 	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates")
 	flags.AddFlagSet(auth.GetLoginFlags(&cc.loginOpts))
+	flags.BoolVarP(&cc.deviceFlow, "device-flow", "", false, "login by OAuth/OIDC device authorization flow")
+	flags.StringVarP(&cc.oidcOpts.Issuer, "oidc-issuer", "", "", "OIDC issuer URL used to discover the device authorization endpoints")
+	flags.StringVarP(&cc.oidcOpts.ClientID, "oidc-client-id", "", "", "OAuth client ID of the device flow")
+	flags.StringSliceVarP(&cc.oidcOpts.Scopes, "oidc-scope", "", []string{"openid", "offline_access"}, "OAuth scopes of the device flow")
+	flags.StringVarP(&cc.oidcOpts.Username, "oidc-username", "", oidc.DefaultUsername, "username used to login registry with the access token")
 
 	return cc
 }
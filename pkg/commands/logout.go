@@ -4,7 +4,9 @@ import (
 	"os"
 	"time"
 
+	"github.com/cnrancher/hangar/pkg/backoff"
 	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/oidc"
 	"github.com/containers/common/pkg/auth"
 	commonFlag "github.com/containers/common/pkg/flag"
 	"github.com/containers/common/pkg/retry"
@@ -25,9 +27,10 @@ type logoutCmd struct {
 func newLogoutCmd() *logoutCmd {
 	cc := &logoutCmd{}
 	cc.baseCmd = newBaseCmd(&cobra.Command{
-		Use:     "logout registry-url",
-		Short:   "Logout from registry server",
-		Example: "  hangar logout docker.io",
+		Use:               "logout registry-url",
+		ValidArgsFunction: completeRegistries,
+		Short:             "Logout from registry server",
+		Example:           "  hangar logout docker.io",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
 			if cc.baseCmd.debug {
@@ -41,7 +44,13 @@ func newLogoutCmd() *logoutCmd {
 			if cc.tlsVerify.Present() {
 				sys.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!cc.tlsVerify.Value())
 			}
-			return retry.IfNecessary(ctx, func() error {
+			for _, registry := range args {
+				// Delete the device flow session (refresh token) if exists.
+				if err := oidc.DeleteSession(registry); err != nil {
+					logrus.Warnf("failed to delete OAuth session of %q: %v", registry, err)
+				}
+			}
+			return backoff.IfNecessary(ctx, func() error {
 				return auth.Logout(sys, &cc.logoutOpts, args)
 			}, &cc.retryOptions)
 		},
@@ -1,15 +1,16 @@
 package commands
 
 import (
-	"bufio"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
+	"github.com/cnrancher/hangar/pkg/airgap"
 	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/copy"
 	"github.com/cnrancher/hangar/pkg/hangar"
 	"github.com/cnrancher/hangar/pkg/hangar/imagelist"
+	"github.com/cnrancher/hangar/pkg/manifest"
 	"github.com/cnrancher/hangar/pkg/utils"
 	commonFlag "github.com/containers/common/pkg/flag"
 	"github.com/containers/image/v5/types"
@@ -18,20 +19,58 @@ import (
 )
 
 type mirrorOpts struct {
-	file        string
-	arch        []string
-	os          []string
-	source      string
-	destination string
-	failed      string
-	jobs        int
-	repoType    string
-	timeout     time.Duration
-	skipLogin   bool
-	tlsVerify   commonFlag.OptionalBool
+	file          []string
+	images        []string
+	arch          []string
+	os            []string
+	source        string
+	destination   string
+	failed        string
+	statusFile    string
+	jobs          int
+	repoType      string
+	timeout       time.Duration
+	skipLogin     bool
+	tlsVerify     commonFlag.OptionalBool
+	detectChanges bool
+	dryRun        bool
 
 	sourceProject      string
 	destinationProject string
+
+	stripHistory bool
+	setLabels    []string
+
+	missingPlatformsOnly bool
+	variantRules         []string
+	destIsProxy          bool
+	includeAttestations  bool
+	copyCosign           bool
+	provenance           bool
+	indexAnnotations     []string
+	allowDigestChange    bool
+
+	platformFallback       string
+	platformFallbackReport string
+
+	deepVerify string
+
+	mirrorConfigDir string
+
+	blobConcurrency int
+	maxMemory       int
+
+	trustOpts
+	stateOpts
+	credentialOpts
+	normalizeOpts
+	failureOpts
+	compatOpts
+	probeOpts
+	contentStoreOpts
+	sigstoreOpts
+	compressionOpts
+	hookOpts
 }
 
 type mirrorCmd struct {
@@ -53,7 +92,86 @@ hangar mirror \
 	--source SOURCE_REGISTRY \
 	--destination DESTINATION_REGISTRY \
 	--arch amd64,arm64 \
-	--os linux`,
+	--os linux
+
+# Mirror a few images without the image list file.
+hangar mirror \
+	--image nginx:1.25 \
+	--image redis:7 \
+	--destination DESTINATION_REGISTRY
+
+# Mirror the critical tier images first and stop copying the other tiers
+# after 1 hour, the image list file uses '# tier: critical', '# tier: standard'
+# and '# tier: optional' comments to tag the following images.
+hangar mirror \
+	--file IMAGE_LIST.txt \
+	--destination DESTINATION_REGISTRY \
+	--time-budget 1h
+
+# Images absent in the source or having no image of the specified platforms
+# are skipped without failing the job if marked as optional in the image list
+# by the '?' prefix or the 'optional=true' attribute:
+#   ?docker.io/library/nginx:1.25
+#   docker.io/library/redis:7 optional=true
+hangar mirror \
+	--file IMAGE_LIST.txt \
+	--destination DESTINATION_REGISTRY
+
+# Mirror the image list hosted in git repository at the pinned ref, the
+# fetched commit is recorded into the run history, the credential is read
+# from the HANGAR_GIT_USERNAME and HANGAR_GIT_PASSWORD environment variables.
+hangar mirror \
+	--file git+https://github.com/org/repo.git//lists/images.txt@v1.0.0 \
+	--destination DESTINATION_REGISTRY
+
+# Mirror the images of multiple image lists in one run, the images in
+# multiple lists are copied once and the results are reported per list.
+hangar mirror \
+	--file rancher-images.txt \
+	--file app-images.txt \
+	--destination DESTINATION_REGISTRY
+
+# Push the tarball created by 'docker save' into the registry without
+# loading it into the daemon, the image is pushed as REFERENCE.
+hangar mirror \
+	--image docker-archive:./app.tar:docker.io/username/app:v1.0 \
+	--destination DESTINATION_REGISTRY
+
+# Mirror the Helm charts pushed into the OCI registry with the images in
+# one run, the chart is referenced by the 'oci://' prefix in the image list:
+#   oci://registry.example.io/charts/rancher:2.9.0
+#   docker.io/rancher/rancher:v2.9.0
+hangar mirror \
+	--file IMAGE_LIST.txt \
+	--destination DESTINATION_REGISTRY
+
+# Rewrite the destination repositories by the rules of the YAML file, the
+# first matched prefix or regex rule is applied to the source repository
+# 'REGISTRY/PROJECT/NAME' and replaces the destination repository:
+#   - prefix: docker.io/library/*
+#     replace: registry.example.io/dockerhub-proxy/*
+#   - regex: ^([^/]+)/([^/]+)/.+/([^/]+)$
+#     replace: registry.example.io/$2/$3
+hangar mirror \
+	--file IMAGE_LIST.txt \
+	--destination registry.example.io \
+	--rewrite-rules rewrite-rules.yaml
+
+# Annotate the destination manifest indexes with the bundle release to
+# identify which bundle provided each tag.
+hangar mirror \
+	--file IMAGE_LIST.txt \
+	--destination registry.example.io \
+	--index-annotation org.example.bundle.id=rancher-v2.8.0 \
+	--index-annotation org.example.bundle.created=2024-01-01
+
+# Verify the cosign signatures of the source images against the public
+# key before copy, the unsigned images are failed in the enforce mode.
+hangar mirror \
+	--file IMAGE_LIST.txt \
+	--destination DESTINATION_REGISTRY \
+	--verify-sigstore-pubkey cosign.pub \
+	--verify-mode enforce`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
 			if cc.baseCmd.debug {
@@ -61,30 +179,70 @@ hangar mirror \
 				logrus.Debugf("debug output enabled")
 				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
 			}
-			h, err := cc.prepareHangar()
-			if err != nil {
-				return err
+			if (cc.detectChanges || cc.dryRun) && !cc.baseCmd.debug {
+				// Only output the change list or the plan to stdout.
+				logrus.SetLevel(logrus.WarnLevel)
 			}
-			if err := run(h); err != nil {
-				return err
+			if cc.dryRun {
+				h, err := cc.prepareHangar()
+				if err != nil {
+					return err
+				}
+				return dryRun(h)
 			}
-			return nil
+			return cc.runHooks(cmd, cc.source, cc.destination, func() error {
+				h, err := cc.prepareHangar()
+				if err != nil {
+					return err
+				}
+				if cc.detectChanges {
+					return detectChanges(h)
+				}
+				err = run(h)
+				if e := cc.savePlatformGaps(h); e != nil {
+					logrus.Errorf("%v", e)
+				}
+				if e := cc.writeMirrorConfig(h); e != nil {
+					logrus.Errorf("%v", e)
+				}
+				return err
+			})
 		},
 	})
 
 	flags := cc.baseCmd.cmd.PersistentFlags()
-	flags.StringVarP(&cc.file, "file", "f", "", "image list file")
+	flags.StringSliceVarP(&cc.file, "file", "f", nil, "image list file, can be specified multiple times to process the images of multiple lists in one run")
 	flags.SetAnnotation("file", cobra.BashCompFilenameExt, []string{"txt"})
-	flags.SetAnnotation("file", cobra.BashCompOneRequiredFlag, []string{""})
-	flags.StringSliceVarP(&cc.arch, "arch", "a", []string{"amd64", "arm64"}, "architecture list of images")
-	flags.StringSliceVarP(&cc.os, "os", "", []string{"linux"}, "OS list of images")
+	flags.StringSliceVarP(&cc.images, "image", "", nil, "image to copy, can be specified multiple times instead of the image list file")
+	flags.StringSliceVarP(&cc.arch, "arch", "a", defaultArch(), "architecture list of images")
+	flags.StringSliceVarP(&cc.os, "os", "", defaultOS(), "OS list of images")
 	flags.StringVarP(&cc.source, "source", "s", "", "override the source registry in image list")
+	cc.baseCmd.cmd.RegisterFlagCompletionFunc("source", completeRegistries)
 	flags.StringVarP(&cc.destination, "destination", "d", "", "specify the destination image registry")
+	cc.baseCmd.cmd.RegisterFlagCompletionFunc("destination", completeRegistries)
 	flags.StringVarP(&cc.failed, "failed", "o", "mirror-failed.txt", "file name of the mirror failed image list")
 	flags.SetAnnotation("failed", cobra.BashCompFilenameExt, []string{"txt"})
+	flags.StringVarP(&cc.statusFile, "status-file", "", "", "write the job progress & failures into the status file continuously (JSON format)")
+	flags.SetAnnotation("status-file", cobra.BashCompFilenameExt, []string{"json"})
 	flags.IntVarP(&cc.jobs, "jobs", "j", 1, "worker number,copy images parallelly (1-20)")
+	flags.IntVarP(&cc.blobConcurrency, "blob-concurrency", "", copy.DefaultBlobConcurrency,
+		"number of the blobs of each image copied in parallel, independent of the worker number")
+	flags.IntVarP(&cc.maxMemory, "max-memory", "", 0,
+		"total size (MiB) of the large layers streamed in parallel by all the workers, "+
+			"the layers exceeding the size are copied one at a time, 0 to disable")
 	flags.DurationVarP(&cc.timeout, "timeout", "", time.Minute*10, "timeout when mirror each images")
 	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates")
+	flags.BoolVarP(&cc.detectChanges, "detect-changes", "", false,
+		"compare destination with desired state without copying, exit 2 with JSON change list if changed")
+	flags.BoolVarP(&cc.dryRun, "dry-run", "", false,
+		"resolve the source manifests and output the platform images would be mirrored and their total size without any writes")
+	flags.BoolVarP(&cc.missingPlatformsOnly, "missing-platforms-only", "", false,
+		"only copy the platforms not exists in the destination manifest list and patch the destination manifest list")
+	cc.baseCmd.cmd.Flags().BoolVarP(&cc.allowDigestChange, "allow-digest-change-on-conflict", "", false,
+		"retry the image with the digest preservation disabled if the destination registry rejects the manifest, "+
+			"the changed digests are recorded in the summary")
+	flags.StringSliceVarP(&cc.variantRules, "variant-rule", "", nil,
+		"default variant of the arch in 'ARCH=VARIANT' format when matching platforms (default 'arm=v7,arm64=v8', 'ARCH=' to disable)")
 
 	flags.BoolVarP(&cc.skipLogin, "skip-login", "", false,
 		"skip check the destination registry is logged in (used in shell script)")
@@ -92,6 +250,44 @@ hangar mirror \
 		"override all source image projects")
 	flags.StringVarP(&cc.destinationProject, "destination-project", "", "",
 		"override all destination image projects")
+	flags.BoolVarP(&cc.destIsProxy, "dest-is-proxy", "", false,
+		"the destination registry is a pull-through proxy cache, only check the locally cached content (Harbor, zot or Artifactory)")
+	cc.normalizeOpts.addFlags(flags)
+	cc.compatOpts.addFlags(flags)
+	cc.failureOpts.addFlags(flags)
+	cc.hookOpts.addFlags(cc.baseCmd.cmd.Flags())
+
+	// The config transformations are only available when copying images.
+	cc.baseCmd.cmd.Flags().BoolVarP(&cc.stripHistory, "strip-history", "", false,
+		"strip the build history of the image config (the image digest will be changed)")
+	cc.baseCmd.cmd.Flags().StringSliceVarP(&cc.setLabels, "set-label", "", nil,
+		"set the label of the image config in 'KEY=VALUE' format (the image digest will be changed)")
+
+	cc.baseCmd.cmd.Flags().BoolVarP(&cc.includeAttestations, "include-attestations", "", false,
+		"copy the attestation manifests (unknown/unknown platform) of the image index with the subject images")
+	cc.baseCmd.cmd.Flags().BoolVarP(&cc.copyCosign, "copy-cosign", "", false,
+		"copy the cosign tag-based signature, attestation and SBOM artifacts (sha256-DIGEST.sig/.att/.sbom) of the copied images")
+	cc.baseCmd.cmd.Flags().BoolVarP(&cc.provenance, "provenance", "", false,
+		"annotate the destination manifest index with the source digest & run ID, skip the images mirrored from the same source digest on subsequent runs")
+	cc.baseCmd.cmd.Flags().StringSliceVarP(&cc.indexAnnotations, "index-annotation", "", nil,
+		"set the annotation of the destination manifest index in 'KEY=VALUE' format to identify the bundle "+
+			"(e.g. 'org.example.bundle.version=v2.8.0'), the OCI image index is pushed")
+	cc.baseCmd.cmd.Flags().StringVarP(&cc.platformFallback, "platform-fallback", "", "",
+		"handle the images missing the requested arch: 'report' the missing platforms, or 'copy' the linux/amd64 image as TAG-OS-ARCH-fallback")
+	cc.baseCmd.cmd.Flags().StringVarP(&cc.platformFallbackReport, "platform-fallback-report", "", "",
+		"write the platform fallback report into the file (JSON format)")
+	cc.baseCmd.cmd.Flags().SetAnnotation("platform-fallback-report", cobra.BashCompFilenameExt, []string{"json"})
+	cc.baseCmd.cmd.Flags().StringVarP(&cc.mirrorConfigDir, "mirror-config-dir", "", "",
+		"write the RKE2/K3s registries.yaml and containerd certs.d/REGISTRY/hosts.toml "+
+			"matching the mirrored images into the directory")
+
+	cc.trustOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.stateOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.probeOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.contentStoreOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.sigstoreOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.compressionOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.credentialOpts.addFlags(cc.baseCmd.cmd.Flags())
 
 	addCommands(
 		cc.cmd,
@@ -102,9 +298,6 @@ hangar mirror \
 }
 
 func (cc *mirrorCmd) prepareHangar() (hangar.Hangar, error) {
-	if cc.file == "" {
-		return nil, fmt.Errorf("file not provided")
-	}
 	// if cc.destination == "" {
 	// 	return fmt.Errorf("destination registry URL not provided")
 	// }
@@ -117,25 +310,15 @@ func (cc *mirrorCmd) prepareHangar() (hangar.Hangar, error) {
 			cc.jobs = 1
 		}
 	}
-
-	file, err := os.Open(cc.file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open %q: %v", cc.file, err)
+	if err := checkBlobConcurrency(cc.blobConcurrency); err != nil {
+		return nil, err
 	}
 
-	images := []string{}
-	sc := bufio.NewScanner(file)
-	sc.Split(bufio.ScanLines)
-	for sc.Scan() {
-		l := strings.TrimSpace(sc.Text())
-		if l == "" || strings.HasPrefix(l, "#") || strings.HasPrefix(l, "//") {
-			continue
-		}
-		images = append(images, l)
-	}
-	if err := file.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close %q: %v", cc.file, err)
+	list, err := readImageList(cc.file, cc.images)
+	if err != nil {
+		return nil, err
 	}
+	images := list.images
 
 	sysCtx := cc.baseCmd.newSystemContext()
 	if cc.tlsVerify.Present() {
@@ -155,6 +338,87 @@ func (cc *mirrorCmd) prepareHangar() (hangar.Hangar, error) {
 		}
 	}
 
+	for _, line := range images {
+		src, dest := cc.getSourceDestination(line)
+		if src != "" {
+			cc.addSource(src)
+		}
+		if dest != "" {
+			cc.addDestination(dest)
+		}
+	}
+	if err := cc.checkCredentials(signalContext, sysCtx); err != nil {
+		return nil, err
+	}
+	images = cc.probeSources(signalContext, sysCtx, images, func(line string) string {
+		src, _ := cc.getSourceDestination(line)
+		return src
+	})
+
+	labels, err := copy.ParseLabels(cc.setLabels)
+	if err != nil {
+		return nil, err
+	}
+	indexAnnotations, err := manifest.ParseAnnotations(cc.indexAnnotations)
+	if err != nil {
+		return nil, err
+	}
+	mutation := &copy.ConfigMutation{
+		StripHistory: cc.stripHistory,
+		Labels:       labels,
+	}
+	if !mutation.Empty() {
+		logrus.Infof("Image config transformations: %v", mutation)
+	}
+
+	trustStore, err := cc.newTrustStore()
+	if err != nil {
+		return nil, err
+	}
+	stateStore, err := cc.newStateStore()
+	if err != nil {
+		return nil, err
+	}
+	nameNormalizer, err := cc.newNameNormalizer()
+	if err != nil {
+		return nil, err
+	}
+	rewriteRules, err := cc.loadRewriteRules()
+	if err != nil {
+		return nil, err
+	}
+	maxFailures, err := cc.failureThreshold()
+	if err != nil {
+		return nil, err
+	}
+	contentStore, err := cc.newContentStore()
+	if err != nil {
+		return nil, err
+	}
+	sigstoreVerifier, err := cc.newSigstoreVerifier()
+	if err != nil {
+		return nil, err
+	}
+	layerCompression, err := cc.newLayerCompression()
+	if err != nil {
+		return nil, err
+	}
+	platformFallback, err := hangar.ParsePlatformFallback(cc.platformFallback)
+	if err != nil {
+		return nil, err
+	}
+	deepVerify, err := hangar.ParseDeepVerify(cc.deepVerify)
+	if err != nil {
+		return nil, err
+	}
+	compatibility, err := cc.compatOpts.compatibility()
+	if err != nil {
+		return nil, err
+	}
+	variantRules, err := utils.ParseVariantRules(cc.variantRules)
+	if err != nil {
+		return nil, err
+	}
 	policy, err := cc.getPolicy()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get policy: %w", err)
@@ -167,15 +431,56 @@ func (cc *mirrorCmd) prepareHangar() (hangar.Hangar, error) {
 			Variant:             nil, // TODO: support variants
 			Timeout:             cc.timeout,
 			Workers:             cc.jobs,
+			BlobConcurrency:     cc.blobConcurrency,
+			MaxMemory:           int64(cc.maxMemory) << 20,
 			FailedImageListName: cc.failed,
+			StatusFile:          cc.statusFile,
 			SystemContext:       sysCtx,
 			Policy:              policy,
+			MaxFailures:         maxFailures,
+			KeepGoing:           cc.keepGoing,
+			BatchSize:           cc.batchSize,
+			BreakerThreshold:    cc.breakerThreshold,
+			BreakerCooldown:     cc.breakerCooldown,
+			Tiers:               list.tiers,
+			Optional:            list.optional,
+			ImageListOrigins:    list.origins,
+			ImageListSource:     list.source,
+			TimeBudget:          cc.timeBudget,
+			ContentStore:        contentStore,
+			SigstoreVerifier:    sigstoreVerifier,
+			LayerCompression:    layerCompression,
+			AllowedRegistries:   cc.allowedRegistries,
+			TrustStore:          trustStore,
+			AcceptChanges:       cc.acceptChanges,
+			StateStore:          stateStore,
+			OnlyIfChanged:       cc.onlyIfChanged,
+			NameNormalizer:      nameNormalizer,
+			RewriteRules:        rewriteRules,
+			IndexAnnotations:    indexAnnotations,
+			DestinationProxy:    cc.destIsProxy,
+			IncludeAttestations: cc.includeAttestations,
+			DeepVerify:          deepVerify,
+			Compatibility:       compatibility,
+			CompatRepository:    cc.compatRepository,
+			CompatSearch:        cc.compatSearch,
+			CompatAPI:           cc.compatAPI,
+			CompatCreate:        cc.compatCreate,
+			CompatBootstrap:     cc.compatBootstrap,
+			AllowDigestChange:   cc.allowDigestChange,
+			VariantRules:        variantRules,
 		},
 
 		SourceRegistry:      cc.source,
 		SourceProject:       cc.sourceProject,
 		DestinationRegistry: cc.destination,
 		DestinationProject:  cc.destinationProject,
+		ConfigMutation:      mutation,
+
+		MissingPlatformsOnly: cc.missingPlatformsOnly,
+		PlatformFallback:     platformFallback,
+		CopyCosign:           cc.copyCosign,
+		Provenance:           cc.provenance,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create mirrorer: %v", err)
@@ -186,6 +491,84 @@ func (cc *mirrorCmd) prepareHangar() (hangar.Hangar, error) {
 	return m, nil
 }
 
+// savePlatformGaps writes the platform fallback report into file.
+func (cc *mirrorCmd) savePlatformGaps(h hangar.Hangar) error {
+	if cc.platformFallbackReport == "" {
+		return nil
+	}
+	m, ok := h.(*hangar.Mirrorer)
+	if !ok {
+		return nil
+	}
+	gaps := m.PlatformGaps()
+	if gaps == nil {
+		gaps = []*hangar.PlatformGap{}
+	}
+	if err := utils.SaveJSON(gaps, cc.platformFallbackReport); err != nil {
+		return fmt.Errorf("failed to save platform fallback report: %w", err)
+	}
+	logrus.Infof("Platform fallback report exported to %q", cc.platformFallbackReport)
+	return nil
+}
+
+// writeMirrorConfig writes the registries.yaml and hosts.toml mirroring the
+// source registries to the destination registry.
+func (cc *mirrorCmd) writeMirrorConfig(h hangar.Hangar) error {
+	if cc.mirrorConfigDir == "" {
+		return nil
+	}
+	m, ok := h.(*hangar.Mirrorer)
+	if !ok {
+		return nil
+	}
+	if err := airgap.WriteMirrorConfig(
+		cc.mirrorConfigDir, cc.destination, m.Mappings()); err != nil {
+		return fmt.Errorf("failed to write mirror config: %w", err)
+	}
+	logrus.Infof("Mirror config exported to %q", cc.mirrorConfigDir)
+	return nil
+}
+
+// getSourceDestination gets the source and destination image name of the
+// image list line, returns empty strings if the line is invalid.
+func (cc *mirrorCmd) getSourceDestination(line string) (string, string) {
+	var src, dest string
+	switch imagelist.Detect(line) {
+	case imagelist.TypeDefault:
+		src, dest = line, line
+	case imagelist.TypeMirror:
+		spec, _ := imagelist.GetMirrorSpec(line)
+		if len(spec) != 3 {
+			return "", ""
+		}
+		src, dest = spec[0], spec[1]
+	case imagelist.TypePair:
+		src, dest, _ = imagelist.GetPairSpec(line)
+	case imagelist.TypeDockerArchive:
+		// The source image is read from the local tarball.
+		_, ref, _ := imagelist.GetDockerArchiveSpec(line)
+		dest = utils.ConstructRegistry(ref, cc.destination)
+		if cc.destinationProject != "" {
+			dest = utils.ReplaceProjectName(dest, cc.destinationProject)
+		}
+		return "", dest
+	case imagelist.TypeChart:
+		src, _ = imagelist.GetChartSpec(line)
+		dest = src
+	default:
+		return "", ""
+	}
+	src = utils.ConstructRegistry(src, cc.source)
+	if cc.sourceProject != "" {
+		src = utils.ReplaceProjectName(src, cc.sourceProject)
+	}
+	dest = utils.ConstructRegistry(dest, cc.destination)
+	if cc.destinationProject != "" {
+		dest = utils.ReplaceProjectName(dest, cc.destinationProject)
+	}
+	return src, dest
+}
+
 // getRegistrySet only gets the destination registry set: map[registry-url]true.
 func (cc *mirrorCmd) getRegistrySet(images []string) map[string]bool {
 	set := map[string]bool{}
@@ -205,6 +588,15 @@ func (cc *mirrorCmd) getRegistrySet(images []string) map[string]bool {
 				continue
 			}
 			set[utils.GetRegistryName(spec[1])] = true
+		case imagelist.TypePair:
+			_, dest, _ := imagelist.GetPairSpec(line)
+			set[utils.GetRegistryName(dest)] = true
+		case imagelist.TypeDockerArchive:
+			_, ref, _ := imagelist.GetDockerArchiveSpec(line)
+			set[utils.GetRegistryName(ref)] = true
+		case imagelist.TypeChart:
+			ref, _ := imagelist.GetChartSpec(line)
+			set[utils.GetRegistryName(ref)] = true
 		default:
 		}
 	}
@@ -27,7 +27,13 @@ hangar mirror validate \
 	--source SOURCE_REGISTRY \
 	--destination DESTINATION_REGISTRY \
 	--arch amd64,arm64 \
-	--os linux`,
+	--os linux
+
+# Fetch and hash all blobs of the destination images:
+hangar mirror validate \
+	--file IMAGE_LIST.txt \
+	--destination DESTINATION_REGISTRY \
+	--deep-verify full`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
 			if cc.baseCmd.debug {
@@ -46,5 +52,8 @@ hangar mirror validate \
 		},
 	})
 
+	cc.mirrorCmd.baseCmd.cmd.Flags().StringVarP(&cc.deepVerify, "deep-verify", "", "",
+		"fetch and hash the destination blobs to detect the storage corruption and check the image config platforms: 'sample' (first & last layers) or 'full' (all layers)")
+
 	return cc
 }
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"github.com/cnrancher/hangar/pkg/destination"
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// normalizeOpts is the destination repository name normalization options.
+type normalizeOpts struct {
+	lowercaseNames bool
+	maxPathDepth   int
+	nameMapping    string
+	rewriteRules   string
+}
+
+func (o *normalizeOpts) addFlags(flags *flag.FlagSet) {
+	flags.BoolVarP(&o.lowercaseNames, "lowercase-names", "", false,
+		"convert the destination repository names to lowercase")
+	flags.IntVarP(&o.maxPathDepth, "max-path-depth", "", 0,
+		"limit the path depth of the destination repositories, the exceeded path is replaced by hash (0: no limit)")
+	flags.StringVarP(&o.nameMapping, "name-mapping", "", "",
+		"record the normalized destination repository names into the mapping file to apply on future runs")
+	flags.StringVarP(&o.rewriteRules, "rewrite-rules", "", "",
+		"rewrite the source repositories into the destination repositories by the prefix or regex rules of the YAML file")
+	flags.SetAnnotation("rewrite-rules", cobra.BashCompFilenameExt, []string{"yaml", "yml"})
+}
+
+// newNameNormalizer creates the name normalizer, returns nil if the name
+// normalization is not enabled.
+func (o *normalizeOpts) newNameNormalizer() (*hangar.NameNormalizer, error) {
+	if !o.lowercaseNames && o.maxPathDepth == 0 && o.nameMapping == "" {
+		return nil, nil
+	}
+	return hangar.NewNameNormalizer(&hangar.NameNormalizerOpts{
+		Lowercase:   o.lowercaseNames,
+		MaxDepth:    o.maxPathDepth,
+		MappingFile: o.nameMapping,
+	})
+}
+
+// loadRewriteRules reads the destination rewrite rules, returns nil if the
+// rewrite rules file is not specified.
+func (o *normalizeOpts) loadRewriteRules() (destination.RewriteRules, error) {
+	if o.rewriteRules == "" {
+		return nil, nil
+	}
+	return destination.LoadRewriteRules(o.rewriteRules)
+}
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/operator"
+	"github.com/cnrancher/hangar/pkg/utils"
+	commonFlag "github.com/containers/common/pkg/flag"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type operatorCmd struct {
+	*baseCmd
+
+	namespace string
+	resync    time.Duration
+	workers   int
+	timeout   time.Duration
+	tlsVerify commonFlag.OptionalBool
+	printCRD  bool
+}
+
+func newOperatorCmd() *operatorCmd {
+	cc := &operatorCmd{}
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "operator",
+		Short: "Run in operator mode to reconcile the ImageMirror resources",
+		Long: `Run in operator mode inside the Kubernetes cluster.
+
+The operator watches the ImageMirror custom resources, mirrors the image
+list of each resource to its destination registry when the spec changed
+or the schedule interval elapsed, and reports the per-image state in the
+resource status.`,
+		Example: `# Print the CustomResourceDefinition of the ImageMirror:
+hangar operator --print-crd > crd.yaml
+
+# Run the operator to reconcile the ImageMirror in all namespaces:
+hangar operator --resync 1m
+
+# Run the operator to reconcile the ImageMirror in namespace 'hangar':
+hangar operator --namespace hangar`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+			return cc.run()
+		},
+	})
+
+	flags := cc.baseCmd.cmd.Flags()
+	flags.StringVarP(&cc.namespace, "namespace", "n", "", "namespace to watch (default all namespaces)")
+	flags.DurationVarP(&cc.resync, "resync", "", time.Minute, "interval to re-check the schedule of the watched ImageMirror resources")
+	flags.IntVarP(&cc.workers, "workers", "", 2, "number of ImageMirror resources reconciled concurrently")
+	flags.DurationVarP(&cc.timeout, "timeout", "", time.Minute*10, "timeout when mirror each images")
+	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates")
+	flags.BoolVarP(&cc.printCRD, "print-crd", "", false, "print the CustomResourceDefinition manifest of the ImageMirror and exit")
+
+	return cc
+}
+
+func (cc *operatorCmd) run() error {
+	if cc.printCRD {
+		_, err := os.Stdout.Write(operator.CRD())
+		return err
+	}
+
+	client, err := operator.NewInClusterClient()
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	sysCtx := cc.baseCmd.newSystemContext()
+	if cc.tlsVerify.Present() {
+		sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!cc.tlsVerify.Value())
+		sysCtx.OCIInsecureSkipTLSVerify = !cc.tlsVerify.Value()
+	}
+	policy, err := cc.getPolicy()
+	if err != nil {
+		return fmt.Errorf("failed to get policy: %w", err)
+	}
+	c, err := operator.NewController(&operator.ControllerOpts{
+		Client:        client,
+		Namespace:     cc.namespace,
+		Resync:        cc.resync,
+		Workers:       cc.workers,
+		Timeout:       cc.timeout,
+		SystemContext: sysCtx,
+		Policy:        policy,
+	})
+	if err != nil {
+		return err
+	}
+	return c.Run(signalContext)
+}
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/history"
+	"github.com/cnrancher/hangar/pkg/plugin"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type pluginCmd struct {
+	*baseCmd
+}
+
+func newPluginCmd() *pluginCmd {
+	cc := &pluginCmd{}
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "plugin",
+		Short: "Manage the hangar plugins",
+		Long: `Manage the hangar plugins.
+
+Any executable named 'hangar-NAME' in PATH can be executed as 'hangar NAME',
+the dash in executable name separates the subcommands, e.g. 'hangar-foo-bar'
+is executed as 'hangar foo bar'.
+
+The following environment variables are passed to the plugins:
+
+  ` + strings.Join([]string{
+			plugin.EnvVersion + ": hangar version",
+			plugin.EnvBinary + ": path of the hangar executable",
+			plugin.EnvConfig + ": path of the hangar config file",
+			plugin.EnvAuthFile + ": path of the registry auth file",
+			plugin.EnvHistoryFile + ": path of the run history file",
+		}, "\n  "),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	})
+
+	addCommands(
+		cc.cmd,
+		newPluginListCmd(),
+	)
+	return cc
+}
+
+type pluginListCmd struct {
+	*baseCmd
+}
+
+func newPluginListCmd() *pluginListCmd {
+	cc := &pluginListCmd{}
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:     "list",
+		Short:   "List the hangar plugins found in PATH",
+		Example: "  hangar plugin list",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+			}
+			plugins := plugin.List()
+			if len(plugins) == 0 {
+				logrus.Infof("No plugins found in PATH")
+				return nil
+			}
+			for _, p := range plugins {
+				fmt.Printf("%-20s %s\n", p.Name, p.Path)
+			}
+			return nil
+		},
+	})
+	return cc
+}
+
+// execPlugin executes the 'hangar-NAME' plugin executable if the command
+// is not a builtin command of hangar, the current process is replaced
+// by the plugin if found.
+func execPlugin(root *cobra.Command, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return nil
+	}
+	if c, _, err := root.Find(args); err == nil && c != root {
+		// Builtin command.
+		return nil
+	}
+	switch args[0] {
+	case "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return nil
+	}
+	p, pluginArgs, ok := plugin.Lookup(args)
+	if !ok {
+		return nil
+	}
+	logrus.Debugf("executing plugin %q: %v", p.Name, p.Path)
+	return p.Exec(pluginArgs, pluginEnv())
+}
+
+// pluginEnv returns the structured context passed to plugins by env.
+func pluginEnv() map[string]string {
+	env := map[string]string{
+		plugin.EnvVersion:     utils.Version,
+		plugin.EnvConfig:      cmdconfig.DefaultConfigPath(),
+		plugin.EnvAuthFile:    defaultAuthFile(),
+		plugin.EnvHistoryFile: history.DefaultPath(),
+	}
+	if exe, err := os.Executable(); err == nil {
+		env[plugin.EnvBinary] = exe
+	}
+	return env
+}
+
+// defaultAuthFile returns the registry auth file path used by hangar.
+func defaultAuthFile() string {
+	if p := os.Getenv("REGISTRY_AUTH_FILE"); p != "" {
+		return p
+	}
+	if d := os.Getenv("XDG_RUNTIME_DIR"); d != "" {
+		return filepath.Join(d, "containers", "auth.json")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("containers-user-%d", os.Getuid()),
+		"containers", "auth.json")
+}
@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/probe"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	flag "github.com/spf13/pflag"
+)
+
+// probeOpts is the options of the source registry health & latency probe
+// before the job starts.
+type probeOpts struct {
+	probe        bool
+	probeSlow    time.Duration
+	probeReorder bool
+}
+
+func (o *probeOpts) addFlags(flags *flag.FlagSet) {
+	flags.BoolVarP(&o.probe, "probe", "", false,
+		"probe the health and latency of the source registries before the job starts")
+	flags.DurationVarP(&o.probeSlow, "probe-slow", "", time.Second*3,
+		"latency threshold to warn the slow source registries")
+	flags.BoolVarP(&o.probeReorder, "probe-reorder", "", false,
+		"start with the images of the healthy source registries (requires '--probe')")
+}
+
+// probeSources probes each distinct source registry of the images,
+// returns the images reordered by the registry health if reorder enabled.
+// The sourceOf function returns the source image of the image list line.
+func (o *probeOpts) probeSources(
+	ctx context.Context,
+	sysCtx *types.SystemContext,
+	images []string,
+	sourceOf func(line string) string,
+) []string {
+	if !o.probe {
+		if o.probeReorder {
+			logrus.Warnf("'--probe-reorder' is ignored since '--probe' not provided")
+		}
+		return images
+	}
+
+	// Use the first image of the registry as the sample image.
+	samples := map[string]string{}
+	lineRegistry := make([]string, len(images))
+	for i, line := range images {
+		src := sourceOf(line)
+		if src == "" {
+			continue
+		}
+		registry := utils.GetRegistryName(src)
+		lineRegistry[i] = registry
+		if _, ok := samples[registry]; !ok {
+			samples[registry] = src
+		}
+	}
+
+	var (
+		results = make([]*probe.Result, 0, len(samples))
+		mutex   = &sync.Mutex{}
+		wg      = &sync.WaitGroup{}
+	)
+	for registry, image := range samples {
+		wg.Add(1)
+		go func(registry, image string) {
+			defer wg.Done()
+			r := probe.Probe(ctx, &probe.Options{
+				Registry:      registry,
+				Image:         image,
+				SystemContext: utils.CopySystemContext(sysCtx),
+			})
+			mutex.Lock()
+			results = append(results, r)
+			mutex.Unlock()
+		}(registry, image)
+	}
+	wg.Wait()
+
+	probe.Sort(results, o.probeSlow)
+	rank := map[string]int{}
+	for i, r := range results {
+		rank[r.Registry] = i
+		switch {
+		case !r.Reachable:
+			logrus.Warnf("Source registry %q is unreachable: %v", r.Registry, r.Err)
+		case r.Err != nil:
+			logrus.Warnf("Source registry %q is unhealthy (ping %v): %v",
+				r.Registry, r.PingLatency.Round(time.Millisecond), r.Err)
+		case !r.Healthy(o.probeSlow):
+			logrus.Warnf("Source registry %q is slow: ping %v, manifest & blob %v",
+				r.Registry, r.PingLatency.Round(time.Millisecond),
+				r.BlobLatency.Round(time.Millisecond))
+		default:
+			logrus.Infof("Source registry %q is healthy: ping %v, manifest & blob %v",
+				r.Registry, r.PingLatency.Round(time.Millisecond),
+				r.BlobLatency.Round(time.Millisecond))
+		}
+	}
+	if !o.probeReorder {
+		return images
+	}
+
+	index := make([]int, len(images))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		return rank[lineRegistry[index[i]]] < rank[lineRegistry[index[j]]]
+	})
+	reordered := make([]string, 0, len(images))
+	for _, i := range index {
+		reordered = append(reordered, images[i])
+	}
+	logrus.Infof("Reordered the images to start with the healthy source registries")
+	return reordered
+}
@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/cnrancher/hangar/pkg/proxy"
+	"github.com/cnrancher/hangar/pkg/utils"
+	commonFlag "github.com/containers/common/pkg/flag"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type proxyCmd struct {
+	*baseCmd
+
+	listen    string
+	upstream  string
+	archive   string
+	cacheDir  string
+	tlsVerify commonFlag.OptionalBool
+}
+
+func newProxyCmd() *proxyCmd {
+	cc := &proxyCmd{}
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "proxy --listen :5000 --upstream docker.io --archive CACHE.zip",
+		Short: "Run the read-through caching proxy persisting pulls into archive",
+		Long: `Run the read-through caching pull-through registry of the upstream
+registry, the images pulled through the proxy are persisted into the
+hangar archive file after the proxy stopped (Ctrl-C).
+
+Configure the proxy as the registry mirror of the container runtime and
+run the normal online installation, the archive file produced can be
+loaded by 'hangar load' for the later offline installations.
+
+Only the platform images pulled completely are written into the archive.`,
+		Example: `# Run the caching proxy of Docker Hub:
+hangar proxy \
+	--listen :5000 \
+	--upstream docker.io \
+	--archive CACHE.zip`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+
+			return cc.run()
+		},
+	})
+
+	flags := cc.baseCmd.cmd.Flags()
+	flags.StringVarP(&cc.listen, "listen", "l", ":5000", "listen address of the caching proxy")
+	flags.StringVarP(&cc.upstream, "upstream", "u", "docker.io", "upstream registry of the caching proxy")
+	cc.baseCmd.cmd.RegisterFlagCompletionFunc("upstream", completeRegistries)
+	flags.StringVarP(&cc.archive, "archive", "a", "", "archive file to persist the pulled images (.zip)")
+	flags.SetAnnotation("archive", cobra.BashCompFilenameExt, []string{"zip"})
+	flags.StringVarP(&cc.cacheDir, "cache-dir", "", "",
+		"directory to cache the pulled manifests and blobs, reused by the next run (default temporary directory)")
+	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates of the upstream")
+
+	return cc
+}
+
+func (cc *proxyCmd) run() error {
+	if cc.archive == "" {
+		return fmt.Errorf("archive file not provided, use '--archive' to provide the archive file")
+	}
+	cacheDir := cc.cacheDir
+	if cacheDir == "" {
+		dir, err := os.MkdirTemp(archive.CacheDir(), "*")
+		if err != nil {
+			return fmt.Errorf("failed to create cache dir: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		cacheDir = dir
+	}
+
+	sysCtx := cc.baseCmd.newSystemContext()
+	if cc.tlsVerify.Present() {
+		sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!cc.tlsVerify.Value())
+		sysCtx.OCIInsecureSkipTLSVerify = !cc.tlsVerify.Value()
+	}
+	p, err := proxy.New(&proxy.Options{
+		Upstream:      cc.upstream,
+		CacheDir:      cacheDir,
+		SystemContext: sysCtx,
+	})
+	if err != nil {
+		return err
+	}
+	if err := p.Serve(signalContext, cc.listen); err != nil {
+		return fmt.Errorf("failed to serve caching proxy: %w", err)
+	}
+
+	logrus.Infof("Writing pulled images into archive %q", cc.archive)
+	n, err := p.WriteArchive(cc.archive)
+	if err != nil {
+		return fmt.Errorf("failed to write archive %q: %w", cc.archive, err)
+	}
+	logrus.Infof("%d images written into archive %q", n, cc.archive)
+	return nil
+}
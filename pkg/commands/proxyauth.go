@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/proxyauth"
+	flag "github.com/spf13/pflag"
+)
+
+// proxyEnvs is the proxy environment variables of the HTTP transport, the
+// upper case variables have higher priority.
+var proxyEnvs = []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"}
+
+// proxyAuthCloser stops the proxy connector after command executed.
+var proxyAuthCloser io.Closer
+
+// proxyAuthOpts is the options of the proxy requiring the NTLM or
+// Negotiate (Kerberos) authentication.
+type proxyAuthOpts struct {
+	scheme string
+	helper string
+}
+
+func (o *proxyAuthOpts) addFlags(flags *flag.FlagSet) {
+	flags.StringVar(&o.scheme, "proxy-auth", "",
+		"authentication scheme of the HTTPS_PROXY/HTTP_PROXY proxy (ntlm, negotiate)")
+	flags.StringVar(&o.helper, "proxy-auth-helper", "",
+		"command to get the tokens of the proxy authentication, executed as 'COMMAND SCHEME PROXY_HOST' "+
+			"with the base64 challenge in stdin and the base64 token in stdout (required by negotiate)")
+}
+
+// start starts the local proxy connector doing the authentication
+// handshake with the proxy of the environment variables, and points the
+// proxy environment variables to the connector. The NTLM credential is
+// read from the HANGAR_PROXY_USERNAME ('DOMAIN\USER') and
+// HANGAR_PROXY_PASSWORD environment variables, or the proxy URL.
+func (o *proxyAuthOpts) start() (io.Closer, error) {
+	if o.scheme == "" {
+		if o.helper != "" {
+			return nil, fmt.Errorf("'--proxy-auth-helper' requires '--proxy-auth'")
+		}
+		return nil, nil
+	}
+	upstream := proxyFromEnvironment()
+	if upstream == nil {
+		return nil, fmt.Errorf("'--proxy-auth' requires the HTTPS_PROXY or HTTP_PROXY environment variable")
+	}
+
+	var (
+		auth proxyauth.Authenticator
+		err  error
+	)
+	switch strings.ToLower(o.scheme) {
+	case "ntlm":
+		if o.helper != "" {
+			auth, err = proxyauth.NewHelper("NTLM", o.helper)
+			break
+		}
+		username := os.Getenv("HANGAR_PROXY_USERNAME")
+		password := os.Getenv("HANGAR_PROXY_PASSWORD")
+		if username == "" && upstream.User != nil {
+			username = upstream.User.Username()
+			password, _ = upstream.User.Password()
+		}
+		if username == "" {
+			return nil, fmt.Errorf("NTLM proxy credential not provided: " +
+				"set the HANGAR_PROXY_USERNAME and HANGAR_PROXY_PASSWORD environment variables")
+		}
+		auth = proxyauth.NewNTLM(username, password)
+	case "negotiate":
+		if o.helper == "" {
+			return nil, fmt.Errorf("'--proxy-auth-helper' is required by the negotiate proxy authentication")
+		}
+		auth, err = proxyauth.NewHelper("Negotiate", o.helper)
+	default:
+		return nil, fmt.Errorf("unsupported proxy authentication %q: should be ntlm or negotiate", o.scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	upstream.User = nil
+	c, err := proxyauth.New(&proxyauth.Options{
+		Upstream:      upstream.String(),
+		Authenticator: auth,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.Start()
+	for _, k := range proxyEnvs {
+		os.Setenv(k, c.URL())
+	}
+	return c, nil
+}
+
+// proxyFromEnvironment returns the proxy URL of the environment
+// variables.
+func proxyFromEnvironment() *url.URL {
+	for _, k := range proxyEnvs {
+		v := os.Getenv(k)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "://") {
+			v = "http://" + v
+		}
+		u, err := url.Parse(v)
+		if err != nil {
+			continue
+		}
+		return u
+	}
+	return nil
+}
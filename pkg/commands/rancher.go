@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type rancherCmd struct {
+	*baseCmd
+}
+
+func newRancherCmd() *rancherCmd {
+	cc := &rancherCmd{}
+
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "rancher",
+		Short: "Helpers for managing Rancher images",
+		Long:  "",
+		Example: `
+# Get the images need to be added into registry to upgrade Rancher:
+hangar rancher upgrade-plan \
+	--from v2.7.9 \
+	--to v2.8.0 \
+	--destination REGISTRY_URL`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+			return cmd.Help()
+		},
+	})
+
+	addCommands(cc.cmd,
+		newRancherUpgradePlanCmd(),
+	)
+	return cc
+}
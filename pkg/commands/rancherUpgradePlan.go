@@ -0,0 +1,217 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/cnrancher/hangar/pkg/rancher/chartimages"
+	"github.com/cnrancher/hangar/pkg/rancher/listgenerator"
+	"github.com/cnrancher/hangar/pkg/rancher/upgradeplan"
+	"github.com/cnrancher/hangar/pkg/utils"
+	commonFlag "github.com/containers/common/pkg/flag"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/semver"
+)
+
+type rancherUpgradePlanCmd struct {
+	*baseCmd
+
+	from        string
+	to          string
+	destination string
+	output      string
+	outputPlan  string
+	archive     string
+	arch        []string
+	os          []string
+	jobs        int
+	timeout     time.Duration
+	failed      string
+	dev         bool
+	tlsVerify   commonFlag.OptionalBool
+}
+
+func newRancherUpgradePlanCmd() *rancherUpgradePlanCmd {
+	cc := &rancherUpgradePlanCmd{}
+
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "upgrade-plan --from CURRENT_VERSION --to TARGET_VERSION -d REGISTRY_URL",
+		Short: "Output the images need to be added into registry to upgrade Rancher",
+		Long: `'upgrade-plan' generates the image lists of the current and target Rancher versions,
+queries the destination registry and outputs the images not exist in the registry.`,
+		Example: `
+# Output the delta image list:
+hangar rancher upgrade-plan \
+	--from v2.7.9 \
+	--to v2.8.0 \
+	--destination REGISTRY_URL \
+	--output upgrade-images.txt
+
+# Save the delta images into archive file:
+hangar rancher upgrade-plan \
+	--from v2.7.9 \
+	--to v2.8.0 \
+	--destination REGISTRY_URL \
+	--archive upgrade-images.zip`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+			return cc.run(signalContext)
+		},
+	})
+
+	flags := cc.baseCmd.cmd.Flags()
+	flags.StringVarP(&cc.from, "from", "", "", "current rancher version (use '-ent' suffix for Rancher Prime Manager GC) (required)")
+	flags.StringVarP(&cc.to, "to", "", "", "target rancher version (use '-ent' suffix for Rancher Prime Manager GC) (required)")
+	flags.StringVarP(&cc.destination, "destination", "d", "", "destination registry to query the existing images (required)")
+	cc.baseCmd.cmd.RegisterFlagCompletionFunc("destination", completeRegistries)
+	flags.StringVarP(&cc.output, "output", "o", "upgrade-images.txt", "output delta image list file")
+	flags.StringVarP(&cc.outputPlan, "output-plan", "", "", "output the upgrade plan in JSON format")
+	flags.StringVarP(&cc.archive, "archive", "", "", "save the delta images into archive file")
+	flags.SetAnnotation("archive", cobra.BashCompFilenameExt, []string{"zip"})
+	flags.StringSliceVarP(&cc.arch, "arch", "a", defaultArch(), "architecture list of images (used with '--archive')")
+	flags.StringSliceVarP(&cc.os, "os", "", defaultOS(), "OS list of images (used with '--archive')")
+	flags.IntVarP(&cc.jobs, "jobs", "j", 5, "worker number, query & save images parallelly (1-20)")
+	flags.DurationVarP(&cc.timeout, "timeout", "", time.Minute*10, "timeout when save each images (used with '--archive')")
+	flags.StringVarP(&cc.failed, "failed", "", "save-failed.txt", "file name of the save failed image list (used with '--archive')")
+	flags.BoolVarP(&cc.dev, "dev", "", false, "switch to dev branch/URL of charts & KDM data")
+	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates")
+
+	return cc
+}
+
+func (cc *rancherUpgradePlanCmd) run(ctx context.Context) error {
+	if cc.from == "" || cc.to == "" {
+		return fmt.Errorf("rancher version not specified, use '--from' and '--to' to specify the rancher versions")
+	}
+	if cc.destination == "" {
+		return fmt.Errorf("destination registry not specified, use '--destination' to specify the registry")
+	}
+	if cc.jobs > utils.MaxWorkerNum || cc.jobs < utils.MinWorkerNum {
+		logrus.Warnf("invalid worker num: %v, set to 5", cc.jobs)
+		cc.jobs = 5
+	}
+
+	logrus.Infof("generating image list of current version %q", cc.from)
+	current, err := cc.generateImages(ctx, cc.from)
+	if err != nil {
+		return fmt.Errorf("failed to generate image list of %q: %w", cc.from, err)
+	}
+	logrus.Infof("generating image list of target version %q", cc.to)
+	target, err := cc.generateImages(ctx, cc.to)
+	if err != nil {
+		return fmt.Errorf("failed to generate image list of %q: %w", cc.to, err)
+	}
+
+	sysCtx := cc.baseCmd.newSystemContext()
+	if cc.tlsVerify.Present() {
+		sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!cc.tlsVerify.Value())
+		sysCtx.OCIInsecureSkipTLSVerify = !cc.tlsVerify.Value()
+	}
+	logrus.Infof("querying existing images in %q", cc.destination)
+	plan, err := upgradeplan.Compute(ctx, &upgradeplan.Options{
+		CurrentImages: current,
+		TargetImages:  target,
+		Registry:      cc.destination,
+		SystemContext: sysCtx,
+		Workers:       cc.jobs,
+	})
+	if err != nil {
+		return err
+	}
+	logrus.Infof("required %d images (%d added by %q), %d already exist, %d missing",
+		len(plan.Required), len(plan.Added), cc.to, len(plan.Present), len(plan.Missing))
+
+	if cc.output != "" {
+		if err := utils.SaveSlice(cc.output, plan.Missing); err != nil {
+			return err
+		}
+		logrus.Infof("delta image list saved to %q", cc.output)
+	}
+	if cc.outputPlan != "" {
+		if err := utils.SaveJSON(plan, cc.outputPlan); err != nil {
+			return err
+		}
+		logrus.Infof("upgrade plan saved to %q", cc.outputPlan)
+	}
+	if cc.archive == "" {
+		return nil
+	}
+	if len(plan.Missing) == 0 {
+		logrus.Infof("no image need to be saved, skip creating archive")
+		return nil
+	}
+	return cc.saveArchive(plan.Missing, sysCtx)
+}
+
+// generateImages generates the image list of the Rancher version from the
+// default charts & KDM data.
+func (cc *rancherUpgradePlanCmd) generateImages(
+	ctx context.Context, version string,
+) ([]string, error) {
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	isRPMGC := false
+	if strings.Contains(version, "-ent") {
+		isRPMGC = true
+		version = strings.Split(version, "-ent")[0]
+	}
+	if !semver.IsValid(version) {
+		return nil, fmt.Errorf("%q is not valid semver", version)
+	}
+	o := &listgenerator.GeneratorOpts{
+		RancherVersion: version,
+		MinKubeVersion: minKubeVersion(version),
+		ChartsPaths:    make(map[string]chartimages.ChartRepoType),
+		ChartURLs:      make(map[string]listgenerator.ChartURL),
+		ChartCacheDir:  chartimages.DefaultCacheDir(),
+		Workers:        cc.jobs,
+	}
+	addDefaultSources(version, o, isRPMGC, cc.dev)
+	g, err := listgenerator.NewGenerator(o)
+	if err != nil {
+		return nil, err
+	}
+	result, err := g.Generate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return result.Images(), nil
+}
+
+func (cc *rancherUpgradePlanCmd) saveArchive(
+	images []string, sysCtx *types.SystemContext,
+) error {
+	policy, err := cc.getPolicy()
+	if err != nil {
+		return fmt.Errorf("failed to get policy: %w", err)
+	}
+	s, err := hangar.NewSaver(&hangar.SaverOpts{
+		CommonOpts: hangar.CommonOpts{
+			Images:              images,
+			Arch:                cc.arch,
+			OS:                  cc.os,
+			Timeout:             cc.timeout,
+			Workers:             cc.jobs,
+			FailedImageListName: cc.failed,
+			SystemContext:       sysCtx,
+			Policy:              policy,
+		},
+		ArchiveName: cc.archive,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create saver: %v", err)
+	}
+	return run(s)
+}
@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type registryCmd struct {
+	*baseCmd
+}
+
+func newRegistryCmd() *registryCmd {
+	cc := &registryCmd{}
+
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "registry",
+		Short: "Helpers for debugging the registry server",
+		Long:  "",
+		Example: `
+# Request the registry API with the credential of Hangar:
+hangar registry api GET /v2/library/nginx/tags/list -r REGISTRY`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+			return cmd.Help()
+		},
+	})
+
+	addCommands(cc.cmd,
+		newRegistryAPICmd(),
+	)
+	return cc
+}
@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/extension"
+	"github.com/cnrancher/hangar/pkg/utils"
+	commonFlag "github.com/containers/common/pkg/flag"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type registryAPICmd struct {
+	*baseCmd
+
+	registry  string
+	headers   []string
+	data      string
+	include   bool
+	tlsVerify commonFlag.OptionalBool
+}
+
+func newRegistryAPICmd() *registryAPICmd {
+	cc := &registryAPICmd{}
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "api METHOD PATH -r REGISTRY",
+		Short: "Send the raw registry API request with the credential of Hangar",
+		Long: `Send the raw registry API request with the credential, TLS settings and
+token requesting of Hangar, to debug the authentication and scope issues
+of the registry.
+
+The token scope is resolved from the API path automatically, the response
+body is written into stdout.`,
+		Example: `# List the tags of the repository:
+hangar registry api GET /v2/library/nginx/tags/list -r harbor.example.io
+
+# Show the response headers of the manifest:
+hangar registry api HEAD /v2/library/nginx/manifests/latest \
+	-r harbor.example.io \
+	--header 'Accept: application/vnd.oci.image.index.v1+json' \
+	--include`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+			return cc.run(strings.ToUpper(args[0]), args[1])
+		},
+	})
+
+	flags := cc.baseCmd.cmd.Flags()
+	flags.StringVarP(&cc.registry, "registry", "r", "", "registry server to send the request")
+	cc.baseCmd.cmd.RegisterFlagCompletionFunc("registry", completeRegistries)
+	flags.StringArrayVarP(&cc.headers, "header", "H", nil, "request header in 'KEY: VALUE' format, can be specified multiple times")
+	flags.StringVarP(&cc.data, "data", "", "", "file of the request body ('-' to read from stdin)")
+	flags.BoolVarP(&cc.include, "include", "i", false, "output the response status and headers")
+	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates")
+
+	return cc
+}
+
+func (cc *registryAPICmd) run(method, path string) error {
+	if cc.registry == "" {
+		return fmt.Errorf("registry not provided, use '--registry' to specify the registry server")
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	header := http.Header{}
+	for _, h := range cc.headers {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok {
+			return fmt.Errorf("invalid header %q: should be 'KEY: VALUE' format", h)
+		}
+		header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	var (
+		body []byte
+		err  error
+	)
+	switch cc.data {
+	case "":
+	case "-":
+		body, err = io.ReadAll(os.Stdin)
+	default:
+		body, err = os.ReadFile(cc.data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	sysCtx := cc.baseCmd.newSystemContext()
+	if cc.tlsVerify.Present() {
+		sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!cc.tlsVerify.Value())
+		sysCtx.OCIInsecureSkipTLSVerify = !cc.tlsVerify.Value()
+	}
+	logrus.Debugf("%s %s (scope %q)", method, path, extension.Scope(method, path))
+	resp, err := extension.NewClient(sysCtx, cc.registry).
+		Do(signalContext, method, path, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if cc.include {
+		fmt.Fprintf(os.Stdout, "%s %s\n", resp.Proto, resp.Status)
+		keys := make([]string, 0, len(resp.Header))
+		for k := range resp.Header {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, v := range resp.Header[k] {
+				fmt.Fprintf(os.Stdout, "%s: %s\n", k, v)
+			}
+		}
+		fmt.Fprintln(os.Stdout)
+	}
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s %s: %v", method, path, resp.Status)
+	}
+	return nil
+}
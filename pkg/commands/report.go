@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/history"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type reportCmd struct {
+	*baseCmd
+
+	last    int
+	command string
+	json    bool
+}
+
+func newReportCmd() *reportCmd {
+	cc := &reportCmd{}
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "report",
+		Short: "Compare the recent runs recorded in the run history (trend report)",
+		Long: `Compare the recent runs recorded in the run history.
+
+The image counts, archive sizes, new failures and newly appeared images
+of each run are compared with its previous run to spot the regressions.`,
+		Example: `# Compare the last 5 runs:
+hangar report --last 5
+
+# Compare the last 5 save runs in JSON format:
+hangar report --last 5 --command save --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+			return cc.run()
+		},
+	})
+
+	flags := cc.baseCmd.cmd.Flags()
+	flags.IntVarP(&cc.last, "last", "n", 5, "number of the recent runs to compare")
+	flags.StringVarP(&cc.command, "command", "c", "", "only compare the runs of the command (mirror, save, load, sync, etc.)")
+	flags.BoolVarP(&cc.json, "json", "", false, "output in JSON format")
+
+	return cc
+}
+
+func (cc *reportCmd) run() error {
+	records, err := history.Load(historyOpts.file, cc.command, cc.last)
+	if err != nil {
+		return err
+	}
+	report := history.NewReport(records)
+	if cc.json {
+		b, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(b))
+		return nil
+	}
+	if len(records) == 0 {
+		logrus.Infof("No run history found in %q", historyOpts.file)
+		return nil
+	}
+
+	fmt.Printf("%4s | %-19s | %-20s | %-9s | %6s | %6s | %10s | %s\n",
+		"#", "START", "COMMAND", "RESULT", "TOTAL", "FAILED", "SIZE", "DURATION")
+	for i, r := range records {
+		size := "-"
+		if r.Size > 0 {
+			size = utils.FormatSize(r.Size)
+		}
+		fmt.Printf("%4d | %-19s | %-20s | %-9s | %6d | %6d | %10s | %v\n",
+			i+1, r.StartTime.Format("2006-01-02 15:04:05"), r.Command, r.Result,
+			r.Total, r.Failed, size, r.Duration.Round(1e9))
+	}
+	for i, d := range report.Diffs {
+		fmt.Printf("\n#%d => #%d: size %s, duration %+.0fs\n",
+			i+1, i+2, formatSizeDelta(d.SizeDelta), d.DurationDelta)
+		printImages("new failed images", d.NewFailures)
+		printImages("recovered images", d.Recovered)
+		printImages("new images", d.NewImages)
+		printImages("removed images", d.RemovedImages)
+	}
+	if len(report.PersistentFailures) > 0 {
+		fmt.Println()
+		printImages("images failed in all runs", report.PersistentFailures)
+	}
+	for _, r := range report.Regressions {
+		logrus.Warnf("%s", r)
+	}
+	return nil
+}
+
+func formatSizeDelta(delta int64) string {
+	if delta >= 0 {
+		return "+" + utils.FormatSize(delta)
+	}
+	return "-" + utils.FormatSize(-delta)
+}
+
+func printImages(title string, images []string) {
+	if len(images) == 0 {
+		return
+	}
+	fmt.Printf("  %s (%d):\n    %s\n", title, len(images), strings.Join(images, "\n    "))
+}
@@ -0,0 +1,118 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/extension"
+	"github.com/cnrancher/hangar/pkg/utils"
+	commonFlag "github.com/containers/common/pkg/flag"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type reposCmd struct {
+	*baseCmd
+
+	project   string
+	backend   string
+	limit     int
+	json      bool
+	tlsVerify commonFlag.OptionalBool
+}
+
+func newReposCmd() *reposCmd {
+	cc := &reposCmd{}
+
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "repos REGISTRY",
+		Short: "List the repositories of the registry",
+		Long: `List the repositories of the registry by the registry catalog API,
+or the vendor specific APIs of Harbor, Quay and Nexus by the '--backend'
+option.
+
+The catalog API lists all repositories of the registry, the '--project'
+option filters the repositories by the project prefix.
+The Harbor backend uses the username and password of the registry
+credential, the Quay backend requires the '--project' (namespace) and
+lists the public repositories if no OAuth token is stored.
+The Nexus backend requires the '--project' (docker repository name) and
+the REGISTRY should be the Nexus server address instead of the repository
+connector port.`,
+		Example: `# List the repositories by the catalog API:
+hangar repos registry.example.io
+
+# List the repositories of the Harbor project in JSON format:
+hangar repos harbor.example.io --backend harbor --project library --json
+
+# List the repositories of the Quay namespace:
+hangar repos quay.io --backend quay --project coreos
+
+# List the repositories of the Nexus docker hosted repository:
+hangar repos nexus.example.io --backend nexus --project docker-hosted`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeRegistries,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+			return cc.run(args[0])
+		},
+	})
+
+	flags := cc.baseCmd.cmd.Flags()
+	flags.StringVarP(&cc.project, "project", "p", "", "list the repositories of the project (namespace) only")
+	flags.StringVarP(&cc.backend, "backend", "", string(extension.BackendCatalog),
+		fmt.Sprintf("API to list the repositories, available: %v", extension.Backends))
+	cc.baseCmd.cmd.RegisterFlagCompletionFunc("backend", func(
+		cmd *cobra.Command, args []string, toComplete string,
+	) ([]string, cobra.ShellCompDirective) {
+		var s []string
+		for _, b := range extension.Backends {
+			s = append(s, string(b))
+		}
+		return s, cobra.ShellCompDirectiveNoFileComp
+	})
+	flags.IntVarP(&cc.limit, "limit", "", 0, "maximum number of repositories to output (0 for no limit)")
+	flags.BoolVarP(&cc.json, "json", "", false, "output in json format")
+	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates")
+
+	return cc
+}
+
+func (cc *reposCmd) run(registry string) error {
+	backend := extension.Backend(cc.backend)
+	if !slices.Contains(extension.Backends, backend) {
+		return fmt.Errorf("invalid backend %q, available: %v", cc.backend, extension.Backends)
+	}
+
+	sysCtx := cc.baseCmd.newSystemContext()
+	if cc.tlsVerify.Present() {
+		sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!cc.tlsVerify.Value())
+		sysCtx.OCIInsecureSkipTLSVerify = !cc.tlsVerify.Value()
+	}
+	repos, err := extension.NewClient(sysCtx, registry).
+		Repositories(signalContext, backend, cc.project, cc.limit)
+	if err != nil {
+		return err
+	}
+
+	if cc.json {
+		if repos == nil {
+			repos = []string{}
+		}
+		b, _ := json.MarshalIndent(repos, "", "  ")
+		fmt.Println(string(b))
+		return nil
+	}
+	for _, r := range repos {
+		fmt.Println(r)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package commands
 import (
 	"github.com/cnrancher/hangar/pkg/rancher/chartimages"
 	"github.com/cnrancher/hangar/pkg/rancher/listgenerator"
+	"github.com/cnrancher/hangar/pkg/utils"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/mod/semver"
 )
@@ -206,68 +207,56 @@ var (
 	}
 )
 
-func addRPMCharts(v string, g *listgenerator.Generator, dev bool) {
+func addRPMCharts(v string, o *listgenerator.GeneratorOpts, dev bool) {
 	majorMinor := semver.MajorMinor(v)
 	chartsMap := RancherPrimeManagerCharts
 	if dev {
 		chartsMap = RancherPrimeManagerChartsDEV
 	}
 	for url := range chartsMap[majorMinor] {
-		g.ChartURLs[url] = struct {
-			Type   chartimages.ChartRepoType
-			Branch string
-		}{
+		o.ChartURLs[url] = listgenerator.ChartURL{
 			Type:   chartimages.RepoTypeDefault,
 			Branch: chartsMap[majorMinor][url],
 		}
 	}
 }
 
-func addRPMSystemCharts(v string, g *listgenerator.Generator, dev bool) {
+func addRPMSystemCharts(v string, o *listgenerator.GeneratorOpts, dev bool) {
 	majorMinor := semver.MajorMinor(v)
 	systemChartsMap := RancherPrimeManagerSystemCharts
 	if dev {
 		systemChartsMap = RancherPrimeManagerSystemChartsDEV
 	}
 	for url := range systemChartsMap[majorMinor] {
-		g.ChartURLs[url] = struct {
-			Type   chartimages.ChartRepoType
-			Branch string
-		}{
+		o.ChartURLs[url] = listgenerator.ChartURL{
 			Type:   chartimages.RepoTypeSystem,
 			Branch: systemChartsMap[majorMinor][url],
 		}
 	}
 }
 
-func addRPMGCCharts(v string, g *listgenerator.Generator, dev bool) {
+func addRPMGCCharts(v string, o *listgenerator.GeneratorOpts, dev bool) {
 	majorMinor := semver.MajorMinor(v)
 	chartsMap := RancherPrimeManagerGCCharts
 	if dev {
 		chartsMap = RancherPrimeManagerGCChartsDEV
 	}
 	for url := range chartsMap[majorMinor] {
-		g.ChartURLs[url] = struct {
-			Type   chartimages.ChartRepoType
-			Branch string
-		}{
+		o.ChartURLs[url] = listgenerator.ChartURL{
 			Type:   chartimages.RepoTypeDefault,
 			Branch: chartsMap[majorMinor][url],
 		}
 	}
 }
 
-func addRPMGCSystemCharts(v string, g *listgenerator.Generator, dev bool) {
+func addRPMGCSystemCharts(v string, o *listgenerator.GeneratorOpts, dev bool) {
 	majorMinor := semver.MajorMinor(v)
 	chartsMap := RancherPrimeManagerGCSystemCharts
 	if dev {
 		chartsMap = RancherPrimeManagerGCSystemChartsDEV
 	}
 	for url := range chartsMap[majorMinor] {
-		g.ChartURLs[url] = struct {
-			Type   chartimages.ChartRepoType
-			Branch string
-		}{
+		o.ChartURLs[url] = listgenerator.ChartURL{
 			Type:   chartimages.RepoTypeSystem,
 			Branch: chartsMap[majorMinor][url],
 		}
@@ -275,7 +264,7 @@ func addRPMGCSystemCharts(v string, g *listgenerator.Generator, dev bool) {
 }
 
 func addRancherPrimeManagerKontainerDriverMetadata(
-	v string, g *listgenerator.Generator, dev bool,
+	v string, o *listgenerator.GeneratorOpts, dev bool,
 ) {
 	majorMinor := semver.MajorMinor(v)
 	urlMap := KontainerDriverMetadataURLs
@@ -287,11 +276,11 @@ func addRancherPrimeManagerKontainerDriverMetadata(
 		logrus.Warnf("KDM URL of version %q not found!", majorMinor)
 		return
 	}
-	g.KDMURL = url
+	o.KDMURL = url
 }
 
 func addRancherPrimeManagerGCKontainerDriverMetadata(
-	v string, g *listgenerator.Generator, dev bool,
+	v string, o *listgenerator.GeneratorOpts, dev bool,
 ) {
 	majorMinor := semver.MajorMinor(v)
 	urlMap := KontainerDriverMetadataGCURLs
@@ -303,5 +292,35 @@ func addRancherPrimeManagerGCKontainerDriverMetadata(
 		logrus.Warnf("KDM URL of version %q not found!", majorMinor)
 		return
 	}
-	g.KDMURL = url
+	o.KDMURL = url
+}
+
+// minKubeVersion returns the minimum kube version of the Rancher version.
+func minKubeVersion(v string) string {
+	switch {
+	case utils.SemverMajorMinorEqual(v, "v2.6"):
+		return "v1.21.0"
+	case utils.SemverMajorMinorEqual(v, "v2.7"):
+		return "v1.21.0"
+	}
+	return ""
+}
+
+// addDefaultSources adds the default RPM (GC) charts & KDM of the
+// Rancher version to generate list.
+func addDefaultSources(
+	v string, o *listgenerator.GeneratorOpts, isRPMGC bool, dev bool,
+) {
+	if isRPMGC {
+		logrus.Debugf("add RPM GC charts & KDM to generate list")
+		addRPMCharts(v, o, dev)
+		addRPMGCCharts(v, o, dev)
+		addRPMGCSystemCharts(v, o, dev)
+		addRancherPrimeManagerGCKontainerDriverMetadata(v, o, dev)
+	} else {
+		logrus.Debugf("add RPM charts & KDM to generate list")
+		addRPMCharts(v, o, dev)
+		addRPMSystemCharts(v, o, dev)
+		addRancherPrimeManagerKontainerDriverMetadata(v, o, dev)
+	}
 }
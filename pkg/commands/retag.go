@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/cnrancher/hangar/pkg/utils"
+	commonFlag "github.com/containers/common/pkg/flag"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type retagCmd struct {
+	*baseCmd
+
+	file        string
+	source      string
+	destination string
+	failed      string
+	statusFile  string
+	jobs        int
+	timeout     time.Duration
+	skipLogin   bool
+	tlsVerify   commonFlag.OptionalBool
+
+	failureOpts
+}
+
+func newRetagCmd() *retagCmd {
+	cc := &retagCmd{}
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "retag -s SOURCE_IMAGE -d DEST_IMAGE",
+		Short: "Copy image manifests between tags/repositories within the destination registry",
+		Long: `Copy image manifests between tags/repositories within the same registry.
+
+The blobs are mounted from the source repository instead of being transferred,
+only the manifests are uploaded to the registry.
+
+The image list format is '[SOURCE_IMAGE] [DEST_IMAGE]' per line.`,
+		Example: `# Retag a single image:
+hangar retag \
+	--source harbor.local/app/app:1.2.3 \
+	--destination harbor.local/app/app:stable
+
+# Retag images from image list:
+hangar retag \
+	--file RETAG_LIST.txt \
+	--jobs 5`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+
+			h, err := cc.prepareHangar()
+			if err != nil {
+				return err
+			}
+			return run(h)
+		},
+	})
+
+	flags := cc.baseCmd.cmd.Flags()
+	flags.StringVarP(&cc.file, "file", "f", "", "image list file in '[SOURCE_IMAGE] [DEST_IMAGE]' format")
+	flags.SetAnnotation("file", cobra.BashCompFilenameExt, []string{"txt"})
+	flags.StringVarP(&cc.source, "source", "s", "", "source image")
+	flags.StringVarP(&cc.destination, "destination", "d", "", "destination image (should be in the same registry with source image)")
+	flags.StringVarP(&cc.failed, "failed", "o", "retag-failed.txt", "file name of the retag failed image list")
+	flags.SetAnnotation("failed", cobra.BashCompFilenameExt, []string{"txt"})
+	flags.StringVarP(&cc.statusFile, "status-file", "", "", "write the job progress & failures into the status file continuously (JSON format)")
+	flags.SetAnnotation("status-file", cobra.BashCompFilenameExt, []string{"json"})
+	flags.IntVarP(&cc.jobs, "jobs", "j", 1, "worker number, retag images parallelly (1-20)")
+	flags.DurationVarP(&cc.timeout, "timeout", "", time.Minute*10, "timeout when retag each images")
+	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates")
+	flags.BoolVarP(&cc.skipLogin, "skip-login", "", false,
+		"skip check the registry is logged in (used in shell script)")
+	cc.failureOpts.addFlags(flags)
+
+	return cc
+}
+
+func (cc *retagCmd) prepareHangar() (hangar.Hangar, error) {
+	var lines []string
+	switch {
+	case cc.file != "" && (cc.source != "" || cc.destination != ""):
+		return nil, fmt.Errorf("'--file' and '--source/--destination' are mutually exclusive")
+	case cc.file != "":
+		file, err := os.Open(cc.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %q: %v", cc.file, err)
+		}
+		sc := bufio.NewScanner(file)
+		sc.Split(bufio.ScanLines)
+		for sc.Scan() {
+			l := strings.TrimSpace(sc.Text())
+			if l == "" || strings.HasPrefix(l, "#") || strings.HasPrefix(l, "//") {
+				continue
+			}
+			lines = append(lines, l)
+		}
+		if err := file.Close(); err != nil {
+			return nil, fmt.Errorf("failed to close %q: %v", cc.file, err)
+		}
+	case cc.source != "" && cc.destination != "":
+		lines = append(lines, cc.source+" "+cc.destination)
+	default:
+		return nil, fmt.Errorf("image not provided, use '--source' and '--destination' or '--file' to provide the images")
+	}
+	if cc.debug {
+		logrus.Infof("debug mode enabled, force worker number to 1")
+		cc.jobs = 1
+	} else if cc.jobs > utils.MaxWorkerNum || cc.jobs < utils.MinWorkerNum {
+		logrus.Warnf("invalid worker num: %v, set to 1", cc.jobs)
+		cc.jobs = 1
+	}
+
+	sysCtx := cc.baseCmd.newSystemContext()
+	if cc.tlsVerify.Present() {
+		sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!cc.tlsVerify.Value())
+		sysCtx.OCIInsecureSkipTLSVerify = !cc.tlsVerify.Value()
+	}
+
+	if !cc.skipLogin {
+		registrySet := map[string]bool{}
+		for _, l := range lines {
+			if _, dest, err := hangar.ParseRetagLine(l); err == nil {
+				registrySet[utils.GetRegistryName(dest)] = true
+			}
+		}
+		if err := prepareLogin(
+			signalContext,
+			registrySet,
+			utils.CopySystemContext(sysCtx),
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	maxFailures, err := cc.failureThreshold()
+	if err != nil {
+		return nil, err
+	}
+	policy, err := cc.getPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %w", err)
+	}
+	r, err := hangar.NewRetagger(&hangar.RetaggerOpts{
+		CommonOpts: hangar.CommonOpts{
+			Images:              lines,
+			Timeout:             cc.timeout,
+			Workers:             cc.jobs,
+			FailedImageListName: cc.failed,
+			StatusFile:          cc.statusFile,
+			SystemContext:       sysCtx,
+			Policy:              policy,
+			MaxFailures:         maxFailures,
+			KeepGoing:           cc.keepGoing,
+			BatchSize:           cc.batchSize,
+			BreakerThreshold:    cc.breakerThreshold,
+			BreakerCooldown:     cc.breakerCooldown,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create retagger: %v", err)
+	}
+	return r, nil
+}
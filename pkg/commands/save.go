@@ -1,14 +1,16 @@
 package commands
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/cnrancher/hangar/pkg/airgap"
 	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/copy"
 	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
 	"github.com/cnrancher/hangar/pkg/utils"
 	commonFlag "github.com/containers/common/pkg/flag"
 	"github.com/containers/image/v5/types"
@@ -17,16 +19,43 @@ import (
 )
 
 type saveOpts struct {
-	file        string
+	file        []string
+	images      []string
 	arch        []string
 	os          []string
 	source      string
-	destination string
+	destination []string
 	failed      string
+	statusFile  string
 	jobs        int
 	timeout     time.Duration
 	tlsVerify   commonFlag.OptionalBool
 	autoYes     bool
+	dryRun      bool
+
+	includeAttestations bool
+	skipBlobsFile       string
+	layout              string
+	deterministic       bool
+	compressWorkers     int
+	stagingBuffer       int
+	airgapDir           string
+	airgapRegistry      string
+	resume              bool
+
+	blobConcurrency int
+	maxMemory       int
+
+	trustOpts
+	stateOpts
+	credentialOpts
+	failureOpts
+	probeOpts
+	contentStoreOpts
+	sigstoreOpts
+	compressionOpts
+	lockOpts
+	hookOpts
 }
 
 type saveCmd struct {
@@ -48,7 +77,55 @@ hangar save \
 	--source SOURCE_REGISTRY \
 	--destination SAVED_ARCHIVE.zip \
 	--arch amd64,arm64 \
-	--os linux`,
+	--os linux
+
+# Write zip and tar.zst archives from the same pulled blobs.
+hangar save \
+	--file IMAGE_LIST.txt \
+	--destination SAVED_ARCHIVE.zip \
+	--destination SAVED_ARCHIVE.tar.zst
+
+# Save images into the unpacked directory for NFS/rsync distribution,
+# the directory can be loaded and validated as the archive file.
+hangar save \
+	--file IMAGE_LIST.txt \
+	--layout dir \
+	--destination SAVED_ARCHIVE_DIR
+
+# Write the Rancher air-gap install artifacts beside the archive.
+hangar save \
+	--file IMAGE_LIST.txt \
+	--destination SAVED_ARCHIVE.zip \
+	--airgap-dir airgap \
+	--airgap-registry REGISTRY_URL
+
+# Record the resolved image digests and flags into the lock file to
+# reproduce the bundle by '--from-lock hangar.lock.yaml'.
+hangar save \
+	--file IMAGE_LIST.txt \
+	--destination SAVED_ARCHIVE.zip \
+	--lock-file hangar.lock.yaml
+
+# Save the tarball created by 'docker save' without loading it into the
+# daemon, the image list line format is 'docker-archive:PATH:REFERENCE'.
+hangar save \
+	--image docker-archive:./app.tar:docker.io/username/app:v1.0 \
+	--destination SAVED_ARCHIVE.zip
+
+# Verify the removable drive is mounted before saving and unmount it after
+# the archive is written, the post-run hook is executed even if failed.
+hangar save \
+	--file IMAGE_LIST.txt \
+	--destination /mnt/usb/SAVED_ARCHIVE.zip \
+	--pre-run 'mountpoint -q /mnt/usb' \
+	--post-run 'sync && umount /mnt/usb'
+
+# Output the platform images would be saved and their total size without
+# creating the archive.
+hangar save \
+	--file IMAGE_LIST.txt \
+	--arch amd64,arm64 \
+	--dry-run`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
 			if cc.baseCmd.debug {
@@ -56,54 +133,123 @@ hangar save \
 				logrus.Debugf("debug output enabled")
 				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
 			}
-			h, err := cc.prepareHangar()
-			if err != nil {
+			if err := cc.applyLock(cmd, cc.file, &cc.images); err != nil {
 				return err
 			}
-
-			if _, err = os.Stat(cc.destination); err != nil {
-				if !os.IsNotExist(err) {
-					return fmt.Errorf("failed to stat file [%v]: %w",
-						cc.destination, err)
+			if cc.dryRun {
+				if !cc.baseCmd.debug {
+					// Only output the plan to stdout.
+					logrus.SetLevel(logrus.WarnLevel)
+				}
+				h, err := cc.prepareHangar()
+				if err != nil {
+					return err
+				}
+				return dryRun(h)
+			}
+			// The pre-run hook may mount the drive of the destination, so
+			// the destination is checked after the hook.
+			return cc.runHooks(cmd, cc.source, strings.Join(cc.destination, ","), func() error {
+				h, err := cc.prepareHangar()
+				if err != nil {
+					return err
 				}
-			} else {
-				fmt.Printf("File %q already exists! Overwrite? [y/N] ", cc.destination)
-				if cc.autoYes {
-					fmt.Println("y")
-				} else {
+
+				for _, d := range cc.destination {
+					if _, err = os.Stat(d); err != nil {
+						if !os.IsNotExist(err) {
+							return fmt.Errorf("failed to stat file [%v]: %w",
+								d, err)
+						}
+						continue
+					}
+					fmt.Printf("File %q already exists! Overwrite? [y/N] ", d)
+					if cc.autoYes {
+						fmt.Println("y")
+						continue
+					}
 					var s string
 					if _, err = utils.Scanf(signalContext, "%s", &s); err != nil {
 						return err
 					}
 					if len(s) == 0 || s[0] != 'y' && s[0] != 'Y' {
 						logrus.Warnf("Abort.")
-						return fmt.Errorf("file %q already exists", cc.destination)
+						return fmt.Errorf("file %q already exists", d)
 					}
 				}
-			}
 
-			if err := run(h); err != nil {
+				err = run(h)
+				if cc.airgapDir != "" {
+					if err := cc.writeAirgap(h); err != nil {
+						return err
+					}
+				}
 				return err
-			}
-			return nil
+			})
 		},
 	})
 
 	flags := cc.baseCmd.cmd.PersistentFlags()
-	flags.StringVarP(&cc.file, "file", "f", "", "image list file")
+	flags.StringSliceVarP(&cc.file, "file", "f", nil, "image list file, can be specified multiple times to process the images of multiple lists in one run")
 	flags.SetAnnotation("file", cobra.BashCompFilenameExt, []string{"txt"})
-	flags.SetAnnotation("file", cobra.BashCompOneRequiredFlag, []string{""})
-	flags.StringSliceVarP(&cc.arch, "arch", "a", []string{"amd64", "arm64"}, "architecture list of images")
-	flags.StringSliceVarP(&cc.os, "os", "", []string{"linux"}, "OS list of images")
+	flags.StringSliceVarP(&cc.images, "image", "", nil, "image to copy, can be specified multiple times instead of the image list file")
+	flags.StringSliceVarP(&cc.arch, "arch", "a", defaultArch(), "architecture list of images")
+	flags.StringSliceVarP(&cc.os, "os", "", defaultOS(), "OS list of images")
 	flags.StringVarP(&cc.source, "source", "s", "", "override the source registry in image list")
-	flags.StringVarP(&cc.destination, "destination", "d", "saved-images.zip", "file name of the output saved images")
-	flags.SetAnnotation("destination", cobra.BashCompFilenameExt, []string{"zip"})
+	cc.baseCmd.cmd.RegisterFlagCompletionFunc("source", completeRegistries)
+	flags.StringSliceVarP(&cc.destination, "destination", "d", []string{"saved-images.zip"}, "file name of the output saved images, "+
+		"specify multiple times to write archives in different formats (zip, tar, tar.gz, tar.zst) from the same pulled blobs")
+	flags.SetAnnotation("destination", cobra.BashCompFilenameExt, []string{"zip", "tar", "gz", "zst"})
 	flags.StringVarP(&cc.failed, "failed", "o", "save-failed.txt", "file name of the save failed image list")
 	flags.SetAnnotation("failed", cobra.BashCompFilenameExt, []string{"txt"})
+	flags.StringVarP(&cc.statusFile, "status-file", "", "", "write the job progress & failures into the status file continuously (JSON format)")
+	flags.SetAnnotation("status-file", cobra.BashCompFilenameExt, []string{"json"})
 	flags.IntVarP(&cc.jobs, "jobs", "j", 1, "worker number, copy images parallelly (1-20)")
+	flags.IntVarP(&cc.blobConcurrency, "blob-concurrency", "", copy.DefaultBlobConcurrency,
+		"number of the blobs of each image copied in parallel, independent of the worker number")
+	flags.IntVarP(&cc.maxMemory, "max-memory", "", 0,
+		"total size (MiB) of the large layers streamed in parallel by all the workers, "+
+			"the layers exceeding the size are copied one at a time, 0 to disable")
 	flags.DurationVarP(&cc.timeout, "timeout", "", time.Minute*10, "timeout when save each images")
 	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates")
 	flags.BoolVarP(&cc.autoYes, "auto-yes", "y", false, "answer yes automatically (used in shell script)")
+	flags.BoolVarP(&cc.dryRun, "dry-run", "", false,
+		"resolve the source manifests and output the platform images would be saved and their total size without creating the archive")
+
+	cc.baseCmd.cmd.Flags().BoolVarP(&cc.includeAttestations, "include-attestations", "", false,
+		"copy the attestation manifests (unknown/unknown platform) of the image index with the subject images")
+	cc.baseCmd.cmd.Flags().StringVarP(&cc.skipBlobsFile, "skip-blobs-file", "", "",
+		"file of the layer digests (one per line) present out-of-band to skip saving into the archive")
+	cc.baseCmd.cmd.Flags().SetAnnotation("skip-blobs-file", cobra.BashCompFilenameExt, []string{"txt"})
+	cc.baseCmd.cmd.Flags().StringVarP(&cc.layout, "layout", "", string(archive.LayoutArchive),
+		fmt.Sprintf("representation of the saved images (%v: archive file, %v: unpacked directory with "+
+			"hardlinked content-addressed blobs for NFS/rsync distribution)", archive.LayoutArchive, archive.LayoutDir))
+	cc.baseCmd.cmd.Flags().BoolVarP(&cc.deterministic, "deterministic", "", false,
+		"write identical archive output for identical input images (image list order, fixed timestamps), "+
+			"so rsync/dedup-based transfer of successive archives only ships changed blocks "+
+			"(pulled images are cached until all images are pulled)")
+	cc.baseCmd.cmd.Flags().IntVarP(&cc.compressWorkers, "compress-workers", "", 0,
+		"number of goroutines compressing the tar.gz/tar.zst archives in parallel (default: number of CPUs)")
+	cc.baseCmd.cmd.Flags().IntVarP(&cc.stagingBuffer, "staging-buffer", "", archive.DefaultStagingSize>>20,
+		"size (MiB) of the blob data read ahead from the cache while compressing, 0 to disable")
+	cc.baseCmd.cmd.Flags().StringVarP(&cc.airgapDir, "airgap-dir", "", "",
+		"write the air-gap install artifacts (images.yaml, images.txt, load-images.sh, registries.yaml) into the directory")
+	cc.baseCmd.cmd.Flags().StringVarP(&cc.airgapRegistry, "airgap-registry", "", "",
+		"private registry the images will be loaded into (used with '--airgap-dir')")
+	cc.baseCmd.cmd.RegisterFlagCompletionFunc("airgap-registry", completeRegistries)
+	cc.baseCmd.cmd.Flags().BoolVarP(&cc.resume, "resume", "", false,
+		"write the completed images into the checkpoint in the 'DESTINATION.resume' dir periodically "+
+			"and resume the interrupted job without pulling the completed images again")
+	cc.trustOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.stateOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.probeOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.contentStoreOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.sigstoreOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.compressionOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.lockOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.credentialOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.failureOpts.addFlags(flags)
+	cc.hookOpts.addFlags(cc.baseCmd.cmd.Flags())
 
 	addCommands(
 		cc.cmd,
@@ -113,8 +259,22 @@ hangar save \
 }
 
 func (cc *saveCmd) prepareHangar() (hangar.Hangar, error) {
-	if cc.file == "" {
-		return nil, fmt.Errorf("image list not provided, use '--file' to specify the image list file")
+	if len(cc.destination) == 0 {
+		return nil, fmt.Errorf("output archive not provided, use '--destination' to specify the archive file")
+	}
+	if cc.airgapDir != "" && cc.airgapRegistry == "" {
+		return nil, fmt.Errorf("'--airgap-dir' requires '--airgap-registry' to be specified")
+	}
+	layout, err := archive.ParseLayout(cc.layout)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, d := range cc.destination {
+		if seen[d] {
+			return nil, fmt.Errorf("duplicated destination %q", d)
+		}
+		seen[d] = true
 	}
 	if cc.debug {
 		logrus.Infof("debug mode enabled, force worker number to 1")
@@ -125,24 +285,15 @@ func (cc *saveCmd) prepareHangar() (hangar.Hangar, error) {
 			cc.jobs = 1
 		}
 	}
+	if err := checkBlobConcurrency(cc.blobConcurrency); err != nil {
+		return nil, err
+	}
 
-	file, err := os.Open(cc.file)
+	list, err := readImageList(cc.file, cc.images)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open %q: %v", cc.file, err)
-	}
-	images := []string{}
-	sc := bufio.NewScanner(file)
-	sc.Split(bufio.ScanLines)
-	for sc.Scan() {
-		l := strings.TrimSpace(sc.Text())
-		if l == "" || strings.HasPrefix(l, "#") || strings.HasPrefix(l, "//") {
-			continue
-		}
-		images = append(images, l)
-	}
-	if err := file.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close %q: %v", cc.file, err)
+		return nil, err
 	}
+	images := list.images
 
 	sysCtx := cc.baseCmd.newSystemContext()
 	if cc.tlsVerify.Present() {
@@ -150,6 +301,46 @@ func (cc *saveCmd) prepareHangar() (hangar.Hangar, error) {
 		sysCtx.OCIInsecureSkipTLSVerify = !cc.tlsVerify.Value()
 	}
 
+	for _, line := range images {
+		if src := sourceImage(line, cc.source); src != "" {
+			cc.addSource(src)
+		}
+	}
+	if err := cc.checkCredentials(signalContext, sysCtx); err != nil {
+		return nil, err
+	}
+	images = cc.probeSources(signalContext, sysCtx, images, func(line string) string {
+		return sourceImage(line, cc.source)
+	})
+
+	trustStore, err := cc.newTrustStore()
+	if err != nil {
+		return nil, err
+	}
+	stateStore, err := cc.newStateStore()
+	if err != nil {
+		return nil, err
+	}
+	maxFailures, err := cc.failureThreshold()
+	if err != nil {
+		return nil, err
+	}
+	contentStore, err := cc.newContentStore()
+	if err != nil {
+		return nil, err
+	}
+	sigstoreVerifier, err := cc.newSigstoreVerifier()
+	if err != nil {
+		return nil, err
+	}
+	layerCompression, err := cc.newLayerCompression()
+	if err != nil {
+		return nil, err
+	}
+	skipBlobs, err := hangar.LoadSkipBlobs(cc.skipBlobsFile)
+	if err != nil {
+		return nil, err
+	}
 	policy, err := cc.getPolicy()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get policy: %w", err)
@@ -162,14 +353,44 @@ func (cc *saveCmd) prepareHangar() (hangar.Hangar, error) {
 			Variant:             nil,
 			Timeout:             cc.timeout,
 			Workers:             cc.jobs,
+			BlobConcurrency:     cc.blobConcurrency,
+			MaxMemory:           int64(cc.maxMemory) << 20,
 			FailedImageListName: cc.failed,
+			StatusFile:          cc.statusFile,
 			SystemContext:       sysCtx,
 			Policy:              policy,
+			MaxFailures:         maxFailures,
+			KeepGoing:           cc.keepGoing,
+			BatchSize:           cc.batchSize,
+			BreakerThreshold:    cc.breakerThreshold,
+			BreakerCooldown:     cc.breakerCooldown,
+			Tiers:               list.tiers,
+			Optional:            list.optional,
+			ImageListOrigins:    list.origins,
+			ImageListSource:     list.source,
+			TimeBudget:          cc.timeBudget,
+			ContentStore:        contentStore,
+			SigstoreVerifier:    sigstoreVerifier,
+			LayerCompression:    layerCompression,
+			AllowedRegistries:   cc.allowedRegistries,
+			TrustStore:          trustStore,
+			AcceptChanges:       cc.acceptChanges,
+			StateStore:          stateStore,
+			OnlyIfChanged:       cc.onlyIfChanged,
+			IncludeAttestations: cc.includeAttestations,
+			Lock:                cc.newLock(cc.baseCmd.cmd),
+			FromLock:            cc.locked,
 		},
 
 		SourceRegistry:    cc.source,
 		SharedBlobDirPath: "", // Use the default shared blob dir path.
-		ArchiveName:       cc.destination,
+		ArchiveName:       cc.destination[0],
+		ExtraArchiveNames: cc.destination[1:],
+		Layout:            layout,
+		Deterministic:     cc.deterministic,
+		Compress:          cc.compressOpts(),
+		SkipBlobs:         skipBlobs,
+		Resume:            cc.resume,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create saver: %v", err)
@@ -179,3 +400,45 @@ func (cc *saveCmd) prepareHangar() (hangar.Hangar, error) {
 
 	return s, nil
 }
+
+// writeAirgap writes the air-gap install artifacts of the saved images.
+func (cc *saveCmd) writeAirgap(h hangar.Hangar) error {
+	s, ok := h.(*hangar.Saver)
+	if !ok {
+		return nil
+	}
+	summary := s.Summary()
+	failed := make(map[string]bool, len(summary.FailedImages))
+	for _, img := range summary.FailedImages {
+		failed[img] = true
+	}
+	images := make([]string, 0, len(summary.Images))
+	for _, img := range summary.Images {
+		if failed[img] {
+			continue
+		}
+		images = append(images, utils.ConstructRegistry(img, cc.source))
+	}
+	err := airgap.Write(cc.airgapDir, &airgap.Options{
+		Registry: cc.airgapRegistry,
+		Archives: cc.destination,
+		Images:   images,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write air-gap artifacts: %w", err)
+	}
+	logrus.Infof("Air-gap artifacts written into [%v]", cc.airgapDir)
+	return nil
+}
+
+// compressOpts returns the archive compression pipeline options.
+func (cc *saveCmd) compressOpts() *archive.CompressOpts {
+	o := &archive.CompressOpts{
+		Workers:     cc.compressWorkers,
+		StagingSize: cc.stagingBuffer << 20,
+	}
+	if cc.stagingBuffer <= 0 {
+		o.StagingSize = -1
+	}
+	return o
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/cnrancher/hangar/pkg/copy"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// sigstoreOpts is the options of verifying the sigstore signatures of the
+// source images before copy.
+type sigstoreOpts struct {
+	sigstorePublicKey string
+	verifyMode        string
+}
+
+func (o *sigstoreOpts) addFlags(flags *flag.FlagSet) {
+	flags.StringVarP(&o.sigstorePublicKey, "verify-sigstore-pubkey", "", "",
+		"verify the sigstore (cosign) signatures of the source images against the public key before copy")
+	flags.SetAnnotation("verify-sigstore-pubkey", cobra.BashCompFilenameExt, []string{"pub", "pem"})
+	flags.StringVarP(&o.verifyMode, "verify-mode", "", string(copy.VerifyModeEnforce),
+		fmt.Sprintf("behavior when the signature verification failed (%v: fail the image, %v: output the warning and continue)",
+			copy.VerifyModeEnforce, copy.VerifyModeWarn))
+}
+
+// newSigstoreVerifier returns the sigstore signature verifier, returns nil
+// if the public key not provided.
+func (o *sigstoreOpts) newSigstoreVerifier() (*copy.SigstoreVerifier, error) {
+	mode, err := copy.ParseVerifyMode(o.verifyMode)
+	if err != nil {
+		return nil, err
+	}
+	if o.sigstorePublicKey == "" {
+		return nil, nil
+	}
+	v, err := copy.NewSigstoreVerifier(o.sigstorePublicKey, mode)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("Verify sigstore signatures of source images by public key [%v] (%v mode)",
+		o.sigstorePublicKey, mode)
+	return v, nil
+}
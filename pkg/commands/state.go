@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/cnrancher/hangar/pkg/statedb"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// stateOpts is the state DB options to skip the images not changed since
+// the last successful run.
+type stateOpts struct {
+	stateFile     string
+	onlyIfChanged bool
+}
+
+func (o *stateOpts) addFlags(flags *flag.FlagSet) {
+	flags.StringVarP(&o.stateFile, "state-file", "", "",
+		"state DB file recording the source digests of the images copied successfully "+
+			"(default \"state.json\" in the state DB directory)")
+	flags.SetAnnotation("state-file", cobra.BashCompFilenameExt, []string{"json"})
+	flags.BoolVarP(&o.onlyIfChanged, "only-if-changed", "", false,
+		"skip the images whose source digest is not changed since the last successful run "+
+			"recorded in the state DB, without accessing the destination")
+}
+
+// newStateStore loads the state DB, returns nil if the state DB cannot be
+// loaded and '--only-if-changed' is not enabled.
+func (o *stateOpts) newStateStore() (*hangar.StateStore, error) {
+	name := o.stateFile
+	if name == "" {
+		name = statedb.Path("state.json")
+	}
+	s, err := hangar.NewStateStore(name)
+	if err != nil {
+		if o.onlyIfChanged || o.stateFile != "" {
+			return nil, err
+		}
+		logrus.Warnf("Failed to load state DB: %v", err)
+		return nil, nil
+	}
+	if o.onlyIfChanged {
+		logrus.Infof("State DB: %q, %d images recorded", name, len(s.Images))
+	}
+	return s, nil
+}
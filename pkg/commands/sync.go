@@ -1,13 +1,13 @@
 package commands
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/copy"
 	"github.com/cnrancher/hangar/pkg/hangar"
 	"github.com/cnrancher/hangar/pkg/utils"
 	commonFlag "github.com/containers/common/pkg/flag"
@@ -17,15 +17,37 @@ import (
 )
 
 type syncOpts struct {
-	file        string
-	arch        []string
-	os          []string
-	source      string
-	destination string
-	failed      string
-	jobs        int
-	timeout     time.Duration
-	tlsVerify   commonFlag.OptionalBool
+	file          []string
+	images        []string
+	arch          []string
+	os            []string
+	source        string
+	destination   string
+	failed        string
+	statusFile    string
+	jobs          int
+	timeout       time.Duration
+	tlsVerify     commonFlag.OptionalBool
+	detectChanges bool
+	dryRun        bool
+
+	includeAttestations bool
+	copySignatures      bool
+	copyAttestations    bool
+	resume              bool
+
+	blobConcurrency int
+	maxMemory       int
+
+	trustOpts
+	credentialOpts
+	failureOpts
+	probeOpts
+	contentStoreOpts
+	sigstoreOpts
+	compressionOpts
+	lockOpts
+	hookOpts
 }
 
 type syncCmd struct {
@@ -47,7 +69,33 @@ hangar sync \
 	--source SOURCE_REGISTRY \
 	--destination SAVED_ARCHIVE.zip \
 	--arch amd64,arm64 \
-	--os linux`,
+	--os linux \
+	--lock-file hangar.lock.yaml
+
+# Save the signatures, attestations and SBOMs of the images into the archive,
+# they will be loaded with the images by 'hangar load'.
+hangar sync \
+	--file IMAGE_LIST.txt \
+	--source SOURCE_REGISTRY \
+	--destination SAVED_ARCHIVE.zip \
+	--copy-signatures \
+	--copy-attestations
+
+# Sync the images into different destination projects, each line of the
+# image list has the source image and the destination image:
+#   docker.io/library/nginx:1.25 team-a/nginx:1.25
+#   docker.io/library/redis:7 team-b/redis:7
+# The image list in YAML format ('.yaml' or '.yml') is also supported:
+#   - source: docker.io/library/nginx:1.25
+#     destination: team-a/nginx:1.25
+hangar sync \
+	--file IMAGE_LIST.txt \
+	--destination SAVED_ARCHIVE.zip
+
+# Reproduce the bundle by the images, digests and flags of the lock file.
+hangar sync \
+	--from-lock hangar.lock.yaml \
+	--destination SAVED_ARCHIVE.zip`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
 			if cc.baseCmd.debug {
@@ -55,32 +103,82 @@ hangar sync \
 				logrus.Debugf("debug output enabled")
 				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
 			}
-
-			h, err := cc.prepareHangar()
-			if err != nil {
+			if err := cc.applyLock(cmd, cc.file, &cc.images); err != nil {
 				return err
 			}
-			if err := run(h); err != nil {
-				return err
+			if (cc.detectChanges || cc.dryRun) && !cc.baseCmd.debug {
+				// Only output the change list or the plan to stdout.
+				logrus.SetLevel(logrus.WarnLevel)
 			}
-			return nil
+			if cc.dryRun {
+				h, err := cc.prepareHangar()
+				if err != nil {
+					return err
+				}
+				return dryRun(h)
+			}
+
+			return cc.runHooks(cmd, cc.source, cc.destination, func() error {
+				h, err := cc.prepareHangar()
+				if err != nil {
+					return err
+				}
+				if cc.detectChanges {
+					return detectChanges(h)
+				}
+				if err := run(h); err != nil {
+					return err
+				}
+				return nil
+			})
 		},
 	})
 
 	flags := cc.baseCmd.cmd.PersistentFlags()
-	flags.StringVarP(&cc.file, "file", "f", "", "image list file")
+	flags.StringSliceVarP(&cc.file, "file", "f", nil, "image list file, can be specified multiple times to process the images of multiple lists in one run")
 	flags.SetAnnotation("file", cobra.BashCompFilenameExt, []string{"txt"})
-	flags.SetAnnotation("file", cobra.BashCompOneRequiredFlag, []string{""})
-	flags.StringSliceVarP(&cc.arch, "arch", "a", []string{"amd64", "arm64"}, "architecture list of images")
-	flags.StringSliceVarP(&cc.os, "os", "", []string{"linux"}, "OS list of images")
+	flags.StringSliceVarP(&cc.images, "image", "", nil, "image to copy, can be specified multiple times instead of the image list file")
+	flags.StringSliceVarP(&cc.arch, "arch", "a", defaultArch(), "architecture list of images")
+	flags.StringSliceVarP(&cc.os, "os", "", defaultOS(), "OS list of images")
 	flags.StringVarP(&cc.source, "source", "s", "", "override the source registry in image list")
+	cc.baseCmd.cmd.RegisterFlagCompletionFunc("source", completeRegistries)
 	flags.StringVarP(&cc.destination, "destination", "d", "", "file name of the destination archive file")
 	flags.SetAnnotation("destination", cobra.BashCompFilenameExt, []string{"zip"})
 	flags.StringVarP(&cc.failed, "failed", "o", "sync-failed.txt", "file name of the sync failed image list")
 	flags.SetAnnotation("failed", cobra.BashCompFilenameExt, []string{"txt"})
+	flags.StringVarP(&cc.statusFile, "status-file", "", "", "write the job progress & failures into the status file continuously (JSON format)")
+	flags.SetAnnotation("status-file", cobra.BashCompFilenameExt, []string{"json"})
 	flags.IntVarP(&cc.jobs, "jobs", "j", 1, "worker number,copy images parallelly (1-20)")
+	flags.IntVarP(&cc.blobConcurrency, "blob-concurrency", "", copy.DefaultBlobConcurrency,
+		"number of the blobs of each image copied in parallel, independent of the worker number")
+	flags.IntVarP(&cc.maxMemory, "max-memory", "", 0,
+		"total size (MiB) of the large layers streamed in parallel by all the workers, "+
+			"the layers exceeding the size are copied one at a time, 0 to disable")
 	flags.DurationVarP(&cc.timeout, "timeout", "", time.Minute*10, "timeout when save each images")
 	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates")
+	flags.BoolVarP(&cc.detectChanges, "detect-changes", "", false,
+		"compare destination with desired state without copying, exit 2 with JSON change list if changed")
+	flags.BoolVarP(&cc.dryRun, "dry-run", "", false,
+		"resolve the source manifests and output the platform images would be synced and their total size without any writes")
+
+	cc.baseCmd.cmd.Flags().BoolVarP(&cc.includeAttestations, "include-attestations", "", false,
+		"copy the attestation manifests (unknown/unknown platform) of the image index with the subject images")
+	cc.baseCmd.cmd.Flags().BoolVarP(&cc.copySignatures, "copy-signatures", "", false,
+		"save the cosign signatures (.sig tags) and the signature OCI referrers of the images into the archive")
+	cc.baseCmd.cmd.Flags().BoolVarP(&cc.copyAttestations, "copy-attestations", "", false,
+		"save the cosign attestations & SBOMs (.att, .sbom tags) and the other OCI referrers of the images into the archive")
+	cc.baseCmd.cmd.Flags().BoolVarP(&cc.resume, "resume", "", false,
+		"write the images appended into the archive into the checkpoint in the 'DESTINATION.resume' dir "+
+			"periodically and skip the images completed by the interrupted job")
+	cc.trustOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.probeOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.contentStoreOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.sigstoreOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.compressionOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.lockOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.credentialOpts.addFlags(cc.baseCmd.cmd.Flags())
+	cc.failureOpts.addFlags(flags)
+	cc.hookOpts.addFlags(cc.baseCmd.cmd.Flags())
 
 	addCommands(
 		cc.cmd,
@@ -90,9 +188,6 @@ hangar sync \
 }
 
 func (cc *syncCmd) prepareHangar() (hangar.Hangar, error) {
-	if cc.file == "" {
-		return nil, fmt.Errorf("image list not provided, use '--file' to specify the image list file")
-	}
 	if cc.debug {
 		logrus.Infof("debug mode enabled, force worker number to 1")
 		cc.jobs = 1
@@ -102,28 +197,19 @@ func (cc *syncCmd) prepareHangar() (hangar.Hangar, error) {
 			cc.jobs = 1
 		}
 	}
+	if err := checkBlobConcurrency(cc.blobConcurrency); err != nil {
+		return nil, err
+	}
 
 	_, err := os.Stat(cc.destination)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat %v: %w", cc.destination, err)
 	}
-	file, err := os.Open(cc.file)
+	list, err := readImageList(cc.file, cc.images)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open %q: %v", cc.file, err)
-	}
-	images := []string{}
-	sc := bufio.NewScanner(file)
-	sc.Split(bufio.ScanLines)
-	for sc.Scan() {
-		l := strings.TrimSpace(sc.Text())
-		if l == "" || strings.HasPrefix(l, "#") || strings.HasPrefix(l, "//") {
-			continue
-		}
-		images = append(images, l)
-	}
-	if err := file.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close %q: %v", cc.file, err)
+		return nil, err
 	}
+	images := list.images
 
 	sysCtx := cc.baseCmd.newSystemContext()
 	if cc.tlsVerify.Present() {
@@ -131,6 +217,38 @@ func (cc *syncCmd) prepareHangar() (hangar.Hangar, error) {
 		sysCtx.OCIInsecureSkipTLSVerify = !cc.tlsVerify.Value()
 	}
 
+	for _, line := range images {
+		if src := sourceImage(line, cc.source); src != "" {
+			cc.addSource(src)
+		}
+	}
+	if err := cc.checkCredentials(signalContext, sysCtx); err != nil {
+		return nil, err
+	}
+	images = cc.probeSources(signalContext, sysCtx, images, func(line string) string {
+		return sourceImage(line, cc.source)
+	})
+
+	trustStore, err := cc.newTrustStore()
+	if err != nil {
+		return nil, err
+	}
+	maxFailures, err := cc.failureThreshold()
+	if err != nil {
+		return nil, err
+	}
+	contentStore, err := cc.newContentStore()
+	if err != nil {
+		return nil, err
+	}
+	sigstoreVerifier, err := cc.newSigstoreVerifier()
+	if err != nil {
+		return nil, err
+	}
+	layerCompression, err := cc.newLayerCompression()
+	if err != nil {
+		return nil, err
+	}
 	policy, err := cc.getPolicy()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get policy: %w", err)
@@ -143,14 +261,39 @@ func (cc *syncCmd) prepareHangar() (hangar.Hangar, error) {
 			Variant:             nil,
 			Timeout:             cc.timeout,
 			Workers:             cc.jobs,
+			BlobConcurrency:     cc.blobConcurrency,
+			MaxMemory:           int64(cc.maxMemory) << 20,
 			FailedImageListName: cc.failed,
+			StatusFile:          cc.statusFile,
 			SystemContext:       sysCtx,
 			Policy:              policy,
+			MaxFailures:         maxFailures,
+			KeepGoing:           cc.keepGoing,
+			BatchSize:           cc.batchSize,
+			BreakerThreshold:    cc.breakerThreshold,
+			BreakerCooldown:     cc.breakerCooldown,
+			Tiers:               list.tiers,
+			Optional:            list.optional,
+			ImageListOrigins:    list.origins,
+			ImageListSource:     list.source,
+			TimeBudget:          cc.timeBudget,
+			ContentStore:        contentStore,
+			SigstoreVerifier:    sigstoreVerifier,
+			LayerCompression:    layerCompression,
+			AllowedRegistries:   cc.allowedRegistries,
+			TrustStore:          trustStore,
+			AcceptChanges:       cc.acceptChanges,
+			IncludeAttestations: cc.includeAttestations,
+			Lock:                cc.newLock(cc.baseCmd.cmd),
+			FromLock:            cc.locked,
 		},
 
 		SourceRegistry:    cc.source,
 		SharedBlobDirPath: "", // Use the default shared blob dir path.
 		ArchiveName:       cc.destination,
+		Resume:            cc.resume,
+		CopySignatures:    cc.copySignatures,
+		CopyAttestations:  cc.copyAttestations,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create syncer: %v", err)
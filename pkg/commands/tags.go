@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/extension"
+	"github.com/cnrancher/hangar/pkg/utils"
+	commonFlag "github.com/containers/common/pkg/flag"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type tagsCmd struct {
+	*baseCmd
+
+	filter    string
+	limit     int
+	json      bool
+	tlsVerify commonFlag.OptionalBool
+}
+
+func newTagsCmd() *tagsCmd {
+	cc := &tagsCmd{}
+
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "tags REGISTRY/REPOSITORY",
+		Short: "List the tags of the repository by the registry tags list API",
+		Long: `List the tags of the repository by the registry tags list API,
+the paginated result of the registry is followed automatically.
+
+The '--filter' is the regular expression matching the whole tag name.`,
+		Example: `# List the tags of the repository:
+hangar tags docker.io/library/nginx
+
+# List the first 100 tags matching 'v2.*' in JSON format:
+hangar tags registry.example.io/rancher/rancher --filter 'v2.*' --limit 100 --json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+			return cc.run(args[0])
+		},
+	})
+
+	flags := cc.baseCmd.cmd.Flags()
+	flags.StringVarP(&cc.filter, "filter", "", "", "regular expression to filter the tags")
+	flags.IntVarP(&cc.limit, "limit", "", 0, "maximum number of tags to output (0 for no limit)")
+	flags.BoolVarP(&cc.json, "json", "", false, "output in json format")
+	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates")
+
+	return cc
+}
+
+func (cc *tagsCmd) run(repository string) error {
+	named, err := reference.ParseNormalizedNamed(repository)
+	if err != nil {
+		return fmt.Errorf("failed to parse %q: %w", repository, err)
+	}
+	if !reference.IsNameOnly(named) {
+		return fmt.Errorf("invalid repository %q: should not contain tag or digest", repository)
+	}
+	tags, err := cc.list(reference.Domain(named), reference.Path(named))
+	if err != nil {
+		return err
+	}
+
+	if cc.json {
+		if tags == nil {
+			tags = []string{}
+		}
+		b, _ := json.MarshalIndent(tags, "", "  ")
+		fmt.Println(string(b))
+		return nil
+	}
+	for _, t := range tags {
+		fmt.Println(t)
+	}
+	return nil
+}
+
+// list lists the tags of the repository matching the filter.
+func (cc *tagsCmd) list(registry, repository string) ([]string, error) {
+	var (
+		re  *regexp.Regexp
+		err error
+	)
+	if cc.filter != "" {
+		re, err = regexp.Compile("^(?:" + cc.filter + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %w", cc.filter, err)
+		}
+	}
+
+	sysCtx := cc.baseCmd.newSystemContext()
+	if cc.tlsVerify.Present() {
+		sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!cc.tlsVerify.Value())
+		sysCtx.OCIInsecureSkipTLSVerify = !cc.tlsVerify.Value()
+	}
+	limit := cc.limit
+	if re != nil {
+		// The limit is applied on the filtered tags.
+		limit = 0
+	}
+	tags, err := extension.NewClient(sysCtx, registry).
+		ListTags(signalContext, repository, limit)
+	if err != nil {
+		return nil, err
+	}
+	if re == nil {
+		return tags, nil
+	}
+
+	var matched []string
+	for _, t := range tags {
+		if !re.MatchString(t) {
+			continue
+		}
+		matched = append(matched, t)
+		if cc.limit > 0 && len(matched) >= cc.limit {
+			break
+		}
+	}
+	logrus.Debugf("%d of %d tags matched %q", len(matched), len(tags), cc.filter)
+	return matched, nil
+}
@@ -0,0 +1,199 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/cmdconfig"
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/cnrancher/hangar/pkg/utils"
+	commonFlag "github.com/containers/common/pkg/flag"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type testPullCmd struct {
+	*baseCmd
+
+	file        string
+	destination string
+	sample      string
+	full        bool
+	arch        string
+	os          string
+	report      string
+	failed      string
+	jobs        int
+	timeout     time.Duration
+	skipLogin   bool
+	tlsVerify   commonFlag.OptionalBool
+
+	failureOpts
+}
+
+func newTestPullCmd() *testPullCmd {
+	cc := &testPullCmd{}
+	cc.baseCmd = newBaseCmd(&cobra.Command{
+		Use:   "test-pull -f LIST.txt -d REGISTRY",
+		Short: "Pull a sample of the mirrored images from destination registry",
+		Long: `Pull a sample of the mirrored images from destination registry as an
+end-to-end smoke test.
+
+The manifest, config and the first layer (or all layers if '--full' is
+specified) of the images are downloaded with the same credentials & certs
+a cluster node would use, the content is verified by digest and discarded.
+
+The pull results are written into the report file (JSON format).`,
+		Example: `# Pull 10% of the mirrored images:
+hangar test-pull \
+	--file IMAGE_LIST.txt \
+	--destination harbor.example.io \
+	--sample 10%
+
+# Pull all layers of 20 images for arm64 nodes:
+hangar test-pull \
+	--file IMAGE_LIST.txt \
+	--destination harbor.example.io \
+	--sample 20 \
+	--full \
+	--arch arm64`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			initializeFlagsConfig(cmd, cmdconfig.DefaultProvider)
+			if cc.baseCmd.debug {
+				logrus.SetLevel(logrus.DebugLevel)
+				logrus.Debugf("debug output enabled")
+				logrus.Debugf("%v", utils.PrintObject(cmdconfig.Get("")))
+			}
+
+			p, err := cc.prepareHangar()
+			if err != nil {
+				return err
+			}
+			err = run(p)
+			if cc.report != "" {
+				if err := utils.SaveJSON(p.Results(), cc.report); err != nil {
+					return fmt.Errorf("failed to save report: %w", err)
+				}
+				logrus.Infof("Pull report saved to %q", cc.report)
+			}
+			return err
+		},
+	})
+
+	flags := cc.baseCmd.cmd.Flags()
+	flags.StringVarP(&cc.file, "file", "f", "", "image list file")
+	flags.SetAnnotation("file", cobra.BashCompFilenameExt, []string{"txt"})
+	flags.StringVarP(&cc.destination, "destination", "d", "", "override the registry of the images to be pulled")
+	cc.baseCmd.cmd.RegisterFlagCompletionFunc("destination", completeRegistries)
+	flags.StringVarP(&cc.sample, "sample", "", "", "pull a sample of the images, percentage (e.g. '10%') or number (default all images)")
+	flags.BoolVarP(&cc.full, "full", "", false, "pull all layers of the image instead of the first layer")
+	flags.StringVarP(&cc.arch, "arch", "", "", "architecture of the image to pull from manifest list (default the current architecture)")
+	flags.StringVarP(&cc.os, "os", "", "", "OS of the image to pull from manifest list (default the current OS)")
+	flags.StringVarP(&cc.report, "report", "", "test-pull-report.json", "file name of the pull report (JSON format)")
+	flags.SetAnnotation("report", cobra.BashCompFilenameExt, []string{"json"})
+	flags.StringVarP(&cc.failed, "failed", "o", "test-pull-failed.txt", "file name of the pull failed image list")
+	flags.SetAnnotation("failed", cobra.BashCompFilenameExt, []string{"txt"})
+	flags.IntVarP(&cc.jobs, "jobs", "j", 1, "worker number, pull images parallelly (1-20)")
+	flags.DurationVarP(&cc.timeout, "timeout", "", time.Minute*10, "timeout when pull each images")
+	commonFlag.OptionalBoolFlag(flags, &cc.tlsVerify, "tls-verify", "require HTTPS and verify certificates")
+	flags.BoolVarP(&cc.skipLogin, "skip-login", "", false,
+		"skip check the registry is logged in (used in shell script)")
+	cc.failureOpts.addFlags(flags)
+
+	return cc
+}
+
+func (cc *testPullCmd) prepareHangar() (*hangar.Puller, error) {
+	if cc.file == "" {
+		return nil, fmt.Errorf("image list file not provided, use '--file' to provide the image list")
+	}
+	file, err := os.Open(cc.file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %v", cc.file, err)
+	}
+	var lines []string
+	sc := bufio.NewScanner(file)
+	sc.Split(bufio.ScanLines)
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") || strings.HasPrefix(l, "//") {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close %q: %v", cc.file, err)
+	}
+	lines, err = hangar.SampleImages(lines, cc.sample)
+	if err != nil {
+		return nil, err
+	}
+	if cc.debug {
+		logrus.Infof("debug mode enabled, force worker number to 1")
+		cc.jobs = 1
+	} else if cc.jobs > utils.MaxWorkerNum || cc.jobs < utils.MinWorkerNum {
+		logrus.Warnf("invalid worker num: %v, set to 1", cc.jobs)
+		cc.jobs = 1
+	}
+
+	sysCtx := cc.baseCmd.newSystemContext()
+	sysCtx.ArchitectureChoice = cc.arch
+	sysCtx.OSChoice = cc.os
+	if cc.tlsVerify.Present() {
+		sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(!cc.tlsVerify.Value())
+		sysCtx.OCIInsecureSkipTLSVerify = !cc.tlsVerify.Value()
+	}
+
+	if !cc.skipLogin {
+		registrySet := map[string]bool{}
+		if cc.destination != "" {
+			registrySet[cc.destination] = true
+		} else {
+			for _, l := range lines {
+				image, _, _ := strings.Cut(l, "@")
+				registrySet[utils.GetRegistryName(image)] = true
+			}
+		}
+		if err := prepareLogin(
+			signalContext,
+			registrySet,
+			utils.CopySystemContext(sysCtx),
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	maxFailures, err := cc.failureThreshold()
+	if err != nil {
+		return nil, err
+	}
+	policy, err := cc.getPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %w", err)
+	}
+	p, err := hangar.NewPuller(&hangar.PullerOpts{
+		CommonOpts: hangar.CommonOpts{
+			Images:              lines,
+			Timeout:             cc.timeout,
+			Workers:             cc.jobs,
+			FailedImageListName: cc.failed,
+			SystemContext:       sysCtx,
+			Policy:              policy,
+			MaxFailures:         maxFailures,
+			KeepGoing:           cc.keepGoing,
+			BatchSize:           cc.batchSize,
+			BreakerThreshold:    cc.breakerThreshold,
+			BreakerCooldown:     cc.breakerCooldown,
+		},
+		DestinationRegistry: cc.destination,
+		Full:                cc.full,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create puller: %v", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/sirupsen/logrus"
+	flag "github.com/spf13/pflag"
+)
+
+// trustOpts is the source registry allow-list and trust-on-first-use
+// digest pinning options.
+type trustOpts struct {
+	allowedRegistries []string
+	trustStore        string
+	acceptChanges     bool
+}
+
+func (o *trustOpts) addFlags(flags *flag.FlagSet) {
+	flags.StringSliceVarP(&o.allowedRegistries, "allowed-registries", "", nil,
+		"allow-list of the source registries, images from other registries will fail")
+	flags.StringVarP(&o.trustStore, "trust-store", "", "",
+		"record the first-seen digest of source images into the trust store file (trust-on-first-use)")
+	flags.BoolVarP(&o.acceptChanges, "accept-changes", "", false,
+		"accept the source image digest changes and update the trust store")
+}
+
+// newTrustStore loads the trust store, returns nil if the trust store
+// is not enabled.
+func (o *trustOpts) newTrustStore() (*hangar.TrustStore, error) {
+	if o.trustStore == "" {
+		if o.acceptChanges {
+			logrus.Warnf("'--accept-changes' is ignored since '--trust-store' not provided")
+		}
+		return nil, nil
+	}
+	t, err := hangar.NewTrustStore(o.trustStore)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("Trust store: %q, %d images recorded", o.trustStore, len(t.Images))
+	return t, nil
+}
@@ -0,0 +1,179 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/containers/image/v5/image"
+	imagetypes "github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultContentStore is the content store directory of containerd.
+	DefaultContentStore = "/var/lib/containerd/io.containerd.content.v1.content"
+	// RKE2ContentStore is the content store directory of the RKE2
+	// embedded containerd.
+	RKE2ContentStore = "/var/lib/rancher/rke2/agent/containerd/io.containerd.content.v1.content"
+	// K3sContentStore is the content store directory of the K3s
+	// embedded containerd.
+	K3sContentStore = "/var/lib/rancher/k3s/agent/containerd/io.containerd.content.v1.content"
+)
+
+// ContentStore reads the blobs from the local containerd content store,
+// the blobs are stored in 'blobs/ALGORITHM/ENCODED' of the root directory.
+type ContentStore struct {
+	root string
+	// open opens the blobs of the custom blob store, nil if reading the
+	// containerd content store of the root directory
+	open OpenBlobFunc
+
+	hits  atomic.Int64
+	bytes atomic.Int64
+}
+
+// NewContentStore returns the local containerd content store of the root
+// directory, returns error if the directory is not a content store.
+func NewContentStore(root string) (*ContentStore, error) {
+	fi, err := os.Stat(filepath.Join(root, "blobs"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid containerd content store %q: %w", root, err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("invalid containerd content store %q: blobs is not a directory", root)
+	}
+	return &ContentStore{
+		root: root,
+	}, nil
+}
+
+// OpenBlobFunc opens the blob by digest, returns false if the blob does
+// not exist or its size mismatch (size is -1 if unknown).
+type OpenBlobFunc func(d digest.Digest, size int64) (io.ReadCloser, int64, bool)
+
+// NewBlobStore returns the content store reading the blobs by the open
+// function instead of the containerd content store directory, the name is
+// used as the root of the content store.
+func NewBlobStore(name string, open OpenBlobFunc) *ContentStore {
+	return &ContentStore{
+		root: name,
+		open: open,
+	}
+}
+
+// Root returns the root directory of the content store.
+func (c *ContentStore) Root() string {
+	if c == nil {
+		return ""
+	}
+	return c.root
+}
+
+// Open opens the blob in the content store, returns false if the blob does
+// not exist or its size mismatch (size is -1 if unknown).
+// The blob digest is verified by the image copy when reading.
+func (c *ContentStore) Open(d digest.Digest, size int64) (io.ReadCloser, int64, bool) {
+	if c == nil || d.Validate() != nil {
+		return nil, 0, false
+	}
+	if c.open != nil {
+		rc, n, ok := c.open(d, size)
+		if ok {
+			c.hits.Add(1)
+			c.bytes.Add(n)
+		}
+		return rc, n, ok
+	}
+	f, err := os.Open(filepath.Join(c.root, "blobs", d.Algorithm().String(), d.Encoded()))
+	if err != nil {
+		return nil, 0, false
+	}
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() || size >= 0 && fi.Size() != size {
+		f.Close()
+		return nil, 0, false
+	}
+	c.hits.Add(1)
+	c.bytes.Add(fi.Size())
+	logrus.Debugf("read blob [%v] from local content store", d)
+	return f, fi.Size(), true
+}
+
+// Hits returns the number and the total size of the blobs read from the
+// content store.
+func (c *ContentStore) Hits() (int64, int64) {
+	if c == nil {
+		return 0, 0
+	}
+	return c.hits.Load(), c.bytes.Load()
+}
+
+// cachedReference wraps the source image reference, the blobs are read
+// from the local content store if exists before falling back to the
+// image source.
+type cachedReference struct {
+	imagetypes.ImageReference
+	store *ContentStore
+}
+
+// NewCachedReference returns the source image reference reading the blobs
+// from the local content store first, returns the reference itself if the
+// content store is nil.
+func NewCachedReference(
+	ref imagetypes.ImageReference, store *ContentStore,
+) imagetypes.ImageReference {
+	if store == nil {
+		return ref
+	}
+	return &cachedReference{
+		ImageReference: ref,
+		store:          store,
+	}
+}
+
+func (r *cachedReference) NewImage(
+	ctx context.Context, sys *imagetypes.SystemContext,
+) (imagetypes.ImageCloser, error) {
+	src, err := r.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return image.FromSource(ctx, sys, src)
+}
+
+func (r *cachedReference) NewImageSource(
+	ctx context.Context, sys *imagetypes.SystemContext,
+) (imagetypes.ImageSource, error) {
+	src, err := r.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedSource{
+		ImageSource: src,
+		ref:         r,
+	}, nil
+}
+
+// cachedSource reads the blobs from the local content store.
+type cachedSource struct {
+	imagetypes.ImageSource
+	ref *cachedReference
+}
+
+func (s *cachedSource) Reference() imagetypes.ImageReference {
+	return s.ref
+}
+
+func (s *cachedSource) GetBlob(
+	ctx context.Context, info imagetypes.BlobInfo, cache imagetypes.BlobInfoCache,
+) (io.ReadCloser, int64, error) {
+	if rc, size, ok := s.ref.store.Open(info.Digest, info.Size); ok {
+		return rc, size, nil
+	}
+	return s.ImageSource.GetBlob(ctx, info, cache)
+}
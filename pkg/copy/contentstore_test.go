@@ -0,0 +1,75 @@
+package copy
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ContentStore(t *testing.T) {
+	root := t.TempDir()
+	_, err := NewContentStore(root)
+	assert.NotNil(t, err)
+
+	data := []byte("layer")
+	d := digest.FromBytes(data)
+	dir := filepath.Join(root, "blobs", d.Algorithm().String())
+	assert.Nil(t, os.MkdirAll(dir, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, d.Encoded()), data, 0644))
+
+	store, err := NewContentStore(root)
+	assert.Nil(t, err)
+	rc, size, ok := store.Open(d, int64(len(data)))
+	assert.True(t, ok)
+	assert.Equal(t, int64(len(data)), size)
+	b, err := io.ReadAll(rc)
+	assert.Nil(t, err)
+	assert.Nil(t, rc.Close())
+	assert.Equal(t, data, b)
+
+	// Size unknown.
+	rc, _, ok = store.Open(d, -1)
+	assert.True(t, ok)
+	rc.Close()
+	// Size mismatch.
+	_, _, ok = store.Open(d, 1)
+	assert.False(t, ok)
+	// Not exists.
+	_, _, ok = store.Open(digest.FromString("not-exists"), -1)
+	assert.False(t, ok)
+
+	hits, bytes := store.Hits()
+	assert.Equal(t, int64(2), hits)
+	assert.Equal(t, int64(2*len(data)), bytes)
+
+	var nilStore *ContentStore
+	_, _, ok = nilStore.Open(d, -1)
+	assert.False(t, ok)
+}
+
+func Test_NewBlobStore(t *testing.T) {
+	data := []byte("layer")
+	d := digest.FromBytes(data)
+	store := NewBlobStore("archive.zip", func(dgst digest.Digest, size int64) (io.ReadCloser, int64, bool) {
+		if dgst != d {
+			return nil, 0, false
+		}
+		return io.NopCloser(bytes.NewReader(data)), int64(len(data)), true
+	})
+	assert.Equal(t, "archive.zip", store.Root())
+	rc, size, ok := store.Open(d, -1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(len(data)), size)
+	rc.Close()
+	_, _, ok = store.Open(digest.FromString("not-exists"), -1)
+	assert.False(t, ok)
+
+	hits, n := store.Hits()
+	assert.Equal(t, int64(1), hits)
+	assert.Equal(t, int64(len(data)), n)
+}
@@ -4,12 +4,17 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/cnrancher/hangar/pkg/backoff"
 	"github.com/containers/common/pkg/retry"
 	imagecopy "github.com/containers/image/v5/copy"
 	"github.com/containers/image/v5/signature"
 	imagetypes "github.com/containers/image/v5/types"
 )
 
+// DefaultBlobConcurrency is the default number of the blobs of the image
+// copied in parallel by hangar.
+const DefaultBlobConcurrency = 3
+
 type Copier struct {
 	source      imagetypes.ImageReference
 	destination imagetypes.ImageReference
@@ -28,6 +33,10 @@ type CopierOption struct {
 	DestRef   imagetypes.ImageReference
 
 	Policy *signature.Policy
+
+	// BlobConcurrency is the number of the blobs of the image copied in
+	// parallel, the default of containers/image is used if not positive.
+	BlobConcurrency int
 }
 
 func NewCopier(o *CopierOption) *Copier {
@@ -39,6 +48,9 @@ func NewCopier(o *CopierOption) *Copier {
 		options:      o.Options,
 		retryOptions: o.RetryOptions,
 	}
+	if c.options != nil && o.BlobConcurrency > 0 {
+		c.options.MaxParallelDownloads = uint(o.BlobConcurrency)
+	}
 
 	return c
 }
@@ -51,7 +63,7 @@ func (c *Copier) Copy(ctx context.Context) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("copy: failed to create policy context: %w", err)
 	}
-	err = retry.IfNecessary(ctx, func() error {
+	err = backoff.IfNecessary(ctx, func() error {
 		var err error
 		m, err = imagecopy.Image(
 			ctx,
@@ -0,0 +1,22 @@
+package copy
+
+import (
+	"testing"
+
+	imagecopy "github.com/containers/image/v5/copy"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewCopier_BlobConcurrency(t *testing.T) {
+	c := NewCopier(&CopierOption{
+		Options:         &imagecopy.Options{},
+		BlobConcurrency: 5,
+	})
+	assert.Equal(t, uint(5), c.options.MaxParallelDownloads)
+
+	// The default of containers/image is used if not positive.
+	c = NewCopier(&CopierOption{
+		Options: &imagecopy.Options{},
+	})
+	assert.Equal(t, uint(0), c.options.MaxParallelDownloads)
+}
@@ -0,0 +1,170 @@
+package copy
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/containers/image/v5/image"
+	imagetypes "github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// minLimitedBlobSize is the size of the blobs not limited by the memory
+// limiter, e.g. the configs and the small layers.
+const minLimitedBlobSize = 1 << 20
+
+// MemoryLimiter limits the total size of the blobs streamed in parallel
+// by all the workers, the blobs exceeding the limit are copied one at a
+// time.
+//
+// The blobs are streamed without buffering the whole blob, the limiter
+// bounds the data in flight of the large blobs when many workers copy the
+// multi-GB layers at the same time.
+type MemoryLimiter struct {
+	limit int64
+
+	mu   sync.Mutex
+	used int64
+	// released is closed when the blob released to wake up the waiters
+	released chan struct{}
+}
+
+// NewMemoryLimiter returns the memory limiter of the size in bytes,
+// returns nil (not limited) if the limit is not positive.
+func NewMemoryLimiter(limit int64) *MemoryLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &MemoryLimiter{
+		limit:    limit,
+		released: make(chan struct{}),
+	}
+}
+
+// weight returns the size acquired by the blob, the blob of the unknown
+// size (-1) acquires the whole limit.
+func (l *MemoryLimiter) weight(size int64) int64 {
+	if size < 0 || size > l.limit {
+		return l.limit
+	}
+	return size
+}
+
+// acquire waits until the size is available, the blob is always acquired
+// if no other blob is being copied.
+func (l *MemoryLimiter) acquire(ctx context.Context, n int64) error {
+	for {
+		l.mu.Lock()
+		if l.used == 0 || l.used+n <= l.limit {
+			l.used += n
+			l.mu.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+func (l *MemoryLimiter) release(n int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.used -= n
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// limitedReference wraps the source image reference, the blobs are read
+// after the size acquired from the memory limiter.
+type limitedReference struct {
+	imagetypes.ImageReference
+	limiter *MemoryLimiter
+}
+
+// NewLimitedReference returns the source image reference limited by the
+// memory limiter, returns the reference itself if the limiter is nil.
+func NewLimitedReference(
+	ref imagetypes.ImageReference, limiter *MemoryLimiter,
+) imagetypes.ImageReference {
+	if limiter == nil {
+		return ref
+	}
+	return &limitedReference{
+		ImageReference: ref,
+		limiter:        limiter,
+	}
+}
+
+func (r *limitedReference) NewImage(
+	ctx context.Context, sys *imagetypes.SystemContext,
+) (imagetypes.ImageCloser, error) {
+	src, err := r.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return image.FromSource(ctx, sys, src)
+}
+
+func (r *limitedReference) NewImageSource(
+	ctx context.Context, sys *imagetypes.SystemContext,
+) (imagetypes.ImageSource, error) {
+	src, err := r.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &limitedSource{
+		ImageSource: src,
+		ref:         r,
+	}, nil
+}
+
+// limitedSource reads the blobs limited by the memory limiter.
+type limitedSource struct {
+	imagetypes.ImageSource
+	ref *limitedReference
+}
+
+func (s *limitedSource) Reference() imagetypes.ImageReference {
+	return s.ref
+}
+
+func (s *limitedSource) GetBlob(
+	ctx context.Context, info imagetypes.BlobInfo, cache imagetypes.BlobInfoCache,
+) (io.ReadCloser, int64, error) {
+	if info.Size >= 0 && info.Size < minLimitedBlobSize {
+		return s.ImageSource.GetBlob(ctx, info, cache)
+	}
+	limiter := s.ref.limiter
+	n := limiter.weight(info.Size)
+	if err := limiter.acquire(ctx, n); err != nil {
+		return nil, 0, err
+	}
+	logrus.Debugf("acquired %d bytes of memory limit for blob [%v]", n, info.Digest)
+	rc, size, err := s.ImageSource.GetBlob(ctx, info, cache)
+	if err != nil {
+		limiter.release(n)
+		return nil, 0, err
+	}
+	return &limitedReader{
+		ReadCloser: rc,
+		release:    func() { limiter.release(n) },
+	}, size, nil
+}
+
+// limitedReader releases the acquired size when closed.
+type limitedReader struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *limitedReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
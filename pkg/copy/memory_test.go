@@ -0,0 +1,44 @@
+package copy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MemoryLimiter(t *testing.T) {
+	assert.Nil(t, NewMemoryLimiter(0))
+
+	l := NewMemoryLimiter(10)
+	assert.Equal(t, int64(10), l.weight(-1))
+	assert.Equal(t, int64(10), l.weight(20))
+	assert.Equal(t, int64(3), l.weight(3))
+
+	assert.Nil(t, l.acquire(context.TODO(), 6))
+	assert.Nil(t, l.acquire(context.TODO(), 4))
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*10)
+	defer cancel()
+	assert.ErrorIs(t, l.acquire(ctx, 1), context.DeadlineExceeded)
+
+	// The waiter is woken up after the size released.
+	acquired := make(chan struct{})
+	go func() {
+		assert.Nil(t, l.acquire(context.TODO(), 5))
+		close(acquired)
+	}()
+	l.release(4)
+	select {
+	case <-acquired:
+		t.Fatal("acquired before enough size released")
+	case <-time.After(time.Millisecond * 10):
+	}
+	l.release(6)
+	<-acquired
+	l.release(5)
+
+	// The blob exceeding the limit is acquired if no other blob.
+	assert.Nil(t, l.acquire(context.TODO(), l.weight(100)))
+	l.release(l.weight(100))
+}
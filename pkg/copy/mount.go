@@ -0,0 +1,83 @@
+package copy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/docker/reference"
+	imagemanifest "github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache"
+	imagetypes "github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// RecordBlobLocations records the locations of the blobs of the docker image
+// (including all instances of the manifest list) into the default blob
+// info cache, so the blobs can be mounted from the image repository instead
+// of being transferred when copying into the same registry.
+func RecordBlobLocations(
+	ctx context.Context, ref imagetypes.ImageReference, sys *imagetypes.SystemContext,
+) error {
+	named := ref.DockerReference()
+	if named == nil {
+		return fmt.Errorf("RecordBlobLocations: %q is not docker reference",
+			ref.StringWithinTransport())
+	}
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return fmt.Errorf("RecordBlobLocations: %w", err)
+	}
+	defer src.Close()
+
+	b, mime, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("RecordBlobLocations: %w", err)
+	}
+	var blobs []digest.Digest
+	if imagemanifest.MIMETypeIsMultiImage(mime) {
+		list, err := imagemanifest.ListFromBlob(b, mime)
+		if err != nil {
+			return fmt.Errorf("RecordBlobLocations: %w", err)
+		}
+		for _, d := range list.Instances() {
+			b, mime, err := src.GetManifest(ctx, &d)
+			if err != nil {
+				return fmt.Errorf("RecordBlobLocations: %w", err)
+			}
+			d, err := manifestBlobs(b, mime)
+			if err != nil {
+				return fmt.Errorf("RecordBlobLocations: %w", err)
+			}
+			blobs = append(blobs, d...)
+		}
+	} else {
+		blobs, err = manifestBlobs(b, mime)
+		if err != nil {
+			return fmt.Errorf("RecordBlobLocations: %w", err)
+		}
+	}
+
+	cache := blobinfocache.DefaultCache(sys)
+	// Keep the same scope & location format with the docker transport.
+	scope := imagetypes.BICTransportScope{Opaque: reference.Domain(named)}
+	location := imagetypes.BICLocationReference{Opaque: named.Name()}
+	for _, d := range blobs {
+		cache.RecordKnownLocation(ref.Transport(), scope, d, location)
+	}
+	return nil
+}
+
+func manifestBlobs(b []byte, mime string) ([]digest.Digest, error) {
+	m, err := imagemanifest.FromBlob(b, mime)
+	if err != nil {
+		return nil, err
+	}
+	var blobs []digest.Digest
+	if d := m.ConfigInfo().Digest; d != "" {
+		blobs = append(blobs, d)
+	}
+	for _, l := range m.LayerInfos() {
+		blobs = append(blobs, l.Digest)
+	}
+	return blobs, nil
+}
@@ -0,0 +1,280 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/image"
+	imagemanifest "github.com/containers/image/v5/manifest"
+	imagetypes "github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ConfigMutation is the transformations applied to the image config
+// during copy, the digest of the copied image will be changed.
+type ConfigMutation struct {
+	// StripHistory removes the build history and the build container
+	// metadata (container, container_config) from the image config.
+	StripHistory bool
+	// Labels are set into the image config labels.
+	Labels map[string]string
+}
+
+// ParseLabels parses the labels from the 'KEY=VALUE' format strings.
+func ParseLabels(s []string) (map[string]string, error) {
+	labels := make(map[string]string, len(s))
+	for _, l := range s {
+		k, v, ok := strings.Cut(l, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label %q, should be 'KEY=VALUE'", l)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+// Empty returns true if no transformation needs to be applied.
+func (m *ConfigMutation) Empty() bool {
+	return m == nil || (!m.StripHistory && len(m.Labels) == 0)
+}
+
+// Mutate applies the transformations to the image config blob, the unknown
+// fields of the image config are kept as is.
+func (m *ConfigMutation) Mutate(config []byte) ([]byte, error) {
+	if m.Empty() {
+		return config, nil
+	}
+	var c map[string]json.RawMessage
+	if err := json.Unmarshal(config, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode image config: %w", err)
+	}
+	if m.StripHistory {
+		delete(c, "history")
+		delete(c, "container")
+		delete(c, "container_config")
+	}
+	if len(m.Labels) > 0 {
+		var runtime map[string]json.RawMessage
+		if b, ok := c["config"]; ok && string(b) != "null" {
+			if err := json.Unmarshal(b, &runtime); err != nil {
+				return nil, fmt.Errorf("failed to decode image runtime config: %w", err)
+			}
+		}
+		if runtime == nil {
+			runtime = map[string]json.RawMessage{}
+		}
+		var labels map[string]string
+		if b, ok := runtime["Labels"]; ok && string(b) != "null" {
+			if err := json.Unmarshal(b, &labels); err != nil {
+				return nil, fmt.Errorf("failed to decode image labels: %w", err)
+			}
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		for k, v := range m.Labels {
+			labels[k] = v
+		}
+		b, err := json.Marshal(labels)
+		if err != nil {
+			return nil, err
+		}
+		runtime["Labels"] = b
+		if c["config"], err = json.Marshal(runtime); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(c)
+}
+
+// String returns the human readable description of the mutation.
+func (m *ConfigMutation) String() string {
+	if m.Empty() {
+		return ""
+	}
+	var s []string
+	if m.StripHistory {
+		s = append(s, "strip-history")
+	}
+	keys := make([]string, 0, len(m.Labels))
+	for k := range m.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s = append(s, fmt.Sprintf("label %s=%s", k, m.Labels[k]))
+	}
+	return strings.Join(s, ", ")
+}
+
+// mutatedReference wraps the source image reference, the image config
+// read from the image source is rewritten by the mutation.
+type mutatedReference struct {
+	imagetypes.ImageReference
+	mutation *ConfigMutation
+}
+
+// NewMutatedReference returns the source image reference applying the
+// config mutation when reading the image.
+// The reference should point to a single image instead of a manifest list.
+func NewMutatedReference(
+	ref imagetypes.ImageReference, m *ConfigMutation,
+) imagetypes.ImageReference {
+	return &mutatedReference{
+		ImageReference: ref,
+		mutation:       m,
+	}
+}
+
+// DockerReference returns the reference without digest since the manifest
+// digest is changed after mutation.
+func (r *mutatedReference) DockerReference() reference.Named {
+	named := r.ImageReference.DockerReference()
+	if named == nil {
+		return nil
+	}
+	if _, ok := named.(reference.Digested); !ok {
+		return named
+	}
+	return reference.TrimNamed(named)
+}
+
+func (r *mutatedReference) NewImage(
+	ctx context.Context, sys *imagetypes.SystemContext,
+) (imagetypes.ImageCloser, error) {
+	src, err := r.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return image.FromSource(ctx, sys, src)
+}
+
+func (r *mutatedReference) NewImageSource(
+	ctx context.Context, sys *imagetypes.SystemContext,
+) (imagetypes.ImageSource, error) {
+	src, err := r.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &mutatedSource{
+		ImageSource: src,
+		ref:         r,
+	}, nil
+}
+
+// mutatedSource rewrites the image config and the manifest.
+type mutatedSource struct {
+	imagetypes.ImageSource
+	ref *mutatedReference
+
+	once     sync.Once
+	err      error
+	manifest []byte
+	mime     string
+	config   []byte
+	digest   digest.Digest
+}
+
+func (s *mutatedSource) Reference() imagetypes.ImageReference {
+	return s.ref
+}
+
+func (s *mutatedSource) init(ctx context.Context) error {
+	s.once.Do(func() {
+		s.err = s.mutate(ctx)
+	})
+	return s.err
+}
+
+func (s *mutatedSource) mutate(ctx context.Context) error {
+	b, mime, err := s.ImageSource.GetManifest(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if mime == "" {
+		mime = imagemanifest.GuessMIMEType(b)
+	}
+	var configDesc imgspecv1.Descriptor
+	var m map[string]json.RawMessage
+	switch mime {
+	case imagemanifest.DockerV2Schema2MediaType,
+		imgspecv1.MediaTypeImageManifest:
+		if err := json.Unmarshal(b, &m); err != nil {
+			return fmt.Errorf("failed to decode manifest: %w", err)
+		}
+		if err := json.Unmarshal(m["config"], &configDesc); err != nil {
+			return fmt.Errorf("failed to decode config descriptor: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported MIME %q to mutate image config", mime)
+	}
+
+	rc, _, err := s.ImageSource.GetBlob(ctx, imagetypes.BlobInfo{
+		Digest:    configDesc.Digest,
+		Size:      configDesc.Size,
+		MediaType: configDesc.MediaType,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get image config: %w", err)
+	}
+	defer rc.Close()
+	config, err := io.ReadAll(rc)
+	if err != nil {
+		return fmt.Errorf("failed to read image config: %w", err)
+	}
+	if s.config, err = s.ref.mutation.Mutate(config); err != nil {
+		return err
+	}
+	s.digest = digest.FromBytes(s.config)
+	configDesc.Digest = s.digest
+	configDesc.Size = int64(len(s.config))
+	if m["config"], err = json.Marshal(configDesc); err != nil {
+		return err
+	}
+	if s.manifest, err = json.Marshal(m); err != nil {
+		return err
+	}
+	s.mime = mime
+	return nil
+}
+
+func (s *mutatedSource) GetManifest(
+	ctx context.Context, instanceDigest *digest.Digest,
+) ([]byte, string, error) {
+	if instanceDigest != nil {
+		return s.ImageSource.GetManifest(ctx, instanceDigest)
+	}
+	if err := s.init(ctx); err != nil {
+		return nil, "", err
+	}
+	return s.manifest, s.mime, nil
+}
+
+func (s *mutatedSource) GetBlob(
+	ctx context.Context, info imagetypes.BlobInfo, cache imagetypes.BlobInfoCache,
+) (io.ReadCloser, int64, error) {
+	if err := s.init(ctx); err != nil {
+		return nil, 0, err
+	}
+	if info.Digest == s.digest {
+		return io.NopCloser(bytes.NewReader(s.config)), int64(len(s.config)), nil
+	}
+	return s.ImageSource.GetBlob(ctx, info, cache)
+}
+
+// GetSignatures returns no signatures since the signatures of the source
+// image are invalid after mutation.
+func (s *mutatedSource) GetSignatures(
+	context.Context, *digest.Digest,
+) ([][]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,65 @@
+package copy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"owner=team-a", "empty=", "k=a=b"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"owner": "team-a",
+		"empty": "",
+		"k":     "a=b",
+	}, labels)
+
+	_, err = ParseLabels([]string{"invalid"})
+	assert.NotNil(t, err)
+	_, err = ParseLabels([]string{"=value"})
+	assert.NotNil(t, err)
+}
+
+func Test_ConfigMutation(t *testing.T) {
+	var m *ConfigMutation
+	assert.True(t, m.Empty())
+	assert.True(t, (&ConfigMutation{}).Empty())
+
+	config := []byte(`{"architecture":"amd64","os":"linux",` +
+		`"config":{"Env":["PATH=/bin"],"Labels":{"a":"b"}},` +
+		`"container":"abc","container_config":{"Hostname":"build-host"},` +
+		`"history":[{"created_by":"RUN make"}],` +
+		`"rootfs":{"type":"layers","diff_ids":["sha256:aaa"]}}`)
+	b, err := (&ConfigMutation{}).Mutate(config)
+	assert.Nil(t, err)
+	assert.Equal(t, config, b)
+
+	m = &ConfigMutation{
+		StripHistory: true,
+		Labels:       map[string]string{"owner": "team-a", "a": "c"},
+	}
+	b, err = m.Mutate(config)
+	assert.Nil(t, err)
+	var c map[string]any
+	assert.Nil(t, json.Unmarshal(b, &c))
+	assert.NotContains(t, c, "history")
+	assert.NotContains(t, c, "container")
+	assert.NotContains(t, c, "container_config")
+	assert.Equal(t, "amd64", c["architecture"])
+	assert.NotNil(t, c["rootfs"])
+	runtime := c["config"].(map[string]any)
+	assert.Equal(t, []any{"PATH=/bin"}, runtime["Env"])
+	assert.Equal(t, map[string]any{"a": "c", "owner": "team-a"}, runtime["Labels"])
+	assert.Equal(t, "strip-history, label a=c, label owner=team-a", m.String())
+
+	// Image config without runtime config.
+	m = &ConfigMutation{Labels: map[string]string{"owner": "team-a"}}
+	b, err = m.Mutate([]byte(`{"architecture":"amd64","config":null}`))
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"architecture":"amd64","config":{"Labels":{"owner":"team-a"}}}`, string(b))
+
+	_, err = m.Mutate([]byte(`invalid`))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,110 @@
+package copy
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/extension"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
+	imagetypes "github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// sharedReference wraps the docker source image reference, the blobs are
+// fetched by the registry client sharing the HTTP connections and the
+// tokens with other workers, instead of the client created by
+// containers/image for each image reference.
+type sharedReference struct {
+	imagetypes.ImageReference
+	registry   string
+	repository string
+}
+
+// NewSharedReference returns the source image reference fetching the blobs
+// by the shared registry client, returns the reference itself if it is not
+// a docker reference or the registry is configured with the mirrors or
+// the location rewritten in the registries.conf, which are only handled
+// by containers/image.
+func NewSharedReference(
+	ref imagetypes.ImageReference, sys *imagetypes.SystemContext,
+) imagetypes.ImageReference {
+	if ref.Transport().Name() != docker.Transport.Name() {
+		return ref
+	}
+	named := ref.DockerReference()
+	if named == nil {
+		return ref
+	}
+	reg, err := sysregistriesv2.FindRegistry(sys, named.Name())
+	if err != nil {
+		return ref
+	}
+	if reg != nil && (len(reg.Mirrors) != 0 || reg.Blocked ||
+		!strings.HasPrefix(named.Name(), reg.Location)) {
+		return ref
+	}
+	return &sharedReference{
+		ImageReference: ref,
+		registry:       reference.Domain(named),
+		repository:     reference.Path(named),
+	}
+}
+
+func (r *sharedReference) NewImage(
+	ctx context.Context, sys *imagetypes.SystemContext,
+) (imagetypes.ImageCloser, error) {
+	src, err := r.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return image.FromSource(ctx, sys, src)
+}
+
+func (r *sharedReference) NewImageSource(
+	ctx context.Context, sys *imagetypes.SystemContext,
+) (imagetypes.ImageSource, error) {
+	src, err := r.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &sharedSource{
+		ImageSource: src,
+		ref:         r,
+		client:      extension.NewStreamClient(sys, r.registry),
+	}, nil
+}
+
+// sharedSource fetches the blobs by the shared registry client.
+type sharedSource struct {
+	imagetypes.ImageSource
+	ref    *sharedReference
+	client *extension.Client
+}
+
+func (s *sharedSource) Reference() imagetypes.ImageReference {
+	return s.ref
+}
+
+// GetBlob fetches the blob by the shared registry client, falls back to
+// the containers/image source if failed or the blob has the foreign URLs.
+// The blob digest is verified by the image copy when reading.
+func (s *sharedSource) GetBlob(
+	ctx context.Context, info imagetypes.BlobInfo, cache imagetypes.BlobInfoCache,
+) (io.ReadCloser, int64, error) {
+	if len(info.URLs) != 0 {
+		return s.ImageSource.GetBlob(ctx, info, cache)
+	}
+	rc, size, err := s.client.Blob(ctx, s.ref.repository, info.Digest)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		logrus.Debugf("fetch blob [%v] by shared client: %v", info.Digest, err)
+		return s.ImageSource.GetBlob(ctx, info, cache)
+	}
+	return rc, size, nil
+}
@@ -0,0 +1,85 @@
+package copy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/extension"
+	"github.com/containers/image/v5/transports/alltransports"
+	imagetypes "github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fallbackSource is the image source serving the blobs not fetched by the
+// shared client.
+type fallbackSource struct {
+	imagetypes.ImageSource
+	fetched []digest.Digest
+}
+
+func (s *fallbackSource) GetBlob(
+	_ context.Context, info imagetypes.BlobInfo, _ imagetypes.BlobInfoCache,
+) (io.ReadCloser, int64, error) {
+	s.fetched = append(s.fetched, info.Digest)
+	return io.NopCloser(strings.NewReader("fallback")), 8, nil
+}
+
+func Test_sharedSource_GetBlob(t *testing.T) {
+	data := []byte("layer")
+	d := digest.FromBytes(data)
+	missing := digest.FromString("missing")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/library/nginx/blobs/"+d.String() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	sys := &imagetypes.SystemContext{
+		DockerInsecureSkipTLSVerify: imagetypes.OptionalBoolTrue,
+	}
+	registry := strings.TrimPrefix(server.URL, "https://")
+	ref, err := alltransports.ParseImageName("docker://" + registry + "/library/nginx:1.25")
+	assert.Nil(t, err)
+	shared, ok := NewSharedReference(ref, sys).(*sharedReference)
+	assert.True(t, ok)
+	assert.Equal(t, registry, shared.registry)
+	assert.Equal(t, "library/nginx", shared.repository)
+
+	fallback := &fallbackSource{}
+	s := &sharedSource{
+		ImageSource: fallback,
+		ref:         shared,
+		client:      extension.NewStreamClient(sys, registry),
+	}
+	rc, size, err := s.GetBlob(context.TODO(), imagetypes.BlobInfo{Digest: d, Size: -1}, nil)
+	assert.Nil(t, err)
+	b, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, data, b)
+	assert.Equal(t, int64(len(data)), size)
+	assert.Empty(t, fallback.fetched)
+
+	// Fallback to the containers/image source.
+	rc, _, err = s.GetBlob(context.TODO(), imagetypes.BlobInfo{Digest: missing, Size: -1}, nil)
+	assert.Nil(t, err)
+	rc.Close()
+	rc, _, err = s.GetBlob(context.TODO(), imagetypes.BlobInfo{
+		Digest: d, Size: -1, URLs: []string{"https://example.io/layer"},
+	}, nil)
+	assert.Nil(t, err)
+	rc.Close()
+	assert.Equal(t, []digest.Digest{missing, d}, fallback.fetched)
+
+	// Not a docker reference.
+	ref, err = alltransports.ParseImageName("oci:" + t.TempDir())
+	assert.Nil(t, err)
+	assert.Equal(t, ref, NewSharedReference(ref, sys))
+}
@@ -0,0 +1,238 @@
+package copy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	imagetypes "github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// SigstoreSignatureAnnotation is the annotation of the signature
+	// layer storing the base64 encoded signature of the payload.
+	SigstoreSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// SigstorePayloadMediaType is the media type of the signature layer
+	// (simple signing payload).
+	SigstorePayloadMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+	// sigstorePayloadType is the critical type of the payload.
+	sigstorePayloadType = "cosign container image signature"
+	// maxSigstorePayloadSize is the max size of the payload read from
+	// the registry.
+	maxSigstorePayloadSize = 4 << 20
+)
+
+var (
+	ErrSignatureNotFound = errors.New("sigstore signature not found")
+	ErrSignatureInvalid  = errors.New("sigstore signature invalid")
+)
+
+// VerifyMode is the behavior when the sigstore signature verification
+// failed.
+type VerifyMode string
+
+const (
+	// VerifyModeEnforce fails the copy of the image.
+	VerifyModeEnforce VerifyMode = "enforce"
+	// VerifyModeWarn only outputs the warning and continues the copy.
+	VerifyModeWarn VerifyMode = "warn"
+)
+
+// ParseVerifyMode parses the verify mode, default enforce if empty.
+func ParseVerifyMode(s string) (VerifyMode, error) {
+	switch VerifyMode(strings.ToLower(s)) {
+	case "", VerifyModeEnforce:
+		return VerifyModeEnforce, nil
+	case VerifyModeWarn:
+		return VerifyModeWarn, nil
+	}
+	return "", fmt.Errorf("invalid verify mode %q: should be %q or %q",
+		s, VerifyModeEnforce, VerifyModeWarn)
+}
+
+// SigstoreVerifier verifies the sigstore (cosign) signatures of the source
+// images stored by the tag-based convention ('sha256-<encoded>.sig')
+// against the public key before the images are copied.
+type SigstoreVerifier struct {
+	publicKey crypto.PublicKey
+	mode      VerifyMode
+}
+
+// NewSigstoreVerifier loads the PEM encoded public key (ECDSA, RSA or
+// Ed25519) of the key file, e.g. the 'cosign.pub' generated by
+// 'cosign generate-key-pair'.
+func NewSigstoreVerifier(keyPath string, mode VerifyMode) (*SigstoreVerifier, error) {
+	b, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	key, err := parsePublicKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %q: %w", keyPath, err)
+	}
+	return &SigstoreVerifier{
+		publicKey: key,
+		mode:      mode,
+	}, nil
+}
+
+func parsePublicKey(b []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", key)
+}
+
+// Mode returns the verify mode.
+func (v *SigstoreVerifier) Mode() VerifyMode {
+	return v.mode
+}
+
+// Verify verifies the signatures of the manifest digest stored in the
+// signature reference (the '.sig' tag of the digest), returns nil if any
+// signature is valid.
+func (v *SigstoreVerifier) Verify(
+	ctx context.Context,
+	sigRef imagetypes.ImageReference,
+	sysCtx *imagetypes.SystemContext,
+	dgst digest.Digest,
+) error {
+	src, err := sigRef.NewImageSource(ctx, sysCtx)
+	if err != nil {
+		if utils.IsManifestUnknown(err) {
+			return fmt.Errorf("%w: %v", ErrSignatureNotFound, dgst)
+		}
+		return fmt.Errorf("failed to get signature of %v: %w", dgst, err)
+	}
+	defer src.Close()
+	b, _, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		if utils.IsManifestUnknown(err) {
+			return fmt.Errorf("%w: %v", ErrSignatureNotFound, dgst)
+		}
+		return fmt.Errorf("failed to get signature of %v: %w", dgst, err)
+	}
+	m := imgspecv1.Manifest{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("failed to decode signature manifest of %v: %w", dgst, err)
+	}
+
+	var errs []error
+	for _, layer := range m.Layers {
+		sig, ok := layer.Annotations[SigstoreSignatureAnnotation]
+		if !ok || layer.MediaType != SigstorePayloadMediaType {
+			continue
+		}
+		if layer.Size > maxSigstorePayloadSize {
+			errs = append(errs, fmt.Errorf("payload %v too large", layer.Digest))
+			continue
+		}
+		payload, err := readBlob(ctx, src, layer.Digest)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := v.VerifyPayload(payload, sig, dgst); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return nil
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("%w: %v", ErrSignatureNotFound, dgst)
+	}
+	return fmt.Errorf("%w: %v: %v", ErrSignatureInvalid, dgst, errs)
+}
+
+// VerifyPayload verifies the base64 encoded signature of the simple
+// signing payload, and the manifest digest signed in the payload.
+func (v *SigstoreVerifier) VerifyPayload(payload []byte, sig string, dgst digest.Digest) error {
+	signature, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if !verifySignature(v.publicKey, payload, signature) {
+		return fmt.Errorf("signature not signed by the public key")
+	}
+
+	var p struct {
+		Critical struct {
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+			Type string `json:"type"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("invalid signature payload: %w", err)
+	}
+	if p.Critical.Type != sigstorePayloadType {
+		return fmt.Errorf("invalid signature payload type %q", p.Critical.Type)
+	}
+	if p.Critical.Image.DockerManifestDigest != dgst.String() {
+		return fmt.Errorf("signed digest %q mismatch", p.Critical.Image.DockerManifestDigest)
+	}
+	return nil
+}
+
+// verifySignature verifies the signature of the data by the SHA256 hash,
+// the Ed25519 signature is verified by the data directly.
+func verifySignature(key crypto.PublicKey, data, signature []byte) bool {
+	hash := sha256.Sum256(data)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, hash[:], signature)
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], signature) == nil {
+			return true
+		}
+		return rsa.VerifyPSS(k, crypto.SHA256, hash[:], signature, nil) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, data, signature)
+	}
+	return false
+}
+
+func readBlob(
+	ctx context.Context, src imagetypes.ImageSource, d digest.Digest,
+) ([]byte, error) {
+	rc, _, err := src.GetBlob(ctx, imagetypes.BlobInfo{Digest: d, Size: -1}, none.NoCache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob %v: %w", d, err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, maxSigstorePayloadSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %v: %w", d, err)
+	}
+	if d.Algorithm().FromBytes(b) != d {
+		return nil, fmt.Errorf("blob %v: digest mismatch", d)
+	}
+	return b, nil
+}
@@ -0,0 +1,109 @@
+package copy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePublicKey(t *testing.T, key crypto.PublicKey) string {
+	t.Helper()
+	b, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cosign.pub")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: b,
+	}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func sigstorePayload(d digest.Digest) []byte {
+	return []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"example.io/library/test"},`+
+		`"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, d))
+}
+
+func Test_SigstoreVerifier(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewSigstoreVerifier(writePublicKey(t, key.Public()), VerifyModeWarn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, VerifyModeWarn, v.Mode())
+
+	d := digest.FromString("manifest")
+	payload := sigstorePayload(d)
+	hash := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(sig)
+	assert.NoError(t, v.VerifyPayload(payload, encoded, d))
+	// Signed digest mismatch.
+	assert.ErrorContains(t, v.VerifyPayload(payload, encoded, digest.FromString("other")),
+		"mismatch")
+	// Payload tampered.
+	tampered := sigstorePayload(digest.FromString("other"))
+	assert.Error(t, v.VerifyPayload(tampered, encoded, digest.FromString("other")))
+	// Signed by other key.
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherSig, _ := ecdsa.SignASN1(rand.Reader, otherKey, hash[:])
+	assert.Error(t, v.VerifyPayload(payload,
+		base64.StdEncoding.EncodeToString(otherSig), d))
+	// Invalid encoding.
+	assert.Error(t, v.VerifyPayload(payload, "@", d))
+
+	// Ed25519 key.
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = NewSigstoreVerifier(writePublicKey(t, pub), VerifyModeEnforce)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, v.VerifyPayload(payload,
+		base64.StdEncoding.EncodeToString(ed25519.Sign(priv, payload)), d))
+
+	// Invalid public key.
+	path := filepath.Join(t.TempDir(), "invalid.pub")
+	os.WriteFile(path, []byte("invalid"), 0644)
+	_, err = NewSigstoreVerifier(path, VerifyModeEnforce)
+	assert.Error(t, err)
+}
+
+func Test_ParseVerifyMode(t *testing.T) {
+	for s, expected := range map[string]VerifyMode{
+		"":        VerifyModeEnforce,
+		"enforce": VerifyModeEnforce,
+		"WARN":    VerifyModeWarn,
+	} {
+		m, err := ParseVerifyMode(s)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, m)
+	}
+	_, err := ParseVerifyMode("ignore")
+	assert.Error(t, err)
+}
@@ -0,0 +1,248 @@
+package credential
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Credential policies.
+const (
+	// PolicyIgnore does not check the credential permissions.
+	PolicyIgnore = "ignore"
+	// PolicyWarn outputs warning if the credential has excessive permissions.
+	PolicyWarn = "warn"
+	// PolicyFail fails if the credential has excessive permissions.
+	PolicyFail = "fail"
+)
+
+// Repository actions of the registry token scope.
+const (
+	ActionPull   = "pull"
+	ActionPush   = "push"
+	ActionDelete = "delete"
+	// ActionAll is the wildcard action granted to the admin accounts.
+	ActionAll = "*"
+)
+
+var (
+	ErrExcessivePermission = errors.New("credential has excessive permissions")
+	ErrScopeUnknown        = errors.New("unable to determine the granted scope")
+)
+
+// Check is the credential permission check of the registry.
+type Check struct {
+	// Role is the role of the registry, e.g. 'source', 'destination'.
+	Role string
+	// Registry is the registry server name.
+	Registry string
+	// Repository is the repository used to request the token scope,
+	// e.g. 'library/nginx'.
+	Repository string
+	// Forbidden is the actions the credential should not be granted.
+	Forbidden []string
+}
+
+// Verify requests the token of the repository scope with all forbidden
+// actions and checks the actions granted by the registry token service.
+// Returns ErrExcessivePermission if any forbidden action is granted.
+func (c *Check) Verify(ctx context.Context, sysCtx *types.SystemContext) error {
+	actions := append([]string{ActionPull}, c.Forbidden...)
+	granted, err := GrantedActions(ctx, sysCtx, c.Registry, c.Repository, actions)
+	if err != nil {
+		return err
+	}
+	var excessive []string
+	for _, a := range c.Forbidden {
+		if slices.Contains(granted, a) || slices.Contains(granted, ActionAll) {
+			excessive = append(excessive, a)
+		}
+	}
+	if len(excessive) > 0 {
+		return fmt.Errorf("%w: %v credential of %q is granted %q on %q",
+			ErrExcessivePermission, c.Role, c.Registry,
+			strings.Join(excessive, ","), c.Repository)
+	}
+	return nil
+}
+
+// Enforce runs the checks according to the credential policy.
+func Enforce(
+	ctx context.Context, sysCtx *types.SystemContext, policy string, checks []*Check,
+) error {
+	switch policy {
+	case "", PolicyIgnore:
+		return nil
+	case PolicyWarn, PolicyFail:
+	default:
+		return fmt.Errorf("invalid credential policy %q: available policies: %v",
+			policy, []string{PolicyIgnore, PolicyWarn, PolicyFail})
+	}
+	for _, c := range checks {
+		err := c.Verify(ctx, sysCtx)
+		switch {
+		case err == nil:
+			logrus.Infof("Credential of %v registry %q passed the permission check",
+				c.Role, c.Registry)
+		case errors.Is(err, ErrExcessivePermission):
+			if policy == PolicyFail {
+				return err
+			}
+			logrus.Warnf("%v", err)
+		default:
+			logrus.Warnf("Skip checking credential of %v registry %q: %v",
+				c.Role, c.Registry, err)
+		}
+	}
+	return nil
+}
+
+// GrantedActions requests the bearer token of the repository scope from
+// the registry token service and returns the actions granted in the token.
+func GrantedActions(
+	ctx context.Context,
+	sysCtx *types.SystemContext,
+	registry, repository string,
+	actions []string,
+) ([]string, error) {
+	insecure := utils.InsecureRegistry(sysCtx, registry)
+	client := &http.Client{
+		Timeout: time.Second * 10,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+		},
+	}
+
+	server := registry
+	if server == utils.DockerHubRegistry {
+		server = "registry-1.docker.io"
+	}
+	resp, err := ping(ctx, client, "https://"+server+"/v2/")
+	if err != nil && insecure && errors.Is(err, http.ErrSchemeMismatch) {
+		resp, err = ping(ctx, client, "http://"+server+"/v2/")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to ping registry %q: %w", registry, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil, fmt.Errorf("%w: registry %q does not require authentication",
+			ErrScopeUnknown, registry)
+	}
+	scheme, params := ParseChallenge(resp.Header.Get("WWW-Authenticate"))
+	if !strings.EqualFold(scheme, "bearer") || params["realm"] == "" {
+		return nil, fmt.Errorf("%w: registry %q does not use token authentication",
+			ErrScopeUnknown, registry)
+	}
+
+	u, err := url.Parse(params["realm"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token realm: %w", err)
+	}
+	q := u.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	q.Set("scope", fmt.Sprintf("repository:%s:%s",
+		repository, strings.Join(actions, ",")))
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := config.GetCredentials(sysCtx, registry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credential of %q: %w", registry, err)
+	}
+	if auth.Username != "" {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to request token: %v", resp.Status)
+	}
+	t := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return nil, fmt.Errorf("failed to decode token: %w", err)
+	}
+	token := t.Token
+	if token == "" {
+		token = t.AccessToken
+	}
+	return tokenActions(token, repository)
+}
+
+func ping(ctx context.Context, client *http.Client, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Debugf("ping %s", u)
+	return client.Do(req)
+}
+
+// ParseChallenge parses the WWW-Authenticate header, example:
+//
+//	Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func ParseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := map[string]string{}
+	for _, p := range strings.Split(rest, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok {
+			continue
+		}
+		params[strings.ToLower(k)] = strings.Trim(v, `"`)
+	}
+	return scheme, params
+}
+
+// tokenActions decodes the claims of the JWT token and returns the
+// actions granted to the repository.
+func tokenActions(token, repository string) ([]string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: token is not JWT", ErrScopeUnknown)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode token: %v", ErrScopeUnknown, err)
+	}
+	claims := struct {
+		Access []struct {
+			Type    string   `json:"type"`
+			Name    string   `json:"name"`
+			Actions []string `json:"actions"`
+		} `json:"access"`
+	}{}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode token claims: %v", ErrScopeUnknown, err)
+	}
+	var actions []string
+	for _, a := range claims.Access {
+		if a.Type == "repository" && a.Name == repository {
+			actions = append(actions, a.Actions...)
+		}
+	}
+	return actions, nil
+}
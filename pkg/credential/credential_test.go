@@ -0,0 +1,107 @@
+package credential
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newToken(t *testing.T, repository string, actions []string) string {
+	t.Helper()
+	claims := map[string]any{
+		"access": []map[string]any{
+			{
+				"type":    "repository",
+				"name":    repository,
+				"actions": actions,
+			},
+		},
+	}
+	b, err := json.Marshal(claims)
+	assert.Nil(t, err)
+	return "e30." + base64.RawURLEncoding.EncodeToString(b) + ".c2ln"
+}
+
+func Test_ParseChallenge(t *testing.T) {
+	scheme, params := ParseChallenge(
+		`Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`)
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(t, "https://auth.docker.io/token", params["realm"])
+	assert.Equal(t, "registry.docker.io", params["service"])
+
+	scheme, _ = ParseChallenge(`Basic realm="registry"`)
+	assert.Equal(t, "Basic", scheme)
+}
+
+func Test_TokenActions(t *testing.T) {
+	actions, err := tokenActions(
+		newToken(t, "library/nginx", []string{"pull", "push"}), "library/nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pull", "push"}, actions)
+
+	actions, err = tokenActions(
+		newToken(t, "library/nginx", []string{"pull", "push"}), "library/busybox")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(actions))
+
+	_, err = tokenActions("opaque-token", "library/nginx")
+	assert.ErrorIs(t, err, ErrScopeUnknown)
+}
+
+func Test_Verify(t *testing.T) {
+	var granted []string
+	server := httptest.NewTLSServer(nil)
+	defer server.Close()
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/token":
+			scope := strings.Split(r.URL.Query().Get("scope"), ":")
+			json.NewEncoder(w).Encode(map[string]string{
+				"token": newToken(t, scope[1], granted),
+			})
+		}
+	})
+
+	// Use an empty auth file to request the anonymous token.
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	assert.Nil(t, os.WriteFile(authFile, []byte(`{"auths":{}}`), 0600))
+	sysCtx := &types.SystemContext{
+		AuthFilePath:                authFile,
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+	c := &Check{
+		Role:       "source",
+		Registry:   strings.TrimPrefix(server.URL, "https://"),
+		Repository: "library/nginx",
+		Forbidden:  []string{ActionPush, ActionDelete},
+	}
+
+	granted = []string{ActionPull}
+	assert.Nil(t, c.Verify(context.TODO(), sysCtx))
+	assert.Nil(t, Enforce(context.TODO(), sysCtx, PolicyFail, []*Check{c}))
+
+	granted = []string{ActionPull, ActionPush}
+	assert.ErrorIs(t, c.Verify(context.TODO(), sysCtx), ErrExcessivePermission)
+	assert.Nil(t, Enforce(context.TODO(), sysCtx, PolicyWarn, []*Check{c}))
+	assert.ErrorIs(t, Enforce(context.TODO(), sysCtx, PolicyFail, []*Check{c}),
+		ErrExcessivePermission)
+
+	granted = []string{ActionAll}
+	assert.ErrorIs(t, c.Verify(context.TODO(), sysCtx), ErrExcessivePermission)
+
+	assert.NotNil(t, Enforce(context.TODO(), sysCtx, "unknown", []*Check{c}))
+}
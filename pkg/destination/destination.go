@@ -8,14 +8,17 @@ import (
 	"path"
 	"strings"
 
+	"github.com/cnrancher/hangar/pkg/extension"
 	"github.com/cnrancher/hangar/pkg/hangar/archive"
 	"github.com/cnrancher/hangar/pkg/manifest"
 	"github.com/cnrancher/hangar/pkg/types"
+	"github.com/cnrancher/hangar/pkg/utils"
 	imagemanifest "github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/transports/alltransports"
 	imagetypes "github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
 )
 
 // Destination represents the destination of the image to be copied。
@@ -51,6 +54,15 @@ type Destination struct {
 	ociIndex *imgspecv1.Index
 
 	systemCtx *imagetypes.SystemContext
+
+	// proxy is true if the destination registry is a pull-through proxy
+	// cache, the content may be fetched from the upstream on demand.
+	proxy bool
+	// cached is the manifest digests stored locally on the pull-through
+	// proxy cache, only these manifests are considered existing.
+	cached map[digest.Digest]bool
+	// variantRules normalizes the empty variants when matching platforms
+	variantRules utils.VariantRules
 }
 
 // Option is used for create the Destination object.
@@ -68,10 +80,29 @@ type Option struct {
 	Name string
 	// Image Tag, need to provide if Type is docker / docker-daemon
 	Tag string
+	// Proxy treats the destination registry as a pull-through proxy cache,
+	// need to provide if Type is docker
+	Proxy bool
+	// VariantRules normalizes the empty variants when matching the
+	// platforms, the default variant rules are used if nil.
+	VariantRules utils.VariantRules
+	// RewriteRules rewrites the registry, project and name of the
+	// destination by matching the SourceRepository, only applied if Type
+	// is docker
+	RewriteRules RewriteRules
+	// SourceRepository is the repository ('REGISTRY/PROJECT/NAME') of the
+	// source image matched by the RewriteRules
+	SourceRepository string
 
 	SystemContext *imagetypes.SystemContext
 }
 
+// ErrProxyCacheUnsupported is returned by Init if the destination is a
+// pull-through proxy cache but the registry has no API to look up the
+// locally cached content.
+var ErrProxyCacheUnsupported = errors.New(
+	"local cache lookup of the pull-through proxy unsupported on this registry")
+
 // NewDestination is the constructor to create a Destination object.
 func NewDestination(o *Option) (*Destination, error) {
 	var (
@@ -84,6 +115,9 @@ func NewDestination(o *Option) (*Destination, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err = d.rewrite(o.RewriteRules, o.SourceRepository); err != nil {
+			return nil, err
+		}
 	case types.TypeDockerDaemon:
 		d, err = newDestinationFromDockerDaemon(o)
 		if err != nil {
@@ -102,6 +136,15 @@ func NewDestination(o *Option) (*Destination, error) {
 	default:
 		return nil, types.ErrInvalidType
 	}
+	d.variantRules = o.VariantRules
+	if d.variantRules == nil {
+		d.variantRules = utils.DefaultVariantRules
+	}
+	// The reference name is used by the dry-run plan and the logs before
+	// the destination initialized.
+	if err = d.initReferenceName(); err != nil {
+		return nil, err
+	}
 
 	return d, nil
 }
@@ -113,6 +156,10 @@ func (d *Destination) Init(ctx context.Context) error {
 	}
 	// Ignore other error
 	if err = d.initManifest(ctx); err != nil {
+		if d.proxy {
+			// The existence of the proxy cache content is unknown.
+			return err
+		}
 		if errors.Is(err, context.Canceled) ||
 			errors.Is(err, context.DeadlineExceeded) ||
 			strings.Contains(err.Error(), "timeout") {
@@ -131,6 +178,18 @@ func (d *Destination) Directory() string {
 	return d.directory
 }
 
+func (d *Destination) Registry() string {
+	return d.registry
+}
+
+func (d *Destination) Project() string {
+	return d.project
+}
+
+func (d *Destination) Name() string {
+	return d.name
+}
+
 // ReferenceName returns the reference name with transport of the source image.
 //
 //	Example:
@@ -156,28 +215,66 @@ func (d *Destination) MultiArchTag(os, osVersion, arch, variant string) string {
 //		docker://docker.io/library/hello-world:latest-linux-amd64
 //		docker://docker.io/library/example:latest-windows-10.0.14393.1066-amd64
 //		docker-daemon://docker.io/library/nginx:1.23-linux-arm64
-//		oci:./path/to/oci-image/<sha256sum>
-//		dir:./path/to/image/<sha256sum>
+//		oci:./path/to/oci-image/<encoded-digest>
+//		dir:./path/to/image/<encoded-digest>
 func (d *Destination) ReferenceNameMultiArch(
-	os, osVersion, arch, variant, sha256sum string,
+	os, osVersion, arch, variant, encodedDigest string,
 ) string {
 	switch d.imageType {
 	case types.TypeDir,
 		types.TypeOci:
-		return path.Join(d.referenceName, sha256sum)
+		return path.Join(d.referenceName, encodedDigest)
 	default:
 		return d.MultiArchTag(os, osVersion, arch, variant)
 	}
 }
 
+// ReferenceAttestation returns the reference of the attestation manifest
+// of the subject image digest.
+//
+//	Example:
+//		docker://docker.io/library/nginx:1.23-att-<encoded-subject-digest[:12]>
+//		oci:./path/to/oci-image/<encoded-digest>
+//		dir:./path/to/image/<encoded-digest>
+func (d *Destination) ReferenceAttestation(
+	subject digest.Digest, encodedDigest string,
+) (imagetypes.ImageReference, error) {
+	var refName string
+	switch d.imageType {
+	case types.TypeDir,
+		types.TypeOci:
+		refName = path.Join(d.referenceName, encodedDigest)
+	default:
+		encoded := subject.Encoded()
+		if len(encoded) > 12 {
+			encoded = encoded[:12]
+		}
+		refName = fmt.Sprintf("%s-att-%s", d.referenceName, encoded)
+	}
+	return alltransports.ParseImageName(refName)
+}
+
+// ReferenceTag returns the reference of the tag in the destination
+// repository, only available when the destination type is docker.
+//
+//	Example:
+//		docker://docker.io/library/nginx:sha256-<encoded-digest>.sig
+func (d *Destination) ReferenceTag(tag string) (imagetypes.ImageReference, error) {
+	if d.imageType != types.TypeDocker {
+		return nil, fmt.Errorf("tag reference not supported by %v destination", d.imageType)
+	}
+	return alltransports.ParseImageName(fmt.Sprintf("%s%s/%s/%s:%s",
+		d.imageType.Transport(), d.registry, d.project, d.name, tag))
+}
+
 func (d *Destination) Reference() (imagetypes.ImageReference, error) {
 	return alltransports.ParseImageName(d.referenceName)
 }
 
 func (d *Destination) ReferenceMultiArch(
-	os, osVersion, arch, variant, sha256sum string,
+	os, osVersion, arch, variant, encodedDigest string,
 ) (imagetypes.ImageReference, error) {
-	refName := d.ReferenceNameMultiArch(os, osVersion, arch, variant, sha256sum)
+	refName := d.ReferenceNameMultiArch(os, osVersion, arch, variant, encodedDigest)
 	return alltransports.ParseImageName(refName)
 }
 
@@ -258,6 +355,25 @@ func (d *Destination) initReferenceName() error {
 
 func (d *Destination) initManifest(ctx context.Context) error {
 	var err error
+	if d.imageType == types.TypeDocker {
+		var exists bool
+		client := extension.For(ctx, d.systemCtx, d.registry)
+		if d.proxy {
+			// The manifest of the pull-through proxy may be fetched from
+			// the upstream, only trust the locally cached content.
+			exists, err = d.proxyCached(ctx, client, d.tag)
+		} else {
+			// Use the search extension for faster existence check if the
+			// registry supports it (zot).
+			exists, err = client.TagExists(ctx, d.project+"/"+d.name, d.tag)
+		}
+		switch {
+		case err != nil && d.proxy:
+			return err
+		case err == nil && !exists:
+			return nil
+		}
+	}
 	inspector, err := manifest.NewInspector(ctx, &manifest.InspectorOption{
 		ReferenceName: d.referenceName,
 		SystemContext: d.systemCtx,
@@ -286,6 +402,11 @@ func (d *Destination) initManifest(ctx context.Context) error {
 			return err
 		}
 		d.schema2List = s2list
+		for _, m := range s2list.Manifests {
+			if err := d.recordCached(ctx, m.Digest); err != nil {
+				return err
+			}
+		}
 	// OCI image list
 	case imgspecv1.MediaTypeImageIndex:
 		ociIndex := &imgspecv1.Index{}
@@ -294,11 +415,55 @@ func (d *Destination) initManifest(ctx context.Context) error {
 			return fmt.Errorf("initManifest: %w", err)
 		}
 		d.ociIndex = ociIndex
+		for _, m := range ociIndex.Manifests {
+			if err := d.recordCached(ctx, m.Digest); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
+// proxyCached checks whether the manifest of the reference is stored
+// locally on the pull-through proxy cache.
+func (d *Destination) proxyCached(
+	ctx context.Context, client *extension.Client, reference string,
+) (bool, error) {
+	cached, err := client.Cached(ctx, d.project+"/"+d.name, reference)
+	switch {
+	case errors.Is(err, extension.ErrNotSupported):
+		return false, fmt.Errorf("registry %q: %w", d.registry, ErrProxyCacheUnsupported)
+	case err != nil:
+		return false, fmt.Errorf("failed to look up proxy cache of [%v]: %w",
+			d.ReferenceNameWithoutTransport(), err)
+	}
+	return cached, nil
+}
+
+// recordCached records the platform manifest digest if it is stored
+// locally on the pull-through proxy cache.
+func (d *Destination) recordCached(ctx context.Context, dgst digest.Digest) error {
+	if !d.proxy {
+		return nil
+	}
+	cached, err := d.proxyCached(ctx, extension.For(ctx, d.systemCtx, d.registry), dgst.String())
+	if err != nil {
+		return err
+	}
+	if d.cached == nil {
+		d.cached = map[digest.Digest]bool{}
+	}
+	d.cached[dgst] = cached
+	return nil
+}
+
+// trusted returns false if the destination is a pull-through proxy cache
+// and the platform manifest is not stored locally.
+func (d *Destination) trusted(dgst digest.Digest) bool {
+	return !d.proxy || d.cached[dgst]
+}
+
 func newDestinationFromDir(o *Option) (*Destination, error) {
 	if o.Type != types.TypeDir {
 		return nil, types.ErrInvalidType
@@ -338,6 +503,7 @@ func newDestinationFromDocker(o *Option) (*Destination, error) {
 		name:      o.Name,
 		tag:       o.Tag,
 		systemCtx: o.SystemContext,
+		proxy:     o.Proxy,
 	}
 	if d.tag == "" {
 		d.tag = "latest"
@@ -388,6 +554,9 @@ func (d *Destination) ImageBySet(set map[string]map[string]bool) *archive.Image
 	case imagemanifest.DockerV2ListMediaType:
 		for _, m := range d.schema2List.Manifests {
 			p := &m.Platform
+			if !d.trusted(m.Digest) {
+				continue
+			}
 			if len(set["arch"]) != 0 && !set["arch"][p.Architecture] {
 				continue
 			}
@@ -397,12 +566,18 @@ func (d *Destination) ImageBySet(set map[string]map[string]bool) *archive.Image
 			archSet[p.Architecture] = true
 			osSet[p.OS] = true
 			image.Images = append(image.Images, archive.ImageSpec{
-				Digest: m.Digest,
+				Arch:    p.Architecture,
+				OS:      p.OS,
+				Variant: p.Variant,
+				Digest:  m.Digest,
 			})
 		}
 	case imgspecv1.MediaTypeImageIndex:
 		for _, m := range d.ociIndex.Manifests {
 			p := m.Platform
+			if !d.trusted(m.Digest) {
+				continue
+			}
 			if len(set["arch"]) != 0 && !set["arch"][p.Architecture] {
 				continue
 			}
@@ -412,7 +587,12 @@ func (d *Destination) ImageBySet(set map[string]map[string]bool) *archive.Image
 			archSet[p.Architecture] = true
 			osSet[p.OS] = true
 			image.Images = append(image.Images, archive.ImageSpec{
-				Digest: m.Digest,
+				Arch:    p.Architecture,
+				OS:      p.OS,
+				Variant: p.Variant,
+				Digest:  m.Digest,
+				SourceDigest: digest.Digest(
+					m.Annotations[manifest.AnnotationSourceDigest]),
 			})
 		}
 	}
@@ -425,6 +605,15 @@ func (d *Destination) ImageBySet(set map[string]map[string]bool) *archive.Image
 	return image
 }
 
+// Annotations returns the annotations of the destination OCI image index,
+// returns nil if the destination image does not exist or is not OCI index.
+func (d *Destination) Annotations() map[string]string {
+	if d.ociIndex == nil {
+		return nil
+	}
+	return d.ociIndex.Annotations
+}
+
 func (d *Destination) ManifestImages() manifest.Images {
 	var mis manifest.Images
 	switch d.mime {
@@ -443,6 +632,7 @@ func (d *Destination) ManifestImages() manifest.Images {
 	case imgspecv1.MediaTypeImageIndex:
 		for _, m := range d.ociIndex.Manifests {
 			mi := manifest.NewImage(m.Digest, m.MediaType, m.Size)
+			mi.Annotations = m.Annotations
 			mi.UpdatePlatform(
 				m.Platform.Architecture,
 				m.Platform.Variant,
@@ -456,6 +646,11 @@ func (d *Destination) ManifestImages() manifest.Images {
 	return mis
 }
 
+// HaveDigest returns true if the destination manifest list already has
+// the image digest, or the image copied from the source digest but the
+// manifest was rewritten by the destination registry on push.
+// Only the manifests stored locally are checked if the destination is a
+// pull-through proxy cache.
 func (d *Destination) HaveDigest(imageDigest digest.Digest) bool {
 	if d.mime == "" || imageDigest == "" {
 		return false
@@ -464,13 +659,51 @@ func (d *Destination) HaveDigest(imageDigest digest.Digest) bool {
 	switch d.mime {
 	case imagemanifest.DockerV2ListMediaType:
 		for _, m := range d.schema2List.Manifests {
-			if m.Digest == imageDigest {
+			if m.Digest == imageDigest && d.trusted(m.Digest) {
+				return true
+			}
+		}
+	case imgspecv1.MediaTypeImageIndex:
+		for _, m := range d.ociIndex.Manifests {
+			if !d.trusted(m.Digest) {
+				continue
+			}
+			if m.Digest == imageDigest ||
+				m.Annotations[manifest.AnnotationSourceDigest] == imageDigest.String() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HavePlatform returns true if the destination manifest list already has
+// the image of the platform (os/arch/variant), the empty variants are
+// normalized by the variant rules.
+func (d *Destination) HavePlatform(os, arch, variant string) bool {
+	if d.mime == "" {
+		return false
+	}
+	platform := d.variantRules.Platform(os, arch, variant)
+
+	switch d.mime {
+	case imagemanifest.DockerV2ListMediaType:
+		for _, m := range d.schema2List.Manifests {
+			p := &m.Platform
+			if !d.trusted(m.Digest) {
+				continue
+			}
+			if d.variantRules.Platform(p.OS, p.Architecture, p.Variant) == platform {
 				return true
 			}
 		}
 	case imgspecv1.MediaTypeImageIndex:
 		for _, m := range d.ociIndex.Manifests {
-			if m.Digest == imageDigest {
+			p := m.Platform
+			if p == nil || !d.trusted(m.Digest) {
+				continue
+			}
+			if d.variantRules.Platform(p.OS, p.Architecture, p.Variant) == platform {
 				return true
 			}
 		}
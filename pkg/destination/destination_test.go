@@ -0,0 +1,120 @@
+package destination
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/types"
+	imagetypes "github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testAmd64Digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	testArm64Digest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	testIndex       = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` +
+		`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + testAmd64Digest + `","size":100,` +
+		`"platform":{"architecture":"amd64","os":"linux"}},` +
+		`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + testArm64Digest + `","size":100,` +
+		`"platform":{"architecture":"arm64","os":"linux","variant":"v8"}}]}`
+)
+
+// newTestProxyDestination creates the proxy destination of the fake
+// registry served by the handler, the registry API requests not handled
+// by the handler are served as the registry with the testIndex.
+func newTestProxyDestination(t *testing.T, handler http.HandlerFunc) *Destination {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/":
+		case r.URL.Path == "/v2/proxy/nginx/manifests/1.25":
+			w.Header().Set("Content-Type", imgspecv1.MediaTypeImageIndex)
+			w.Write([]byte(testIndex))
+		default:
+			handler(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	d, err := NewDestination(&Option{
+		Type:     types.TypeDocker,
+		Registry: strings.TrimPrefix(server.URL, "https://"),
+		Project:  "proxy",
+		Name:     "nginx",
+		Tag:      "1.25",
+		Proxy:    true,
+		SystemContext: &imagetypes.SystemContext{
+			DockerInsecureSkipTLSVerify: imagetypes.OptionalBoolTrue,
+		},
+	})
+	assert.Nil(t, err)
+	return d
+}
+
+func Test_Destination_Proxy(t *testing.T) {
+	t.Run("harbor cached", func(t *testing.T) {
+		d := newTestProxyDestination(t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v2.0/systeminfo":
+				w.Write([]byte(`{"harbor_version":"v2.10.0"}`))
+			case "/api/v2.0/projects/proxy/repositories/nginx/artifacts/1.25",
+				"/api/v2.0/projects/proxy/repositories/nginx/artifacts/" + testAmd64Digest:
+				w.Write([]byte(`{}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+		assert.Nil(t, d.Init(context.TODO()))
+		assert.True(t, d.Exists())
+		// The arm64 image is not cached locally.
+		assert.True(t, d.HaveDigest(testAmd64Digest))
+		assert.False(t, d.HaveDigest(testArm64Digest))
+		assert.True(t, d.HavePlatform("linux", "amd64", ""))
+		assert.False(t, d.HavePlatform("linux", "arm64", "v8"))
+		images := d.ImageBySet(nil).Images
+		assert.Len(t, images, 1)
+		assert.Equal(t, digest.Digest(testAmd64Digest), images[0].Digest)
+	})
+
+	t.Run("harbor not cached", func(t *testing.T) {
+		d := newTestProxyDestination(t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v2.0/systeminfo":
+				w.Write([]byte(`{"harbor_version":"v2.10.0"}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+		assert.Nil(t, d.Init(context.TODO()))
+		assert.False(t, d.Exists())
+		assert.False(t, d.HaveDigest(testAmd64Digest))
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		d := newTestProxyDestination(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+		err := d.Init(context.TODO())
+		assert.ErrorIs(t, err, ErrProxyCacheUnsupported)
+		assert.False(t, d.Exists())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		d := newTestProxyDestination(t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v2.0/systeminfo":
+				w.Write([]byte(`{"harbor_version":"v2.10.0"}`))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		})
+		err := d.Init(context.TODO())
+		assert.NotNil(t, err)
+		assert.NotErrorIs(t, err, ErrProxyCacheUnsupported)
+		assert.False(t, d.Exists())
+	})
+}
@@ -0,0 +1,136 @@
+package destination
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// RewriteRule rewrites the source repository ('REGISTRY/PROJECT/NAME') into
+// the destination repository by the prefix or the regular expression, the
+// rewritten repository replaces the destination registry, project and name.
+//
+//	Example:
+//		# Map the images of docker.io/library to the proxy project.
+//		- prefix: docker.io/library/*
+//		  replace: harbor.example.io/dockerhub-proxy/*
+//		# Flatten the nested projects.
+//		- regex: ^([^/]+)/([^/]+)/.+/([^/]+)$
+//		  replace: harbor.example.io/$2/$3
+//		# Add the suffix to the image name.
+//		- regex: ^quay\.io/(.+)$
+//		  replace: harbor.example.io/${1}-mirrored
+type RewriteRule struct {
+	// Prefix is the source repository prefix to be replaced, the trailing '*'
+	// is optional.
+	Prefix string `json:"prefix,omitempty"`
+	// Regex is the regular expression of the source repository, the sub matches
+	// are expanded in the replace string ('$1', '${name}').
+	Regex string `json:"regex,omitempty"`
+	// Replace is the replacement of the matched prefix or repository.
+	Replace string `json:"replace"`
+
+	regex *regexp.Regexp
+}
+
+// RewriteRules is the rewrite rules of the source repositories, the first
+// matched rule is applied.
+type RewriteRules []RewriteRule
+
+// LoadRewriteRules reads the rewrite rules from the YAML file.
+func LoadRewriteRules(file string) (RewriteRules, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rewrite rules: %w", err)
+	}
+	var rules RewriteRules
+	if err := yaml.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode rewrite rules %q: %w", file, err)
+	}
+	if err := rules.compile(); err != nil {
+		return nil, fmt.Errorf("invalid rewrite rules %q: %w", file, err)
+	}
+	return rules, nil
+}
+
+func (rules RewriteRules) compile() error {
+	for i := range rules {
+		r := &rules[i]
+		switch {
+		case r.Prefix != "" && r.Regex != "":
+			return fmt.Errorf("rule %d: prefix and regex are mutually exclusive", i+1)
+		case r.Prefix != "":
+			r.Prefix = strings.TrimSuffix(r.Prefix, "*")
+			r.Replace = strings.TrimSuffix(r.Replace, "*")
+		case r.Regex != "":
+			re, err := regexp.Compile(r.Regex)
+			if err != nil {
+				return fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			r.regex = re
+		default:
+			return fmt.Errorf("rule %d: prefix or regex not specified", i+1)
+		}
+	}
+	return nil
+}
+
+// Rewrite returns the repository rewritten by the first matched rule,
+// returns false if no rule matched.
+func (rules RewriteRules) Rewrite(repository string) (string, bool) {
+	for _, r := range rules {
+		switch {
+		case r.regex != nil:
+			if !r.regex.MatchString(repository) {
+				continue
+			}
+			return r.regex.ReplaceAllString(repository, r.Replace), true
+		case r.Prefix != "":
+			if !strings.HasPrefix(repository, r.Prefix) {
+				continue
+			}
+			return r.Replace + strings.TrimPrefix(repository, r.Prefix), true
+		}
+	}
+	return repository, false
+}
+
+// Apply returns the destination registry, project and name rewritten from
+// the source repository by the first matched rule, the rewritten
+// repository should have the registry and at least one path component.
+// Returns false if no rule matched.
+func (rules RewriteRules) Apply(source string) (registry, project, name string, ok bool, err error) {
+	rewritten, ok := rules.Rewrite(source)
+	if !ok {
+		return "", "", "", false, nil
+	}
+	v := strings.SplitN(strings.Trim(rewritten, "/"), "/", 3)
+	switch len(v) {
+	case 2:
+		registry, project, name = v[0], "library", v[1]
+	case 3:
+		registry, project, name = v[0], v[1], v[2]
+	}
+	if registry == "" || project == "" || name == "" {
+		return "", "", "", false, fmt.Errorf(
+			"invalid repository %q rewritten from %q", rewritten, source)
+	}
+	return registry, project, name, true, nil
+}
+
+// rewrite applies the rewrite rules to the source repository and replaces
+// the registry, project and name of the destination by the rewritten one.
+func (d *Destination) rewrite(rules RewriteRules, source string) error {
+	if len(rules) == 0 || source == "" {
+		return nil
+	}
+	registry, project, name, ok, err := rules.Apply(source)
+	if err != nil || !ok {
+		return err
+	}
+	d.registry, d.project, d.name = registry, project, name
+	return nil
+}
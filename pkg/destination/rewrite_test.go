@@ -0,0 +1,122 @@
+package destination
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RewriteRules_Apply(t *testing.T) {
+	rules := RewriteRules{
+		{Prefix: "docker.io/library/*", Replace: "harbor.example.io/dockerhub-proxy/*"},
+		{Prefix: "gcr.io/", Replace: "harbor.example.io/"},
+		{Regex: `^([^/]+)/([^/]+)/.+/([^/]+)$`, Replace: "harbor.example.io/$2/$3"},
+		{Regex: `^quay\.io/[^/]+/(.+)$`, Replace: "harbor.example.io/${1}-mirrored"},
+		{Prefix: "ghcr.io/", Replace: "harbor.example.io"},
+	}
+	assert.Nil(t, rules.compile())
+
+	for _, c := range []struct {
+		source   string
+		registry string
+		project  string
+		name     string
+		ok       bool
+		err      bool
+	}{
+		// prefix rule
+		{"docker.io/library/nginx", "harbor.example.io", "dockerhub-proxy", "nginx", true, false},
+		{"gcr.io/distroless/static", "harbor.example.io", "distroless", "static", true, false},
+		// regex rule, 3-part result
+		{"registry.k8s.io/sig-storage/nested/csi-provisioner", "harbor.example.io", "sig-storage", "csi-provisioner", true, false},
+		// regex rule, 2-part result
+		{"quay.io/coreos/etcd", "harbor.example.io", "library", "etcd-mirrored", true, false},
+		// 1-part result
+		{"ghcr.io/name", "", "", "", false, true},
+		// no rule matched
+		{"docker.io/rancher/rancher", "", "", "", false, false},
+	} {
+		registry, project, name, ok, err := rules.Apply(c.source)
+		if c.err {
+			assert.Error(t, err, c.source)
+			continue
+		}
+		assert.Nil(t, err, c.source)
+		assert.Equal(t, c.ok, ok, c.source)
+		assert.Equal(t, c.registry, registry, c.source)
+		assert.Equal(t, c.project, project, c.source)
+		assert.Equal(t, c.name, name, c.source)
+	}
+}
+
+func Test_RewriteRules_compile(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		rules RewriteRules
+		err   bool
+	}{
+		{"prefix", RewriteRules{{Prefix: "docker.io/", Replace: "harbor.example.io/"}}, false},
+		{"regex", RewriteRules{{Regex: "^(.+)$", Replace: "harbor.example.io/$1"}}, false},
+		{"prefix and regex", RewriteRules{{Prefix: "docker.io/", Regex: "^(.+)$"}}, true},
+		{"empty", RewriteRules{{Replace: "harbor.example.io/"}}, true},
+		{"invalid regex", RewriteRules{{Regex: "^(.+$", Replace: "$1"}}, true},
+	} {
+		err := c.rules.compile()
+		if c.err {
+			assert.Error(t, err, c.name)
+		} else {
+			assert.Nil(t, err, c.name)
+		}
+	}
+}
+
+func Test_LoadRewriteRules(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "rules.yaml")
+	assert.Nil(t, os.WriteFile(file, []byte(
+		"- prefix: docker.io/library/*\n  replace: harbor.example.io/dockerhub-proxy/*\n"), 0644))
+	rules, err := LoadRewriteRules(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "docker.io/library/", rules[0].Prefix)
+
+	assert.Nil(t, os.WriteFile(file, []byte("- regex: \"^(.+$\"\n  replace: $1\n"), 0644))
+	_, err = LoadRewriteRules(file)
+	assert.Error(t, err)
+	_, err = LoadRewriteRules(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func Test_NewDestination_Rewrite(t *testing.T) {
+	rules := RewriteRules{
+		{Prefix: "docker.io/library/*", Replace: "harbor.example.io/dockerhub-proxy/*"},
+	}
+	assert.Nil(t, rules.compile())
+
+	// The rule matches the source repository but not the destination.
+	d, err := NewDestination(&Option{
+		Type:             types.TypeDocker,
+		Registry:         "registry.example.io",
+		Project:          "library",
+		Name:             "nginx",
+		Tag:              "1.25",
+		RewriteRules:     rules,
+		SourceRepository: "docker.io/library/nginx",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "harbor.example.io/dockerhub-proxy/nginx:1.25", d.ReferenceNameWithoutTransport())
+
+	// The destination defaults to docker.io but the source is not matched.
+	d, err = NewDestination(&Option{
+		Type:             types.TypeDocker,
+		Project:          "rancher",
+		Name:             "rancher",
+		Tag:              "v2.9.0",
+		RewriteRules:     rules,
+		SourceRepository: "docker.io/rancher/rancher",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "docker.io/rancher/rancher:v2.9.0", d.ReferenceNameWithoutTransport())
+}
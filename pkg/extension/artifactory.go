@@ -0,0 +1,114 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	artifactoryAQL   = "/artifactory/api/search/aql"
+	artifactoryScope = "artifactory:api"
+)
+
+// SetArtifactory enables the AQL search of the JFrog Artifactory docker
+// repository of the repository key for the tag existence checks.
+func (c *Client) SetArtifactory(repositoryKey string) {
+	c.mu.Lock()
+	c.artifactoryKey = strings.Trim(repositoryKey, "/")
+	c.mu.Unlock()
+}
+
+// aqlTags returns the tags of the repository by the Artifactory AQL search,
+// the tags are the folders of the repository containing the manifest file.
+// The platform manifests of the indexes are stored in the folders named by
+// the digest, they are recorded as the digests but not the tags.
+// The repository key is trimmed from the repository if the registry is
+// accessed by the repository path method.
+func (c *Client) aqlTags(ctx context.Context, key, repository string) (*tagCache, error) {
+	repository = strings.TrimPrefix(repository, key+"/")
+	query := fmt.Sprintf(`items.find({"repo":%q,"path":{"$match":%q},`+
+		`"name":{"$in":["manifest.json","list.manifest.json"]}}).include("path","name","sha256")`,
+		key, repository+"/*")
+	if err := c.presetArtifactoryAuthorization(); err != nil {
+		return nil, err
+	}
+	resp, err := c.send(ctx, http.MethodPost, artifactoryAQL, artifactoryScope,
+		http.Header{"Content-Type": {"text/plain"}}, []byte(query))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("AQL search %q: %v", repository, resp.Status)
+	}
+	r := struct {
+		Results []struct {
+			Path   string `json:"path"`
+			Name   string `json:"name"`
+			Sha256 string `json:"sha256"`
+		} `json:"results"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("failed to decode AQL search result: %w", err)
+	}
+	cache := &tagCache{
+		tags:    make(map[string]digest.Digest, len(r.Results)),
+		digests: map[digest.Digest]bool{},
+	}
+	for _, i := range r.Results {
+		tag := strings.TrimPrefix(i.Path, repository+"/")
+		if tag == i.Path || strings.Contains(tag, "/") {
+			// The manifest of the nested repository.
+			continue
+		}
+		var d digest.Digest
+		if i.Sha256 != "" {
+			d = digest.NewDigestFromEncoded(digest.SHA256, i.Sha256)
+			cache.digests[d] = true
+		}
+		if strings.HasPrefix(tag, "sha256:") || strings.HasPrefix(tag, "sha256__") {
+			// The folder of the platform manifest.
+			continue
+		}
+		cache.tags[tag] = d
+	}
+	return cache, nil
+}
+
+// presetArtifactoryAuthorization caches the Authorization header of the
+// Artifactory REST API from the registry credential, the access token
+// stored as the password is sent as the bearer token.
+func (c *Client) presetArtifactoryAuthorization() error {
+	auth, err := config.GetCredentials(c.sysCtx, c.registry)
+	if err != nil {
+		return fmt.Errorf("failed to get credential of %q: %w", c.registry, err)
+	}
+	var authorization string
+	switch {
+	case auth.IdentityToken != "":
+		authorization = "Bearer " + auth.IdentityToken
+	case isAccessToken(auth.Password):
+		authorization = "Bearer " + auth.Password
+	case auth.Username != "":
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(auth.Username, auth.Password)
+		authorization = req.Header.Get("Authorization")
+	default:
+		return nil
+	}
+	c.tokens.preset(artifactoryScope, authorization)
+	return nil
+}
+
+// isAccessToken checks whether the secret is the Artifactory access token
+// (JWT) or reference token instead of the password or API key.
+func isAccessToken(secret string) bool {
+	// The JWT header and the base64 encoded 'reftkn' prefix.
+	return strings.HasPrefix(secret, "eyJ") || strings.HasPrefix(secret, "cmVmdGtu")
+}
@@ -0,0 +1,29 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Blob fetches the blob of the repository, the returned size is -1 if
+// the registry did not send the content length. The redirected blob
+// storage is followed by the HTTP client without the registry token.
+func (c *Client) Blob(ctx context.Context, repository string, dgst digest.Digest) (io.ReadCloser, int64, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, 0, fmt.Errorf("invalid digest %q: %w", dgst, err)
+	}
+	p := fmt.Sprintf("/v2/%s/blobs/%s", repository, dgst)
+	resp, err := c.send(ctx, http.MethodGet, p, Scope(http.MethodGet, p), nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("GET %s: %v", p, resp.Status)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
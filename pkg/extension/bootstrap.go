@@ -0,0 +1,126 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// BootstrapTag is the tag of the placeholder image pushed to initialize
+// the new repository.
+const BootstrapTag = "hangar-bootstrap"
+
+// bootstrapConfig is the config of the placeholder image without layers.
+var bootstrapConfig = []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+
+// RepositoryExists checks whether the repository has any tag by the
+// distribution tags list API.
+func (c *Client) RepositoryExists(ctx context.Context, repository string) (bool, error) {
+	p := fmt.Sprintf("/v2/%s/tags/list?n=1", repository)
+	resp, err := c.get(ctx, p, fmt.Sprintf("repository:%s:pull", repository), "application/json")
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("GET %s: %v", p, resp.Status)
+	}
+	r := struct {
+		Tags []string `json:"tags"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return false, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return len(r.Tags) > 0, nil
+}
+
+// Bootstrap pushes the placeholder image (the image config without
+// layers) with the BootstrapTag into the repository, for the registries
+// rejecting the manifest-only pushes into the repositories not exist.
+func (c *Client) Bootstrap(ctx context.Context, repository string) error {
+	config := imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageConfig,
+		Digest:    digest.FromBytes(bootstrapConfig),
+		Size:      int64(len(bootstrapConfig)),
+	}
+	if err := c.pushBlob(ctx, repository, config.Digest, bootstrapConfig); err != nil {
+		return err
+	}
+	b, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []imgspecv1.Descriptor{},
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(ctx, http.MethodPut,
+		fmt.Sprintf("/v2/%s/manifests/%s", repository, BootstrapTag),
+		http.Header{"Content-Type": {imgspecv1.MediaTypeImageManifest}}, b)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to push bootstrap manifest %s:%s: %v",
+			repository, BootstrapTag, resp.Status)
+	}
+	return nil
+}
+
+// pushBlob uploads the blob into the repository by the monolithic upload
+// (POST then PUT), the existing blob is not uploaded again.
+func (c *Client) pushBlob(
+	ctx context.Context, repository string, dgst digest.Digest, data []byte,
+) error {
+	if ok, err := c.BlobExists(ctx, repository, dgst); err == nil && ok {
+		return nil
+	}
+	p := fmt.Sprintf("/v2/%s/blobs/uploads/", repository)
+	resp, err := c.Do(ctx, http.MethodPost, p, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("POST %s: %v", p, resp.Status)
+	}
+	location, err := uploadLocation(resp.Header.Get("Location"), dgst)
+	if err != nil {
+		return err
+	}
+	resp, err = c.send(ctx, http.MethodPut, location, Scope(http.MethodPost, p),
+		http.Header{"Content-Type": {"application/octet-stream"}}, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to upload blob %v: %v", dgst, resp.Status)
+	}
+	return nil
+}
+
+// uploadLocation returns the path of the upload session location with the
+// digest query, the location is either absolute URL or absolute path.
+func uploadLocation(location string, dgst digest.Digest) (string, error) {
+	u, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(u.Path, "/v2/") {
+		return "", fmt.Errorf("invalid upload location %q", location)
+	}
+	q := u.Query()
+	q.Set("digest", dgst.String())
+	return u.Path + "?" + q.Encode(), nil
+}
@@ -0,0 +1,126 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	harborSystemInfo = "/api/v2.0/systeminfo"
+	harborScope      = "harbor:api"
+)
+
+// Cached checks whether the manifest of the reference (tag or digest) is
+// stored locally on the pull-through proxy cache registry, the lookup
+// never fetches the manifest from the upstream registry.
+//
+// The artifact API is used on Harbor (proxy cache projects), the zot search
+// extension and the Artifactory AQL search are used on zot and Artifactory.
+// Returns ErrNotSupported if the registry has no local cache lookup.
+func (c *Client) Cached(ctx context.Context, repository, reference string) (bool, error) {
+	harbor, err := c.detectHarbor(ctx)
+	if err != nil {
+		return false, err
+	}
+	if harbor {
+		return c.harborArtifactExists(ctx, repository, reference)
+	}
+	cache, err := c.search(ctx, repository)
+	if err != nil {
+		return false, err
+	}
+	if d, err := digest.Parse(reference); err == nil {
+		return cache.digests[d], nil
+	}
+	_, ok := cache.tags[reference]
+	return ok, nil
+}
+
+// detectHarbor detects whether the registry is Harbor by the system info
+// API, which is accessible without authentication.
+func (c *Client) detectHarbor(ctx context.Context) (bool, error) {
+	c.mu.Lock()
+	detected, harbor := c.harborDetected, c.harbor
+	c.mu.Unlock()
+	if detected {
+		return harbor, nil
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, harborSystemInfo,
+		http.Header{"Accept": {"application/json"}}, "", nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		info := struct {
+			HarborVersion string `json:"harbor_version"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&info); err == nil {
+			harbor = info.HarborVersion != ""
+		}
+	case resp.StatusCode >= http.StatusInternalServerError:
+		// Do not cache the result of the server error.
+		return false, fmt.Errorf("GET %s: %v", harborSystemInfo, resp.Status)
+	}
+	c.mu.Lock()
+	c.harborDetected, c.harbor = true, harbor
+	c.mu.Unlock()
+	logrus.Debugf("registry %q is Harbor: %v", c.registry, harbor)
+	return harbor, nil
+}
+
+// harborArtifactExists checks whether the artifact of the reference exists
+// in the Harbor project by the artifact API. The artifacts of the proxy
+// cache project are only recorded after they were cached locally.
+func (c *Client) harborArtifactExists(ctx context.Context, repository, reference string) (bool, error) {
+	project, name, ok := strings.Cut(repository, "/")
+	if !ok {
+		return false, fmt.Errorf("invalid Harbor repository %q", repository)
+	}
+	if err := c.presetHarborAuthorization(); err != nil {
+		return false, err
+	}
+	// The repository name is double encoded by the Harbor API.
+	p := fmt.Sprintf("/api/v2.0/projects/%s/repositories/%s/artifacts/%s",
+		url.PathEscape(project), url.PathEscape(url.PathEscape(name)),
+		url.PathEscape(reference))
+	resp, err := c.send(ctx, http.MethodGet, p, harborScope,
+		http.Header{"Accept": {"application/json"}}, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("artifact %s:%s: %v", repository, reference, resp.Status)
+}
+
+// presetHarborAuthorization caches the basic Authorization header of the
+// Harbor API from the registry credential (user or robot account).
+func (c *Client) presetHarborAuthorization() error {
+	auth, err := config.GetCredentials(c.sysCtx, c.registry)
+	if err != nil {
+		return fmt.Errorf("failed to get credential of %q: %w", c.registry, err)
+	}
+	if auth.Username == "" {
+		return nil
+	}
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth(auth.Username, auth.Password)
+	c.tokens.preset(harborScope, req.Header.Get("Authorization"))
+	return nil
+}
@@ -0,0 +1,48 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// manifestAccept is the Accept header of the manifest HEAD requests.
+var manifestAccept = strings.Join([]string{
+	imgspecv1.MediaTypeImageManifest,
+	imgspecv1.MediaTypeImageIndex,
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v1+prettyjws",
+}, ", ")
+
+// BlobExists checks whether the blob exists in the repository by the
+// HEAD request.
+func (c *Client) BlobExists(ctx context.Context, repository string, dgst digest.Digest) (bool, error) {
+	return c.head(ctx, fmt.Sprintf("/v2/%s/blobs/%s", repository, dgst), nil)
+}
+
+// ManifestExists checks whether the manifest of the digest exists in the
+// repository by the HEAD request.
+func (c *Client) ManifestExists(ctx context.Context, repository string, dgst digest.Digest) (bool, error) {
+	return c.head(ctx, fmt.Sprintf("/v2/%s/manifests/%s", repository, dgst),
+		http.Header{"Accept": {manifestAccept}})
+}
+
+func (c *Client) head(ctx context.Context, p string, header http.Header) (bool, error) {
+	resp, err := c.send(ctx, http.MethodHead, p, Scope(http.MethodHead, p), header, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("HEAD %s: %v", p, resp.Status)
+}
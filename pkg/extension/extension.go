@@ -0,0 +1,578 @@
+// Package extension implements the client of the registry extension APIs
+// (OCI distribution extensions, zot search, Artifactory AQL search and the
+// OCI referrers API).
+// The capabilities of the registry are detected automatically and cached,
+// callers fall back to the standard distribution API if the extension is
+// not supported.
+package extension
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/credential"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNotSupported = errors.New("registry extension not supported")
+)
+
+const (
+	discoverPath = "/v2/_oci/ext/discover"
+	zotSearch    = "/_zot/ext/search"
+
+	// tagCacheTTL is the expiration time of the cached repository tags.
+	tagCacheTTL = time.Minute
+)
+
+// Capabilities is the extension APIs supported by the registry.
+type Capabilities struct {
+	// Extensions is the extension names returned by the discover API.
+	Extensions []string `json:"extensions,omitempty"`
+	// Search is true if the zot search extension is supported.
+	Search bool `json:"search"`
+	// Referrers is true if the OCI referrers API is supported,
+	// it is detected after the first referrers request.
+	Referrers bool `json:"referrers"`
+}
+
+// Client is the extension API client of the registry.
+type Client struct {
+	registry string
+	endpoint string
+	sysCtx   *types.SystemContext
+	client   *http.Client
+	insecure bool
+
+	mu           sync.Mutex
+	capabilities Capabilities
+	// referrersDetected is true if the referrers API support was detected.
+	referrersDetected bool
+	// tokens is the cached Authorization header of the scopes shared by
+	// the clients of the registry.
+	tokens *tokenCache
+	tags   map[string]*tagCache
+	// artifactoryKey is the docker repository key of the Artifactory
+	// registry to search tags by AQL.
+	artifactoryKey string
+	// harborDetected is true if the Harbor API support was detected.
+	harborDetected bool
+	harbor         bool
+}
+
+type tagCache struct {
+	tags map[string]digest.Digest
+	// digests is the manifest digests stored in the repository, including
+	// the platform manifests of the indexes.
+	digests map[digest.Digest]bool
+	expires time.Time
+}
+
+// clients caches the detected client of the registry and credential.
+var clients sync.Map
+
+// For returns the cached extension client of the registry and the
+// credential of the system context, the capabilities are detected when the
+// client is created.
+func For(ctx context.Context, sysCtx *types.SystemContext, registry string) *Client {
+	key := registry + "#" + credentialIdentity(sysCtx, registry)
+	if c, ok := clients.Load(key); ok {
+		return c.(*Client)
+	}
+	c := newClient(sysCtx, registry)
+	c.detect(ctx)
+	if ctx.Err() != nil {
+		// Do not cache the result if the detection was canceled.
+		return c
+	}
+	v, _ := clients.LoadOrStore(key, c)
+	return v.(*Client)
+}
+
+// NewClient returns the client of the registry without detecting the
+// capabilities, used for sending the raw registry API requests.
+// The HTTP connections are shared with other clients of the registry, the
+// tokens are shared with the clients using the same credential.
+func NewClient(sysCtx *types.SystemContext, registry string) *Client {
+	return newClient(sysCtx, registry)
+}
+
+// NewStreamClient returns the client of the registry like NewClient, but
+// the requests are not limited by the total timeout, used for streaming
+// the blobs which may take longer than the timeout of the API requests.
+func NewStreamClient(sysCtx *types.SystemContext, registry string) *Client {
+	c := newClient(sysCtx, registry)
+	c.client = sharedStreamClient(registry, c.insecure)
+	return c
+}
+
+func newClient(sysCtx *types.SystemContext, registry string) *Client {
+	insecure := utils.InsecureRegistry(sysCtx, registry)
+	server := registry
+	if server == utils.DockerHubRegistry {
+		server = "registry-1.docker.io"
+	}
+	return &Client{
+		registry: registry,
+		endpoint: "https://" + server,
+		sysCtx:   sysCtx,
+		insecure: insecure,
+		client:   sharedHTTPClient(registry, insecure),
+		tokens:   sharedTokenCache(registry, credentialIdentity(sysCtx, registry)),
+		tags:     map[string]*tagCache{},
+	}
+}
+
+// Capabilities returns the detected extension capabilities.
+func (c *Client) Capabilities() Capabilities {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.capabilities
+}
+
+// detect detects the extensions by the OCI distribution extensions
+// discover API.
+func (c *Client) detect(ctx context.Context) {
+	if c.registry == utils.DockerHubRegistry {
+		// Docker Hub does not support the extensions API.
+		return
+	}
+	resp, err := c.get(ctx, discoverPath, "", "application/json")
+	if err != nil {
+		logrus.Debugf("registry %q extension discover: %v", c.registry, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logrus.Debugf("registry %q extension discover: %v", c.registry, resp.Status)
+		return
+	}
+	d := struct {
+		Extensions []struct {
+			Name      string   `json:"name"`
+			Endpoints []string `json:"endpoints"`
+		} `json:"extensions"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		logrus.Debugf("registry %q extension discover: %v", c.registry, err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range d.Extensions {
+		c.capabilities.Extensions = append(c.capabilities.Extensions, e.Name)
+		for _, p := range e.Endpoints {
+			if strings.HasSuffix(p, zotSearch) {
+				c.capabilities.Search = true
+			}
+		}
+	}
+	logrus.Debugf("registry %q extensions: %v", c.registry, c.capabilities.Extensions)
+}
+
+// Tags returns the tags and manifest digests of the repository by the
+// zot search extension or the Artifactory AQL search, the result is
+// cached for a short time.
+func (c *Client) Tags(ctx context.Context, repository string) (map[string]digest.Digest, error) {
+	cache, err := c.search(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+	return cache.tags, nil
+}
+
+// search returns the cached search result of the repository, the
+// repository is searched again if the cache expired.
+func (c *Client) search(ctx context.Context, repository string) (*tagCache, error) {
+	c.mu.Lock()
+	search, key := c.capabilities.Search, c.artifactoryKey
+	cache := c.tags[repository]
+	c.mu.Unlock()
+	if !search && key == "" {
+		return nil, ErrNotSupported
+	}
+	if cache != nil && time.Now().Before(cache.expires) {
+		return cache, nil
+	}
+
+	var err error
+	if search {
+		cache, err = c.searchTags(ctx, repository)
+	} else {
+		cache, err = c.aqlTags(ctx, key, repository)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cache.expires = time.Now().Add(tagCacheTTL)
+	c.mu.Lock()
+	c.tags[repository] = cache
+	c.mu.Unlock()
+	return cache, nil
+}
+
+// searchTags returns the tags and the manifest digests of the repository
+// by the zot search extension.
+func (c *Client) searchTags(ctx context.Context, repository string) (*tagCache, error) {
+	q := url.Values{}
+	q.Set("query", fmt.Sprintf(
+		`{ImageList(repo:%q){Results{Tag Digest Manifests{Digest}}}}`, repository))
+	resp, err := c.get(ctx, "/v2"+zotSearch+"?"+q.Encode(),
+		fmt.Sprintf("repository:%s:pull", repository), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("search %q: %v", repository, resp.Status)
+	}
+	r := struct {
+		Data struct {
+			ImageList struct {
+				Results []struct {
+					Tag       string `json:"Tag"`
+					Digest    string `json:"Digest"`
+					Manifests []struct {
+						Digest string `json:"Digest"`
+					} `json:"Manifests"`
+				} `json:"Results"`
+			} `json:"ImageList"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("failed to decode search result: %w", err)
+	}
+	if len(r.Errors) != 0 && len(r.Data.ImageList.Results) == 0 {
+		// The repository does not exist.
+		logrus.Debugf("search %q: %v", repository, r.Errors[0].Message)
+	}
+	cache := &tagCache{
+		tags:    make(map[string]digest.Digest, len(r.Data.ImageList.Results)),
+		digests: map[digest.Digest]bool{},
+	}
+	for _, i := range r.Data.ImageList.Results {
+		cache.tags[i.Tag] = digest.Digest(i.Digest)
+		cache.digests[digest.Digest(i.Digest)] = true
+		for _, m := range i.Manifests {
+			cache.digests[digest.Digest(m.Digest)] = true
+		}
+	}
+	return cache, nil
+}
+
+// TagExists checks whether the tag exists in the repository by the search
+// extension, returns ErrNotSupported if the search is not supported.
+func (c *Client) TagExists(ctx context.Context, repository, tag string) (bool, error) {
+	tags, err := c.Tags(ctx, repository)
+	if err != nil {
+		return false, err
+	}
+	_, ok := tags[tag]
+	return ok, nil
+}
+
+// Referrers returns the referrer descriptors of the manifest digest,
+// it uses the OCI referrers API if supported, or falls back to the
+// referrers tag schema (<alg>-<hex>).
+func (c *Client) Referrers(
+	ctx context.Context, repository string, dgst digest.Digest,
+) ([]imgspecv1.Descriptor, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid digest %q: %w", dgst, err)
+	}
+	scope := fmt.Sprintf("repository:%s:pull", repository)
+	c.mu.Lock()
+	detected, supported := c.referrersDetected, c.capabilities.Referrers
+	c.mu.Unlock()
+
+	if !detected || supported {
+		resp, err := c.get(ctx, fmt.Sprintf("/v2/%s/referrers/%s", repository, dgst),
+			scope, imgspecv1.MediaTypeImageIndex)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			c.setReferrers(true)
+			return decodeIndex(resp.Body)
+		case http.StatusNotFound:
+			c.setReferrers(false)
+		default:
+			return nil, fmt.Errorf("referrers of %s@%s: %v", repository, dgst, resp.Status)
+		}
+	}
+
+	// Fallback to the referrers tag schema.
+	tag := referrersTag(dgst)
+	resp, err := c.get(ctx, fmt.Sprintf("/v2/%s/manifests/%s", repository, tag),
+		scope, imgspecv1.MediaTypeImageIndex)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return decodeIndex(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("referrers tag %s:%s: %v", repository, tag, resp.Status)
+}
+
+// AddReferrer adds the referrer descriptor into the referrers tag schema
+// index of the subject manifest digest if the referrers API is not
+// supported, the registry supporting the referrers API indexes the
+// referrers pushed with the subject field automatically.
+func (c *Client) AddReferrer(
+	ctx context.Context, repository string, subject digest.Digest, desc imgspecv1.Descriptor,
+) error {
+	referrers, err := c.Referrers(ctx, repository, subject)
+	if err != nil {
+		return err
+	}
+	if c.Capabilities().Referrers {
+		return nil
+	}
+	for _, r := range referrers {
+		if r.Digest == desc.Digest {
+			return nil
+		}
+	}
+	b, err := json.Marshal(imgspecv1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: append(referrers, desc),
+	})
+	if err != nil {
+		return err
+	}
+	tag := referrersTag(subject)
+	resp, err := c.Do(ctx, http.MethodPut, fmt.Sprintf("/v2/%s/manifests/%s", repository, tag),
+		http.Header{"Content-Type": {imgspecv1.MediaTypeImageIndex}}, b)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to update referrers tag %s:%s: %v", repository, tag, resp.Status)
+	}
+	return nil
+}
+
+// referrersTag returns the tag of the referrers tag schema, e.g.
+// 'sha256-<encoded>'.
+func referrersTag(dgst digest.Digest) string {
+	return fmt.Sprintf("%s-%s", dgst.Algorithm(), dgst.Encoded())
+}
+
+func (c *Client) setReferrers(supported bool) {
+	c.mu.Lock()
+	if !c.referrersDetected {
+		logrus.Debugf("registry %q referrers API supported: %v", c.registry, supported)
+	}
+	c.referrersDetected = true
+	c.capabilities.Referrers = supported
+	c.mu.Unlock()
+}
+
+func decodeIndex(r io.Reader) ([]imgspecv1.Descriptor, error) {
+	index := imgspecv1.Index{}
+	if err := json.NewDecoder(r).Decode(&index); err != nil {
+		return nil, fmt.Errorf("failed to decode referrers index: %w", err)
+	}
+	return index.Manifests, nil
+}
+
+// Do sends the raw registry API request with the authorization of the
+// scope required by the API path, the token is requested automatically
+// by the credential of the registry.
+func (c *Client) Do(
+	ctx context.Context, method, p string, header http.Header, body []byte,
+) (*http.Response, error) {
+	return c.send(ctx, method, p, Scope(method, p), header, body)
+}
+
+// Scope returns the token scope required by the registry API request.
+//
+//	Example:
+//		GET /v2/library/nginx/tags/list => repository:library/nginx:pull
+//		PUT /v2/library/nginx/manifests/latest => repository:library/nginx:pull,push
+//		GET /v2/_catalog => registry:catalog:*
+func Scope(method, p string) string {
+	p, _, _ = strings.Cut(p, "?")
+	p = strings.TrimPrefix(p, "/v2/")
+	if p == "_catalog" {
+		return "registry:catalog:*"
+	}
+	var repository string
+	for _, s := range []string{"/tags/", "/manifests/", "/blobs/", "/referrers/"} {
+		if i := strings.LastIndex(p, s); i > 0 {
+			repository = p[:i]
+			break
+		}
+	}
+	if repository == "" {
+		return ""
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return fmt.Sprintf("repository:%s:pull", repository)
+	case http.MethodDelete:
+		return fmt.Sprintf("repository:%s:delete", repository)
+	default:
+		return fmt.Sprintf("repository:%s:pull,push", repository)
+	}
+}
+
+// get sends the GET request to the registry, the request is retried with
+// the credential if the registry requires authentication.
+func (c *Client) get(ctx context.Context, p, scope, accept string) (*http.Response, error) {
+	return c.send(ctx, http.MethodGet, p, scope, http.Header{"Accept": {accept}}, nil)
+}
+
+func (c *Client) send(
+	ctx context.Context, method, p, scope string, header http.Header, body []byte,
+) (*http.Response, error) {
+	token := c.tokens.scope(scope)
+	authorization := token.get()
+	resp, err := c.do(ctx, method, p, header, authorization, body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	authorization, err = token.refresh(authorization, func() (string, time.Time, error) {
+		return c.authorize(ctx, challenge, scope)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.do(ctx, method, p, header, authorization, body)
+}
+
+func (c *Client) do(
+	ctx context.Context, method, p string, header http.Header, authorization string, body []byte,
+) (*http.Response, error) {
+	c.mu.Lock()
+	endpoint := c.endpoint
+	c.mu.Unlock()
+	resp, err := c.request(ctx, method, endpoint+p, header, authorization, body)
+	if err == nil || !errors.Is(err, http.ErrSchemeMismatch) || !c.insecure {
+		return resp, err
+	}
+	// Fallback to HTTP for the insecure registry.
+	endpoint = "http://" + strings.TrimPrefix(endpoint, "https://")
+	c.mu.Lock()
+	c.endpoint = endpoint
+	c.mu.Unlock()
+	return c.request(ctx, method, endpoint+p, header, authorization, body)
+}
+
+func (c *Client) request(
+	ctx context.Context, method, u string, header http.Header, authorization string, body []byte,
+) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return c.client.Do(req)
+}
+
+// authorize returns the Authorization header of the auth challenge and
+// the time to refresh it, zero if the authorization does not expire.
+func (c *Client) authorize(ctx context.Context, challenge, scope string) (string, time.Time, error) {
+	auth, err := config.GetCredentials(c.sysCtx, c.registry)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get credential of %q: %w", c.registry, err)
+	}
+	scheme, params := credential.ParseChallenge(challenge)
+	switch {
+	case strings.EqualFold(scheme, "basic"):
+		if auth.Username == "" {
+			return "", time.Time{}, fmt.Errorf("registry %q requires authentication", c.registry)
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(auth.Username, auth.Password)
+		return req.Header.Get("Authorization"), time.Time{}, nil
+	case strings.EqualFold(scheme, "bearer") && params["realm"] != "":
+	default:
+		return "", time.Time{}, fmt.Errorf("unsupported auth challenge %q", challenge)
+	}
+
+	u, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse token realm: %w", err)
+	}
+	q := u.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	if params["scope"] != "" {
+		q.Set("scope", params["scope"])
+	} else if scope != "" {
+		q.Set("scope", scope)
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if auth.Username != "" {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("failed to request token: %v", resp.Status)
+	}
+	t := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to decode token: %w", err)
+	}
+	token := t.Token
+	if token == "" {
+		token = t.AccessToken
+	}
+	return "Bearer " + token, tokenExpires(t.ExpiresIn), nil
+}
@@ -0,0 +1,564 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDigest = "sha256:4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945"
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c := newClient(nil, "registry.example.io")
+	c.endpoint = server.URL
+	return c
+}
+
+func Test_Client_Tags(t *testing.T) {
+	var searched int
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case discoverPath:
+			w.Write([]byte(`{"extensions":[{"name":"_zot","endpoints":["/v2/_zot/ext/search","/v2/_zot/ext/userprefs"]}]}`))
+		case "/v2" + zotSearch:
+			searched++
+			assert.Contains(t, r.URL.Query().Get("query"), `repo:"library/nginx"`)
+			w.Write([]byte(`{"data":{"ImageList":{"Results":[{"Tag":"1.25","Digest":"` + testDigest + `"}]}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	c.detect(context.TODO())
+	assert.True(t, c.Capabilities().Search)
+	assert.Equal(t, []string{"_zot"}, c.Capabilities().Extensions)
+
+	exists, err := c.TagExists(context.TODO(), "library/nginx", "1.25")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	exists, err = c.TagExists(context.TODO(), "library/nginx", "1.26")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	// The search result is cached.
+	assert.Equal(t, 1, searched)
+}
+
+func Test_Client_NotSupported(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	c.detect(context.TODO())
+	assert.False(t, c.Capabilities().Search)
+	_, err := c.TagExists(context.TODO(), "library/nginx", "latest")
+	assert.ErrorIs(t, err, ErrNotSupported)
+}
+
+func Test_Client_Referrers(t *testing.T) {
+	dgst := digest.Digest(testDigest)
+	index := `{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"digest":"` + testDigest + `","size":100,"artifactType":"application/vnd.dev.cosign.artifact.sig.v1+json"}]}`
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/library/nginx/referrers/" + testDigest:
+			w.Write([]byte(index))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	descs, err := c.Referrers(context.TODO(), "library/nginx", dgst)
+	assert.Nil(t, err)
+	assert.Len(t, descs, 1)
+	assert.True(t, c.Capabilities().Referrers)
+
+	var requests []string
+	c = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/v2/library/nginx/manifests/sha256-" + dgst.Encoded():
+			w.Write([]byte(index))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	descs, err = c.Referrers(context.TODO(), "library/nginx", dgst)
+	assert.Nil(t, err)
+	assert.Len(t, descs, 1)
+	assert.False(t, c.Capabilities().Referrers)
+	// The referrers API is not requested again after detected.
+	descs, err = c.Referrers(context.TODO(), "library/busybox", dgst)
+	assert.Nil(t, err)
+	assert.Len(t, descs, 0)
+	assert.Equal(t, 3, len(requests))
+
+	_, err = c.Referrers(context.TODO(), "library/nginx", "invalid")
+	assert.NotNil(t, err)
+}
+
+func Test_Client_AddReferrer(t *testing.T) {
+	dgst := digest.Digest(testDigest)
+	desc := imgspecv1.Descriptor{
+		MediaType:    imgspecv1.MediaTypeImageManifest,
+		Digest:       digest.FromString("referrer"),
+		Size:         100,
+		ArtifactType: "application/vnd.dev.sigstore.bundle.v0.3+json",
+	}
+	var (
+		put  []byte
+		puts int
+	)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut &&
+			r.URL.Path == "/v2/library/nginx/manifests/sha256-"+dgst.Encoded():
+			assert.Equal(t, imgspecv1.MediaTypeImageIndex, r.Header.Get("Content-Type"))
+			put, _ = io.ReadAll(r.Body)
+			puts++
+			w.WriteHeader(http.StatusCreated)
+		case r.URL.Path == "/v2/library/nginx/manifests/sha256-"+dgst.Encoded() && put != nil:
+			w.Write(put)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	assert.Nil(t, c.AddReferrer(context.TODO(), "library/nginx", dgst, desc))
+	index := imgspecv1.Index{}
+	assert.Nil(t, json.Unmarshal(put, &index))
+	assert.Equal(t, []imgspecv1.Descriptor{desc}, index.Manifests)
+	// The referrer already exists in the index.
+	assert.Nil(t, c.AddReferrer(context.TODO(), "library/nginx", dgst, desc))
+	assert.Equal(t, 1, puts)
+
+	// The referrers API is supported.
+	c = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/library/nginx/referrers/" + testDigest:
+			w.Write([]byte(`{"schemaVersion":2,"manifests":[]}`))
+		default:
+			t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	assert.Nil(t, c.AddReferrer(context.TODO(), "library/nginx", dgst, desc))
+}
+
+func Test_Scope(t *testing.T) {
+	assert.Equal(t, "repository:library/nginx:pull",
+		Scope(http.MethodGet, "/v2/library/nginx/tags/list?n=10"))
+	assert.Equal(t, "repository:library/nginx:pull",
+		Scope(http.MethodHead, "/v2/library/nginx/manifests/latest"))
+	assert.Equal(t, "repository:a/b/c:pull,push",
+		Scope(http.MethodPost, "/v2/a/b/c/blobs/uploads/"))
+	assert.Equal(t, "repository:library/nginx:delete",
+		Scope(http.MethodDelete, "/v2/library/nginx/manifests/"+testDigest))
+	assert.Equal(t, "registry:catalog:*", Scope(http.MethodGet, "/v2/_catalog"))
+	assert.Equal(t, "", Scope(http.MethodGet, "/v2/"))
+}
+
+func Test_Client_Do(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(b)
+	})
+	resp, err := c.Do(context.TODO(), http.MethodPut, "/v2/library/nginx/manifests/latest",
+		http.Header{"Content-Type": {"text/plain"}}, []byte("hello"))
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	b, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "hello", string(b))
+}
+
+func Test_Client_ListTags(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/library/nginx/tags/list" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.URL.Query().Get("last") {
+		case "":
+			w.Header().Set("Link", `</v2/library/nginx/tags/list?last=1.25&n=100>; rel="next"`)
+			w.Write([]byte(`{"name":"library/nginx","tags":["1.24","1.25"]}`))
+		default:
+			w.Write([]byte(`{"name":"library/nginx","tags":["1.26"]}`))
+		}
+	})
+	tags, err := c.ListTags(context.TODO(), "library/nginx", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.24", "1.25", "1.26"}, tags)
+	tags, err = c.ListTags(context.TODO(), "library/nginx", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.24"}, tags)
+	_, err = c.ListTags(context.TODO(), "library/notfound", 0)
+	assert.NotNil(t, err)
+}
+
+func Test_nextLink(t *testing.T) {
+	assert.Equal(t, "/v2/_catalog?last=b&n=2",
+		nextLink(`</v2/_catalog?last=b&n=2>; rel="next"`))
+	assert.Equal(t, "/v2/a/tags/list?last=1&n=2",
+		nextLink(`<https://registry.example.io/v2/a/tags/list?last=1&n=2>; rel="next"`))
+	assert.Equal(t, "", nextLink(`</v2/_catalog?n=2>; rel="prev"`))
+	assert.Equal(t, "", nextLink(""))
+}
+
+func Test_Client_Repositories(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/_catalog":
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/_catalog?last=library/nginx&n=100>; rel="next"`)
+				w.Write([]byte(`{"repositories":["cnrancher/hangar","library/nginx"]}`))
+				return
+			}
+			w.Write([]byte(`{"repositories":["library/redis"]}`))
+		case "/api/v2.0/projects/library/repositories":
+			w.Write([]byte(`[{"name":"library/nginx"},{"name":"library/redis"}]`))
+		case "/api/v1/repository":
+			if r.URL.Query().Get("next_page") == "" {
+				w.Write([]byte(`{"repositories":[{"namespace":"coreos","name":"etcd"}],"next_page":"abc"}`))
+				return
+			}
+			w.Write([]byte(`{"repositories":[{"namespace":"coreos","name":"flannel"}]}`))
+		case "/service/rest/v1/components":
+			if r.URL.Query().Get("continuationToken") == "" {
+				w.Write([]byte(`{"items":[{"name":"library/nginx","version":"1.25"},{"name":"library/nginx","version":"1.26"}],"continuationToken":"abc"}`))
+				return
+			}
+			w.Write([]byte(`{"items":[{"name":"library/redis","version":"7"}],"continuationToken":null}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	repos, err := c.Repositories(context.TODO(), BackendCatalog, "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cnrancher/hangar", "library/nginx", "library/redis"}, repos)
+	repos, err = c.Repositories(context.TODO(), BackendCatalog, "library", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"library/nginx", "library/redis"}, repos)
+	repos, err = c.Repositories(context.TODO(), BackendHarbor, "library", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"library/nginx"}, repos)
+	repos, err = c.Repositories(context.TODO(), BackendQuay, "coreos", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"coreos/etcd", "coreos/flannel"}, repos)
+	_, err = c.Repositories(context.TODO(), BackendQuay, "", 0)
+	assert.NotNil(t, err)
+	repos, err = c.Repositories(context.TODO(), BackendNexus, "docker-hosted", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"library/nginx", "library/redis"}, repos)
+	_, err = c.Repositories(context.TODO(), BackendNexus, "", 0)
+	assert.NotNil(t, err)
+	_, err = c.Repositories(context.TODO(), "unknown", "", 0)
+	assert.NotNil(t, err)
+}
+
+func Test_Client_AQLTags(t *testing.T) {
+	const platformDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != artifactoryAQL || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(b), `"repo":"docker-local"`)
+		assert.Contains(t, string(b), `"$match":"library/nginx/*"`)
+		w.Write([]byte(`{"results":[` +
+			`{"path":"library/nginx/1.25","name":"list.manifest.json","sha256":"` + testDigest[len("sha256:"):] + `"},` +
+			`{"path":"library/nginx/sha256:` + platformDigest[len("sha256:"):] + `","name":"manifest.json","sha256":"` + platformDigest[len("sha256:"):] + `"},` +
+			`{"path":"library/nginx/sub/latest","name":"manifest.json"}]}`))
+	})
+	_, err := c.Tags(context.TODO(), "docker-local/library/nginx")
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	c.SetArtifactory("docker-local")
+	exists, err := c.TagExists(context.TODO(), "docker-local/library/nginx", "1.25")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	tags, err := c.Tags(context.TODO(), "docker-local/library/nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]digest.Digest{"1.25": testDigest}, tags)
+	// The platform manifest folders are not tags.
+	cached, err := c.Cached(context.TODO(), "docker-local/library/nginx", platformDigest)
+	assert.Nil(t, err)
+	assert.True(t, cached)
+}
+
+func Test_isAccessToken(t *testing.T) {
+	assert.True(t, isAccessToken("eyJ2ZXIiOiIyIiwidHlwIjoiSldUIn0.payload.signature"))
+	assert.True(t, isAccessToken("cmVmdGtuOjAxOjE3MDAwMDAwMDA6YWJj"))
+	assert.False(t, isAccessToken("password"))
+}
+
+func Test_Client_Exists(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		switch r.URL.Path {
+		case "/v2/library/nginx/blobs/" + testDigest:
+		case "/v2/library/nginx/manifests/" + testDigest:
+			assert.Contains(t, r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json")
+		case "/v2/library/error/blobs/" + testDigest:
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	exists, err := c.BlobExists(context.TODO(), "library/nginx", testDigest)
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	exists, err = c.ManifestExists(context.TODO(), "library/nginx", testDigest)
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	exists, err = c.BlobExists(context.TODO(), "library/redis", testDigest)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	_, err = c.BlobExists(context.TODO(), "library/error", testDigest)
+	assert.NotNil(t, err)
+}
+
+func Test_Client_Bootstrap(t *testing.T) {
+	var (
+		blob     []byte
+		manifest []byte
+	)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/library/new/tags/list":
+			if manifest == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"name":"library/new","tags":["hangar-bootstrap"]}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/library/new/blobs/uploads/":
+			w.Header().Set("Location", "http://"+r.Host+"/v2/library/new/blobs/uploads/uuid?_state=s")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/library/new/blobs/uploads/uuid":
+			assert.Equal(t, "s", r.URL.Query().Get("_state"))
+			blob, _ = io.ReadAll(r.Body)
+			assert.Equal(t, digest.FromBytes(blob).String(), r.URL.Query().Get("digest"))
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/library/new/manifests/"+BootstrapTag:
+			manifest, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	ok, err := c.RepositoryExists(context.TODO(), "library/new")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, c.Bootstrap(context.TODO(), "library/new"))
+	m := imgspecv1.Manifest{}
+	assert.Nil(t, json.Unmarshal(manifest, &m))
+	assert.Equal(t, digest.FromBytes(blob), m.Config.Digest)
+	assert.Empty(t, m.Layers)
+	ok, err = c.RepositoryExists(context.TODO(), "library/new")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	_, err = uploadLocation("uploads/uuid", digest.FromString(""))
+	assert.Error(t, err)
+}
+
+func Test_Client_SharedToken(t *testing.T) {
+	var requested atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			requested.Add(1)
+			w.Write([]byte(`{"token":"abc","expires_in":300}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.Header().Set("WWW-Authenticate",
+				fmt.Sprintf(`Bearer realm="http://%s/token",service="test"`, r.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"name":"library/nginx","tags":["latest"]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := NewClient(nil, "shared.example.io")
+			c.endpoint = server.URL
+			ok, err := c.RepositoryExists(context.TODO(), "library/nginx")
+			assert.Nil(t, err)
+			assert.True(t, ok)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), requested.Load())
+	assert.Same(t, NewClient(nil, "shared.example.io").client,
+		NewClient(nil, "shared.example.io").client)
+}
+
+func Test_Client_SharedToken_Credentials(t *testing.T) {
+	var requested atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		if r.URL.Path == "/token" {
+			requested.Add(1)
+			w.Write([]byte(`{"token":"` + user + `","expires_in":300}`))
+			return
+		}
+		authorization := r.Header.Get("Authorization")
+		if authorization == "" {
+			w.Header().Set("WWW-Authenticate",
+				fmt.Sprintf(`Bearer realm="http://%s/token",service="test"`, r.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// Respond the token to check which credential requested it.
+		w.Write([]byte(authorization))
+	}))
+	t.Cleanup(server.Close)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		user := []string{"alice", "bob"}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := NewClient(&types.SystemContext{
+				DockerAuthConfig: &types.DockerAuthConfig{Username: user, Password: "password"},
+			}, "credentials.example.io")
+			c.endpoint = server.URL
+			// Both users request the token of the same scope.
+			resp, err := c.Do(context.TODO(), http.MethodGet, "/v2/project/shared/tags/list", nil, nil)
+			assert.Nil(t, err)
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, "Bearer "+user, string(b))
+		}()
+	}
+	wg.Wait()
+	// One token is requested by each credential.
+	assert.Equal(t, int32(2), requested.Load())
+	assert.NotSame(t,
+		NewClient(&types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{Username: "alice"}},
+			"credentials.example.io").tokens,
+		NewClient(&types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{Username: "bob"}},
+			"credentials.example.io").tokens)
+}
+
+func Test_Client_Blob(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/library/nginx/blobs/"+testDigest {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("blob"))
+	})
+	rc, size, err := c.Blob(context.TODO(), "library/nginx", testDigest)
+	assert.Nil(t, err)
+	b, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "blob", string(b))
+	assert.Equal(t, int64(4), size)
+	_, _, err = c.Blob(context.TODO(), "library/redis", testDigest)
+	assert.NotNil(t, err)
+	_, _, err = c.Blob(context.TODO(), "library/nginx", "invalid")
+	assert.NotNil(t, err)
+}
+
+func Test_tokenExpires(t *testing.T) {
+	now := time.Now()
+	assert.WithinDuration(t, now.Add(defaultTokenTTL-tokenExpiryMargin), tokenExpires(0), time.Second)
+	assert.WithinDuration(t, now.Add(time.Minute*5-tokenExpiryMargin), tokenExpires(300), time.Second)
+	assert.WithinDuration(t, now.Add(time.Second*5), tokenExpires(5), time.Second)
+}
+
+func Test_Client_Cached(t *testing.T) {
+	const child = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	t.Run("harbor", func(t *testing.T) {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.EscapedPath() {
+			case harborSystemInfo:
+				w.Write([]byte(`{"harbor_version":"v2.10.0"}`))
+			case "/api/v2.0/projects/proxy/repositories/library%252Fnginx/artifacts/1.25",
+				"/api/v2.0/projects/proxy/repositories/library%252Fnginx/artifacts/" + testDigest:
+				w.Write([]byte(`{"digest":"` + testDigest + `"}`))
+			case "/api/v2.0/projects/proxy/repositories/library%252Ferror/artifacts/1.25":
+				w.WriteHeader(http.StatusInternalServerError)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+		cached, err := c.Cached(context.TODO(), "proxy/library/nginx", "1.25")
+		assert.Nil(t, err)
+		assert.True(t, cached)
+		cached, err = c.Cached(context.TODO(), "proxy/library/nginx", testDigest)
+		assert.Nil(t, err)
+		assert.True(t, cached)
+		cached, err = c.Cached(context.TODO(), "proxy/library/nginx", child)
+		assert.Nil(t, err)
+		assert.False(t, cached)
+		_, err = c.Cached(context.TODO(), "proxy/library/error", "1.25")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("zot", func(t *testing.T) {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case discoverPath:
+				w.Write([]byte(`{"extensions":[{"name":"_zot","endpoints":["/v2/_zot/ext/search"]}]}`))
+			case "/v2" + zotSearch:
+				w.Write([]byte(`{"data":{"ImageList":{"Results":[{"Tag":"1.25","Digest":"` + testDigest +
+					`","Manifests":[{"Digest":"` + child + `"}]}]}}}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+		c.detect(context.TODO())
+		for _, ref := range []string{"1.25", testDigest, child} {
+			cached, err := c.Cached(context.TODO(), "library/nginx", ref)
+			assert.Nil(t, err)
+			assert.True(t, cached, ref)
+		}
+		cached, err := c.Cached(context.TODO(), "library/nginx", "1.26")
+		assert.Nil(t, err)
+		assert.False(t, cached)
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+		c.detect(context.TODO())
+		_, err := c.Cached(context.TODO(), "library/nginx", "1.25")
+		assert.ErrorIs(t, err, ErrNotSupported)
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		})
+		_, err := c.Cached(context.TODO(), "library/nginx", "1.25")
+		assert.NotNil(t, err)
+		assert.NotErrorIs(t, err, ErrNotSupported)
+	})
+}
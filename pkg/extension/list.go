@@ -0,0 +1,297 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containers/image/v5/pkg/docker/config"
+)
+
+// pageSize is the number of entries requested in each page of the
+// paginated APIs.
+const pageSize = 100
+
+// ListTags lists the tags of the repository by the distribution tags list
+// API, the paginated result is followed by the Link header.
+// All tags are returned if the limit is not positive.
+func (c *Client) ListTags(ctx context.Context, repository string, limit int) ([]string, error) {
+	var (
+		tags  []string
+		scope = fmt.Sprintf("repository:%s:pull", repository)
+		p     = fmt.Sprintf("/v2/%s/tags/list?n=%d", repository, pageSize)
+	)
+	for p != "" {
+		r := struct {
+			Tags []string `json:"tags"`
+		}{}
+		next, err := c.page(ctx, p, scope, &r)
+		if err != nil {
+			return nil, fmt.Errorf("list tags of %q: %w", repository, err)
+		}
+		tags = append(tags, r.Tags...)
+		if limit > 0 && len(tags) >= limit {
+			return tags[:limit], nil
+		}
+		p = next
+	}
+	return tags, nil
+}
+
+// page requests one page of the paginated API and decodes the response
+// into v, returns the path of the next page or empty if it is the last.
+func (c *Client) page(ctx context.Context, p, scope string, v any) (string, error) {
+	resp, err := c.get(ctx, p, scope, "application/json")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %v", p, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nextLink(resp.Header.Get("Link")), nil
+}
+
+// nextLink parses the path of the next page from the Link header.
+//
+//	Example:
+//		</v2/library/nginx/tags/list?last=1.25&n=100>; rel="next"
+func nextLink(link string) string {
+	for _, l := range strings.Split(link, ",") {
+		target, params, ok := strings.Cut(strings.TrimSpace(l), ";")
+		if !ok || !strings.Contains(strings.ReplaceAll(params, " ", ""), `rel="next"`) {
+			continue
+		}
+		target = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(target), "<"), ">")
+		u, err := url.Parse(target)
+		if err != nil {
+			return ""
+		}
+		// The link may be the absolute URL of the registry.
+		return u.RequestURI()
+	}
+	return ""
+}
+
+// Backend is the API used for listing the repositories of the registry.
+type Backend string
+
+const (
+	// BackendCatalog lists the repositories by the distribution catalog API.
+	BackendCatalog Backend = "catalog"
+	// BackendHarbor lists the repositories by the Harbor v2.0 API.
+	BackendHarbor Backend = "harbor"
+	// BackendQuay lists the repositories by the Quay v1 API.
+	BackendQuay Backend = "quay"
+	// BackendNexus lists the repositories by the Nexus 3 components API.
+	BackendNexus Backend = "nexus"
+)
+
+// Backends is the supported repository listing backends.
+var Backends = []Backend{BackendCatalog, BackendHarbor, BackendQuay, BackendNexus}
+
+// Repositories lists the repositories of the registry by the backend,
+// only the repositories of the project (namespace) are listed if the
+// project is not empty. All repositories are returned if the limit is
+// not positive.
+func (c *Client) Repositories(
+	ctx context.Context, backend Backend, project string, limit int,
+) ([]string, error) {
+	var (
+		repos []string
+		err   error
+	)
+	switch backend {
+	case BackendCatalog, "":
+		repos, err = c.catalog(ctx, project, limit)
+	case BackendHarbor:
+		repos, err = c.harborRepositories(ctx, project, limit)
+	case BackendQuay:
+		repos, err = c.quayRepositories(ctx, project, limit)
+	case BackendNexus:
+		repos, err = c.nexusRepositories(ctx, project, limit)
+	default:
+		return nil, fmt.Errorf("unsupported backend %q", backend)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list repositories of %q: %w", c.registry, err)
+	}
+	if limit > 0 && len(repos) > limit {
+		repos = repos[:limit]
+	}
+	return repos, nil
+}
+
+// catalog lists the repositories by the catalog API, the repositories
+// are filtered by the project prefix since the API does not support it.
+func (c *Client) catalog(ctx context.Context, project string, limit int) ([]string, error) {
+	var (
+		repos []string
+		p     = fmt.Sprintf("/v2/_catalog?n=%d", pageSize)
+	)
+	for p != "" {
+		r := struct {
+			Repositories []string `json:"repositories"`
+		}{}
+		next, err := c.page(ctx, p, "registry:catalog:*", &r)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range r.Repositories {
+			if project != "" && !strings.HasPrefix(repo, project+"/") {
+				continue
+			}
+			repos = append(repos, repo)
+		}
+		if limit > 0 && len(repos) >= limit {
+			break
+		}
+		p = next
+	}
+	return repos, nil
+}
+
+// harborRepositories lists the repositories of the Harbor project,
+// or all repositories the user can access if the project is empty.
+func (c *Client) harborRepositories(ctx context.Context, project string, limit int) ([]string, error) {
+	var (
+		repos []string
+		p     = fmt.Sprintf("/api/v2.0/repositories?page=1&page_size=%d", pageSize)
+		scope = "harbor:api"
+	)
+	if project != "" {
+		p = fmt.Sprintf("/api/v2.0/projects/%s/repositories?page=1&page_size=%d",
+			url.PathEscape(project), pageSize)
+	}
+	// The Harbor API accepts the basic auth of the registry credential.
+	if err := c.presetAuthorization(scope, false); err != nil {
+		return nil, err
+	}
+	for p != "" {
+		var r []struct {
+			Name string `json:"name"`
+		}
+		next, err := c.page(ctx, p, scope, &r)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range r {
+			repos = append(repos, repo.Name)
+		}
+		if limit > 0 && len(repos) >= limit {
+			break
+		}
+		p = next
+	}
+	return repos, nil
+}
+
+// quayRepositories lists the repositories of the Quay namespace, the
+// pagination of the Quay API is the next_page token of the response.
+func (c *Client) quayRepositories(ctx context.Context, namespace string, limit int) ([]string, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("namespace is required by the Quay API")
+	}
+	var (
+		repos []string
+		scope = "quay:api"
+		q     = url.Values{"namespace": {namespace}}
+	)
+	// The Quay API only accepts the OAuth token, the public repositories
+	// are listed anonymously if the identity token is not provided.
+	if err := c.presetAuthorization(scope, true); err != nil {
+		return nil, err
+	}
+	for {
+		r := struct {
+			Repositories []struct {
+				Namespace string `json:"namespace"`
+				Name      string `json:"name"`
+			} `json:"repositories"`
+			NextPage string `json:"next_page"`
+		}{}
+		if _, err := c.page(ctx, "/api/v1/repository?"+q.Encode(), scope, &r); err != nil {
+			return nil, err
+		}
+		for _, repo := range r.Repositories {
+			repos = append(repos, repo.Namespace+"/"+repo.Name)
+		}
+		if r.NextPage == "" || (limit > 0 && len(repos) >= limit) {
+			break
+		}
+		q.Set("next_page", r.NextPage)
+	}
+	return repos, nil
+}
+
+// nexusRepositories lists the image repositories of the Nexus docker
+// repository by the components API, the catalog API of Nexus does not
+// paginate and is limited by the repository connector. The components
+// are the tags of the images, paginated by the continuationToken.
+func (c *Client) nexusRepositories(ctx context.Context, repository string, limit int) ([]string, error) {
+	if repository == "" {
+		return nil, fmt.Errorf("repository is required by the Nexus API")
+	}
+	var (
+		repos []string
+		seen  = map[string]bool{}
+		scope = "nexus:api"
+		q     = url.Values{"repository": {repository}}
+	)
+	// The Nexus API accepts the basic auth of the registry credential.
+	if err := c.presetAuthorization(scope, false); err != nil {
+		return nil, err
+	}
+	for {
+		r := struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			ContinuationToken string `json:"continuationToken"`
+		}{}
+		if _, err := c.page(ctx, "/service/rest/v1/components?"+q.Encode(), scope, &r); err != nil {
+			return nil, err
+		}
+		for _, item := range r.Items {
+			if seen[item.Name] {
+				continue
+			}
+			seen[item.Name] = true
+			repos = append(repos, item.Name)
+		}
+		if r.ContinuationToken == "" || (limit > 0 && len(repos) >= limit) {
+			break
+		}
+		q.Set("continuationToken", r.ContinuationToken)
+	}
+	return repos, nil
+}
+
+// presetAuthorization caches the Authorization header of the vendor API
+// scope from the registry credential, the vendor APIs do not send the
+// token auth challenge like the distribution API.
+func (c *Client) presetAuthorization(scope string, token bool) error {
+	auth, err := config.GetCredentials(c.sysCtx, c.registry)
+	if err != nil {
+		return fmt.Errorf("failed to get credential of %q: %w", c.registry, err)
+	}
+	var authorization string
+	switch {
+	case token && auth.IdentityToken != "":
+		authorization = "Bearer " + auth.IdentityToken
+	case !token && auth.Username != "":
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(auth.Username, auth.Password)
+		authorization = req.Header.Get("Authorization")
+	default:
+		return nil
+	}
+	c.tokens.preset(scope, authorization)
+	return nil
+}
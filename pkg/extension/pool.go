@@ -0,0 +1,190 @@
+package extension
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/types"
+)
+
+const (
+	// defaultTokenTTL is the lifetime of the bearer token if the token
+	// server does not return the 'expires_in', defined by the distribution
+	// token authentication specification.
+	defaultTokenTTL = time.Minute
+	// tokenExpiryMargin is subtracted from the token lifetime to refresh
+	// the token before it expires on the registry.
+	tokenExpiryMargin = time.Second * 10
+)
+
+// The HTTP clients and token caches are shared by the registry API requests
+// sent by the extension Client (tag lists, referrers, existence checks, the
+// caching proxy, etc) and the source blobs fetched by the image copies.
+// The manifests and the destination blob uploads of the image copies are
+// still handled by containers/image, which creates its own transport and
+// token cache for each image reference and provides no hook to inject them.
+var (
+	// httpClients caches the HTTP client of the registry shared by the
+	// workers, the TLS connections are reused across the requests.
+	httpClients sync.Map
+	// tokenCaches caches the authorization of the registry and credential
+	// shared by the workers, the token is requested once per scope until it
+	// expires.
+	tokenCaches sync.Map
+)
+
+// sharedHTTPClient returns the HTTP client of the registry shared by all
+// the clients of the registry in the process.
+func sharedHTTPClient(registry string, insecure bool) *http.Client {
+	key := registry
+	if insecure {
+		key += "#insecure"
+	}
+	if c, ok := httpClients.Load(key); ok {
+		return c.(*http.Client)
+	}
+	c := &http.Client{
+		Timeout: time.Second * 30,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   time.Second * 30,
+				KeepAlive: time.Second * 30,
+			}).DialContext,
+			TLSClientConfig:       &tls.Config{InsecureSkipVerify: insecure},
+			TLSHandshakeTimeout:   time.Second * 10,
+			ResponseHeaderTimeout: time.Second * 30,
+			MaxIdleConnsPerHost:   utils.MaxWorkerNum,
+			IdleConnTimeout:       time.Second * 90,
+			ForceAttemptHTTP2:     true,
+		},
+	}
+	v, _ := httpClients.LoadOrStore(key, c)
+	return v.(*http.Client)
+}
+
+// sharedStreamClient returns the HTTP client of the registry without the
+// total timeout for streaming the large blobs, the connections are shared
+// with the client returned by sharedHTTPClient and only the dial, the TLS
+// handshake and the response header are timed out.
+func sharedStreamClient(registry string, insecure bool) *http.Client {
+	return &http.Client{
+		Transport: sharedHTTPClient(registry, insecure).Transport,
+	}
+}
+
+// tokenCache is the authorization of the scopes of the registry.
+type tokenCache struct {
+	mu     sync.Mutex
+	scopes map[string]*scopeToken
+}
+
+// scopeToken is the authorization of the scope.
+type scopeToken struct {
+	// mu serializes the token requests of the scope, the workers waiting
+	// for the token reuse the one requested by the first worker.
+	mu            sync.Mutex
+	authorization string
+	// expires is zero if the authorization does not expire (basic auth)
+	expires time.Time
+}
+
+// credentialIdentity returns the identity of the registry credential of
+// the system context, empty if the registry is accessed anonymously.
+// The secrets are hashed to avoid keeping them in the cache keys.
+func credentialIdentity(sysCtx *types.SystemContext, registry string) string {
+	auth, err := config.GetCredentials(sysCtx, registry)
+	if err != nil || auth == (types.DockerAuthConfig{}) {
+		return ""
+	}
+	h := sha256.Sum256([]byte(auth.Username + "\x00" + auth.Password + "\x00" + auth.IdentityToken))
+	return hex.EncodeToString(h[:8])
+}
+
+// sharedTokenCache returns the token cache of the registry shared by all
+// the clients of the registry using the same credential in the process,
+// the tokens of different credentials are never shared.
+func sharedTokenCache(registry, identity string) *tokenCache {
+	key := registry + "#" + identity
+	if t, ok := tokenCaches.Load(key); ok {
+		return t.(*tokenCache)
+	}
+	v, _ := tokenCaches.LoadOrStore(key, &tokenCache{
+		scopes: map[string]*scopeToken{},
+	})
+	return v.(*tokenCache)
+}
+
+func (t *tokenCache) scope(scope string) *scopeToken {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.scopes[scope]
+	if !ok {
+		s = &scopeToken{}
+		t.scopes[scope] = s
+	}
+	return s
+}
+
+// preset caches the authorization of the scope without expiration.
+func (t *tokenCache) preset(scope, authorization string) {
+	s := t.scope(scope)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authorization, s.expires = authorization, time.Time{}
+}
+
+// get returns the cached authorization, empty if not requested or
+// expired.
+func (s *scopeToken) get() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.valid() {
+		return ""
+	}
+	return s.authorization
+}
+
+// refresh returns the authorization refreshed by other worker if it is
+// different from the rejected one, otherwise requests the new one.
+func (s *scopeToken) refresh(
+	rejected string, authorize func() (string, time.Time, error),
+) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.valid() && s.authorization != rejected {
+		return s.authorization, nil
+	}
+	authorization, expires, err := authorize()
+	if err != nil {
+		return "", err
+	}
+	s.authorization, s.expires = authorization, expires
+	return authorization, nil
+}
+
+func (s *scopeToken) valid() bool {
+	if s.authorization == "" {
+		return false
+	}
+	return s.expires.IsZero() || time.Now().Before(s.expires)
+}
+
+// tokenExpires returns the time the token should be refreshed by the
+// 'expires_in' seconds of the token response.
+func tokenExpires(expiresIn int) time.Time {
+	ttl := defaultTokenTTL
+	if expiresIn > 0 {
+		ttl = time.Duration(expiresIn) * time.Second
+	}
+	if ttl > tokenExpiryMargin*2 {
+		ttl -= tokenExpiryMargin
+	}
+	return time.Now().Add(ttl)
+}
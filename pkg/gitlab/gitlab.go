@@ -0,0 +1,191 @@
+// Package gitlab implements the GitLab API client to check and create the
+// projects of the GitLab Container Registry repositories, the container
+// repositories of GitLab could only be pushed into the existing projects.
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/backoff"
+	"github.com/containers/common/pkg/retry"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNamespaceNotFound = errors.New("gitlab namespace not found")
+)
+
+// Client is the GitLab API v4 client.
+type Client struct {
+	// url is the GitLab server URL, e.g. 'https://gitlab.example.com'.
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewClient creates the GitLab API client, the token is the personal,
+// group or project access token with the 'api' scope.
+func NewClient(u, token string, tlsVerify bool) *Client {
+	return &Client{
+		url:   strings.TrimSuffix(u, "/"),
+		token: token,
+		client: &http.Client{
+			Timeout: time.Second * 10,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: !tlsVerify},
+			},
+		},
+	}
+}
+
+// APIURL returns the default GitLab server URL of the container registry,
+// the 'registry.' prefix of the registry domain is removed.
+//
+//	Example:
+//		registry.gitlab.com => https://gitlab.com
+//		gitlab.example.com:5050 => https://gitlab.example.com
+func APIURL(registry string) string {
+	host := registry
+	if h, _, ok := strings.Cut(registry, ":"); ok {
+		host = h
+	}
+	return "https://" + strings.TrimPrefix(host, "registry.")
+}
+
+// FindProject returns the full path of the project containing the container
+// repository, the container repository path is the project path followed
+// by the optional image names. Returns empty string if not found.
+//
+//	Example:
+//		group/subgroup/project/image => group/subgroup/project
+func (c *Client) FindProject(ctx context.Context, repository string) (string, error) {
+	components := strings.Split(strings.Trim(repository, "/"), "/")
+	// The project path has 2 components at least (namespace/project).
+	for i := len(components); i >= 2; i-- {
+		p := strings.Join(components[:i], "/")
+		exists, err := c.ProjectExists(ctx, p)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return p, nil
+		}
+	}
+	return "", nil
+}
+
+// ProjectExists checks the project of the full path exists or not.
+func (c *Client) ProjectExists(ctx context.Context, p string) (bool, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/api/v4/projects/"+url.PathEscape(p), nil)
+	if err != nil {
+		return false, fmt.Errorf("gitlab.ProjectExists: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		logrus.Debugf("gitlab project %q already exists", p)
+		return true, nil
+	case http.StatusNotFound:
+		logrus.Debugf("gitlab project %q not found", p)
+		return false, nil
+	}
+	return false, fmt.Errorf("gitlab.ProjectExists: %q response: %v", p, resp.Status)
+}
+
+// CreateProject creates the private project of the full path, the parent
+// namespace (group or user) should exist.
+func (c *Client) CreateProject(ctx context.Context, p string) error {
+	namespace, name := path.Split(strings.Trim(p, "/"))
+	namespace = strings.TrimSuffix(namespace, "/")
+	if namespace == "" {
+		return fmt.Errorf("gitlab.CreateProject: invalid project path %q", p)
+	}
+	id, err := c.namespaceID(ctx, namespace)
+	if err != nil {
+		return fmt.Errorf("gitlab.CreateProject: %w", err)
+	}
+	b, err := json.Marshal(map[string]any{
+		"name":         name,
+		"path":         name,
+		"namespace_id": id,
+		"visibility":   "private",
+	})
+	if err != nil {
+		return fmt.Errorf("gitlab.CreateProject: json.Marshal: %w", err)
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/api/v4/projects", b)
+	if err != nil {
+		return fmt.Errorf("gitlab.CreateProject: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusBadRequest:
+		// GitLab responses 400 if the path has already been taken.
+		if exists, err := c.ProjectExists(ctx, p); err == nil && exists {
+			logrus.Debugf("already created project %q", p)
+			return nil
+		}
+		return fmt.Errorf("failed to create project %q, response: %s", p, resp.Status)
+	default:
+		return fmt.Errorf("failed to create project %q, response: %s", p, resp.Status)
+	}
+	return nil
+}
+
+// namespaceID returns the ID of the namespace (group or user) of the
+// full path.
+func (c *Client) namespaceID(ctx context.Context, namespace string) (int, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/api/v4/namespaces/"+url.PathEscape(namespace), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return 0, fmt.Errorf("%w: %q", ErrNamespaceNotFound, namespace)
+	default:
+		return 0, fmt.Errorf("get namespace %q: %v", namespace, resp.Status)
+	}
+	n := struct {
+		ID int `json:"id"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&n); err != nil {
+		return 0, fmt.Errorf("failed to decode namespace %q: %w", namespace, err)
+	}
+	return n.ID, nil
+}
+
+func (c *Client) do(ctx context.Context, method, p string, body []byte) (*http.Response, error) {
+	var resp *http.Response
+	err := backoff.IfNecessary(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, method, c.url+p, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if c.token != "" {
+			req.Header.Set("PRIVATE-TOKEN", c.token)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		logrus.Debugf("client.Do: %v %v", method, req.URL.String())
+		resp, err = c.client.Do(req)
+		return err
+	}, &retry.Options{
+		MaxRetry: 3,
+		Delay:    time.Millisecond * 100,
+	})
+	return resp, err
+}
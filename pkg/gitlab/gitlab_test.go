@@ -0,0 +1,57 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_APIURL(t *testing.T) {
+	assert.Equal(t, "https://gitlab.com", APIURL("registry.gitlab.com"))
+	assert.Equal(t, "https://gitlab.example.com", APIURL("gitlab.example.com:5050"))
+}
+
+func Test_Client(t *testing.T) {
+	projects := map[string]bool{"group/sub/project": true}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token", r.Header.Get("PRIVATE-TOKEN"))
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v4/namespaces/group/sub":
+			w.Write([]byte(`{"id":10}`))
+		case r.Method == http.MethodGet && len(r.URL.Path) > len("/api/v4/projects/"):
+			if !projects[r.URL.Path[len("/api/v4/projects/"):]] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v4/projects":
+			data := struct {
+				Path        string `json:"path"`
+				NamespaceID int    `json:"namespace_id"`
+			}{}
+			json.NewDecoder(r.Body).Decode(&data)
+			assert.Equal(t, 10, data.NamespaceID)
+			projects["group/sub/"+data.Path] = true
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "token", true)
+	p, err := c.FindProject(context.TODO(), "group/sub/project/image")
+	assert.Nil(t, err)
+	assert.Equal(t, "group/sub/project", p)
+	p, err = c.FindProject(context.TODO(), "group/sub/nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, "", p)
+
+	assert.Nil(t, c.CreateProject(context.TODO(), "group/sub/nginx"))
+	p, err = c.FindProject(context.TODO(), "group/sub/nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, "group/sub/nginx", p)
+	assert.ErrorIs(t, c.CreateProject(context.TODO(), "other/nginx"), ErrNamespaceNotFound)
+}
@@ -3,6 +3,7 @@ package archive
 import (
 	"os"
 	"path"
+	"time"
 )
 
 const (
@@ -12,6 +13,11 @@ const (
 
 var (
 	cacheDir string
+
+	// FixedModTime is the modification time of the files written into
+	// the archive in the deterministic mode, which is the earliest time
+	// supported by the zip format.
+	FixedModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
 )
 
 func init() {
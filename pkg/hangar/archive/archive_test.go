@@ -1,8 +1,15 @@
 package archive
 
 import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,3 +29,270 @@ func Test_CompareIndexVersion(t *testing.T) {
 	err = CompareIndexVersion(index)
 	assert.Nil(t, err)
 }
+
+func Test_WritePartialIndex(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "saved-images.zip")
+	index := NewIndex()
+	index.Append(&Image{
+		Source: "docker.io/library/nginx",
+		Tag:    "1.25",
+		Images: []ImageSpec{{Arch: "amd64", OS: "linux"}},
+	})
+	assert.Nil(t, WritePartialIndex(name, index))
+	assert.Equal(t, name+".index.json", PartialIndexName(name))
+
+	b, err := os.ReadFile(PartialIndexName(name))
+	assert.Nil(t, err)
+	i, err := UnmarshalIndex(b)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(i.List))
+	_, err = os.Stat(PartialIndexName(name) + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func Test_DetectFormat(t *testing.T) {
+	assert.Equal(t, FormatZip, DetectFormat("saved-images.zip"))
+	assert.Equal(t, FormatZip, DetectFormat("saved-images"))
+	assert.Equal(t, FormatTar, DetectFormat("saved-images.tar"))
+	assert.Equal(t, FormatTarGzip, DetectFormat("saved-images.tar.gz"))
+	assert.Equal(t, FormatTarZstd, DetectFormat("saved-images.tar.zst"))
+}
+
+func Test_TarWriter(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "nginx")
+	assert.Nil(t, os.MkdirAll(filepath.Join(src, SharedBlobDir), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(src, SharedBlobDir, "blob"), []byte("data"), 0644))
+
+	name := filepath.Join(dir, "saved-images.tar")
+	w, err := NewTarWriter(name, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Write(src))
+	assert.Nil(t, w.WriteIndex(NewIndex()))
+	assert.Nil(t, w.Close())
+
+	f, err := os.Open(name)
+	assert.Nil(t, err)
+	defer f.Close()
+	files := map[string]string{}
+	tr := tar.NewReader(f)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		b, err := io.ReadAll(tr)
+		assert.Nil(t, err)
+		files[h.Name] = string(b)
+	}
+	assert.Equal(t, "data", files[SharedBlobDir+"/blob"])
+	_, ok := files[SharedBlobDir+"/"]
+	assert.True(t, ok)
+	_, ok = files[IndexFileName]
+	assert.True(t, ok)
+}
+
+func Test_DirLayout(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "cache")
+	blob := filepath.Join(src, SharedBlobDir, "sha256", "abc")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(blob), 0755))
+	assert.Nil(t, os.WriteFile(blob, []byte("data"), 0644))
+	assert.Nil(t, os.MkdirAll(filepath.Join(src, "def"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(src, "def", "index.json"), []byte("{}"), 0644))
+
+	name := filepath.Join(dir, "saved-images")
+	w, err := NewDirWriter(name)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Write(src))
+	assert.Nil(t, w.WriteIndex(NewIndex()))
+	assert.Nil(t, w.Close())
+	assert.Nil(t, os.RemoveAll(src))
+
+	r, err := NewReader(name)
+	assert.Nil(t, err)
+	defer r.Close()
+	_, err = r.Index()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), r.BlobSizes()["sha256:abc"])
+
+	dest := filepath.Join(dir, "dest")
+	assert.Nil(t, r.Decompress(SharedBlobDir+"/sha256/abc", dest))
+	b, err := os.ReadFile(filepath.Join(dest, "abc"))
+	assert.Nil(t, err)
+	assert.Equal(t, "data", string(b))
+	assert.Nil(t, r.Decompress("def/", dest))
+	_, err = os.Stat(filepath.Join(dest, "index.json"))
+	assert.Nil(t, err)
+	assert.ErrorIs(t, r.Decompress("not-exists", dest), os.ErrNotExist)
+}
+
+func Test_ParseLayout(t *testing.T) {
+	l, err := ParseLayout("")
+	assert.Nil(t, err)
+	assert.Equal(t, LayoutArchive, l)
+	l, err = ParseLayout("dir")
+	assert.Nil(t, err)
+	assert.Equal(t, LayoutDir, l)
+	_, err = ParseLayout("unknown")
+	assert.NotNil(t, err)
+}
+
+func Test_MultiWriter_Deterministic(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "cache")
+	blob := filepath.Join(src, SharedBlobDir, "sha256", "abc")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(blob), 0755))
+	assert.Nil(t, os.WriteFile(blob, []byte("data"), 0644))
+
+	write := func(names ...string) {
+		w, err := NewMultiWriter(LayoutArchive, nil, names...)
+		assert.Nil(t, err)
+		w.SetDeterministic()
+		assert.Nil(t, w.Write(src))
+		index := NewIndex()
+		index.Time = FixedModTime
+		assert.Nil(t, w.WriteIndex(index))
+		assert.Nil(t, w.Close())
+	}
+	write(filepath.Join(dir, "1.zip"), filepath.Join(dir, "1.tar"))
+	now := time.Now().Add(time.Hour)
+	assert.Nil(t, os.Chtimes(blob, now, now))
+	write(filepath.Join(dir, "2.zip"), filepath.Join(dir, "2.tar"))
+
+	for _, ext := range []string{".zip", ".tar"} {
+		b1, err := os.ReadFile(filepath.Join(dir, "1"+ext))
+		assert.Nil(t, err)
+		b2, err := os.ReadFile(filepath.Join(dir, "2"+ext))
+		assert.Nil(t, err)
+		assert.Equal(t, b1, b2)
+	}
+}
+
+func Test_stagedReader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), stagingChunkSize/5+3)
+	for _, size := range []int{-1, 1, stagingChunkSize * 2} {
+		r := newStagedReader(bytes.NewReader(data), size)
+		b, err := io.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Equal(t, data, b)
+		assert.Nil(t, r.Close())
+	}
+
+	// Close before reading finished.
+	r := newStagedReader(bytes.NewReader(data), stagingChunkSize)
+	b := make([]byte, 10)
+	_, err := io.ReadFull(r, b)
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+}
+
+func Test_MultiWriter_Compress(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "cache")
+	blob := filepath.Join(src, SharedBlobDir, "sha256", "abc")
+	data := bytes.Repeat([]byte("data"), gzipBlockSize)
+	assert.Nil(t, os.MkdirAll(filepath.Dir(blob), 0755))
+	assert.Nil(t, os.WriteFile(blob, data, 0644))
+
+	write := func(workers int, names ...string) {
+		w, err := NewMultiWriter(LayoutArchive, &CompressOpts{
+			Workers:     workers,
+			StagingSize: stagingChunkSize,
+		}, names...)
+		assert.Nil(t, err)
+		w.SetDeterministic()
+		assert.Nil(t, w.Write(src))
+		index := NewIndex()
+		index.Time = FixedModTime
+		assert.Nil(t, w.WriteIndex(index))
+		assert.Nil(t, w.Close())
+	}
+	write(2, filepath.Join(dir, "1.tar.gz"), filepath.Join(dir, "1.tar.zst"))
+	write(4, filepath.Join(dir, "2.tar.gz"), filepath.Join(dir, "2.tar.zst"))
+
+	// The output is identical regardless of the number of workers.
+	for _, ext := range []string{".tar.gz", ".tar.zst"} {
+		b1, err := os.ReadFile(filepath.Join(dir, "1"+ext))
+		assert.Nil(t, err)
+		b2, err := os.ReadFile(filepath.Join(dir, "2"+ext))
+		assert.Nil(t, err)
+		assert.Equal(t, b1, b2)
+	}
+}
+
+func Test_Reader_OpenBlob(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "cache")
+	data := []byte("layer")
+	d := digest.FromBytes(data)
+	blob := filepath.Join(src, SharedBlobDir, "sha256", d.Encoded())
+	assert.Nil(t, os.MkdirAll(filepath.Dir(blob), 0755))
+	assert.Nil(t, os.WriteFile(blob, data, 0644))
+
+	name := filepath.Join(dir, "saved-images.zip")
+	w, err := NewWriter(name, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Write(src))
+	assert.Nil(t, w.WriteIndex(NewIndex()))
+	assert.Nil(t, w.Close())
+
+	r, err := NewReader(name)
+	assert.Nil(t, err)
+	defer r.Close()
+	assert.True(t, r.StoredBlob(d))
+	rc, size, ok := r.OpenBlob(d, int64(len(data)))
+	assert.True(t, ok)
+	assert.Equal(t, int64(len(data)), size)
+	b, err := io.ReadAll(rc)
+	assert.Nil(t, err)
+	assert.Nil(t, rc.Close())
+	assert.Equal(t, data, b)
+
+	// Size mismatch.
+	_, _, ok = r.OpenBlob(d, 1)
+	assert.False(t, ok)
+	// Not exists.
+	assert.False(t, r.StoredBlob(digest.FromString("not-exists")))
+	_, _, ok = r.OpenBlob(digest.FromString("not-exists"), -1)
+	assert.False(t, ok)
+
+	b, err = r.ReadBlob(d)
+	assert.Nil(t, err)
+	assert.Equal(t, data, b)
+	_, err = r.ReadBlob(digest.FromString("not-exists"))
+	assert.NotNil(t, err)
+}
+
+func Test_Checksum(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "saved-images.zip")
+	part := filepath.Join(dir, "saved-images.zip.part1")
+	assert.Nil(t, os.WriteFile(name, []byte("archive"), 0644))
+	assert.Nil(t, os.WriteFile(part, []byte("part"), 0644))
+
+	// Checksum file not exists.
+	verified, err := VerifyChecksum(name)
+	assert.Nil(t, err)
+	assert.False(t, verified)
+
+	assert.Nil(t, WriteChecksum(name, part))
+	b, err := os.ReadFile(ChecksumName(name))
+	assert.Nil(t, err)
+	assert.Equal(t, digest.FromString("archive").Encoded()+"  saved-images.zip\n"+
+		digest.FromString("part").Encoded()+"  saved-images.zip.part1\n", string(b))
+	verified, err = VerifyChecksum(name)
+	assert.Nil(t, err)
+	assert.True(t, verified)
+
+	// Corrupted part.
+	assert.Nil(t, os.WriteFile(part, []byte("corrupted"), 0644))
+	_, err = VerifyChecksum(name)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	// The checksum is not written for the directory.
+	assert.Nil(t, WriteChecksum(dir))
+	_, err = os.Stat(ChecksumName(dir))
+	assert.True(t, os.IsNotExist(err))
+}
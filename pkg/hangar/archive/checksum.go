@@ -0,0 +1,108 @@
+package archive
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// ChecksumName returns the name of the checksum file written beside the
+// archive file, example: saved-images.zip.sha256
+func ChecksumName(archiveName string) string {
+	return archiveName + ".sha256"
+}
+
+// WriteChecksum writes the SHA256 checksums of the archive file and its
+// parts (optional) into the checksum file in the 'sha256sum' format, the
+// files are recorded by their base names relative to the checksum file.
+// The checksum is not written for the unpacked archive directory.
+func WriteChecksum(archiveName string, parts ...string) error {
+	fi, err := os.Stat(archiveName)
+	if err != nil {
+		return fmt.Errorf("writeChecksum: %w", err)
+	}
+	if fi.IsDir() {
+		return nil
+	}
+	sb := strings.Builder{}
+	for _, name := range append([]string{archiveName}, parts...) {
+		sum, err := sha256File(name)
+		if err != nil {
+			return fmt.Errorf("writeChecksum: %w", err)
+		}
+		sb.WriteString(fmt.Sprintf("%s  %s\n", sum, filepath.Base(name)))
+	}
+	name := ChecksumName(archiveName)
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("writeChecksum: %w", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("writeChecksum: %w", err)
+	}
+	return nil
+}
+
+// VerifyChecksum verifies the files recorded in the checksum file of the
+// archive, returns false if the checksum file does not exist.
+func VerifyChecksum(archiveName string) (bool, error) {
+	f, err := os.Open(ChecksumName(archiveName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(archiveName)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" {
+			continue
+		}
+		expected, name, ok := strings.Cut(l, " ")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		if !ok || name == "" {
+			return false, fmt.Errorf("%q line %d: invalid checksum format",
+				ChecksumName(archiveName), n)
+		}
+		sum, err := sha256File(filepath.Join(dir, name))
+		if err != nil {
+			return false, err
+		}
+		if !strings.EqualFold(sum, expected) {
+			return false, fmt.Errorf("%w: %q: expected %v, got %v",
+				ErrChecksumMismatch, name, expected, sum)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func sha256File(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read %q: %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
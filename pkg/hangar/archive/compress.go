@@ -0,0 +1,143 @@
+package archive
+
+import (
+	"io"
+	"runtime"
+	"sync"
+)
+
+const (
+	// gzipBlockSize is the block size of the parallel gzip compression.
+	gzipBlockSize = 1 << 20
+	// stagingChunkSize is the size of the chunks read ahead from the
+	// blob files.
+	stagingChunkSize = 256 << 10
+	// DefaultStagingSize is the default size of the buffered blob staging.
+	DefaultStagingSize = 8 << 20
+)
+
+// CompressOpts is the options of the archive compression pipeline.
+type CompressOpts struct {
+	// Workers is the number of goroutines compressing the tar.gz and
+	// tar.zst archives in parallel, the number of CPUs if not positive.
+	Workers int
+	// StagingSize is the size of the blob data read ahead from the cache
+	// dir while the previous data is being compressed, so the disk reads
+	// overlap with the compression. DefaultStagingSize if 0, disabled if
+	// negative.
+	StagingSize int
+}
+
+func (o *CompressOpts) workers() int {
+	if o == nil || o.Workers <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return o.Workers
+}
+
+func (o *CompressOpts) stagingSize() int {
+	if o == nil || o.StagingSize == 0 {
+		return DefaultStagingSize
+	}
+	return o.StagingSize
+}
+
+// stagingPool is the chunk buffers of the staged readers.
+var stagingPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, stagingChunkSize)
+		return &b
+	},
+}
+
+type stagingChunk struct {
+	buf *[]byte
+	n   int
+	err error
+}
+
+// stagedReader reads the file in background into the bounded staging
+// chunks, the reads of the next chunks are not blocked by the consumer
+// until the staging is full.
+type stagedReader struct {
+	ch   chan *stagingChunk
+	done chan struct{}
+	once sync.Once
+
+	cur *stagingChunk
+	off int
+}
+
+// newStagedReader stages the data of the reader in background, returns
+// the reader itself if the staging is disabled. The reader should be
+// closed by the staged reader after finished.
+func newStagedReader(r io.Reader, size int) io.ReadCloser {
+	if size <= 0 {
+		return io.NopCloser(r)
+	}
+	n := size / stagingChunkSize
+	if n < 1 {
+		n = 1
+	}
+	s := &stagedReader{
+		ch:   make(chan *stagingChunk, n),
+		done: make(chan struct{}),
+	}
+	go s.stage(r)
+	return s
+}
+
+func (s *stagedReader) stage(r io.Reader) {
+	defer close(s.ch)
+	for {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		buf := stagingPool.Get().(*[]byte)
+		n, err := io.ReadFull(r, *buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		select {
+		case s.ch <- &stagingChunk{buf: buf, n: n, err: err}:
+		case <-s.done:
+			stagingPool.Put(buf)
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *stagedReader) Read(p []byte) (int, error) {
+	for s.cur == nil || s.off == s.cur.n {
+		if s.cur != nil {
+			if s.cur.err != nil {
+				return 0, s.cur.err
+			}
+			stagingPool.Put(s.cur.buf)
+		}
+		c, ok := <-s.ch
+		if !ok {
+			return 0, io.ErrClosedPipe
+		}
+		s.cur, s.off = c, 0
+	}
+	n := copy(p, (*s.cur.buf)[s.off:s.cur.n])
+	s.off += n
+	return n, nil
+}
+
+// Close stops staging and waits for the background reads finished.
+func (s *stagedReader) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+		for c := range s.ch {
+			stagingPool.Put(c.buf)
+		}
+	})
+	return nil
+}
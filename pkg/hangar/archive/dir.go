@@ -0,0 +1,200 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Layout is the representation of the saved images.
+type Layout string
+
+const (
+	// LayoutArchive saves images into the archive file, the archive format
+	// is detected by the file name extension.
+	LayoutArchive Layout = "archive"
+	// LayoutDir saves images into the unpacked directory with the
+	// content-addressed blob dir and index file, which is designed for
+	// distribution over NFS/rsync.
+	LayoutDir Layout = "dir"
+)
+
+// ParseLayout parses the layout name, returns error if unsupported.
+func ParseLayout(s string) (Layout, error) {
+	switch Layout(s) {
+	case "", LayoutArchive:
+		return LayoutArchive, nil
+	case LayoutDir:
+		return LayoutDir, nil
+	}
+	return "", fmt.Errorf("unsupported layout %q, available: %v, %v",
+		s, LayoutArchive, LayoutDir)
+}
+
+// DirWriter writes files into the unpacked archive directory,
+// files are hardlinked if possible.
+type DirWriter struct {
+	dir string
+	// deterministic sets the fixed timestamps to the written files
+	deterministic bool
+}
+
+// NewDirWriter constructs a new DirWriter object, the existing blobs in
+// the directory are reused since they are content-addressed.
+func NewDirWriter(name string) (*DirWriter, error) {
+	if err := os.MkdirAll(name, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %q: %w", name, err)
+	}
+	return &DirWriter{
+		dir: name,
+	}, nil
+}
+
+// Write writes a single file or a directory (recursive) to the directory.
+func (w *DirWriter) Write(name string) error {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if fi.Mode().IsRegular() {
+		target := filepath.Join(w.dir, name)
+		if err := linkFile(name, target, false); err != nil {
+			return err
+		}
+		return w.chtimes(target)
+	}
+
+	err = filepath.Walk(name, func(p string, fi os.FileInfo, e error) error {
+		if e != nil {
+			logrus.Warnf("writeDir: failed to open %s: %v", p, e)
+			return nil
+		}
+		rel, err := filepath.Rel(name, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		target := filepath.Join(w.dir, rel)
+		if fi.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		logrus.Debugf("link file: %v", rel)
+		if err := linkFile(p, target, false); err != nil {
+			return err
+		}
+		return w.chtimes(target)
+	})
+	if err != nil {
+		return fmt.Errorf("writeDir walk: %w", err)
+	}
+	return nil
+}
+
+// WriteIndex writes the index json file into the directory.
+func (w *DirWriter) WriteIndex(index *Index) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("writeIndex: %w", err)
+	}
+	name := filepath.Join(w.dir, IndexFileName)
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("writeIndex: %w", err)
+	}
+	if err := w.chtimes(tmp); err != nil {
+		return fmt.Errorf("writeIndex: %w", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("writeIndex: %w", err)
+	}
+	logrus.Infof("Write index file %q to [%s], size %.2fK",
+		IndexFileName, w.dir, float32(len(data))/1024)
+	return nil
+}
+
+func (w *DirWriter) setDeterministic() {
+	w.deterministic = true
+}
+
+// chtimes sets the fixed timestamps to the file in the deterministic mode.
+func (w *DirWriter) chtimes(name string) error {
+	if !w.deterministic {
+		return nil
+	}
+	return os.Chtimes(name, FixedModTime, FixedModTime)
+}
+
+func (w *DirWriter) Close() error {
+	return nil
+}
+
+// linkFile hardlinks the src file to the dst, the file is copied if
+// hardlink is not supported (e.g. cross-device). The existing dst file is
+// kept unless replace is true.
+func linkFile(src, dst string, replace bool) error {
+	if _, err := os.Lstat(dst); err == nil {
+		if !replace {
+			return nil
+		}
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	err := os.Link(src, dst)
+	if err == nil {
+		return nil
+	}
+	logrus.Debugf("failed to link %q, fallback to copy: %v", src, err)
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %w", src, err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %q: %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("io.Copy: %w", err)
+	}
+	return out.Close()
+}
+
+// extractDir links the file/directory in the unpacked archive directory
+// to the destination in the same way as decompressing it from zip.
+func extractDir(dir, name, destination string) error {
+	src := filepath.Join(dir, filepath.FromSlash(name))
+	fi, err := os.Stat(src)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return os.ErrNotExist
+		}
+		return err
+	}
+	if fi.Mode().IsRegular() {
+		return linkFile(src, filepath.Join(destination, filepath.Base(src)), true)
+	}
+	return filepath.Walk(src, func(p string, fi os.FileInfo, e error) error {
+		if e != nil {
+			return e
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, rel)
+		if fi.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		logrus.Debugf("extract: %v", target)
+		return linkFile(p, target, true)
+	})
+}
@@ -0,0 +1,138 @@
+package archive
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Format is the file format of the Hangar archive.
+type Format string
+
+const (
+	FormatZip     Format = "zip"
+	FormatTar     Format = "tar"
+	FormatTarGzip Format = "tar.gz"
+	FormatTarZstd Format = "tar.zst"
+)
+
+// DetectFormat detects the archive format by the file name extension,
+// the zip format is used if the extension is unknown.
+func DetectFormat(name string) Format {
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return FormatTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return FormatTarGzip
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return FormatTarZstd
+	}
+	return FormatZip
+}
+
+// fileWriter writes the image files and the index into the archive.
+type fileWriter interface {
+	Write(name string) error
+	WriteIndex(index *Index) error
+	Close() error
+	setDeterministic()
+}
+
+// MultiWriter writes the same files into multiple archive files in
+// different formats.
+type MultiWriter struct {
+	names   []string
+	writers []fileWriter
+}
+
+// NewMultiWriter creates the archive files in the format detected by
+// their file names, or the unpacked archive directories if the layout is
+// LayoutDir. The compression options are optional.
+func NewMultiWriter(layout Layout, opts *CompressOpts, names ...string) (*MultiWriter, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no archive file name provided")
+	}
+	mw := &MultiWriter{}
+	for _, name := range names {
+		var (
+			w   fileWriter
+			err error
+		)
+		switch {
+		case layout == LayoutDir:
+			w, err = NewDirWriter(name)
+		case DetectFormat(name) == FormatZip:
+			w, err = NewWriter(name, opts)
+		default:
+			w, err = NewTarWriter(name, opts)
+		}
+		if err != nil {
+			mw.Close()
+			return nil, err
+		}
+		mw.names = append(mw.names, name)
+		mw.writers = append(mw.writers, w)
+	}
+	return mw, nil
+}
+
+// Write writes a single file or a directory (recursive) to all archives,
+// the archives are written in parallel, so the compression of an archive
+// does not block the others.
+func (mw *MultiWriter) Write(name string) error {
+	if len(mw.writers) == 1 {
+		if err := mw.writers[0].Write(name); err != nil {
+			return fmt.Errorf("failed to write %q: %w", mw.names[0], err)
+		}
+		return nil
+	}
+	errs := make([]error, len(mw.writers))
+	wg := &sync.WaitGroup{}
+	for i, w := range mw.writers {
+		wg.Add(1)
+		go func(i int, w fileWriter) {
+			defer wg.Done()
+			errs[i] = w.Write(name)
+		}(i, w)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("failed to write %q: %w", mw.names[i], err)
+		}
+	}
+	return nil
+}
+
+// WriteIndex writes the index file into all archives.
+func (mw *MultiWriter) WriteIndex(index *Index) error {
+	for i, w := range mw.writers {
+		if err := w.WriteIndex(index); err != nil {
+			return fmt.Errorf("failed to write index of %q: %w", mw.names[i], err)
+		}
+	}
+	return nil
+}
+
+// SetDeterministic writes the files with fixed timestamps, so the archive
+// output is identical for the identical input files in the same order.
+func (mw *MultiWriter) SetDeterministic() {
+	for _, w := range mw.writers {
+		w.setDeterministic()
+	}
+}
+
+// Close closes all archive files and returns the first error.
+func (mw *MultiWriter) Close() error {
+	if mw == nil {
+		return nil
+	}
+	var err error
+	for i, w := range mw.writers {
+		if e := w.Close(); e != nil && err == nil {
+			err = fmt.Errorf("failed to close %q: %w", mw.names[i], e)
+		}
+	}
+	mw.writers = nil
+	return err
+}
@@ -3,6 +3,7 @@ package archive
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/cnrancher/hangar/pkg/utils"
@@ -18,6 +19,9 @@ type Index struct {
 	List    []*Image  `json:"list,omitempty" yaml:"list,omitempty"`
 	Version string    `json:"version,omitempty" yaml:"version.omitempty"`
 	Time    time.Time `json:"time,omitempty" yaml:"omitempty"`
+	// SkippedBlobs is the image layers not saved into the archive,
+	// which are expected to be present on the destination out-of-band.
+	SkippedBlobs []digest.Digest `json:"skippedBlobs,omitempty" yaml:"skippedBlobs,omitempty"`
 
 	digestSet map[digest.Digest]bool
 }
@@ -28,6 +32,8 @@ type Image struct {
 	ArchList []string    `json:"archList,omitempty" yaml:"archList,omitempty"`
 	OsList   []string    `json:"osList,omitempty" yaml:"osList,omitempty"`
 	Images   []ImageSpec `json:"images,omitempty" yaml:"images,omitempty"`
+	// Artifacts is the signatures and attestations of the images.
+	Artifacts []Artifact `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
 }
 
 type ImageSpec struct {
@@ -40,6 +46,28 @@ type ImageSpec struct {
 	Layers     []digest.Digest `json:"layers,omitempty" yaml:"layers,omitempty"`
 	Config     digest.Digest   `json:"config,omitempty" yaml:"config,omitempty"`
 	Digest     digest.Digest   `json:"digest,omitempty" yaml:"digest,omitempty"`
+	// SourceDigest is the source manifest digest if the destination
+	// registry rewrote the manifest on push and changed the digest.
+	SourceDigest digest.Digest `json:"sourceDigest,omitempty" yaml:"sourceDigest,omitempty"`
+	// Annotations is the annotations of the attestation manifest descriptor.
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
+
+// Artifact is the cosign signature, attestation or SBOM artifact of the
+// image saved into the archive, the OCI image directory of the artifact is
+// stored as the platform images.
+type Artifact struct {
+	ImageSpec `yaml:",inline"`
+	// Subject is the manifest digest of the image referred by the artifact.
+	Subject digest.Digest `json:"subject,omitempty" yaml:"subject,omitempty"`
+	// Tag is the tag of the cosign tag-based artifact, e.g.
+	// 'sha256-<encoded>.sig', empty if the artifact is the OCI referrer
+	// of the subject image.
+	Tag string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	// ArtifactType is the artifact type of the OCI referrer.
+	ArtifactType string `json:"artifactType,omitempty" yaml:"artifactType,omitempty"`
+	// Size is the size of the artifact manifest.
+	Size int64 `json:"size,omitempty" yaml:"size,omitempty"`
 }
 
 func NewIndex() *Index {
@@ -123,6 +151,42 @@ func (i *Index) HasReference(project, name, tag string) bool {
 	return false
 }
 
+// SkipBlob records the image layer not saved into the archive.
+func (i *Index) SkipBlob(d digest.Digest) {
+	for _, b := range i.SkippedBlobs {
+		if b == d {
+			return
+		}
+	}
+	i.SkippedBlobs = append(i.SkippedBlobs, d)
+}
+
+// PartialIndexName returns the name of the partial index file written
+// beside the archive file, example: saved-images.zip.index.json
+func PartialIndexName(archiveName string) string {
+	return archiveName + "." + IndexFileName
+}
+
+// WritePartialIndex writes the index of the images already written into
+// the archive beside the archive file, the partial index file is replaced
+// atomically to let external monitors read the progress safely.
+func WritePartialIndex(archiveName string, index *Index) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("writePartialIndex: %w", err)
+	}
+	name := PartialIndexName(archiveName)
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("writePartialIndex: %w", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("writePartialIndex: %w", err)
+	}
+	return nil
+}
+
 // CompareIndexVersion compares the loaded index version with current version.
 func CompareIndexVersion(index *Index) error {
 	res, err := utils.SemverCompare(index.Version, IndexVersion)
@@ -8,21 +8,36 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/STARRY-S/zip"
 	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 )
 
 type Reader struct {
 	f  *os.File
 	zr *zip.Reader
+	// dir is the unpacked archive directory, empty if reading zip file
+	dir string
+	// blobs is the shared blob files of the zip archive
+	blobs     map[digest.Digest]*zip.File
+	blobsOnce sync.Once
 }
 
-// NewReader constructs a new Archive Reader object.
+// NewReader constructs a new Archive Reader object, the name can be the
+// zip archive file or the unpacked archive directory.
 // Needs to call Close() method to release resource after usage.
 func NewReader(name string) (*Reader, error) {
 	reader := &Reader{}
+	if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+		reader.dir = name
+		if err := reader.validateIndex(); err != nil {
+			return nil, err
+		}
+		return reader, nil
+	}
 	f, err := os.Open(name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
@@ -61,6 +76,9 @@ func (r *Reader) validateIndex() error {
 }
 
 func (r *Reader) Index() ([]byte, error) {
+	if r.dir != "" {
+		return os.ReadFile(filepath.Join(r.dir, IndexFileName))
+	}
 	var f *zip.File
 	for _, file := range r.zr.File {
 		if file.Name == IndexFileName {
@@ -87,6 +105,9 @@ func (r *Reader) Index() ([]byte, error) {
 
 // Decompress decompresses the file/directory in archive.
 func (r *Reader) Decompress(name string, destination string) error {
+	if r.dir != "" {
+		return extractDir(r.dir, name, destination)
+	}
 	var file *zip.File
 	for _, f := range r.zr.File {
 		if f.Name != name {
@@ -176,6 +197,143 @@ func (r *Reader) DecompressImageTmp(
 	return tmpDir, nil
 }
 
+// BlobSizes returns the uncompressed size of the shared blobs in archive,
+// the key of the returned map is the blob digest (ALGORITHM:ENCODED).
+func (r *Reader) BlobSizes() map[digest.Digest]int64 {
+	sizes := make(map[digest.Digest]int64)
+	if r.dir != "" {
+		root := filepath.Join(r.dir, SharedBlobDir)
+		filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return nil
+			}
+			// share/ALGORITHM/ENCODED
+			algorithm := filepath.Base(filepath.Dir(p))
+			sizes[digest.NewDigestFromEncoded(
+				digest.Algorithm(algorithm), fi.Name())] = fi.Size()
+			return nil
+		})
+		return sizes
+	}
+	prefix := SharedBlobDir + "/"
+	for _, f := range r.zr.File {
+		if !strings.HasPrefix(f.Name, prefix) || f.Mode().IsDir() {
+			continue
+		}
+		// share/ALGORITHM/ENCODED
+		algorithm, encoded, ok := strings.Cut(strings.TrimPrefix(f.Name, prefix), "/")
+		if !ok {
+			continue
+		}
+		sizes[digest.NewDigestFromEncoded(digest.Algorithm(algorithm), encoded)] =
+			int64(f.UncompressedSize64)
+	}
+	return sizes
+}
+
+// blobFile returns the shared blob file of the zip archive.
+func (r *Reader) blobFile(d digest.Digest) *zip.File {
+	r.blobsOnce.Do(func() {
+		r.blobs = make(map[digest.Digest]*zip.File)
+		prefix := SharedBlobDir + "/"
+		for _, f := range r.zr.File {
+			if !strings.HasPrefix(f.Name, prefix) || f.Mode().IsDir() {
+				continue
+			}
+			// share/ALGORITHM/ENCODED
+			algorithm, encoded, ok := strings.Cut(strings.TrimPrefix(f.Name, prefix), "/")
+			if !ok {
+				continue
+			}
+			r.blobs[digest.NewDigestFromEncoded(digest.Algorithm(algorithm), encoded)] = f
+		}
+	})
+	return r.blobs[d]
+}
+
+// StoredBlob returns true if the shared blob is stored in the archive
+// verbatim (without the zip compression), which can be streamed to the
+// destination registry directly by OpenBlob without decompressing.
+func (r *Reader) StoredBlob(d digest.Digest) bool {
+	if d.Validate() != nil {
+		return false
+	}
+	if r.dir != "" {
+		fi, err := os.Stat(filepath.Join(r.dir, SharedBlobDir, d.Algorithm().String(), d.Encoded()))
+		return err == nil && fi.Mode().IsRegular()
+	}
+	f := r.blobFile(d)
+	return f != nil && f.Method == zip.Store
+}
+
+// OpenBlob opens the shared blob stored in the archive verbatim, returns
+// false if the blob does not exist, is compressed by zip or its size
+// mismatch (size is -1 if unknown).
+// The blob digest is verified by the image copy when reading.
+func (r *Reader) OpenBlob(d digest.Digest, size int64) (io.ReadCloser, int64, bool) {
+	if !r.StoredBlob(d) {
+		return nil, 0, false
+	}
+	if r.dir != "" {
+		f, err := os.Open(filepath.Join(r.dir, SharedBlobDir, d.Algorithm().String(), d.Encoded()))
+		if err != nil {
+			return nil, 0, false
+		}
+		fi, err := f.Stat()
+		if err != nil || size >= 0 && fi.Size() != size {
+			f.Close()
+			return nil, 0, false
+		}
+		return f, fi.Size(), true
+	}
+	f := r.blobFile(d)
+	if size >= 0 && int64(f.UncompressedSize64) != size {
+		return nil, 0, false
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, 0, false
+	}
+	logrus.Debugf("stream blob [%v] from archive", d)
+	return rc, int64(f.UncompressedSize64), true
+}
+
+// ReadBlob reads the shared blob of the archive (e.g. the manifest and
+// the config) into memory and verifies the digest, the blob can be
+// compressed by zip.
+func (r *Reader) ReadBlob(d digest.Digest) ([]byte, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	var (
+		rc  io.ReadCloser
+		err error
+	)
+	if r.dir != "" {
+		rc, err = os.Open(filepath.Join(r.dir, SharedBlobDir, d.Algorithm().String(), d.Encoded()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open blob %v: %w", d, err)
+		}
+	} else {
+		f := r.blobFile(d)
+		if f == nil {
+			return nil, fmt.Errorf("blob %v not found in archive", d)
+		}
+		if rc, err = f.Open(); err != nil {
+			return nil, fmt.Errorf("failed to open blob %v: %w", d, err)
+		}
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %v: %w", d, err)
+	}
+	if d.Algorithm().FromBytes(b) != d {
+		return nil, fmt.Errorf("blob %v: digest mismatch", d)
+	}
+	return b, nil
+}
+
 func (r *Reader) Close() error {
 	if r == nil {
 		return nil
@@ -193,6 +351,21 @@ func (r *Reader) Close() error {
 }
 
 func (r *Reader) Ls() {
+	if r.dir != "" {
+		filepath.Walk(r.dir, func(p string, fi os.FileInfo, err error) error {
+			if err != nil || p == r.dir {
+				return nil
+			}
+			var t = "r"
+			if fi.IsDir() {
+				t = "d"
+			}
+			rel, _ := filepath.Rel(r.dir, p)
+			logrus.Infof(" %v %v", t, filepath.ToSlash(rel))
+			return nil
+		})
+		return
+	}
 	for _, f := range r.zr.File {
 		var t = " "
 		switch {
@@ -0,0 +1,204 @@
+package archive
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/sirupsen/logrus"
+)
+
+// TarWriter creates a new Hangar archive in tar format (optionally
+// compressed by gzip or zstd) and write files into it.
+type TarWriter struct {
+	f  *os.File
+	cw io.WriteCloser // compress writer, nil if not compressed
+	tw *tar.Writer
+	// deterministic writes the files with fixed timestamps
+	deterministic bool
+	// stagingSize is the size of the blob data read ahead
+	stagingSize int
+}
+
+// NewTarWriter constructs a new TarWriter object, the compression is
+// detected by the file name extension and runs in parallel by the
+// compression options (optional).
+func NewTarWriter(name string, opts *CompressOpts) (*TarWriter, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %q: %w", name, err)
+	}
+
+	w := &TarWriter{
+		f:           f,
+		stagingSize: opts.stagingSize(),
+	}
+	// Use the stable compression settings, so the output is identical
+	// for the identical input regardless of the number of workers.
+	switch DetectFormat(name) {
+	case FormatTarGzip:
+		gw, err := pgzip.NewWriterLevel(f, pgzip.DefaultCompression)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create gzip writer: %w", err)
+		}
+		if err := gw.SetConcurrency(gzipBlockSize, opts.workers()); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create gzip writer: %w", err)
+		}
+		w.cw = gw
+	case FormatTarZstd:
+		w.cw, err = zstd.NewWriter(f,
+			zstd.WithEncoderLevel(zstd.SpeedDefault),
+			zstd.WithEncoderConcurrency(opts.workers()))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+	}
+	if w.cw != nil {
+		w.tw = tar.NewWriter(w.cw)
+	} else {
+		w.tw = tar.NewWriter(f)
+	}
+	logrus.Debugf("create tar archive %q: compress workers %d, staging size %d",
+		name, opts.workers(), w.stagingSize)
+	return w, nil
+}
+
+// Write writes a single file or a directory (recursive) to archive file.
+func (w *TarWriter) Write(name string) error {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if fi.Mode().IsRegular() {
+		return w.writeFile(name, name, fi)
+	}
+
+	return w.writeDir(name)
+}
+
+func (w *TarWriter) writeFile(name, fname string, fi fs.FileInfo) error {
+	if err := w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     filepath.ToSlash(fname),
+		Size:     fi.Size(),
+		Mode:     0644,
+		ModTime:  w.modTime(fi.ModTime()),
+	}); err != nil {
+		return fmt.Errorf("tar write header failed: %w", err)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %w", name, err)
+	}
+	defer file.Close()
+	r := newStagedReader(file, w.stagingSize)
+	defer r.Close()
+	if _, err = io.Copy(w.tw, r); err != nil {
+		return fmt.Errorf("failed to copy data: %w", err)
+	}
+	return nil
+}
+
+func (w *TarWriter) writeDir(base string) error {
+	err := filepath.Walk(base, func(name string, fi os.FileInfo, e error) error {
+		if e != nil {
+			logrus.Warnf("writeDir: failed to open %s: %v", name, e)
+			return nil
+		}
+
+		fname := strings.TrimPrefix(name, base)
+		fname = strings.TrimPrefix(fname, string(os.PathSeparator))
+		if fname == "" {
+			return nil
+		}
+		if !fi.IsDir() {
+			logrus.Debugf("archive file: %v", fname)
+			return w.writeFile(name, fname, fi)
+		}
+		logrus.Debugf("archive dir: %v", fname)
+		if err := w.tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     filepath.ToSlash(fname) + "/",
+			Mode:     0755,
+			ModTime:  w.modTime(fi.ModTime()),
+		}); err != nil {
+			return fmt.Errorf("tar write header failed: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("writeDir walk: %w", err)
+	}
+
+	return w.tw.Flush()
+}
+
+// WriteIndex writes the index json file into the end of the tar archive.
+func (w *TarWriter) WriteIndex(index *Index) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("writeIndex: %w", err)
+	}
+	if err := w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     IndexFileName,
+		Size:     int64(len(data)),
+		Mode:     0644,
+		ModTime:  w.modTime(time.Now()),
+	}); err != nil {
+		return fmt.Errorf("writeIndex: failed to create file in tar: %w", err)
+	}
+	if _, err = w.tw.Write(data); err != nil {
+		return fmt.Errorf("writeIndex: tar write failed: %w", err)
+	}
+	logrus.Infof("Write index file %q to [%s], size %.2fK",
+		IndexFileName, w.f.Name(), float32(len(data))/1024)
+	return nil
+}
+
+func (w *TarWriter) setDeterministic() {
+	w.deterministic = true
+}
+
+func (w *TarWriter) modTime(t time.Time) time.Time {
+	if w.deterministic {
+		return FixedModTime
+	}
+	return t
+}
+
+func (w *TarWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+	if w.tw != nil {
+		if err := w.tw.Close(); err != nil {
+			return err
+		}
+		w.tw = nil
+	}
+	if w.cw != nil {
+		if err := w.cw.Close(); err != nil {
+			return err
+		}
+		w.cw = nil
+	}
+	if w.f != nil {
+		if err := w.f.Close(); err != nil {
+			return err
+		}
+		w.f = nil
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/STARRY-S/zip"
 	"github.com/sirupsen/logrus"
@@ -17,18 +18,25 @@ import (
 type Writer struct {
 	f  *os.File
 	zw *zip.Writer
+	// deterministic writes the files with fixed timestamps
+	deterministic bool
+	// stagingSize is the size of the blob data read ahead
+	stagingSize int
 }
 
-// NewWriter constructs a new Writer object.
-func NewWriter(name string) (*Writer, error) {
+// NewWriter constructs a new Writer object, the files are stored without
+// compression, only the staging size of the compression options
+// (optional) is used.
+func NewWriter(name string, opts *CompressOpts) (*Writer, error) {
 	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file %q: %w", name, err)
 	}
 
 	return &Writer{
-		f:  f,
-		zw: zip.NewWriter(f),
+		f:           f,
+		zw:          zip.NewWriter(f),
+		stagingSize: opts.stagingSize(),
 	}, nil
 }
 
@@ -50,7 +58,7 @@ func (w *Writer) writeFile(name string, fi fs.FileInfo) error {
 	writer, err := w.zw.CreateHeader(&zip.FileHeader{
 		Name:     name,
 		Method:   zip.Store,
-		Modified: fi.ModTime(),
+		Modified: w.modTime(fi.ModTime()),
 	})
 	if err != nil {
 		return fmt.Errorf("zip create failed: %w", err)
@@ -60,7 +68,9 @@ func (w *Writer) writeFile(name string, fi fs.FileInfo) error {
 		return fmt.Errorf("failed to open %q: %w", name, err)
 	}
 	defer file.Close()
-	_, err = io.Copy(writer, file)
+	r := newStagedReader(file, w.stagingSize)
+	defer r.Close()
+	_, err = io.Copy(writer, r)
 	if err != nil {
 		return fmt.Errorf("failed to copy data: %w", err)
 	}
@@ -86,7 +96,7 @@ func (w *Writer) writeDir(base string) error {
 		writer, err := w.zw.CreateHeader(&zip.FileHeader{
 			Name:     fname,
 			Method:   zip.Store,
-			Modified: fi.ModTime(),
+			Modified: w.modTime(fi.ModTime()),
 		})
 		if err != nil {
 			return fmt.Errorf("zip create failed: %w", err)
@@ -99,7 +109,10 @@ func (w *Writer) writeDir(base string) error {
 		if err != nil {
 			return fmt.Errorf("failed to open %q: %w", fname, err)
 		}
-		_, err = io.Copy(writer, file)
+		r := newStagedReader(file, w.stagingSize)
+		_, err = io.Copy(writer, r)
+		r.Close()
+		file.Close()
 		if err != nil {
 			return fmt.Errorf("failed to copy data: %w", err)
 		}
@@ -136,6 +149,17 @@ func (w *Writer) WriteIndex(index *Index) error {
 	return nil
 }
 
+func (w *Writer) setDeterministic() {
+	w.deterministic = true
+}
+
+func (w *Writer) modTime(t time.Time) time.Time {
+	if w.deterministic {
+		return FixedModTime
+	}
+	return t
+}
+
 func (w *Writer) Close() error {
 	if w == nil {
 		return nil
@@ -0,0 +1,36 @@
+package hangar
+
+import (
+	"context"
+
+	"github.com/cnrancher/hangar/pkg/audit"
+	"github.com/cnrancher/hangar/pkg/manifest"
+)
+
+// recordAudit records the write operation to the registry into the
+// audit log.
+func recordAudit(
+	ctx context.Context, action, src, dest string, digests []string, err error,
+) {
+	e := &audit.Event{
+		Action:  action,
+		Source:  src,
+		Image:   dest,
+		Digests: digests,
+		Result:  audit.ResultSucceeded,
+	}
+	if err != nil {
+		e.Result = audit.ResultFailed
+		e.Error = err.Error()
+	}
+	audit.Record(ctx, e)
+}
+
+// manifestDigests returns the digests of the manifest images.
+func manifestDigests(images manifest.Images) []string {
+	digests := make([]string, 0, len(images))
+	for _, img := range images {
+		digests = append(digests, img.Digest.String())
+	}
+	return digests
+}
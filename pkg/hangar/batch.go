@@ -0,0 +1,58 @@
+package hangar
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// batchThreshold is the number of images to enable the batch flush
+	// automatically if the batch size is not specified.
+	batchThreshold = 10000
+	// defaultBatchSize is the batch size of the automatic batch flush.
+	defaultBatchSize = 1000
+)
+
+// resolveBatchSize returns the number of images of each batch,
+// returns 0 if the batch flush is disabled.
+func resolveBatchSize(size, total int) int {
+	switch {
+	case size > 0:
+		return size
+	case size < 0:
+		return 0
+	case total > batchThreshold:
+		return defaultBatchSize
+	}
+	return 0
+}
+
+// batchDone counts the image processed by worker and flushes the
+// intermediate artifacts when a batch of images finished, so a crash
+// loses at most one batch.
+func (c *common) batchDone() {
+	if c.batchSize <= 0 {
+		return
+	}
+	n := c.processed.Add(1)
+	if n%int64(c.batchSize) != 0 {
+		return
+	}
+	c.flushBatch(int(n))
+}
+
+// flushBatch writes the failed image list and the archive index
+// (if available) of the images processed so far.
+func (c *common) flushBatch(processed int) {
+	c.flushMutex.Lock()
+	defer c.flushMutex.Unlock()
+
+	if err := c.SaveFailedImages(); err != nil {
+		logrus.Warnf("Failed to flush failed image list: %v", err)
+	}
+	if c.flushIndex != nil {
+		if err := c.flushIndex(); err != nil {
+			logrus.Warnf("Failed to flush archive index: %v", err)
+		}
+	}
+	logrus.Infof("Batch flushed: %d/%d images processed", processed, c.total)
+}
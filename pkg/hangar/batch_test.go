@@ -0,0 +1,42 @@
+package hangar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_resolveBatchSize(t *testing.T) {
+	assert.Equal(t, 0, resolveBatchSize(0, 100))
+	assert.Equal(t, 0, resolveBatchSize(0, batchThreshold))
+	assert.Equal(t, defaultBatchSize, resolveBatchSize(0, batchThreshold+1))
+	assert.Equal(t, 50, resolveBatchSize(50, 100))
+	assert.Equal(t, 0, resolveBatchSize(-1, batchThreshold+1))
+}
+
+func Test_batchDone(t *testing.T) {
+	failed := filepath.Join(t.TempDir(), "failed.txt")
+	var flushed int
+	c := newTestCommon(t)
+	c.total = 5
+	c.batchSize = 2
+	c.failedImageSet["nginx"] = true
+	c.failedImageListName = failed
+	c.flushIndex = func() error {
+		flushed++
+		return nil
+	}
+	for i := 0; i < 5; i++ {
+		c.batchDone()
+	}
+	assert.Equal(t, 2, flushed)
+	b, err := os.ReadFile(failed)
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx\n", string(b))
+
+	c.batchSize = 0
+	c.batchDone()
+	assert.Equal(t, 2, flushed)
+}
@@ -0,0 +1,92 @@
+package hangar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ChangeReason is the reason why the destination image does not match
+// the desired state.
+type ChangeReason string
+
+const (
+	// ChangeMissing means the destination image does not exist.
+	ChangeMissing ChangeReason = "missing"
+	// ChangeOutdated means the destination image exists but some
+	// platforms (digests) are missing.
+	ChangeOutdated ChangeReason = "outdated"
+	// ChangeCorrupted means the destination blobs do not match their
+	// digests, found by the deep verify mode.
+	ChangeCorrupted ChangeReason = "corrupted"
+)
+
+// ErrChangesDetected is returned when the destination does not match the
+// desired state in detect-changes mode.
+var ErrChangesDetected = errors.New("changes detected")
+
+// Change represents a single difference between the image list
+// and the destination.
+type Change struct {
+	Source      string       `json:"source"`
+	Destination string       `json:"destination,omitempty"`
+	Reason      ChangeReason `json:"reason"`
+}
+
+// ChangeDetector compares the destination with the desired state
+// without copying images.
+type ChangeDetector interface {
+	DetectChanges(ctx context.Context) ([]Change, error)
+}
+
+// mismatchError is the validate error caused by the destination image
+// does not match the source image.
+type mismatchError struct {
+	reason ChangeReason
+	msg    string
+}
+
+func newMismatchError(reason ChangeReason, format string, a ...any) error {
+	return &mismatchError{
+		reason: reason,
+		msg:    fmt.Sprintf(format, a...),
+	}
+}
+
+func (e *mismatchError) Error() string {
+	return e.msg
+}
+
+// recordChange records the change if the error is a mismatchError and
+// the detect-changes mode is enabled, returns false if not recorded.
+func (c *common) recordChange(err error, src, dest string) bool {
+	if !c.detectChanges {
+		return false
+	}
+	var e *mismatchError
+	if !errors.As(err, &e) {
+		return false
+	}
+	c.changesMutex.Lock()
+	c.changes = append(c.changes, Change{
+		Source:      src,
+		Destination: dest,
+		Reason:      e.reason,
+	})
+	c.changesMutex.Unlock()
+	return true
+}
+
+// Changes returns the sorted changes recorded in detect-changes mode.
+func (c *common) Changes() []Change {
+	c.changesMutex.Lock()
+	defer c.changesMutex.Unlock()
+
+	changes := make([]Change, len(c.changes))
+	copy(changes, c.changes)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Source < changes[j].Source
+	})
+	return changes
+}
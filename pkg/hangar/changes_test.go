@@ -0,0 +1,29 @@
+package hangar
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_recordChange(t *testing.T) {
+	c := newTestCommon(t)
+	missing := newMismatchError(ChangeMissing, "FAILED: [%v]", "busybox")
+	// Not recorded if the detect-changes mode is disabled.
+	assert.False(t, c.recordChange(missing, "busybox", "reg.io/library/busybox"))
+
+	c.detectChanges = true
+	// The errors other than the mismatch are not changes.
+	assert.False(t, c.recordChange(errors.New("connection refused"), "alpine", ""))
+	assert.True(t, c.recordChange(
+		fmt.Errorf("validate failed: %w", newMismatchError(ChangeOutdated, "FAILED: [%v]", "nginx")),
+		"nginx", "reg.io/library/nginx"))
+	assert.True(t, c.recordChange(missing, "busybox", "reg.io/library/busybox"))
+
+	assert.Equal(t, []Change{
+		{Source: "busybox", Destination: "reg.io/library/busybox", Reason: ChangeMissing},
+		{Source: "nginx", Destination: "reg.io/library/nginx", Reason: ChangeOutdated},
+	}, c.Changes())
+}
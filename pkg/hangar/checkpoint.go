@@ -0,0 +1,189 @@
+package hangar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/cnrancher/hangar/pkg/statedb"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// checkpointInterval is the interval of writing the checkpoint file.
+	checkpointInterval = 30 * time.Second
+	// checkpointFileName is the checkpoint file name in the resume dir.
+	checkpointFileName = "checkpoint.json"
+	// checkpointVersion is the version of the checkpoint file.
+	checkpointVersion = 1
+)
+
+// Checkpoint records the images completed by the interrupted save/sync job,
+// the completed images are not copied again when the job resumed.
+type Checkpoint struct {
+	Version int                         `json:"version"`
+	Images  map[string]*CheckpointImage `json:"images"`
+
+	dir   string
+	dirty bool
+	mutex *sync.Mutex
+}
+
+// CheckpointImage is the image completed by the job.
+type CheckpointImage struct {
+	// Digest is the source manifest digest of the image.
+	Digest digest.Digest `json:"digest"`
+	// Image is the copied image written into the archive index.
+	Image *archive.Image `json:"image"`
+}
+
+// ResumeDir returns the directory of the checkpoint file and the pulled
+// image caches of the archive, example: saved-images.zip.resume
+func ResumeDir(archiveName string) string {
+	return archiveName + ".resume"
+}
+
+// NewCheckpoint loads the checkpoint file from the resume dir,
+// an empty checkpoint is created if the file does not exist.
+func NewCheckpoint(dir string) (*Checkpoint, error) {
+	c := &Checkpoint{
+		Version: checkpointVersion,
+		Images:  make(map[string]*CheckpointImage),
+		dir:     dir,
+		mutex:   &sync.Mutex{},
+	}
+	name := filepath.Join(dir, checkpointFileName)
+	b, err := os.ReadFile(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("failed to read checkpoint %q: %w", name, err)
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint %q: %w", name, err)
+	}
+	if c.Version != checkpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d", c.Version)
+	}
+	if c.Images == nil {
+		c.Images = make(map[string]*CheckpointImage)
+	}
+	return c, nil
+}
+
+// Completed returns the completed image, returns nil if the image is not
+// completed or the checkpoint is nil.
+func (c *Checkpoint) Completed(image string) *CheckpointImage {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Images[image]
+}
+
+// Record records the completed image.
+func (c *Checkpoint) Record(image string, dgst digest.Digest, copied *archive.Image) {
+	if c == nil || copied == nil || len(copied.Images) == 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Images[image] = &CheckpointImage{
+		Digest: dgst,
+		Image:  copied,
+	}
+	c.dirty = true
+}
+
+// Save writes the checkpoint file if the checkpoint changed.
+func (c *Checkpoint) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	if err := statedb.WriteJSON(filepath.Join(c.dir, checkpointFileName), c); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// Remove deletes the resume dir after the job completed.
+func (c *Checkpoint) Remove() error {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return os.RemoveAll(c.dir)
+}
+
+// CacheDir returns the cache dir of the pulled image in the resume dir,
+// the cache dirs of the completed images are kept until the job completed.
+func (c *Checkpoint) CacheDir(image string) string {
+	return filepath.Join(c.dir, "images", digest.FromString(image).Encoded()[:16])
+}
+
+// autoSave writes the checkpoint file periodically until the returned stop
+// function called.
+func (c *Checkpoint) autoSave(ctx context.Context) func() {
+	if c == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.Save(); err != nil {
+					logrus.Warnf("Failed to write checkpoint: %v", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		if err := c.Save(); err != nil {
+			logrus.Warnf("Failed to write checkpoint: %v", err)
+		}
+	}
+}
+
+// finishCheckpoint removes the resume dir if all images completed, the
+// checkpoint is kept to resume the failed images otherwise.
+func (c *common) finishCheckpoint(ctx context.Context) {
+	if c.checkpoint == nil {
+		return
+	}
+	c.failedImageListMutex.RLock()
+	failed := len(c.failedImageSet)
+	c.failedImageListMutex.RUnlock()
+	if failed > 0 || ctx.Err() != nil || c.aborted.Load() || c.budgetSkipped.Load() > 0 {
+		logrus.Infof("Checkpoint kept in [%v], use '--resume' to resume the job",
+			c.checkpoint.dir)
+		return
+	}
+	if err := c.checkpoint.Remove(); err != nil {
+		logrus.Warnf("Failed to remove resume dir %q: %v", c.checkpoint.dir, err)
+	}
+}
@@ -0,0 +1,80 @@
+package hangar
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Checkpoint(t *testing.T) {
+	dir := ResumeDir(filepath.Join(t.TempDir(), "saved-images.zip"))
+	c, err := NewCheckpoint(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(c.Images))
+
+	image := "docker.io/library/nginx:latest"
+	copied := &archive.Image{
+		Source: "docker.io/library/nginx",
+		Tag:    "latest",
+		Images: []archive.ImageSpec{{OS: "linux", Arch: "amd64", Digest: digest.FromString("1")}},
+	}
+	assert.Nil(t, c.Completed(image))
+	c.Record(image, digest.FromString("index"), copied)
+	// The image with no platform copied is not completed.
+	c.Record("docker.io/library/busybox:latest", digest.FromString("2"), &archive.Image{})
+	assert.Nil(t, c.Save())
+
+	c, err = NewCheckpoint(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(c.Images))
+	assert.Equal(t, digest.FromString("index"), c.Completed(image).Digest)
+	assert.Equal(t, copied, c.Completed(image).Image)
+	assert.Equal(t, dir, filepath.Dir(filepath.Dir(c.CacheDir(image))))
+	assert.NotEqual(t, c.CacheDir(image), c.CacheDir("docker.io/library/busybox:latest"))
+
+	assert.Nil(t, c.Remove())
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+
+	// The checkpoint methods are nil-safe.
+	var n *Checkpoint
+	assert.Nil(t, n.Completed(image))
+	n.Record(image, digest.FromString("index"), copied)
+	assert.Nil(t, n.Save())
+	n.autoSave(context.Background())()
+}
+
+func Test_FinishCheckpoint(t *testing.T) {
+	dir := ResumeDir(filepath.Join(t.TempDir(), "saved-images.zip"))
+	cp, err := NewCheckpoint(dir)
+	assert.Nil(t, err)
+	cp.Record("nginx", digest.FromString("1"), &archive.Image{
+		Images: []archive.ImageSpec{{Digest: digest.FromString("1")}},
+	})
+	assert.Nil(t, cp.Save())
+
+	c := newTestCommon(t)
+	c.checkpoint = cp
+	c.failedImageSet["redis"] = true
+	// The checkpoint is kept if some images failed.
+	c.finishCheckpoint(context.Background())
+	_, err = os.Stat(dir)
+	assert.Nil(t, err)
+
+	// The checkpoint is kept if the job interrupted.
+	c.failedImageSet = map[string]bool{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.finishCheckpoint(ctx)
+	_, err = os.Stat(dir)
+	assert.Nil(t, err)
+
+	c.finishCheckpoint(context.Background())
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+}
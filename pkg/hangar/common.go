@@ -2,16 +2,28 @@ package hangar
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/cnrancher/hangar/pkg/backoff"
+	hangarcopy "github.com/cnrancher/hangar/pkg/copy"
+	"github.com/cnrancher/hangar/pkg/destination"
 	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/cnrancher/hangar/pkg/logger"
+	"github.com/cnrancher/hangar/pkg/manifest"
+	"github.com/cnrancher/hangar/pkg/source"
 	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 )
 
@@ -51,6 +63,175 @@ type common struct {
 	systemContext *types.SystemContext
 	// policy
 	policy *signature.Policy
+	// detectChanges records the mismatched images as changes instead of
+	// validate failures
+	detectChanges bool
+	// changes stores the changes detected (thread-unsafe)
+	changes []Change
+	// changesMutex is a mutex for read/write of changes
+	changesMutex *sync.Mutex
+	// status writes the job status into status file
+	status *statusWriter
+	// allowedRegistries is the allow-list of the source registries
+	allowedRegistries map[string]bool
+	// trustStore records the first-seen digest of source images
+	trustStore *TrustStore
+	// acceptChanges accepts the source image digest changes
+	acceptChanges bool
+	// nameNormalizer normalizes the destination repository names
+	nameNormalizer *NameNormalizer
+	// maxFailures is the failure threshold to abort the job early
+	maxFailures *FailureThreshold
+	// keepGoing never aborts the job on failures
+	keepGoing bool
+	// destinationProxy is true if the destination registry is a
+	// pull-through proxy cache
+	destinationProxy bool
+	// includeAttestations copies the attestation manifests of the images
+	includeAttestations bool
+	// excludedAttestations is the number of the attestation manifests
+	// excluded from the copied images
+	excludedAttestations *atomic.Int64
+	// batchSizeOpt is the batch size option, auto enabled if 0
+	batchSizeOpt int
+	// batchSize is the number of images to flush the failed image list
+	// and the archive index, disabled if 0
+	batchSize int
+	// processed is the number of images processed by workers
+	processed *atomic.Int64
+	// flushIndex writes the archive index of the images processed so far
+	flushIndex func() error
+	flushMutex *sync.Mutex
+	// workersDone is called after all workers finished and before the
+	// error handler stopped
+	workersDone func()
+	// breaker pauses the work targeting the registry returning sustained
+	// server errors
+	breaker *backoff.Breaker
+	// contentStore is the local containerd content store to read the
+	// source blobs before falling back to the network
+	contentStore *hangarcopy.ContentStore
+	// layerCompression is the algorithm to re-compress the layers during
+	// copy, the layers are copied as-is if nil
+	layerCompression *compression.Algorithm
+	// blobConcurrency is the number of the blobs of each image copied in
+	// parallel
+	blobConcurrency int
+	// memoryLimiter serializes the very large blobs copied by the workers,
+	// nil to disable
+	memoryLimiter *hangarcopy.MemoryLimiter
+	// platformConcurrency is the number of the platform images of each
+	// multi-arch image copied in parallel
+	platformConcurrency int
+	// sigstoreVerifier verifies the sigstore signatures of the source
+	// images before copy, nil to disable
+	sigstoreVerifier *hangarcopy.SigstoreVerifier
+	// allowDigestChange retries the image without the digest
+	// preservation if the push failed with the digest preserved
+	allowDigestChange bool
+	// abort cancels the object context to abort the job
+	abort     context.CancelFunc
+	abortOnce *sync.Once
+	aborted   *atomic.Bool
+	// total is the total number of images to be processed
+	total int
+	// timings records the duration of the images
+	timings *timings
+	// startTime & endTime of the job
+	startTime time.Time
+	endTime   time.Time
+	// runID is the unique ID of the job
+	runID string
+	// deepVerifyMode fetches and hashes the destination blobs when
+	// validating
+	deepVerifyMode DeepVerify
+	// variantRules normalizes the empty variants when matching platforms
+	variantRules utils.VariantRules
+	// rewriteRules rewrites the destination repositories
+	rewriteRules destination.RewriteRules
+	// indexAnnotations is the custom annotations of the destination
+	// manifest indexes
+	indexAnnotations map[string]string
+	// digestDrifts is the images rewritten by the destination registry
+	// (thread-unsafe)
+	digestDrifts      []DigestDrift
+	digestDriftsMutex *sync.Mutex
+	// compat is the compatibility profile of the destination registry
+	compat Compatibility
+	// compatRepository is the repository of the path based routing
+	// prefixed to the destination projects
+	compatRepository string
+	// compatSearch checks the destination existence by the vendor
+	// search API
+	compatSearch bool
+	// compatAPI is the API server URL of the compatibility profile
+	compatAPI string
+	// compatCreate creates the missing projects of the destination
+	// repositories by the API of the compatibility profile
+	compatCreate bool
+	// compatBootstrap pushes the placeholder image into the new
+	// destination repositories before pushing the images
+	compatBootstrap bool
+	// bootstrapped is the map of the destination repository and the
+	// *bootstrapResult
+	bootstrapped *sync.Map
+	// dryRunMode resolves the images would be copied without writing
+	dryRunMode bool
+	// planned is the images would be copied in dry-run mode
+	planned      []PlannedImage
+	plannedMutex *sync.Mutex
+	// resolvePlan resolves the planned images of the object in dry-run
+	// mode
+	resolvePlan func(ctx context.Context, obj *planObject) ([]PlannedImage, error)
+	// lock records the resolved source image digests into the lock file
+	lock *Lock
+	// fromLock verifies the source image digests match the lock file
+	fromLock *Lock
+	// tiers is the criticality tiers of the image list lines
+	tiers map[string]Tier
+	// timeBudget stops copying the non-critical images after the budget
+	timeBudget time.Duration
+	// budgetSkipped is the number of images skipped by the time budget
+	budgetSkipped *atomic.Int64
+	// suggestions is the corrections suggested for the images not found
+	// in the source registry (thread-unsafe)
+	suggestions      []ImageSuggestion
+	suggestionsMutex *sync.Mutex
+	// optional is the image list lines marked as optional
+	optional map[string]bool
+	// skippedOptional is the optional images skipped (thread-unsafe)
+	skippedOptional      []SkippedOptional
+	skippedOptionalMutex *sync.Mutex
+	// stateStore records the source digests of the images copied
+	// successfully
+	stateStore *StateStore
+	// onlyIfChanged skips the images whose source digest unchanged since
+	// the last successful run
+	onlyIfChanged bool
+	// unchanged is the number of images skipped by onlyIfChanged
+	unchanged *atomic.Int64
+	// copiedImages is the platforms and layers of the copied images,
+	// map[SOURCE]image
+	copiedImages      map[string]*archive.Image
+	copiedImagesMutex *sync.Mutex
+	// errorMessages is the error messages handled by the error handler
+	errorMessages      []string
+	errorMessagesMutex *sync.Mutex
+	// imageListSource is the git source of the image list
+	imageListSource *ImageListSource
+	// imageListOrigins is the image list files of the image list lines
+	imageListOrigins map[string][]string
+	// checkpoint records the completed images to resume the interrupted
+	// save/sync job, nil if resume is not enabled
+	checkpoint *Checkpoint
+	// platformMismatches is the images whose config platform does not
+	// match the index entry found by the deep verify
+	platformMismatches      []PlatformMismatch
+	platformMismatchesMutex *sync.Mutex
+	// deprecatedImages is the images published as Docker schema1 or with
+	// the deprecated layer media types
+	deprecatedImages      []DeprecatedImage
+	deprecatedImagesMutex *sync.Mutex
 }
 
 type CommonOpts struct {
@@ -63,6 +244,140 @@ type CommonOpts struct {
 	FailedImageListName string
 	SystemContext       *types.SystemContext
 	Policy              *signature.Policy
+	// StatusFile is the path to write the job status continuously,
+	// the status file is disabled if empty.
+	StatusFile string
+	// AllowedRegistries is the allow-list of the source registries,
+	// all registries are allowed if empty.
+	AllowedRegistries []string
+	// TrustStore records the first-seen digest of the source images,
+	// trust-on-first-use is disabled if nil.
+	TrustStore *TrustStore
+	// AcceptChanges accepts the source image digest changes and updates
+	// the trust store.
+	AcceptChanges bool
+	// NameNormalizer normalizes the destination repository names,
+	// the destination names are not changed if nil.
+	NameNormalizer *NameNormalizer
+	// MaxFailures is the failure threshold to abort the job early,
+	// the job never aborts if nil.
+	MaxFailures *FailureThreshold
+	// KeepGoing never aborts the job on failures, the MaxFailures
+	// is ignored if enabled.
+	KeepGoing bool
+	// DestinationProxy treats the destination registry as a pull-through
+	// proxy cache, only the locally cached content is considered existing.
+	DestinationProxy bool
+	// IncludeAttestations copies the attestation manifests (unknown/unknown
+	// platform) of the image indexes, the attestation manifests are
+	// excluded from the destination index by default.
+	IncludeAttestations bool
+	// BatchSize is the number of images to flush the failed image list and
+	// the archive index periodically, the batch flush is enabled with
+	// 1000 images automatically for the image list over 10000 images
+	// if 0, disabled if negative.
+	BatchSize int
+	// BreakerThreshold is the number of consecutive server errors (5xx)
+	// of the registry to pause the work targeting the registry,
+	// the circuit breaker is disabled if not positive.
+	BreakerThreshold int
+	// BreakerCooldown is the duration to pause the work targeting the
+	// registry after the circuit breaker opened.
+	BreakerCooldown time.Duration
+	// ContentStore is the local containerd content store to read the
+	// source blobs when the digests match, nil to disable.
+	ContentStore *hangarcopy.ContentStore
+	// LayerCompression re-compresses the layers into the algorithm
+	// (gzip or zstd) during copy, the digests of the copied images are
+	// changed, the layers are copied as-is if nil.
+	LayerCompression *compression.Algorithm
+	// BlobConcurrency is the number of the blobs of each image copied in
+	// parallel independent of the worker number, the default (3) is used
+	// if not positive.
+	BlobConcurrency int
+	// MaxMemory is the total size in bytes of the large blobs streamed
+	// in parallel by all the workers, the blobs exceeding the size are
+	// copied one at a time, not limited if not positive.
+	MaxMemory int64
+	// SigstoreVerifier verifies the sigstore signatures of the source
+	// images against the public key before copy, nil to disable.
+	SigstoreVerifier *hangarcopy.SigstoreVerifier
+	// AllowDigestChange retries the platform image with the digest
+	// preservation disabled if the destination registry rejects the
+	// manifest (e.g. the registries rewriting the media types), the
+	// changed digests are recorded as the digest drifts.
+	AllowDigestChange bool
+	// DeepVerify fetches and hashes the destination blobs when validating
+	// to detect the storage corruption, only the manifest digests are
+	// compared if empty.
+	DeepVerify DeepVerify
+	// VariantRules normalizes the empty variants when matching the
+	// platforms of the source and destination images, the default
+	// variant rules (arm: v7, arm64: v8) are used if nil.
+	VariantRules utils.VariantRules
+	// RewriteRules rewrites the destination repositories of the registry
+	// images, the repositories are not rewritten if empty.
+	RewriteRules destination.RewriteRules
+	// IndexAnnotations is the custom annotations (e.g. the bundle ID,
+	// version and build date) of the destination manifest indexes built
+	// by hangar, the OCI image index is pushed if not empty.
+	IndexAnnotations map[string]string
+	// Compatibility is the compatibility profile of the destination
+	// registry, the destination registry is distribution compatible
+	// if empty.
+	Compatibility Compatibility
+	// CompatRepository is the repository name of the path based routing
+	// of the destination registry (e.g. the Nexus docker hosted repository),
+	// which is prefixed to the destination projects.
+	CompatRepository string
+	// CompatSearch checks the existence of the destination images by the
+	// vendor search API of the compatibility profile (Artifactory AQL),
+	// requires the CompatRepository as the repository key.
+	CompatSearch bool
+	// CompatAPI is the API server URL of the compatibility profile,
+	// e.g. the GitLab server URL, which is detected from the registry
+	// if empty.
+	CompatAPI string
+	// CompatCreate creates the missing GitLab projects of the destination
+	// repositories, the missing projects are reported if disabled.
+	CompatCreate bool
+	// CompatBootstrap pushes the placeholder image (tagged
+	// 'hangar-bootstrap') to initialize the new destination repositories
+	// before pushing the images, for the registries rejecting the
+	// manifest-only pushes into the repositories not exist.
+	CompatBootstrap bool
+	// Lock records the resolved source image digests and writes the lock
+	// file after the job finished, the lock file is disabled if nil.
+	Lock *Lock
+	// FromLock verifies the source image digests match with the lock file
+	// to reproduce the job, the digests are not verified if nil.
+	FromLock *Lock
+	// Tiers is the criticality tiers of the image list lines, the images
+	// are copied in the order of critical, standard and optional tiers.
+	// The image not in Tiers is in the standard tier.
+	Tiers map[string]Tier
+	// TimeBudget stops copying the non-critical images after the budget
+	// exceeded, the critical images are always copied. The skipped images
+	// are exported to the failed image list, disabled if not positive.
+	TimeBudget time.Duration
+	// Optional is the image list lines marked as optional, the optional
+	// images absent in the source or having no image of the specified
+	// platforms are skipped without failing the job.
+	Optional map[string]bool
+	// ImageListOrigins is the image list files of the image list lines
+	// when multiple image list files are processed in one run, the
+	// results are reported per image list file.
+	ImageListOrigins map[string][]string
+	// StateStore is the state DB recording the source digests of the
+	// images copied successfully.
+	StateStore *StateStore
+	// OnlyIfChanged skips the images whose source digest matches the last
+	// successful run recorded in the StateStore, without accessing the
+	// destination.
+	OnlyIfChanged bool
+	// ImageListSource is the git repository and the commit of the image
+	// list hosted in git, recorded into the summary and the lock file.
+	ImageListSource *ImageListSource
 }
 
 func newCommon(o *CommonOpts) (*common, error) {
@@ -89,6 +404,83 @@ func newCommon(o *CommonOpts) (*common, error) {
 
 		systemContext: utils.CopySystemContext(o.SystemContext),
 		policy:        nil,
+		changesMutex:  &sync.Mutex{},
+		status:        newStatusWriter(o.StatusFile),
+
+		trustStore:    o.TrustStore,
+		acceptChanges: o.AcceptChanges,
+
+		nameNormalizer: o.NameNormalizer,
+		maxFailures:    o.MaxFailures,
+		keepGoing:      o.KeepGoing,
+		timings:        newTimings(),
+		abortOnce:      &sync.Once{},
+		aborted:        &atomic.Bool{},
+
+		destinationProxy: o.DestinationProxy,
+
+		includeAttestations:  o.IncludeAttestations,
+		excludedAttestations: &atomic.Int64{},
+
+		batchSizeOpt: o.BatchSize,
+		processed:    &atomic.Int64{},
+		flushMutex:   &sync.Mutex{},
+
+		breaker:      backoff.NewBreaker(o.BreakerThreshold, o.BreakerCooldown),
+		contentStore: o.ContentStore,
+		runID:        newRunID(),
+
+		layerCompression: o.LayerCompression,
+		blobConcurrency:  o.BlobConcurrency,
+		memoryLimiter:    hangarcopy.NewMemoryLimiter(o.MaxMemory),
+		sigstoreVerifier: o.SigstoreVerifier,
+
+		platformConcurrency: platformConcurrency(o.Workers, o.BlobConcurrency, o.MaxMemory),
+
+		allowDigestChange: o.AllowDigestChange,
+
+		deepVerifyMode: o.DeepVerify,
+		variantRules:   o.VariantRules,
+		rewriteRules:   o.RewriteRules,
+
+		indexAnnotations: o.IndexAnnotations,
+
+		digestDriftsMutex: &sync.Mutex{},
+
+		compat:           o.Compatibility,
+		compatRepository: strings.Trim(o.CompatRepository, "/"),
+		compatSearch:     o.CompatSearch,
+		compatAPI:        o.CompatAPI,
+		compatCreate:     o.CompatCreate,
+		compatBootstrap:  o.CompatBootstrap,
+		bootstrapped:     &sync.Map{},
+
+		plannedMutex: &sync.Mutex{},
+
+		lock:     o.Lock,
+		fromLock: o.FromLock,
+
+		tiers:         o.Tiers,
+		timeBudget:    o.TimeBudget,
+		budgetSkipped: &atomic.Int64{},
+
+		suggestionsMutex: &sync.Mutex{},
+
+		optional:             o.Optional,
+		skippedOptionalMutex: &sync.Mutex{},
+
+		stateStore:    o.StateStore,
+		onlyIfChanged: o.OnlyIfChanged,
+		unchanged:     &atomic.Int64{},
+
+		copiedImages:       make(map[string]*archive.Image),
+		copiedImagesMutex:  &sync.Mutex{},
+		errorMessagesMutex: &sync.Mutex{},
+		imageListSource:    o.ImageListSource,
+		imageListOrigins:   o.ImageListOrigins,
+
+		platformMismatchesMutex: &sync.Mutex{},
+		deprecatedImagesMutex:   &sync.Mutex{},
 	}
 	var err error
 	policy, err := utils.CopyPolicy(o.Policy)
@@ -96,7 +488,15 @@ func newCommon(o *CommonOpts) (*common, error) {
 		return nil, fmt.Errorf("failed to copy policy: %w", err)
 	}
 	c.policy = policy
+	c.resolvePlan = c.planImage
+	if c.variantRules == nil {
+		c.variantRules = utils.DefaultVariantRules
+	}
+	if c.lock != nil {
+		c.lock.ImageList = o.ImageListSource
+	}
 	copy(c.images, o.Images)
+	sortByTier(c.images, c.tiers)
 	for i := 0; i < len(o.OS); i++ {
 		c.imageSpecSet["os"][o.OS[i]] = true
 	}
@@ -106,11 +506,26 @@ func newCommon(o *CommonOpts) (*common, error) {
 	for i := 0; i < len(o.Variant); i++ {
 		c.imageSpecSet["variant"][o.Variant[i]] = true
 	}
+	if len(o.AllowedRegistries) != 0 {
+		c.allowedRegistries = make(map[string]bool)
+		for _, r := range o.AllowedRegistries {
+			c.allowedRegistries[r] = true
+		}
+	}
 
 	return c, nil
 }
 
+// newRunID returns the ID of the job in '<UTC-time>-<random-hex>' format.
+func newRunID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
 func (c *common) SaveFailedImages() error {
+	c.failedImageListMutex.RLock()
+	defer c.failedImageListMutex.RUnlock()
 	if len(c.failedImageSet) == 0 {
 		return nil
 	}
@@ -131,12 +546,30 @@ func (c *common) SaveFailedImages() error {
 }
 
 func (c *common) initWorker(ctx context.Context, f func(context.Context, any)) {
-	c.objectCtx = ctx
+	c.objectCtx, c.abort = context.WithCancel(ctx)
+	c.total = len(c.images)
+	c.batchSize = resolveBatchSize(c.batchSizeOpt, c.total)
+	c.startTime = time.Now()
+	c.endTime = time.Time{}
+	c.status.begin(len(c.images))
 	maxWorkerNum := c.workers
 	if len(c.images) > 0 && len(c.images) < maxWorkerNum {
 		maxWorkerNum = len(c.images)
 		logrus.Debugf("Reset worker num %d", maxWorkerNum)
 	}
+	logger.Section("PLAN")
+	if len(c.images) > 0 {
+		logrus.Infof("Images: %d", len(c.images))
+	}
+	logrus.Infof("Workers: %d", maxWorkerNum)
+	logrus.Debugf("Run ID: %v", c.runID)
+	if c.maxFailures != nil && !c.keepGoing {
+		logrus.Infof("Max failures: %v", c.maxFailures)
+	}
+	if c.batchSize > 0 {
+		logrus.Infof("Batch size: %d", c.batchSize)
+	}
+	logger.Section("PROGRESS")
 	for i := 0; i < maxWorkerNum; i++ {
 		c.waitGroup.Add(1)
 		go c.workerFunc(i, f)
@@ -146,6 +579,8 @@ func (c *common) initWorker(ctx context.Context, f func(context.Context, any)) {
 
 func (c *common) workerFunc(id int, f func(context.Context, any)) {
 	defer c.waitGroup.Done()
+	// Attach the worker ID to the logs output by the worker.
+	ctx := logger.WithWorker(c.objectCtx, id)
 	for {
 		select {
 		case <-c.objectCtx.Done():
@@ -160,11 +595,84 @@ func (c *common) workerFunc(id int, f func(context.Context, any)) {
 			if obj == nil {
 				continue
 			}
-			f(c.objectCtx, obj)
+			name := ""
+			if o, ok := obj.(object); ok {
+				name = o.name()
+			}
+			c.status.start(name)
+			f(ctx, obj)
+			c.status.done(name)
+			c.batchDone()
 		}
 	}
 }
 
+// maxPlatformConcurrency is the max number of the platform images of each
+// multi-arch image copied in parallel.
+const maxPlatformConcurrency = 4
+
+// sourceRepository returns the 'REGISTRY/PROJECT/NAME' of the source image
+// reference matched by the destination rewrite rules.
+func sourceRepository(image string) string {
+	return utils.GetRegistryName(image) + "/" + utils.GetProjectName(image) +
+		"/" + utils.GetImageName(image)
+}
+
+// configureSource applies the copy options shared by the mirror, save and
+// sync jobs to the source image, every source created from the image list
+// should be configured by it.
+func (c *common) configureSource(src *source.Source) {
+	src.SetIncludeAttestations(c.includeAttestations)
+	src.SetContentStore(c.contentStore)
+	src.SetCompression(c.layerCompression)
+	src.SetBlobConcurrency(c.blobConcurrency)
+	src.SetMemoryLimiter(c.memoryLimiter)
+	src.SetPlatformConcurrency(c.platformConcurrency)
+	src.SetSigstoreVerifier(c.sigstoreVerifier)
+	src.SetAllowDigestChange(c.allowDigestChange)
+}
+
+// platformConcurrency returns the number of the platform images of each
+// multi-arch image copied in parallel. The blobs in flight by all the
+// workers are limited to utils.MaxWorkerNum * DefaultBlobConcurrency, the
+// platform images are copied one at a time if the workers and the blob
+// concurrency already reach the limit or the memory is limited.
+func platformConcurrency(workers, blobConcurrency int, maxMemory int64) int {
+	if maxMemory > 0 {
+		return 1
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+	if blobConcurrency <= 0 {
+		blobConcurrency = hangarcopy.DefaultBlobConcurrency
+	}
+	n := utils.MaxWorkerNum * hangarcopy.DefaultBlobConcurrency / (workers * blobConcurrency)
+	if n < 1 {
+		return 1
+	}
+	if n > maxPlatformConcurrency {
+		return maxPlatformConcurrency
+	}
+	return n
+}
+
+// waitBreaker pauses the work if the registries return sustained server
+// errors. The returned function records the result of the work into the
+// circuit breaker, the worker defers it after its error handler so the
+// image is recorded as failed if the wait was canceled.
+func (c *common) waitBreaker(
+	ctx context.Context, registries ...string,
+) (func(*error), error) {
+	if err := c.breaker.Wait(ctx, registries...); err != nil {
+		return nil, fmt.Errorf("failed to wait for registry %v: %w",
+			registries, err)
+	}
+	return func(err *error) {
+		c.breaker.Record(*err, registries...)
+	}, nil
+}
+
 func (c *common) initErrorHandler(ctx context.Context) {
 	c.errorCtx = ctx
 	c.errorWaitGroup.Add(errorHandlerWorkerNum)
@@ -182,6 +690,9 @@ func (c *common) initErrorHandler(ctx context.Context) {
 						return
 					}
 					logrus.Error(err)
+					c.errorMessagesMutex.Lock()
+					c.errorMessages = append(c.errorMessages, err.Error())
+					c.errorMessagesMutex.Unlock()
 				}
 			}
 		}()
@@ -191,7 +702,10 @@ func (c *common) initErrorHandler(ctx context.Context) {
 func (c *common) recordFailedImage(name string) {
 	c.failedImageListMutex.Lock()
 	c.failedImageSet[name] = true
+	failed := len(c.failedImageSet)
 	c.failedImageListMutex.Unlock()
+	c.status.fail(name)
+	c.checkFailureThreshold(failed)
 }
 
 func (c *common) handleError(err error) error {
@@ -222,16 +736,48 @@ func (c *common) waitWorkers() {
 	close(c.objectCh)
 	// Waiting for all images were copied
 	c.waitGroup.Wait()
+	if c.workersDone != nil {
+		c.workersDone()
+	}
+	if c.abort != nil {
+		c.abort()
+	}
 	close(c.errorCh)
 	// Waiting for all error messages were handled properly
 	c.errorWaitGroup.Wait()
+	c.endTime = time.Now()
+	c.status.finish()
+	if c.dryRunMode {
+		// Nothing is persisted in dry-run mode.
+		return
+	}
+	if c.trustStore != nil {
+		if err := c.trustStore.Save(); err != nil {
+			logrus.Errorf("failed to save trust store: %v", err)
+		}
+	}
+	c.saveStateStore()
+	if err := c.nameNormalizer.Save(); err != nil {
+		logrus.Errorf("failed to save name mapping: %v", err)
+	}
+	if c.lock != nil {
+		if err := c.lock.Save(); err != nil {
+			logrus.Errorf("failed to save lock file: %v", err)
+		}
+	}
 }
 
 // layerManager is for managing image layer cache.
 type layerManager struct {
 	mutex        *sync.RWMutex
-	layersRefMap map[string]int
+	layersRefMap map[digest.Digest]int
 	cacheDir     string
+	// skipBlobs is the image layers present on the destination
+	// out-of-band, which are not decompressed from the archive
+	skipBlobs map[digest.Digest]bool
+	// streamed returns true if the blob is streamed from the archive
+	// directly, which is not decompressed, nil if disabled
+	streamed func(digest.Digest) bool
 }
 
 func newLayerManager(index *archive.Index) (*layerManager, error) {
@@ -241,41 +787,55 @@ func newLayerManager(index *archive.Index) (*layerManager, error) {
 	}
 	m := &layerManager{
 		mutex:        &sync.RWMutex{},
-		layersRefMap: make(map[string]int),
+		layersRefMap: make(map[digest.Digest]int),
 		cacheDir:     tmpDir,
 	}
 	for _, img := range index.List {
 		for _, spec := range img.Images {
-			for _, layer := range spec.Layers {
-				m.layersRefMap[layer.Encoded()]++
+			for _, layer := range m.getImageLayers(&spec) {
+				m.layersRefMap[layer]++
 			}
-			if spec.Config != "" {
-				m.layersRefMap[spec.Config.Encoded()]++
-			}
-			m.layersRefMap[spec.Digest.Encoded()]++
 		}
 	}
 	return m, nil
 }
 
-func (m *layerManager) getImageLayers(img *archive.ImageSpec) []string {
-	var data = make([]string, 0, len(img.Layers)+2)
-	for _, l := range img.Layers {
-		data = append(data, l.Encoded())
-	}
-	data = append(data, img.Digest.Encoded())
+// getImageLayers returns the blob digests (layers, manifest and config)
+// of the image.
+func (m *layerManager) getImageLayers(img *archive.ImageSpec) []digest.Digest {
+	var data = make([]digest.Digest, 0, len(img.Layers)+2)
+	data = append(data, img.Layers...)
+	data = append(data, img.Digest)
 	if img.Config != "" {
-		data = append(data, img.Config.Encoded())
+		data = append(data, img.Config)
 	}
 	return data
 }
 
+// skipped returns true if the blob is the image layer present on the
+// destination out-of-band or streamed from the archive directly.
+func (m *layerManager) skipped(img *archive.ImageSpec, blob digest.Digest) bool {
+	if !m.skipBlobs[blob] && (m.streamed == nil || !m.streamed(blob)) {
+		return false
+	}
+	for _, layer := range img.Layers {
+		if layer == blob {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *layerManager) decompressLayer(
 	img *archive.ImageSpec, ar *archive.Reader,
 ) error {
 	for _, layer := range m.getImageLayers(img) {
-		p := path.Join(archive.SharedBlobDir, "sha256", layer)
-		err := ar.Decompress(p, m.blobDir())
+		if m.skipped(img, layer) {
+			continue
+		}
+		p := path.Join(archive.SharedBlobDir,
+			layer.Algorithm().String(), layer.Encoded())
+		err := ar.Decompress(p, m.blobDir(layer.Algorithm()))
 		if err != nil {
 			return fmt.Errorf("failed to decompress [%v]: %w", p, err)
 		}
@@ -302,7 +862,10 @@ func (m *layerManager) clean(img *archive.ImageSpec) {
 		}
 		if m.layersRefMap[layer] == 0 {
 			m.layersRefMap[layer]--
-			p := path.Join(m.blobDir(), layer)
+			if m.skipped(img, layer) {
+				continue
+			}
+			p := path.Join(m.blobDir(layer.Algorithm()), layer.Encoded())
 			if _, err := os.Stat(p); err != nil {
 				logrus.Warnf("failed to cleanup [%v]: stat %v", p, err)
 			}
@@ -323,6 +886,50 @@ func (m *layerManager) sharedBlobDir() string {
 	return path.Join(m.cacheDir, archive.SharedBlobDir)
 }
 
-func (m *layerManager) blobDir() string {
-	return path.Join(m.cacheDir, archive.SharedBlobDir, "sha256")
+func (m *layerManager) blobDir(algorithm digest.Algorithm) string {
+	return path.Join(m.cacheDir, archive.SharedBlobDir, algorithm.String())
+}
+
+// sourceDigestAnnotations returns the descriptor annotations of the copied
+// image, the source digest is annotated if the manifest was rewritten by
+// the destination registry, to match the source digest on subsequent runs.
+func sourceDigestAnnotations(image archive.ImageSpec) map[string]string {
+	if image.SourceDigest == "" {
+		return image.Annotations
+	}
+	annotations := make(map[string]string, len(image.Annotations)+1)
+	for k, v := range image.Annotations {
+		annotations[k] = v
+	}
+	annotations[manifest.AnnotationSourceDigest] = image.SourceDigest.String()
+	return annotations
+}
+
+// withIndexAnnotations returns the annotations of the destination manifest
+// index merged with the custom index annotations, the annotations written
+// by hangar take precedence.
+func (c *common) withIndexAnnotations(annotations map[string]string) map[string]string {
+	if len(c.indexAnnotations) == 0 {
+		return annotations
+	}
+	merged := make(map[string]string, len(c.indexAnnotations)+len(annotations))
+	for k, v := range c.indexAnnotations {
+		merged[k] = v
+	}
+	for k, v := range annotations {
+		merged[k] = v
+	}
+	return merged
+}
+
+// indexAnnotationsChanged checks whether the custom index annotations are
+// missing or different in the annotations of the destination manifest
+// index, the index should be re-created to update the annotations.
+func (c *common) indexAnnotationsChanged(annotations map[string]string) bool {
+	for k, v := range c.indexAnnotations {
+		if a, ok := annotations[k]; !ok || a != v {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,181 @@
+package hangar
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/backoff"
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/cnrancher/hangar/pkg/manifest"
+	"github.com/cnrancher/hangar/pkg/source"
+	"github.com/containers/image/v5/signature"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCommon returns the common initialized by newCommon, the tests set
+// the fields they cover on the returned common.
+func newTestCommon(t *testing.T) *common {
+	t.Helper()
+	c, err := newCommon(&CommonOpts{
+		Policy: &signature.Policy{
+			Default: signature.PolicyRequirements{signature.NewPRInsecureAcceptAnything()},
+		},
+	})
+	if err != nil {
+		t.Fatalf("newCommon: %v", err)
+	}
+	return c
+}
+
+func Test_LayerManagerDigestAlgorithm(t *testing.T) {
+	sha256Layer := digest.Canonical.FromString("layer")
+	sha512Layer := digest.SHA512.FromString("layer")
+	sha512Manifest := digest.SHA512.FromString("manifest")
+	spec := archive.ImageSpec{
+		Layers: []digest.Digest{sha256Layer, sha512Layer},
+		Digest: sha512Manifest,
+	}
+	m := &layerManager{
+		layersRefMap: make(map[digest.Digest]int),
+		cacheDir:     t.TempDir(),
+	}
+	for _, layer := range m.getImageLayers(&spec) {
+		m.layersRefMap[layer] += 2
+	}
+	assert.Equal(t, []digest.Digest{sha256Layer, sha512Layer, sha512Manifest},
+		m.getImageLayers(&spec))
+	assert.Equal(t, 2, m.layersRefMap[sha512Layer])
+	assert.Equal(t, filepath.Join(m.cacheDir, archive.SharedBlobDir, "sha512"),
+		m.blobDir(digest.SHA512))
+}
+
+func Test_RecordExcludedAttestations(t *testing.T) {
+	c := newTestCommon(t)
+	c.recordExcludedAttestations(0)
+	assert.Equal(t, 0, c.Summary().ExcludedAttestations)
+	c.recordExcludedAttestations(2)
+	c.recordExcludedAttestations(1)
+	assert.Equal(t, 3, c.Summary().ExcludedAttestations)
+}
+
+func Test_RecordDeprecated(t *testing.T) {
+	c := newTestCommon(t)
+	c.recordDeprecated("docker.io/library/b:1", nil)
+	c.recordDeprecated("docker.io/library/b:1", []source.DeprecatedMediaType{
+		{
+			Platform:    "linux/amd64",
+			MediaType:   "application/vnd.docker.distribution.manifest.v1+prettyjws",
+			ConvertedTo: "application/vnd.docker.distribution.manifest.v2+json",
+		},
+	})
+	c.recordDeprecated("docker.io/library/a:1", []source.DeprecatedMediaType{
+		{
+			Platform:    "windows/amd64",
+			MediaType:   "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip",
+			ConvertedTo: "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip",
+		},
+	})
+	d := c.Summary().DeprecatedImages
+	assert.Len(t, d, 2)
+	assert.Equal(t, "docker.io/library/a:1", d[0].Image)
+	assert.Equal(t, "windows/amd64", d[0].Platform)
+	assert.Equal(t, "docker.io/library/b:1", d[1].Image)
+	assert.Equal(t, "application/vnd.docker.distribution.manifest.v2+json", d[1].ConvertedTo)
+}
+
+func Test_imageListResults(t *testing.T) {
+	assert.Nil(t, imageListResults(nil, nil))
+	results := imageListResults(map[string][]string{
+		"a": {"rancher.txt"},
+		"b": {"rancher.txt", "app.txt"},
+		"c": {"app.txt"},
+	}, []string{"b"})
+	assert.Len(t, results, 2)
+	assert.Equal(t, &ImageListResult{
+		Name: "app.txt", Total: 2, Failed: 1, FailedImages: []string{"b"},
+	}, results[0])
+	assert.Equal(t, &ImageListResult{
+		Name: "rancher.txt", Total: 2, Failed: 1, FailedImages: []string{"b"},
+	}, results[1])
+}
+
+func Test_newRunID(t *testing.T) {
+	id := newRunID()
+	assert.Regexp(t, regexp.MustCompile(`^\d{8}T\d{6}Z-[0-9a-f]{6}$`), id)
+	assert.NotEqual(t, id, newRunID())
+}
+
+func Test_IndexAnnotations(t *testing.T) {
+	c := &common{}
+	assert.Nil(t, c.withIndexAnnotations(nil))
+	assert.False(t, c.indexAnnotationsChanged(nil))
+
+	c.indexAnnotations = map[string]string{
+		"org.example.bundle.id":      "rancher-v2.8.0",
+		"org.example.bundle.created": "2024-01-01",
+	}
+	assert.Equal(t, map[string]string{
+		"org.example.bundle.id":         "rancher-v2.8.0",
+		"org.example.bundle.created":    "2024-01-01",
+		manifest.AnnotationSourceDigest: "sha256:abc",
+	}, c.withIndexAnnotations(map[string]string{
+		manifest.AnnotationSourceDigest: "sha256:abc",
+	}))
+	assert.True(t, c.indexAnnotationsChanged(nil))
+	assert.True(t, c.indexAnnotationsChanged(map[string]string{
+		"org.example.bundle.id":      "rancher-v2.7.0",
+		"org.example.bundle.created": "2024-01-01",
+	}))
+	assert.False(t, c.indexAnnotationsChanged(map[string]string{
+		"org.example.bundle.id":         "rancher-v2.8.0",
+		"org.example.bundle.created":    "2024-01-01",
+		manifest.AnnotationSourceDigest: "sha256:abc",
+	}))
+}
+
+func Test_waitBreaker(t *testing.T) {
+	c := newTestCommon(t)
+	c.breaker = backoff.NewBreaker(1, time.Hour)
+
+	record, err := c.waitBreaker(context.TODO(), "reg.io")
+	assert.Nil(t, err)
+	err = errors.New("received unexpected HTTP status: 503 Service Unavailable")
+	record(&err)
+
+	// The circuit of the registry is open, the canceled wait returns error
+	// so the worker records the image as failed.
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	_, err = c.waitBreaker(ctx, "reg.io")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Other registries are not paused.
+	_, err = c.waitBreaker(ctx, "docker.io")
+	assert.Nil(t, err)
+}
+
+func Test_destinationDigests(t *testing.T) {
+	assert.Equal(t, map[digest.Digest]bool{
+		"sha256:a": true,
+		"sha256:b": true,
+		"sha256:c": true,
+	}, destinationDigests([]archive.ImageSpec{
+		{Digest: "sha256:a"},
+		// The manifest was rewritten by the destination registry.
+		{Digest: "sha256:b", SourceDigest: "sha256:c"},
+	}))
+}
+
+func Test_platformConcurrency(t *testing.T) {
+	assert.Equal(t, maxPlatformConcurrency, platformConcurrency(1, 0, 0))
+	assert.Equal(t, 2, platformConcurrency(10, 3, 0))
+	assert.Equal(t, 1, platformConcurrency(20, 3, 0))
+	assert.Equal(t, 1, platformConcurrency(20, 10, 0))
+	// The platform images are copied one at a time if memory is limited.
+	assert.Equal(t, 1, platformConcurrency(1, 3, 1<<30))
+}
@@ -0,0 +1,209 @@
+package hangar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cnrancher/hangar/pkg/destination"
+	"github.com/cnrancher/hangar/pkg/extension"
+	"github.com/cnrancher/hangar/pkg/gitlab"
+	"github.com/cnrancher/hangar/pkg/probe"
+	"github.com/cnrancher/hangar/pkg/types"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Compatibility is the compatibility profile of the destination registry
+// to handle the behaviors differ from the distribution registry.
+type Compatibility string
+
+const (
+	// CompatibilityNone is the distribution compatible registry.
+	CompatibilityNone Compatibility = ""
+	// CompatibilityNexus is the docker hosted repository of Sonatype Nexus
+	// Repository 3, the repository is addressed by the connector port or
+	// by the repository name prefix (path based routing), and the OCI
+	// image index is rejected by the earlier releases.
+	CompatibilityNexus Compatibility = "nexus"
+	// CompatibilityArtifactory is the docker repository of JFrog
+	// Artifactory, the repository key is the first path component of the
+	// repository (repository path method), and the tag existence can be
+	// checked by the AQL search.
+	CompatibilityArtifactory Compatibility = "artifactory"
+	// CompatibilityGitLab is the GitLab Container Registry, the container
+	// repositories could only be pushed into the existing projects.
+	CompatibilityGitLab Compatibility = "gitlab"
+)
+
+var (
+	ErrInvalidCompatibility  = errors.New("invalid compatibility profile")
+	ErrGitLabProjectNotFound = errors.New("gitlab projects of the destination repositories not found")
+)
+
+// ParseCompatibility parses the compatibility profile
+// (empty string, 'nexus', 'artifactory' or 'gitlab').
+func ParseCompatibility(s string) (Compatibility, error) {
+	switch c := Compatibility(s); c {
+	case CompatibilityNone, CompatibilityNexus, CompatibilityArtifactory, CompatibilityGitLab:
+		return c, nil
+	}
+	return "", fmt.Errorf("%w %q: should be %q, %q or %q", ErrInvalidCompatibility,
+		s, CompatibilityNexus, CompatibilityArtifactory, CompatibilityGitLab)
+}
+
+// server returns the Server header prefix of the registry product,
+// returns empty string if the registry could not be identified by the
+// Server header.
+func (c Compatibility) server() string {
+	switch c {
+	case CompatibilityNexus:
+		return "Nexus/"
+	case CompatibilityArtifactory:
+		return "Artifactory/"
+	}
+	return ""
+}
+
+// fallbackSchema2List returns true if the Docker manifest list should be
+// pushed when the OCI image index is rejected by the registry.
+func (c Compatibility) fallbackSchema2List() bool {
+	return c == CompatibilityNexus
+}
+
+// compatProject returns the destination project prefixed by the repository
+// of the path based routing.
+func (c *common) compatProject(project string) string {
+	if c.compatRepository == "" {
+		return project
+	}
+	if project == "" {
+		return c.compatRepository
+	}
+	return c.compatRepository + "/" + project
+}
+
+// initCompatibility pings the destination registry and warns if the
+// registry does not match the compatibility profile, the failure of the
+// check does not abort the job. The AQL search of the Artifactory
+// repository is enabled for the existence checks if configured.
+func (c *common) initCompatibility(ctx context.Context, registry string) {
+	if c.compat == CompatibilityNone || registry == "" {
+		return
+	}
+	if c.compat == CompatibilityArtifactory && c.compatSearch {
+		extension.For(ctx, c.systemContext, registry).SetArtifactory(c.compatRepository)
+		logrus.Infof("Check the existence of images in Artifactory repository %q by AQL search",
+			c.compatRepository)
+	}
+	if c.compat.server() == "" {
+		return
+	}
+	insecure := utils.InsecureRegistry(c.systemContext, registry)
+	server, err := probe.Server(ctx, registry, insecure)
+	if err != nil {
+		logrus.Warnf("Failed to check the compatibility of registry %q: %v",
+			registry, err)
+		return
+	}
+	if !strings.HasPrefix(server, c.compat.server()) {
+		logrus.Warnf("Registry %q server %q does not match the compatibility profile %q",
+			registry, server, c.compat)
+		return
+	}
+	logrus.Infof("Registry %q server: %v", registry, server)
+}
+
+// initGitLabProjects checks the GitLab projects of the destination
+// repositories exist before pushing, the missing projects are created if
+// enabled, otherwise the missing projects are reported.
+func (c *common) initGitLabProjects(
+	ctx context.Context, registry string, repositories []string,
+) error {
+	if c.compat != CompatibilityGitLab || registry == "" {
+		return nil
+	}
+	credential, err := config.GetCredentials(c.systemContext, registry)
+	if err != nil {
+		return fmt.Errorf("failed to get credential of %q: %w", registry, err)
+	}
+	api := c.compatAPI
+	if api == "" {
+		api = gitlab.APIURL(registry)
+	}
+	// The access token with the 'api' scope is used as the registry password.
+	client := gitlab.NewClient(api, credential.Password,
+		!c.systemContext.OCIInsecureSkipTLSVerify)
+
+	set := map[string]bool{}
+	for _, r := range repositories {
+		set[r] = true
+	}
+	var missing []string
+	for r := range set {
+		p, err := client.FindProject(ctx, r)
+		if err != nil {
+			return err
+		}
+		if p == "" {
+			missing = append(missing, r)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	if !c.compatCreate {
+		return fmt.Errorf("%w on %q: [%v], create the projects or use '--compat-create' to create automatically",
+			ErrGitLabProjectNotFound, api, strings.Join(missing, ", "))
+	}
+	for _, p := range missing {
+		if err := client.CreateProject(ctx, p); err != nil {
+			return err
+		}
+		logrus.Infof("Created GitLab project %q for registry %q", p, registry)
+	}
+	return nil
+}
+
+// bootstrapResult is the result of initializing the destination
+// repository, each repository is initialized only once.
+type bootstrapResult struct {
+	once sync.Once
+	err  error
+}
+
+// bootstrapRepository pushes the placeholder image into the destination
+// repository if the repository does not exist, for the registries
+// rejecting the manifest-only pushes into the new repositories.
+func (c *common) bootstrapRepository(ctx context.Context, dest *destination.Destination) error {
+	if !c.compatBootstrap || dest.Type() != types.TypeDocker || dest.Exists() {
+		return nil
+	}
+	repository := path.Join(dest.Project(), dest.Name())
+	v, _ := c.bootstrapped.LoadOrStore(dest.Registry()+"/"+repository, &bootstrapResult{})
+	r := v.(*bootstrapResult)
+	r.once.Do(func() {
+		client := extension.For(ctx, dest.SystemContext(), dest.Registry())
+		ok, err := client.RepositoryExists(ctx, repository)
+		if err != nil {
+			r.err = fmt.Errorf("failed to check repository %q: %w", repository, err)
+			return
+		}
+		if ok {
+			return
+		}
+		if err := client.Bootstrap(ctx, repository); err != nil {
+			r.err = fmt.Errorf("failed to bootstrap repository %q: %w", repository, err)
+			return
+		}
+		logrus.Infof("Initialized repository [%v/%v] by the placeholder image [%v]",
+			dest.Registry(), repository, extension.BootstrapTag)
+	})
+	return r.err
+}
@@ -0,0 +1,34 @@
+package hangar
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseCompatibility(t *testing.T) {
+	c, err := ParseCompatibility("")
+	assert.Nil(t, err)
+	assert.Equal(t, CompatibilityNone, c)
+	c, err = ParseCompatibility("nexus")
+	assert.Nil(t, err)
+	assert.Equal(t, CompatibilityNexus, c)
+	assert.True(t, c.fallbackSchema2List())
+	c, err = ParseCompatibility("artifactory")
+	assert.Nil(t, err)
+	assert.Equal(t, CompatibilityArtifactory, c)
+	assert.False(t, c.fallbackSchema2List())
+	c, err = ParseCompatibility("gitlab")
+	assert.Nil(t, err)
+	assert.Equal(t, CompatibilityGitLab, c)
+	_, err = ParseCompatibility("quay")
+	assert.ErrorIs(t, err, ErrInvalidCompatibility)
+}
+
+func Test_compatProject(t *testing.T) {
+	c := &common{}
+	assert.Equal(t, "library", c.compatProject("library"))
+	c.compatRepository = "docker-hosted"
+	assert.Equal(t, "docker-hosted/library", c.compatProject("library"))
+	assert.Equal(t, "docker-hosted", c.compatProject(""))
+}
@@ -0,0 +1,205 @@
+package hangar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cnrancher/hangar/pkg/destination"
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	imagemanifest "github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// DeepVerify is the mode to fetch and hash the destination blobs when
+// validating, to detect the storage corruption of the destination
+// registry which could not be found by comparing the manifest digests.
+type DeepVerify string
+
+const (
+	// DeepVerifyNone only compares the manifest digests.
+	DeepVerifyNone DeepVerify = ""
+	// DeepVerifySample verifies the manifest, config and the first and
+	// last layers of the destination images.
+	DeepVerifySample DeepVerify = "sample"
+	// DeepVerifyFull verifies the manifest, config and all layers of
+	// the destination images.
+	DeepVerifyFull DeepVerify = "full"
+)
+
+var (
+	ErrInvalidDeepVerify = errors.New("invalid deep verify mode")
+	ErrPlatformMismatch  = errors.New("image config platform does not match the index")
+)
+
+// PlatformMismatch is the image whose config OS/architecture does not
+// match the platform of the manifest index entry, which causes the
+// 'exec format error' after deployed.
+type PlatformMismatch struct {
+	// Image is the destination image reference name with digest.
+	Image string `json:"image"`
+	// Index is the platform of the manifest index entry.
+	Index string `json:"index"`
+	// Config is the platform of the image config.
+	Config string `json:"config"`
+}
+
+// configPlatform is the platform fields of the image config.
+type configPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p *configPlatform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// matches checks whether the image config platform matches the index
+// entry, the variant is only compared if both are specified since the
+// variant is usually omitted in the image config.
+func (p *configPlatform) matches(want *configPlatform) bool {
+	if p.OS != want.OS || p.Architecture != want.Architecture {
+		return false
+	}
+	return p.Variant == "" || want.Variant == "" || p.Variant == want.Variant
+}
+
+// ParseDeepVerify parses the deep verify mode
+// (empty string, 'sample' or 'full').
+func ParseDeepVerify(s string) (DeepVerify, error) {
+	switch v := DeepVerify(s); v {
+	case DeepVerifyNone, DeepVerifySample, DeepVerifyFull:
+		return v, nil
+	}
+	return "", fmt.Errorf("%w %q: should be %q or %q", ErrInvalidDeepVerify,
+		s, DeepVerifySample, DeepVerifyFull)
+}
+
+// deepVerify fetches the manifests and blobs of the destination images
+// of the platforms to be validated and verifies the content by their
+// digests, returns nil if the deep verify is disabled.
+func (c *common) deepVerify(ctx context.Context, dest *destination.Destination) error {
+	if c.deepVerifyMode == DeepVerifyNone {
+		return nil
+	}
+	for _, img := range dest.ImageBySet(c.imageSpecSet).Images {
+		if err := c.deepVerifyImage(ctx, dest, img); err != nil {
+			return fmt.Errorf("%v: %w", dest.ReferenceNameDigest(img.Digest), err)
+		}
+	}
+	return nil
+}
+
+func (c *common) deepVerifyImage(
+	ctx context.Context, dest *destination.Destination, img archive.ImageSpec,
+) error {
+	d := img.Digest
+	ref, err := alltransports.ParseImageName(dest.ReferenceNameDigest(d))
+	if err != nil {
+		return fmt.Errorf("failed to parse image: %w", err)
+	}
+	src, err := ref.NewImageSource(ctx, dest.SystemContext())
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	b, mime, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := verifyDigest(b, d); err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	m, err := imagemanifest.FromBlob(b, mime)
+	if err != nil {
+		return err
+	}
+	config := m.ConfigInfo()
+	if isImageConfig(config.MediaType) && img.OS != "unknown" {
+		b, err := readBlob(ctx, src, config)
+		if err != nil {
+			return fmt.Errorf("config %v: %w", config.Digest, err)
+		}
+		got := &configPlatform{}
+		if err := json.Unmarshal(b, got); err != nil {
+			return fmt.Errorf("config %v: %w", config.Digest, err)
+		}
+		want := &configPlatform{OS: img.OS, Architecture: img.Arch, Variant: img.Variant}
+		if !got.matches(want) {
+			c.recordPlatformMismatch(PlatformMismatch{
+				Image:  dest.ReferenceNameDigest(d),
+				Index:  want.String(),
+				Config: got.String(),
+			})
+			return fmt.Errorf("%w: index %v, config %v",
+				ErrPlatformMismatch, want, got)
+		}
+		// The config blob is verified.
+		config.Digest = ""
+	}
+	blobs := []types.BlobInfo{config}
+	for _, l := range sampleLayers(m.LayerInfos(), c.deepVerifyMode) {
+		blobs = append(blobs, l.BlobInfo)
+	}
+	for _, info := range blobs {
+		if info.Digest == "" {
+			continue
+		}
+		if _, err := pullBlob(ctx, src, info); err != nil {
+			return fmt.Errorf("blob %v: %w", info.Digest, err)
+		}
+	}
+	return nil
+}
+
+// isImageConfig checks whether the config media type is the image config,
+// the configs of the artifacts (e.g. helm charts) have no platform.
+func isImageConfig(mediaType string) bool {
+	return mediaType == imagemanifest.DockerV2Schema2ConfigMediaType ||
+		mediaType == imgspecv1.MediaTypeImageConfig
+}
+
+// readBlob reads the small blob (e.g. image config) and verifies the
+// digest.
+func readBlob(ctx context.Context, src types.ImageSource, info types.BlobInfo) ([]byte, error) {
+	rc, _, err := src.GetBlob(ctx, info, none.NoCache)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyDigest(b, info.Digest); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// recordPlatformMismatch records the image whose config platform does not
+// match the index entry.
+func (c *common) recordPlatformMismatch(m PlatformMismatch) {
+	c.platformMismatchesMutex.Lock()
+	c.platformMismatches = append(c.platformMismatches, m)
+	c.platformMismatchesMutex.Unlock()
+}
+
+// sampleLayers returns the layers to be verified by the deep verify mode.
+func sampleLayers(layers []imagemanifest.LayerInfo, mode DeepVerify) []imagemanifest.LayerInfo {
+	if mode == DeepVerifyFull || len(layers) <= 2 {
+		return layers
+	}
+	return []imagemanifest.LayerInfo{layers[0], layers[len(layers)-1]}
+}
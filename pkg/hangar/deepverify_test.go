@@ -0,0 +1,47 @@
+package hangar
+
+import (
+	"testing"
+
+	imagemanifest "github.com/containers/image/v5/manifest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseDeepVerify(t *testing.T) {
+	v, err := ParseDeepVerify("")
+	assert.Nil(t, err)
+	assert.Equal(t, DeepVerifyNone, v)
+	v, err = ParseDeepVerify("full")
+	assert.Nil(t, err)
+	assert.Equal(t, DeepVerifyFull, v)
+	_, err = ParseDeepVerify("all")
+	assert.ErrorIs(t, err, ErrInvalidDeepVerify)
+}
+
+func Test_sampleLayers(t *testing.T) {
+	layers := make([]imagemanifest.LayerInfo, 5)
+	for i := range layers {
+		layers[i].Size = int64(i)
+	}
+	assert.Len(t, sampleLayers(layers, DeepVerifyFull), 5)
+	s := sampleLayers(layers, DeepVerifySample)
+	assert.Len(t, s, 2)
+	assert.Equal(t, int64(0), s[0].Size)
+	assert.Equal(t, int64(4), s[1].Size)
+	assert.Len(t, sampleLayers(layers[:2], DeepVerifySample), 2)
+}
+
+func Test_configPlatform_matches(t *testing.T) {
+	index := &configPlatform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	assert.True(t, (&configPlatform{OS: "linux", Architecture: "arm64"}).matches(index))
+	assert.True(t, (&configPlatform{OS: "linux", Architecture: "arm64", Variant: "v8"}).matches(index))
+	assert.False(t, (&configPlatform{OS: "linux", Architecture: "amd64"}).matches(index))
+	assert.False(t, (&configPlatform{OS: "linux", Architecture: "arm64", Variant: "v7"}).matches(index))
+	assert.Equal(t, "linux/arm64/v8", index.String())
+}
+
+func Test_isImageConfig(t *testing.T) {
+	assert.True(t, isImageConfig(imagemanifest.DockerV2Schema2ConfigMediaType))
+	assert.True(t, isImageConfig("application/vnd.oci.image.config.v1+json"))
+	assert.False(t, isImageConfig("application/vnd.in-toto+json"))
+}
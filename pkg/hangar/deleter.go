@@ -0,0 +1,298 @@
+package hangar
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/audit"
+	"github.com/cnrancher/hangar/pkg/logger"
+	"github.com/cnrancher/hangar/pkg/manifest"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// DeleteStatus is the result status of the deleted image.
+type DeleteStatus string
+
+const (
+	DeleteStatusDeleted  DeleteStatus = "deleted"
+	DeleteStatusDryRun   DeleteStatus = "dry-run"
+	DeleteStatusNotFound DeleteStatus = "not-found"
+	DeleteStatusMismatch DeleteStatus = "digest-mismatch"
+	DeleteStatusFailed   DeleteStatus = "failed"
+)
+
+// DeleteResult is the deletion result of an image in the report.
+type DeleteResult struct {
+	// Image is the image line in image list.
+	Image string `json:"image"`
+	// Reference is the destination image reference to be deleted.
+	Reference string `json:"reference"`
+	// Digest is the manifest digest of the destination image.
+	Digest string `json:"digest,omitempty"`
+	// ExpectedDigest is the digest specified in image list for confirmation.
+	ExpectedDigest string       `json:"expectedDigest,omitempty"`
+	Status         DeleteStatus `json:"status"`
+	Error          string       `json:"error,omitempty"`
+}
+
+// deleteObject is the object sending to worker pool when deleting image
+type deleteObject struct {
+	line     string
+	image    string
+	expected digest.Digest
+	timeout  time.Duration
+	id       int
+}
+
+func (o *deleteObject) name() string {
+	return o.line
+}
+
+// Deleter deletes the images in image list from destination registry.
+//
+// The image list line format is:
+//
+//	[REGISTRY]/[PROJECT]/[NAME]:[TAG]
+//	[REGISTRY]/[PROJECT]/[NAME]:[TAG]@[DIGEST]
+//
+// The image is only deleted if the manifest digest matches with the
+// DIGEST if provided.
+type Deleter struct {
+	*common
+
+	// results is the deletion results (thread-unsafe)
+	results []DeleteResult
+	// resultsMutex is a mutex for read/write of results
+	resultsMutex *sync.Mutex
+
+	// Override the registry of the images to be deleted
+	DestinationRegistry string
+	// DryRun only outputs the images to be deleted without deleting
+	DryRun bool
+}
+
+type DeleterOpts struct {
+	CommonOpts
+
+	// Override the registry of the images to be deleted
+	DestinationRegistry string
+	// DryRun only outputs the images to be deleted without deleting
+	DryRun bool
+}
+
+func NewDeleter(o *DeleterOpts) (*Deleter, error) {
+	d := &Deleter{
+		resultsMutex:        &sync.Mutex{},
+		DestinationRegistry: o.DestinationRegistry,
+		DryRun:              o.DryRun,
+	}
+	var err error
+	d.common, err = newCommon(&o.CommonOpts)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Deleter) newObject(id int, line string) (*deleteObject, error) {
+	image, dgst, _ := strings.Cut(strings.TrimSpace(line), "@")
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image %q: %w", line, err)
+	}
+	if _, ok := named.(reference.Tagged); !ok {
+		return nil, fmt.Errorf("invalid image %q: tag not provided", line)
+	}
+	image = named.String()
+	if d.DestinationRegistry != "" {
+		image = d.DestinationRegistry + "/" + reference.Path(named) + ":" +
+			named.(reference.Tagged).Tag()
+	}
+	o := &deleteObject{
+		line:    line,
+		image:   image,
+		timeout: d.timeout,
+		id:      id,
+	}
+	if dgst != "" {
+		if o.expected, err = digest.Parse(dgst); err != nil {
+			return nil, fmt.Errorf("invalid digest of %q: %w", line, err)
+		}
+	}
+	return o, nil
+}
+
+// Run deletes the images from destination registry.
+func (d *Deleter) Run(ctx context.Context) error {
+	d.common.initErrorHandler(ctx)
+	d.common.initWorker(ctx, d.worker)
+	for i, line := range d.common.images {
+		object, err := d.newObject(i+1, line)
+		if err != nil {
+			d.recordResult(DeleteResult{
+				Image:  line,
+				Status: DeleteStatusFailed,
+				Error:  err.Error(),
+			})
+			d.recordFailedImage(line)
+			d.handleError(NewError(i+1, err, nil, nil))
+			continue
+		}
+		d.handleObject(object)
+	}
+	d.waitWorkers()
+	if len(d.failedImageSet) != 0 {
+		v := make([]string, 0, len(d.failedImageSet))
+		for i := range d.failedImageSet {
+			v = append(v, i)
+		}
+		logrus.Errorf("Delete failed image list: \n%v", strings.Join(v, "\n"))
+		return d.failedError(ErrDeleteFailed)
+	}
+	return nil
+}
+
+// Validate is not supported by deleter, use DryRun instead.
+func (d *Deleter) Validate(ctx context.Context) error {
+	return fmt.Errorf("validate is not supported by deleter")
+}
+
+// Results returns the deletion results sorted by image.
+func (d *Deleter) Results() []DeleteResult {
+	d.resultsMutex.Lock()
+	defer d.resultsMutex.Unlock()
+
+	results := make([]DeleteResult, len(d.results))
+	copy(results, d.results)
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Image < results[j].Image
+	})
+	return results
+}
+
+func (d *Deleter) recordResult(r DeleteResult) {
+	d.resultsMutex.Lock()
+	d.results = append(d.results, r)
+	d.resultsMutex.Unlock()
+}
+
+func (d *Deleter) worker(ctx context.Context, o any) {
+	if o == nil {
+		return
+	}
+	obj, ok := o.(*deleteObject)
+	if !ok {
+		logrus.Errorf("skip object type(%T), data %v", o, o)
+		return
+	}
+
+	var (
+		deleteContext context.Context
+		cancel        context.CancelFunc
+		err           error
+		result        = DeleteResult{
+			Image:          obj.line,
+			Reference:      obj.image,
+			ExpectedDigest: obj.expected.String(),
+		}
+	)
+	if obj.timeout > 0 {
+		deleteContext, cancel = context.WithTimeout(ctx, obj.timeout)
+	} else {
+		deleteContext, cancel = context.WithCancel(ctx)
+	}
+	defer func() {
+		cancel()
+		d.finishResult(obj, &result, err)
+	}()
+
+	log := logger.FromContext(ctx).WithField(logger.ImageField, obj.id)
+	ref, err := alltransports.ParseImageName("docker://" + obj.image)
+	if err != nil {
+		err = fmt.Errorf("failed to parse image: %w", err)
+		return
+	}
+	inspector, err := manifest.NewInspector(deleteContext, &manifest.InspectorOption{
+		Reference:     ref,
+		SystemContext: d.systemContext,
+	})
+	if err != nil {
+		if utils.IsManifestUnknown(err) {
+			log.Warnf("Skip deleting [%v]: not found", obj.image)
+			result.Status = DeleteStatusNotFound
+			err = nil
+		}
+		return
+	}
+	b, _, err := inspector.Raw(deleteContext)
+	inspector.Close()
+	if err != nil {
+		return
+	}
+	// Calculate the digest by the algorithm of the expected digest.
+	var algorithm digest.Algorithm
+	if obj.expected != "" {
+		algorithm = obj.expected.Algorithm()
+	}
+	dgst, err := manifest.Digest(b, algorithm)
+	if err != nil {
+		return
+	}
+	result.Digest = dgst.String()
+	if obj.expected != "" && obj.expected != dgst {
+		result.Status = DeleteStatusMismatch
+		err = fmt.Errorf("skip deleting [%v]: digest %v does not match %v",
+			obj.image, dgst, obj.expected)
+		return
+	}
+	if d.DryRun {
+		log.Infof("[DRY-RUN] Delete [%v@%v]", obj.image, dgst)
+		result.Status = DeleteStatusDryRun
+		return
+	}
+
+	// Delete the verified digest rather than the tag, the tag may be
+	// pushed to another manifest after the digest checked.
+	named, err := reference.ParseNormalizedNamed(obj.image)
+	if err != nil {
+		err = fmt.Errorf("failed to parse image: %w", err)
+		return
+	}
+	digestRef, err := alltransports.ParseImageName(
+		"docker://" + reference.TrimNamed(named).String() + "@" + dgst.String())
+	if err != nil {
+		err = fmt.Errorf("failed to parse image: %w", err)
+		return
+	}
+	log.Infof("Deleting [%v@%v]", obj.image, dgst)
+	err = digestRef.DeleteImage(deleteContext, d.systemContext)
+	recordAudit(ctx, audit.ActionDelete, "", obj.image,
+		[]string{dgst.String()}, err)
+	if err != nil {
+		err = fmt.Errorf("failed to delete [%v]: %w", obj.image, err)
+		return
+	}
+	result.Status = DeleteStatusDeleted
+}
+
+// finishResult records the deletion result of the object, the result is
+// marked as failed if the error is not nil and the status is not set.
+func (d *Deleter) finishResult(obj *deleteObject, result *DeleteResult, err error) {
+	if err != nil {
+		if result.Status == "" {
+			result.Status = DeleteStatusFailed
+		}
+		result.Error = err.Error()
+		d.handleError(NewError(obj.id, err, nil, nil))
+		d.recordFailedImage(obj.line)
+	}
+	d.recordResult(*result)
+}
@@ -0,0 +1,65 @@
+package hangar
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deleter_newObject(t *testing.T) {
+	d := &Deleter{}
+	o, err := d.newObject(1, "harbor.local/app/app:1.2.3")
+	assert.Nil(t, err)
+	assert.Equal(t, "harbor.local/app/app:1.2.3", o.image)
+	assert.Equal(t, "", o.expected.String())
+
+	o, err = d.newObject(1, "nginx:stable@sha256:"+
+		"0000000000000000000000000000000000000000000000000000000000000000")
+	assert.Nil(t, err)
+	assert.Equal(t, "docker.io/library/nginx:stable", o.image)
+	assert.Equal(t, "sha256:"+
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		o.expected.String())
+
+	d.DestinationRegistry = "registry.local"
+	o, err = d.newObject(1, "harbor.local/app/app:1.2.3")
+	assert.Nil(t, err)
+	assert.Equal(t, "registry.local/app/app:1.2.3", o.image)
+
+	_, err = d.newObject(1, "harbor.local/app/app")
+	assert.NotNil(t, err)
+	_, err = d.newObject(1, "harbor.local/app/app:1.2.3@sha256:abc")
+	assert.NotNil(t, err)
+}
+
+func Test_Deleter_finishResult(t *testing.T) {
+	d := &Deleter{
+		common:       newTestCommon(t),
+		resultsMutex: &sync.Mutex{},
+	}
+	// Skip sending the errors to the error handler.
+	var cancel context.CancelFunc
+	d.errorCtx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	o := &deleteObject{line: "nginx:1.25", id: 1}
+	d.finishResult(o, &DeleteResult{Image: "nginx:1.25", Status: DeleteStatusDeleted}, nil)
+	o = &deleteObject{line: "nginx:1.26", id: 2}
+	d.finishResult(o, &DeleteResult{Image: "nginx:1.26", Status: DeleteStatusMismatch},
+		errors.New("digest mismatch"))
+	o = &deleteObject{line: "nginx:1.27", id: 3}
+	d.finishResult(o, &DeleteResult{Image: "nginx:1.27"}, errors.New("unauthorized"))
+
+	results := d.Results()
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, DeleteStatusDeleted, results[0].Status)
+	assert.Equal(t, "", results[0].Error)
+	// The status set before the error is kept.
+	assert.Equal(t, DeleteStatusMismatch, results[1].Status)
+	assert.Equal(t, "digest mismatch", results[1].Error)
+	assert.Equal(t, DeleteStatusFailed, results[2].Status)
+	assert.Equal(t, map[string]bool{"nginx:1.26": true, "nginx:1.27": true}, d.failedImageSet)
+}
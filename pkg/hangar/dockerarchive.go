@@ -0,0 +1,93 @@
+package hangar
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/cnrancher/hangar/pkg/hangar/imagelist"
+	"github.com/cnrancher/hangar/pkg/source"
+	"github.com/cnrancher/hangar/pkg/types"
+	"github.com/cnrancher/hangar/pkg/utils"
+	imagetypes "github.com/containers/image/v5/types"
+)
+
+// newDockerArchiveSource creates the source image of the docker-archive
+// image list line, returns the source and the image reference in the
+// tarball, which is used as the destination image name.
+//
+// The '--source' and '--source-project' options are not applied since
+// the image is read from the local tarball.
+func newDockerArchiveSource(
+	line string, sysCtx *imagetypes.SystemContext,
+) (*source.Source, string, error) {
+	path, ref, ok := imagelist.GetDockerArchiveSpec(line)
+	if !ok {
+		return nil, "", fmt.Errorf("invalid docker-archive image %q", line)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, "", fmt.Errorf("failed to read docker-archive tarball: %w", err)
+	}
+	src, err := source.NewSource(&source.Option{
+		Type:          types.TypeDockerArhive,
+		Directory:     path,
+		Registry:      utils.GetRegistryName(ref),
+		Project:       utils.GetProjectName(ref),
+		Name:          utils.GetImageName(ref),
+		Tag:           utils.GetImageTag(ref),
+		SystemContext: sysCtx,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return src, ref, nil
+}
+
+// newImageListSource creates the source image of the image list line in
+// default, pair or docker-archive format, returns the source and the image
+// reference used as the destination image name.
+func newImageListSource(
+	line, sourceRegistry, sourceProject string, sysCtx *imagetypes.SystemContext,
+) (*source.Source, string, error) {
+	switch imagelist.Detect(line) {
+	case imagelist.TypeDockerArchive:
+		return newDockerArchiveSource(line, sysCtx)
+	case imagelist.TypePair:
+		src, dst, _ := imagelist.GetPairSpec(line)
+		s, _, err := newImageListSource(src, sourceRegistry, sourceProject, sysCtx)
+		if err != nil {
+			return nil, "", err
+		}
+		return s, dst, nil
+	}
+	if sourceRegistry == "" {
+		sourceRegistry = utils.GetRegistryName(line)
+	}
+	if sourceProject == "" {
+		sourceProject = utils.GetProjectName(line)
+	}
+	src, err := source.NewSource(&source.Option{
+		Type:          types.TypeDocker,
+		Registry:      sourceRegistry,
+		Project:       sourceProject,
+		Name:          utils.GetImageName(line),
+		Tag:           utils.GetImageTag(line),
+		SystemContext: sysCtx,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return src, line, nil
+}
+
+// renamePairImage renames the copied image of the pair image list line
+// to the destination image, other lines are not renamed.
+func renamePairImage(line string, image *archive.Image) {
+	_, dst, ok := imagelist.GetPairSpec(line)
+	if !ok {
+		return
+	}
+	image.Source = fmt.Sprintf("%s/%s/%s", utils.GetRegistryName(dst),
+		utils.GetProjectName(dst), utils.GetImageName(dst))
+	image.Tag = utils.GetImageTag(dst)
+}
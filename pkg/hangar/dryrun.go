@@ -0,0 +1,204 @@
+package hangar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/hangar/imagelist"
+	"github.com/cnrancher/hangar/pkg/logger"
+	"github.com/cnrancher/hangar/pkg/manifest"
+	"github.com/cnrancher/hangar/pkg/source"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// PlannedImage is the platform image would be copied, which is resolved
+// in dry-run mode.
+type PlannedImage struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination,omitempty"`
+	// Platform in 'os/arch[/variant]' format, 'chart' for the Helm chart.
+	Platform string        `json:"platform"`
+	Digest   digest.Digest `json:"digest"`
+	// Size is the compressed size of the config and layers.
+	Size int64 `json:"size"`
+}
+
+// Plan is the platform images would be copied in dry-run mode.
+type Plan struct {
+	Images []PlannedImage `json:"images"`
+	// Total is the sum of the size of the planned images.
+	Total int64 `json:"total"`
+}
+
+// DryRunner resolves the source manifests and the platforms would be
+// copied without performing any writes.
+type DryRunner interface {
+	DryRun(ctx context.Context) (*Plan, error)
+}
+
+// planObject is the source image resolved by the plan worker.
+type planObject struct {
+	id          int
+	image       string
+	source      *source.Source
+	destination string
+}
+
+// dryRun resolves the planned images of the objects by the workers,
+// the objects are sent by the send function.
+func (c *common) dryRun(ctx context.Context, send func()) (*Plan, error) {
+	c.dryRunMode = true
+	c.initErrorHandler(ctx)
+	c.initWorker(ctx, c.planWorker)
+	send()
+	c.waitWorkers()
+
+	c.plannedMutex.Lock()
+	defer c.plannedMutex.Unlock()
+	plan := &Plan{
+		Images: append([]PlannedImage{}, c.planned...),
+	}
+	sort.SliceStable(plan.Images, func(i, j int) bool {
+		return plan.Images[i].Source < plan.Images[j].Source
+	})
+	for _, img := range plan.Images {
+		plan.Total += img.Size
+	}
+	if len(c.failedImageSet) != 0 {
+		v := make([]string, 0, len(c.failedImageSet))
+		for i := range c.failedImageSet {
+			v = append(v, i)
+		}
+		logrus.Errorf("Dry-run failed image list: \n%v", strings.Join(v, "\n"))
+		return plan, c.failedError(ErrValidateFailed)
+	}
+	return plan, nil
+}
+
+// planImageList sends the source images of the image list lines into the
+// plan workers, the destination is the archive name.
+func (c *common) planImageList(sourceRegistry, sourceProject, archiveName string) {
+	for i, img := range c.images {
+		switch imagelist.Detect(img) {
+		case imagelist.TypeDefault, imagelist.TypePair, imagelist.TypeDockerArchive:
+		default:
+			logrus.Warnf("Ignore image list line %q: invalid format", img)
+			continue
+		}
+		src, _, err := newImageListSource(
+			img, sourceRegistry, sourceProject, c.systemContext)
+		if err != nil {
+			c.handleError(fmt.Errorf("failed to init source image: %w", err))
+			c.recordFailedImage(img)
+			continue
+		}
+		c.handleObject(&planObject{
+			id:          i + 1,
+			image:       img,
+			source:      src,
+			destination: archiveName,
+		})
+	}
+}
+
+func (c *common) planWorker(ctx context.Context, o any) {
+	obj, ok := o.(*planObject)
+	if !ok {
+		logrus.Errorf("skip object type(%T), data %v", o, o)
+		return
+	}
+	var (
+		planContext context.Context
+		cancel      context.CancelFunc
+	)
+	if c.timeout > 0 {
+		planContext, cancel = context.WithTimeout(ctx, c.timeout)
+	} else {
+		planContext, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	images, err := c.resolvePlan(planContext, obj)
+	if errors.Is(err, utils.ErrNoAvailableImage) {
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+			Warnf("Skip copy image [%v]: %v",
+				obj.source.ReferenceNameWithoutTransport(), err)
+		c.skipOptional(obj.image, err)
+		return
+	}
+	if err != nil {
+		if c.skipOptional(obj.image, err) {
+			return
+		}
+		c.handleError(NewError(obj.id, err, obj.source, nil))
+		c.recordFailedImage(obj.image)
+		return
+	}
+	for _, img := range images {
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+			Infof("[DRY-RUN] Copy [%v] %v %v (%v)",
+				img.Source, img.Platform, img.Digest, utils.FormatSize(img.Size))
+	}
+	c.plannedMutex.Lock()
+	c.planned = append(c.planned, images...)
+	c.plannedMutex.Unlock()
+}
+
+// planImage resolves the platform images of the source image filtered by
+// the arch & os list, the sizes are calculated by the manifests without
+// pulling the blobs.
+func (c *common) planImage(ctx context.Context, obj *planObject) ([]PlannedImage, error) {
+	if err := obj.source.Init(ctx); err != nil {
+		return nil, fmt.Errorf("failed to init [%v]: %w",
+			obj.source.ReferenceName(), err)
+	}
+	if obj.source.IsHelmChart() {
+		// The chart is copied without filtering by the platforms.
+		return []PlannedImage{{
+			Source:      obj.source.ReferenceNameWithoutTransport(),
+			Destination: obj.destination,
+			Platform:    "chart",
+			Digest:      obj.source.Digest(),
+			Size:        obj.source.ChartSize(),
+		}}, nil
+	}
+	set := map[digest.Digest]bool{}
+	for _, img := range obj.source.ImageBySet(c.imageSpecSet).Images {
+		set[img.Digest] = true
+	}
+	if len(set) == 0 {
+		return nil, utils.ErrNoAvailableImage
+	}
+	inspector, err := manifest.NewInspector(ctx, &manifest.InspectorOption{
+		ReferenceName: obj.source.ReferenceName(),
+		SystemContext: obj.source.SystemContext(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer inspector.Close()
+	info, err := inspector.Size(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get size of [%v]: %w",
+			obj.source.ReferenceNameWithoutTransport(), err)
+	}
+	var images []PlannedImage
+	for _, p := range info.Platforms {
+		if !set[p.Digest] {
+			continue
+		}
+		images = append(images, PlannedImage{
+			Source:      obj.source.ReferenceNameWithoutTransport(),
+			Destination: obj.destination,
+			Platform:    p.Platform,
+			Digest:      p.Digest,
+			Size:        p.Size,
+		})
+	}
+	return images, nil
+}
@@ -0,0 +1,91 @@
+package hangar
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrTooManyFailures = errors.New("too many failures, job aborted")
+)
+
+// FailureThreshold is the max failures of the job before aborting early,
+// the threshold is the count of failed images or the percent of the
+// total images.
+type FailureThreshold struct {
+	Count     int
+	Percent   float64
+	IsPercent bool
+}
+
+// ParseFailureThreshold parses the failure threshold in count (e.g. '5')
+// or percent (e.g. '5%') format, returns nil if s is empty.
+func ParseFailureThreshold(s string) (*FailureThreshold, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || v < 0 || v > 100 {
+			return nil, fmt.Errorf("invalid failure threshold %q: percent should be in range 0-100", s)
+		}
+		return &FailureThreshold{Percent: v, IsPercent: true}, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("invalid failure threshold %q: should be a non-negative count or percent", s)
+	}
+	return &FailureThreshold{Count: v}, nil
+}
+
+// Exceeded checks whether the failed number exceeds the threshold.
+func (t *FailureThreshold) Exceeded(failed, total int) bool {
+	if t == nil {
+		return false
+	}
+	if t.IsPercent {
+		if total == 0 {
+			return false
+		}
+		return float64(failed)*100/float64(total) > t.Percent
+	}
+	return failed > t.Count
+}
+
+func (t *FailureThreshold) String() string {
+	if t == nil {
+		return "unlimited"
+	}
+	if t.IsPercent {
+		return strconv.FormatFloat(t.Percent, 'f', -1, 64) + "%"
+	}
+	return strconv.Itoa(t.Count)
+}
+
+// checkFailureThreshold aborts the job if the failed images exceed the
+// failure threshold, the job never aborts if keepGoing is enabled.
+func (c *common) checkFailureThreshold(failed int) {
+	if c.keepGoing || c.abort == nil || !c.maxFailures.Exceeded(failed, c.total) {
+		return
+	}
+	c.abortOnce.Do(func() {
+		logrus.Errorf("Failed images (%d/%d) exceed the failure threshold %v, aborting",
+			failed, c.total, c.maxFailures)
+		c.aborted.Store(true)
+		c.abort()
+	})
+}
+
+// failedError returns the error of the failed job, ErrTooManyFailures is
+// wrapped if the job was aborted by the failure threshold.
+func (c *common) failedError(err error) error {
+	if c.aborted.Load() {
+		return fmt.Errorf("%w: %w", err, ErrTooManyFailures)
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package hangar
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseFailureThreshold(t *testing.T) {
+	th, err := ParseFailureThreshold("")
+	assert.Nil(t, err)
+	assert.Nil(t, th)
+	assert.False(t, th.Exceeded(100, 100))
+
+	th, err = ParseFailureThreshold("5")
+	assert.Nil(t, err)
+	assert.Equal(t, "5", th.String())
+	assert.False(t, th.Exceeded(5, 10))
+	assert.True(t, th.Exceeded(6, 10))
+
+	th, err = ParseFailureThreshold("5%")
+	assert.Nil(t, err)
+	assert.Equal(t, "5%", th.String())
+	assert.False(t, th.Exceeded(5, 100))
+	assert.True(t, th.Exceeded(6, 100))
+	assert.False(t, th.Exceeded(1, 0))
+
+	th, err = ParseFailureThreshold("0%")
+	assert.Nil(t, err)
+	assert.True(t, th.Exceeded(1, 100))
+
+	for _, s := range []string{"-1", "abc", "101%", "-5%"} {
+		_, err = ParseFailureThreshold(s)
+		assert.NotNil(t, err)
+	}
+}
+
+func Test_CheckFailureThreshold(t *testing.T) {
+	th, _ := ParseFailureThreshold("1")
+	newFailureCommon := func(keepGoing bool) *common {
+		c := newTestCommon(t)
+		c.total = 10
+		c.maxFailures = th
+		c.keepGoing = keepGoing
+		c.objectCtx, c.abort = context.WithCancel(context.Background())
+		return c
+	}
+
+	c := newFailureCommon(false)
+	c.checkFailureThreshold(1)
+	assert.Nil(t, c.objectCtx.Err())
+	assert.Equal(t, ErrCopyFailed, c.failedError(ErrCopyFailed))
+	c.checkFailureThreshold(2)
+	assert.NotNil(t, c.objectCtx.Err())
+	assert.ErrorIs(t, c.failedError(ErrCopyFailed), ErrTooManyFailures)
+	assert.ErrorIs(t, c.failedError(ErrCopyFailed), ErrCopyFailed)
+
+	c = newFailureCommon(true)
+	c.checkFailureThreshold(5)
+	assert.Nil(t, c.objectCtx.Err())
+	assert.Equal(t, ErrCopyFailed, c.failedError(ErrCopyFailed))
+}
@@ -0,0 +1,214 @@
+package hangar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/copy"
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/cnrancher/hangar/pkg/logger"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/common/pkg/retry"
+	imagecopy "github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/transports/alltransports"
+)
+
+// PlatformFallback is the mode to handle the images missing the
+// requested platforms.
+type PlatformFallback string
+
+const (
+	// PlatformFallbackNone does not check the missing platforms.
+	PlatformFallbackNone PlatformFallback = ""
+	// PlatformFallbackReport records the missing platforms only.
+	PlatformFallbackReport PlatformFallback = "report"
+	// PlatformFallbackCopy records the missing platforms and copies the
+	// linux/amd64 image as the fallback image of the missing platforms.
+	PlatformFallbackCopy PlatformFallback = "copy"
+)
+
+const (
+	fallbackOS   = "linux"
+	fallbackArch = "amd64"
+	// fallbackSuffix is the tag suffix of the fallback image, example:
+	// nginx:1.25-linux-arm64-fallback
+	fallbackSuffix = "-fallback"
+)
+
+var ErrInvalidPlatformFallback = errors.New("invalid platform fallback mode")
+
+// ParsePlatformFallback parses the platform fallback mode
+// (empty string, 'report' or 'copy').
+func ParsePlatformFallback(s string) (PlatformFallback, error) {
+	switch f := PlatformFallback(s); f {
+	case PlatformFallbackNone, PlatformFallbackReport, PlatformFallbackCopy:
+		return f, nil
+	}
+	return "", fmt.Errorf("%w %q: should be %q or %q", ErrInvalidPlatformFallback,
+		s, PlatformFallbackReport, PlatformFallbackCopy)
+}
+
+// PlatformGap is the requested platforms missing in the source image.
+type PlatformGap struct {
+	// Image is the source image reference name.
+	Image string `json:"image"`
+	// Missing is the missing platforms in OS/ARCH format.
+	Missing []string `json:"missing"`
+	// Fallbacks is the copied fallback image reference names.
+	Fallbacks []string `json:"fallbacks,omitempty"`
+	// Error is the error message if failed to copy the fallback image.
+	Error string `json:"error,omitempty"`
+}
+
+type platformGaps struct {
+	mu   sync.Mutex
+	gaps []*PlatformGap
+}
+
+func (g *platformGaps) record(gap *PlatformGap) {
+	g.mu.Lock()
+	g.gaps = append(g.gaps, gap)
+	g.mu.Unlock()
+}
+
+// sorted returns the gaps sorted by the image name.
+func (g *platformGaps) sorted() []*PlatformGap {
+	g.mu.Lock()
+	gaps := append([]*PlatformGap{}, g.gaps...)
+	g.mu.Unlock()
+	sort.Slice(gaps, func(i, j int) bool {
+		return gaps[i].Image < gaps[j].Image
+	})
+	return gaps
+}
+
+// missingPlatforms returns the requested platforms (OS/ARCH) not available
+// in the source images, returns nil if the source is not a manifest list.
+func missingPlatforms(images []archive.ImageSpec, set map[string]map[string]bool) []string {
+	if len(images) == 0 || len(set["arch"]) == 0 {
+		return nil
+	}
+	available := map[string]bool{}
+	osSet := map[string]bool{}
+	for _, img := range images {
+		if img.Arch == "" {
+			// Single-arch image.
+			return nil
+		}
+		available[img.OS+"/"+img.Arch] = true
+		osSet[img.OS] = true
+	}
+	if len(set["os"]) != 0 {
+		osSet = set["os"]
+	}
+	var missing []string
+	for os := range osSet {
+		for arch := range set["arch"] {
+			if !available[os+"/"+arch] {
+				missing = append(missing, os+"/"+arch)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// fallbackImage returns the linux/amd64 image of the images.
+func fallbackImage(images []archive.ImageSpec) *archive.ImageSpec {
+	for i := range images {
+		if images[i].OS == fallbackOS && images[i].Arch == fallbackArch {
+			return &images[i]
+		}
+	}
+	return nil
+}
+
+// checkPlatformGap records the platforms missing in the source image and
+// copies the fallback image if enabled, the fallback copy error will not
+// fail the image.
+func (m *Mirrorer) checkPlatformGap(ctx context.Context, obj *mirrorObject) {
+	if m.PlatformFallback == PlatformFallbackNone {
+		return
+	}
+	images := obj.source.ImageBySet(map[string]map[string]bool{
+		"os": m.imageSpecSet["os"],
+	}).Images
+	missing := missingPlatforms(images, m.imageSpecSet)
+	if len(missing) == 0 {
+		return
+	}
+	gap := &PlatformGap{
+		Image:   obj.source.ReferenceNameWithoutTransport(),
+		Missing: missing,
+	}
+	defer m.platformGaps.record(gap)
+	l := logger.FromContext(ctx).WithField(logger.ImageField, obj.id)
+	l.Warnf("Image [%v] missing platforms %v", gap.Image, missing)
+	if m.PlatformFallback != PlatformFallbackCopy {
+		return
+	}
+
+	fallback := fallbackImage(obj.source.ImageBySet(nil).Images)
+	if fallback == nil {
+		gap.Error = fmt.Sprintf("image does not have %s/%s fallback platform",
+			fallbackOS, fallbackArch)
+		l.Warnf("Skip copy fallback image of [%v]: %v", gap.Image, gap.Error)
+		return
+	}
+	for _, p := range missing {
+		os, arch, _ := strings.Cut(p, "/")
+		destName := obj.destination.MultiArchTag(os, "", arch, "") + fallbackSuffix
+		if err := m.copyFallback(ctx, obj, fallback, destName); err != nil {
+			gap.Error = err.Error()
+			l.Warnf("Failed to copy fallback image of [%v]: %v", gap.Image, err)
+			return
+		}
+		gap.Fallbacks = append(gap.Fallbacks,
+			strings.TrimPrefix(destName, obj.destination.Type().Transport()))
+		l.Infof("Copied %s/%s image of [%v] as the %s fallback",
+			fallbackOS, fallbackArch, gap.Image, p)
+	}
+}
+
+func (m *Mirrorer) copyFallback(
+	ctx context.Context, obj *mirrorObject, image *archive.ImageSpec, destName string,
+) error {
+	src := obj.source
+	sourceRef, err := alltransports.ParseImageName(fmt.Sprintf("%s%s/%s/%s@%s",
+		src.Type().Transport(), src.Registry(), src.Project(), src.Name(), image.Digest))
+	if err != nil {
+		return err
+	}
+	destRef, err := alltransports.ParseImageName(destName)
+	if err != nil {
+		return err
+	}
+	copier := copy.NewCopier(&copy.CopierOption{
+		Options: &imagecopy.Options{
+			SourceCtx:       utils.CopySystemContext(m.systemContext),
+			DestinationCtx:  utils.CopySystemContext(obj.destination.SystemContext()),
+			PreserveDigests: true,
+		},
+		RetryOptions: &retry.Options{
+			MaxRetry: 3,
+			Delay:    time.Millisecond * 100,
+		},
+		SourceRef:       copy.NewLimitedReference(sourceRef, m.memoryLimiter),
+		DestRef:         destRef,
+		Policy:          m.policy,
+		BlobConcurrency: m.blobConcurrency,
+	})
+	_, err = copier.Copy(ctx)
+	return err
+}
+
+// PlatformGaps returns the images missing the requested platforms,
+// should be called after the job finished.
+func (m *Mirrorer) PlatformGaps() []*PlatformGap {
+	return m.platformGaps.sorted()
+}
@@ -0,0 +1,58 @@
+package hangar
+
+import (
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParsePlatformFallback(t *testing.T) {
+	f, err := ParsePlatformFallback("")
+	assert.Nil(t, err)
+	assert.Equal(t, PlatformFallbackNone, f)
+	f, err = ParsePlatformFallback("copy")
+	assert.Nil(t, err)
+	assert.Equal(t, PlatformFallbackCopy, f)
+	_, err = ParsePlatformFallback("amd64")
+	assert.ErrorIs(t, err, ErrInvalidPlatformFallback)
+}
+
+func Test_missingPlatforms(t *testing.T) {
+	set := map[string]map[string]bool{
+		"os":   {"linux": true},
+		"arch": {"amd64": true, "arm64": true, "s390x": true},
+	}
+	images := []archive.ImageSpec{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "arm64"},
+	}
+	assert.Equal(t, []string{"linux/s390x"}, missingPlatforms(images, set))
+
+	images = images[:1]
+	assert.Equal(t, []string{"linux/arm64", "linux/s390x"}, missingPlatforms(images, set))
+
+	// Single-arch image.
+	assert.Len(t, missingPlatforms([]archive.ImageSpec{{Digest: "sha256:abc"}}, set), 0)
+	// Arch not specified.
+	assert.Len(t, missingPlatforms(images, map[string]map[string]bool{}), 0)
+	assert.Len(t, missingPlatforms(nil, set), 0)
+}
+
+func Test_fallbackImage(t *testing.T) {
+	images := []archive.ImageSpec{
+		{OS: "windows", Arch: "amd64", Digest: "sha256:1"},
+		{OS: "linux", Arch: "amd64", Digest: "sha256:2"},
+	}
+	assert.Equal(t, "sha256:2", fallbackImage(images).Digest.String())
+	assert.Nil(t, fallbackImage(images[:1]))
+}
+
+func Test_platformGaps(t *testing.T) {
+	g := &platformGaps{}
+	g.record(&PlatformGap{Image: "docker.io/library/nginx:latest"})
+	g.record(&PlatformGap{Image: "docker.io/library/busybox:latest"})
+	gaps := g.sorted()
+	assert.Equal(t, 2, len(gaps))
+	assert.Equal(t, "docker.io/library/busybox:latest", gaps[0].Image)
+}
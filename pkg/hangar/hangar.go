@@ -8,6 +8,8 @@ import (
 var (
 	ErrValidateFailed = errors.New("some images failed to validate")
 	ErrCopyFailed     = errors.New("some images failed to copy")
+	ErrDeleteFailed   = errors.New("some images failed to delete")
+	ErrPullFailed     = errors.New("some images failed to pull")
 )
 
 type Hangar interface {
@@ -0,0 +1,149 @@
+package imagelist
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// GitPrefix is the prefix of the image list hosted in git repository.
+const GitPrefix = "git+"
+
+// GitSource is the image list file in git repository at the pinned ref.
+//
+//	Example:
+//		git+https://github.com/org/repo.git//lists/images.txt@v1.0.0
+type GitSource struct {
+	// URL is the clone URL of the git repository.
+	URL string
+	// Path is the path of the image list file in the repository.
+	Path string
+	// Ref is the branch, tag or commit of the image list, HEAD if empty.
+	Ref string
+}
+
+// IsGitSource checks whether the image list file name is the git source.
+func IsGitSource(name string) bool {
+	return strings.HasPrefix(name, GitPrefix)
+}
+
+// ParseGitSource parses the 'git+URL//PATH@REF' image list file name.
+func ParseGitSource(name string) (*GitSource, error) {
+	if !IsGitSource(name) {
+		return nil, fmt.Errorf("invalid git source %q: %q prefix not found", name, GitPrefix)
+	}
+	s := strings.TrimPrefix(name, GitPrefix)
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok || scheme == "" {
+		return nil, fmt.Errorf("invalid git source %q: URL scheme not found", name)
+	}
+	repo, p, ok := strings.Cut(rest, "//")
+	if !ok || repo == "" || p == "" {
+		return nil, fmt.Errorf("invalid git source %q: should be 'git+URL//PATH@REF'", name)
+	}
+	g := &GitSource{
+		URL:  scheme + "://" + repo,
+		Path: p,
+	}
+	if i := strings.LastIndex(p, "@"); i >= 0 {
+		g.Path, g.Ref = p[:i], p[i+1:]
+		if g.Ref == "" {
+			return nil, fmt.Errorf("invalid git source %q: empty ref", name)
+		}
+	}
+	g.Path = strings.Trim(g.Path, "/")
+	if g.Path == "" {
+		return nil, fmt.Errorf("invalid git source %q: empty path", name)
+	}
+	return g, nil
+}
+
+// String returns the git source without the credential of the URL.
+func (g *GitSource) String() string {
+	s := GitPrefix + redactURL(g.URL) + "//" + g.Path
+	if g.Ref != "" {
+		s += "@" + g.Ref
+	}
+	return s
+}
+
+// Fetch clones the repository into memory and reads the image list file
+// at the ref, returns the content and the resolved commit hash. The
+// credential of the URL is used if the username is empty.
+func (g *GitSource) Fetch(ctx context.Context, username, password string) ([]byte, string, error) {
+	o := &git.CloneOptions{
+		URL:        g.URL,
+		Tags:       git.AllTags,
+		NoCheckout: true,
+	}
+	if u, err := url.Parse(g.URL); err == nil && u.User != nil {
+		p, _ := u.User.Password()
+		o.Auth = &http.BasicAuth{Username: u.User.Username(), Password: p}
+		u.User = nil
+		o.URL = u.String()
+	}
+	if username != "" || password != "" {
+		o.Auth = &http.BasicAuth{Username: username, Password: password}
+	}
+	r, err := git.CloneContext(ctx, memory.NewStorage(), nil, o)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to clone %q: %w", redactURL(g.URL), err)
+	}
+	hash, err := g.resolve(r)
+	if err != nil {
+		return nil, "", err
+	}
+	commit, err := r.CommitObject(*hash)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get commit %v: %w", hash, err)
+	}
+	f, err := commit.File(g.Path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %q at commit %v: %w", g.Path, hash, err)
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %q at commit %v: %w", g.Path, hash, err)
+	}
+	return []byte(content), hash.String(), nil
+}
+
+// resolve resolves the ref into the commit hash, the branches of the
+// bare clone are the remote references.
+func (g *GitSource) resolve(r *git.Repository) (*plumbing.Hash, error) {
+	if g.Ref == "" {
+		ref, err := r.Head()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve HEAD of %q: %w", redactURL(g.URL), err)
+		}
+		h := ref.Hash()
+		return &h, nil
+	}
+	var err error
+	for _, rev := range []string{g.Ref, git.DefaultRemoteName + "/" + g.Ref} {
+		var h *plumbing.Hash
+		h, err = r.ResolveRevision(plumbing.Revision(rev))
+		if err == nil {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to resolve ref %q of %q: %w", g.Ref, redactURL(g.URL), err)
+}
+
+// redactURL removes the password of the URL.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
@@ -17,6 +17,15 @@ const (
 	//  quay.io/skopeo/stable docker.io/username/mirrored-skopeo-stable 1.22
 	TypeMirror ListType = "mirror"
 
+	// TypePair maps the source image to the destination image with tag:
+	//
+	//  [SOURCE_IMAGE] [DEST_IMAGE]
+	//
+	// Example:
+	//  docker.io/library/nginx:1.22 registry.example.io/team-a/nginx:1.22
+	//  quay.io/skopeo/stable:v1.13 registry.example.io/team-b/skopeo:v1.13
+	TypePair ListType = "pair"
+
 	// TypeDefault:
 	//
 	//  [REGISTRY]/[PROJECT]/[NAME]:[TAG]
@@ -24,8 +33,30 @@ const (
 	// Example:
 	//  docker.io/library/nginx:1.22
 	TypeDefault ListType = "default"
+
+	// TypeDockerArchive is the tarball created by 'docker save':
+	//
+	//  docker-archive:[PATH]:[REFERENCE]
+	//
+	// Example:
+	//  docker-archive:./app.tar:docker.io/username/app:v1.0
+	TypeDockerArchive ListType = "docker-archive"
+
+	// TypeChart is the Helm chart pushed into the OCI registry:
+	//
+	//  oci://[REGISTRY]/[PROJECT]/[NAME]:[VERSION]
+	//
+	// Example:
+	//  oci://registry.example.io/charts/rancher:2.9.0
+	TypeChart ListType = "chart"
 )
 
+// dockerArchivePrefix is the transport prefix of the docker-archive line.
+const dockerArchivePrefix = "docker-archive:"
+
+// chartPrefix is the scheme prefix of the Helm chart OCI reference.
+const chartPrefix = "oci://"
+
 func IsMirrorFormat(line string) bool {
 	_, ok := getMirrorSpec(line)
 	return ok
@@ -35,15 +66,73 @@ func GetMirrorSpec(line string) ([]string, bool) {
 	return getMirrorSpec(line)
 }
 
+// GetPairSpec returns the source image and the destination image of the
+// pair line, both images are in the default format.
+func GetPairSpec(line string) (string, string, bool) {
+	spec := strings.Fields(line)
+	if len(spec) != 2 {
+		return "", "", false
+	}
+	if !isDefaultFormat(spec[0]) || !isDefaultFormat(spec[1]) {
+		return "", "", false
+	}
+	return spec[0], spec[1], true
+}
+
 func IsDefaultFormat(line string) bool {
 	return isDefaultFormat(line)
 }
 
+// GetDockerArchiveSpec returns the tarball path and the image reference in
+// the tarball of the docker-archive line.
+func GetDockerArchiveSpec(line string) (string, string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, dockerArchivePrefix) {
+		return "", "", false
+	}
+	path, ref, ok := strings.Cut(strings.TrimPrefix(line, dockerArchivePrefix), ":")
+	if !ok || path == "" || ref == "" || strings.ContainsAny(ref, " @") {
+		return "", "", false
+	}
+	return path, ref, true
+}
+
+// GetChartSpec returns the chart reference without the 'oci://' prefix of
+// the Helm chart line, the chart version is required.
+func GetChartSpec(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, chartPrefix) {
+		return "", false
+	}
+	ref := strings.TrimPrefix(line, chartPrefix)
+	i := strings.LastIndex(ref, ":")
+	if i < 0 || i == len(ref)-1 || strings.Contains(ref[i:], "/") ||
+		!isDefaultFormat(ref) {
+		return "", false
+	}
+	return ref, true
+}
+
 func Detect(line string) ListType {
+	if strings.HasPrefix(strings.TrimSpace(line), chartPrefix) {
+		if _, ok := GetChartSpec(line); ok {
+			return TypeChart
+		}
+		return TypeUnknow
+	}
+	if strings.HasPrefix(strings.TrimSpace(line), dockerArchivePrefix) {
+		if _, _, ok := GetDockerArchiveSpec(line); ok {
+			return TypeDockerArchive
+		}
+		return TypeUnknow
+	}
 	_, ok := getMirrorSpec(line)
 	if ok {
 		return TypeMirror
 	}
+	if _, _, ok := GetPairSpec(line); ok {
+		return TypePair
+	}
 	if isDefaultFormat(line) {
 		return TypeDefault
 	}
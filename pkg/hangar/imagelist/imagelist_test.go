@@ -80,9 +80,24 @@ func Test_Detect(t *testing.T) {
 	if !assert.Equal(imagelist.TypeMirror, imagelist.Detect(" nginx library/mirrored-nginx 1.22  ")) {
 		return
 	}
+	if !assert.Equal(imagelist.TypePair, imagelist.Detect("nginx:1.22 team-a/nginx:1.22")) {
+		return
+	}
 	if !assert.Equal(imagelist.TypeUnknow, imagelist.Detect("docker://docker.io/library/nginx:1.22")) {
 		return
 	}
+	if !assert.Equal(imagelist.TypeDockerArchive, imagelist.Detect("docker-archive:app.tar:app:v1")) {
+		return
+	}
+	if !assert.Equal(imagelist.TypeUnknow, imagelist.Detect("docker-archive:app.tar")) {
+		return
+	}
+	if !assert.Equal(imagelist.TypeChart, imagelist.Detect("oci://example.io/charts/rancher:2.9.0")) {
+		return
+	}
+	if !assert.Equal(imagelist.TypeUnknow, imagelist.Detect("oci://example.io/charts/rancher")) {
+		return
+	}
 }
 
 func Test_GetMirrorSpec(t *testing.T) {
@@ -101,3 +116,46 @@ func Test_GetMirrorSpec(t *testing.T) {
 	assert.Equal("b", spec[1])
 	assert.Equal("c", spec[2])
 }
+
+func Test_GetPairSpec(t *testing.T) {
+	assert := assert.New(t)
+	src, dst, ok := imagelist.GetPairSpec("  docker.io/library/nginx:1.22   example.io/team-a/nginx:1.22 ")
+	assert.True(ok)
+	assert.Equal("docker.io/library/nginx:1.22", src)
+	assert.Equal("example.io/team-a/nginx:1.22", dst)
+	_, _, ok = imagelist.GetPairSpec("nginx")
+	assert.False(ok)
+	_, _, ok = imagelist.GetPairSpec("a b c")
+	assert.False(ok)
+	_, _, ok = imagelist.GetPairSpec("nginx a/b/c/d")
+	assert.False(ok)
+}
+
+func Test_GetChartSpec(t *testing.T) {
+	assert := assert.New(t)
+	ref, ok := imagelist.GetChartSpec(" oci://example.io/charts/rancher:2.9.0 ")
+	assert.True(ok)
+	assert.Equal("example.io/charts/rancher:2.9.0", ref)
+	_, ok = imagelist.GetChartSpec("oci://localhost:5000/charts/rancher")
+	assert.False(ok)
+	_, ok = imagelist.GetChartSpec("oci://example.io/charts/rancher:")
+	assert.False(ok)
+	_, ok = imagelist.GetChartSpec("example.io/charts/rancher:2.9.0")
+	assert.False(ok)
+}
+
+func Test_GetDockerArchiveSpec(t *testing.T) {
+	assert := assert.New(t)
+	path, ref, ok := imagelist.GetDockerArchiveSpec(" docker-archive:./app.tar:docker.io/user/app:v1 ")
+	assert.True(ok)
+	assert.Equal("./app.tar", path)
+	assert.Equal("docker.io/user/app:v1", ref)
+	_, _, ok = imagelist.GetDockerArchiveSpec("docker-archive:./app.tar")
+	assert.False(ok)
+	_, _, ok = imagelist.GetDockerArchiveSpec("docker-archive::app:v1")
+	assert.False(ok)
+	_, _, ok = imagelist.GetDockerArchiveSpec("docker-archive:./app.tar:app@sha256:abc")
+	assert.False(ok)
+	_, _, ok = imagelist.GetDockerArchiveSpec("docker.io/user/app:v1")
+	assert.False(ok)
+}
@@ -5,26 +5,36 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/cnrancher/hangar/pkg/audit"
+	hangarcopy "github.com/cnrancher/hangar/pkg/copy"
 	"github.com/cnrancher/hangar/pkg/destination"
+	"github.com/cnrancher/hangar/pkg/extension"
 	"github.com/cnrancher/hangar/pkg/hangar/archive"
 	"github.com/cnrancher/hangar/pkg/hangar/imagelist"
 	"github.com/cnrancher/hangar/pkg/harbor"
+	"github.com/cnrancher/hangar/pkg/logger"
 	"github.com/cnrancher/hangar/pkg/manifest"
 	"github.com/cnrancher/hangar/pkg/source"
 	"github.com/cnrancher/hangar/pkg/types"
 	"github.com/cnrancher/hangar/pkg/utils"
 	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/transports/alltransports"
+	imagetypes "github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 )
 
 // loadObject is the object sending to worker pool when loading image
 type loadObject struct {
-	image   *archive.Image
+	image *archive.Image
+	// line is the image list line, empty if loading all images
+	line    string
 	timeout time.Duration
 	id      int
 }
@@ -43,6 +53,13 @@ type Loader struct {
 	indexImageSet map[string]*archive.Image
 	// layerManager manages the layers
 	layerManager *layerManager
+	// blobStore streams the layers stored in archive verbatim, nil if
+	// the passthrough is disabled
+	blobStore *hangarcopy.ContentStore
+	// plan is the load plan computed by the warm-up phase
+	plan *LoadPlan
+	// tenants isolates the destination projects, nil if not enabled
+	tenants *tenants
 
 	// Specify the source image registry.
 	SourceRegistry string
@@ -58,6 +75,14 @@ type Loader struct {
 	SharedBlobDirPath string
 	// ArchiveName is the archive file name to be load
 	ArchiveName string
+	// AdjustQuota raises the Harbor project storage quota automatically
+	// if the quota is not enough to load images.
+	AdjustQuota bool
+	// Passthrough streams the layers stored in archive verbatim
+	Passthrough bool
+	// WarmUp checks the existing manifests and blobs in destination
+	// before loading
+	WarmUp bool
 }
 
 type LoaderOpts struct {
@@ -77,6 +102,29 @@ type LoaderOpts struct {
 	SharedBlobDirPath string
 	// ArchiveName is the archive file name to be load
 	ArchiveName string
+	// AdjustQuota raises the Harbor project storage quota automatically
+	// if the quota is not enough to load images.
+	AdjustQuota bool
+	// SkipBlobs is the image layers present on the destination registry
+	// out-of-band and not to be loaded from the archive, the layers
+	// skipped when saving the archive are skipped automatically.
+	SkipBlobs map[digest.Digest]bool
+	// Passthrough streams the layers stored in the archive verbatim to
+	// the destination registry with their original compression and
+	// digests, instead of decompressing them into the cache dir.
+	// The layers compressed by zip are still decompressed.
+	Passthrough bool
+	// WarmUp checks the manifests and blobs already exist in the
+	// destination registry by HEAD requests before loading, to print the
+	// exact load plan and compute the progress by the bytes to upload.
+	WarmUp bool
+	// SkipChecksum skips verifying the archive file by the checksum file
+	// written beside the archive on save.
+	SkipChecksum bool
+	// Tenants is the robot accounts and concurrency of the destination
+	// projects owned by different teams, the quota and permission
+	// failures of a project do not abort the images of other projects.
+	Tenants *ProjectTenants
 }
 
 func NewLoader(o *LoaderOpts) (*Loader, error) {
@@ -86,6 +134,7 @@ func NewLoader(o *LoaderOpts) (*Loader, error) {
 		index:         archive.NewIndex(),
 		indexImageSet: make(map[string]*archive.Image),
 		layerManager:  nil,
+		tenants:       newTenants(o.Tenants),
 
 		SourceRegistry:      o.SourceRegistry,
 		SourceProject:       o.SourceProject,
@@ -94,6 +143,9 @@ func NewLoader(o *LoaderOpts) (*Loader, error) {
 		Directory:           o.Directory,
 		SharedBlobDirPath:   o.SharedBlobDirPath,
 		ArchiveName:         o.ArchiveName,
+		AdjustQuota:         o.AdjustQuota,
+		Passthrough:         o.Passthrough,
+		WarmUp:              o.WarmUp,
 	}
 	if l.SharedBlobDirPath == "" {
 		l.SharedBlobDirPath = archive.SharedBlobDir
@@ -104,6 +156,17 @@ func NewLoader(o *LoaderOpts) (*Loader, error) {
 		return nil, fmt.Errorf("failed to create common: %w", err)
 	}
 
+	if !o.SkipChecksum {
+		// Fail early on the corrupted transfers before pushing images.
+		verified, err := archive.VerifyChecksum(o.ArchiveName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify archive %q: %w", o.ArchiveName, err)
+		}
+		if verified {
+			logrus.Infof("Archive %q verified by checksum file %q",
+				o.ArchiveName, archive.ChecksumName(o.ArchiveName))
+		}
+	}
 	l.ar, err = archive.NewReader(l.ArchiveName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create archive reader: %w", err)
@@ -129,6 +192,21 @@ func NewLoader(o *LoaderOpts) (*Loader, error) {
 		return nil, fmt.Errorf("failed to init layer manager: %w", err)
 	}
 	l.layerManager = lm
+	l.layerManager.skipBlobs = make(map[digest.Digest]bool)
+	for d := range o.SkipBlobs {
+		l.layerManager.skipBlobs[d] = true
+	}
+	for _, d := range l.index.SkippedBlobs {
+		l.layerManager.skipBlobs[d] = true
+	}
+	if len(l.layerManager.skipBlobs) > 0 {
+		logrus.Infof("Skip %d blobs present on the destination out-of-band",
+			len(l.layerManager.skipBlobs))
+	}
+	if l.Passthrough {
+		l.blobStore = hangarcopy.NewBlobStore(l.ArchiveName, l.ar.OpenBlob)
+		l.layerManager.streamed = l.ar.StoredBlob
+	}
 
 	return l, nil
 }
@@ -145,19 +223,16 @@ func (l *Loader) copy(ctx context.Context) {
 				logrus.Warnf("Ignore image list line %q: invalid format", line)
 				continue
 			}
-			registry := utils.GetRegistryName(line)
-			if l.SourceRegistry != "" {
-				registry = l.SourceRegistry
-			}
-			project := utils.GetProjectName(line)
-			if l.SourceProject != "" {
-				project = l.SourceProject
+			if l.skipByBudget(line) {
+				continue
 			}
-			name := utils.GetImageName(line)
-			tag := utils.GetImageTag(line)
-			imageName := fmt.Sprintf("%s/%s/%s:%s",
-				registry, project, name, tag)
+			imageName := l.indexImageName(line)
 			image, ok := l.indexImageSet[imageName]
+			if !ok && l.optional[line] {
+				l.recordSkippedOptional(line,
+					fmt.Errorf("image [%v] not exists in archive", imageName))
+				continue
+			}
 			if !ok {
 				l.recordFailedImage(line)
 				l.handleError(
@@ -173,11 +248,13 @@ func (l *Loader) copy(ctx context.Context) {
 			object := &loadObject{
 				id:    i + 1,
 				image: image,
+				line:  line,
 			}
 			l.handleObject(object)
 		}
 	} else {
 		// Load all images from archive file.
+		l.setTotal(len(l.index.List))
 		for i, image := range l.index.List {
 			object := &loadObject{
 				id:    i + 1,
@@ -193,23 +270,62 @@ func (l *Loader) copy(ctx context.Context) {
 	}
 }
 
+// indexImageName returns the image name in archive index of the
+// image list line.
+func (l *Loader) indexImageName(line string) string {
+	registry := utils.GetRegistryName(line)
+	if l.SourceRegistry != "" {
+		registry = l.SourceRegistry
+	}
+	project := utils.GetProjectName(line)
+	if l.SourceProject != "" {
+		project = l.SourceProject
+	}
+	name := utils.GetImageName(line)
+	tag := utils.GetImageTag(line)
+	return fmt.Sprintf("%s/%s/%s:%s", registry, project, name, tag)
+}
+
 // Run loads images from hangar archive to destination image registry
 func (l *Loader) Run(ctx context.Context) error {
-	if err := l.initHarborProject(ctx); err != nil {
-		return fmt.Errorf("initHarborProject: %w", err)
+	l.initCompatibility(ctx, l.DestinationRegistry)
+	if err := l.initGitLabProjects(
+		ctx, l.DestinationRegistry, l.destinationRepositories()); err != nil {
+		return err
+	}
+	// The registry of the compatibility profile is not Harbor.
+	if l.compat == CompatibilityNone {
+		if err := l.initHarborProject(ctx); err != nil {
+			return fmt.Errorf("initHarborProject: %w", err)
+		}
+	}
+	if l.WarmUp {
+		l.plan = l.warmUp(ctx)
+		l.plan.print()
+		l.status.setWeights(l.plan.images)
 	}
 	l.copy(ctx)
+	if n, size := l.blobStore.Hits(); n > 0 {
+		logrus.Infof("Blobs streamed from archive without decompressing: %d (%s)",
+			n, utils.FormatSize(size))
+	}
 	if len(l.failedImageSet) != 0 {
 		v := make([]string, 0, len(l.failedImageSet))
 		for i := range l.failedImageSet {
 			v = append(v, i)
 		}
 		logrus.Errorf("Copy failed image list: \n%v", strings.Join(v, "\n"))
-		return ErrCopyFailed
+		return l.failedError(ErrCopyFailed)
 	}
 	return nil
 }
 
+// Plan returns the load plan computed by the warm-up phase, returns nil
+// if the warm-up is disabled.
+func (l *Loader) Plan() *LoadPlan {
+	return l.plan
+}
+
 func (l *Loader) initHarborProject(ctx context.Context) error {
 	harborURL, err := harbor.GetRegistryURL(ctx, l.DestinationRegistry,
 		!l.systemContext.OCIInsecureSkipTLSVerify)
@@ -234,27 +350,180 @@ func (l *Loader) initHarborProject(ctx context.Context) error {
 		projectSet[project] = true
 	}
 	for project := range projectSet {
-		exists, err := harbor.ProjectExists(
-			ctx, project, harborURL, &credential,
-			!l.systemContext.OCIInsecureSkipTLSVerify)
-		if err != nil {
+		err := l.initHarborProjectOf(ctx, project, harborURL,
+			l.tenants.credential(project, &credential))
+		if err != nil && !l.tenants.block(project, err) {
 			return err
 		}
-		if exists {
+	}
+	return l.checkHarborQuota(ctx, harborURL, &credential)
+}
+
+// initHarborProjectOf creates the Harbor project if not exists.
+func (l *Loader) initHarborProjectOf(
+	ctx context.Context, project, harborURL string, credential *imagetypes.DockerAuthConfig,
+) error {
+	exists, err := harbor.ProjectExists(
+		ctx, project, harborURL, credential,
+		!l.systemContext.OCIInsecureSkipTLSVerify)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	err = harbor.CreateProject(
+		ctx, project, harborURL, credential,
+		!l.systemContext.OCIInsecureSkipTLSVerify)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Created Harbor V2 project %q for registry %q",
+		project, l.DestinationRegistry)
+	return nil
+}
+
+// checkHarborQuota compares the Harbor project storage quotas with the
+// size of images to be loaded, returns error or raises the quota if the
+// available storage is not enough.
+func (l *Loader) checkHarborQuota(
+	ctx context.Context, harborURL string, credential *imagetypes.DockerAuthConfig,
+) error {
+	for project, size := range l.projectBlobSizes() {
+		if l.tenants.blockedErr(project) != nil {
 			continue
 		}
-		err = harbor.CreateProject(
-			ctx, project, harborURL, &credential,
-			!l.systemContext.OCIInsecureSkipTLSVerify)
-		if err != nil {
+		err := l.checkHarborProjectQuota(ctx, project, size, harborURL,
+			l.tenants.credential(project, credential))
+		if err != nil && !l.tenants.block(project, err) {
 			return err
 		}
-		logrus.Infof("Created Harbor V2 project %q for registry %q",
-			project, l.DestinationRegistry)
 	}
 	return nil
 }
 
+// checkHarborProjectQuota checks the storage quota of the Harbor project.
+func (l *Loader) checkHarborProjectQuota(
+	ctx context.Context, project string, size int64,
+	harborURL string, credential *imagetypes.DockerAuthConfig,
+) error {
+	tlsVerify := !l.systemContext.OCIInsecureSkipTLSVerify
+	quota, err := harbor.GetProjectQuota(ctx, project, harborURL, credential, tlsVerify)
+	if err != nil {
+		return err
+	}
+	if quota.Unlimited() || size <= quota.Available() {
+		logrus.Debugf("Harbor project %q quota is enough: require %s, available %s",
+			project, formatSize(size), formatSize(quota.Available()))
+		return nil
+	}
+	if !l.AdjustQuota {
+		return fmt.Errorf("storage quota of Harbor project %q is not enough: "+
+			"require %s, available %s (used %s of %s), "+
+			"raise the project quota or use '--adjust-quota' to raise it automatically",
+			project, formatSize(size), formatSize(quota.Available()),
+			formatSize(quota.Used), formatSize(quota.Hard))
+	}
+	hard := quota.Hard
+	quota.Hard = quota.Used + size
+	if err := harbor.UpdateProjectQuota(ctx, quota, harborURL, credential, tlsVerify); err != nil {
+		return err
+	}
+	logrus.Infof("Raised storage quota of Harbor project %q from %s to %s",
+		project, formatSize(hard), formatSize(quota.Hard))
+	return nil
+}
+
+// loadImages returns the images of the archive to be loaded.
+func (l *Loader) loadImages() []*archive.Image {
+	if len(l.common.images) == 0 {
+		return l.index.List
+	}
+	var images []*archive.Image
+	for _, line := range l.common.images {
+		if imagelist.Detect(line) != imagelist.TypeDefault {
+			continue
+		}
+		if image, ok := l.indexImageSet[l.indexImageName(line)]; ok {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// destinationRepository returns the project and name of the destination
+// repository of the image.
+func (l *Loader) destinationRepository(registry, image string) (string, string, error) {
+	project := utils.GetProjectName(image)
+	if l.DestinationProject != "" {
+		project = l.DestinationProject
+	}
+	project, name, err := l.nameNormalizer.Normalize(
+		registry, project, utils.GetImageName(image))
+	if err != nil {
+		return "", "", err
+	}
+	return l.compatProject(project), name, nil
+}
+
+// destinationRepositories returns the destination repositories of the
+// images to be loaded.
+func (l *Loader) destinationRepositories() []string {
+	var repositories []string
+	for _, image := range l.loadImages() {
+		project, name, err := l.destinationRepository(l.DestinationRegistry, image.Source)
+		if err != nil {
+			// The error is handled when loading the image.
+			continue
+		}
+		repositories = append(repositories, project+"/"+name)
+	}
+	return repositories
+}
+
+// projectBlobSizes returns the total size of the unique blobs to be
+// loaded into each destination project.
+func (l *Loader) projectBlobSizes() map[string]int64 {
+	images := l.loadImages()
+	blobSizes := l.ar.BlobSizes()
+	projectBlobs := map[string]map[digest.Digest]bool{}
+	for _, image := range images {
+		project := utils.GetProjectName(image.Source)
+		if l.DestinationProject != "" {
+			project = l.DestinationProject
+		}
+		if projectBlobs[project] == nil {
+			projectBlobs[project] = map[digest.Digest]bool{}
+		}
+		for i := range image.Images {
+			spec := &image.Images[i]
+			if len(l.imageSpecSet["os"]) != 0 && !l.imageSpecSet["os"][spec.OS] {
+				continue
+			}
+			if len(l.imageSpecSet["arch"]) != 0 && !l.imageSpecSet["arch"][spec.Arch] {
+				continue
+			}
+			for _, blob := range l.layerManager.getImageLayers(spec) {
+				projectBlobs[project][blob] = true
+			}
+		}
+	}
+	sizes := make(map[string]int64, len(projectBlobs))
+	for project, blobs := range projectBlobs {
+		for blob := range blobs {
+			sizes[project] += blobSizes[blob]
+		}
+	}
+	return sizes
+}
+
+func formatSize(size int64) string {
+	if size < 0 {
+		return "unlimited"
+	}
+	return utils.FormatSize(size)
+}
+
 func (l *Loader) worker(ctx context.Context, o any) {
 	if o == nil {
 		return
@@ -264,7 +533,11 @@ func (l *Loader) worker(ctx context.Context, o any) {
 		logrus.Errorf("skip object type(%T), data %v", o, o)
 		return
 	}
-
+	imageName := obj.image.Source + ":" + obj.image.Tag
+	destinationRegistry := utils.GetRegistryName(imageName)
+	if l.DestinationRegistry != "" {
+		destinationRegistry = l.DestinationRegistry
+	}
 	var (
 		copyContext context.Context
 		cancel      context.CancelFunc
@@ -275,7 +548,6 @@ func (l *Loader) worker(ctx context.Context, o any) {
 	} else {
 		copyContext, cancel = context.WithCancel(ctx)
 	}
-	imageName := obj.image.Source + ":" + obj.image.Tag
 	// Use defer to handle error message.
 	defer func() {
 		if err != nil {
@@ -284,129 +556,106 @@ func (l *Loader) worker(ctx context.Context, o any) {
 		}
 		cancel()
 	}()
+	record, err := l.waitBreaker(ctx, destinationRegistry)
+	if err != nil {
+		return
+	}
+	defer record(&err)
+	timer := newImageTimer(imageName)
+	defer l.timings.record(timer)
 
 	// Init destination image spec.
-	destinationRegistry := utils.GetRegistryName(imageName)
-	if l.DestinationRegistry != "" {
-		destinationRegistry = l.DestinationRegistry
+	destinationProject, destinationName, err := l.destinationRepository(
+		destinationRegistry, imageName)
+	if err != nil {
+		return
 	}
-	destinationProject := utils.GetProjectName(imageName)
-	if l.DestinationProject != "" {
-		destinationProject = l.DestinationProject
+	if blockedErr := l.tenants.blockedErr(destinationProject); blockedErr != nil {
+		l.recordBlockedImage(obj.id, imageName, blockedErr)
+		return
+	}
+	release, err := l.tenants.acquire(copyContext, destinationProject)
+	if err != nil {
+		return
 	}
+	defer release()
+	defer func() {
+		// Stop loading the remaining images of the project after its
+		// storage quota exceeded.
+		if isQuotaExceeded(err) {
+			l.tenants.block(destinationProject, err)
+		}
+	}()
 	dest, err := destination.NewDestination(&destination.Option{
-		Type:          types.TypeDocker,
-		Registry:      destinationRegistry,
-		Project:       destinationProject,
-		Name:          utils.GetImageName(imageName),
-		Tag:           obj.image.Tag,
-		SystemContext: l.systemContext,
+		Type:             types.TypeDocker,
+		Registry:         destinationRegistry,
+		Project:          destinationProject,
+		Name:             destinationName,
+		Tag:              obj.image.Tag,
+		SystemContext:    l.tenants.systemContext(l.systemContext, destinationProject),
+		Proxy:            l.destinationProxy,
+		VariantRules:     l.variantRules,
+		RewriteRules:     l.rewriteRules,
+		SourceRepository: sourceRepository(imageName),
 	})
 	if err != nil {
 		err = fmt.Errorf("failed to create destination image: %w", err)
 		return
 	}
+	timer.begin(PhaseInspect)
 	if err = dest.Init(copyContext); err != nil {
 		err = fmt.Errorf("failed to init destination image: %w", err)
 		return
 	}
+	if err = l.bootstrapRepository(copyContext, dest); err != nil {
+		return
+	}
 
 	var manifestImages = make(manifest.Images, 0)
-	logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+	logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 		Infof("Loading [%v] => [%v]",
 			imageName, dest.ReferenceNameWithoutTransport())
+	// Errors of the platforms failed to load when keep-going enabled.
+	var platformErrs []error
+	loaded := &archive.Image{
+		Source: obj.image.Source,
+		Tag:    obj.image.Tag,
+	}
+	defer func() {
+		l.recordCopiedImage(imageName, loaded)
+	}()
 	for _, img := range obj.image.Images {
-		if img.Digest == "" {
-			logrus.WithFields(logrus.Fields{"IMG": obj.id}).
-				Warnf("Skip invalid image [%v] [%v] [%v]",
-					imageName, img.Arch, img.OS)
-			continue
-		}
-
-		var (
-			tmpDir string
-			imgRef string
-		)
-		imgRef = dest.ReferenceNameDigest(img.Digest)
-		l.arMutex.Lock()
-		tmpDir, err = l.ar.DecompressImageTmp(&img, l.common.imageSpecSet)
-		l.arMutex.Unlock()
-		// Register defer function to clean-up cache.
-		defer func(d string, img archive.ImageSpec) {
-			if d != "" {
-				os.RemoveAll(d)
-			}
-			l.layerManager.clean(&img)
-		}(tmpDir, img)
-
+		var mi *manifest.Image
+		mi, err = l.loadPlatform(ctx, copyContext, obj, dest, img, timer)
 		if err != nil {
-			if !errors.Is(err, utils.ErrNoAvailableImage) {
-				err = fmt.Errorf("failed to decompress image [%v]: %w", imgRef, err)
+			if !l.keepGoing {
 				return
 			}
-			refName := fmt.Sprintf("%s@%s", obj.image.Source, img.Digest)
-			if img.OSVersion != "" {
-				logrus.WithFields(logrus.Fields{"IMG": obj.id}).
-					Infof("Skip [%s] [%s%s] [%s] [%s]",
-						refName, img.Arch, img.Variant, img.OS, img.OSVersion)
-			} else {
-				logrus.WithFields(logrus.Fields{"IMG": obj.id}).
-					Infof("Skip [%s] [%s%s] [%s]",
-						refName, img.Arch, img.Variant, img.OS)
-			}
+			logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+				Warnf("Continue loading other platforms of [%v]: %v", imageName, err)
+			platformErrs = append(platformErrs, err)
 			err = nil
 			continue
 		}
-
-		l.arMutex.Lock()
-		err = l.layerManager.decompressLayer(&img, l.ar)
-		l.arMutex.Unlock()
-		if err != nil {
-			err = fmt.Errorf("arch [%v] os [%v]: %w", img.Arch, img.OS, err)
-			return
+		if mi != nil {
+			manifestImages = append(manifestImages, mi)
+			loaded.Images = append(loaded.Images, img)
 		}
-
-		var src *source.Source
-		src, err = source.NewSource(&source.Option{
-			Type:      types.TypeOci,
-			Directory: tmpDir,
-			SystemContext: utils.SystemContextWithSharedBlobDir(
-				l.systemContext, l.layerManager.sharedBlobDir()),
-		})
-		if err != nil {
-			err = fmt.Errorf("failed to create source image: %w", err)
-			return
-		}
-		if err = src.Init(copyContext); err != nil {
-			err = fmt.Errorf("failed to init [%v]: %w",
-				src.ReferenceName(), err)
-			return
-		}
-		err = src.Copy(copyContext, dest, l.common.imageSpecSet, l.policy)
-		if err != nil {
-			if errors.Is(err, utils.ErrNoAvailableImage) {
-				logrus.WithFields(logrus.Fields{"IMG": obj.id}).
-					Warnf("Skip saving image [%v]: %v", imageName, err)
-				err = nil
-			} else {
-				err = fmt.Errorf("failed to copy [%v] to [%v]: %w",
-					src.ReferenceName(), dest.ReferenceName(), err)
-				return
-			}
+	}
+	defer func() {
+		// The signatures and attestations are loaded after the images.
+		if err == nil && len(obj.image.Artifacts) > 0 {
+			err = l.loadArtifacts(ctx, copyContext, obj, dest, loaded)
 		}
-
-		var mi *manifest.Image
-		mi, err = manifest.NewImageByInspect(
-			copyContext, dest.ReferenceNameDigest(img.Digest), dest.SystemContext(),
-		)
-		if err != nil {
-			err = fmt.Errorf("failed to create manifest image: %w", err)
-			return
+	}()
+	timer.begin(PhasePush)
+	defer func() {
+		// Report the platforms failed to load after pushing manifest of
+		// the loaded platforms.
+		if err == nil && len(platformErrs) > 0 {
+			err = errors.Join(platformErrs...)
 		}
-		mi.UpdatePlatform(
-			img.Arch, img.Variant, img.OS, img.OSVersion, img.OSFeatures)
-		manifestImages = append(manifestImages, mi)
-	}
+	}()
 
 	destManifestImages := dest.ManifestImages()
 	if len(destManifestImages) > 0 {
@@ -419,6 +668,10 @@ func (l *Loader) worker(ctx context.Context, o any) {
 				break
 			}
 		}
+		if skipBuildManifest && l.indexAnnotationsChanged(dest.Annotations()) {
+			// Re-create the manifest index to update the index annotations.
+			skipBuildManifest = false
+		}
 		if skipBuildManifest {
 			logrus.Debugf("skip build manifest for image [%v]: already exists",
 				dest.ReferenceName())
@@ -430,6 +683,9 @@ func (l *Loader) worker(ctx context.Context, o any) {
 	builder, err := manifest.NewBuilder(&manifest.BuilderOpts{
 		ReferenceName: dest.ReferenceName(),
 		SystemContext: dest.SystemContext(),
+		Annotations:   l.withIndexAnnotations(nil),
+
+		FallbackSchema2List: l.compat.fallbackSchema2List(),
 	})
 	if err != nil {
 		err = fmt.Errorf("failed to create manifest builder: %w", err)
@@ -444,15 +700,252 @@ func (l *Loader) worker(ctx context.Context, o any) {
 		builder.Add(img)
 	}
 	if builder.Images() == 0 {
+		if len(platformErrs) == 0 && l.optional[obj.line] {
+			l.recordSkippedOptional(obj.line, utils.ErrNoAvailableImage)
+			return
+		}
 		err = fmt.Errorf("failed to load [%v]: some images failed to load", imageName)
 		return
 	}
-	if err = builder.Push(ctx); err != nil {
+	err = builder.Push(ctx)
+	recordAudit(ctx, audit.ActionPush, imageName,
+		dest.ReferenceNameWithoutTransport(),
+		manifestDigests(manifestImages), err)
+	if err != nil {
 		err = fmt.Errorf("failed to push manifest: %w", err)
 		return
 	}
 }
 
+// loadPlatform loads the platform image from archive to the destination
+// registry, returns nil manifest image if the platform image is skipped.
+func (l *Loader) loadPlatform(
+	ctx, copyContext context.Context,
+	obj *loadObject,
+	dest *destination.Destination,
+	img archive.ImageSpec,
+	timer *imageTimer,
+) (mi *manifest.Image, err error) {
+	imageName := obj.image.Source + ":" + obj.image.Tag
+	if img.Digest == "" {
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+			Warnf("Skip invalid image [%v] [%v] [%v]",
+				imageName, img.Arch, img.OS)
+		return nil, nil
+	}
+
+	var (
+		tmpDir string
+		imgRef string
+	)
+	imgRef = dest.ReferenceNameDigest(img.Digest)
+	set := l.common.imageSpecSet
+	if manifest.IsAttestation(img.Annotations) {
+		// The attestation manifest (unknown/unknown platform) is not
+		// filtered by the platform, the attestations of the subject images
+		// not loaded are removed when building the manifest index.
+		set = nil
+	}
+	timer.begin(PhasePull)
+	l.arMutex.Lock()
+	tmpDir, err = l.ar.DecompressImageTmp(&img, set)
+	l.arMutex.Unlock()
+	// Register defer function to clean-up cache.
+	defer func(d string, img archive.ImageSpec) {
+		if d != "" {
+			os.RemoveAll(d)
+		}
+		l.layerManager.clean(&img)
+	}(tmpDir, img)
+
+	if err != nil {
+		if !errors.Is(err, utils.ErrNoAvailableImage) {
+			err = fmt.Errorf("failed to decompress image [%v]: %w", imgRef, err)
+			return
+		}
+		refName := fmt.Sprintf("%s@%s", obj.image.Source, img.Digest)
+		if img.OSVersion != "" {
+			logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+				Infof("Skip [%s] [%s%s] [%s] [%s]",
+					refName, img.Arch, img.Variant, img.OS, img.OSVersion)
+		} else {
+			logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+				Infof("Skip [%s] [%s%s] [%s]",
+					refName, img.Arch, img.Variant, img.OS)
+		}
+		return nil, nil
+	}
+
+	l.arMutex.Lock()
+	err = l.layerManager.decompressLayer(&img, l.ar)
+	l.arMutex.Unlock()
+	if err != nil {
+		err = fmt.Errorf("arch [%v] os [%v]: %w", img.Arch, img.OS, err)
+		return
+	}
+
+	var src *source.Source
+	src, err = source.NewSource(&source.Option{
+		Type:      types.TypeOci,
+		Directory: tmpDir,
+		SystemContext: utils.SystemContextWithSharedBlobDir(
+			l.systemContext, l.layerManager.sharedBlobDir()),
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to create source image: %w", err)
+		return
+	}
+	// The layers not decompressed are read from the archive directly.
+	src.SetContentStore(l.blobStore)
+	src.SetMemoryLimiter(l.memoryLimiter)
+	src.SetPlatformConcurrency(l.platformConcurrency)
+	src.SetAllowDigestChange(l.allowDigestChange)
+	if err = src.Init(copyContext); err != nil {
+		err = fmt.Errorf("failed to init [%v]: %w",
+			src.ReferenceName(), err)
+		return
+	}
+	timer.begin(PhasePush)
+	err = src.Copy(copyContext, dest, set, l.policy)
+	if err != nil {
+		if errors.Is(err, utils.ErrNoAvailableImage) {
+			logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+				Warnf("Skip saving image [%v]: %v", imageName, err)
+			err = nil
+		} else {
+			err = fmt.Errorf("failed to copy [%v] to [%v]: %w",
+				src.ReferenceName(), dest.ReferenceName(), err)
+			return
+		}
+	}
+
+	destDigest := img.Digest
+	l.recordDigestDrifts(ctx, obj.id, dest.ReferenceNameWithoutTransport(), src.DriftedDigests())
+	if d, ok := src.DriftedDigests()[img.Digest]; ok {
+		destDigest = d
+		img.SourceDigest = img.Digest
+		img.Digest = d
+	}
+	mi, err = manifest.NewImageByInspect(
+		copyContext, dest.ReferenceNameDigest(destDigest), dest.SystemContext(),
+	)
+	if err != nil {
+		err = fmt.Errorf("failed to create manifest image: %w", err)
+		return
+	}
+	mi.UpdatePlatform(
+		img.Arch, img.Variant, img.OS, img.OSVersion, img.OSFeatures)
+	mi.Annotations = sourceDigestAnnotations(img)
+	return mi, nil
+}
+
+// loadArtifacts loads the signatures and attestations of the loaded
+// images, the OCI referrers are added into the referrers tag schema index
+// of the subject image if the destination registry does not support the
+// referrers API.
+func (l *Loader) loadArtifacts(
+	ctx, copyContext context.Context,
+	obj *loadObject,
+	dest *destination.Destination,
+	loaded *archive.Image,
+) error {
+	subjects := map[digest.Digest]bool{}
+	for _, img := range loaded.Images {
+		// The artifacts of the images rewritten by the destination
+		// registry are no longer valid.
+		if img.SourceDigest == "" {
+			subjects[img.Digest] = true
+		}
+	}
+	var (
+		num  int
+		errs []error
+	)
+	for _, a := range obj.image.Artifacts {
+		if !subjects[a.Subject] {
+			logrus.Debugf("skip loading artifact %v: subject %v not loaded",
+				a.Digest, a.Subject)
+			continue
+		}
+		if err := l.loadArtifact(copyContext, dest, a); err != nil {
+			errs = append(errs, fmt.Errorf("failed to load artifact %v of %v: %w",
+				a.Digest, a.Subject, err))
+			continue
+		}
+		num++
+	}
+	if num > 0 {
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+			Infof("Loaded %d signatures & attestations of [%v]",
+				num, dest.ReferenceNameWithoutTransport())
+	}
+	return errors.Join(errs...)
+}
+
+// loadArtifact copies the artifact from archive to the destination
+// repository without mutation to keep its digest.
+func (l *Loader) loadArtifact(
+	ctx context.Context, dest *destination.Destination, a archive.Artifact,
+) error {
+	l.arMutex.Lock()
+	tmpDir, err := l.ar.DecompressImageTmp(&a.ImageSpec, nil)
+	l.arMutex.Unlock()
+	defer func() {
+		if tmpDir != "" {
+			os.RemoveAll(tmpDir)
+		}
+		l.layerManager.clean(&a.ImageSpec)
+	}()
+	if err != nil {
+		return fmt.Errorf("failed to decompress artifact: %w", err)
+	}
+	l.arMutex.Lock()
+	err = l.layerManager.decompressLayer(&a.ImageSpec, l.ar)
+	l.arMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	src, err := source.NewSource(&source.Option{
+		Type:      types.TypeOci,
+		Directory: tmpDir,
+		SystemContext: utils.SystemContextWithSharedBlobDir(
+			l.systemContext, l.layerManager.sharedBlobDir()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create source image: %w", err)
+	}
+	src.SetContentStore(l.blobStore)
+	src.SetMemoryLimiter(l.memoryLimiter)
+	src.SetPlatformConcurrency(l.platformConcurrency)
+	if err = src.Init(ctx); err != nil {
+		return fmt.Errorf("failed to init [%v]: %w", src.ReferenceName(), err)
+	}
+	var destRef imagetypes.ImageReference
+	if a.Tag != "" {
+		destRef, err = dest.ReferenceTag(a.Tag)
+	} else {
+		destRef, err = alltransports.ParseImageName(dest.ReferenceNameDigest(a.Digest))
+	}
+	if err != nil {
+		return err
+	}
+	if err = src.CopyArtifact(ctx, destRef, dest.SystemContext(), l.policy); err != nil {
+		return err
+	}
+	if a.Tag != "" {
+		return nil
+	}
+	return extension.For(ctx, dest.SystemContext(), dest.Registry()).AddReferrer(
+		ctx, path.Join(dest.Project(), dest.Name()), a.Subject, imgspecv1.Descriptor{
+			MediaType:    a.MediaType,
+			Digest:       a.Digest,
+			Size:         a.Size,
+			ArtifactType: a.ArtifactType,
+			Annotations:  a.Annotations,
+		})
+}
+
 func (l *Loader) Validate(ctx context.Context) error {
 	l.validate(ctx)
 	if len(l.failedImageSet) != 0 {
@@ -461,30 +954,34 @@ func (l *Loader) Validate(ctx context.Context) error {
 			v = append(v, i)
 		}
 		logrus.Errorf("Validate failed image list: \n%v", strings.Join(v, "\n"))
-		return ErrValidateFailed
+		return l.failedError(ErrValidateFailed)
 	}
 	return nil
 }
 
+// DetectChanges compares the destination registry with the archive images
+// without loading images, returns the images need to be loaded.
+func (l *Loader) DetectChanges(ctx context.Context) ([]Change, error) {
+	l.detectChanges = true
+	if err := l.Validate(ctx); err != nil {
+		return nil, err
+	}
+	return l.Changes(), nil
+}
+
 func (l *Loader) validate(ctx context.Context) {
 	l.common.initErrorHandler(ctx)
 	l.common.initWorker(ctx, l.validateWorker)
 	if len(l.common.images) > 0 {
 		// Validate images according to image list specified by user.
 		for i, line := range l.common.images {
-			registry := utils.GetRegistryName(line)
-			if l.SourceRegistry != "" {
-				registry = l.SourceRegistry
-			}
-			project := utils.GetProjectName(line)
-			if l.SourceProject != "" {
-				project = l.SourceProject
-			}
-			name := utils.GetImageName(line)
-			tag := utils.GetImageTag(line)
-			imageName := fmt.Sprintf("%s/%s/%s:%s",
-				registry, project, name, tag)
+			imageName := l.indexImageName(line)
 			image, ok := l.indexImageSet[imageName]
+			if !ok && l.optional[line] {
+				l.recordSkippedOptional(line,
+					fmt.Errorf("image [%v] not exists in archive", imageName))
+				continue
+			}
 			if !ok {
 				l.recordFailedImage(line)
 				l.handleError(
@@ -505,6 +1002,7 @@ func (l *Loader) validate(ctx context.Context) {
 		}
 	} else {
 		// Validate all images from archive file.
+		l.setTotal(len(l.index.List))
 		for i, image := range l.index.List {
 			object := &loadObject{
 				id:    i + 1,
@@ -541,10 +1039,14 @@ func (l *Loader) validateWorker(ctx context.Context, o any) {
 		validateContext, cancel = context.WithCancel(ctx)
 	}
 	imageName := obj.image.Source + ":" + obj.image.Tag
+	destName := ""
 	// Use defer to handle error message.
 	defer func() {
 		cancel()
 		if err != nil {
+			if l.recordChange(err, imageName, destName) {
+				return
+			}
 			l.handleError(NewError(obj.id, err, nil, nil))
 			l.recordFailedImage(imageName)
 		}
@@ -574,17 +1076,22 @@ func (l *Loader) validateWorker(ctx context.Context, o any) {
 	if l.DestinationRegistry != "" {
 		destinationRegistry = l.DestinationRegistry
 	}
-	destinationProject := utils.GetProjectName(imageName)
-	if l.DestinationProject != "" {
-		destinationProject = l.DestinationProject
+	destinationProject, destinationName, err := l.destinationRepository(
+		destinationRegistry, imageName)
+	if err != nil {
+		return
 	}
 	dest, err := destination.NewDestination(&destination.Option{
-		Type:          types.TypeDocker,
-		Registry:      destinationRegistry,
-		Project:       destinationProject,
-		Name:          utils.GetImageName(imageName),
-		Tag:           obj.image.Tag,
-		SystemContext: l.systemContext,
+		Type:             types.TypeDocker,
+		Registry:         destinationRegistry,
+		Project:          destinationProject,
+		Name:             destinationName,
+		Tag:              obj.image.Tag,
+		SystemContext:    l.tenants.systemContext(l.systemContext, destinationProject),
+		Proxy:            l.destinationProxy,
+		VariantRules:     l.variantRules,
+		RewriteRules:     l.rewriteRules,
+		SourceRepository: sourceRepository(imageName),
 	})
 	if err != nil {
 		err = fmt.Errorf("failed to create destination image: %w", err)
@@ -594,28 +1101,32 @@ func (l *Loader) validateWorker(ctx context.Context, o any) {
 		err = fmt.Errorf("failed to init destination image: %w", err)
 		return
 	}
+	destName = dest.ReferenceNameWithoutTransport()
 	if !dest.Exists() {
-		logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 			Errorf("Image [%v] does not exists in destination registry server",
 				dest.ReferenceNameWithoutTransport())
-		err = fmt.Errorf("FAILED: [%v]", imageName)
+		err = newMismatchError(ChangeMissing, "FAILED: [%v]", imageName)
 		return
 	}
-	destImage := dest.ImageBySet(l.imageSpecSet)
-	destDigestSet := map[digest.Digest]bool{}
-	for _, img := range destImage.Images {
-		destDigestSet[img.Digest] = true
-	}
+	destDigestSet := destinationDigests(dest.ImageBySet(l.imageSpecSet).Images)
 	for d := range sourceDigestSet {
 		if !destDigestSet[d] {
-			logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+			logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 				Errorf("Image [%v] digest [%v] does not exists in destination registry",
 					dest.ReferenceNameWithoutTransport(), d)
-			err = fmt.Errorf("FAILED: [%v]", imageName)
+			err = newMismatchError(ChangeOutdated, "FAILED: [%v]", imageName)
 			return
 		}
 	}
 
-	logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+	if err = l.deepVerify(validateContext, dest); err != nil {
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+			Errorf("Deep verify failed: %v", err)
+		err = newMismatchError(ChangeCorrupted, "FAILED: [%v]", imageName)
+		return
+	}
+
+	logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 		Infof("PASS: [%v]", imageName)
 }
@@ -0,0 +1,149 @@
+package hangar
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/cnrancher/hangar/pkg/statedb"
+	"github.com/opencontainers/go-digest"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	ErrLockMismatch = errors.New("source image digest does not match the lock file")
+)
+
+// Lock is the job input manifest (lock file) capturing the resolved source
+// image digests, the tool version and the options used by the job to
+// reproduce the bundle.
+type Lock struct {
+	Version       int    `json:"version"`
+	HangarVersion string `json:"hangarVersion"`
+	Command       string `json:"command"`
+	// Flags is the command line flags (including the source registry
+	// rewrite rules) used by the job, map[flag]value.
+	Flags map[string]string `json:"flags,omitempty"`
+	// ImageList is the git repository and the commit of the image list
+	// hosted in git.
+	ImageList *ImageListSource `json:"imageList,omitempty"`
+	// Images is the resolved source images in sorted order.
+	Images []LockImage `json:"images"`
+
+	path   string
+	digest map[string]digest.Digest
+	mutex  *sync.Mutex
+}
+
+// LockImage is the resolved source image of the lock file.
+type LockImage struct {
+	// Image is the source image reference name without transport.
+	Image  string        `json:"image"`
+	Digest digest.Digest `json:"digest"`
+}
+
+// ImageListSource is the image list hosted in git repository and the
+// commit of the image list fetched by the job.
+type ImageListSource struct {
+	// Source is the 'git+URL//PATH@REF' of the image list.
+	Source string `json:"source"`
+	Commit string `json:"commit"`
+}
+
+const lockVersion = 1
+
+// NewLock creates the lock file of the job, the lock is written into the
+// file path by Save.
+func NewLock(path, hangarVersion, command string, flags map[string]string) *Lock {
+	return &Lock{
+		Version:       lockVersion,
+		HangarVersion: hangarVersion,
+		Command:       command,
+		Flags:         flags,
+		path:          path,
+		digest:        make(map[string]digest.Digest),
+		mutex:         &sync.Mutex{},
+	}
+}
+
+// LoadLock reads the lock file.
+func LoadLock(path string) (*Lock, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file %q: %w", path, err)
+	}
+	l := &Lock{
+		path:   path,
+		digest: make(map[string]digest.Digest),
+		mutex:  &sync.Mutex{},
+	}
+	if err := yaml.Unmarshal(b, l); err != nil {
+		return nil, fmt.Errorf("failed to decode lock file %q: %w", path, err)
+	}
+	if l.Version != lockVersion {
+		return nil, fmt.Errorf("unsupported lock file version %d", l.Version)
+	}
+	for _, i := range l.Images {
+		if err := i.Digest.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid digest of [%v] in lock file: %w", i.Image, err)
+		}
+		l.digest[i.Image] = i.Digest
+	}
+	return l, nil
+}
+
+// ImageList returns the source images of the lock file.
+func (l *Lock) ImageList() []string {
+	images := make([]string, 0, len(l.Images))
+	for _, i := range l.Images {
+		images = append(images, i.Image)
+	}
+	return images
+}
+
+// Verify checks the digest of the image matches with the lock file,
+// the image not in the lock file is ignored.
+func (l *Lock) Verify(image string, dgst digest.Digest) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	d, ok := l.digest[image]
+	if !ok || d == dgst {
+		return nil
+	}
+	return fmt.Errorf("%w: [%v] locked %v, got %v", ErrLockMismatch, image, d, dgst)
+}
+
+// Record records the resolved digest of the source image.
+func (l *Lock) Record(image string, dgst digest.Digest) {
+	l.mutex.Lock()
+	l.digest[image] = dgst
+	l.mutex.Unlock()
+}
+
+// Save writes the lock into the lock file.
+func (l *Lock) Save() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.Images = make([]LockImage, 0, len(l.digest))
+	for image, d := range l.digest {
+		l.Images = append(l.Images, LockImage{
+			Image:  image,
+			Digest: d,
+		})
+	}
+	sort.Slice(l.Images, func(i, j int) bool {
+		return l.Images[i].Image < l.Images[j].Image
+	})
+	b, err := yaml.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("failed to encode lock file: %w", err)
+	}
+	if err := statedb.WriteFile(l.path, b); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return nil
+}
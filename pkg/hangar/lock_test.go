@@ -0,0 +1,39 @@
+package hangar
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Lock(t *testing.T) {
+	var (
+		d1 = digest.FromString("nginx")
+		d2 = digest.FromString("redis")
+	)
+	path := filepath.Join(t.TempDir(), "hangar.lock.yaml")
+	l := NewLock(path, "v1.0.0", "hangar save", map[string]string{
+		"arch":   "amd64,arm64",
+		"source": "registry.example.io",
+	})
+	l.Record("docker.io/library/redis:7", d2)
+	l.Record("docker.io/library/nginx:1.25", d1)
+	assert.Nil(t, l.Save())
+
+	loaded, err := LoadLock(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.0.0", loaded.HangarVersion)
+	assert.Equal(t, "amd64,arm64", loaded.Flags["arch"])
+	assert.Equal(t, []string{
+		"docker.io/library/nginx:1.25",
+		"docker.io/library/redis:7",
+	}, loaded.ImageList())
+	assert.Nil(t, loaded.Verify("docker.io/library/nginx:1.25", d1))
+	assert.Nil(t, loaded.Verify("docker.io/library/busybox:latest", d1))
+	assert.ErrorIs(t, loaded.Verify("docker.io/library/redis:7", d1), ErrLockMismatch)
+
+	_, err = LoadLock(filepath.Join(t.TempDir(), "not-exists.yaml"))
+	assert.NotNil(t, err)
+}
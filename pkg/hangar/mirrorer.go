@@ -4,11 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/cnrancher/hangar/pkg/airgap"
+	"github.com/cnrancher/hangar/pkg/audit"
+	"github.com/cnrancher/hangar/pkg/copy"
 	"github.com/cnrancher/hangar/pkg/destination"
 	"github.com/cnrancher/hangar/pkg/hangar/imagelist"
+	"github.com/cnrancher/hangar/pkg/logger"
 	"github.com/cnrancher/hangar/pkg/manifest"
 	"github.com/cnrancher/hangar/pkg/source"
 	"github.com/cnrancher/hangar/pkg/types"
@@ -25,6 +31,11 @@ type mirrorObject struct {
 	destination *destination.Destination
 	timeout     time.Duration
 	id          int
+	// mapping is the source repository referenced by the image list and
+	// the repository pushed into the destination registry
+	mapping airgap.Mapping
+	// chart is true if the object is the Helm chart OCI reference
+	chart bool
 }
 
 // Mirrorer mirrors multipule images between image registries.
@@ -39,6 +50,27 @@ type Mirrorer struct {
 	SourceProject string
 	// Override the project of the copied destination image
 	DestinationProject string
+	// ConfigMutation is the transformations applied to the image config
+	// during copy.
+	ConfigMutation *copy.ConfigMutation
+	// MissingPlatformsOnly only copies the platforms not exists in the
+	// destination manifest list and patches the destination manifest list.
+	MissingPlatformsOnly bool
+	// PlatformFallback is the mode to handle the images missing the
+	// requested platforms.
+	PlatformFallback PlatformFallback
+	// CopyCosign copies the cosign tag-based signature, attestation and
+	// SBOM artifacts (sha256-<digest>.sig) of the copied images.
+	CopyCosign bool
+	// Provenance writes the source digest & run ID annotations into the
+	// destination manifest index, and skips the images whose annotated
+	// source digest matches on subsequent runs.
+	Provenance bool
+
+	platformGaps *platformGaps
+	// mappings is the repositories mirrored successfully
+	mappings      map[airgap.Mapping]bool
+	mappingsMutex *sync.Mutex
 }
 
 type MirrorerOpts struct {
@@ -48,6 +80,18 @@ type MirrorerOpts struct {
 	DestinationRegistry string
 	SourceProject       string
 	DestinationProject  string
+	ConfigMutation      *copy.ConfigMutation
+	// MissingPlatformsOnly only copies the platforms not exists in the
+	// destination manifest list.
+	MissingPlatformsOnly bool
+	// PlatformFallback is the mode to handle the images missing the
+	// requested platforms, the missing platforms are not checked if empty.
+	PlatformFallback PlatformFallback
+	// CopyCosign copies the cosign tag-based artifacts of the copied images.
+	CopyCosign bool
+	// Provenance writes and checks the source digest annotations of the
+	// destination manifest index.
+	Provenance bool
 }
 
 func NewMirrorer(o *MirrorerOpts) (*Mirrorer, error) {
@@ -56,6 +100,16 @@ func NewMirrorer(o *MirrorerOpts) (*Mirrorer, error) {
 		DestinationRegistry: o.DestinationRegistry,
 		SourceProject:       o.SourceProject,
 		DestinationProject:  o.DestinationProject,
+		ConfigMutation:      o.ConfigMutation,
+
+		MissingPlatformsOnly: o.MissingPlatformsOnly,
+		PlatformFallback:     o.PlatformFallback,
+		CopyCosign:           o.CopyCosign,
+		Provenance:           o.Provenance,
+
+		platformGaps:  &platformGaps{},
+		mappings:      make(map[airgap.Mapping]bool),
+		mappingsMutex: &sync.Mutex{},
 	}
 	var err error
 	m.common, err = newCommon(&o.CommonOpts)
@@ -69,24 +123,18 @@ func (m *Mirrorer) copy(ctx context.Context) {
 	m.common.initErrorHandler(ctx)
 	m.common.initWorker(ctx, m.worker)
 	for i, line := range m.common.images {
-		var (
-			object *mirrorObject
-			err    error
-		)
-		switch imagelist.Detect(line) {
-		case imagelist.TypeDefault:
-			object, err = m.mirrorObjectImageListTypeDefault(line)
-		case imagelist.TypeMirror:
-			object, err = m.mirrorObjectImageListTypeMirror(line)
-		default:
-			logrus.Warnf("Ignore image list line %q: invalid format", line)
+		if m.skipByBudget(line) {
 			continue
 		}
+		object, err := m.newMirrorObject(line)
 		if err != nil {
 			m.common.recordFailedImage(line)
 			m.handleError(err)
 			continue
 		}
+		if object == nil {
+			continue
+		}
 		object.id = i + 1
 		m.handleObject(object)
 	}
@@ -95,6 +143,11 @@ func (m *Mirrorer) copy(ctx context.Context) {
 
 // Run mirror images from source to destination registry.
 func (m *Mirrorer) Run(ctx context.Context) error {
+	m.initCompatibility(ctx, m.DestinationRegistry)
+	if err := m.initGitLabProjects(
+		ctx, m.DestinationRegistry, m.destinationRepositories()); err != nil {
+		return err
+	}
 	m.copy(ctx)
 	if len(m.failedImageSet) != 0 {
 		v := make([]string, 0, len(m.failedImageSet))
@@ -102,11 +155,30 @@ func (m *Mirrorer) Run(ctx context.Context) error {
 			v = append(v, i)
 		}
 		logrus.Errorf("Copy failed image list: \n%v", strings.Join(v, "\n"))
-		return ErrCopyFailed
+		return m.failedError(ErrCopyFailed)
 	}
 	return nil
 }
 
+// newMirrorObject creates the mirror object of the image list line by the
+// format of the line, returns nil if the line is in invalid format.
+func (m *Mirrorer) newMirrorObject(line string) (*mirrorObject, error) {
+	switch imagelist.Detect(line) {
+	case imagelist.TypeDefault:
+		return m.mirrorObjectImageListTypeDefault(line)
+	case imagelist.TypeMirror:
+		return m.mirrorObjectImageListTypeMirror(line)
+	case imagelist.TypePair:
+		return m.mirrorObjectImageListTypePair(line)
+	case imagelist.TypeDockerArchive:
+		return m.mirrorObjectImageListTypeDockerArchive(line)
+	case imagelist.TypeChart:
+		return m.mirrorObjectImageListTypeChart(line)
+	}
+	logrus.Warnf("Ignore image list line %q: invalid format", line)
+	return nil, nil
+}
+
 func (m *Mirrorer) mirrorObjectImageListTypeDefault(line string) (*mirrorObject, error) {
 	object := &mirrorObject{
 		image: line,
@@ -131,22 +203,28 @@ func (m *Mirrorer) mirrorObjectImageListTypeDefault(line string) (*mirrorObject,
 		return nil, fmt.Errorf("failed to init source image: %v", err)
 	}
 	object.source = src
-	destProject := utils.GetProjectName(line)
-	if m.DestinationProject != "" {
-		destProject = m.DestinationProject
+	m.configureSource(src)
+	destProject, destName, err := m.destinationRepository(line)
+	if err != nil {
+		return nil, err
 	}
 	dest, err := destination.NewDestination(&destination.Option{
-		Type:          types.TypeDocker,
-		Registry:      m.DestinationRegistry,
-		Project:       destProject,
-		Name:          utils.GetImageName(line),
-		Tag:           utils.GetImageTag(line),
-		SystemContext: m.systemContext,
+		Type:             types.TypeDocker,
+		Registry:         m.DestinationRegistry,
+		Project:          destProject,
+		Name:             destName,
+		Tag:              utils.GetImageTag(line),
+		SystemContext:    m.systemContext,
+		Proxy:            m.destinationProxy,
+		VariantRules:     m.variantRules,
+		RewriteRules:     m.rewriteRules,
+		SourceRepository: sourceRepository(line),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to init dest image: %v", err)
 	}
 	object.destination = dest
+	object.mapping = newMapping(line, dest)
 	return object, nil
 }
 
@@ -179,25 +257,222 @@ func (m *Mirrorer) mirrorObjectImageListTypeMirror(line string) (*mirrorObject,
 		return nil, fmt.Errorf("failed to init source image: %v", err)
 	}
 	object.source = src
-	destProject := utils.GetProjectName(spec[1])
-	if m.DestinationProject != "" {
-		destProject = m.DestinationProject
+	m.configureSource(src)
+	destProject, destName, err := m.destinationRepository(spec[1])
+	if err != nil {
+		return nil, err
 	}
 	dest, err := destination.NewDestination(&destination.Option{
+		Type:             types.TypeDocker,
+		Registry:         m.DestinationRegistry,
+		Project:          destProject,
+		Name:             destName,
+		Tag:              spec[2],
+		SystemContext:    m.systemContext,
+		Proxy:            m.destinationProxy,
+		VariantRules:     m.variantRules,
+		RewriteRules:     m.rewriteRules,
+		SourceRepository: sourceRepository(spec[0]),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to init dest image: %v", err)
+	}
+	object.destination = dest
+	object.mapping = newMapping(spec[0], dest)
+	return object, nil
+}
+
+// mirrorObjectImageListTypePair creates the mirror object of the pair line,
+// the tags of the source and destination images can be different.
+func (m *Mirrorer) mirrorObjectImageListTypePair(line string) (*mirrorObject, error) {
+	object := &mirrorObject{
+		image: line,
+	}
+
+	srcImage, destImage, ok := imagelist.GetPairSpec(line)
+	if !ok {
+		return nil, fmt.Errorf("ignore line %q in image list: invalid format", line)
+	}
+	sourceRegistry := utils.GetRegistryName(srcImage)
+	if m.SourceRegistry != "" {
+		sourceRegistry = m.SourceRegistry
+	}
+	sourceProject := utils.GetProjectName(srcImage)
+	if m.SourceProject != "" {
+		sourceProject = m.SourceProject
+	}
+	src, err := source.NewSource(&source.Option{
 		Type:          types.TypeDocker,
-		Registry:      m.DestinationRegistry,
-		Project:       destProject,
-		Name:          utils.GetImageName(spec[1]),
-		Tag:           spec[2],
+		Registry:      sourceRegistry,
+		Project:       sourceProject,
+		Name:          utils.GetImageName(srcImage),
+		Tag:           utils.GetImageTag(srcImage),
 		SystemContext: m.systemContext,
 	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to init source image: %v", err)
+	}
+	object.source = src
+	m.configureSource(src)
+	destProject, destName, err := m.destinationRepository(destImage)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := destination.NewDestination(&destination.Option{
+		Type:             types.TypeDocker,
+		Registry:         m.DestinationRegistry,
+		Project:          destProject,
+		Name:             destName,
+		Tag:              utils.GetImageTag(destImage),
+		SystemContext:    m.systemContext,
+		Proxy:            m.destinationProxy,
+		VariantRules:     m.variantRules,
+		RewriteRules:     m.rewriteRules,
+		SourceRepository: sourceRepository(srcImage),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to init dest image: %v", err)
 	}
 	object.destination = dest
+	object.mapping = newMapping(srcImage, dest)
 	return object, nil
 }
 
+func (m *Mirrorer) mirrorObjectImageListTypeDockerArchive(line string) (*mirrorObject, error) {
+	object := &mirrorObject{
+		image: line,
+	}
+	src, ref, err := newDockerArchiveSource(line, m.systemContext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init source image: %v", err)
+	}
+	object.source = src
+	m.configureSource(src)
+	destProject, destName, err := m.destinationRepository(ref)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := destination.NewDestination(&destination.Option{
+		Type:             types.TypeDocker,
+		Registry:         m.DestinationRegistry,
+		Project:          destProject,
+		Name:             destName,
+		Tag:              utils.GetImageTag(ref),
+		SystemContext:    m.systemContext,
+		Proxy:            m.destinationProxy,
+		VariantRules:     m.variantRules,
+		RewriteRules:     m.rewriteRules,
+		SourceRepository: sourceRepository(ref),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to init dest image: %v", err)
+	}
+	object.destination = dest
+	object.mapping = newMapping(ref, dest)
+	return object, nil
+}
+
+// mirrorObjectImageListTypeChart creates the mirror object of the Helm
+// chart OCI reference, the chart is copied by the artifact copy path.
+func (m *Mirrorer) mirrorObjectImageListTypeChart(line string) (*mirrorObject, error) {
+	ref, ok := imagelist.GetChartSpec(line)
+	if !ok {
+		return nil, fmt.Errorf("ignore line %q in image list: invalid format", line)
+	}
+	object, err := m.mirrorObjectImageListTypeDefault(ref)
+	if err != nil {
+		return nil, err
+	}
+	object.image = line
+	object.chart = true
+	return object, nil
+}
+
+// configureSource applies the mirror options to the source image, the
+// source of every image list type is configured by it.
+func (m *Mirrorer) configureSource(src *source.Source) {
+	m.common.configureSource(src)
+	src.SetConfigMutation(m.ConfigMutation)
+	src.SetMissingPlatformsOnly(m.MissingPlatformsOnly)
+}
+
+// destinationRepository returns the project and name of the destination
+// repository of the image.
+func (m *Mirrorer) destinationRepository(image string) (string, string, error) {
+	project := utils.GetProjectName(image)
+	if m.DestinationProject != "" {
+		project = m.DestinationProject
+	}
+	project, name, err := m.nameNormalizer.Normalize(
+		m.DestinationRegistry, project, utils.GetImageName(image))
+	if err != nil {
+		return "", "", err
+	}
+	return m.compatProject(project), name, nil
+}
+
+// destinationRepositories returns the destination repositories of the
+// image list.
+func (m *Mirrorer) destinationRepositories() []string {
+	var repositories []string
+	for _, line := range m.common.images {
+		image := line
+		switch imagelist.Detect(line) {
+		case imagelist.TypeDefault:
+		case imagelist.TypeMirror:
+			spec, _ := imagelist.GetMirrorSpec(line)
+			if len(spec) != 3 {
+				continue
+			}
+			image = spec[1]
+		case imagelist.TypePair:
+			_, image, _ = imagelist.GetPairSpec(line)
+		case imagelist.TypeDockerArchive:
+			_, image, _ = imagelist.GetDockerArchiveSpec(line)
+		case imagelist.TypeChart:
+			image, _ = imagelist.GetChartSpec(line)
+		default:
+			continue
+		}
+		project, name, err := m.destinationRepository(image)
+		if err != nil {
+			// The error is handled when copying the image.
+			continue
+		}
+		repositories = append(repositories, project+"/"+name)
+	}
+	return repositories
+}
+
+// newMapping returns the mapping of the source image in image list and the
+// destination repository.
+func newMapping(image string, dest *destination.Destination) airgap.Mapping {
+	return airgap.Mapping{
+		SourceRegistry: utils.GetRegistryName(image),
+		SourceRepository: utils.GetProjectName(image) + "/" +
+			utils.GetImageName(image),
+		DestinationRepository: dest.Project() + "/" + dest.Name(),
+	}
+}
+
+// Mappings returns the repositories mirrored successfully in sorted order,
+// should be called after the job finished.
+func (m *Mirrorer) Mappings() []airgap.Mapping {
+	m.mappingsMutex.Lock()
+	defer m.mappingsMutex.Unlock()
+	mappings := make([]airgap.Mapping, 0, len(m.mappings))
+	for mapping := range m.mappings {
+		mappings = append(mappings, mapping)
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		if mappings[i].SourceRegistry != mappings[j].SourceRegistry {
+			return mappings[i].SourceRegistry < mappings[j].SourceRegistry
+		}
+		return mappings[i].SourceRepository < mappings[j].SourceRepository
+	})
+	return mappings
+}
+
 func (m *Mirrorer) worker(ctx context.Context, o any) {
 	if o == nil {
 		return
@@ -212,6 +487,10 @@ func (m *Mirrorer) worker(ctx context.Context, o any) {
 		copyContext context.Context
 		cancel      context.CancelFunc
 		err         error
+		// copied is true if the destination is up to date with the source
+		copied   bool
+		stateKey = obj.source.ReferenceNameWithoutTransport() + " => " +
+			obj.destination.ReferenceNameWithoutTransport()
 	)
 	if obj.timeout > 0 {
 		copyContext, cancel = context.WithTimeout(ctx, obj.timeout)
@@ -221,46 +500,127 @@ func (m *Mirrorer) worker(ctx context.Context, o any) {
 	defer func() {
 		cancel()
 		if err != nil {
+			if m.skipOptional(obj.image, err) {
+				return
+			}
 			m.handleError(fmt.Errorf("error occurred when copy [%v] to [%v]: %w",
 				obj.source.ReferenceNameWithoutTransport(),
 				obj.destination.ReferenceNameWithoutTransport(), err))
 			m.common.recordFailedImage(obj.source.ReferenceNameWithoutTransport())
+			return
+		}
+		m.mappingsMutex.Lock()
+		m.mappings[obj.mapping] = true
+		m.mappingsMutex.Unlock()
+		if copied {
+			m.recordState(stateKey, obj.source.Digest())
 		}
 	}()
+	record, err := m.waitBreaker(ctx, obj.source.Registry(), obj.destination.Registry())
+	if err != nil {
+		return
+	}
+	defer record(&err)
+	timer := newImageTimer(obj.source.ReferenceNameWithoutTransport())
+	defer m.timings.record(timer)
 
+	timer.begin(PhaseInspect)
 	err = obj.source.Init(copyContext)
 	if err != nil {
 		err = fmt.Errorf("failed to init [%v]: %w",
 			obj.source.ReferenceName(), err)
 		return
 	}
+	if err = m.verifySource(obj.source); err != nil {
+		return
+	}
+	if m.skipUnchanged(stateKey, obj.source.Digest()) {
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+			Infof("Skip copying [%v]: source digest [%v] not changed since last run",
+				obj.source.ReferenceNameWithoutTransport(), obj.source.Digest())
+		return
+	}
 	err = obj.destination.Init(copyContext)
 	if err != nil {
 		err = fmt.Errorf("failed to init [%v]: %w",
 			obj.destination.ReferenceName(), err)
 		return
 	}
+	if err = m.bootstrapRepository(copyContext, obj.destination); err != nil {
+		return
+	}
+	if obj.chart {
+		logrus.WithFields(logrus.Fields{
+			"IMG": obj.id,
+		}).Infof("Copying chart [%v] => [%v]",
+			obj.source.ReferenceNameWithoutTransport(),
+			obj.destination.ReferenceNameWithoutTransport())
+		timer.begin(PhaseCopy)
+		err = obj.source.CopyChart(copyContext, obj.destination, m.policy)
+		recordAudit(ctx, audit.ActionPush,
+			obj.source.ReferenceNameWithoutTransport(),
+			obj.destination.ReferenceNameWithoutTransport(),
+			[]string{obj.source.Digest().String()}, err)
+		copied = err == nil
+		return
+	}
+	m.checkPlatformGap(copyContext, obj)
+	if m.Provenance && m.provenanceMatched(obj) {
+		copied = true
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+			Infof("Skip copying [%v]: mirrored from the same source digest by run %v",
+				obj.source.ReferenceNameWithoutTransport(),
+				obj.destination.Annotations()[manifest.AnnotationRunID])
+		return
+	}
 	logrus.WithFields(logrus.Fields{
 		"IMG": obj.id,
 	}).Infof("Copying [%v] => [%v]",
 		obj.source.ReferenceNameWithoutTransport(),
 		obj.destination.ReferenceNameWithoutTransport())
+	timer.begin(PhaseCopy)
 	err = obj.source.Copy(copyContext, obj.destination, m.imageSpecSet, m.policy)
 	if err != nil {
 		if errors.Is(err, utils.ErrNoAvailableImage) {
-			logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+			logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 				Warnf("Skip copy image [%v]: %v",
 					obj.source.ReferenceNameWithoutTransport(), err)
+			m.skipOptional(obj.image, err)
 			err = nil
 		} else {
 			return
 		}
+	} else {
+		copied = true
 	}
 
+	m.recordExcludedAttestations(obj.source.ExcludedAttestations())
+	m.recordDeprecated(obj.source.ReferenceNameWithoutTransport(), obj.source.DeprecatedMediaTypes())
+	for s, d := range obj.source.MutatedDigests() {
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+			Infof("Mutated image config [%v@%v] => [%v]",
+				obj.source.ReferenceNameWithoutTransport(), s, d)
+	}
+	m.recordDigestDrifts(ctx, obj.id, obj.destination.ReferenceNameWithoutTransport(),
+		obj.source.DriftedDigests())
 	copiedImage := obj.source.GetCopiedImage()
+	m.recordCopiedImage(obj.source.ReferenceNameWithoutTransport(), copiedImage)
 	if len(copiedImage.Images) == 0 {
 		return
 	}
+	if m.CopyCosign {
+		var num int
+		num, err = obj.source.CopyCosignArtifacts(copyContext, obj.destination, m.policy)
+		if err != nil {
+			return
+		}
+		if num > 0 {
+			logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+				Infof("Copied %d cosign artifacts of [%v]",
+					num, obj.source.ReferenceNameWithoutTransport())
+		}
+	}
+	timer.begin(PhasePush)
 	var manifestImages = make(manifest.Images, 0)
 	for _, image := range copiedImage.Images {
 		var mi *manifest.Image
@@ -275,6 +635,7 @@ func (m *Mirrorer) worker(ctx context.Context, o any) {
 		}
 		mi.UpdatePlatform(
 			image.Arch, image.Variant, image.OS, image.OSVersion, image.OSFeatures)
+		mi.Annotations = sourceDigestAnnotations(image)
 		manifestImages = append(manifestImages, mi)
 	}
 	destManifestImages := obj.destination.ManifestImages()
@@ -288,6 +649,16 @@ func (m *Mirrorer) worker(ctx context.Context, o any) {
 				break
 			}
 		}
+		if skipBuildManifest && m.Provenance &&
+			obj.destination.Annotations()[manifest.AnnotationSourceDigest] !=
+				obj.source.Digest().String() {
+			// Re-create the manifest index to update the provenance.
+			skipBuildManifest = false
+		}
+		if skipBuildManifest && m.indexAnnotationsChanged(obj.destination.Annotations()) {
+			// Re-create the manifest index to update the index annotations.
+			skipBuildManifest = false
+		}
 		if skipBuildManifest {
 			logrus.Debugf("skip build manifest for image [%v]: already exists",
 				obj.destination.ReferenceName())
@@ -295,9 +666,20 @@ func (m *Mirrorer) worker(ctx context.Context, o any) {
 		}
 	}
 
+	var annotations map[string]string
+	if m.Provenance {
+		annotations = map[string]string{
+			manifest.AnnotationSource:       obj.source.ReferenceNameWithoutTransport(),
+			manifest.AnnotationSourceDigest: obj.source.Digest().String(),
+			manifest.AnnotationRunID:        m.runID,
+		}
+	}
 	builder, err := manifest.NewBuilder(&manifest.BuilderOpts{
 		ReferenceName: obj.destination.ReferenceName(),
 		SystemContext: obj.destination.SystemContext(),
+		Annotations:   m.withIndexAnnotations(annotations),
+
+		FallbackSchema2List: m.compat.fallbackSchema2List(),
 	})
 	if err != nil {
 		err = fmt.Errorf("failed to create mafiest builder: %w", err)
@@ -315,7 +697,12 @@ func (m *Mirrorer) worker(ctx context.Context, o any) {
 	if builder.Images() == 0 {
 		return
 	}
-	if err = builder.Push(ctx); err != nil {
+	err = builder.Push(ctx)
+	recordAudit(ctx, audit.ActionPush,
+		obj.source.ReferenceNameWithoutTransport(),
+		obj.destination.ReferenceNameWithoutTransport(),
+		manifestDigests(manifestImages), err)
+	if err != nil {
 		err = fmt.Errorf("failed to push manifest: %w", err)
 		return
 	}
@@ -329,33 +716,58 @@ func (m *Mirrorer) Validate(ctx context.Context) error {
 			v = append(v, i)
 		}
 		logrus.Errorf("Copy failed image list: \n%v", strings.Join(v, "\n"))
-		return ErrCopyFailed
+		return m.failedError(ErrCopyFailed)
 	}
 	return nil
 }
 
+// DetectChanges compares the destination registry with the image list
+// without copying images, returns the images need to be mirrored.
+func (m *Mirrorer) DetectChanges(ctx context.Context) ([]Change, error) {
+	m.detectChanges = true
+	if err := m.Validate(ctx); err != nil {
+		return nil, err
+	}
+	return m.Changes(), nil
+}
+
+// DryRun resolves the source manifests of the image list and the platform
+// images would be mirrored without copying images.
+func (m *Mirrorer) DryRun(ctx context.Context) (*Plan, error) {
+	return m.dryRun(ctx, func() {
+		for i, line := range m.common.images {
+			object, err := m.newMirrorObject(line)
+			if err != nil {
+				m.common.recordFailedImage(line)
+				m.handleError(err)
+				continue
+			}
+			if object == nil {
+				continue
+			}
+			m.handleObject(&planObject{
+				id:          i + 1,
+				image:       line,
+				source:      object.source,
+				destination: object.destination.ReferenceNameWithoutTransport(),
+			})
+		}
+	})
+}
+
 func (m *Mirrorer) validate(ctx context.Context) {
 	m.common.initErrorHandler(ctx)
 	m.initWorker(ctx, m.validateWorker)
 	for i, line := range m.common.images {
-		var (
-			object *mirrorObject
-			err    error
-		)
-		switch imagelist.Detect(line) {
-		case imagelist.TypeDefault:
-			object, err = m.mirrorObjectImageListTypeDefault(line)
-		case imagelist.TypeMirror:
-			object, err = m.mirrorObjectImageListTypeMirror(line)
-		default:
-			logrus.Warnf("Ignore image list line %q: invalid format", line)
-			continue
-		}
+		object, err := m.newMirrorObject(line)
 		if err != nil {
 			m.common.recordFailedImage(line)
 			m.handleError(err)
 			continue
 		}
+		if object == nil {
+			continue
+		}
 		object.id = i + 1
 		m.handleObject(object)
 	}
@@ -385,12 +797,21 @@ func (m *Mirrorer) validateWorker(ctx context.Context, o any) {
 	defer func() {
 		cancel()
 		if err != nil {
+			if m.skipOptional(obj.image, err) {
+				return
+			}
+			if m.recordChange(err,
+				obj.source.ReferenceNameWithoutTransport(),
+				obj.destination.ReferenceNameWithoutTransport()) {
+				return
+			}
 			m.handleError(NewError(obj.id, err, obj.source, obj.destination))
 			m.common.recordFailedImage(obj.source.ReferenceNameWithoutTransport())
 		}
 	}()
 	err = obj.source.Init(validateContext)
 	if err != nil {
+		m.suggestSource(validateContext, obj.source.ReferenceNameWithoutTransport(), obj.source, err)
 		return
 	}
 	err = obj.destination.Init(validateContext)
@@ -398,33 +819,54 @@ func (m *Mirrorer) validateWorker(ctx context.Context, o any) {
 		return
 	}
 	if !obj.destination.Exists() {
-		logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 			Errorf("[%v] does not exists",
 				obj.destination.ReferenceNameWithoutTransport())
-		err = fmt.Errorf("FAILED: [%v] != [%v]",
+		err = newMismatchError(ChangeMissing, "FAILED: [%v] != [%v]",
 			obj.source.ReferenceNameWithoutTransport(),
 			obj.destination.ReferenceNameWithoutTransport())
 		return
 	}
 
-	switch obj.source.MIME() {
-	case imagemanifest.DockerV2Schema1MediaType,
-		imagemanifest.DockerV2Schema1SignedMediaType:
+	switch {
+	case obj.chart:
+		var d digest.Digest
+		if d, err = chartDigest(validateContext, obj.destination); err != nil {
+			return
+		}
+		if d != obj.source.Digest() {
+			logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+				Errorf("Chart [%v] does not exists in destination registry",
+					obj.destination.ReferenceNameDigest(obj.source.Digest()))
+			err = newMismatchError(ChangeOutdated, "FAILED: [%v] != [%v]",
+				obj.source.ReferenceNameWithoutTransport(),
+				obj.destination.ReferenceNameWithoutTransport())
+			return
+		}
+	case obj.source.Type() == types.TypeDockerArhive,
+		obj.source.MIME() == imagemanifest.DockerV2Schema1MediaType,
+		obj.source.MIME() == imagemanifest.DockerV2Schema1SignedMediaType:
 		// Could not compare image digest since the destination mediaType
-		// was changed during copy.
+		// was changed during copy, or the layers of the docker-archive
+		// tarball were compressed.
 	default:
 		destImages := obj.destination.ImageBySet(m.imageSpecSet)
-		destDigestSet := map[digest.Digest]bool{}
+		destDigestSet := destinationDigests(destImages.Images)
+		destPlatformSet := map[string]bool{}
 		for _, img := range destImages.Images {
-			destDigestSet[img.Digest] = true
+			destPlatformSet[m.variantRules.Platform(img.OS, img.Arch, img.Variant)] = true
 		}
 		sourceImages := obj.source.ImageBySet(m.imageSpecSet)
 		for _, img := range sourceImages.Images {
+			if m.MissingPlatformsOnly && img.Arch != "" &&
+				destPlatformSet[m.variantRules.Platform(img.OS, img.Arch, img.Variant)] {
+				continue
+			}
 			if !destDigestSet[img.Digest] {
-				logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+				logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 					Errorf("Image [%v] does not exists in destination registry",
 						obj.destination.ReferenceNameDigest(img.Digest))
-				err = fmt.Errorf("FAILED: [%v] != [%v]",
+				err = newMismatchError(ChangeOutdated, "FAILED: [%v] != [%v]",
 					obj.source.ReferenceNameWithoutTransport(),
 					obj.destination.ReferenceNameWithoutTransport())
 				return
@@ -432,8 +874,69 @@ func (m *Mirrorer) validateWorker(ctx context.Context, o any) {
 		}
 	}
 
-	logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+	if err = m.deepVerify(validateContext, obj.destination); err != nil {
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+			Errorf("Deep verify failed: %v", err)
+		err = newMismatchError(ChangeCorrupted, "FAILED: [%v] != [%v]",
+			obj.source.ReferenceNameWithoutTransport(),
+			obj.destination.ReferenceNameWithoutTransport())
+		return
+	}
+
+	logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 		Infof("PASS: [%v] == [%v]",
 			obj.source.ReferenceNameWithoutTransport(),
 			obj.destination.ReferenceNameWithoutTransport())
 }
+
+// chartDigest returns the manifest digest of the destination chart.
+func chartDigest(ctx context.Context, dest *destination.Destination) (digest.Digest, error) {
+	b, _, err := dest.InspectRAW(ctx)
+	if err != nil {
+		return "", err
+	}
+	return manifest.Digest(b, digest.Canonical)
+}
+
+// provenanceMatched checks whether the destination manifest index was
+// pushed from the same source manifest digest and contains all the
+// platforms to be copied.
+func (m *Mirrorer) provenanceMatched(obj *mirrorObject) bool {
+	annotations := obj.destination.Annotations()
+	if annotations[manifest.AnnotationSourceDigest] == "" ||
+		annotations[manifest.AnnotationSourceDigest] != obj.source.Digest().String() {
+		return false
+	}
+	if m.indexAnnotationsChanged(annotations) {
+		return false
+	}
+	srcImage := obj.source.ImageBySet(m.imageSpecSet)
+	destImage := obj.destination.ImageBySet(m.imageSpecSet)
+	if len(srcImage.Images) == 0 {
+		return false
+	}
+	platforms := map[string]bool{}
+	for _, i := range destImage.Images {
+		platforms[m.variantRules.Platform(i.OS, i.Arch, i.Variant)] = true
+	}
+	for _, i := range srcImage.Images {
+		if i.Arch == "" && i.OS == "" {
+			// Platform is not recorded for the single manifest image,
+			// compare the arch & os list instead.
+			continue
+		}
+		if !platforms[m.variantRules.Platform(i.OS, i.Arch, i.Variant)] {
+			return false
+		}
+	}
+	archSet := map[string]bool{}
+	for _, a := range destImage.ArchList {
+		archSet[a] = true
+	}
+	for _, a := range srcImage.ArchList {
+		if !archSet[a] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package hangar
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/containers/image/v5/signature"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Mirrorer_DryRun(t *testing.T) {
+	m, err := NewMirrorer(&MirrorerOpts{
+		CommonOpts: CommonOpts{
+			Images: []string{
+				"nginx:1.25",
+				"quay.io/skopeo/stable reg.io/team-b/mirrored-skopeo v1.13",
+				"docker.io/library/busybox:1.36 reg.io/team-a/busybox:1.36",
+				"invalid line format foo bar",
+				"rancher/rancher:v2.8.0",
+			},
+			Workers: 2,
+			Policy: &signature.Policy{
+				Default: signature.PolicyRequirements{signature.NewPRInsecureAcceptAnything()},
+			},
+		},
+		DestinationRegistry: "reg.io",
+	})
+	assert.Nil(t, err)
+	m.resolvePlan = func(_ context.Context, obj *planObject) ([]PlannedImage, error) {
+		src := obj.source.Registry() + "/" + obj.source.Project() + "/" +
+			obj.source.Name() + ":" + obj.source.Tag()
+		if obj.source.Name() == "rancher" {
+			return nil, errors.New("manifest unknown")
+		}
+		return []PlannedImage{{
+			Source:      src,
+			Destination: obj.destination,
+			Platform:    "linux/amd64",
+			Size:        100,
+		}}, nil
+	}
+
+	plan, err := m.DryRun(context.TODO())
+	assert.ErrorIs(t, err, ErrValidateFailed)
+	assert.Equal(t, []PlannedImage{
+		{
+			Source:      "docker.io/library/busybox:1.36",
+			Destination: "reg.io/team-a/busybox:1.36",
+			Platform:    "linux/amd64",
+			Size:        100,
+		},
+		{
+			Source:      "docker.io/library/nginx:1.25",
+			Destination: "reg.io/library/nginx:1.25",
+			Platform:    "linux/amd64",
+			Size:        100,
+		},
+		{
+			Source:      "quay.io/skopeo/stable:v1.13",
+			Destination: "reg.io/team-b/mirrored-skopeo:v1.13",
+			Platform:    "linux/amd64",
+			Size:        100,
+		},
+	}, plan.Images)
+	assert.Equal(t, int64(300), plan.Total)
+	assert.Equal(t, map[string]bool{"rancher/rancher:v2.8.0": true}, m.failedImageSet)
+}
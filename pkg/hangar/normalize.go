@@ -0,0 +1,158 @@
+package hangar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNameConflict = errors.New("normalized repository name conflicts")
+)
+
+// NameNormalizer normalizes the destination repository names for the
+// registries rejecting mixed-case or deep repository paths, the normalized
+// names are recorded in the mapping file to apply the same normalization
+// consistently on future runs and validation.
+type NameNormalizer struct {
+	Version int `json:"version"`
+	// Repositories is the mapping of the repositories,
+	// map["REGISTRY/ORIGINAL/PATH"]"NORMALIZED/PATH".
+	Repositories map[string]string `json:"repositories"`
+
+	lowercase bool
+	maxDepth  int
+	path      string
+	mutex     *sync.Mutex
+}
+
+// NameNormalizerOpts is the options of the NameNormalizer.
+type NameNormalizerOpts struct {
+	// Lowercase converts the repository path to lowercase.
+	Lowercase bool
+	// MaxDepth limits the path depth of the repository (at least 2),
+	// the exceeded path components are replaced by hash.
+	MaxDepth int
+	// MappingFile is the file to record the repository name mapping.
+	MappingFile string
+}
+
+const nameMappingVersion = 1
+
+// NewNameNormalizer creates the NameNormalizer and loads the mapping file,
+// an empty mapping is created if the mapping file does not exist.
+func NewNameNormalizer(o *NameNormalizerOpts) (*NameNormalizer, error) {
+	if o.MaxDepth != 0 && o.MaxDepth < 2 {
+		return nil, fmt.Errorf("invalid max path depth %d: should be at least 2", o.MaxDepth)
+	}
+	n := &NameNormalizer{
+		Version:      nameMappingVersion,
+		Repositories: make(map[string]string),
+		lowercase:    o.Lowercase,
+		maxDepth:     o.MaxDepth,
+		path:         o.MappingFile,
+		mutex:        &sync.Mutex{},
+	}
+	if n.path == "" {
+		return n, nil
+	}
+	b, err := os.ReadFile(n.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return n, nil
+		}
+		return nil, fmt.Errorf("failed to read name mapping %q: %w", n.path, err)
+	}
+	if err := json.Unmarshal(b, n); err != nil {
+		return nil, fmt.Errorf("failed to decode name mapping %q: %w", n.path, err)
+	}
+	if n.Repositories == nil {
+		n.Repositories = make(map[string]string)
+	}
+	return n, nil
+}
+
+// Normalize returns the normalized project and name of the destination
+// repository. The recorded mapping is used if the repository was
+// normalized before.
+func (n *NameNormalizer) Normalize(registry, project, name string) (string, string, error) {
+	if n == nil {
+		return project, name, nil
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	original := project + "/" + name
+	key := registry + "/" + original
+	normalized, ok := n.Repositories[key]
+	if !ok {
+		normalized = n.normalize(original)
+		if normalized == original {
+			return project, name, nil
+		}
+		for k, v := range n.Repositories {
+			if v == normalized && strings.HasPrefix(k, registry+"/") {
+				return "", "", fmt.Errorf("%w: [%v] and [%v] are both normalized to [%v]",
+					ErrNameConflict, strings.TrimPrefix(k, registry+"/"), original, normalized)
+			}
+		}
+		logrus.Infof("Normalize repository [%v/%v] => [%v/%v]",
+			registry, original, registry, normalized)
+		n.Repositories[key] = normalized
+	}
+	i := strings.LastIndex(normalized, "/")
+	if i < 0 {
+		return "", "", fmt.Errorf("invalid normalized repository %q", normalized)
+	}
+	return normalized[:i], normalized[i+1:], nil
+}
+
+func (n *NameNormalizer) normalize(repository string) string {
+	if n.lowercase {
+		repository = strings.ToLower(repository)
+	}
+	components := strings.Split(repository, "/")
+	if n.maxDepth == 0 || len(components) <= n.maxDepth {
+		return repository
+	}
+	// Keep the first (maxDepth-1) components and the base name,
+	// replace the remainder by the hash to avoid conflicts.
+	keep := components[:n.maxDepth-1]
+	remainder := components[n.maxDepth-1 : len(components)-1]
+	sum := sha256.Sum256([]byte(strings.Join(remainder, "/")))
+	base := components[len(components)-1] + "-" + hex.EncodeToString(sum[:])[:8]
+	return strings.Join(append(keep, base), "/")
+}
+
+// Save writes the name mapping into the mapping file.
+func (n *NameNormalizer) Save() error {
+	if n == nil || n.path == "" {
+		return nil
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	b, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode name mapping: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(n.path), 0755); err != nil {
+		return fmt.Errorf("failed to create name mapping dir: %w", err)
+	}
+	tmp := n.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("failed to write name mapping: %w", err)
+	}
+	if err := os.Rename(tmp, n.path); err != nil {
+		return fmt.Errorf("failed to write name mapping: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package hangar
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NameNormalizer(t *testing.T) {
+	var n *NameNormalizer
+	project, name, err := n.Normalize("reg.io", "Library", "Nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, "Library", project)
+	assert.Equal(t, "Nginx", name)
+
+	_, err = NewNameNormalizer(&NameNormalizerOpts{MaxDepth: 1})
+	assert.NotNil(t, err)
+
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	n, err = NewNameNormalizer(&NameNormalizerOpts{
+		Lowercase:   true,
+		MaxDepth:    2,
+		MappingFile: path,
+	})
+	assert.Nil(t, err)
+	project, name, err = n.Normalize("reg.io", "Library", "Nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, "library", project)
+	assert.Equal(t, "nginx", name)
+	project, name, err = n.Normalize("reg.io", "team/sub/dir", "app")
+	assert.Nil(t, err)
+	assert.Equal(t, "team", project)
+	assert.Equal(t, "app-", name[:4])
+	assert.Equal(t, 12, len(name))
+	// Unchanged repositories are not recorded.
+	_, _, err = n.Normalize("reg.io", "library", "busybox")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(n.Repositories))
+	// Conflict with the recorded mapping.
+	_, _, err = n.Normalize("reg.io", "LIBRARY", "nginx")
+	assert.ErrorIs(t, err, ErrNameConflict)
+	// Different registry does not conflict.
+	_, _, err = n.Normalize("other.io", "LIBRARY", "nginx")
+	assert.Nil(t, err)
+	assert.Nil(t, n.Save())
+
+	// Recorded mapping is applied even if the normalization rule changed.
+	n, err = NewNameNormalizer(&NameNormalizerOpts{MappingFile: path})
+	assert.Nil(t, err)
+	project, name, err = n.Normalize("reg.io", "Library", "Nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, "library", project)
+	assert.Equal(t, "nginx", name)
+	project, name, err = n.Normalize("reg.io", "Other", "App")
+	assert.Nil(t, err)
+	assert.Equal(t, "Other", project)
+	assert.Equal(t, "App", name)
+}
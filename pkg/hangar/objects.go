@@ -1 +1,31 @@
 package hangar
+
+// object is the object sending to worker pool.
+type object interface {
+	// name returns the image name of the object, which is same as the
+	// name recorded by recordFailedImage when the object failed.
+	name() string
+}
+
+func (o *loadObject) name() string {
+	return o.image.Source + ":" + o.image.Tag
+}
+
+func (o *mirrorObject) name() string {
+	if o.source != nil {
+		return o.source.ReferenceNameWithoutTransport()
+	}
+	return o.image
+}
+
+func (o *saveObject) name() string {
+	return o.image
+}
+
+func (o *syncObject) name() string {
+	return o.image
+}
+
+func (o *planObject) name() string {
+	return o.image
+}
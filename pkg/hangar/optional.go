@@ -0,0 +1,56 @@
+package hangar
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// SkippedOptional is the optional image skipped since it is absent in
+// the source or has no image of the specified platforms.
+type SkippedOptional struct {
+	// Image is the image list line.
+	Image  string `json:"image"`
+	Reason string `json:"reason"`
+}
+
+// skipOptional records the optional image skipped if the error is the
+// absence of the image, returns false if the image is not optional or
+// the error should fail the image. The access denied error is not treated
+// as the absence since it may be caused by the missing credential.
+func (c *common) skipOptional(line string, err error) bool {
+	if !c.optional[line] {
+		return false
+	}
+	if !errors.Is(err, utils.ErrNoAvailableImage) && !isImageUnknown(err) {
+		return false
+	}
+	c.recordSkippedOptional(line, err)
+	return true
+}
+
+// recordSkippedOptional records the optional image skipped, which is not
+// counted as failed.
+func (c *common) recordSkippedOptional(line string, err error) {
+	logrus.Warnf("Skip optional image [%v]: %v", line, err)
+	c.skippedOptionalMutex.Lock()
+	c.skippedOptional = append(c.skippedOptional, SkippedOptional{
+		Image:  line,
+		Reason: err.Error(),
+	})
+	c.skippedOptionalMutex.Unlock()
+}
+
+// skippedOptionalImages returns the optional images skipped in sorted
+// order.
+func (c *common) skippedOptionalImages() []SkippedOptional {
+	c.skippedOptionalMutex.Lock()
+	skipped := append([]SkippedOptional{}, c.skippedOptional...)
+	c.skippedOptionalMutex.Unlock()
+	sort.Slice(skipped, func(i, j int) bool {
+		return skipped[i].Image < skipped[j].Image
+	})
+	return skipped
+}
@@ -0,0 +1,36 @@
+package hangar
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_skipOptional(t *testing.T) {
+	c := newTestCommon(t)
+	c.failedImageSet["c"] = true
+	c.optional = map[string]bool{"a": true, "b": true}
+	c.images = []string{"a", "b", "c", "d"}
+	c.total = 4
+	// Not optional.
+	assert.False(t, c.skipOptional("d", utils.ErrNoAvailableImage))
+	// Not the absence of the image.
+	assert.False(t, c.skipOptional("a", errors.New("connection refused")))
+	assert.False(t, c.skipOptional("a", errors.New("requested access to the resource is denied")))
+
+	assert.True(t, c.skipOptional("b",
+		fmt.Errorf("failed to init source: %w", errors.New("manifest unknown"))))
+	assert.True(t, c.skipOptional("a", utils.ErrNoAvailableImage))
+
+	s := c.Summary()
+	assert.Equal(t, []SkippedOptional{
+		{Image: "a", Reason: utils.ErrNoAvailableImage.Error()},
+		{Image: "b", Reason: "failed to init source: manifest unknown"},
+	}, s.SkippedOptional)
+	assert.Equal(t, 4, s.Total)
+	assert.Equal(t, 1, s.Failed)
+	assert.Equal(t, 1, s.Succeeded)
+}
@@ -0,0 +1,351 @@
+package hangar
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/logger"
+	"github.com/containers/image/v5/docker/reference"
+	imagemanifest "github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// PullStatus is the result status of the pulled image.
+type PullStatus string
+
+const (
+	PullStatusPulled PullStatus = "pulled"
+	PullStatusFailed PullStatus = "failed"
+)
+
+// PullResult is the pull result of an image in the report.
+type PullResult struct {
+	// Image is the image line in image list.
+	Image string `json:"image"`
+	// Reference is the destination image reference pulled.
+	Reference string `json:"reference"`
+	// Digest is the digest of the platform manifest pulled.
+	Digest string `json:"digest,omitempty"`
+	// Blobs is the number of the blobs pulled and verified.
+	Blobs int `json:"blobs,omitempty"`
+	// Size is the total size of the blobs pulled.
+	Size   int64      `json:"size,omitempty"`
+	Status PullStatus `json:"status"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// pullObject is the object sending to worker pool when pulling image
+type pullObject struct {
+	line    string
+	image   string
+	timeout time.Duration
+	id      int
+}
+
+func (o *pullObject) name() string {
+	return o.line
+}
+
+// Puller pulls the images in image list from the destination registry
+// to ensure the registry serves the mirrored images correctly.
+//
+// The manifest, config and the first layer of the image (or all layers
+// if Full is set) are downloaded and verified by their digests,
+// the pulled content is discarded.
+type Puller struct {
+	*common
+
+	// results is the pull results (thread-unsafe)
+	results []PullResult
+	// resultsMutex is a mutex for read/write of results
+	resultsMutex *sync.Mutex
+
+	// Override the registry of the images to be pulled
+	DestinationRegistry string
+	// Full pulls all layers of the image instead of the first layer
+	Full bool
+}
+
+type PullerOpts struct {
+	CommonOpts
+
+	// Override the registry of the images to be pulled
+	DestinationRegistry string
+	// Full pulls all layers of the image instead of the first layer
+	Full bool
+}
+
+func NewPuller(o *PullerOpts) (*Puller, error) {
+	p := &Puller{
+		resultsMutex:        &sync.Mutex{},
+		DestinationRegistry: o.DestinationRegistry,
+		Full:                o.Full,
+	}
+	var err error
+	p.common, err = newCommon(&o.CommonOpts)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SampleImages selects the images evenly distributed in the image list
+// by the sample, which is either a percentage (e.g. '10%') or a number.
+// The same sample of the same image list is always selected.
+func SampleImages(images []string, sample string) ([]string, error) {
+	sample = strings.TrimSpace(sample)
+	if sample == "" {
+		return images, nil
+	}
+	var n int
+	if s, ok := strings.CutSuffix(sample, "%"); ok {
+		p, err := strconv.ParseFloat(s, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid sample %q: percentage should be in (0, 100]", sample)
+		}
+		n = int(math.Ceil(float64(len(images)) * p / 100))
+	} else {
+		var err error
+		n, err = strconv.Atoi(sample)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid sample %q: should be a positive number or percentage", sample)
+		}
+	}
+	if n >= len(images) {
+		return images, nil
+	}
+	sampled := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		sampled = append(sampled, images[i*len(images)/n])
+	}
+	return sampled, nil
+}
+
+func (p *Puller) newObject(id int, line string) (*pullObject, error) {
+	image, _, _ := strings.Cut(strings.TrimSpace(line), "@")
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image %q: %w", line, err)
+	}
+	named = reference.TagNameOnly(named)
+	image = named.String()
+	if p.DestinationRegistry != "" {
+		image = p.DestinationRegistry + "/" + reference.Path(named) + ":" +
+			named.(reference.Tagged).Tag()
+	}
+	return &pullObject{
+		line:    line,
+		image:   image,
+		timeout: p.timeout,
+		id:      id,
+	}, nil
+}
+
+// Run pulls the images from destination registry.
+func (p *Puller) Run(ctx context.Context) error {
+	p.common.initErrorHandler(ctx)
+	p.common.initWorker(ctx, p.worker)
+	for i, line := range p.common.images {
+		object, err := p.newObject(i+1, line)
+		if err != nil {
+			p.recordResult(PullResult{
+				Image:  line,
+				Status: PullStatusFailed,
+				Error:  err.Error(),
+			})
+			p.recordFailedImage(line)
+			p.handleError(NewError(i+1, err, nil, nil))
+			continue
+		}
+		p.handleObject(object)
+	}
+	p.waitWorkers()
+	if len(p.failedImageSet) != 0 {
+		v := make([]string, 0, len(p.failedImageSet))
+		for i := range p.failedImageSet {
+			v = append(v, i)
+		}
+		logrus.Errorf("Pull failed image list: \n%v", strings.Join(v, "\n"))
+		return p.failedError(ErrPullFailed)
+	}
+	return nil
+}
+
+// Validate is not supported by puller.
+func (p *Puller) Validate(ctx context.Context) error {
+	return fmt.Errorf("validate is not supported by puller")
+}
+
+// Results returns the pull results sorted by image.
+func (p *Puller) Results() []PullResult {
+	p.resultsMutex.Lock()
+	defer p.resultsMutex.Unlock()
+
+	results := make([]PullResult, len(p.results))
+	copy(results, p.results)
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Image < results[j].Image
+	})
+	return results
+}
+
+func (p *Puller) recordResult(r PullResult) {
+	p.resultsMutex.Lock()
+	p.results = append(p.results, r)
+	p.resultsMutex.Unlock()
+}
+
+func (p *Puller) worker(ctx context.Context, o any) {
+	if o == nil {
+		return
+	}
+	obj, ok := o.(*pullObject)
+	if !ok {
+		logrus.Errorf("skip object type(%T), data %v", o, o)
+		return
+	}
+
+	var (
+		pullContext context.Context
+		cancel      context.CancelFunc
+		err         error
+		result      = PullResult{
+			Image:     obj.line,
+			Reference: obj.image,
+		}
+	)
+	if obj.timeout > 0 {
+		pullContext, cancel = context.WithTimeout(ctx, obj.timeout)
+	} else {
+		pullContext, cancel = context.WithCancel(ctx)
+	}
+	defer func() {
+		cancel()
+		if err != nil {
+			result.Status = PullStatusFailed
+			result.Error = err.Error()
+			p.handleError(NewError(obj.id, err, nil, nil))
+			p.recordFailedImage(obj.line)
+		} else {
+			result.Status = PullStatusPulled
+		}
+		p.recordResult(result)
+	}()
+
+	log := logger.FromContext(ctx).WithField(logger.ImageField, obj.id)
+	log.Infof("Pulling [%v]", obj.image)
+	err = p.pull(pullContext, obj, &result)
+	if err != nil {
+		err = fmt.Errorf("failed to pull [%v]: %w", obj.image, err)
+		return
+	}
+	log.Infof("Pulled [%v@%v]: %d blobs verified", obj.image, result.Digest, result.Blobs)
+}
+
+// pull downloads the manifest and blobs of the image and verifies
+// the content by digest.
+func (p *Puller) pull(ctx context.Context, obj *pullObject, result *PullResult) error {
+	ref, err := alltransports.ParseImageName("docker://" + obj.image)
+	if err != nil {
+		return fmt.Errorf("failed to parse image: %w", err)
+	}
+	src, err := ref.NewImageSource(ctx, p.systemContext)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	b, mime, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var instance *digest.Digest
+	if imagemanifest.MIMETypeIsMultiImage(mime) {
+		// Pull the instance of the platform the node would use.
+		list, err := imagemanifest.ListFromBlob(b, mime)
+		if err != nil {
+			return err
+		}
+		d, err := list.ChooseInstance(p.systemContext)
+		if err != nil {
+			return err
+		}
+		instance = &d
+		if b, mime, err = src.GetManifest(ctx, instance); err != nil {
+			return err
+		}
+		if err := verifyDigest(b, d); err != nil {
+			return fmt.Errorf("manifest %v: %w", d, err)
+		}
+	}
+	dgst, err := imagemanifest.Digest(b)
+	if err != nil {
+		return err
+	}
+	result.Digest = dgst.String()
+	m, err := imagemanifest.FromBlob(b, mime)
+	if err != nil {
+		return err
+	}
+
+	blobs := []types.BlobInfo{m.ConfigInfo()}
+	layers := m.LayerInfos()
+	if !p.Full && len(layers) > 1 {
+		layers = layers[:1]
+	}
+	for _, l := range layers {
+		blobs = append(blobs, l.BlobInfo)
+	}
+	for _, info := range blobs {
+		if info.Digest == "" {
+			continue
+		}
+		n, err := pullBlob(ctx, src, info)
+		if err != nil {
+			return fmt.Errorf("blob %v: %w", info.Digest, err)
+		}
+		result.Blobs++
+		result.Size += n
+	}
+	return nil
+}
+
+// pullBlob downloads the blob and discards the content after verified.
+func pullBlob(ctx context.Context, src types.ImageSource, info types.BlobInfo) (int64, error) {
+	rc, _, err := src.GetBlob(ctx, info, none.NoCache)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	verifier := info.Digest.Verifier()
+	n, err := io.Copy(verifier, rc)
+	if err != nil {
+		return n, err
+	}
+	if info.Size >= 0 && n != info.Size {
+		return n, fmt.Errorf("size %d does not match %d", n, info.Size)
+	}
+	if !verifier.Verified() {
+		return n, fmt.Errorf("digest mismatch")
+	}
+	return n, nil
+}
+
+func verifyDigest(b []byte, d digest.Digest) error {
+	if d.Algorithm().FromBytes(b) != d {
+		return fmt.Errorf("digest mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package hangar
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SampleImages(t *testing.T) {
+	images := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+
+	s, err := SampleImages(images, "")
+	assert.Nil(t, err)
+	assert.Equal(t, images, s)
+
+	s, err = SampleImages(images, "10%")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, s)
+
+	s, err = SampleImages(images, "25%")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "d", "g"}, s)
+
+	s, err = SampleImages(images, "5")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "c", "e", "g", "i"}, s)
+
+	s, err = SampleImages(images, "20")
+	assert.Nil(t, err)
+	assert.Equal(t, images, s)
+
+	_, err = SampleImages(images, "0")
+	assert.NotNil(t, err)
+	_, err = SampleImages(images, "120%")
+	assert.NotNil(t, err)
+	_, err = SampleImages(images, "abc")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,292 @@
+package hangar
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/audit"
+	"github.com/cnrancher/hangar/pkg/copy"
+	"github.com/cnrancher/hangar/pkg/logger"
+	"github.com/cnrancher/hangar/pkg/manifest"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/common/pkg/retry"
+	imagecopy "github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/docker/reference"
+	imagemanifest "github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports/alltransports"
+	imagetypes "github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// retagObject is the object sending to worker pool when re-tagging image
+type retagObject struct {
+	line        string
+	source      imagetypes.ImageReference
+	destination imagetypes.ImageReference
+	timeout     time.Duration
+	id          int
+}
+
+func (o *retagObject) name() string {
+	return o.line
+}
+
+// Retagger copies the image manifests between tags/repositories within
+// the same registry, the blobs are mounted instead of being transferred.
+//
+// The image list line format is:
+//
+//	[SOURCE_IMAGE] [DEST_IMAGE]
+//
+// Example:
+//
+//	harbor.local/app/app:1.2.3 harbor.local/app/app:stable
+type Retagger struct {
+	*common
+}
+
+type RetaggerOpts struct {
+	CommonOpts
+}
+
+func NewRetagger(o *RetaggerOpts) (*Retagger, error) {
+	r := &Retagger{}
+	var err error
+	r.common, err = newCommon(&o.CommonOpts)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ParseRetagLine parses the source and destination image of the retag
+// image list line.
+func ParseRetagLine(line string) (string, string, error) {
+	v := strings.Fields(line)
+	if len(v) != 2 {
+		return "", "", fmt.Errorf("invalid line %q: should be '[SOURCE_IMAGE] [DEST_IMAGE]'", line)
+	}
+	src, err := reference.ParseNormalizedNamed(v[0])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid source image %q: %w", v[0], err)
+	}
+	dest, err := reference.ParseNormalizedNamed(v[1])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid destination image %q: %w", v[1], err)
+	}
+	if reference.Domain(src) != reference.Domain(dest) {
+		return "", "", fmt.Errorf("source %q and destination %q are not in the same registry",
+			v[0], v[1])
+	}
+	if _, ok := dest.(reference.Tagged); !ok {
+		return "", "", fmt.Errorf("destination %q should have a tag", v[1])
+	}
+	return reference.TagNameOnly(src).String(), dest.String(), nil
+}
+
+func (r *Retagger) newObject(id int, line string) (*retagObject, error) {
+	src, dest, err := ParseRetagLine(line)
+	if err != nil {
+		return nil, err
+	}
+	srcRef, err := alltransports.ParseImageName("docker://" + src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse source image: %w", err)
+	}
+	destRef, err := alltransports.ParseImageName("docker://" + dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse destination image: %w", err)
+	}
+	return &retagObject{
+		line:        line,
+		source:      srcRef,
+		destination: destRef,
+		timeout:     r.timeout,
+		id:          id,
+	}, nil
+}
+
+func (r *Retagger) handleLines(ctx context.Context, f func(context.Context, any)) {
+	r.common.initErrorHandler(ctx)
+	r.common.initWorker(ctx, f)
+	for i, line := range r.common.images {
+		object, err := r.newObject(i+1, line)
+		if err != nil {
+			r.recordFailedImage(line)
+			r.handleError(NewError(i+1, err, nil, nil))
+			continue
+		}
+		r.handleObject(object)
+	}
+	r.waitWorkers()
+}
+
+// Run copies the image manifests from source tags to destination tags.
+func (r *Retagger) Run(ctx context.Context) error {
+	r.handleLines(ctx, r.worker)
+	if len(r.failedImageSet) != 0 {
+		v := make([]string, 0, len(r.failedImageSet))
+		for i := range r.failedImageSet {
+			v = append(v, i)
+		}
+		logrus.Errorf("Retag failed image list: \n%v", strings.Join(v, "\n"))
+		return r.failedError(ErrCopyFailed)
+	}
+	return nil
+}
+
+// Validate checks the destination tags have the same manifest digest
+// with the source tags.
+func (r *Retagger) Validate(ctx context.Context) error {
+	r.handleLines(ctx, r.validateWorker)
+	if len(r.failedImageSet) != 0 {
+		v := make([]string, 0, len(r.failedImageSet))
+		for i := range r.failedImageSet {
+			v = append(v, i)
+		}
+		logrus.Errorf("Validate failed image list: \n%v", strings.Join(v, "\n"))
+		return r.failedError(ErrValidateFailed)
+	}
+	return nil
+}
+
+func (r *Retagger) worker(ctx context.Context, o any) {
+	if o == nil {
+		return
+	}
+	obj, ok := o.(*retagObject)
+	if !ok {
+		logrus.Errorf("skip object type(%T), data %v", o, o)
+		return
+	}
+
+	var (
+		copyContext context.Context
+		cancel      context.CancelFunc
+		err         error
+	)
+	if obj.timeout > 0 {
+		copyContext, cancel = context.WithTimeout(ctx, obj.timeout)
+	} else {
+		copyContext, cancel = context.WithCancel(ctx)
+	}
+	defer func() {
+		cancel()
+		if err != nil {
+			r.handleError(NewError(obj.id, err, nil, nil))
+			r.recordFailedImage(obj.line)
+		}
+	}()
+
+	logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+		Infof("Retagging [%v] => [%v]",
+			obj.source.DockerReference(), obj.destination.DockerReference())
+	// Record the source blobs into cache to mount blobs by the destination.
+	if err = copy.RecordBlobLocations(copyContext, obj.source, r.systemContext); err != nil {
+		return
+	}
+	copier := copy.NewCopier(&copy.CopierOption{
+		Options: &imagecopy.Options{
+			SourceCtx:          utils.CopySystemContext(r.systemContext),
+			DestinationCtx:     utils.CopySystemContext(r.systemContext),
+			ImageListSelection: imagecopy.CopyAllImages,
+			PreserveDigests:    true,
+		},
+		RetryOptions: &retry.Options{
+			MaxRetry: 3,
+			Delay:    time.Millisecond * 100,
+		},
+		SourceRef: obj.source,
+		DestRef:   obj.destination,
+		Policy:    r.policy,
+	})
+	var m []byte
+	m, err = copier.Copy(copyContext)
+	var digests []string
+	if err == nil {
+		if dgst, e := imagemanifest.Digest(m); e == nil {
+			digests = append(digests, dgst.String())
+		}
+	}
+	recordAudit(ctx, audit.ActionRetag,
+		obj.source.DockerReference().String(),
+		obj.destination.DockerReference().String(), digests, err)
+	if err != nil {
+		err = fmt.Errorf("failed to copy [%v] to [%v]: %w",
+			obj.source.DockerReference(), obj.destination.DockerReference(), err)
+		return
+	}
+}
+
+func (r *Retagger) validateWorker(ctx context.Context, o any) {
+	if o == nil {
+		return
+	}
+	obj, ok := o.(*retagObject)
+	if !ok {
+		logrus.Errorf("skip object type(%T), data %v", o, o)
+		return
+	}
+
+	var (
+		validateContext context.Context
+		cancel          context.CancelFunc
+		err             error
+	)
+	if obj.timeout > 0 {
+		validateContext, cancel = context.WithTimeout(ctx, obj.timeout)
+	} else {
+		validateContext, cancel = context.WithCancel(ctx)
+	}
+	defer func() {
+		cancel()
+		if err != nil {
+			r.handleError(NewError(obj.id, err, nil, nil))
+			r.recordFailedImage(obj.line)
+		}
+	}()
+
+	srcDigest, err := r.manifestDigest(validateContext, obj.source)
+	if err != nil {
+		err = fmt.Errorf("failed to inspect [%v]: %w", obj.source.DockerReference(), err)
+		return
+	}
+	destDigest, err := r.manifestDigest(validateContext, obj.destination)
+	if err != nil {
+		err = fmt.Errorf("failed to inspect [%v]: %w", obj.destination.DockerReference(), err)
+		return
+	}
+	if srcDigest != destDigest {
+		err = fmt.Errorf("digest mismatch: [%v] %v, [%v] %v",
+			obj.source.DockerReference(), srcDigest,
+			obj.destination.DockerReference(), destDigest)
+		return
+	}
+	logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+		Infof("PASS: [%v] == [%v]",
+			obj.source.DockerReference(), obj.destination.DockerReference())
+}
+
+func (r *Retagger) manifestDigest(
+	ctx context.Context, ref imagetypes.ImageReference,
+) (string, error) {
+	inspector, err := manifest.NewInspector(ctx, &manifest.InspectorOption{
+		Reference:     ref,
+		SystemContext: r.systemContext,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer inspector.Close()
+	b, _, err := inspector.Raw(ctx)
+	if err != nil {
+		return "", err
+	}
+	d, err := imagemanifest.Digest(b)
+	if err != nil {
+		return "", err
+	}
+	return d.String(), nil
+}
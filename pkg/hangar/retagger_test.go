@@ -0,0 +1,26 @@
+package hangar
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseRetagLine(t *testing.T) {
+	src, dest, err := ParseRetagLine("harbor.local/app/app:1.2.3  harbor.local/app/app:stable")
+	assert.Nil(t, err)
+	assert.Equal(t, "harbor.local/app/app:1.2.3", src)
+	assert.Equal(t, "harbor.local/app/app:stable", dest)
+
+	src, dest, err = ParseRetagLine("nginx library/nginx:stable")
+	assert.Nil(t, err)
+	assert.Equal(t, "docker.io/library/nginx:latest", src)
+	assert.Equal(t, "docker.io/library/nginx:stable", dest)
+
+	_, _, err = ParseRetagLine("harbor.local/app/app:1.2.3")
+	assert.NotNil(t, err)
+	_, _, err = ParseRetagLine("harbor.local/app/app:1.2.3 registry.local/app/app:stable")
+	assert.NotNil(t, err)
+	_, _, err = ParseRetagLine("harbor.local/app/app:1.2.3 harbor.local/app/app")
+	assert.NotNil(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/cnrancher/hangar/pkg/destination"
 	"github.com/cnrancher/hangar/pkg/hangar/archive"
 	"github.com/cnrancher/hangar/pkg/hangar/imagelist"
+	"github.com/cnrancher/hangar/pkg/logger"
 	"github.com/cnrancher/hangar/pkg/source"
 	"github.com/cnrancher/hangar/pkg/types"
 	"github.com/cnrancher/hangar/pkg/utils"
@@ -28,15 +30,43 @@ type saveObject struct {
 	destination *destination.Destination
 	timeout     time.Duration
 	id          int
+	// resumed is the image completed by the interrupted job, the image
+	// is written into archive from the cache dir without pulling
+	resumed *CheckpointImage
+}
+
+// copiedImage returns the image copied into the cache dir.
+func (obj *saveObject) copiedImage() *archive.Image {
+	if obj.resumed != nil {
+		return obj.resumed.Image
+	}
+	return obj.source.GetCopiedImage()
+}
+
+// digest returns the source manifest digest of the image.
+func (obj *saveObject) digest() digest.Digest {
+	if obj.resumed != nil {
+		return obj.resumed.Digest
+	}
+	return obj.source.Digest()
 }
 
 type Saver struct {
 	*common
 
-	aw        *archive.Writer
+	aw        *archive.MultiWriter
 	awMutex   *sync.RWMutex
 	index     *archive.Index
 	layersSet map[digest.Digest]bool
+	// skipBlobs is the image layers present out-of-band
+	skipBlobs map[digest.Digest]bool
+	// pending is the pulled images to write into archive in the
+	// deterministic mode
+	pending      []*saveObject
+	pendingMutex *sync.Mutex
+	// archived is the source digests of the images written into archive,
+	// recorded into the state DB after the archive index is written
+	archived map[string]digest.Digest
 
 	// Override the registry of source image to be copied
 	SourceRegistry string
@@ -46,6 +76,16 @@ type Saver struct {
 	SharedBlobDirPath string
 	// ArchiveName is the saved archive file name
 	ArchiveName string
+	// ExtraArchiveNames are the additional archive files written from
+	// the same pulled blobs, the format is detected by the file extension.
+	ExtraArchiveNames []string
+	// Layout is the representation of the saved images
+	Layout archive.Layout
+	// Deterministic makes the archive output identical for the identical
+	// input images
+	Deterministic bool
+	// Compress is the options of the archive compression pipeline
+	Compress *archive.CompressOpts
 }
 
 type SaverOpts struct {
@@ -59,6 +99,26 @@ type SaverOpts struct {
 	SharedBlobDirPath string
 	// ArchiveName is the saved archive file name
 	ArchiveName string
+	// ExtraArchiveNames are the additional archive files written from
+	// the same pulled blobs, the format is detected by the file extension.
+	ExtraArchiveNames []string
+	// Layout is the representation of the saved images, the archives are
+	// written as unpacked directories if the layout is LayoutDir.
+	Layout archive.Layout
+	// Deterministic writes the images in the image list order with fixed
+	// timestamps, so the archive output is identical for the identical
+	// input images, the pulled images are cached until all images pulled.
+	Deterministic bool
+	// SkipBlobs is the image layers present out-of-band and not to be
+	// saved into the archive.
+	SkipBlobs map[digest.Digest]bool
+	// Compress is the options of the parallel compression and the blob
+	// staging of the archive writers, the default options are used if nil.
+	Compress *archive.CompressOpts
+	// Resume writes the completed images into the checkpoint periodically
+	// and resumes the interrupted job by the checkpoint, the pulled images
+	// are kept in the resume dir until the job completed.
+	Resume bool
 }
 
 func NewSaver(o *SaverOpts) (*Saver, error) {
@@ -66,11 +126,18 @@ func NewSaver(o *SaverOpts) (*Saver, error) {
 		awMutex:   &sync.RWMutex{},
 		index:     archive.NewIndex(),
 		layersSet: make(map[digest.Digest]bool),
+		skipBlobs: o.SkipBlobs,
+
+		pendingMutex: &sync.Mutex{},
 
 		SourceRegistry:    o.SourceRegistry,
 		SourceProject:     o.SourceProject,
 		SharedBlobDirPath: o.SharedBlobDirPath,
 		ArchiveName:       o.ArchiveName,
+		ExtraArchiveNames: o.ExtraArchiveNames,
+		Layout:            o.Layout,
+		Deterministic:     o.Deterministic,
+		Compress:          o.Compress,
 	}
 	if s.SharedBlobDirPath == "" {
 		s.SharedBlobDirPath = archive.SharedBlobDir
@@ -80,47 +147,51 @@ func NewSaver(o *SaverOpts) (*Saver, error) {
 	if err != nil {
 		return nil, err
 	}
+	if o.Resume {
+		s.common.checkpoint, err = NewCheckpoint(ResumeDir(s.ArchiveName))
+		if err != nil {
+			return nil, err
+		}
+		if n := len(s.common.checkpoint.Images); n > 0 {
+			logrus.Infof("Resume the interrupted job: %d images completed", n)
+		}
+	}
 	return s, nil
 }
 
 func (s *Saver) copy(ctx context.Context) {
+	stopCheckpoint := s.checkpoint.autoSave(ctx)
 	s.common.initErrorHandler(ctx)
+	s.common.flushIndex = s.flushPartialIndex
+	s.common.workersDone = func() {
+		s.archivePending(ctx)
+	}
 	s.common.initWorker(ctx, s.worker)
 	for i, img := range s.common.images {
 		switch imagelist.Detect(img) {
-		case imagelist.TypeDefault:
+		case imagelist.TypeDefault, imagelist.TypePair, imagelist.TypeDockerArchive:
 		default:
 			logrus.Warnf("Ignore image list line %q: invalid format", img)
 			continue
 		}
+		if s.skipByBudget(img) {
+			continue
+		}
 		object := &saveObject{
 			id:    i + 1,
 			image: img,
 		}
-		sourceRegistry := utils.GetRegistryName(img)
-		if s.SourceRegistry != "" {
-			sourceRegistry = s.SourceRegistry
-		}
-		sourceProject := utils.GetProjectName(img)
-		if s.SourceProject != "" {
-			sourceProject = s.SourceProject
-		}
-		src, err := source.NewSource(&source.Option{
-			Type:          types.TypeDocker,
-			Registry:      sourceRegistry,
-			Project:       sourceProject,
-			Name:          utils.GetImageName(img),
-			Tag:           utils.GetImageTag(img),
-			SystemContext: s.systemContext,
-		})
+		src, ref, err := newImageListSource(
+			img, s.SourceRegistry, s.SourceProject, s.systemContext)
 		if err != nil {
 			s.handleError(fmt.Errorf("failed to init source image: %w", err))
 			s.recordFailedImage(img)
 			continue
 		}
 		object.source = src
+		s.configureSource(src)
 
-		cd, err := s.newSaveCacheDir()
+		cd, err := s.newSaveCacheDir(object)
 		if err != nil {
 			s.handleError(fmt.Errorf("failed to create cache dir: %w", err))
 			os.RemoveAll(cd)
@@ -131,8 +202,8 @@ func (s *Saver) copy(ctx context.Context) {
 		dest, err := destination.NewDestination(&destination.Option{
 			Type:          types.TypeOci,
 			Directory:     cd,
-			Name:          utils.GetImageName(img),
-			Tag:           utils.GetImageTag(img),
+			Name:          utils.GetImageName(ref),
+			Tag:           utils.GetImageTag(ref),
 			SystemContext: utils.SystemContextWithSharedBlobDir(s.systemContext, sd),
 		})
 		if err != nil {
@@ -147,15 +218,80 @@ func (s *Saver) copy(ctx context.Context) {
 		}
 	}
 	s.waitWorkers()
+	stopCheckpoint()
 	if err := s.writeIndex(); err != nil {
 		logrus.Errorf("failed to write index file: %v", err)
+	} else {
+		if s.batchSize > 0 {
+			// The archive is completed, remove the partial index file.
+			os.Remove(archive.PartialIndexName(s.ArchiveName))
+		}
+		s.recordArchivedState()
 	}
 	if err := s.aw.Close(); err != nil {
 		logrus.Errorf("failed to close archive writer: %v", err)
+		return
 	}
+	for _, name := range s.archiveNames() {
+		if err := archive.WriteChecksum(name); err != nil {
+			logrus.Errorf("failed to write checksum of %q: %v", name, err)
+		}
+	}
+	s.finishCheckpoint(ctx)
 }
 
-func (s *Saver) newSaveCacheDir() (string, error) {
+// flushPartialIndex writes the index of the images written into the
+// archive so far beside the archive file.
+func (s *Saver) flushPartialIndex() error {
+	s.awMutex.RLock()
+	defer s.awMutex.RUnlock()
+	return archive.WritePartialIndex(s.ArchiveName, s.index)
+}
+
+// archivePending writes the pulled images into archive in the image list
+// order in the deterministic mode.
+func (s *Saver) archivePending(ctx context.Context) {
+	sort.Slice(s.pending, func(i, j int) bool {
+		return s.pending[i].id < s.pending[j].id
+	})
+	for _, obj := range s.pending {
+		if err := s.archiveImage(ctx, obj); err != nil {
+			s.handleError(NewError(obj.id, err, obj.source, obj.destination))
+			s.recordFailedImage(obj.image)
+		}
+		if s.checkpoint.Completed(obj.image) != nil {
+			// Keep the cache dir of the completed image to resume the job.
+			continue
+		}
+		if err := os.RemoveAll(obj.destination.Directory()); err != nil {
+			logrus.Errorf("failed to delete cache dir %q: %v",
+				obj.destination.Directory(), err)
+		}
+	}
+	s.pending = nil
+}
+
+// newSaveCacheDir creates the cache dir to pull the image, the cache dir is
+// in the resume dir if resume is enabled, and the cache dir of the image
+// completed by the interrupted job is reused.
+func (s *Saver) newSaveCacheDir(obj *saveObject) (string, error) {
+	if s.checkpoint != nil {
+		cd := s.checkpoint.CacheDir(obj.image)
+		if c := s.checkpoint.Completed(obj.image); c != nil {
+			if _, err := os.Stat(cd); err == nil {
+				obj.resumed = c
+				return cd, nil
+			}
+		}
+		// Remove the cache dir of the image not completed.
+		if err := os.RemoveAll(cd); err != nil {
+			return "", fmt.Errorf("failed to remove %q: %w", cd, err)
+		}
+		if err := os.MkdirAll(cd, 0755); err != nil {
+			return "", fmt.Errorf("failed to create %q: %w", cd, err)
+		}
+		return cd, nil
+	}
 	cd, err := os.MkdirTemp(archive.CacheDir(), "*")
 	if err != nil {
 		return "", fmt.Errorf("os.MkdirTemp: %w", err)
@@ -171,11 +307,15 @@ func (s *Saver) writeIndex() error {
 // Run save images from registry server into local directory / hangar archive.
 func (s *Saver) Run(ctx context.Context) error {
 	// Init Archive Writer.
-	aw, err := archive.NewWriter(s.ArchiveName)
+	aw, err := archive.NewMultiWriter(s.Layout, s.Compress, s.archiveNames()...)
 	if err != nil {
-		return fmt.Errorf("failed to create archive %q: %w", s.ArchiveName, err)
+		return fmt.Errorf("failed to create archive: %w", err)
 	}
 	s.aw = aw
+	if s.Deterministic {
+		s.aw.SetDeterministic()
+		s.index.Time = archive.FixedModTime
+	}
 
 	s.copy(ctx)
 	if len(s.failedImageSet) != 0 {
@@ -184,11 +324,16 @@ func (s *Saver) Run(ctx context.Context) error {
 			v = append(v, i)
 		}
 		logrus.Errorf("Save failed image list: \n%v", strings.Join(v, "\n"))
-		return ErrCopyFailed
+		return s.failedError(ErrCopyFailed)
 	}
 	return nil
 }
 
+// archiveNames returns all archive file names to write.
+func (s *Saver) archiveNames() []string {
+	return append([]string{s.ArchiveName}, s.ExtraArchiveNames...)
+}
+
 func (s *Saver) worker(ctx context.Context, o any) {
 	if o == nil {
 		return
@@ -203,6 +348,7 @@ func (s *Saver) worker(ctx context.Context, o any) {
 		copyContext context.Context
 		cancel      context.CancelFunc
 		err         error
+		keepCache   bool
 	)
 	if obj.timeout > 0 {
 		copyContext, cancel = context.WithTimeout(ctx, obj.timeout)
@@ -210,58 +356,127 @@ func (s *Saver) worker(ctx context.Context, o any) {
 		copyContext, cancel = context.WithCancel(ctx)
 	}
 	defer func() {
-		if err != nil {
+		if err != nil && !s.skipOptional(obj.image, err) {
 			s.handleError(NewError(obj.id, err, obj.source, obj.destination))
 			s.recordFailedImage(obj.image)
 		}
 		cancel()
+		if keepCache {
+			return
+		}
 		// Delete cache dir.
 		if err = os.RemoveAll(obj.destination.Directory()); err != nil {
 			logrus.Errorf("failed to delete cache dir %q: %v",
 				obj.destination.Directory(), err)
 		}
 	}()
-
-	err = obj.source.Init(copyContext)
+	record, err := s.waitBreaker(ctx, obj.source.Registry())
 	if err != nil {
-		err = fmt.Errorf("failed to init source: %w", err)
 		return
 	}
-	logrus.WithFields(logrus.Fields{"IMG": obj.id}).
-		Infof("Saving [%v]", obj.source.ReferenceNameWithoutTransport())
-	err = obj.destination.Init(copyContext)
-	if err != nil {
-		err = fmt.Errorf("failed to init destination: %w", err)
+	defer record(&err)
+	timer := newImageTimer(obj.image)
+	defer s.timings.record(timer)
+
+	if obj.resumed != nil {
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+			Infof("Skip pulling [%v]: completed by the interrupted job",
+				obj.image)
+		if s.lock != nil {
+			s.lock.Record(obj.source.ReferenceNameWithoutTransport(), obj.resumed.Digest)
+		}
+	} else {
+		var pulled bool
+		if pulled, err = s.pull(ctx, copyContext, obj, timer); err != nil || !pulled {
+			return
+		}
+	}
+	if s.checkpoint.Completed(obj.image) != nil {
+		// Keep the cache dir of the completed image to resume the job.
+		keepCache = true
+	}
+
+	if s.Deterministic {
+		// Write the image into archive in the image list order after all
+		// images are pulled, keep the cache dir until written.
+		s.pendingMutex.Lock()
+		s.pending = append(s.pending, obj)
+		s.pendingMutex.Unlock()
+		keepCache = true
 		return
 	}
-	err = obj.source.Copy(copyContext, obj.destination, s.imageSpecSet, s.policy)
+
+	// Images copied to cache folder, write to archive file.
+	timer.begin(PhaseArchive)
+	err = s.archiveImage(ctx, obj)
+}
+
+// pull pulls the image into the cache dir, returns false if the image is
+// skipped.
+func (s *Saver) pull(
+	ctx, copyContext context.Context, obj *saveObject, timer *imageTimer,
+) (bool, error) {
+	timer.begin(PhaseInspect)
+	if err := obj.source.Init(copyContext); err != nil {
+		return false, fmt.Errorf("failed to init source: %w", err)
+	}
+	if err := s.verifySource(obj.source); err != nil {
+		return false, err
+	}
+	if s.skipUnchanged(obj.source.ReferenceNameWithoutTransport(), obj.source.Digest()) {
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+			Infof("Skip saving [%v]: source digest [%v] not changed since last run",
+				obj.source.ReferenceNameWithoutTransport(), obj.source.Digest())
+		return false, nil
+	}
+	logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+		Infof("Saving [%v]", obj.source.ReferenceNameWithoutTransport())
+	if err := obj.destination.Init(copyContext); err != nil {
+		return false, fmt.Errorf("failed to init destination: %w", err)
+	}
+	timer.begin(PhasePull)
+	err := obj.source.Copy(copyContext, obj.destination, s.imageSpecSet, s.policy)
 	if err != nil {
-		if errors.Is(err, utils.ErrNoAvailableImage) {
-			logrus.WithFields(logrus.Fields{"IMG": obj.id}).
-				Warnf("Skip save image [%v]: %v",
-					obj.source.ReferenceNameWithoutTransport(), err)
-			err = nil
-		} else {
-			err = fmt.Errorf("failed to copy [%v] to [%v]: %w",
+		if !errors.Is(err, utils.ErrNoAvailableImage) {
+			return false, fmt.Errorf("failed to copy [%v] to [%v]: %w",
 				obj.source.ReferenceName(), obj.destination.ReferenceName(), err)
-			return
 		}
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+			Warnf("Skip save image [%v]: %v",
+				obj.source.ReferenceNameWithoutTransport(), err)
+		s.skipOptional(obj.image, err)
 	}
+	s.recordExcludedAttestations(obj.source.ExcludedAttestations())
+	s.recordDeprecated(obj.source.ReferenceNameWithoutTransport(), obj.source.DeprecatedMediaTypes())
+	s.checkpoint.Record(obj.image, obj.source.Digest(), obj.source.GetCopiedImage())
+	return true, nil
+}
 
-	// Images copied to cache folder, write to archive file.
+// archiveImage writes the image copied to the cache dir into archive file
+// and removes the duplicated blobs.
+func (s *Saver) archiveImage(ctx context.Context, obj *saveObject) error {
 	s.awMutex.Lock()
 	defer s.awMutex.Unlock()
 
-	logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+	logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 		Debugf("Compressing [%v]", obj.destination.ReferenceNameWithoutTransport())
 
 	destDir := obj.destination.Directory()
-	copiedImage := obj.source.GetCopiedImage()
+	copiedImage := obj.copiedImage()
+	renamePairImage(obj.image, copiedImage)
 	imageBlobs := map[digest.Digest]bool{}
 	filesToDelete := map[string]bool{}
 	// Record image layers and remove duplicated layers.
 	for _, image := range copiedImage.Images {
 		for _, layer := range image.Layers {
+			if s.skipBlobs[layer] {
+				// The layer is present out-of-band, do not save it.
+				d := path.Join(destDir, archive.SharedBlobDir,
+					string(layer.Algorithm()), layer.Encoded())
+				filesToDelete[d] = true
+				s.index.SkipBlob(layer)
+				continue
+			}
 			imageBlobs[layer] = true
 		}
 		if image.Config != "" {
@@ -275,17 +490,25 @@ func (s *Saver) worker(ctx context.Context, o any) {
 		}
 	}
 	for blob := range imageBlobs {
-		if s.layersSet[blob] {
-			d := path.Join(destDir, archive.SharedBlobDir,
-				string(blob.Algorithm()), blob.Encoded())
+		d := path.Join(destDir, archive.SharedBlobDir,
+			string(blob.Algorithm()), blob.Encoded())
+		switch {
+		case s.layersSet[blob]:
 			filesToDelete[d] = true
-		} else {
+		case obj.resumed != nil:
+			// The duplicated blobs were removed from the cache dir of the
+			// resumed image by the interrupted job, the blob is written by
+			// the image whose cache dir keeps it.
+			if _, err := os.Stat(d); err == nil {
+				s.layersSet[blob] = true
+			}
+		default:
 			s.layersSet[blob] = true
 		}
 	}
 
 	for f := range filesToDelete {
-		if _, err := os.Stat(f); err != nil {
+		if _, err := os.Stat(f); err != nil && obj.resumed == nil {
 			logrus.Warnf("failed to clean duplicated file %q: stat: %v",
 				f, err)
 		}
@@ -295,17 +518,52 @@ func (s *Saver) worker(ctx context.Context, o any) {
 		}
 	}
 
-	err = s.aw.Write(obj.destination.ReferenceNameWithoutTransport())
+	err := s.aw.Write(obj.destination.ReferenceNameWithoutTransport())
 	if err != nil {
-		err = fmt.Errorf("failed to write [%v] to [%v]: %w",
-			obj.destination.ReferenceNameWithoutTransport(), s.ArchiveName, err)
-		return
+		return fmt.Errorf("failed to write [%v] to [%v]: %w",
+			obj.destination.ReferenceNameWithoutTransport(),
+			strings.Join(s.archiveNames(), ","), err)
 	}
 	s.index.Append(copiedImage)
+	s.recordCopiedImage(obj.source.ReferenceNameWithoutTransport(), copiedImage)
+	if s.stateStore != nil && len(copiedImage.Images) != 0 {
+		if s.archived == nil {
+			s.archived = make(map[string]digest.Digest)
+		}
+		s.archived[obj.source.ReferenceNameWithoutTransport()] = obj.digest()
+	}
+	return nil
+}
+
+// recordArchivedState records the images written into the completed archive
+// into the state DB, the images of the incomplete archive are not recorded
+// so they are saved again by the next run.
+func (s *Saver) recordArchivedState() {
+	if s.stateStore == nil || len(s.archived) == 0 {
+		return
+	}
+	for image, dgst := range s.archived {
+		s.recordState(image, dgst)
+	}
+	s.saveStateStore()
 }
 
 func (s *Saver) Validate(ctx context.Context) error {
-	ar, err := archive.NewReader(s.ArchiveName)
+	// Only the zip archive and the unpacked directory support reading
+	// the index.
+	var name string
+	for _, n := range s.archiveNames() {
+		if fi, err := os.Stat(n); err == nil && fi.IsDir() ||
+			archive.DetectFormat(n) == archive.FormatZip {
+			name = n
+			break
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("validate requires a zip archive or directory, got [%v]",
+			strings.Join(s.archiveNames(), ","))
+	}
+	ar, err := archive.NewReader(name)
 	if err != nil {
 		return fmt.Errorf("failed to create archive reader: %w", err)
 	}
@@ -327,17 +585,25 @@ func (s *Saver) Validate(ctx context.Context) error {
 			v = append(v, i)
 		}
 		logrus.Errorf("Validate failed image list: \n%v", strings.Join(v, "\n"))
-		return ErrValidateFailed
+		return s.failedError(ErrValidateFailed)
 	}
 	return nil
 }
 
+// DryRun resolves the source manifests of the image list and the platform
+// images would be saved into the archive without creating the archive.
+func (s *Saver) DryRun(ctx context.Context) (*Plan, error) {
+	return s.dryRun(ctx, func() {
+		s.planImageList(s.SourceRegistry, s.SourceProject, s.ArchiveName)
+	})
+}
+
 func (s *Saver) validate(ctx context.Context) {
 	s.common.initErrorHandler(ctx)
 	s.common.initWorker(ctx, s.validateWorker)
 	for i, img := range s.common.images {
 		switch imagelist.Detect(img) {
-		case imagelist.TypeDefault:
+		case imagelist.TypeDefault, imagelist.TypePair, imagelist.TypeDockerArchive:
 		default:
 			logrus.Warnf("Ignore image list line %q: invalid format", img)
 			continue
@@ -346,22 +612,8 @@ func (s *Saver) validate(ctx context.Context) {
 			id:    i + 1,
 			image: img,
 		}
-		sourceRegistry := utils.GetRegistryName(img)
-		if s.SourceRegistry != "" {
-			sourceRegistry = s.SourceRegistry
-		}
-		sourceProject := utils.GetProjectName(img)
-		if s.SourceProject != "" {
-			sourceProject = s.SourceProject
-		}
-		src, err := source.NewSource(&source.Option{
-			Type:          types.TypeDocker,
-			Registry:      sourceRegistry,
-			Project:       sourceProject,
-			Name:          utils.GetImageName(img),
-			Tag:           utils.GetImageTag(img),
-			SystemContext: s.systemContext,
-		})
+		src, _, err := newImageListSource(
+			img, s.SourceRegistry, s.SourceProject, s.systemContext)
 		if err != nil {
 			s.handleError(fmt.Errorf("failed to init source image: %w", err))
 			s.recordFailedImage(img)
@@ -396,7 +648,7 @@ func (s *Saver) validateWorker(ctx context.Context, o any) {
 
 	defer func() {
 		cancel()
-		if err != nil {
+		if err != nil && !s.skipOptional(obj.image, err) {
 			s.handleError(NewError(obj.id, err, nil, nil))
 			s.recordFailedImage(obj.image)
 		}
@@ -404,14 +656,17 @@ func (s *Saver) validateWorker(ctx context.Context, o any) {
 
 	err = obj.source.Init(validateContext)
 	if err != nil {
+		s.suggestSource(validateContext, obj.image, obj.source, err)
 		return
 	}
 	var fail bool
-	switch obj.source.MIME() {
-	case imagemanifest.DockerV2Schema1MediaType,
-		imagemanifest.DockerV2Schema1SignedMediaType:
+	switch {
+	case obj.source.Type() == types.TypeDockerArhive,
+		obj.source.MIME() == imagemanifest.DockerV2Schema1MediaType,
+		obj.source.MIME() == imagemanifest.DockerV2Schema1SignedMediaType:
 		// Could not compare image digest since the destination mediaType
-		// was changed during copy.
+		// was changed during copy, or the layers of the docker-archive
+		// tarball were compressed.
 		if !s.index.HasReference(
 			obj.source.Project(), obj.source.Name(), obj.source.Tag()) {
 			fail = true
@@ -424,7 +679,7 @@ func (s *Saver) validateWorker(ctx context.Context, o any) {
 	}
 
 	if fail {
-		logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 			Errorf("Image [%v] does not exists in archive index",
 				obj.source.ReferenceNameWithoutTransport())
 		err = fmt.Errorf("FAILED: [%v]",
@@ -432,6 +687,6 @@ func (s *Saver) validateWorker(ctx context.Context, o any) {
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+	logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 		Infof("PASS: [%v]", obj.source.ReferenceNameWithoutTransport())
 }
@@ -0,0 +1,45 @@
+package hangar
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// LoadSkipBlobs reads the blob digests to skip from the file, one digest
+// (ALGORITHM:ENCODED) per line, empty lines and lines starting with '#'
+// are ignored.
+func LoadSkipBlobs(name string) (map[digest.Digest]bool, error) {
+	if name == "" {
+		return nil, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", name, err)
+	}
+	defer f.Close()
+
+	blobs := make(map[digest.Digest]bool)
+	scanner := bufio.NewScanner(f)
+	var n int
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		d, err := digest.Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest %q in %q line %d: %w",
+				line, name, n, err)
+		}
+		blobs[d] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", name, err)
+	}
+	return blobs, nil
+}
@@ -0,0 +1,60 @@
+package hangar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LoadSkipBlobs(t *testing.T) {
+	layer := digest.Canonical.FromString("layer")
+	name := filepath.Join(t.TempDir(), "digests.txt")
+	err := os.WriteFile(name, []byte("# base image layers\n\n"+layer.String()+"\n"), 0644)
+	assert.Nil(t, err)
+	blobs, err := LoadSkipBlobs(name)
+	assert.Nil(t, err)
+	assert.Equal(t, map[digest.Digest]bool{layer: true}, blobs)
+
+	err = os.WriteFile(name, []byte("sha256:invalid\n"), 0644)
+	assert.Nil(t, err)
+	_, err = LoadSkipBlobs(name)
+	assert.NotNil(t, err)
+
+	blobs, err = LoadSkipBlobs("")
+	assert.Nil(t, err)
+	assert.Len(t, blobs, 0)
+}
+
+func Test_layerManager_skipped(t *testing.T) {
+	layer := digest.Canonical.FromString("layer")
+	config := digest.Canonical.FromString("config")
+	spec := &archive.ImageSpec{
+		Layers: []digest.Digest{layer},
+		Config: config,
+	}
+	m := &layerManager{
+		skipBlobs: map[digest.Digest]bool{layer: true, config: true},
+	}
+	assert.True(t, m.skipped(spec, layer))
+	// Only the image layers can be skipped.
+	assert.False(t, m.skipped(spec, config))
+}
+
+func Test_layerManager_streamed(t *testing.T) {
+	layer := digest.Canonical.FromString("layer")
+	config := digest.Canonical.FromString("config")
+	spec := &archive.ImageSpec{
+		Layers: []digest.Digest{layer},
+		Config: config,
+	}
+	m := &layerManager{
+		streamed: func(digest.Digest) bool { return true },
+	}
+	assert.True(t, m.skipped(spec, layer))
+	// The config is always decompressed.
+	assert.False(t, m.skipped(spec, config))
+}
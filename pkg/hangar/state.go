@@ -0,0 +1,115 @@
+package hangar
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/statedb"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// StateRecord is the last successful copy of the image.
+type StateRecord struct {
+	// Digest is the source manifest digest copied.
+	Digest digest.Digest `json:"digest"`
+	// Platforms is the OS and arch list of the job copied the image.
+	Platforms string    `json:"platforms,omitempty"`
+	RunID     string    `json:"runID,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// StateStore is the state DB recording the source manifest digests of the
+// images copied successfully, to skip the images not changed since the
+// last successful run without accessing the destination.
+type StateStore struct {
+	*statedb.Store[StateRecord]
+}
+
+const stateStoreVersion = 1
+
+// NewStateStore loads the state DB from the file path,
+// an empty state DB is created if the file does not exist.
+func NewStateStore(path string) (*StateStore, error) {
+	s, err := statedb.Open[StateRecord]("state DB", path, stateStoreVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &StateStore{Store: s}, nil
+}
+
+// Unchanged checks whether the image was copied successfully with the
+// same source digest and platforms by the last run.
+func (s *StateStore) Unchanged(key string, dgst digest.Digest, platforms string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	r, ok := s.Images[key]
+	return ok && dgst != "" && r.Digest == dgst && r.Platforms == platforms
+}
+
+// Record records the successful copy of the image.
+func (s *StateStore) Record(key string, dgst digest.Digest, platforms, runID string) {
+	if dgst == "" {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	s.Images[key] = &StateRecord{
+		Digest:    dgst,
+		Platforms: platforms,
+		RunID:     runID,
+		Time:      time.Now(),
+	}
+}
+
+// statePlatforms returns the OS and arch list of the job in sorted order,
+// the image copied with different platforms is considered changed.
+//
+//	Example:
+//		linux/amd64,arm64
+func (c *common) statePlatforms() string {
+	var osList, archList []string
+	for o := range c.imageSpecSet["os"] {
+		osList = append(osList, o)
+	}
+	for a := range c.imageSpecSet["arch"] {
+		archList = append(archList, a)
+	}
+	sort.Strings(osList)
+	sort.Strings(archList)
+	return strings.Join(osList, ",") + "/" + strings.Join(archList, ",")
+}
+
+// skipUnchanged checks whether the source digest of the image is not
+// changed since the last successful run if '--only-if-changed' enabled.
+func (c *common) skipUnchanged(key string, dgst digest.Digest) bool {
+	if !c.onlyIfChanged || c.stateStore == nil {
+		return false
+	}
+	if !c.stateStore.Unchanged(key, dgst, c.statePlatforms()) {
+		return false
+	}
+	c.unchanged.Add(1)
+	return true
+}
+
+// recordState records the source digest of the image copied successfully
+// into the state DB.
+func (c *common) recordState(key string, dgst digest.Digest) {
+	if c.stateStore == nil {
+		return
+	}
+	c.stateStore.Record(key, dgst, c.statePlatforms(), c.runID)
+}
+
+func (c *common) saveStateStore() {
+	if c.stateStore == nil {
+		return
+	}
+	if err := c.stateStore.Save(); err != nil {
+		logrus.Errorf("failed to save state DB: %v", err)
+	}
+}
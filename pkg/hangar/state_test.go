@@ -0,0 +1,62 @@
+package hangar
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := NewStateStore(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(s.Images))
+
+	d1 := digest.FromString("1")
+	d2 := digest.FromString("2")
+	image := "docker.io/library/nginx:latest"
+	assert.False(t, s.Unchanged(image, d1, "linux/amd64"))
+	s.Record(image, d1, "linux/amd64", "run-1")
+	s.Record("docker.io/library/busybox:latest", "", "linux/amd64", "run-1")
+	assert.Nil(t, s.Save())
+
+	s, err = NewStateStore(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(s.Images))
+	assert.Equal(t, "run-1", s.Images[image].RunID)
+	assert.True(t, s.Unchanged(image, d1, "linux/amd64"))
+	assert.False(t, s.Unchanged(image, d2, "linux/amd64"))
+	assert.False(t, s.Unchanged(image, d1, "linux/amd64,arm64"))
+	assert.False(t, s.Unchanged(image, "", "linux/amd64"))
+}
+
+func Test_SkipUnchanged(t *testing.T) {
+	s, err := NewStateStore(filepath.Join(t.TempDir(), "state.json"))
+	assert.Nil(t, err)
+	c := newTestCommon(t)
+	c.imageSpecSet = map[string]map[string]bool{
+		"os":   {"linux": true},
+		"arch": {"arm64": true, "amd64": true},
+	}
+	c.stateStore = s
+	c.runID = "run-1"
+	assert.Equal(t, "linux/amd64,arm64", c.statePlatforms())
+
+	d := digest.FromString("1")
+	key := "docker.io/library/nginx:latest"
+	c.recordState(key, d)
+	// Not skipped if '--only-if-changed' is not enabled.
+	assert.False(t, c.skipUnchanged(key, d))
+	c.onlyIfChanged = true
+	assert.True(t, c.skipUnchanged(key, d))
+	assert.False(t, c.skipUnchanged(key, digest.FromString("2")))
+	assert.Equal(t, int64(1), c.unchanged.Load())
+
+	// The state DB is optional.
+	c = newTestCommon(t)
+	c.onlyIfChanged = true
+	c.recordState(key, d)
+	assert.False(t, c.skipUnchanged(key, d))
+}
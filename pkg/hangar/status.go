@@ -0,0 +1,288 @@
+package hangar
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Status is the progress and failure state of the running job,
+// written into the status file in JSON format.
+type Status struct {
+	// Total is the total number of images.
+	Total int `json:"total"`
+	// Processed is the number of images finished (succeed or failed).
+	Processed int `json:"processed"`
+	// Percent is the percentage of processed images, or the percentage
+	// of processed bytes if the bytes to upload are known.
+	Percent float64 `json:"percent"`
+	// Bytes is the total size of the blobs to upload computed by the
+	// warm-up phase, 0 if unknown.
+	Bytes int64 `json:"bytes,omitempty"`
+	// BytesProcessed is the size of the blobs to upload of the
+	// processed images.
+	BytesProcessed int64 `json:"bytesProcessed,omitempty"`
+	// Current is the images being processed by workers.
+	Current []string `json:"current"`
+	// Failed is the failed images so far.
+	Failed []string `json:"failed"`
+	// Finished is true if the job is finished.
+	Finished   bool      `json:"finished"`
+	StartTime  time.Time `json:"startTime"`
+	UpdateTime time.Time `json:"updateTime"`
+}
+
+// statusInterval is the interval of writing the changed status into the
+// status file while the job is running.
+const statusInterval = time.Second
+
+// statusWriter writes the job status into the status file when the
+// status changed, the methods are no-op if the status writer is nil.
+// The status changed while the job is running is written periodically
+// instead of on every event, and the final status is always written when
+// the job finished.
+type statusWriter struct {
+	path    string
+	mu      sync.Mutex
+	status  Status
+	current map[string]int
+	failed  map[string]bool
+	// weights is the size of the blobs to upload of the images
+	weights map[string]int64
+	// dirty is true if the status changed since the last write
+	dirty bool
+	// stop stops the periodic writing, nil if the job is not running
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func newStatusWriter(path string) *statusWriter {
+	if path == "" {
+		return nil
+	}
+	return &statusWriter{
+		path:    path,
+		current: make(map[string]int),
+		failed:  make(map[string]bool),
+	}
+}
+
+// begin resets the status with the total number of images, the weights
+// of the images are kept.
+func (w *statusWriter) begin(total int) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status = Status{
+		Total:     total,
+		Bytes:     w.totalWeight(),
+		StartTime: time.Now(),
+	}
+	w.current = make(map[string]int)
+	w.failed = make(map[string]bool)
+	w.write()
+	if w.stop == nil {
+		w.stop = make(chan struct{})
+		w.stopped = make(chan struct{})
+		go w.run(w.stop, w.stopped)
+	}
+}
+
+// run writes the changed status periodically until stopped.
+func (w *statusWriter) run(stop, stopped chan struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.flush()
+		}
+	}
+}
+
+// flush writes the status if changed since the last write.
+func (w *statusWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dirty {
+		w.write()
+	}
+}
+
+// changed marks the status changed, the status is written immediately if
+// the job is not running, needs to hold the mutex.
+func (w *statusWriter) changed() {
+	if w.stop == nil {
+		w.write()
+		return
+	}
+	w.dirty = true
+}
+
+// setTotal updates the total number of images.
+func (w *statusWriter) setTotal(total int) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.Total = total
+	w.changed()
+}
+
+// setWeights sets the size of the blobs to upload of the images, so the
+// percentage is computed by the processed bytes.
+func (w *statusWriter) setWeights(weights map[string]int64) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.weights = weights
+	w.status.Bytes = w.totalWeight()
+	w.changed()
+}
+
+// totalWeight returns the total size of the blobs to upload, needs to
+// hold the mutex.
+func (w *statusWriter) totalWeight() int64 {
+	var total int64
+	for _, n := range w.weights {
+		total += n
+	}
+	return total
+}
+
+// processed counts the processed image, needs to hold the mutex.
+func (w *statusWriter) processed(name string) {
+	w.status.Processed++
+	w.status.BytesProcessed += w.weights[name]
+}
+
+// start records the image is being processed by worker.
+func (w *statusWriter) start(name string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.current[name]++
+	w.changed()
+}
+
+// done records the image processed by worker.
+func (w *statusWriter) done(name string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.current[name] > 1 {
+		w.current[name]--
+	} else {
+		delete(w.current, name)
+	}
+	w.processed(name)
+	w.changed()
+}
+
+// fail records the failed image, the image failed before sending to
+// worker is counted as processed.
+func (w *statusWriter) fail(name string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failed[name] {
+		return
+	}
+	w.failed[name] = true
+	if w.current[name] == 0 {
+		w.processed(name)
+	}
+	w.changed()
+}
+
+// finish marks the job finished, stops the periodic writing and writes
+// the final status.
+func (w *statusWriter) finish() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	stop, stopped := w.stop, w.stopped
+	w.stop, w.stopped = nil, nil
+	w.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-stopped
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.current = make(map[string]int)
+	w.status.Finished = true
+	w.write()
+}
+
+// write writes the status file atomically, needs to hold the mutex.
+func (w *statusWriter) write() {
+	w.dirty = false
+	s := w.status
+	s.UpdateTime = time.Now()
+	s.Current = make([]string, 0, len(w.current))
+	for name := range w.current {
+		s.Current = append(s.Current, name)
+	}
+	sort.Strings(s.Current)
+	s.Failed = make([]string, 0, len(w.failed))
+	for name := range w.failed {
+		s.Failed = append(s.Failed, name)
+	}
+	sort.Strings(s.Failed)
+	switch {
+	case s.Finished:
+		s.Percent = 100
+	case s.Bytes > 0:
+		s.Percent = float64(min(s.BytesProcessed, s.Bytes)) * 100 / float64(s.Bytes)
+	case s.Total > 0:
+		s.Percent = float64(min(s.Processed, s.Total)) * 100 / float64(s.Total)
+	}
+
+	if err := writeStatusFile(w.path, &s); err != nil {
+		logrus.Warnf("failed to write status file: %v", err)
+	}
+}
+
+func writeStatusFile(path string, s *Status) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".status-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// Rename the temp file to make the update atomic for the readers.
+	return os.Rename(tmp.Name(), path)
+}
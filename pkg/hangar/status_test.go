@@ -0,0 +1,91 @@
+package hangar
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readStatus(t *testing.T, path string) Status {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	var s Status
+	assert.Nil(t, json.Unmarshal(b, &s))
+	return s
+}
+
+func Test_statusWriter(t *testing.T) {
+	var w *statusWriter
+	// Nil status writer should be no-op.
+	w.begin(1)
+	w.fail("a")
+	assert.Nil(t, newStatusWriter(""))
+
+	path := filepath.Join(t.TempDir(), "status.json")
+	w = newStatusWriter(path)
+	w.begin(4)
+	s := readStatus(t, path)
+	assert.Equal(t, 4, s.Total)
+	assert.Equal(t, 0, s.Processed)
+
+	// Failed before sending to worker.
+	w.fail("a")
+	w.start("b")
+	w.start("c")
+	// The status changed is written periodically.
+	s = readStatus(t, path)
+	assert.Equal(t, 0, s.Processed)
+	w.flush()
+	s = readStatus(t, path)
+	assert.Equal(t, 1, s.Processed)
+	assert.Equal(t, []string{"b", "c"}, s.Current)
+	assert.Equal(t, []string{"a"}, s.Failed)
+	assert.Equal(t, float64(25), s.Percent)
+
+	// Failed in worker.
+	w.fail("b")
+	w.done("b")
+	w.done("c")
+	w.flush()
+	s = readStatus(t, path)
+	assert.Equal(t, 3, s.Processed)
+	assert.Empty(t, s.Current)
+	assert.Equal(t, []string{"a", "b"}, s.Failed)
+	assert.Equal(t, float64(75), s.Percent)
+	assert.False(t, s.Finished)
+
+	w.finish()
+	s = readStatus(t, path)
+	assert.True(t, s.Finished)
+	assert.Equal(t, float64(100), s.Percent)
+}
+
+func Test_statusWriter_setWeights(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.json")
+	w := newStatusWriter(path)
+	w.setWeights(map[string]int64{"a": 100, "b": 300})
+	w.begin(3)
+	s := readStatus(t, path)
+	assert.Equal(t, int64(400), s.Bytes)
+
+	w.start("a")
+	w.done("a")
+	w.flush()
+	s = readStatus(t, path)
+	assert.Equal(t, int64(100), s.BytesProcessed)
+	assert.Equal(t, float64(25), s.Percent)
+
+	// The image without blobs to upload.
+	w.fail("c")
+	w.start("b")
+	w.done("b")
+	w.flush()
+	s = readStatus(t, path)
+	assert.Equal(t, 3, s.Processed)
+	assert.Equal(t, float64(100), s.Percent)
+	w.finish()
+}
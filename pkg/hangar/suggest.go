@@ -0,0 +1,157 @@
+package hangar
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/extension"
+	"github.com/cnrancher/hangar/pkg/source"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// maxSuggestions is the max number of the corrections suggested for each
+// image.
+const maxSuggestions = 3
+
+// platformSuffixes is the platform suffixes of the tags ignored when
+// matching the near-miss tags.
+var platformSuffixes = []string{
+	"-amd64", "-arm64", "-arm", "-s390x", "-ppc64le", "-riscv64",
+}
+
+// ImageSuggestion is the corrections suggested for the image not found
+// in the source registry, most of the not found images are the typos of
+// the image list.
+type ImageSuggestion struct {
+	// Image is the image list line.
+	Image string `json:"image"`
+	// Suggestions is the near-miss images exist in the source registry.
+	Suggestions []string `json:"suggestions"`
+}
+
+// isImageUnknown checks whether the error of reading the source image
+// is reported by the registry as the manifest or repository unknown.
+func isImageUnknown(err error) bool {
+	if err == nil {
+		return false
+	}
+	return utils.IsManifestUnknown(err) ||
+		strings.Contains(strings.ToLower(err.Error()), "name unknown")
+}
+
+// isNotFound checks whether the error of reading the source image may be
+// the image not found error. Some registries (Docker Hub) report the
+// repository not exist as access denied, which may also be the
+// credential error, so it is only used for suggesting the corrections.
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	return isImageUnknown(err) ||
+		strings.Contains(strings.ToLower(err.Error()),
+			"requested access to the resource is denied")
+}
+
+// nearRepositories returns the near-miss repositories of the repository,
+// the lower case name and the name with/without the 'library/' project.
+func nearRepositories(project, name string) []string {
+	repository := project + "/" + name
+	var repos []string
+	if lower := strings.ToLower(repository); lower != repository {
+		repos = append(repos, lower)
+	}
+	if project == "library" {
+		repos = append(repos, name)
+	} else {
+		repos = append(repos, "library/"+name)
+	}
+	return repos
+}
+
+// nearTag normalizes the tag for matching the near-miss tags, the case,
+// the 'v' prefix and the platform suffix of the tag are ignored.
+//
+//	Example:
+//		V1.25-amd64 => 1.25
+func nearTag(tag string) string {
+	t := strings.ToLower(tag)
+	for _, s := range platformSuffixes {
+		if strings.HasSuffix(t, s) {
+			t = strings.TrimSuffix(t, s)
+			break
+		}
+	}
+	return strings.TrimPrefix(t, "v")
+}
+
+// nearTags returns the tags matching the near-misses of the tag.
+func nearTags(tag string, tags []string) []string {
+	var near []string
+	key := nearTag(tag)
+	for _, t := range tags {
+		if t != tag && nearTag(t) == key {
+			near = append(near, t)
+		}
+	}
+	// Prefer the tags differing only in case.
+	sort.SliceStable(near, func(i, j int) bool {
+		return strings.EqualFold(near[i], tag) && !strings.EqualFold(near[j], tag)
+	})
+	return near
+}
+
+// suggestSource suggests the corrections of the source image if the
+// source image is not found.
+func (c *common) suggestSource(ctx context.Context, line string, src *source.Source, err error) {
+	if !isNotFound(err) || ctx.Err() != nil || src.Tag() == "" {
+		return
+	}
+	c.suggest(ctx, line, src.Registry(), src.Project(), src.Name(), src.Tag())
+}
+
+// suggest queries the source registry for the near-miss repositories and
+// tags of the image not found, the suggested corrections are recorded
+// into the summary.
+func (c *common) suggest(ctx context.Context, line, registry, project, name, tag string) {
+	client := extension.NewClient(c.systemContext, registry)
+	var suggestions []string
+	for i, repo := range append([]string{project + "/" + name}, nearRepositories(project, name)...) {
+		tags, err := client.ListTags(ctx, repo, 0)
+		if err != nil {
+			// The repository does not exist.
+			logrus.Debugf("suggest: %v", err)
+			continue
+		}
+		if i > 0 {
+			for _, t := range tags {
+				if t == tag {
+					suggestions = append(suggestions, fmt.Sprintf("%s/%s:%s", registry, repo, t))
+					break
+				}
+			}
+		}
+		for _, t := range nearTags(tag, tags) {
+			suggestions = append(suggestions, fmt.Sprintf("%s/%s:%s", registry, repo, t))
+		}
+		if len(suggestions) >= maxSuggestions {
+			break
+		}
+	}
+	if len(suggestions) == 0 {
+		return
+	}
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	logrus.Warnf("Image [%v] not found, did you mean: %v",
+		line, strings.Join(suggestions, ", "))
+	c.suggestionsMutex.Lock()
+	c.suggestions = append(c.suggestions, ImageSuggestion{
+		Image:       line,
+		Suggestions: suggestions,
+	})
+	c.suggestionsMutex.Unlock()
+}
@@ -0,0 +1,42 @@
+package hangar
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_isNotFound(t *testing.T) {
+	assert.False(t, isNotFound(nil))
+	assert.True(t, isNotFound(errors.New("reading manifest 1.25 in docker.io/library/nginx: manifest unknown")))
+	assert.True(t, isNotFound(errors.New("name unknown: repository name not known to registry")))
+	assert.True(t, isNotFound(errors.New("requested access to the resource is denied")))
+	assert.False(t, isNotFound(errors.New("connection refused")))
+
+	assert.True(t, isImageUnknown(errors.New("name unknown: repository name not known to registry")))
+	assert.False(t, isImageUnknown(errors.New("requested access to the resource is denied")))
+}
+
+func Test_nearRepositories(t *testing.T) {
+	assert.Equal(t, []string{"library/nginx"}, nearRepositories("rancher", "nginx"))
+	assert.Equal(t, []string{"nginx"}, nearRepositories("library", "nginx"))
+	assert.Equal(t, []string{"rancher/nginx", "library/Nginx"},
+		nearRepositories("Rancher", "Nginx"))
+}
+
+func Test_nearTag(t *testing.T) {
+	assert.Equal(t, "1.25", nearTag("1.25"))
+	assert.Equal(t, "1.25", nearTag("V1.25"))
+	assert.Equal(t, "1.25", nearTag("v1.25-amd64"))
+	assert.Equal(t, "1.25", nearTag("1.25-arm64"))
+	assert.Equal(t, "latest", nearTag("Latest"))
+}
+
+func Test_nearTags(t *testing.T) {
+	tags := []string{"1.24", "v1.25", "1.25-amd64", "V1.25", "1.26"}
+	assert.Equal(t, []string{"V1.25", "1.25-amd64"}, nearTags("v1.25", tags))
+	assert.Equal(t, []string{"v1.25", "1.25-amd64", "V1.25"}, nearTags("1.25", tags))
+	assert.Equal(t, []string{"1.25-amd64", "v1.25", "V1.25"}, nearTags("1.25-AMD64", tags))
+	assert.Nil(t, nearTags("2.0", tags))
+}
@@ -0,0 +1,305 @@
+package hangar
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/cnrancher/hangar/pkg/logger"
+	"github.com/cnrancher/hangar/pkg/source"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// Summary is the result summary of the finished job.
+type Summary struct {
+	// Total is the total number of images.
+	Total int `json:"total"`
+	// Succeeded is the number of images copied/validated successfully.
+	Succeeded int `json:"succeeded"`
+	// Failed is the number of failed images.
+	Failed int `json:"failed"`
+	// FailedImages is the sorted failed image list.
+	FailedImages []string `json:"failedImages,omitempty"`
+	// Images is the image list of the job.
+	Images    []string      `json:"images,omitempty"`
+	StartTime time.Time     `json:"startTime"`
+	Duration  time.Duration `json:"duration"`
+	// Timings is the duration of the images in descending order.
+	Timings []*ImageTiming `json:"timings,omitempty"`
+	// ExcludedAttestations is the number of the attestation manifests
+	// excluded from the copied images.
+	ExcludedAttestations int `json:"excludedAttestations,omitempty"`
+	// ContentStoreBlobs and ContentStoreBytes are the number and the total
+	// size of the blobs read from the local containerd content store.
+	ContentStoreBlobs int64 `json:"contentStoreBlobs,omitempty"`
+	ContentStoreBytes int64 `json:"contentStoreBytes,omitempty"`
+	// RunID is the unique ID of the job.
+	RunID string `json:"runID,omitempty"`
+	// DigestDrifts is the images whose manifest was rewritten by the
+	// destination registry on push.
+	DigestDrifts []DigestDrift `json:"digestDrifts,omitempty"`
+	// BudgetSkipped is the number of non-critical images skipped after
+	// the time budget exceeded.
+	BudgetSkipped int `json:"budgetSkipped,omitempty"`
+	// Suggestions is the corrections suggested for the images not found
+	// in the source registry.
+	Suggestions []ImageSuggestion `json:"suggestions,omitempty"`
+	// SkippedOptional is the optional images skipped since they are
+	// absent or have no image of the specified platforms.
+	SkippedOptional []SkippedOptional `json:"skippedOptional,omitempty"`
+	// Unchanged is the number of images skipped since the source digest
+	// is not changed since the last successful run.
+	Unchanged int `json:"unchanged,omitempty"`
+	// CopiedImages is the platforms and layers of the copied images,
+	// map[SOURCE]image.
+	CopiedImages map[string]*archive.Image `json:"-"`
+	// Errors is the error messages of the job.
+	Errors []string `json:"-"`
+	// ImageList is the git repository and the commit of the image list
+	// hosted in git.
+	ImageList *ImageListSource `json:"imageList,omitempty"`
+	// PlatformMismatches is the images whose config OS/architecture does
+	// not match the platform of the manifest index entry.
+	PlatformMismatches []PlatformMismatch `json:"platformMismatches,omitempty"`
+	// DeprecatedImages is the compliance section of the images still
+	// published as Docker schema1 or with deprecated layer media types.
+	DeprecatedImages []DeprecatedImage `json:"deprecatedImages,omitempty"`
+	// ImageLists is the results of the image list files when multiple
+	// image list files are processed in one run.
+	ImageLists []*ImageListResult `json:"imageLists,omitempty"`
+	// Origins is the image list files of the image list lines,
+	// map[LINE][]FILE
+	Origins map[string][]string `json:"origins,omitempty"`
+}
+
+// ImageListResult is the result of the images of an image list file.
+type ImageListResult struct {
+	// Name is the image list file name.
+	Name   string `json:"name"`
+	Total  int    `json:"total"`
+	Failed int    `json:"failed"`
+	// FailedImages is the failed images of the image list file.
+	FailedImages []string `json:"failedImages,omitempty"`
+}
+
+// imageListResults returns the results of the image list files, the image
+// in multiple image list files is counted into each of them.
+func imageListResults(origins map[string][]string, failed []string) []*ImageListResult {
+	if len(origins) == 0 {
+		return nil
+	}
+	failedSet := make(map[string]bool, len(failed))
+	for _, f := range failed {
+		failedSet[f] = true
+	}
+	results := map[string]*ImageListResult{}
+	for line, names := range origins {
+		for _, name := range names {
+			r := results[name]
+			if r == nil {
+				r = &ImageListResult{Name: name}
+				results[name] = r
+			}
+			r.Total++
+			if failedSet[line] {
+				r.Failed++
+				r.FailedImages = append(r.FailedImages, line)
+			}
+		}
+	}
+	list := make([]*ImageListResult, 0, len(results))
+	for _, r := range results {
+		sort.Strings(r.FailedImages)
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// recordCopiedImage records the platforms and layers of the copied image.
+func (c *common) recordCopiedImage(name string, image *archive.Image) {
+	if image == nil || len(image.Images) == 0 {
+		return
+	}
+	c.copiedImagesMutex.Lock()
+	c.copiedImages[name] = image
+	c.copiedImagesMutex.Unlock()
+}
+
+// DigestDrift is the manifest digest changed by the destination registry
+// on push (e.g. older Harbor and Nexus rewrite the manifests).
+type DigestDrift struct {
+	// Image is the destination image reference name.
+	Image             string        `json:"image"`
+	SourceDigest      digest.Digest `json:"sourceDigest"`
+	DestinationDigest digest.Digest `json:"destinationDigest"`
+}
+
+// DeprecatedImage is the image published with the deprecated manifest
+// media type (Docker schema1) or layer media type.
+type DeprecatedImage struct {
+	// Image is the source image reference name.
+	Image    string `json:"image"`
+	Platform string `json:"platform"`
+	// MediaType is the deprecated media type of the source image.
+	MediaType string `json:"mediaType"`
+	// ConvertedTo is the media type converted by hangar, same as the
+	// MediaType if kept as-is.
+	ConvertedTo string `json:"convertedTo"`
+}
+
+// setTotal updates the total number of images if the images to be
+// processed are not the image list (e.g. load all images in archive).
+func (c *common) setTotal(total int) {
+	c.total = total
+	c.batchSize = resolveBatchSize(c.batchSizeOpt, total)
+	c.status.setTotal(total)
+	logrus.Infof("Images: %d", total)
+}
+
+// recordExcludedAttestations records the number of the attestation
+// manifests excluded from the copied image.
+func (c *common) recordExcludedAttestations(n int) {
+	if n > 0 {
+		c.excludedAttestations.Add(int64(n))
+	}
+}
+
+// destinationDigests returns the digest set of the destination images for
+// validating the source digests, the source digests of the manifests
+// rewritten by the destination registry are included.
+func destinationDigests(images []archive.ImageSpec) map[digest.Digest]bool {
+	set := make(map[digest.Digest]bool, len(images))
+	for _, img := range images {
+		set[img.Digest] = true
+		if img.SourceDigest != "" {
+			set[img.SourceDigest] = true
+		}
+	}
+	return set
+}
+
+// recordDigestDrifts logs and records the map[source digest]destination
+// digest of the image rewritten by the destination registry.
+func (c *common) recordDigestDrifts(
+	ctx context.Context, id int, image string, drifts map[digest.Digest]digest.Digest,
+) {
+	if len(drifts) == 0 {
+		return
+	}
+	c.digestDriftsMutex.Lock()
+	for s, d := range drifts {
+		logger.FromContext(ctx).WithField(logger.ImageField, id).
+			Warnf("Manifest [%v@%v] was rewritten by the destination registry: [%v]",
+				image, s, d)
+		c.digestDrifts = append(c.digestDrifts, DigestDrift{
+			Image:             image,
+			SourceDigest:      s,
+			DestinationDigest: d,
+		})
+	}
+	c.digestDriftsMutex.Unlock()
+}
+
+// recordDeprecated records the deprecated media types found in the
+// copied image.
+func (c *common) recordDeprecated(image string, deprecated []source.DeprecatedMediaType) {
+	if len(deprecated) == 0 {
+		return
+	}
+	c.deprecatedImagesMutex.Lock()
+	for _, d := range deprecated {
+		c.deprecatedImages = append(c.deprecatedImages, DeprecatedImage{
+			Image:       image,
+			Platform:    d.Platform,
+			MediaType:   d.MediaType,
+			ConvertedTo: d.ConvertedTo,
+		})
+	}
+	c.deprecatedImagesMutex.Unlock()
+}
+
+// Summary returns the result summary of the job,
+// should be called after the job finished.
+func (c *common) Summary() *Summary {
+	c.failedImageListMutex.RLock()
+	failed := make([]string, 0, len(c.failedImageSet))
+	for i := range c.failedImageSet {
+		failed = append(failed, i)
+	}
+	c.failedImageListMutex.RUnlock()
+	sort.Strings(failed)
+
+	s := &Summary{
+		Total:        c.total,
+		Failed:       len(failed),
+		FailedImages: failed,
+		Images:       append([]string{}, c.images...),
+		StartTime:    c.startTime,
+		Timings:      c.timings.sorted(),
+
+		ExcludedAttestations: int(c.excludedAttestations.Load()),
+		RunID:                c.runID,
+		BudgetSkipped:        int(c.budgetSkipped.Load()),
+		Unchanged:            int(c.unchanged.Load()),
+		ImageList:            c.imageListSource,
+		ImageLists:           imageListResults(c.imageListOrigins, failed),
+		Origins:              c.imageListOrigins,
+	}
+	s.ContentStoreBlobs, s.ContentStoreBytes = c.contentStore.Hits()
+	c.digestDriftsMutex.Lock()
+	s.DigestDrifts = append(s.DigestDrifts, c.digestDrifts...)
+	c.digestDriftsMutex.Unlock()
+	sort.Slice(s.DigestDrifts, func(i, j int) bool {
+		if s.DigestDrifts[i].Image != s.DigestDrifts[j].Image {
+			return s.DigestDrifts[i].Image < s.DigestDrifts[j].Image
+		}
+		return s.DigestDrifts[i].SourceDigest < s.DigestDrifts[j].SourceDigest
+	})
+	c.suggestionsMutex.Lock()
+	s.Suggestions = append(s.Suggestions, c.suggestions...)
+	c.suggestionsMutex.Unlock()
+	sort.Slice(s.Suggestions, func(i, j int) bool {
+		return s.Suggestions[i].Image < s.Suggestions[j].Image
+	})
+	s.SkippedOptional = c.skippedOptionalImages()
+	c.copiedImagesMutex.Lock()
+	s.CopiedImages = make(map[string]*archive.Image, len(c.copiedImages))
+	for name, image := range c.copiedImages {
+		s.CopiedImages[name] = image
+	}
+	c.copiedImagesMutex.Unlock()
+	c.errorMessagesMutex.Lock()
+	s.Errors = append(s.Errors, c.errorMessages...)
+	c.errorMessagesMutex.Unlock()
+	c.platformMismatchesMutex.Lock()
+	s.PlatformMismatches = append(s.PlatformMismatches, c.platformMismatches...)
+	c.platformMismatchesMutex.Unlock()
+	sort.Slice(s.PlatformMismatches, func(i, j int) bool {
+		return s.PlatformMismatches[i].Image < s.PlatformMismatches[j].Image
+	})
+	c.deprecatedImagesMutex.Lock()
+	s.DeprecatedImages = append(s.DeprecatedImages, c.deprecatedImages...)
+	c.deprecatedImagesMutex.Unlock()
+	sort.SliceStable(s.DeprecatedImages, func(i, j int) bool {
+		if s.DeprecatedImages[i].Image != s.DeprecatedImages[j].Image {
+			return s.DeprecatedImages[i].Image < s.DeprecatedImages[j].Image
+		}
+		return s.DeprecatedImages[i].Platform < s.DeprecatedImages[j].Platform
+	})
+	if s.Total < s.Failed+len(s.SkippedOptional) {
+		s.Total = s.Failed + len(s.SkippedOptional)
+	}
+	s.Succeeded = s.Total - s.Failed - len(s.SkippedOptional)
+	if !c.startTime.IsZero() {
+		s.Duration = c.endTime.Sub(c.startTime)
+		if c.endTime.IsZero() {
+			s.Duration = time.Since(c.startTime)
+		}
+	}
+	return s
+}
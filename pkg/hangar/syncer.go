@@ -13,6 +13,7 @@ import (
 	"github.com/cnrancher/hangar/pkg/destination"
 	"github.com/cnrancher/hangar/pkg/hangar/archive"
 	"github.com/cnrancher/hangar/pkg/hangar/imagelist"
+	"github.com/cnrancher/hangar/pkg/logger"
 	"github.com/cnrancher/hangar/pkg/source"
 	"github.com/cnrancher/hangar/pkg/types"
 	"github.com/cnrancher/hangar/pkg/utils"
@@ -46,6 +47,11 @@ type Syncer struct {
 	SharedBlobDirPath string
 	// ArchiveName is the saved archive file name
 	ArchiveName string
+	// CopySignatures saves the signatures of the images into the archive.
+	CopySignatures bool
+	// CopyAttestations saves the attestations and SBOMs of the images
+	// into the archive.
+	CopyAttestations bool
 }
 
 type SyncerOpts struct {
@@ -59,6 +65,17 @@ type SyncerOpts struct {
 	SharedBlobDirPath string
 	// ArchiveName is the saved archive file name
 	ArchiveName string
+	// Resume writes the images appended into the archive into the
+	// checkpoint periodically, and skips the images completed by the
+	// interrupted job.
+	Resume bool
+	// CopySignatures saves the cosign signatures and the signature
+	// referrers (by the OCI referrers API or the referrers tag schema)
+	// of the images into the archive.
+	CopySignatures bool
+	// CopyAttestations saves the cosign attestations, SBOMs and the
+	// attestation referrers of the images into the archive.
+	CopyAttestations bool
 }
 
 func NewSyncer(o *SyncerOpts) (*Syncer, error) {
@@ -71,6 +88,8 @@ func NewSyncer(o *SyncerOpts) (*Syncer, error) {
 		SourceProject:     o.SourceProject,
 		SharedBlobDirPath: o.SharedBlobDirPath,
 		ArchiveName:       o.ArchiveName,
+		CopySignatures:    o.CopySignatures,
+		CopyAttestations:  o.CopyAttestations,
 	}
 	if s.SharedBlobDirPath == "" {
 		s.SharedBlobDirPath = archive.SharedBlobDir
@@ -80,45 +99,50 @@ func NewSyncer(o *SyncerOpts) (*Syncer, error) {
 	if err != nil {
 		return nil, err
 	}
+	if o.Resume {
+		s.common.checkpoint, err = NewCheckpoint(ResumeDir(s.ArchiveName))
+		if err != nil {
+			return nil, err
+		}
+		if n := len(s.common.checkpoint.Images); n > 0 {
+			logrus.Infof("Resume the interrupted job: %d images completed", n)
+		}
+	}
 	return s, nil
 }
 
 func (s *Syncer) copy(ctx context.Context) {
+	stopCheckpoint := s.checkpoint.autoSave(ctx)
 	s.common.initErrorHandler(ctx)
+	s.common.flushIndex = s.flushPartialIndex
 	s.common.initWorker(ctx, s.worker)
 	for i, img := range s.common.images {
 		switch imagelist.Detect(img) {
-		case imagelist.TypeDefault:
+		case imagelist.TypeDefault, imagelist.TypePair, imagelist.TypeDockerArchive:
 		default:
 			logrus.Warnf("Ignore image list line %q: invalid format", img)
 			continue
 		}
+		if s.skipByBudget(img) {
+			continue
+		}
+		if s.resumed(img) {
+			logrus.Infof("Skip syncing [%v]: completed by the interrupted job", img)
+			continue
+		}
 		object := &syncObject{
 			id:    i + 1,
 			image: img,
 		}
-		sourceRegistry := utils.GetRegistryName(img)
-		if s.SourceRegistry != "" {
-			sourceRegistry = s.SourceRegistry
-		}
-		sourceProject := utils.GetProjectName(img)
-		if s.SourceProject != "" {
-			sourceProject = s.SourceProject
-		}
-		src, err := source.NewSource(&source.Option{
-			Type:          types.TypeDocker,
-			Registry:      sourceRegistry,
-			Project:       sourceProject,
-			Name:          utils.GetImageName(img),
-			Tag:           utils.GetImageTag(img),
-			SystemContext: s.systemContext,
-		})
+		src, ref, err := newImageListSource(
+			img, s.SourceRegistry, s.SourceProject, s.systemContext)
 		if err != nil {
 			s.handleError(fmt.Errorf("failed to init source image: %w", err))
 			s.recordFailedImage(img)
 			continue
 		}
 		object.source = src
+		s.configureSource(src)
 
 		cd, err := s.newSaveCacheDir()
 		if err != nil {
@@ -130,8 +154,8 @@ func (s *Syncer) copy(ctx context.Context) {
 		dest, err := destination.NewDestination(&destination.Option{
 			Type:      types.TypeOci,
 			Directory: cd,
-			Name:      utils.GetImageName(img),
-			Tag:       utils.GetImageTag(img),
+			Name:      utils.GetImageName(ref),
+			Tag:       utils.GetImageTag(ref),
 			SystemContext: utils.SystemContextWithSharedBlobDir(
 				s.systemContext, sd),
 		})
@@ -147,12 +171,47 @@ func (s *Syncer) copy(ctx context.Context) {
 		}
 	}
 	s.waitWorkers()
+	stopCheckpoint()
 	if err := s.updateIndex(); err != nil {
 		logrus.Errorf("failed to write index file: %v", err)
+	} else if s.batchSize > 0 {
+		// The archive is completed, remove the partial index file.
+		os.Remove(archive.PartialIndexName(s.ArchiveName))
 	}
 	if err := s.au.Close(); err != nil {
 		logrus.Errorf("failed to close archive updater: %v", err)
+		return
+	}
+	// The archive is changed, update the checksum file.
+	if err := archive.WriteChecksum(s.ArchiveName); err != nil {
+		logrus.Errorf("failed to write checksum of %q: %v", s.ArchiveName, err)
 	}
+	s.finishCheckpoint(ctx)
+}
+
+// resumed checks whether the image was appended into the archive by the
+// interrupted job.
+func (s *Syncer) resumed(image string) bool {
+	c := s.checkpoint.Completed(image)
+	if c == nil {
+		return false
+	}
+	s.auMutex.RLock()
+	defer s.auMutex.RUnlock()
+	for _, i := range s.index.List {
+		if i.Source == c.Image.Source && i.Tag == c.Image.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// flushPartialIndex writes the index of the images written into the
+// archive so far beside the archive file.
+func (s *Syncer) flushPartialIndex() error {
+	s.auMutex.RLock()
+	defer s.auMutex.RUnlock()
+	return archive.WritePartialIndex(s.ArchiveName, s.index)
 }
 
 func (s *Syncer) newSaveCacheDir() (string, error) {
@@ -180,7 +239,11 @@ func (s *Syncer) Run(ctx context.Context) error {
 	s.index = au.Index()
 	// Init layerSet.
 	for _, images := range s.index.List {
-		for _, spec := range images.Images {
+		specs := append([]archive.ImageSpec{}, images.Images...)
+		for _, a := range images.Artifacts {
+			specs = append(specs, a.ImageSpec)
+		}
+		for _, spec := range specs {
 			for _, layer := range spec.Layers {
 				s.layersSet[layer] = true
 			}
@@ -198,7 +261,7 @@ func (s *Syncer) Run(ctx context.Context) error {
 			v = append(v, i)
 		}
 		logrus.Errorf("Sync failed image list: \n%v", strings.Join(v, "\n"))
-		return ErrCopyFailed
+		return s.failedError(ErrCopyFailed)
 	}
 	return nil
 }
@@ -224,7 +287,7 @@ func (s *Syncer) worker(ctx context.Context, o any) {
 		copyContext, cancel = context.WithCancel(ctx)
 	}
 	defer func() {
-		if err != nil {
+		if err != nil && !s.skipOptional(obj.image, err) {
 			s.handleError(NewError(obj.id, err, obj.source, obj.destination))
 			s.recordFailedImage(obj.image)
 		}
@@ -235,25 +298,38 @@ func (s *Syncer) worker(ctx context.Context, o any) {
 				obj.destination.Directory(), err)
 		}
 	}()
+	record, err := s.waitBreaker(ctx, obj.source.Registry())
+	if err != nil {
+		return
+	}
+	defer record(&err)
+	timer := newImageTimer(obj.image)
+	defer s.timings.record(timer)
 
+	timer.begin(PhaseInspect)
 	err = obj.source.Init(copyContext)
 	if err != nil {
 		err = fmt.Errorf("failed to init source: %w", err)
 		return
 	}
-	logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+	if err = s.verifySource(obj.source); err != nil {
+		return
+	}
+	logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 		Infof("Syncing [%v]", obj.source.ReferenceNameWithoutTransport())
 	err = obj.destination.Init(copyContext)
 	if err != nil {
 		err = fmt.Errorf("failed to init destination: %w", err)
 		return
 	}
+	timer.begin(PhasePull)
 	err = obj.source.Copy(copyContext, obj.destination, s.imageSpecSet, s.policy)
 	if err != nil {
 		if errors.Is(err, utils.ErrNoAvailableImage) {
-			logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+			logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 				Warnf("Skip copy image [%v]: %v",
 					obj.source.ReferenceNameWithoutTransport(), err)
+			s.skipOptional(obj.image, err)
 			err = nil
 		} else {
 			err = fmt.Errorf("failed to copy [%v] to [%v]: %w",
@@ -261,20 +337,43 @@ func (s *Syncer) worker(ctx context.Context, o any) {
 			return
 		}
 	}
+	s.recordExcludedAttestations(obj.source.ExcludedAttestations())
+	s.recordDeprecated(obj.source.ReferenceNameWithoutTransport(), obj.source.DeprecatedMediaTypes())
+	var artifacts []archive.Artifact
+	if s.CopySignatures || s.CopyAttestations {
+		artifacts, err = obj.source.SaveArtifacts(copyContext, obj.destination,
+			s.CopySignatures, s.CopyAttestations, s.policy)
+		if err != nil {
+			return
+		}
+		if len(artifacts) > 0 {
+			logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
+				Infof("Saved %d signatures & attestations of [%v]",
+					len(artifacts), obj.source.ReferenceNameWithoutTransport())
+		}
+	}
 
 	// Images copied to cache folder, write to archive file.
+	timer.begin(PhaseArchive)
 	s.auMutex.Lock()
 	defer s.auMutex.Unlock()
 
-	logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+	logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 		Debugf("Compressing [%v]", obj.destination.ReferenceNameWithoutTransport())
 
 	destDir := obj.destination.ReferenceNameWithoutTransport()
 	copiedImage := obj.source.GetCopiedImage()
+	s.recordCopiedImage(obj.source.ReferenceNameWithoutTransport(), copiedImage)
+	renamePairImage(obj.image, copiedImage)
+	copiedImage.Artifacts = artifacts
+	specs := append([]archive.ImageSpec{}, copiedImage.Images...)
+	for _, a := range artifacts {
+		specs = append(specs, a.ImageSpec)
+	}
 	imageBlobs := map[digest.Digest]bool{}
 	filesToDelete := map[string]bool{}
 	// Record image layers and remove duplicated layers from shared blob dir.
-	for _, image := range copiedImage.Images {
+	for _, image := range specs {
 		for _, layer := range image.Layers {
 			imageBlobs[layer] = true
 		}
@@ -315,6 +414,7 @@ func (s *Syncer) worker(ctx context.Context, o any) {
 		return
 	}
 	s.index.Append(copiedImage)
+	s.checkpoint.Record(obj.image, obj.source.Digest(), copiedImage)
 }
 
 func (s *Syncer) Validate(ctx context.Context) error {
@@ -340,17 +440,35 @@ func (s *Syncer) Validate(ctx context.Context) error {
 			v = append(v, i)
 		}
 		logrus.Errorf("Validate failed image list: \n%v", strings.Join(v, "\n"))
-		return ErrValidateFailed
+		return s.failedError(ErrValidateFailed)
 	}
 	return nil
 }
 
+// DetectChanges compares the archive index with the image list without
+// copying images, returns the images need to be synced into the archive.
+func (s *Syncer) DetectChanges(ctx context.Context) ([]Change, error) {
+	s.detectChanges = true
+	if err := s.Validate(ctx); err != nil {
+		return nil, err
+	}
+	return s.Changes(), nil
+}
+
+// DryRun resolves the source manifests of the image list and the platform
+// images would be synced into the archive without copying images.
+func (s *Syncer) DryRun(ctx context.Context) (*Plan, error) {
+	return s.dryRun(ctx, func() {
+		s.planImageList(s.SourceRegistry, s.SourceProject, s.ArchiveName)
+	})
+}
+
 func (s *Syncer) validate(ctx context.Context) {
 	s.common.initErrorHandler(ctx)
 	s.common.initWorker(ctx, s.validateWorker)
 	for i, img := range s.common.images {
 		switch imagelist.Detect(img) {
-		case imagelist.TypeDefault:
+		case imagelist.TypeDefault, imagelist.TypePair, imagelist.TypeDockerArchive:
 		default:
 			logrus.Warnf("Ignore image list line %q: invalid format", img)
 			continue
@@ -359,22 +477,8 @@ func (s *Syncer) validate(ctx context.Context) {
 			id:    i + 1,
 			image: img,
 		}
-		sourceRegistry := utils.GetRegistryName(img)
-		if s.SourceRegistry != "" {
-			sourceRegistry = s.SourceRegistry
-		}
-		sourceProject := utils.GetProjectName(img)
-		if s.SourceProject != "" {
-			sourceProject = s.SourceProject
-		}
-		src, err := source.NewSource(&source.Option{
-			Type:          types.TypeDocker,
-			Registry:      sourceRegistry,
-			Project:       sourceProject,
-			Name:          utils.GetImageName(img),
-			Tag:           utils.GetImageTag(img),
-			SystemContext: s.systemContext,
-		})
+		src, _, err := newImageListSource(
+			img, s.SourceRegistry, s.SourceProject, s.systemContext)
 		if err != nil {
 			s.handleError(fmt.Errorf("failed to init source image: %w", err))
 			s.recordFailedImage(img)
@@ -410,6 +514,12 @@ func (s *Syncer) validateWorker(ctx context.Context, o any) {
 	defer func() {
 		cancel()
 		if err != nil {
+			if s.skipOptional(obj.image, err) {
+				return
+			}
+			if s.recordChange(err, obj.image, s.ArchiveName) {
+				return
+			}
 			s.handleError(NewError(obj.id, err, nil, nil))
 			s.recordFailedImage(obj.image)
 		}
@@ -417,14 +527,17 @@ func (s *Syncer) validateWorker(ctx context.Context, o any) {
 
 	err = obj.source.Init(validateContext)
 	if err != nil {
+		s.suggestSource(validateContext, obj.image, obj.source, err)
 		return
 	}
 	var fail bool
-	switch obj.source.MIME() {
-	case imagemanifest.DockerV2Schema1MediaType,
-		imagemanifest.DockerV2Schema1SignedMediaType:
+	switch {
+	case obj.source.Type() == types.TypeDockerArhive,
+		obj.source.MIME() == imagemanifest.DockerV2Schema1MediaType,
+		obj.source.MIME() == imagemanifest.DockerV2Schema1SignedMediaType:
 		// Could not compare image digest since the destination mediaType
-		// was changed during copy.
+		// was changed during copy, or the layers of the docker-archive
+		// tarball were compressed.
 		if !s.index.HasReference(
 			obj.source.Project(), obj.source.Name(), obj.source.Tag()) {
 			fail = true
@@ -437,14 +550,19 @@ func (s *Syncer) validateWorker(ctx context.Context, o any) {
 	}
 
 	if fail {
-		logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+		logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 			Errorf("Image [%v] does not exists in archive index",
 				obj.source.ReferenceNameWithoutTransport())
-		err = fmt.Errorf("FAILED: [%v]",
+		reason := ChangeMissing
+		if s.index.HasReference(
+			obj.source.Project(), obj.source.Name(), obj.source.Tag()) {
+			reason = ChangeOutdated
+		}
+		err = newMismatchError(reason, "FAILED: [%v]",
 			obj.source.ReferenceNameWithoutTransport())
 		return
 	}
 
-	logrus.WithFields(logrus.Fields{"IMG": obj.id}).
+	logger.FromContext(ctx).WithField(logger.ImageField, obj.id).
 		Infof("PASS: [%v]", obj.source.ReferenceNameWithoutTransport())
 }
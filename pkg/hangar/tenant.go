@@ -0,0 +1,206 @@
+package hangar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	ErrProjectBlocked = errors.New("destination project blocked")
+)
+
+// ProjectTenants is the mapping file of the destination projects owned by
+// different teams in the shared registry, each project is loaded by its
+// own robot account and concurrency.
+//
+//	projects:
+//	  team-a:
+//	    username: robot$team-a+loader
+//	    passwordEnv: TEAM_A_ROBOT_SECRET
+//	    jobs: 2
+type ProjectTenants struct {
+	Projects map[string]*ProjectTenant `json:"projects"`
+}
+
+// ProjectTenant is the robot account and the concurrency of the project.
+type ProjectTenant struct {
+	// Username is the robot account of the project, the registry
+	// credential is used if empty.
+	Username string `json:"username,omitempty"`
+	// Password is the secret of the robot account.
+	Password string `json:"password,omitempty"`
+	// PasswordEnv is the environment variable of the secret of the robot
+	// account, to avoid storing the secret in the mapping file.
+	PasswordEnv string `json:"passwordEnv,omitempty"`
+	// Jobs is the max number of the images loaded into the project
+	// concurrently, not limited if not positive.
+	Jobs int `json:"jobs,omitempty"`
+}
+
+// LoadProjectTenants reads the project mapping file, returns nil if the
+// file name is empty.
+func LoadProjectTenants(name string) (*ProjectTenants, error) {
+	if name == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project mapping %q: %w", name, err)
+	}
+	t := &ProjectTenants{}
+	if err := yaml.Unmarshal(b, t); err != nil {
+		return nil, fmt.Errorf("failed to decode project mapping %q: %w", name, err)
+	}
+	for project, p := range t.Projects {
+		if p == nil {
+			return nil, fmt.Errorf("project %q of mapping %q is empty", project, name)
+		}
+		if p.PasswordEnv != "" {
+			p.Password = os.Getenv(p.PasswordEnv)
+		}
+		if p.Username != "" && p.Password == "" {
+			return nil, fmt.Errorf("password of robot account %q of project %q not provided",
+				p.Username, project)
+		}
+	}
+	return t, nil
+}
+
+// tenants isolates the credentials, concurrency and failures of the
+// destination projects, the methods are nil-safe so the projects are not
+// isolated if the mapping file is not provided.
+type tenants struct {
+	projects map[string]*ProjectTenant
+	// slots is the concurrency semaphores of the projects
+	slots map[string]chan struct{}
+
+	mu sync.Mutex
+	// blocked is the error of the projects blocked by the quota or
+	// permission errors, the remaining images of the projects are failed
+	// without loading.
+	blocked map[string]error
+}
+
+func newTenants(t *ProjectTenants) *tenants {
+	if t == nil || len(t.Projects) == 0 {
+		return nil
+	}
+	ts := &tenants{
+		projects: t.Projects,
+		slots:    make(map[string]chan struct{}),
+		blocked:  make(map[string]error),
+	}
+	for project, p := range t.Projects {
+		if p.Jobs > 0 {
+			ts.slots[project] = make(chan struct{}, p.Jobs)
+		}
+		if p.Username != "" {
+			logrus.Infof("Load images into project %q by robot account %q",
+				project, p.Username)
+		}
+	}
+	return ts
+}
+
+// systemContext returns the system context with the robot account of the
+// project.
+func (t *tenants) systemContext(sysCtx *types.SystemContext, project string) *types.SystemContext {
+	if t == nil || t.projects[project] == nil || t.projects[project].Username == "" {
+		return sysCtx
+	}
+	p := t.projects[project]
+	sysCtx = utils.CopySystemContext(sysCtx)
+	sysCtx.DockerAuthConfig = &types.DockerAuthConfig{
+		Username: p.Username,
+		Password: p.Password,
+	}
+	return sysCtx
+}
+
+// credential returns the robot account of the project for the Harbor API,
+// returns the registry credential if the robot account not configured.
+func (t *tenants) credential(
+	project string, registryCredential *types.DockerAuthConfig,
+) *types.DockerAuthConfig {
+	if t == nil || t.projects[project] == nil || t.projects[project].Username == "" {
+		return registryCredential
+	}
+	return &types.DockerAuthConfig{
+		Username: t.projects[project].Username,
+		Password: t.projects[project].Password,
+	}
+}
+
+// acquire waits for the concurrency slot of the project, the release
+// function should be called after the image loaded.
+func (t *tenants) acquire(ctx context.Context, project string) (func(), error) {
+	if t == nil || t.slots[project] == nil {
+		return func() {}, nil
+	}
+	ch := t.slots[project]
+	select {
+	case ch <- struct{}{}:
+		return func() { <-ch }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// block blocks the project, returns false if the projects are not
+// isolated.
+func (t *tenants) block(project string, err error) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.blocked[project] == nil {
+		logrus.Errorf("Stop loading images into project %q: %v", project, err)
+		t.blocked[project] = err
+	}
+	return true
+}
+
+// blockedErr returns the error of the blocked project.
+func (t *tenants) blockedErr(project string) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.blocked[project]; err != nil {
+		return fmt.Errorf("%w %q: %w", ErrProjectBlocked, project, err)
+	}
+	return nil
+}
+
+// isQuotaExceeded checks whether the error returned by registry is the
+// storage quota exceeded error of the project.
+func isQuotaExceeded(err error) bool {
+	if err == nil {
+		return false
+	}
+	s := strings.ToLower(err.Error())
+	return strings.Contains(s, "quota") &&
+		(strings.Contains(s, "exceed") || strings.Contains(s, "not enough"))
+}
+
+// recordBlockedImage records the image of the blocked project as failed
+// without counting into the failure threshold, so the failures of one
+// project do not abort the images of other projects.
+func (l *Loader) recordBlockedImage(id int, image string, err error) {
+	l.handleError(NewError(id, err, nil, nil))
+	l.failedImageListMutex.Lock()
+	l.failedImageSet[image] = true
+	l.failedImageListMutex.Unlock()
+	l.status.fail(image)
+}
@@ -0,0 +1,83 @@
+package hangar
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LoadProjectTenants(t *testing.T) {
+	tenants, err := LoadProjectTenants("")
+	assert.Nil(t, err)
+	assert.Nil(t, tenants)
+
+	name := filepath.Join(t.TempDir(), "projects.yaml")
+	assert.Nil(t, os.WriteFile(name, []byte(`projects:
+  team-a:
+    username: robot$team-a+loader
+    passwordEnv: HANGAR_TEST_ROBOT_SECRET
+    jobs: 2
+  team-b:
+    jobs: 1
+`), 0644))
+	_, err = LoadProjectTenants(name)
+	assert.NotNil(t, err)
+
+	t.Setenv("HANGAR_TEST_ROBOT_SECRET", "secret")
+	tenants, err = LoadProjectTenants(name)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", tenants.Projects["team-a"].Password)
+	assert.Equal(t, 1, tenants.Projects["team-b"].Jobs)
+}
+
+func Test_tenants(t *testing.T) {
+	// Projects are not isolated if the mapping file not provided.
+	var ts *tenants
+	sysCtx := &types.SystemContext{}
+	assert.Equal(t, sysCtx, ts.systemContext(sysCtx, "team-a"))
+	release, err := ts.acquire(context.TODO(), "team-a")
+	assert.Nil(t, err)
+	release()
+	assert.False(t, ts.block("team-a", errors.New("quota exceeded")))
+	assert.Nil(t, ts.blockedErr("team-a"))
+
+	ts = newTenants(&ProjectTenants{
+		Projects: map[string]*ProjectTenant{
+			"team-a": {Username: "robot", Password: "secret", Jobs: 1},
+			"team-b": {},
+		},
+	})
+	assert.Equal(t, "robot", ts.systemContext(sysCtx, "team-a").DockerAuthConfig.Username)
+	assert.Nil(t, sysCtx.DockerAuthConfig)
+	assert.Equal(t, sysCtx, ts.systemContext(sysCtx, "team-b"))
+	assert.Equal(t, "robot", ts.credential("team-a", nil).Username)
+
+	release, err = ts.acquire(context.TODO(), "team-a")
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*10)
+	defer cancel()
+	_, err = ts.acquire(ctx, "team-a")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	release()
+	release, err = ts.acquire(context.TODO(), "team-a")
+	assert.Nil(t, err)
+	release()
+
+	assert.True(t, ts.block("team-a", errors.New("quota exceeded")))
+	assert.ErrorIs(t, ts.blockedErr("team-a"), ErrProjectBlocked)
+	assert.Nil(t, ts.blockedErr("team-b"))
+}
+
+func Test_isQuotaExceeded(t *testing.T) {
+	assert.False(t, isQuotaExceeded(nil))
+	assert.True(t, isQuotaExceeded(errors.New(
+		"denied: adding 10 MiB of storage resource, which when updated to current usage of 1 GiB will exceed the configured upper limit of 1 GiB: quota exceeded")))
+	assert.True(t, isQuotaExceeded(errors.New(`storage quota of Harbor project "a" is not enough`)))
+	assert.False(t, isQuotaExceeded(errors.New("connection refused")))
+}
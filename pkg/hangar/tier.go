@@ -0,0 +1,95 @@
+package hangar
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Tier is the criticality tier of the image in the image list, the images
+// are copied in the order of the tiers.
+type Tier string
+
+const (
+	// TierCritical images are copied first and never skipped by the
+	// time budget.
+	TierCritical Tier = "critical"
+	// TierStandard is the default tier of the images.
+	TierStandard Tier = "standard"
+	// TierOptional images are copied last.
+	TierOptional Tier = "optional"
+)
+
+var ErrInvalidTier = errors.New("invalid image tier")
+
+// ParseTier parses the image tier ('critical', 'standard' or 'optional'),
+// the empty string is the standard tier.
+func ParseTier(s string) (Tier, error) {
+	switch t := Tier(strings.ToLower(strings.TrimSpace(s))); t {
+	case "":
+		return TierStandard, nil
+	case TierCritical, TierStandard, TierOptional:
+		return t, nil
+	}
+	return "", fmt.Errorf("%w %q: should be %q, %q or %q", ErrInvalidTier,
+		s, TierCritical, TierStandard, TierOptional)
+}
+
+func (t Tier) priority() int {
+	switch t {
+	case TierCritical:
+		return 0
+	case TierOptional:
+		return 2
+	}
+	return 1
+}
+
+// MoreCritical returns true if the tier is more critical than the other.
+func (t Tier) MoreCritical(o Tier) bool {
+	return t.priority() < o.priority()
+}
+
+// sortByTier sorts the images by the tiers stably, the critical images
+// are in front.
+func sortByTier(images []string, tiers map[string]Tier) {
+	if len(tiers) == 0 {
+		return
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		return tiers[images[i]].priority() < tiers[images[j]].priority()
+	})
+}
+
+// tier returns the tier of the image list line.
+func (c *common) tier(line string) Tier {
+	if t, ok := c.tiers[line]; ok {
+		return t
+	}
+	return TierStandard
+}
+
+// skipByBudget checks whether the time budget of the job is exceeded,
+// the non-critical image is recorded as failed without counting into the
+// failure threshold and should be skipped, to be copied in the next
+// transfer window by the failed image list.
+func (c *common) skipByBudget(line string) bool {
+	if c.timeBudget <= 0 || time.Since(c.startTime) < c.timeBudget {
+		return false
+	}
+	t := c.tier(line)
+	if t == TierCritical {
+		return false
+	}
+	logrus.Warnf("Skip [%v] (tier %v): time budget %v exceeded", line, t, c.timeBudget)
+	c.budgetSkipped.Add(1)
+	c.failedImageListMutex.Lock()
+	c.failedImageSet[line] = true
+	c.failedImageListMutex.Unlock()
+	c.status.fail(line)
+	return true
+}
@@ -0,0 +1,58 @@
+package hangar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseTier(t *testing.T) {
+	for s, expected := range map[string]Tier{
+		"":          TierStandard,
+		"critical":  TierCritical,
+		" Standard": TierStandard,
+		"OPTIONAL":  TierOptional,
+	} {
+		tier, err := ParseTier(s)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, tier)
+	}
+	_, err := ParseTier("high")
+	assert.ErrorIs(t, err, ErrInvalidTier)
+}
+
+func Test_sortByTier(t *testing.T) {
+	images := []string{"a", "b", "c", "d", "e"}
+	sortByTier(images, map[string]Tier{
+		"a": TierOptional,
+		"c": TierCritical,
+		"e": TierCritical,
+	})
+	assert.Equal(t, []string{"c", "e", "b", "d", "a"}, images)
+}
+
+func Test_Tier_MoreCritical(t *testing.T) {
+	assert.True(t, TierCritical.MoreCritical(TierStandard))
+	assert.True(t, TierStandard.MoreCritical(TierOptional))
+	assert.False(t, TierStandard.MoreCritical(TierStandard))
+	assert.False(t, TierOptional.MoreCritical(TierCritical))
+}
+
+func Test_skipByBudget(t *testing.T) {
+	c := newTestCommon(t)
+	c.tiers = map[string]Tier{"a": TierCritical}
+	c.startTime = time.Now().Add(-time.Hour)
+	// Time budget disabled.
+	assert.False(t, c.skipByBudget("b"))
+
+	c.timeBudget = time.Hour * 2
+	assert.False(t, c.skipByBudget("b"))
+
+	c.timeBudget = time.Minute
+	assert.False(t, c.skipByBudget("a"))
+	assert.True(t, c.skipByBudget("b"))
+	assert.True(t, c.skipByBudget("c"))
+	assert.Equal(t, int64(2), c.budgetSkipped.Load())
+	assert.Equal(t, map[string]bool{"b": true, "c": true}, c.failedImageSet)
+}
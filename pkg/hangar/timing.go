@@ -0,0 +1,129 @@
+package hangar
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Phases of the image job.
+const (
+	// PhaseInspect inspects the source & destination images.
+	PhaseInspect = "inspect"
+	// PhasePull pulls the image from source registry or archive.
+	PhasePull = "pull"
+	// PhasePush pushes the image (manifest) to the destination registry.
+	PhasePush = "push"
+	// PhaseCopy copies the image between registries, the pull and push
+	// are streamed and cannot be measured separately.
+	PhaseCopy = "copy"
+	// PhaseArchive writes the image into archive file.
+	PhaseArchive = "archive"
+)
+
+// ImageTiming is the duration of the image job with phase breakdown.
+type ImageTiming struct {
+	Image    string                   `json:"image"`
+	Duration time.Duration            `json:"duration"`
+	Phases   map[string]time.Duration `json:"phases,omitempty"`
+}
+
+// imageTimer measures the duration of each phase of the image job,
+// the duration of the phase is accumulated if the phase begins repeatedly.
+type imageTimer struct {
+	timing     *ImageTiming
+	start      time.Time
+	phase      string
+	phaseStart time.Time
+}
+
+func newImageTimer(image string) *imageTimer {
+	return &imageTimer{
+		timing: &ImageTiming{
+			Image:  image,
+			Phases: make(map[string]time.Duration),
+		},
+		start: time.Now(),
+	}
+}
+
+// begin ends the current phase and begins the new phase.
+func (t *imageTimer) begin(phase string) {
+	now := time.Now()
+	if t.phase != "" {
+		t.timing.Phases[t.phase] += now.Sub(t.phaseStart)
+	}
+	t.phase = phase
+	t.phaseStart = now
+}
+
+// finish ends the current phase and returns the timing of the image.
+func (t *imageTimer) finish() *ImageTiming {
+	t.begin("")
+	t.timing.Duration = time.Since(t.start)
+	return t.timing
+}
+
+// timings stores the timing of the images (thread-safe).
+type timings struct {
+	mutex *sync.Mutex
+	list  []*ImageTiming
+}
+
+func newTimings() *timings {
+	return &timings{
+		mutex: &sync.Mutex{},
+	}
+}
+
+func (t *timings) record(timer *imageTimer) {
+	timing := timer.finish()
+	t.mutex.Lock()
+	t.list = append(t.list, timing)
+	t.mutex.Unlock()
+}
+
+// sorted returns the timings sorted by duration in descending order.
+func (t *timings) sorted() []*ImageTiming {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	list := append([]*ImageTiming{}, t.list...)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Duration > list[j].Duration
+	})
+	return list
+}
+
+// TimingBucket is the bucket of the image duration histogram.
+type TimingBucket struct {
+	// Le is the upper bound of the bucket, 0 means no upper bound.
+	Le    time.Duration `json:"le"`
+	Count int           `json:"count"`
+}
+
+// timingBucketBounds is the upper bounds of the histogram buckets.
+var timingBucketBounds = []time.Duration{
+	time.Second * 10,
+	time.Second * 30,
+	time.Minute,
+	time.Minute * 5,
+	time.Minute * 15,
+	0,
+}
+
+// TimingHistogram returns the histogram of the image durations.
+func TimingHistogram(list []*ImageTiming) []TimingBucket {
+	buckets := make([]TimingBucket, len(timingBucketBounds))
+	for i, le := range timingBucketBounds {
+		buckets[i].Le = le
+	}
+	for _, t := range list {
+		for i := range buckets {
+			if buckets[i].Le == 0 || t.Duration < buckets[i].Le {
+				buckets[i].Count++
+				break
+			}
+		}
+	}
+	return buckets
+}
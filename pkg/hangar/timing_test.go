@@ -0,0 +1,47 @@
+package hangar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ImageTimer(t *testing.T) {
+	timer := newImageTimer("nginx:latest")
+	timer.begin(PhaseInspect)
+	timer.begin(PhasePull)
+	timer.begin(PhaseInspect)
+	timing := timer.finish()
+	assert.Equal(t, "nginx:latest", timing.Image)
+	assert.Equal(t, 2, len(timing.Phases))
+	assert.True(t, timing.Duration >= timing.Phases[PhaseInspect])
+
+	tm := newTimings()
+	for _, d := range []time.Duration{time.Second, time.Minute, time.Second * 20} {
+		timer := newImageTimer(d.String())
+		timer.start = timer.start.Add(-d)
+		tm.record(timer)
+	}
+	sorted := tm.sorted()
+	assert.Equal(t, 3, len(sorted))
+	assert.Equal(t, "1m0s", sorted[0].Image)
+	assert.Equal(t, "20s", sorted[1].Image)
+	assert.Equal(t, "1s", sorted[2].Image)
+}
+
+func Test_TimingHistogram(t *testing.T) {
+	buckets := TimingHistogram([]*ImageTiming{
+		{Duration: time.Second},
+		{Duration: time.Second * 10},
+		{Duration: time.Minute * 2},
+		{Duration: time.Hour},
+	})
+	assert.Equal(t, len(timingBucketBounds), len(buckets))
+	assert.Equal(t, 1, buckets[0].Count)
+	assert.Equal(t, 1, buckets[1].Count)
+	assert.Equal(t, 0, buckets[2].Count)
+	assert.Equal(t, 1, buckets[3].Count)
+	assert.Equal(t, 0, buckets[4].Count)
+	assert.Equal(t, 1, buckets[5].Count)
+}
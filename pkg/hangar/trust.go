@@ -0,0 +1,97 @@
+package hangar
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/source"
+	"github.com/cnrancher/hangar/pkg/statedb"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrRegistryNotAllowed = errors.New("source registry not in the allow-list")
+	ErrDigestChanged      = errors.New("source image digest changed since first seen")
+)
+
+// TrustRecord is the trust-on-first-use record of the source image.
+type TrustRecord struct {
+	Digest    digest.Digest `json:"digest"`
+	FirstSeen time.Time     `json:"firstSeen"`
+	LastSeen  time.Time     `json:"lastSeen"`
+}
+
+// TrustStore records the first-seen digest of the source images
+// (trust-on-first-use) to detect the upstream tag tampering.
+type TrustStore struct {
+	*statedb.Store[TrustRecord]
+}
+
+const trustStoreVersion = 1
+
+// NewTrustStore loads the trust store from the file path,
+// an empty trust store is created if the file does not exist.
+func NewTrustStore(path string) (*TrustStore, error) {
+	t, err := statedb.Open[TrustRecord]("trust store", path, trustStoreVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &TrustStore{Store: t}, nil
+}
+
+// Verify records the digest of the image if the image is first seen,
+// returns ErrDigestChanged if the digest is different from the first-seen
+// digest, the recorded digest is updated if accept is true.
+func (t *TrustStore) Verify(image string, dgst digest.Digest, accept bool) error {
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+	r, ok := t.Images[image]
+	if !ok {
+		t.Images[image] = &TrustRecord{
+			Digest:    dgst,
+			FirstSeen: now,
+			LastSeen:  now,
+		}
+		return nil
+	}
+	if r.Digest != dgst {
+		if !accept {
+			return fmt.Errorf("%w: [%v] recorded %v, got %v",
+				ErrDigestChanged, image, r.Digest, dgst)
+		}
+		logrus.Warnf("Accept digest change of [%v]: %v => %v",
+			image, r.Digest, dgst)
+		r.Digest = dgst
+		r.FirstSeen = now
+	}
+	r.LastSeen = now
+	return nil
+}
+
+// verifySource checks the source registry is in the allow-list and
+// the source image digest matches with the first-seen digest and the
+// lock file, the resolved digest is recorded into the lock.
+func (c *common) verifySource(src *source.Source) error {
+	if len(c.allowedRegistries) != 0 && !c.allowedRegistries[src.Registry()] {
+		return fmt.Errorf("%w: %q", ErrRegistryNotAllowed, src.Registry())
+	}
+	image := src.ReferenceNameWithoutTransport()
+	if c.fromLock != nil {
+		if err := c.fromLock.Verify(image, src.Digest()); err != nil {
+			return err
+		}
+	}
+	if c.trustStore != nil {
+		if err := c.trustStore.Verify(image, src.Digest(), c.acceptChanges); err != nil {
+			return err
+		}
+	}
+	if c.lock != nil {
+		c.lock.Record(image, src.Digest())
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package hangar
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TrustStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trust.json")
+	s, err := NewTrustStore(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(s.Images))
+
+	d1 := digest.FromString("1")
+	d2 := digest.FromString("2")
+	image := "docker.io/library/nginx:latest"
+	assert.Nil(t, s.Verify(image, d1, false))
+	assert.Nil(t, s.Verify(image, d1, false))
+	assert.ErrorIs(t, s.Verify(image, d2, false), ErrDigestChanged)
+	assert.Nil(t, s.Save())
+
+	s, err = NewTrustStore(path)
+	assert.Nil(t, err)
+	assert.Equal(t, d1, s.Images[image].Digest)
+	assert.ErrorIs(t, s.Verify(image, d2, false), ErrDigestChanged)
+	assert.Nil(t, s.Verify(image, d2, true))
+	assert.Equal(t, d2, s.Images[image].Digest)
+	assert.Nil(t, s.Verify(image, d2, false))
+}
@@ -0,0 +1,164 @@
+package hangar
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cnrancher/hangar/pkg/extension"
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// LoadPlan is the exact work of loading the images computed by the
+// destination warm-up phase.
+type LoadPlan struct {
+	// Manifests is the number of the platform manifests to load.
+	Manifests int `json:"manifests"`
+	// ExistingManifests is the number of the manifests already exist
+	// in the destination registry.
+	ExistingManifests int `json:"existingManifests"`
+	// Blobs is the number of the blobs (layers and configs) to load.
+	Blobs int `json:"blobs"`
+	// ExistingBlobs is the number of the blobs already exist in the
+	// destination repositories.
+	ExistingBlobs int `json:"existingBlobs"`
+	// UploadBytes is the total size of the blobs to upload.
+	UploadBytes int64 `json:"uploadBytes"`
+
+	// images is the size of the blobs to upload of the images,
+	// map[SOURCE:TAG]size
+	images map[string]int64
+}
+
+// warmUpCheck is the manifest or blob to check in the destination
+// repository.
+type warmUpCheck struct {
+	image      string
+	repository string
+	digest     digest.Digest
+	manifest   bool
+	size       int64
+}
+
+// warmUp checks the manifests and blobs already exist in the destination
+// registry concurrently by HEAD requests, and computes the exact plan of
+// loading images. The manifests and blobs failed to check are considered
+// to be uploaded.
+func (l *Loader) warmUp(ctx context.Context) *LoadPlan {
+	plan := &LoadPlan{
+		images: make(map[string]int64),
+	}
+	blobSizes := l.ar.BlobSizes()
+	checked := map[string]bool{}
+	var checks []*warmUpCheck
+	for _, image := range l.loadImages() {
+		name := image.Source + ":" + image.Tag
+		project, repo, err := l.destinationRepository(l.DestinationRegistry, name)
+		if err != nil {
+			// The error is handled when loading the image.
+			continue
+		}
+		repository := project + "/" + repo
+		add := func(d digest.Digest, manifest bool) {
+			if d == "" || checked[repository+"@"+d.String()] {
+				return
+			}
+			checked[repository+"@"+d.String()] = true
+			checks = append(checks, &warmUpCheck{
+				image:      name,
+				repository: repository,
+				digest:     d,
+				manifest:   manifest,
+				size:       blobSizes[d],
+			})
+		}
+		for i := range image.Images {
+			spec := &image.Images[i]
+			if !l.warmUpPlatform(spec) {
+				continue
+			}
+			add(spec.Digest, true)
+			for _, layer := range spec.Layers {
+				if l.layerManager.skipBlobs[layer] {
+					continue
+				}
+				add(layer, false)
+			}
+			add(spec.Config, false)
+		}
+	}
+
+	client := extension.NewClient(l.systemContext, l.DestinationRegistry)
+	mu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	ch := make(chan *warmUpCheck)
+	for i := 0; i < max(l.workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range ch {
+				var (
+					exists bool
+					err    error
+				)
+				if c.manifest {
+					exists, err = client.ManifestExists(ctx, c.repository, c.digest)
+				} else {
+					exists, err = client.BlobExists(ctx, c.repository, c.digest)
+				}
+				if err != nil {
+					logrus.Debugf("warm-up: failed to check [%v@%v]: %v",
+						c.repository, c.digest, err)
+				}
+				mu.Lock()
+				plan.record(c, exists)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, c := range checks {
+		if ctx.Err() != nil {
+			break
+		}
+		ch <- c
+	}
+	close(ch)
+	wg.Wait()
+	return plan
+}
+
+// warmUpPlatform returns true if the platform image is to be loaded.
+func (l *Loader) warmUpPlatform(spec *archive.ImageSpec) bool {
+	if len(l.imageSpecSet["os"]) != 0 && !l.imageSpecSet["os"][spec.OS] {
+		return false
+	}
+	if len(l.imageSpecSet["arch"]) != 0 && !l.imageSpecSet["arch"][spec.Arch] {
+		return false
+	}
+	return true
+}
+
+func (p *LoadPlan) record(c *warmUpCheck, exists bool) {
+	if c.manifest {
+		p.Manifests++
+		if exists {
+			p.ExistingManifests++
+		}
+		return
+	}
+	p.Blobs++
+	if exists {
+		p.ExistingBlobs++
+		return
+	}
+	p.UploadBytes += c.size
+	p.images[c.image] += c.size
+}
+
+func (p *LoadPlan) print() {
+	logrus.Infof("Load plan: %d manifests (%d existing), %d blobs (%d existing), %s to upload",
+		p.Manifests, p.ExistingManifests, p.Blobs, p.ExistingBlobs,
+		utils.FormatSize(p.UploadBytes))
+}
@@ -0,0 +1,26 @@
+package hangar
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LoadPlan_record(t *testing.T) {
+	p := &LoadPlan{
+		images: make(map[string]int64),
+	}
+	p.record(&warmUpCheck{image: "a", digest: digest.FromString("m1"), manifest: true}, true)
+	p.record(&warmUpCheck{image: "a", digest: digest.FromString("m2"), manifest: true}, false)
+	p.record(&warmUpCheck{image: "a", digest: digest.FromString("b1"), size: 10}, true)
+	p.record(&warmUpCheck{image: "a", digest: digest.FromString("b2"), size: 20}, false)
+	p.record(&warmUpCheck{image: "b", digest: digest.FromString("b3"), size: 30}, false)
+
+	assert.Equal(t, 2, p.Manifests)
+	assert.Equal(t, 1, p.ExistingManifests)
+	assert.Equal(t, 3, p.Blobs)
+	assert.Equal(t, 1, p.ExistingBlobs)
+	assert.Equal(t, int64(50), p.UploadBytes)
+	assert.Equal(t, map[string]int64{"a": 20, "b": 30}, p.images)
+}
@@ -13,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cnrancher/hangar/pkg/backoff"
 	"github.com/cnrancher/hangar/pkg/utils"
 	"github.com/containers/common/pkg/retry"
 	"github.com/containers/image/v5/types"
@@ -197,7 +198,7 @@ func httpClientDoWithRetry(
 ) (*http.Response, error) {
 	var resp *http.Response
 	var err error
-	err = retry.IfNecessary(ctx, func() error {
+	err = backoff.IfNecessary(ctx, func() error {
 		logrus.Debugf("client.Do: %v", req.URL.String())
 		resp, err = client.Do(req)
 		return err
@@ -0,0 +1,171 @@
+package harbor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// UnlimitedStorage is the hard storage limit of the project
+// without storage quota.
+const UnlimitedStorage int64 = -1
+
+// Quota is the storage quota of the Harbor V2 project.
+type Quota struct {
+	// ID is the quota ID, used to update the quota.
+	ID int64
+	// Project is the project name.
+	Project string
+	// Hard is the storage limit in bytes, -1 means unlimited.
+	Hard int64
+	// Used is the used storage in bytes.
+	Used int64
+}
+
+// Unlimited returns true if the project has no storage limit.
+func (q *Quota) Unlimited() bool {
+	return q.Hard < 0
+}
+
+// Available returns the available storage in bytes.
+func (q *Quota) Available() int64 {
+	if q.Unlimited() {
+		return -1
+	}
+	return max(q.Hard-q.Used, 0)
+}
+
+type quotaResource struct {
+	Storage int64 `json:"storage"`
+}
+
+type quotaResponse struct {
+	ID   int64         `json:"id"`
+	Hard quotaResource `json:"hard"`
+	Used quotaResource `json:"used"`
+}
+
+// GetProjectQuota gets the storage quota of the project on harbor v2.
+func GetProjectQuota(
+	ctx context.Context,
+	name, u string,
+	credential *types.DockerAuthConfig,
+	tlsVerify bool,
+) (*Quota, error) {
+	u = strings.TrimSuffix(u, "/")
+	var project struct {
+		ProjectID int64 `json:"project_id"`
+	}
+	err := doJSONRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s/api/v2.0/projects/%s", u, url.PathEscape(name)),
+		credential, tlsVerify, nil, &project)
+	if err != nil {
+		return nil, fmt.Errorf("harbor.GetProjectQuota: %w", err)
+	}
+
+	var quotas []quotaResponse
+	err = doJSONRequest(ctx, http.MethodGet,
+		fmt.Sprintf("%s/api/v2.0/quotas?reference=project&reference_id=%d",
+			u, project.ProjectID),
+		credential, tlsVerify, nil, &quotas)
+	if err != nil {
+		return nil, fmt.Errorf("harbor.GetProjectQuota: %w", err)
+	}
+	if len(quotas) == 0 {
+		return nil, fmt.Errorf("harbor.GetProjectQuota: quota of project %q not found", name)
+	}
+	q := &Quota{
+		ID:      quotas[0].ID,
+		Project: name,
+		Hard:    quotas[0].Hard.Storage,
+		Used:    quotas[0].Used.Storage,
+	}
+	logrus.Debugf("harbor project %q quota: hard %d, used %d",
+		name, q.Hard, q.Used)
+	return q, nil
+}
+
+// UpdateProjectQuota updates the hard storage limit of the project quota.
+func UpdateProjectQuota(
+	ctx context.Context,
+	q *Quota, u string,
+	credential *types.DockerAuthConfig,
+	tlsVerify bool,
+) error {
+	u = strings.TrimSuffix(u, "/")
+	data := struct {
+		Hard quotaResource `json:"hard"`
+	}{
+		Hard: quotaResource{Storage: q.Hard},
+	}
+	err := doJSONRequest(ctx, http.MethodPut,
+		fmt.Sprintf("%s/api/v2.0/quotas/%d", u, q.ID),
+		credential, tlsVerify, data, nil)
+	if err != nil {
+		return fmt.Errorf("harbor.UpdateProjectQuota: %w", err)
+	}
+	return nil
+}
+
+// doJSONRequest sends the request with the JSON encoded body and decodes
+// the JSON response into out if it is not nil.
+func doJSONRequest(
+	ctx context.Context,
+	method, u string,
+	credential *types.DockerAuthConfig,
+	tlsVerify bool,
+	in any,
+	out any,
+) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("json.Marshal: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	client := &http.Client{
+		Timeout: time.Second * 5,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: !tlsVerify},
+		},
+	}
+	r, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	auth := fmt.Sprintf("%s:%s", credential.Username, credential.Password)
+	r.Header.Add("Authorization", "Basic "+utils.Base64(auth))
+	r.Header.Add("Accept", "application/json")
+	r.Header.Add("X-Is-Resource-Name", "true")
+	if in != nil {
+		r.Header.Add("Content-Type", "application/json")
+	}
+	resp, err := httpClientDoWithRetry(ctx, client, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %q response: %v", method, u, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %q response: %w", u, err)
+	}
+	return nil
+}
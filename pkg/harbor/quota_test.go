@@ -0,0 +1,54 @@
+package harbor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ProjectQuota(t *testing.T) {
+	var updated int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2.0/projects/library", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.Header.Get("X-Is-Resource-Name"))
+		w.Write([]byte(`{"project_id": 3, "name": "library"}`))
+	})
+	mux.HandleFunc("/api/v2.0/quotas", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "3", r.URL.Query().Get("reference_id"))
+		w.Write([]byte(`[{"id": 7, "hard": {"storage": 1024}, "used": {"storage": 1000}}]`))
+	})
+	mux.HandleFunc("/api/v2.0/quotas/7", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		var data struct {
+			Hard quotaResource `json:"hard"`
+		}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&data))
+		updated = data.Hard.Storage
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	ctx := context.Background()
+	credential := &types.DockerAuthConfig{Username: "admin", Password: "password"}
+	q, err := GetProjectQuota(ctx, "library", s.URL, credential, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), q.ID)
+	assert.Equal(t, int64(24), q.Available())
+	assert.False(t, q.Unlimited())
+
+	q.Hard = 2048
+	assert.Nil(t, UpdateProjectQuota(ctx, q, s.URL, credential, false))
+	assert.Equal(t, int64(2048), updated)
+
+	_, err = GetProjectQuota(ctx, "not-exists", s.URL, credential, false)
+	assert.NotNil(t, err)
+
+	q = &Quota{Hard: UnlimitedStorage, Used: 100}
+	assert.True(t, q.Unlimited())
+	assert.Equal(t, int64(-1), q.Available())
+}
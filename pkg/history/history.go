@@ -0,0 +1,113 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/statedb"
+)
+
+const (
+	ResultSucceeded = "succeeded"
+	ResultFailed    = "failed"
+)
+
+// Record is the summary of a finished hangar run.
+type Record struct {
+	// Command is the hangar command of the run, e.g. 'mirror', 'save'.
+	Command string `json:"command"`
+	// RunID is the unique ID of the run.
+	RunID     string        `json:"runID,omitempty"`
+	Result    string        `json:"result"`
+	StartTime time.Time     `json:"startTime"`
+	Duration  time.Duration `json:"duration"`
+
+	Total        int      `json:"total"`
+	Succeeded    int      `json:"succeeded"`
+	Failed       int      `json:"failed"`
+	FailedImages []string `json:"failedImages,omitempty"`
+	Images       []string `json:"images,omitempty"`
+
+	// ImageList and ImageListCommit are the image list hosted in git
+	// repository and the commit fetched by the run.
+	ImageList       string `json:"imageList,omitempty"`
+	ImageListCommit string `json:"imageListCommit,omitempty"`
+
+	// Archive is the archive file name of the save/sync/load run.
+	Archive string `json:"archive,omitempty"`
+	// Size is the size of the archive file in bytes.
+	Size int64 `json:"size,omitempty"`
+}
+
+// DefaultPath returns the default history file path, the HANGAR_HISTORY_FILE
+// environment variable overrides the default path.
+func DefaultPath() string {
+	if p := os.Getenv("HANGAR_HISTORY_FILE"); p != "" {
+		return p
+	}
+	return statedb.Path("history.jsonl")
+}
+
+// Append appends the run record into the history file
+// (one JSON record per line).
+func Append(path string, r *Record) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("history: %w", err)
+	}
+	return f.Close()
+}
+
+// Load loads the last n run records of the command from the history file
+// in chronological order, all commands are loaded if command is empty and
+// all records are loaded if n <= 0.
+func Load(path string, command string, n int) ([]*Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("history: %w", err)
+	}
+	defer f.Close()
+
+	var records []*Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		r := &Record{}
+		if err := json.Unmarshal(sc.Bytes(), r); err != nil {
+			// Skip the corrupted line.
+			continue
+		}
+		if command != "" && r.Command != command {
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("history: %w", err)
+	}
+	if n > 0 && len(records) > n {
+		records = records[len(records)-n:]
+	}
+	return records, nil
+}
@@ -0,0 +1,63 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AppendLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	records, err := Load(path, "", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(records))
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, Append(path, &Record{
+			Command: "save",
+			Total:   i,
+		}))
+		assert.Nil(t, Append(path, &Record{
+			Command: "mirror",
+			Total:   i,
+		}))
+	}
+	records, err = Load(path, "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, len(records))
+	records, err = Load(path, "save", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, 2, records[0].Total)
+	assert.Equal(t, 3, records[1].Total)
+}
+
+func Test_NewReport(t *testing.T) {
+	now := time.Now()
+	records := []*Record{
+		{
+			Command:      "save",
+			StartTime:    now,
+			Images:       []string{"a", "b", "c"},
+			FailedImages: []string{"c"},
+			Size:         100,
+		},
+		{
+			Command:      "save",
+			StartTime:    now.Add(time.Hour),
+			Images:       []string{"a", "b", "c", "d"},
+			FailedImages: []string{"b", "c"},
+			Size:         200,
+		},
+	}
+	r := NewReport(records)
+	assert.Equal(t, 1, len(r.Diffs))
+	assert.Equal(t, []string{"b"}, r.Diffs[0].NewFailures)
+	assert.Equal(t, []string{"d"}, r.Diffs[0].NewImages)
+	assert.Equal(t, int64(100), r.Diffs[0].SizeDelta)
+	assert.Equal(t, []string{"c"}, r.PersistentFailures)
+	// Size doubled, new failures and persistent failures.
+	assert.Equal(t, 3, len(r.Regressions))
+}
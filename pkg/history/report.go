@@ -0,0 +1,113 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cnrancher/hangar/pkg/utils"
+)
+
+// sizeRegressionRatio is the ratio of archive size growth between two runs
+// to be reported as regression.
+const sizeRegressionRatio = 1.5
+
+// Diff is the comparison result of a run with its previous run.
+type Diff struct {
+	// NewFailures is the images failed in this run but not the previous run.
+	NewFailures []string `json:"newFailures,omitempty"`
+	// Recovered is the images failed in the previous run but not this run.
+	Recovered []string `json:"recovered,omitempty"`
+	// NewImages is the images newly appeared in this run.
+	NewImages []string `json:"newImages,omitempty"`
+	// RemovedImages is the images removed in this run.
+	RemovedImages []string `json:"removedImages,omitempty"`
+	// SizeDelta is the archive size change in bytes.
+	SizeDelta int64 `json:"sizeDelta"`
+	// DurationDelta is the duration change in seconds.
+	DurationDelta float64 `json:"durationDelta"`
+}
+
+// Report is the trend report of the recent runs.
+type Report struct {
+	Runs []*Record `json:"runs"`
+	// Diffs[i] is the comparison of Runs[i+1] with Runs[i].
+	Diffs []*Diff `json:"diffs"`
+	// PersistentFailures is the images failed in every run (at least 2 runs).
+	PersistentFailures []string `json:"persistentFailures,omitempty"`
+	// Regressions is the human readable warnings of the report.
+	Regressions []string `json:"regressions,omitempty"`
+}
+
+// Compare compares the run record with the previous run record.
+func Compare(prev, cur *Record) *Diff {
+	d := &Diff{
+		NewFailures:   difference(cur.FailedImages, prev.FailedImages),
+		Recovered:     difference(prev.FailedImages, cur.FailedImages),
+		NewImages:     difference(cur.Images, prev.Images),
+		RemovedImages: difference(prev.Images, cur.Images),
+		SizeDelta:     cur.Size - prev.Size,
+		DurationDelta: (cur.Duration - prev.Duration).Seconds(),
+	}
+	return d
+}
+
+// NewReport builds the trend report of the run records
+// (in chronological order).
+func NewReport(records []*Record) *Report {
+	r := &Report{
+		Runs:  records,
+		Diffs: make([]*Diff, 0),
+	}
+	for i := 1; i < len(records); i++ {
+		prev, cur := records[i-1], records[i]
+		d := Compare(prev, cur)
+		r.Diffs = append(r.Diffs, d)
+
+		t := cur.StartTime.Format("2006-01-02 15:04:05")
+		if prev.Size > 0 && float64(cur.Size) >= float64(prev.Size)*sizeRegressionRatio {
+			r.Regressions = append(r.Regressions, fmt.Sprintf(
+				"[%s] %s: archive size grew from %s to %s",
+				t, cur.Command, utils.FormatSize(prev.Size), utils.FormatSize(cur.Size)))
+		}
+		if len(d.NewFailures) > 0 {
+			r.Regressions = append(r.Regressions, fmt.Sprintf(
+				"[%s] %s: %d new failed images", t, cur.Command, len(d.NewFailures)))
+		}
+	}
+	if len(records) > 1 {
+		counts := map[string]int{}
+		for _, rec := range records {
+			for _, img := range rec.FailedImages {
+				counts[img]++
+			}
+		}
+		for img, c := range counts {
+			if c == len(records) {
+				r.PersistentFailures = append(r.PersistentFailures, img)
+			}
+		}
+		sort.Strings(r.PersistentFailures)
+		if len(r.PersistentFailures) > 0 {
+			r.Regressions = append(r.Regressions, fmt.Sprintf(
+				"%d images failed in all of the last %d runs",
+				len(r.PersistentFailures), len(records)))
+		}
+	}
+	return r
+}
+
+// difference returns the sorted elements in a but not in b.
+func difference(a, b []string) []string {
+	set := make(map[string]bool, len(b))
+	for _, s := range b {
+		set[s] = true
+	}
+	var d []string
+	for _, s := range a {
+		if !set[s] {
+			d = append(d, s)
+		}
+	}
+	sort.Strings(d)
+	return d
+}
@@ -0,0 +1,276 @@
+package incluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/types"
+)
+
+const (
+	awsRoleARNEnv      = "AWS_ROLE_ARN"
+	awsTokenFileEnv    = "AWS_WEB_IDENTITY_TOKEN_FILE"
+	awsRegionEnv       = "AWS_REGION"
+	awsDefaultRegion   = "AWS_DEFAULT_REGION"
+	awsSessionName     = "hangar"
+	awsSigningAlgo     = "AWS4-HMAC-SHA256"
+	awsTimeFormat      = "20060102T150405Z"
+	awsDateFormat      = "20060102"
+	ecrTarget          = "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken"
+	ecrContentType     = "application/x-amz-json-1.1"
+	stsAPIVersion      = "2011-06-15"
+	stsAssumeRoleWebID = "AssumeRoleWithWebIdentity"
+)
+
+// ecrRegistryRegexp matches the ECR registry, example:
+//
+//	123456789012.dkr.ecr.us-east-1.amazonaws.com
+//	123456789012.dkr.ecr-fips.us-east-1.amazonaws.com
+//	123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn
+var ecrRegistryRegexp = regexp.MustCompile(
+	`^([0-9]{12})\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// ecrProvider gets the ECR authorization token by using the EKS
+// IAM Roles for Service Accounts (IRSA) web identity token.
+type ecrProvider struct {
+	client *http.Client
+}
+
+type awsCredential struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+func newECRProvider() *ecrProvider {
+	return &ecrProvider{
+		client: &http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
+}
+
+func (p *ecrProvider) Name() string {
+	return "EKS IRSA"
+}
+
+func (p *ecrProvider) Available(_ context.Context) bool {
+	return os.Getenv(awsRoleARNEnv) != "" && os.Getenv(awsTokenFileEnv) != ""
+}
+
+func (p *ecrProvider) Match(registry string) bool {
+	return ecrRegistryRegexp.MatchString(strings.ToLower(registry))
+}
+
+func (p *ecrProvider) Credential(
+	ctx context.Context, registry string,
+) (*types.DockerAuthConfig, error) {
+	spec := ecrRegistryRegexp.FindStringSubmatch(strings.ToLower(registry))
+	if len(spec) != 5 {
+		return nil, fmt.Errorf("ecr: invalid ECR registry %q", registry)
+	}
+	accountID, region, domain := spec[1], spec[3], "amazonaws.com"+spec[4]
+	cred, err := p.assumeRole(ctx, region, domain)
+	if err != nil {
+		return nil, err
+	}
+	return p.authorizationToken(ctx, cred, accountID, region, domain)
+}
+
+// assumeRole exchanges the web identity token to the temporary credential.
+// The AssumeRoleWithWebIdentity API does not need to be signed.
+func (p *ecrProvider) assumeRole(
+	ctx context.Context, region, domain string,
+) (*awsCredential, error) {
+	token, err := os.ReadFile(os.Getenv(awsTokenFileEnv))
+	if err != nil {
+		return nil, fmt.Errorf("ecr: failed to read web identity token: %w", err)
+	}
+	if r := os.Getenv(awsRegionEnv); r != "" {
+		region = r
+	} else if r := os.Getenv(awsDefaultRegion); r != "" {
+		region = r
+	}
+	values := url.Values{}
+	values.Set("Action", stsAssumeRoleWebID)
+	values.Set("Version", stsAPIVersion)
+	values.Set("RoleArn", os.Getenv(awsRoleARNEnv))
+	values.Set("RoleSessionName", awsSessionName)
+	values.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+	u := fmt.Sprintf("https://sts.%s.%s/?%s", region, domain, values.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ecr: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ecr: failed to assume role: %w", err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ecr: failed to assume role: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ecr: failed to assume role: %v: %s",
+			resp.Status, string(b))
+	}
+	result := struct {
+		Credentials struct {
+			AccessKeyID     string `xml:"AccessKeyId"`
+			SecretAccessKey string `xml:"SecretAccessKey"`
+			SessionToken    string `xml:"SessionToken"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}{}
+	if err := xml.Unmarshal(b, &result); err != nil {
+		return nil, fmt.Errorf("ecr: failed to decode STS response: %w", err)
+	}
+	return &awsCredential{
+		AccessKeyID:     result.Credentials.AccessKeyID,
+		SecretAccessKey: result.Credentials.SecretAccessKey,
+		SessionToken:    result.Credentials.SessionToken,
+	}, nil
+}
+
+func (p *ecrProvider) authorizationToken(
+	ctx context.Context, cred *awsCredential, accountID, region, domain string,
+) (*types.DockerAuthConfig, error) {
+	body, _ := json.Marshal(map[string][]string{
+		"registryIds": {accountID},
+	})
+	host := fmt.Sprintf("api.ecr.%s.%s", region, domain)
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("ecr: %w", err)
+	}
+	req.Header.Set("Content-Type", ecrContentType)
+	req.Header.Set("X-Amz-Target", ecrTarget)
+	signRequest(req, body, cred, region, "ecr", time.Now().UTC())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ecr: failed to get authorization token: %w", err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ecr: failed to get authorization token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ecr: failed to get authorization token: %v: %s",
+			resp.Status, string(b))
+	}
+	result := struct {
+		AuthorizationData []struct {
+			AuthorizationToken string `json:"authorizationToken"`
+		} `json:"authorizationData"`
+	}{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, fmt.Errorf("ecr: failed to decode authorization token: %w", err)
+	}
+	if len(result.AuthorizationData) == 0 {
+		return nil, fmt.Errorf("ecr: empty authorization data received")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(
+		result.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return nil, fmt.Errorf("ecr: failed to decode authorization token: %w", err)
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil, fmt.Errorf("ecr: invalid authorization token format")
+	}
+	return &types.DockerAuthConfig{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+// signRequest signs the HTTP request with AWS Signature Version 4.
+func signRequest(
+	req *http.Request, body []byte, cred *awsCredential,
+	region, service string, now time.Time,
+) {
+	amzDate := now.Format(awsTimeFormat)
+	date := now.Format(awsDateFormat)
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if cred.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", cred.SessionToken)
+	}
+
+	// The signed headers should be in alphabetical order.
+	signedHeaders := []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+	if cred.SessionToken != "" {
+		signedHeaders = []string{
+			"content-type", "host", "x-amz-date",
+			"x-amz-security-token", "x-amz-target",
+		}
+	}
+	canonicalHeaders := strings.Builder{}
+	for _, h := range signedHeaders {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		canonicalHeaders.WriteString(fmt.Sprintf("%s:%s\n", h, strings.TrimSpace(v)))
+	}
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := strings.Join([]string{
+		awsSigningAlgo,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+cred.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigningAlgo, cred.AccessKeyID, scope,
+		strings.Join(signedHeaders, ";"), signature))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
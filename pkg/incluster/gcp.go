@@ -0,0 +1,105 @@
+package incluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/types"
+)
+
+const (
+	gcpMetadataHost     = "metadata.google.internal"
+	gcpTokenPath        = "/computeMetadata/v1/instance/service-accounts/default/token"
+	gcpAccessTokenUser  = "oauth2accesstoken"
+	gcpMetadataHostEnv  = "GCE_METADATA_HOST"
+	gcpMetadataFlavor   = "Metadata-Flavor"
+	gcpMetadataProvider = "Google"
+)
+
+// gcpProvider gets the GCR / Artifact Registry access token from the
+// GKE metadata server (Workload Identity).
+type gcpProvider struct {
+	client *http.Client
+	host   string
+}
+
+func newGCPProvider() *gcpProvider {
+	host := os.Getenv(gcpMetadataHostEnv)
+	if host == "" {
+		host = gcpMetadataHost
+	}
+	return &gcpProvider{
+		client: &http.Client{
+			Timeout: time.Second * 5,
+		},
+		host: host,
+	}
+}
+
+func (p *gcpProvider) Name() string {
+	return "GKE Workload Identity"
+}
+
+func (p *gcpProvider) Available(ctx context.Context) bool {
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet, fmt.Sprintf("http://%s", p.host), nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set(gcpMetadataFlavor, gcpMetadataProvider)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.Header.Get(gcpMetadataFlavor) == gcpMetadataProvider
+}
+
+// Match returns true if the registry is GCR or Artifact Registry:
+//
+//	gcr.io, us.gcr.io, asia-east1-docker.pkg.dev
+func (p *gcpProvider) Match(registry string) bool {
+	registry = strings.ToLower(registry)
+	return registry == "gcr.io" ||
+		strings.HasSuffix(registry, ".gcr.io") ||
+		strings.HasSuffix(registry, "-docker.pkg.dev")
+}
+
+func (p *gcpProvider) Credential(
+	ctx context.Context, registry string,
+) (*types.DockerAuthConfig, error) {
+	u := fmt.Sprintf("http://%s%s", p.host, gcpTokenPath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("gcp: %w", err)
+	}
+	req.Header.Set(gcpMetadataFlavor, gcpMetadataProvider)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("gcp: failed to get access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gcp: failed to get access token: %v", resp.Status)
+	}
+	token := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		TokenType   string `json:"token_type"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("gcp: failed to decode access token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("gcp: empty access token received")
+	}
+	return &types.DockerAuthConfig{
+		Username: gcpAccessTokenUser,
+		Password: token.AccessToken,
+	}, nil
+}
@@ -0,0 +1,80 @@
+package incluster
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNotInCluster       = errors.New("not running inside kubernetes cluster")
+	ErrProviderNotMatched = errors.New("no in-cluster credential provider matched")
+)
+
+// Provider provides the registry credential from the in-cluster
+// service account (ECR IRSA, GKE Workload Identity, etc.).
+type Provider interface {
+	// Name returns the name of the credential provider.
+	Name() string
+	// Available returns true if the provider can be used in current
+	// environment.
+	Available(ctx context.Context) bool
+	// Match returns true if the registry is supported by this provider.
+	Match(registry string) bool
+	// Credential gets the username and password of the registry.
+	Credential(ctx context.Context, registry string) (*types.DockerAuthConfig, error)
+}
+
+var providers = []Provider{
+	newECRProvider(),
+	newGCPProvider(),
+}
+
+// InCluster returns true if hangar is running inside a kubernetes pod.
+func InCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != "" &&
+		os.Getenv("KUBERNETES_SERVICE_PORT") != ""
+}
+
+// Detect returns the credential provider matches the registry.
+func Detect(ctx context.Context, registry string) (Provider, error) {
+	if !InCluster() {
+		return nil, ErrNotInCluster
+	}
+	for _, p := range providers {
+		if !p.Match(registry) {
+			continue
+		}
+		if !p.Available(ctx) {
+			logrus.Debugf("in-cluster credential provider %q not available",
+				p.Name())
+			continue
+		}
+		return p, nil
+	}
+	return nil, ErrProviderNotMatched
+}
+
+// Login gets the registry credential from the in-cluster service account
+// and stores it into the auth file of the system context.
+func Login(ctx context.Context, sysCtx *types.SystemContext, registry string) error {
+	p, err := Detect(ctx, registry)
+	if err != nil {
+		return err
+	}
+	auth, err := p.Credential(ctx, registry)
+	if err != nil {
+		return err
+	}
+	if _, err := config.SetCredentials(
+		sysCtx, registry, auth.Username, auth.Password); err != nil {
+		return err
+	}
+	logrus.Infof("Logged into %q using in-cluster %s credential",
+		registry, p.Name())
+	return nil
+}
@@ -0,0 +1,32 @@
+package incluster
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ecrProvider_Match(t *testing.T) {
+	p := newECRProvider()
+	assert.True(t, p.Match("123456789012.dkr.ecr.us-east-1.amazonaws.com"))
+	assert.True(t, p.Match("123456789012.dkr.ecr-fips.us-west-2.amazonaws.com"))
+	assert.True(t, p.Match("123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn"))
+	assert.False(t, p.Match("docker.io"))
+	assert.False(t, p.Match("12345.dkr.ecr.us-east-1.amazonaws.com"))
+}
+
+func Test_gcpProvider_Match(t *testing.T) {
+	p := newGCPProvider()
+	assert.True(t, p.Match("gcr.io"))
+	assert.True(t, p.Match("asia.gcr.io"))
+	assert.True(t, p.Match("us-central1-docker.pkg.dev"))
+	assert.False(t, p.Match("docker.io"))
+	assert.False(t, p.Match("quay.io"))
+}
+
+func Test_Detect(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	_, err := Detect(context.TODO(), "gcr.io")
+	assert.ErrorIs(t, err, ErrNotInCluster)
+}
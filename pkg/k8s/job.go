@@ -0,0 +1,230 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultWorkDir is the working directory of the hangar container,
+	// the archive PVC will be mounted to this directory.
+	DefaultWorkDir = "/hangar"
+	// DefaultConfigDir is the directory to mount the config map
+	// (image list files, policy files, etc.).
+	DefaultConfigDir = "/etc/hangar"
+	// dockerConfigPath is the path of the registry credential file
+	// mounted from the kubernetes.io/dockerconfigjson secret.
+	dockerConfigPath = "/root/.docker/config.json"
+)
+
+// JobOptions is the option to render the Job / CronJob manifest.
+type JobOptions struct {
+	// Name of the Job / CronJob.
+	Name string
+	// Namespace of the Job / CronJob.
+	Namespace string
+	// Image is the hangar container image.
+	Image string
+	// Args is the hangar command arguments, example:
+	// mirror -f /etc/hangar/list.txt -d registry.example.io
+	Args []string
+	// Schedule is the cron schedule, render CronJob if not empty.
+	Schedule string
+	// ServiceAccount is the service account name of the pod,
+	// used for in-cluster registry credentials (ECR IRSA, GKE WI).
+	ServiceAccount string
+	// RegistrySecret is the name of the kubernetes.io/dockerconfigjson
+	// secret stores the registry credentials.
+	RegistrySecret string
+	// ConfigMap is the name of the config map stores the image list files.
+	ConfigMap string
+	// PVC is the name of the persistent volume claim to store archives.
+	PVC string
+	// BackoffLimit is the retry number of the Job.
+	BackoffLimit int32
+}
+
+// GenerateJob renders the Job (or CronJob if the schedule is specified)
+// manifest in YAML format to run hangar inside kubernetes cluster.
+func GenerateJob(o *JobOptions) ([]byte, error) {
+	if o == nil {
+		return nil, fmt.Errorf("k8s.GenerateJob: option is nil")
+	}
+	if o.Name == "" {
+		return nil, fmt.Errorf("k8s.GenerateJob: name is empty")
+	}
+	if o.Image == "" {
+		return nil, fmt.Errorf("k8s.GenerateJob: image is empty")
+	}
+	if len(o.Args) == 0 {
+		return nil, fmt.Errorf("k8s.GenerateJob: hangar command not provided")
+	}
+
+	jobSpec := batchv1.JobSpec{
+		BackoffLimit: &o.BackoffLimit,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: labels(o.Name),
+			},
+			Spec: podSpec(o),
+		},
+	}
+	var obj any
+	if o.Schedule != "" {
+		obj = &batchv1.CronJob{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "batch/v1",
+				Kind:       "CronJob",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      o.Name,
+				Namespace: o.Namespace,
+				Labels:    labels(o.Name),
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule:          o.Schedule,
+				ConcurrencyPolicy: batchv1.ForbidConcurrent,
+				JobTemplate: batchv1.JobTemplateSpec{
+					Spec: jobSpec,
+				},
+			},
+		}
+	} else {
+		obj = &batchv1.Job{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "batch/v1",
+				Kind:       "Job",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      o.Name,
+				Namespace: o.Namespace,
+				Labels:    labels(o.Name),
+			},
+			Spec: jobSpec,
+		}
+	}
+	b, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("k8s.GenerateJob: %w", err)
+	}
+	return b, nil
+}
+
+func labels(name string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":       "hangar",
+		"app.kubernetes.io/instance":   name,
+		"app.kubernetes.io/managed-by": "hangar",
+	}
+}
+
+func podSpec(o *JobOptions) corev1.PodSpec {
+	container := corev1.Container{
+		Name:       "hangar",
+		Image:      o.Image,
+		Command:    []string{"hangar"},
+		Args:       o.Args,
+		WorkingDir: DefaultWorkDir,
+		Env: []corev1.EnvVar{
+			{
+				Name:  "HOME",
+				Value: "/root",
+			},
+		},
+	}
+	spec := corev1.PodSpec{
+		RestartPolicy:      corev1.RestartPolicyNever,
+		ServiceAccountName: o.ServiceAccount,
+	}
+	if o.RegistrySecret != "" {
+		spec.Volumes = append(spec.Volumes, corev1.Volume{
+			Name: "registry-credential",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: o.RegistrySecret,
+					Items: []corev1.KeyToPath{
+						{
+							Key:  corev1.DockerConfigJsonKey,
+							Path: "config.json",
+						},
+					},
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "registry-credential",
+			MountPath: dockerConfigPath,
+			SubPath:   "config.json",
+			ReadOnly:  true,
+		})
+	}
+	if o.ConfigMap != "" {
+		spec.Volumes = append(spec.Volumes, corev1.Volume{
+			Name: "config",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: o.ConfigMap,
+					},
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "config",
+			MountPath: DefaultConfigDir,
+			ReadOnly:  true,
+		})
+	}
+	if o.PVC != "" {
+		spec.Volumes = append(spec.Volumes, corev1.Volume{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: o.PVC,
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "data",
+			MountPath: DefaultWorkDir,
+		})
+	} else {
+		spec.Volumes = append(spec.Volumes, corev1.Volume{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "data",
+			MountPath: DefaultWorkDir,
+		})
+	}
+	spec.Containers = []corev1.Container{container}
+	return spec
+}
+
+// JobName converts the string to a valid kubernetes object name.
+func JobName(s string) string {
+	s = strings.ToLower(s)
+	b := strings.Builder{}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-':
+			b.WriteRune(c)
+		default:
+			b.WriteRune('-')
+		}
+	}
+	name := strings.Trim(b.String(), "-")
+	if len(name) > 52 {
+		// CronJob name should be no more than 52 characters.
+		name = strings.TrimRight(name[:52], "-")
+	}
+	return name
+}
@@ -0,0 +1,46 @@
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GenerateJob(t *testing.T) {
+	_, err := GenerateJob(&JobOptions{})
+	assert.NotNil(t, err)
+
+	b, err := GenerateJob(&JobOptions{
+		Name:           "hangar-mirror",
+		Namespace:      "default",
+		Image:          "cnrancher/hangar:latest",
+		Args:           []string{"mirror", "-f", "/etc/hangar/list.txt", "-d", "registry.example.io"},
+		RegistrySecret: "registry-auth",
+		ConfigMap:      "image-list",
+		PVC:            "hangar-data",
+	})
+	assert.Nil(t, err)
+	s := string(b)
+	assert.True(t, strings.Contains(s, "kind: Job"))
+	assert.True(t, strings.Contains(s, "claimName: hangar-data"))
+	assert.True(t, strings.Contains(s, "secretName: registry-auth"))
+	assert.True(t, strings.Contains(s, "mountPath: /etc/hangar"))
+
+	b, err = GenerateJob(&JobOptions{
+		Name:     "hangar-sync",
+		Image:    "cnrancher/hangar:latest",
+		Args:     []string{"sync", "-f", "/etc/hangar/list.txt", "-d", "saved.zip"},
+		Schedule: "0 0 * * *",
+	})
+	assert.Nil(t, err)
+	s = string(b)
+	assert.True(t, strings.Contains(s, "kind: CronJob"))
+	assert.True(t, strings.Contains(s, "emptyDir: {}"))
+}
+
+func Test_JobName(t *testing.T) {
+	assert.Equal(t, "hangar-mirror", JobName("Hangar_Mirror"))
+	assert.Equal(t, "mirror-v2-8-0", JobName("-mirror-v2.8.0-"))
+	assert.Equal(t, 52, len(JobName(strings.Repeat("a", 60))))
+}
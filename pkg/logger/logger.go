@@ -0,0 +1,102 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	nested "github.com/antonfisher/nested-logrus-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/writer"
+)
+
+const (
+	// WorkerField is the log field of the worker ID.
+	WorkerField = "WORKER"
+	// ImageField is the log field of the image (job) ID.
+	ImageField = "IMG"
+)
+
+// FieldsOrder is the order of the log fields output by the formatter.
+var FieldsOrder = []string{WorkerField, ImageField}
+
+type entryKey struct{}
+
+// WithFields returns a copy of ctx carrying the log entry with fields,
+// the fields of the log entry in parent context are inherited.
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	return context.WithValue(ctx, entryKey{}, FromContext(ctx).WithFields(fields))
+}
+
+// WithWorker returns a copy of ctx carrying the worker ID log field.
+func WithWorker(ctx context.Context, id int) context.Context {
+	return WithFields(ctx, logrus.Fields{WorkerField: id})
+}
+
+// FromContext returns the log entry stored in ctx, the entry of the
+// standard logger is returned if not found.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if ctx != nil {
+		if entry, ok := ctx.Value(entryKey{}).(*logrus.Entry); ok {
+			return entry
+		}
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// Options is the options of the log file.
+type Options struct {
+	// File is the log file path, log file is disabled if empty.
+	File string
+	// MaxSize is the max size in MiB of the log file before rotation,
+	// the log file will not be rotated if MaxSize <= 0.
+	MaxSize int
+	// MaxBackups is the max number of rotated log files to retain.
+	MaxBackups int
+}
+
+// SetupFile adds a hook to write the logs of all levels into the log file
+// with size-based rotation. Needs to call Close() method of the returned
+// io.Closer to flush the log file.
+func SetupFile(o *Options) (io.Closer, error) {
+	if o.File == "" {
+		return io.NopCloser(nil), nil
+	}
+	w, err := NewRotateWriter(o.File, int64(o.MaxSize)*1024*1024, o.MaxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("logger.SetupFile: %w", err)
+	}
+	logrus.AddHook(&fileHook{
+		Hook: writer.Hook{
+			Writer:    w,
+			LogLevels: logrus.AllLevels,
+		},
+		formatter: &nested.Formatter{
+			HideKeys:        false,
+			NoColors:        true,
+			TimestampFormat: "2006-01-02 15:04:05",
+			FieldsOrder:     FieldsOrder,
+		},
+	})
+	return w, nil
+}
+
+// fileHook writes the log entry formatted without colors into file.
+type fileHook struct {
+	writer.Hook
+	formatter logrus.Formatter
+}
+
+func (h *fileHook) Fire(entry *logrus.Entry) error {
+	if m := StripColor(entry.Message); m != entry.Message {
+		e := *entry
+		e.Message = m
+		entry = &e
+	}
+	b, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	_, err = h.Writer.Write(b)
+	return err
+}
@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FromContext(t *testing.T) {
+	entry := FromContext(context.Background())
+	assert.Empty(t, entry.Data)
+
+	ctx := WithWorker(context.Background(), 3)
+	ctx = WithFields(ctx, logrus.Fields{ImageField: 12})
+	entry = FromContext(ctx)
+	assert.Equal(t, 3, entry.Data[WorkerField])
+	assert.Equal(t, 12, entry.Data[ImageField])
+}
+
+func Test_RotateWriter(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "hangar.log")
+	w, err := NewRotateWriter(p, 10, 2)
+	assert.Nil(t, err)
+
+	for _, s := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		_, err = w.Write([]byte(s))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, w.Close())
+
+	b, _ := os.ReadFile(p)
+	assert.Equal(t, "dddddddd\n", string(b))
+	b, _ = os.ReadFile(p + ".1")
+	assert.Equal(t, "cccccccc\n", string(b))
+	b, _ = os.ReadFile(p + ".2")
+	assert.Equal(t, "bbbbbbbb\n", string(b))
+	_, err = os.Stat(p + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = w.Write([]byte("closed"))
+	assert.NotNil(t, err)
+	b, _ = os.ReadFile(p)
+	assert.False(t, strings.Contains(string(b), "closed"))
+}
@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"syscall"
+
+	nested "github.com/antonfisher/nested-logrus-formatter"
+	"github.com/moby/term"
+	"github.com/sirupsen/logrus"
+)
+
+// Color modes of the command output.
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+// ANSI color codes.
+const (
+	Red    = "31"
+	Green  = "32"
+	Yellow = "33"
+	Cyan   = "36"
+	Bold   = "1"
+)
+
+var (
+	colorEnabled = true
+	ansiRegexp   = regexp.MustCompile("\x1b\\[[0-9;]*m")
+)
+
+// SetColor sets the color mode of the command output, the color is
+// disabled in auto mode if the NO_COLOR environment variable is set or
+// the output is not terminal.
+func SetColor(mode string) error {
+	switch mode {
+	case ColorAlways:
+		colorEnabled = true
+	case ColorNever:
+		colorEnabled = false
+	case ColorAuto, "":
+		colorEnabled = os.Getenv("NO_COLOR") == "" &&
+			term.IsTerminal(uintptr(syscall.Stdout)) &&
+			term.IsTerminal(uintptr(syscall.Stderr))
+	default:
+		return fmt.Errorf("invalid color mode %q, available: %s, %s, %s",
+			mode, ColorAuto, ColorAlways, ColorNever)
+	}
+	if f, ok := logrus.StandardLogger().Formatter.(*nested.Formatter); ok {
+		f.NoColors = !colorEnabled
+	}
+	return nil
+}
+
+// ColorEnabled returns true if the command output is colorized.
+func ColorEnabled() bool {
+	return colorEnabled
+}
+
+// Colorize returns the string wrapped with the ANSI color codes if color
+// is enabled.
+func Colorize(s string, codes ...string) string {
+	if !colorEnabled || len(codes) == 0 {
+		return s
+	}
+	c := ""
+	for i, code := range codes {
+		if i > 0 {
+			c += ";"
+		}
+		c += code
+	}
+	return "\x1b[" + c + "m" + s + "\x1b[0m"
+}
+
+// StripColor removes the ANSI color codes from the string.
+func StripColor(s string) string {
+	return ansiRegexp.ReplaceAllString(s, "")
+}
+
+// Section outputs the section title (plan, progress, summary, etc.)
+// of the command output.
+func Section(title string) {
+	logrus.Info(Colorize("==> "+title, Bold, Cyan))
+}
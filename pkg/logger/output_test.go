@@ -0,0 +1,21 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Colorize(t *testing.T) {
+	assert.Nil(t, SetColor(ColorAlways))
+	assert.True(t, ColorEnabled())
+	s := Colorize("FAILED", Bold, Red)
+	assert.Equal(t, "\x1b[1;31mFAILED\x1b[0m", s)
+	assert.Equal(t, "FAILED", StripColor(s))
+
+	assert.Nil(t, SetColor(ColorNever))
+	assert.False(t, ColorEnabled())
+	assert.Equal(t, "FAILED", Colorize("FAILED", Red))
+
+	assert.NotNil(t, SetColor("invalid"))
+}
@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotateWriter is a thread-safe log file writer with size-based rotation.
+//
+// When the log file size exceeds the max size, the log file is renamed to
+// 'FILE.1', the existing 'FILE.N' is renamed to 'FILE.N+1' and the file
+// exceeds the max backups is deleted.
+type RotateWriter struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewRotateWriter opens the log file in append mode, the log file will not be
+// rotated if maxSize <= 0.
+func NewRotateWriter(path string, maxSize int64, maxBackups int) (*RotateWriter, error) {
+	w := &RotateWriter{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *RotateWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	w.f = f
+	w.size = fi.Size()
+	return nil
+}
+
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return 0, os.ErrClosed
+	}
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *RotateWriter) rotate() error {
+	if err := w.f.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	w.f = nil
+	if w.maxBackups <= 0 {
+		if err := os.Remove(w.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove log file: %w", err)
+		}
+		return w.open()
+	}
+	os.Remove(w.backupName(w.maxBackups))
+	for i := w.maxBackups - 1; i > 0; i-- {
+		if _, err := os.Stat(w.backupName(i)); err != nil {
+			continue
+		}
+		if err := os.Rename(w.backupName(i), w.backupName(i+1)); err != nil {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+	if err := os.Rename(w.path, w.backupName(1)); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	return w.open()
+}
+
+func (w *RotateWriter) backupName(i int) string {
+	return fmt.Sprintf("%s.%d", w.path, i)
+}
+
+// Close closes the log file.
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
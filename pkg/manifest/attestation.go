@@ -0,0 +1,34 @@
+package manifest
+
+import (
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// AnnotationReferenceType is the annotation of the BuildKit attestation
+	// manifest descriptor in the image index.
+	AnnotationReferenceType = "vnd.docker.reference.type"
+	// AnnotationReferenceDigest is the digest of the image manifest
+	// (subject) described by the attestation manifest.
+	AnnotationReferenceDigest = "vnd.docker.reference.digest"
+	// ReferenceTypeAttestation is the value of the reference type
+	// annotation of the attestation manifest.
+	ReferenceTypeAttestation = "attestation-manifest"
+)
+
+// IsAttestation returns true if the annotations of the index descriptor
+// belong to the BuildKit attestation manifest (unknown/unknown platform).
+func IsAttestation(annotations map[string]string) bool {
+	return annotations[AnnotationReferenceType] == ReferenceTypeAttestation
+}
+
+// IsAttestation returns true if the image is an attestation manifest.
+func (p *Image) IsAttestation() bool {
+	return IsAttestation(p.Annotations)
+}
+
+// Subject returns the digest of the image manifest described by the
+// attestation manifest.
+func (p *Image) Subject() digest.Digest {
+	return digest.Digest(p.Annotations[AnnotationReferenceDigest])
+}
@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/cnrancher/hangar/pkg/backoff"
+	"github.com/cnrancher/hangar/pkg/logger"
 	"github.com/containers/common/pkg/retry"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/transports/alltransports"
 	"github.com/containers/image/v5/types"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // Builder is the builder to build DockerV2ListMediaType manifest.
@@ -22,6 +26,11 @@ type Builder struct {
 	images Images
 	// systemContext
 	systemContext *types.SystemContext
+	// annotations of the manifest index
+	annotations map[string]string
+	// fallbackSchema2List pushes the schema2 list if the OCI index
+	// is rejected
+	fallbackSchema2List bool
 
 	maxRetry int
 	delay    time.Duration
@@ -30,6 +39,12 @@ type Builder struct {
 type BuilderOpts struct {
 	ReferenceName string
 	SystemContext *types.SystemContext
+	// Annotations of the manifest index, the OCI image index is built
+	// if not empty.
+	Annotations map[string]string
+	// FallbackSchema2List pushes the Docker schema2 manifest list without
+	// the annotations if the registry rejects the OCI image index.
+	FallbackSchema2List bool
 	// The number of times to possibly retry.
 	MaxRetry int
 	// The delay to use between retries, if set.
@@ -47,8 +62,11 @@ func NewBuilder(o *BuilderOpts) (*Builder, error) {
 		reference:     ref,
 		images:        nil,
 		systemContext: o.SystemContext,
+		annotations:   o.Annotations,
 		maxRetry:      o.MaxRetry,
 		delay:         o.Delay,
+
+		fallbackSchema2List: o.FallbackSchema2List,
 	}
 	if b.systemContext == nil {
 		b.systemContext = &types.SystemContext{}
@@ -66,7 +84,11 @@ func (b *Builder) Add(p *Image) {
 	if b.images.Contains(p) {
 		return
 	}
-	if i := b.images.FindPlatformIndex(&p.platform); i >= 0 {
+	if p.IsAttestation() {
+		if i := b.images.FindAttestationIndex(p.Subject()); i >= 0 {
+			b.images = append(b.images[:i], b.images[i+1:]...)
+		}
+	} else if i := b.images.FindPlatformIndex(&p.platform); i >= 0 {
 		b.images = append(b.images[:i], b.images[i+1:]...)
 	}
 	b.images = append(b.images, p)
@@ -80,38 +102,41 @@ func (b *Builder) Push(ctx context.Context) error {
 	if len(b.images) == 0 {
 		return fmt.Errorf("manifest builder: no images added to builder")
 	}
-	list := manifest.Schema2List{
-		SchemaVersion: 2,
-		MediaType:     manifest.DockerV2ListMediaType,
-		Manifests:     make([]manifest.Schema2ManifestDescriptor, 0),
+	var (
+		d   []byte
+		oci bool
+		err error
+	)
+	images := b.images.withoutStaleAttestations()
+	if images.hasAnnotations() || len(b.annotations) != 0 {
+		d, err = ociIndex(images, b.annotations)
+		oci = true
+	} else {
+		d, err = schema2List(images)
+	}
+	if err != nil {
+		return fmt.Errorf("manifest builder: %w", err)
 	}
 
-	for _, img := range b.images {
-		s2desc := manifest.Schema2ManifestDescriptor{
-			Schema2Descriptor: manifest.Schema2Descriptor{
-				MediaType: img.MediaType,
-				Size:      img.Size,
-				Digest:    img.Digest,
-			},
-			Platform: manifest.Schema2PlatformSpec{
-				Architecture: img.platform.arch,
-				OS:           img.platform.os,
-				Variant:      img.platform.variant,
-				OSVersion:    img.platform.osVersion,
-				OSFeatures:   img.platform.osFeatures,
-			},
-		}
-		list.Manifests = append(list.Manifests, s2desc)
+	err = b.put(ctx, d)
+	if err == nil || !oci || !b.fallbackSchema2List {
+		return err
 	}
-	d, err := json.MarshalIndent(list, "", "  ")
-	if err != nil {
+	logger.FromContext(ctx).Warnf("Registry rejected the OCI image index [%v]: %v, "+
+		"push Docker manifest list without annotations instead", b.name, err)
+	if d, err = schema2List(images); err != nil {
 		return fmt.Errorf("manifest builder: %w", err)
 	}
+	return b.put(ctx, d)
+}
 
+// put pushes the manifest index to the registry.
+func (b *Builder) put(ctx context.Context, d []byte) error {
 	var (
 		dest types.ImageDestination
+		err  error
 	)
-	if err = retry.IfNecessary(ctx, func() error {
+	if err = backoff.IfNecessary(ctx, func() error {
 		dest, err = b.reference.NewImageDestination(ctx, b.systemContext)
 		return err
 	}, &retry.Options{
@@ -121,7 +146,7 @@ func (b *Builder) Push(ctx context.Context) error {
 		return fmt.Errorf("manifest builder: %w", err)
 	}
 	defer dest.Close()
-	if err = retry.IfNecessary(ctx, func() error {
+	if err = backoff.IfNecessary(ctx, func() error {
 		return dest.PutManifest(ctx, d, nil)
 	}, &retry.Options{
 		MaxRetry: b.maxRetry,
@@ -131,3 +156,59 @@ func (b *Builder) Push(ctx context.Context) error {
 	}
 	return nil
 }
+
+func schema2List(images Images) ([]byte, error) {
+	list := manifest.Schema2List{
+		SchemaVersion: 2,
+		MediaType:     manifest.DockerV2ListMediaType,
+		Manifests:     make([]manifest.Schema2ManifestDescriptor, 0),
+	}
+	for _, img := range images {
+		s2desc := manifest.Schema2ManifestDescriptor{
+			Schema2Descriptor: manifest.Schema2Descriptor{
+				MediaType: img.MediaType,
+				Size:      img.Size,
+				Digest:    img.Digest,
+			},
+			Platform: manifest.Schema2PlatformSpec{
+				Architecture: img.platform.arch,
+				OS:           img.platform.os,
+				Variant:      img.platform.variant,
+				OSVersion:    img.platform.osVersion,
+				OSFeatures:   img.platform.osFeatures,
+			},
+		}
+		list.Manifests = append(list.Manifests, s2desc)
+	}
+	return json.MarshalIndent(list, "", "  ")
+}
+
+// ociIndex builds the OCI image index to keep the descriptor annotations
+// (the subject relationships of the attestation manifests) and the
+// annotations of the index.
+func ociIndex(images Images, annotations map[string]string) ([]byte, error) {
+	index := imgspecv1.Index{
+		Versioned: imgspecs.Versioned{
+			SchemaVersion: 2,
+		},
+		MediaType:   imgspecv1.MediaTypeImageIndex,
+		Manifests:   make([]imgspecv1.Descriptor, 0),
+		Annotations: annotations,
+	}
+	for _, img := range images {
+		index.Manifests = append(index.Manifests, imgspecv1.Descriptor{
+			MediaType:   img.MediaType,
+			Size:        img.Size,
+			Digest:      img.Digest,
+			Annotations: img.Annotations,
+			Platform: &imgspecv1.Platform{
+				Architecture: img.platform.arch,
+				OS:           img.platform.os,
+				Variant:      img.platform.variant,
+				OSVersion:    img.platform.osVersion,
+				OSFeatures:   img.platform.osFeatures,
+			},
+		})
+	}
+	return json.MarshalIndent(index, "", "  ")
+}
@@ -0,0 +1,174 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/backoff"
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// ImageDetail is the manifest, platforms, configs and layers of the image.
+type ImageDetail struct {
+	Name string `json:"name"`
+	// Digest is the digest of the manifest (list), empty if the manifest
+	// list is not stored (e.g. the image in hangar archive).
+	Digest    digest.Digest     `json:"digest,omitempty"`
+	MediaType string            `json:"mediaType,omitempty"`
+	Platforms []*PlatformDetail `json:"platforms"`
+}
+
+// PlatformDetail is the manifest, config and layers of the image of the
+// platform.
+type PlatformDetail struct {
+	// Platform in 'os/arch[/variant]' format.
+	Platform  string         `json:"platform"`
+	Digest    digest.Digest  `json:"digest"`
+	MediaType string         `json:"mediaType"`
+	Config    digest.Digest  `json:"config,omitempty"`
+	Created   *time.Time     `json:"created,omitempty"`
+	Layers    []*LayerDetail `json:"layers"`
+	// Size is the compressed size of the config and layers.
+	Size int64 `json:"size"`
+}
+
+// LayerDetail is the digest, media type and compressed size of the layer.
+type LayerDetail struct {
+	Digest    digest.Digest `json:"digest"`
+	MediaType string        `json:"mediaType,omitempty"`
+	// Size is -1 if unknown (e.g. Docker schema1 layers).
+	Size int64 `json:"size"`
+}
+
+// NewPlatformDetail returns the detail of the image manifest, the config
+// blob is read by getBlob to get the platform and the created time.
+func NewPlatformDetail(
+	b []byte, mime string, getBlob func(digest.Digest) ([]byte, error),
+) (*PlatformDetail, error) {
+	if mime == "" {
+		mime = manifest.GuessMIMEType(b)
+	}
+	m, err := manifest.FromBlob(b, mime)
+	if err != nil {
+		return nil, err
+	}
+	dgst, err := manifest.Digest(b)
+	if err != nil {
+		return nil, err
+	}
+	info, err := m.Inspect(func(bi types.BlobInfo) ([]byte, error) {
+		return getBlob(bi.Digest)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect manifest %v: %w", dgst, err)
+	}
+	d := &PlatformDetail{
+		Platform:  platformString(info.Os, info.Architecture, info.Variant),
+		Digest:    dgst,
+		MediaType: mime,
+		Created:   info.Created,
+		Layers:    []*LayerDetail{},
+	}
+	config := m.ConfigInfo()
+	if config.Digest != "" {
+		d.Config = config.Digest
+		d.Size += max(config.Size, 0)
+	}
+	for _, l := range m.LayerInfos() {
+		d.Layers = append(d.Layers, &LayerDetail{
+			Digest:    l.Digest,
+			MediaType: l.MediaType,
+			Size:      l.Size,
+		})
+		d.Size += max(l.Size, 0)
+	}
+	return d, nil
+}
+
+// Detail returns the manifest, platforms, configs and layers of the
+// image, the manifests of all platforms of the manifest list are
+// inspected.
+func (ins *Inspector) Detail(ctx context.Context) (*ImageDetail, error) {
+	b, mime, err := ins.Raw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dgst, err := manifest.Digest(b)
+	if err != nil {
+		return nil, err
+	}
+	detail := &ImageDetail{
+		Name:      ins.name,
+		Digest:    dgst,
+		MediaType: mime,
+		Platforms: []*PlatformDetail{},
+	}
+	getBlob := func(d digest.Digest) ([]byte, error) {
+		return ins.blob(ctx, d)
+	}
+	if !manifest.MIMETypeIsMultiImage(mime) {
+		p, err := NewPlatformDetail(b, mime, getBlob)
+		if err != nil {
+			return nil, err
+		}
+		detail.Platforms = append(detail.Platforms, p)
+		return detail, nil
+	}
+	list, err := manifest.ListFromBlob(b, mime)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range list.Instances() {
+		var (
+			mb    []byte
+			mmime string
+		)
+		if err = backoff.IfNecessary(ctx, func() error {
+			mb, mmime, err = ins.source.GetManifest(ctx, &d)
+			return err
+		}, &retry.Options{
+			MaxRetry: ins.maxRetry,
+			Delay:    ins.delay,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to get manifest %v: %w", d, err)
+		}
+		p, err := NewPlatformDetail(mb, mmime, getBlob)
+		if err != nil {
+			return nil, fmt.Errorf("manifest %v: %w", d, err)
+		}
+		p.Digest = d
+		detail.Platforms = append(detail.Platforms, p)
+	}
+	return detail, nil
+}
+
+// blob reads the small blob (e.g. image config) of the image and
+// verifies the digest.
+func (ins *Inspector) blob(ctx context.Context, d digest.Digest) ([]byte, error) {
+	var b []byte
+	err := backoff.IfNecessary(ctx, func() error {
+		rc, _, err := ins.source.GetBlob(ctx, types.BlobInfo{Digest: d, Size: -1}, none.NoCache)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		b, err = io.ReadAll(rc)
+		return err
+	}, &retry.Options{
+		MaxRetry: ins.maxRetry,
+		Delay:    ins.delay,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob %v: %w", d, err)
+	}
+	if d.Algorithm().FromBytes(b) != d {
+		return nil, fmt.Errorf("blob %v: digest mismatch", d)
+	}
+	return b, nil
+}
@@ -0,0 +1,48 @@
+package manifest
+
+import (
+	_ "crypto/sha512" // Register the sha384 & sha512 digest algorithms.
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/opencontainers/go-digest"
+)
+
+// Digest calculates the digest of the manifest by the digest algorithm,
+// the canonical (sha256) algorithm is used if the algorithm is empty.
+func Digest(b []byte, algorithm digest.Algorithm) (digest.Digest, error) {
+	if algorithm == "" || algorithm == digest.Canonical {
+		return manifest.Digest(b)
+	}
+	if !algorithm.Available() {
+		return "", fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+	if manifest.GuessMIMEType(b) == manifest.DockerV2Schema1SignedMediaType {
+		// The schema1 signed manifest is only addressed by sha256 digest.
+		return "", fmt.Errorf("unsupported digest algorithm %q for schema1 manifest", algorithm)
+	}
+	return algorithm.FromBytes(b), nil
+}
+
+// ReferenceAlgorithm returns the digest algorithm of the digested image
+// reference name (IMAGE@ALGORITHM:ENCODED), returns the canonical (sha256)
+// algorithm if the reference is not digested.
+func ReferenceAlgorithm(referenceName string) digest.Algorithm {
+	i := strings.LastIndex(referenceName, "@")
+	if i < 0 {
+		return digest.Canonical
+	}
+	d, err := digest.Parse(referenceName[i+1:])
+	if err != nil {
+		return digest.Canonical
+	}
+	return d.Algorithm()
+}
+
+// IsSchema1 returns true if the MIME type is the Docker schema1 manifest,
+// whose digest is always changed after converted to schema2 during copy.
+func IsSchema1(mime string) bool {
+	return mime == manifest.DockerV2Schema1MediaType ||
+		mime == manifest.DockerV2Schema1SignedMediaType
+}
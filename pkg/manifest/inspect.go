@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/cnrancher/hangar/pkg/backoff"
 	"github.com/containers/common/pkg/retry"
 	"github.com/containers/image/v5/image"
 	"github.com/containers/image/v5/transports/alltransports"
@@ -90,7 +91,7 @@ func (ins *Inspector) Raw(ctx context.Context) ([]byte, string, error) {
 		mime string
 		err  error
 	)
-	if err = retry.IfNecessary(ctx, func() error {
+	if err = backoff.IfNecessary(ctx, func() error {
 		b, mime, err = ins.source.GetManifest(ctx, nil)
 		return err
 	}, &retry.Options{
@@ -107,7 +108,7 @@ func (ins *Inspector) Config(ctx context.Context) ([]byte, error) {
 		img types.Image
 		err error
 	)
-	if err = retry.IfNecessary(ctx, func() error {
+	if err = backoff.IfNecessary(ctx, func() error {
 		img, err = image.FromUnparsedImage(
 			ctx, ins.systemContext, image.UnparsedInstance(ins.source, nil))
 		return err
@@ -125,7 +126,7 @@ func (ins *Inspector) ConfigInfo(ctx context.Context) (*types.BlobInfo, error) {
 		img types.Image
 		err error
 	)
-	if err = retry.IfNecessary(ctx, func() error {
+	if err = backoff.IfNecessary(ctx, func() error {
 		img, err = image.FromUnparsedImage(
 			ctx, ins.systemContext, image.UnparsedInstance(ins.source, nil))
 		return err
@@ -148,7 +149,7 @@ func (ins *Inspector) Inspect(ctx context.Context) (*types.ImageInspectInfo, err
 	var (
 		info *types.ImageInspectInfo
 	)
-	if err = retry.IfNecessary(ctx, func() error {
+	if err = backoff.IfNecessary(ctx, func() error {
 		var err error
 		info, err = image.Inspect(ctx)
 		return err
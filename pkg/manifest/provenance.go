@@ -0,0 +1,43 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// AnnotationSource is the source image reference of the manifest
+	// index pushed by hangar.
+	AnnotationSource = "io.cattle.hangar.source"
+	// AnnotationSourceDigest is the source manifest digest of the
+	// manifest index pushed by hangar, it is also annotated on the
+	// descriptor of the manifest whose digest was changed by the
+	// destination registry on push.
+	AnnotationSourceDigest = "io.cattle.hangar.source.digest"
+	// AnnotationRunID is the ID of the hangar run which pushed the
+	// manifest index.
+	AnnotationRunID = "io.cattle.hangar.run.id"
+
+	// hangarAnnotationPrefix is the prefix of the annotations managed
+	// by hangar.
+	hangarAnnotationPrefix = "io.cattle.hangar."
+)
+
+// ParseAnnotations parses the custom manifest index annotations from the
+// 'KEY=VALUE' format strings, the annotations managed by hangar
+// ('io.cattle.hangar.*') are not allowed.
+func ParseAnnotations(s []string) (map[string]string, error) {
+	annotations := make(map[string]string, len(s))
+	for _, a := range s {
+		k, v, ok := strings.Cut(a, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid annotation %q, should be 'KEY=VALUE'", a)
+		}
+		if strings.HasPrefix(k, hangarAnnotationPrefix) {
+			return nil, fmt.Errorf("annotation %q is reserved by hangar", k)
+		}
+		annotations[k] = v
+	}
+	return annotations, nil
+}
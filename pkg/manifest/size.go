@@ -0,0 +1,138 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cnrancher/hangar/pkg/backoff"
+	"github.com/containers/common/pkg/retry"
+	"github.com/containers/image/v5/manifest"
+	"github.com/opencontainers/go-digest"
+)
+
+// PlatformSize is the compressed size of the image of the platform.
+type PlatformSize struct {
+	// Platform in 'os/arch[/variant]' format.
+	Platform string        `json:"platform"`
+	Digest   digest.Digest `json:"digest"`
+	// Layers is the number of the layers.
+	Layers     int   `json:"layers"`
+	ConfigSize int64 `json:"configSize"`
+	LayersSize int64 `json:"layersSize"`
+	// Size is the sum of the config and layers size.
+	Size int64 `json:"size"`
+}
+
+// SizeInfo is the compressed size of the image across the platforms.
+type SizeInfo struct {
+	Platforms []PlatformSize `json:"platforms"`
+	// Total is the sum of the size of all platforms.
+	Total int64 `json:"total"`
+	// Unique is the size of the deduplicated blobs of all platforms,
+	// which is the actual size transferred when copying the image.
+	Unique int64 `json:"unique"`
+}
+
+// Size returns the compressed size of the config and layers of the image
+// by the manifest, the blobs are not downloaded.
+func (ins *Inspector) Size(ctx context.Context) (*SizeInfo, error) {
+	b, mime, err := ins.Raw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info := &SizeInfo{}
+	blobs := map[digest.Digest]int64{}
+	if !manifest.MIMETypeIsMultiImage(mime) {
+		dgst, err := manifest.Digest(b)
+		if err != nil {
+			return nil, err
+		}
+		s, err := platformSize(b, mime, blobs)
+		if err != nil {
+			return nil, err
+		}
+		i, err := ins.Inspect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.Platform = platformString(i.Os, i.Architecture, i.Variant)
+		s.Digest = dgst
+		info.add(s)
+	} else {
+		list, err := manifest.ListFromBlob(b, mime)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range list.Instances() {
+			instance, err := list.Instance(d)
+			if err != nil {
+				return nil, err
+			}
+			var (
+				mb    []byte
+				mmime string
+			)
+			if err = backoff.IfNecessary(ctx, func() error {
+				mb, mmime, err = ins.source.GetManifest(ctx, &d)
+				return err
+			}, &retry.Options{
+				MaxRetry: ins.maxRetry,
+				Delay:    ins.delay,
+			}); err != nil {
+				return nil, fmt.Errorf("failed to get manifest %v: %w", d, err)
+			}
+			s, err := platformSize(mb, mmime, blobs)
+			if err != nil {
+				return nil, fmt.Errorf("manifest %v: %w", d, err)
+			}
+			if p := instance.ReadOnly.Platform; p != nil {
+				s.Platform = platformString(p.OS, p.Architecture, p.Variant)
+			}
+			s.Digest = d
+			info.add(s)
+		}
+	}
+	for _, size := range blobs {
+		info.Unique += size
+	}
+	return info, nil
+}
+
+func (info *SizeInfo) add(s PlatformSize) {
+	info.Platforms = append(info.Platforms, s)
+	info.Total += s.Size
+}
+
+// platformSize returns the size of the image manifest, the blob sizes
+// are recorded into the blobs map for deduplication.
+func platformSize(b []byte, mime string, blobs map[digest.Digest]int64) (PlatformSize, error) {
+	m, err := manifest.FromBlob(b, mime)
+	if err != nil {
+		return PlatformSize{}, err
+	}
+	s := PlatformSize{}
+	config := m.ConfigInfo()
+	if config.Size > 0 {
+		s.ConfigSize = config.Size
+		blobs[config.Digest] = config.Size
+	}
+	for _, l := range m.LayerInfos() {
+		s.Layers++
+		if l.Size <= 0 {
+			// The size of the schema1 layers is unknown.
+			continue
+		}
+		s.LayersSize += l.Size
+		blobs[l.Digest] = l.Size
+	}
+	s.Size = s.ConfigSize + s.LayersSize
+	return s, nil
+}
+
+// platformString returns the platform in 'os/arch[/variant]' format.
+func platformString(os, arch, variant string) string {
+	if variant == "" {
+		return os + "/" + arch
+	}
+	return os + "/" + arch + "/" + variant
+}
@@ -18,7 +18,10 @@ type Image struct {
 	Size      int64
 	Digest    digest.Digest
 	MediaType string
-	platform  manifestPlatform
+	// Annotations of the image descriptor, the manifest index will be
+	// built as OCI image index if any image has annotations.
+	Annotations map[string]string
+	platform    manifestPlatform
 }
 
 func NewImageByInspect(
@@ -41,7 +44,8 @@ func NewImageByInspect(
 	case manifest.DockerV2ListMediaType, imgspecv1.MediaTypeImageIndex:
 		return nil, fmt.Errorf("unsupoorted to add %q to manifest builder", mime)
 	}
-	digest, err := manifest.Digest(b)
+	// Calculate the digest by the same algorithm of the digested reference.
+	digest, err := Digest(b, ReferenceAlgorithm(referenceName))
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate image digest: %w", err)
 	}
@@ -179,6 +183,9 @@ func (images Images) FindPlatformIndex(p *manifestPlatform) int {
 		return -1
 	}
 	for i, img := range images {
+		if img.IsAttestation() {
+			continue
+		}
 		if img.platform.equal(p) {
 			return i
 		}
@@ -186,6 +193,40 @@ func (images Images) FindPlatformIndex(p *manifestPlatform) int {
 	return -1
 }
 
+// hasAnnotations returns true if any image has descriptor annotations.
+func (images Images) hasAnnotations() bool {
+	for _, img := range images {
+		if len(img.Annotations) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutStaleAttestations removes the attestation manifests whose subject
+// image is not in the images (replaced by the new copied image).
+func (images Images) withoutStaleAttestations() Images {
+	result := make(Images, 0, len(images))
+	for _, img := range images {
+		if img.IsAttestation() && !images.ContainDigest(img.Subject()) {
+			continue
+		}
+		result = append(result, img)
+	}
+	return result
+}
+
+// FindAttestationIndex returns the index of the attestation manifest of
+// the subject image digest.
+func (images Images) FindAttestationIndex(subject digest.Digest) int {
+	for i, img := range images {
+		if img.IsAttestation() && img.Subject() == subject {
+			return i
+		}
+	}
+	return -1
+}
+
 func (images Images) Equal(d Images) bool {
 	if len(images) != len(d) {
 		return false
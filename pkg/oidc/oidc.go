@@ -0,0 +1,292 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	grantTypeDeviceCode   = "urn:ietf:params:oauth:grant-type:device_code"
+	grantTypeRefreshToken = "refresh_token"
+	wellKnownPath         = "/.well-known/openid-configuration"
+)
+
+// defaultPollInterval is the poll interval of the token endpoint if the
+// interval is not provided by the device authorization response.
+var defaultPollInterval = time.Second * 5
+
+var (
+	ErrAccessDenied = errors.New("oidc: authorization request was denied")
+	ErrExpiredToken = errors.New("oidc: device code expired")
+)
+
+// Endpoints is the OAuth endpoints used by the device authorization flow.
+type Endpoints struct {
+	DeviceAuthorization string `json:"device_authorization_endpoint"`
+	Token               string `json:"token_endpoint"`
+}
+
+// DeviceCode is the device authorization response (RFC 8628 section 3.2).
+type DeviceCode struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval,omitempty"`
+}
+
+// Token is the access token response (RFC 6749 section 5.1).
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	IDToken      string    `json:"id_token,omitempty"`
+	ExpiresIn    int       `json:"expires_in,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// Expired returns true if the token is expired or will expire in leeway.
+func (t *Token) Expired(leeway time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return true
+	}
+	if t.Expiry.IsZero() {
+		return false
+	}
+	return time.Now().Add(leeway).After(t.Expiry)
+}
+
+// tokenError is the error response of the token endpoint.
+type tokenError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// DeviceFlow implements the OAuth 2.0 device authorization grant.
+type DeviceFlow struct {
+	// Issuer is the OIDC issuer URL, used to discover the endpoints
+	// if the endpoints are not specified.
+	Issuer string
+	// ClientID is the OAuth client ID.
+	ClientID string
+	// Scopes is the requested OAuth scopes.
+	Scopes []string
+	// Endpoints of the authorization server (optional).
+	Endpoints Endpoints
+
+	client *http.Client
+}
+
+func NewDeviceFlow(issuer, clientID string, scopes []string) *DeviceFlow {
+	return &DeviceFlow{
+		Issuer:   issuer,
+		ClientID: clientID,
+		Scopes:   scopes,
+		client: &http.Client{
+			Timeout: time.Second * 30,
+		},
+	}
+}
+
+// Discover gets the device authorization and token endpoint from the
+// OIDC discovery document of the issuer.
+func (f *DeviceFlow) Discover(ctx context.Context) error {
+	if f.Endpoints.DeviceAuthorization != "" && f.Endpoints.Token != "" {
+		return nil
+	}
+	if f.Issuer == "" {
+		return fmt.Errorf("oidc: issuer not provided")
+	}
+	u := strings.TrimSuffix(f.Issuer, "/") + wellKnownPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("oidc: %w", err)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("oidc: failed to get discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("oidc: failed to read discovery document: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: get discovery document failed: %v: %v",
+			resp.Status, string(b))
+	}
+	e := Endpoints{}
+	if err := json.Unmarshal(b, &e); err != nil {
+		return fmt.Errorf("oidc: failed to decode discovery document: %w", err)
+	}
+	if e.DeviceAuthorization == "" {
+		return fmt.Errorf("oidc: issuer %q does not support device authorization flow",
+			f.Issuer)
+	}
+	if e.Token == "" {
+		return fmt.Errorf("oidc: token endpoint of issuer %q not found", f.Issuer)
+	}
+	f.Endpoints = e
+	return nil
+}
+
+// Authorize requests the device code and user code.
+func (f *DeviceFlow) Authorize(ctx context.Context) (*DeviceCode, error) {
+	if err := f.Discover(ctx); err != nil {
+		return nil, err
+	}
+	values := url.Values{}
+	values.Set("client_id", f.ClientID)
+	if len(f.Scopes) != 0 {
+		values.Set("scope", strings.Join(f.Scopes, " "))
+	}
+	code := &DeviceCode{}
+	status, b, err := f.postForm(ctx, f.Endpoints.DeviceAuthorization, values)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: device authorization failed: %v: %v",
+			status, string(b))
+	}
+	if err := json.Unmarshal(b, code); err != nil {
+		return nil, fmt.Errorf("oidc: failed to decode device code: %w", err)
+	}
+	if code.DeviceCode == "" || code.UserCode == "" {
+		return nil, fmt.Errorf("oidc: invalid device authorization response")
+	}
+	return code, nil
+}
+
+// Poll polls the token endpoint until the user completes the authorization,
+// the device code expires or the context is canceled.
+func (f *DeviceFlow) Poll(ctx context.Context, code *DeviceCode) (*Token, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	if code.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(code.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+
+	values := url.Values{}
+	values.Set("grant_type", grantTypeDeviceCode)
+	values.Set("device_code", code.DeviceCode)
+	values.Set("client_id", f.ClientID)
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrExpiredToken
+			}
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		token, tokenErr, err := f.requestToken(ctx, values)
+		if err != nil {
+			return nil, err
+		}
+		if token != nil {
+			return token, nil
+		}
+		switch tokenErr.Error {
+		case "authorization_pending":
+		case "slow_down":
+			interval += time.Second * 5
+		case "access_denied":
+			return nil, ErrAccessDenied
+		case "expired_token":
+			return nil, ErrExpiredToken
+		default:
+			return nil, fmt.Errorf("oidc: request token failed: %v: %v",
+				tokenErr.Error, tokenErr.Description)
+		}
+	}
+}
+
+// Refresh gets a new access token by using the refresh token.
+func (f *DeviceFlow) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	if err := f.Discover(ctx); err != nil {
+		return nil, err
+	}
+	values := url.Values{}
+	values.Set("grant_type", grantTypeRefreshToken)
+	values.Set("refresh_token", refreshToken)
+	values.Set("client_id", f.ClientID)
+	token, tokenErr, err := f.requestToken(ctx, values)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, fmt.Errorf("oidc: refresh token failed: %v: %v",
+			tokenErr.Error, tokenErr.Description)
+	}
+	if token.RefreshToken == "" {
+		// Refresh token is not rotated by the authorization server.
+		token.RefreshToken = refreshToken
+	}
+	return token, nil
+}
+
+// requestToken requests the token endpoint, returns the token if succeed,
+// or the token error response if the server returns an OAuth error.
+func (f *DeviceFlow) requestToken(
+	ctx context.Context, values url.Values,
+) (*Token, *tokenError, error) {
+	status, b, err := f.postForm(ctx, f.Endpoints.Token, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	if status != http.StatusOK {
+		tokenErr := &tokenError{}
+		if err := json.Unmarshal(b, tokenErr); err != nil || tokenErr.Error == "" {
+			return nil, nil, fmt.Errorf("oidc: request token failed: %v: %v",
+				status, string(b))
+		}
+		return nil, tokenErr, nil
+	}
+	token := &Token{}
+	if err := json.Unmarshal(b, token); err != nil {
+		return nil, nil, fmt.Errorf("oidc: failed to decode token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, nil, fmt.Errorf("oidc: access token not found in token response")
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token, nil, nil
+}
+
+func (f *DeviceFlow) postForm(
+	ctx context.Context, u string, values url.Values,
+) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, u, strings.NewReader(values.Encode()))
+	if err != nil {
+		return 0, nil, fmt.Errorf("oidc: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("oidc: %w", err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("oidc: failed to read response: %w", err)
+	}
+	return resp.StatusCode, b, nil
+}
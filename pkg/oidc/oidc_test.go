@@ -0,0 +1,120 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var (
+		server *httptest.Server
+		polled int
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc(wellKnownPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Endpoints{
+			DeviceAuthorization: server.URL + "/device",
+			Token:               server.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "hangar", r.FormValue("client_id"))
+		assert.Equal(t, "openid offline_access", r.FormValue("scope"))
+		json.NewEncoder(w).Encode(DeviceCode{
+			DeviceCode:      "device-code",
+			UserCode:        "ABCD-EFGH",
+			VerificationURI: server.URL + "/verify",
+			ExpiresIn:       60,
+			Interval:        0,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("grant_type") {
+		case grantTypeDeviceCode:
+			assert.Equal(t, "device-code", r.FormValue("device_code"))
+			polled++
+			if polled < 2 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(tokenError{Error: "authorization_pending"})
+				return
+			}
+			json.NewEncoder(w).Encode(Token{
+				AccessToken:  "access-1",
+				RefreshToken: "refresh-1",
+				ExpiresIn:    300,
+			})
+		case grantTypeRefreshToken:
+			if r.FormValue("refresh_token") != "refresh-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(tokenError{Error: "invalid_grant"})
+				return
+			}
+			json.NewEncoder(w).Encode(Token{
+				AccessToken: "access-2",
+				ExpiresIn:   300,
+			})
+		}
+	})
+	server = httptest.NewServer(mux)
+	return server
+}
+
+func Test_DeviceFlow(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	f := NewDeviceFlow(server.URL, "hangar", []string{"openid", "offline_access"})
+	code, err := f.Authorize(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, "ABCD-EFGH", code.UserCode)
+
+	// Use a short poll interval in test.
+	defaultPollInterval = time.Millisecond * 10
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*30)
+	defer cancel()
+	token, err := f.Poll(ctx, code)
+	assert.Nil(t, err)
+	assert.Equal(t, "access-1", token.AccessToken)
+	assert.False(t, token.Expired(time.Minute))
+	assert.True(t, token.Expired(time.Hour))
+
+	token, err = f.Refresh(context.TODO(), "refresh-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "access-2", token.AccessToken)
+	assert.Equal(t, "refresh-1", token.RefreshToken)
+
+	_, err = f.Refresh(context.TODO(), "invalid")
+	assert.NotNil(t, err)
+}
+
+func Test_Session(t *testing.T) {
+	t.Setenv("HANGAR_OIDC_DIR", t.TempDir())
+
+	_, err := LoadSession("quay.example.io")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+
+	s := &Session{
+		Registry: "quay.example.io",
+		ClientID: "hangar",
+		Username: DefaultUsername,
+		Token: &Token{
+			AccessToken:  "access",
+			RefreshToken: "refresh",
+		},
+	}
+	assert.Nil(t, s.Save())
+	l, err := LoadSession("quay.example.io")
+	assert.Nil(t, err)
+	assert.Equal(t, s, l)
+
+	assert.Nil(t, DeleteSession("quay.example.io"))
+	_, err = LoadSession("quay.example.io")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
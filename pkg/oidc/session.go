@@ -0,0 +1,223 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultUsername is the username used when logging into the registry
+// with the OAuth access token.
+const DefaultUsername = "$oauthtoken"
+
+// refreshLeeway is the duration before the token expiry to refresh token.
+const refreshLeeway = time.Minute * 5
+
+var ErrSessionNotFound = errors.New("oidc: session not found")
+
+// Session is the device flow login session of the registry, the refresh
+// token is stored in the session file instead of the registry auth file.
+type Session struct {
+	Registry  string    `json:"registry"`
+	Issuer    string    `json:"issuer,omitempty"`
+	ClientID  string    `json:"clientID"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	Endpoints Endpoints `json:"endpoints"`
+	Username  string    `json:"username"`
+	Token     *Token    `json:"token"`
+}
+
+// sessionDir returns the directory to store the session files,
+// the HANGAR_OIDC_DIR environment variable overrides the default directory.
+func sessionDir() (string, error) {
+	if d := os.Getenv("HANGAR_OIDC_DIR"); d != "" {
+		return d, nil
+	}
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("oidc: %w", err)
+	}
+	return filepath.Join(d, "hangar", "oidc"), nil
+}
+
+func sessionFile(registry string) (string, error) {
+	d, err := sessionDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, utils.Sha256Sum(registry)+".json"), nil
+}
+
+// LoadSession loads the login session of the registry.
+func LoadSession(registry string) (*Session, error) {
+	name, err := sessionFile(registry)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("oidc: failed to read session: %w", err)
+	}
+	s := &Session{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("oidc: failed to decode session %q: %w", name, err)
+	}
+	return s, nil
+}
+
+// Save writes the session into the session file, the session file is only
+// readable by the current user.
+func (s *Session) Save() error {
+	name, err := sessionFile(s.Registry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return fmt.Errorf("oidc: %w", err)
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("oidc: %w", err)
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("oidc: failed to write session: %w", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("oidc: failed to write session: %w", err)
+	}
+	return nil
+}
+
+// DeleteSession deletes the login session of the registry.
+func DeleteSession(registry string) error {
+	name, err := sessionFile(registry)
+	if err != nil {
+		return err
+	}
+	return utils.DeleteIfExist(name)
+}
+
+func (s *Session) flow() *DeviceFlow {
+	f := NewDeviceFlow(s.Issuer, s.ClientID, s.Scopes)
+	f.Endpoints = s.Endpoints
+	return f
+}
+
+// setCredentials stores the access token into the registry auth file.
+func (s *Session) setCredentials(sysCtx *types.SystemContext) error {
+	if _, err := config.SetCredentials(
+		sysCtx, s.Registry, s.Username, s.Token.AccessToken); err != nil {
+		return fmt.Errorf("oidc: failed to set credential of %q: %w",
+			s.Registry, err)
+	}
+	return nil
+}
+
+// LoginOptions is the options of the device flow login.
+type LoginOptions struct {
+	Issuer   string
+	ClientID string
+	Scopes   []string
+	// Username used to login the registry with access token,
+	// DefaultUsername is used if not provided.
+	Username string
+	// Stdout to output the verification URI and user code.
+	Stdout io.Writer
+}
+
+// Login logs into the registry by OAuth device authorization flow.
+// The access token is stored in the registry auth file and the refresh
+// token is stored in the session file for refreshing the access token.
+func Login(
+	ctx context.Context, sysCtx *types.SystemContext, registry string, o *LoginOptions,
+) error {
+	if o.ClientID == "" {
+		return fmt.Errorf("oidc: client ID not provided")
+	}
+	s := &Session{
+		Registry: registry,
+		Issuer:   o.Issuer,
+		ClientID: o.ClientID,
+		Scopes:   o.Scopes,
+		Username: o.Username,
+	}
+	if s.Username == "" {
+		s.Username = DefaultUsername
+	}
+	out := o.Stdout
+	if out == nil {
+		out = os.Stdout
+	}
+
+	f := s.flow()
+	code, err := f.Authorize(ctx)
+	if err != nil {
+		return err
+	}
+	if code.VerificationURIComplete != "" {
+		fmt.Fprintf(out, "Open the following URL in browser to login:\n\n\t%s\n\n",
+			code.VerificationURIComplete)
+	} else {
+		fmt.Fprintf(out, "Open %s in browser and enter code: %s\n",
+			code.VerificationURI, code.UserCode)
+	}
+	fmt.Fprintf(out, "Waiting for authorization...\n")
+	s.Token, err = f.Poll(ctx, code)
+	if err != nil {
+		return err
+	}
+	s.Endpoints = f.Endpoints
+	if err := s.setCredentials(sysCtx); err != nil {
+		return err
+	}
+	if s.Token.RefreshToken == "" {
+		logrus.Warnf("Refresh token not provided by %q, need to login again after the token expired",
+			f.Endpoints.Token)
+	}
+	if err := s.Save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Login Succeeded!\n")
+	return nil
+}
+
+// Refresh refreshes the access token of the registry if the registry was
+// logged in by device flow and the access token is going to expire.
+// ErrSessionNotFound is returned if the registry has no device flow session.
+func Refresh(ctx context.Context, sysCtx *types.SystemContext, registry string) error {
+	s, err := LoadSession(registry)
+	if err != nil {
+		return err
+	}
+	if !s.Token.Expired(refreshLeeway) {
+		return nil
+	}
+	if s.Token == nil || s.Token.RefreshToken == "" {
+		return fmt.Errorf("oidc: access token of %q expired and no refresh token available, login again",
+			registry)
+	}
+	logrus.Debugf("refreshing OAuth access token of %q", registry)
+	token, err := s.flow().Refresh(ctx, s.Token.RefreshToken)
+	if err != nil {
+		return err
+	}
+	s.Token = token
+	if err := s.setCredentials(sysCtx); err != nil {
+		return err
+	}
+	return s.Save()
+}
@@ -0,0 +1,111 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/incluster"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// imageMirrorResource is the GroupVersionResource of the ImageMirror.
+var imageMirrorResource = schema.GroupVersionResource{
+	Group:    Group,
+	Version:  Version,
+	Resource: Resource,
+}
+
+// Client is the kubernetes client to watch the ImageMirror resources and
+// update the status subresource.
+type Client struct {
+	dynamic dynamic.Interface
+}
+
+// NewClient creates the client of the kubernetes API server.
+func NewClient(config *rest.Config) (*Client, error) {
+	d, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	return &Client{
+		dynamic: d,
+	}, nil
+}
+
+// NewInClusterClient creates the client by using the service account
+// of the pod. The service account token file is re-read periodically
+// so the rotated bound token is used after the old one expired.
+func NewInClusterClient() (*Client, error) {
+	if !incluster.InCluster() {
+		return nil, incluster.ErrNotInCluster
+	}
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load in-cluster config: %w", err)
+	}
+	return NewClient(config)
+}
+
+func (c *Client) resource(namespace string) dynamic.ResourceInterface {
+	r := c.dynamic.Resource(imageMirrorResource)
+	if namespace == "" {
+		return r
+	}
+	return r.Namespace(namespace)
+}
+
+// newInformer creates the informer watching the ImageMirror resources in
+// the namespace, watches all namespaces if namespace is empty.
+func (c *Client) newInformer(namespace string, resync time.Duration) cache.SharedIndexInformer {
+	return dynamicinformer.NewFilteredDynamicInformer(
+		c.dynamic,
+		imageMirrorResource,
+		namespace,
+		resync,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		nil,
+	).Informer()
+}
+
+// UpdateStatus updates the status subresource of the ImageMirror.
+func (c *Client) UpdateStatus(ctx context.Context, im *ImageMirror) error {
+	b, err := json.Marshal(map[string]any{
+		"status": im.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %w", err)
+	}
+	_, err = c.resource(im.Namespace).Patch(
+		ctx, im.Name, types.MergePatchType, b, metav1.PatchOptions{}, "status")
+	if err != nil {
+		return fmt.Errorf("failed to update status of %s/%s: %w",
+			im.Namespace, im.Name, err)
+	}
+	return nil
+}
+
+// fromUnstructured converts the object received from the informer into
+// the ImageMirror.
+func fromUnstructured(obj any) (*ImageMirror, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+	im := &ImageMirror{}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), im)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s %s/%s: %w",
+			Kind, u.GetNamespace(), u.GetName(), err)
+	}
+	return im, nil
+}
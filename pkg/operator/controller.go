@@ -0,0 +1,355 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/cnrancher/hangar/pkg/hangar/imagelist"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// ControllerOpts is the option of the ImageMirror controller.
+type ControllerOpts struct {
+	// Client is the kubernetes API client.
+	Client *Client
+	// Namespace to watch, watch all namespaces if empty.
+	Namespace string
+	// Resync is the interval to re-check the schedule of the watched
+	// ImageMirror resources.
+	Resync time.Duration
+	// Workers is the number of ImageMirror resources reconciled
+	// concurrently, default 2.
+	Workers int
+	// Timeout when mirror each images.
+	Timeout time.Duration
+
+	SystemContext *types.SystemContext
+	Policy        *signature.Policy
+}
+
+// Controller reconciles the ImageMirror resources by mirroring
+// the images and reporting the per-image state in status.
+type Controller struct {
+	client    *Client
+	namespace string
+	resync    time.Duration
+	timeout   time.Duration
+	workers   int
+	sysCtx    *types.SystemContext
+	policy    *signature.Policy
+
+	informer cache.SharedIndexInformer
+	queue    workqueue.RateLimitingInterface
+
+	// mirror runs the mirror job of the ImageMirror.
+	mirror func(ctx context.Context, im *ImageMirror) (*hangar.Summary, error)
+}
+
+func NewController(o *ControllerOpts) (*Controller, error) {
+	if o.Client == nil {
+		return nil, fmt.Errorf("operator.NewController: client is nil")
+	}
+	c := &Controller{
+		client:    o.Client,
+		namespace: o.Namespace,
+		resync:    o.Resync,
+		timeout:   o.Timeout,
+		workers:   o.Workers,
+		sysCtx:    o.SystemContext,
+		policy:    o.Policy,
+		queue:     workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+	if c.resync <= 0 {
+		c.resync = time.Minute
+	}
+	if c.workers <= 0 {
+		c.workers = 2
+	}
+	c.informer = c.client.newInformer(c.namespace, c.resync)
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		// The informer resyncs the objects every resync interval
+		// to re-check the schedule of the ImageMirror.
+		UpdateFunc: func(_, obj any) {
+			c.enqueue(obj)
+		},
+	})
+	c.mirror = c.runMirror
+	return c, nil
+}
+
+// Run watches the ImageMirror resources and reconciles them by the
+// workers until the context is canceled.
+func (c *Controller) Run(ctx context.Context) error {
+	defer c.queue.ShutDown()
+
+	logrus.Infof("Start watching %s (namespace %q, resync %v, workers %d)",
+		Resource, c.namespace, c.resync, c.workers)
+	go c.informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c.processNextItem(ctx) {
+			}
+		}()
+	}
+	<-ctx.Done()
+	c.queue.ShutDown()
+	wg.Wait()
+	return nil
+}
+
+func (c *Controller) enqueue(obj any) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		logrus.Warnf("failed to get key of %s: %v", Kind, err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// processNextItem reconciles the next ImageMirror in the queue, returns
+// false if the queue was shut down.
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	key, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.sync(ctx, key.(string)); err != nil {
+		logrus.Errorf("failed to reconcile %v: %v", key, err)
+		if ctx.Err() == nil {
+			c.queue.AddRateLimited(key)
+		}
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// sync reconciles the ImageMirror of the key in the informer cache if
+// the spec changed or the schedule interval elapsed.
+func (c *Controller) sync(ctx context.Context, key string) error {
+	obj, exists, err := c.informer.GetStore().GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// The ImageMirror was deleted.
+		return nil
+	}
+	im, err := fromUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	if !needsSync(im, time.Now()) {
+		return nil
+	}
+	return c.reconcile(ctx, im)
+}
+
+// reconcile mirrors the images of the ImageMirror and updates its status.
+func (c *Controller) reconcile(ctx context.Context, im *ImageMirror) error {
+	logrus.Infof("Reconciling %s %s/%s", Kind, im.Namespace, im.Name)
+	if err := validateSpec(&im.Spec); err != nil {
+		setReady(im, metav1.ConditionFalse, ReasonInvalid, err.Error())
+		im.Status.ObservedGeneration = im.Generation
+		return c.client.UpdateStatus(ctx, im)
+	}
+
+	summary, err := c.mirror(ctx, im)
+	if summary == nil {
+		summary = &hangar.Summary{}
+	}
+	updateStatus(im, summary, err)
+	return c.client.UpdateStatus(ctx, im)
+}
+
+func (c *Controller) runMirror(
+	ctx context.Context, im *ImageMirror,
+) (*hangar.Summary, error) {
+	spec := &im.Spec
+	arch, osList := spec.Arch, spec.OS
+	if len(arch) == 0 {
+		arch = []string{"amd64", "arm64"}
+	}
+	if len(osList) == 0 {
+		osList = []string{"linux"}
+	}
+	jobs := spec.Jobs
+	if jobs > utils.MaxWorkerNum || jobs < utils.MinWorkerNum {
+		jobs = 1
+	}
+	m, err := hangar.NewMirrorer(&hangar.MirrorerOpts{
+		CommonOpts: hangar.CommonOpts{
+			Images:        spec.Images,
+			Arch:          arch,
+			OS:            osList,
+			Timeout:       c.timeout,
+			Workers:       jobs,
+			SystemContext: c.sysCtx,
+			Policy:        c.policy,
+		},
+		SourceRegistry:      spec.Source,
+		SourceProject:       spec.SourceProject,
+		DestinationRegistry: spec.Destination,
+		DestinationProject:  spec.DestinationProject,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mirrorer: %w", err)
+	}
+	err = m.Run(ctx)
+	return m.Summary(), err
+}
+
+// needsSync returns true if the spec of the ImageMirror changed or the
+// schedule interval elapsed since the last sync.
+func needsSync(im *ImageMirror, now time.Time) bool {
+	if im.Spec.Suspend {
+		return false
+	}
+	if im.Status.ObservedGeneration != im.Generation ||
+		im.Status.LastSyncTime == nil {
+		return true
+	}
+	if im.Spec.Schedule == "" {
+		return false
+	}
+	interval, err := time.ParseDuration(im.Spec.Schedule)
+	if err != nil || interval <= 0 {
+		return false
+	}
+	return now.Sub(im.Status.LastSyncTime.Time) >= interval
+}
+
+func validateSpec(spec *ImageMirrorSpec) error {
+	if len(spec.Images) == 0 {
+		return fmt.Errorf("spec.images is empty")
+	}
+	if spec.Destination == "" {
+		return fmt.Errorf("spec.destination is empty")
+	}
+	if spec.Schedule != "" {
+		d, err := time.ParseDuration(spec.Schedule)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid spec.schedule %q: should be a positive duration (example: 6h)",
+				spec.Schedule)
+		}
+	}
+	return nil
+}
+
+// updateStatus updates the status of the ImageMirror by the summary of
+// the finished mirror job.
+func updateStatus(im *ImageMirror, summary *hangar.Summary, err error) {
+	now := metav1.Now()
+	im.Status.ObservedGeneration = im.Generation
+	im.Status.LastSyncTime = &now
+	im.Status.Images = imageConditions(&im.Spec, summary, err)
+	im.Status.Total = len(im.Status.Images)
+	im.Status.Failed = 0
+	for _, i := range im.Status.Images {
+		if !i.Ready {
+			im.Status.Failed++
+		}
+	}
+	im.Status.Succeeded = im.Status.Total - im.Status.Failed
+
+	switch {
+	case err == nil && im.Status.Failed == 0:
+		setReady(im, metav1.ConditionTrue, ReasonSynced,
+			fmt.Sprintf("%d images mirrored", im.Status.Total))
+	case errors.Is(err, hangar.ErrCopyFailed) || err == nil:
+		setReady(im, metav1.ConditionFalse, ReasonSyncFailed,
+			fmt.Sprintf("%d of %d images failed to mirror",
+				im.Status.Failed, im.Status.Total))
+	default:
+		setReady(im, metav1.ConditionFalse, ReasonSyncFailed, err.Error())
+	}
+}
+
+// imageConditions returns the per-image state of the image list.
+func imageConditions(
+	spec *ImageMirrorSpec, summary *hangar.Summary, err error,
+) []ImageCondition {
+	failed := make(map[string]bool, len(summary.FailedImages))
+	for _, i := range summary.FailedImages {
+		failed[i] = true
+	}
+	// The whole job failed before copying images.
+	jobFailed := err != nil && !errors.Is(err, hangar.ErrCopyFailed)
+
+	conditions := make([]ImageCondition, 0, len(spec.Images))
+	for _, line := range spec.Images {
+		c := ImageCondition{
+			Image: line,
+			Ready: true,
+		}
+		switch {
+		case failed[line] || failed[sourceName(spec, line)]:
+			c.Ready = false
+			c.Message = "failed to mirror image"
+		case jobFailed:
+			c.Ready = false
+			c.Message = err.Error()
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions
+}
+
+// sourceName returns the source reference name of the image list line
+// recorded as the failed image by the mirrorer.
+func sourceName(spec *ImageMirrorSpec, line string) string {
+	src := line
+	switch imagelist.Detect(line) {
+	case imagelist.TypeMirror:
+		s, _ := imagelist.GetMirrorSpec(line)
+		if len(s) != 3 {
+			return line
+		}
+		src = s[0]
+	case imagelist.TypePair:
+		src, _, _ = imagelist.GetPairSpec(line)
+	case imagelist.TypeChart:
+		src, _ = imagelist.GetChartSpec(line)
+	}
+	registry := utils.GetRegistryName(src)
+	if spec.Source != "" {
+		registry = spec.Source
+	}
+	project := utils.GetProjectName(src)
+	if spec.SourceProject != "" {
+		project = spec.SourceProject
+	}
+	return fmt.Sprintf("%s/%s/%s:%s", registry, project,
+		utils.GetImageName(src), utils.GetImageTag(src))
+}
+
+func setReady(im *ImageMirror, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&im.Status.Conditions, metav1.Condition{
+		Type:               ConditionReady,
+		Status:             status,
+		ObservedGeneration: im.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
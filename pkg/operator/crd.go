@@ -0,0 +1,14 @@
+package operator
+
+import (
+	_ "embed"
+)
+
+//go:embed crd.yaml
+var crdManifest []byte
+
+// CRD returns the CustomResourceDefinition manifest of the ImageMirror
+// in YAML format.
+func CRD() []byte {
+	return crdManifest
+}
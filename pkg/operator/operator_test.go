@@ -0,0 +1,161 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+func Test_needsSync(t *testing.T) {
+	now := time.Now()
+	last := metav1.NewTime(now.Add(-time.Hour))
+	im := &ImageMirror{}
+	im.Generation = 1
+	assert.True(t, needsSync(im, now))
+
+	im.Status.ObservedGeneration = 1
+	im.Status.LastSyncTime = &last
+	assert.False(t, needsSync(im, now))
+
+	im.Spec.Schedule = "2h"
+	assert.False(t, needsSync(im, now))
+	im.Spec.Schedule = "30m"
+	assert.True(t, needsSync(im, now))
+
+	im.Spec.Suspend = true
+	assert.False(t, needsSync(im, now))
+
+	im.Spec.Suspend = false
+	im.Generation = 2
+	im.Spec.Schedule = ""
+	assert.True(t, needsSync(im, now))
+}
+
+func Test_validateSpec(t *testing.T) {
+	assert.NotNil(t, validateSpec(&ImageMirrorSpec{}))
+	assert.NotNil(t, validateSpec(&ImageMirrorSpec{Images: []string{"nginx"}}))
+	assert.NotNil(t, validateSpec(&ImageMirrorSpec{
+		Images: []string{"nginx"}, Destination: "reg.io", Schedule: "0 0 * * *",
+	}))
+	assert.Nil(t, validateSpec(&ImageMirrorSpec{
+		Images: []string{"nginx"}, Destination: "reg.io", Schedule: "6h",
+	}))
+}
+
+func Test_sourceName(t *testing.T) {
+	spec := &ImageMirrorSpec{}
+	assert.Equal(t, "docker.io/library/nginx:latest", sourceName(spec, "nginx"))
+	assert.Equal(t, "docker.io/rancher/rancher:v2.8.0",
+		sourceName(spec, "rancher/rancher:v2.8.0"))
+
+	spec.Source = "reg.io"
+	spec.SourceProject = "mirror"
+	assert.Equal(t, "reg.io/mirror/nginx:1.25", sourceName(spec, "nginx:1.25"))
+}
+
+func Test_updateStatus(t *testing.T) {
+	im := &ImageMirror{
+		Spec: ImageMirrorSpec{
+			Images:      []string{"nginx", "busybox:1.36", "alpine"},
+			Destination: "reg.io",
+		},
+	}
+	im.Generation = 3
+	updateStatus(im, &hangar.Summary{
+		FailedImages: []string{"docker.io/library/busybox:1.36"},
+	}, hangar.ErrCopyFailed)
+	assert.Equal(t, int64(3), im.Status.ObservedGeneration)
+	assert.NotNil(t, im.Status.LastSyncTime)
+	assert.Equal(t, 3, im.Status.Total)
+	assert.Equal(t, 1, im.Status.Failed)
+	assert.Equal(t, 2, im.Status.Succeeded)
+	assert.True(t, im.Status.Images[0].Ready)
+	assert.False(t, im.Status.Images[1].Ready)
+	assert.Equal(t, 1, len(im.Status.Conditions))
+	assert.Equal(t, metav1.ConditionFalse, im.Status.Conditions[0].Status)
+	assert.Equal(t, ReasonSyncFailed, im.Status.Conditions[0].Reason)
+
+	updateStatus(im, &hangar.Summary{}, nil)
+	assert.Equal(t, 0, im.Status.Failed)
+	assert.Equal(t, 1, len(im.Status.Conditions))
+	assert.Equal(t, metav1.ConditionTrue, im.Status.Conditions[0].Status)
+	assert.Equal(t, ReasonSynced, im.Status.Conditions[0].Reason)
+}
+
+func Test_Controller_sync(t *testing.T) {
+	var patched map[string]ImageMirrorStatus
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch {
+		case r.Method == http.MethodPatch &&
+			r.URL.Path == "/apis/hangar.cattle.io/v1alpha1/namespaces/default/imagemirrors/a/status":
+			assert.True(t, strings.HasPrefix(r.Header.Get("Content-Type"),
+				string(types.MergePatchType)))
+			b, _ := io.ReadAll(r.Body)
+			assert.Nil(t, json.Unmarshal(b, &patched))
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"apiVersion":"hangar.cattle.io/v1alpha1","kind":"ImageMirror",
+"metadata":{"name":"a","namespace":"default"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&rest.Config{
+		Host:        server.URL,
+		BearerToken: "token",
+	})
+	assert.Nil(t, err)
+	c, err := NewController(&ControllerOpts{
+		Client:    client,
+		Namespace: "default",
+	})
+	assert.Nil(t, err)
+	var mirrored []string
+	c.mirror = func(_ context.Context, im *ImageMirror) (*hangar.Summary, error) {
+		mirrored = append(mirrored, im.Spec.Images...)
+		return &hangar.Summary{Total: 1, Succeeded: 1}, nil
+	}
+	newObject := func(namespace string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": Group + "/" + Version,
+			"kind":       Kind,
+			"metadata": map[string]any{
+				"name":       "a",
+				"namespace":  namespace,
+				"generation": int64(1),
+			},
+			"spec": map[string]any{
+				"images":      []any{"nginx"},
+				"destination": "reg.io",
+			},
+		}}
+	}
+	assert.Nil(t, c.informer.GetStore().Add(newObject("default")))
+	assert.Nil(t, c.sync(context.TODO(), "default/a"))
+	assert.Equal(t, []string{"nginx"}, mirrored)
+	assert.Equal(t, int64(1), patched["status"].ObservedGeneration)
+	assert.Equal(t, 1, patched["status"].Succeeded)
+
+	// The deleted ImageMirror is skipped.
+	mirrored = nil
+	assert.Nil(t, c.sync(context.TODO(), "default/b"))
+	assert.Nil(t, mirrored)
+
+	// Failed to update the status.
+	assert.Nil(t, c.informer.GetStore().Add(newObject("unknown")))
+	assert.NotNil(t, c.sync(context.TODO(), "unknown/a"))
+}
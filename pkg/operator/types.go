@@ -0,0 +1,94 @@
+package operator
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Group is the API group of the hangar custom resources.
+	Group = "hangar.cattle.io"
+	// Version is the API version of the hangar custom resources.
+	Version = "v1alpha1"
+	// Kind is the kind of the ImageMirror custom resource.
+	Kind = "ImageMirror"
+	// Resource is the plural resource name of the ImageMirror.
+	Resource = "imagemirrors"
+)
+
+const (
+	// ConditionReady is true if all images of the ImageMirror were
+	// mirrored to the destination registry.
+	ConditionReady = "Ready"
+
+	ReasonSynced     = "Synced"
+	ReasonSyncFailed = "SyncFailed"
+	ReasonInvalid    = "InvalidSpec"
+)
+
+// ImageMirror defines the image list to be mirrored from the source
+// registry to the destination registry.
+type ImageMirror struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ImageMirrorSpec   `json:"spec"`
+	Status ImageMirrorStatus `json:"status,omitempty"`
+}
+
+// ImageMirrorList is the list of ImageMirror.
+type ImageMirrorList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []ImageMirror `json:"items"`
+}
+
+// ImageMirrorSpec is the desired state of the ImageMirror.
+type ImageMirrorSpec struct {
+	// Images is the image list in the same format as the image list file
+	// of the mirror command.
+	Images []string `json:"images"`
+	// Source overrides the source registry of the image list.
+	Source string `json:"source,omitempty"`
+	// SourceProject overrides the source project of the image list.
+	SourceProject string `json:"sourceProject,omitempty"`
+	// Destination is the destination registry.
+	Destination string `json:"destination"`
+	// DestinationProject overrides the destination project of the images.
+	DestinationProject string `json:"destinationProject,omitempty"`
+	// Arch is the architecture list of images, default [amd64, arm64].
+	Arch []string `json:"arch,omitempty"`
+	// OS is the OS list of images, default [linux].
+	OS []string `json:"os,omitempty"`
+	// Jobs is the worker number, default 1.
+	Jobs int `json:"jobs,omitempty"`
+	// Schedule is the interval to re-sync the images (example: 6h).
+	// The images are only mirrored when the spec changed if not specified.
+	Schedule string `json:"schedule,omitempty"`
+	// Suspend stops reconciling the ImageMirror if true.
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// ImageMirrorStatus is the observed state of the ImageMirror.
+type ImageMirrorStatus struct {
+	// ObservedGeneration is the generation of the last mirrored spec.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastSyncTime is the finished time of the last mirror job.
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// Total, Succeeded and Failed are the image numbers of the last job.
+	Total     int `json:"total,omitempty"`
+	Succeeded int `json:"succeeded,omitempty"`
+	Failed    int `json:"failed,omitempty"`
+	// Conditions is the condition list of the ImageMirror.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Images is the per-image mirror state.
+	Images []ImageCondition `json:"images,omitempty"`
+}
+
+// ImageCondition is the mirror state of an image.
+type ImageCondition struct {
+	Image string `json:"image"`
+	Ready bool   `json:"ready"`
+	// Message is the failure reason of the image.
+	Message string `json:"message,omitempty"`
+}
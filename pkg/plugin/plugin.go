@@ -0,0 +1,130 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Prefix is the file name prefix of the hangar plugin executables.
+const Prefix = "hangar-"
+
+// Environment variables passed to the plugin.
+const (
+	EnvVersion     = "HANGAR_VERSION"
+	EnvBinary      = "HANGAR_BINARY"
+	EnvConfig      = "HANGAR_CONFIG"
+	EnvAuthFile    = "HANGAR_AUTH_FILE"
+	EnvHistoryFile = "HANGAR_HISTORY_FILE"
+)
+
+// Plugin is the hangar plugin executable found in PATH.
+type Plugin struct {
+	// Name is the subcommand name of the plugin, e.g. 'foo' for 'hangar-foo'
+	// and 'foo bar' for 'hangar-foo-bar'.
+	Name string
+	// Path is the path of the plugin executable.
+	Path string
+}
+
+// Lookup finds the plugin executable by the command line args, the longest
+// matched plugin name is used, e.g. 'hangar foo bar' will try 'hangar-foo-bar'
+// first and then 'hangar-foo'. Returns the plugin and the remaining args
+// passed to the plugin.
+func Lookup(args []string) (*Plugin, []string, bool) {
+	var parts []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") || !validName(arg) {
+			break
+		}
+		parts = append(parts, arg)
+	}
+	for i := len(parts); i > 0; i-- {
+		name := Prefix + strings.Join(parts[:i], "-")
+		path, err := exec.LookPath(name)
+		if err != nil {
+			continue
+		}
+		return &Plugin{
+			Name: strings.Join(parts[:i], " "),
+			Path: path,
+		}, args[i:], true
+	}
+	return nil, nil, false
+}
+
+// List returns the plugins found in PATH sorted by name, the plugins with
+// the same name in the latter PATH directories are ignored.
+func List() []*Plugin {
+	var plugins []*Plugin
+	found := map[string]bool{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasPrefix(e.Name(), Prefix) {
+				continue
+			}
+			name := strings.TrimPrefix(e.Name(), Prefix)
+			if name == "" || found[name] {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			if !isExecutable(path) {
+				continue
+			}
+			found[name] = true
+			plugins = append(plugins, &Plugin{
+				Name: strings.ReplaceAll(name, "-", " "),
+				Path: path,
+			})
+		}
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Name < plugins[j].Name
+	})
+	return plugins
+}
+
+// Exec replaces the current process with the plugin executable,
+// the env is appended to the environment variables of current process.
+func (p *Plugin) Exec(args []string, env map[string]string) error {
+	environ := os.Environ()
+	for k, v := range env {
+		environ = append(environ, k+"="+v)
+	}
+	argv := append([]string{p.Path}, args...)
+	if err := syscall.Exec(p.Path, argv, environ); err != nil {
+		return fmt.Errorf("failed to execute plugin %q: %w", p.Path, err)
+	}
+	return nil
+}
+
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
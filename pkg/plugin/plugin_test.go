@@ -0,0 +1,41 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Lookup(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"hangar-foo", "hangar-foo-bar"} {
+		assert.Nil(t, os.WriteFile(
+			filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0755))
+	}
+	// Not executable.
+	assert.Nil(t, os.WriteFile(
+		filepath.Join(dir, "hangar-baz"), []byte("#!/bin/sh\n"), 0644))
+	t.Setenv("PATH", dir)
+
+	p, args, ok := Lookup([]string{"foo", "bar", "--flag", "a"})
+	assert.True(t, ok)
+	assert.Equal(t, "foo bar", p.Name)
+	assert.Equal(t, []string{"--flag", "a"}, args)
+
+	p, args, ok = Lookup([]string{"foo", "baz"})
+	assert.True(t, ok)
+	assert.Equal(t, "foo", p.Name)
+	assert.Equal(t, []string{"baz"}, args)
+
+	_, _, ok = Lookup([]string{"baz"})
+	assert.False(t, ok)
+	_, _, ok = Lookup([]string{"--foo"})
+	assert.False(t, ok)
+
+	plugins := List()
+	assert.Equal(t, 2, len(plugins))
+	assert.Equal(t, "foo", plugins[0].Name)
+	assert.Equal(t, "foo bar", plugins[1].Name)
+}
@@ -0,0 +1,177 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/manifest"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTimeout = time.Second * 10
+)
+
+// Result is the health and latency probe result of the registry.
+type Result struct {
+	Registry string `json:"registry"`
+	// Reachable is true if the registry API responds the ping request.
+	Reachable bool `json:"reachable"`
+	// PingLatency is the latency of the registry API ping (/v2/).
+	PingLatency time.Duration `json:"pingLatency"`
+	// BlobLatency is the latency of getting the manifest and config blob
+	// of the sample image.
+	BlobLatency time.Duration `json:"blobLatency,omitempty"`
+	// Err is the error occurred when probing the registry.
+	Err error `json:"-"`
+}
+
+// Latency returns the total latency of the probe.
+func (r *Result) Latency() time.Duration {
+	return r.PingLatency + r.BlobLatency
+}
+
+// Healthy checks whether the registry is reachable and the latency is
+// less than the slow threshold (no limit if the threshold is 0).
+func (r *Result) Healthy(slow time.Duration) bool {
+	if !r.Reachable || r.Err != nil {
+		return false
+	}
+	return slow <= 0 || r.Latency() < slow
+}
+
+// Options is the probe options of the registry.
+type Options struct {
+	// Registry is the registry server name.
+	Registry string
+	// Image is the sample image of the registry to probe the manifest and
+	// blob latency, e.g. 'docker.io/library/nginx:latest'.
+	Image string
+	// SystemContext provides the credentials and TLS options.
+	SystemContext *types.SystemContext
+	// Timeout of the probe, default is 10s.
+	Timeout time.Duration
+}
+
+// Probe pings the registry API and gets the manifest and config blob of
+// the sample image to measure the latency of the registry.
+func Probe(ctx context.Context, o *Options) *Result {
+	timeout := o.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	r := &Result{
+		Registry: o.Registry,
+	}
+	insecure := utils.InsecureRegistry(o.SystemContext, o.Registry)
+	r.PingLatency, r.Err = Ping(ctx, o.Registry, insecure)
+	if r.Err != nil {
+		return r
+	}
+	r.Reachable = true
+	if o.Image == "" {
+		return r
+	}
+
+	start := time.Now()
+	inspector, err := manifest.NewInspector(ctx, &manifest.InspectorOption{
+		ReferenceName: "docker://" + o.Image,
+		SystemContext: o.SystemContext,
+		MaxRetry:      1,
+	})
+	if err != nil {
+		r.Err = fmt.Errorf("failed to inspect [%v]: %w", o.Image, err)
+		return r
+	}
+	defer inspector.Close()
+	if _, err = inspector.Config(ctx); err != nil {
+		r.Err = fmt.Errorf("failed to get config blob of [%v]: %w", o.Image, err)
+		return r
+	}
+	r.BlobLatency = time.Since(start)
+	return r
+}
+
+// Ping sends the registry API ping request (GET /v2/) and returns the
+// latency, the registry is reachable if responds 200 or 401 status.
+func Ping(ctx context.Context, registry string, insecure bool) (time.Duration, error) {
+	d, _, err := pingRegistry(ctx, registry, insecure)
+	return d, err
+}
+
+// Server sends the registry API ping request (GET /v2/) and returns the
+// Server header of the response, e.g. 'Nexus/3.61.0-02 (OSS)'.
+func Server(ctx context.Context, registry string, insecure bool) (string, error) {
+	_, header, err := pingRegistry(ctx, registry, insecure)
+	if err != nil {
+		return "", err
+	}
+	return header.Get("Server"), nil
+}
+
+func pingRegistry(
+	ctx context.Context, registry string, insecure bool,
+) (time.Duration, http.Header, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+		},
+	}
+	server := registry
+	if server == utils.DockerHubRegistry {
+		server = "registry-1.docker.io"
+	}
+	d, header, err := ping(ctx, client, "https://"+server+"/v2/")
+	if err != nil && insecure && errors.Is(err, http.ErrSchemeMismatch) {
+		d, header, err = ping(ctx, client, "http://"+server+"/v2/")
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to ping registry %q: %w", registry, err)
+	}
+	return d, header, nil
+}
+
+func ping(ctx context.Context, client *http.Client, u string) (time.Duration, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	d := time.Since(start)
+	resp.Body.Close()
+	logrus.Debugf("ping %s: %v (%v)", u, resp.Status, d)
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusUnauthorized:
+		return d, resp.Header, nil
+	}
+	return d, nil, fmt.Errorf("unexpected status %v", resp.Status)
+}
+
+// Sort sorts the probe results by health and latency, the healthy
+// registries with lower latency are in front.
+func Sort(results []*Result, slow time.Duration) {
+	sort.SliceStable(results, func(i, j int) bool {
+		hi, hj := results[i].Healthy(slow), results[j].Healthy(slow)
+		if hi != hj {
+			return hi
+		}
+		if results[i].Reachable != results[j].Reachable {
+			return results[i].Reachable
+		}
+		return results[i].Latency() < results[j].Latency()
+	})
+}
@@ -0,0 +1,60 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Ping(t *testing.T) {
+	status := http.StatusUnauthorized
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "Nexus/3.61.0-02 (OSS)")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	_, err := Ping(context.TODO(), registry, true)
+	assert.Nil(t, err)
+	status = http.StatusOK
+	_, err = Ping(context.TODO(), registry, true)
+	assert.Nil(t, err)
+	status = http.StatusNotFound
+	_, err = Ping(context.TODO(), registry, true)
+	assert.NotNil(t, err)
+
+	status = http.StatusUnauthorized
+	header, err := Server(context.TODO(), registry, true)
+	assert.Nil(t, err)
+	assert.Equal(t, "Nexus/3.61.0-02 (OSS)", header)
+	status = http.StatusNotFound
+
+	// Certificate of the test server is not trusted.
+	_, err = Ping(context.TODO(), registry, false)
+	assert.NotNil(t, err)
+}
+
+func Test_Sort(t *testing.T) {
+	results := []*Result{
+		{Registry: "unreachable.io", Err: assert.AnError},
+		{Registry: "slow.io", Reachable: true, PingLatency: time.Second * 5},
+		{Registry: "fast.io", Reachable: true, PingLatency: time.Millisecond * 10},
+		{Registry: "medium.io", Reachable: true, PingLatency: time.Millisecond * 500},
+	}
+	Sort(results, time.Second)
+	var registries []string
+	for _, r := range results {
+		registries = append(registries, r.Registry)
+	}
+	assert.Equal(t, []string{"fast.io", "medium.io", "slow.io", "unreachable.io"}, registries)
+	assert.True(t, results[0].Healthy(time.Second))
+	assert.False(t, results[2].Healthy(time.Second))
+	assert.True(t, results[2].Healthy(0))
+	assert.False(t, results[3].Healthy(0))
+}
@@ -0,0 +1,375 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/types"
+	"github.com/moby/term"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// Modes of the progress output.
+const (
+	ModeAuto  = "auto"
+	ModePlain = "plain"
+	ModeNone  = "none"
+)
+
+const (
+	// barInterval is the refresh interval of the interactive progress bars.
+	barInterval = time.Millisecond * 200
+	// plainInterval is the interval of the line-based progress logs.
+	plainInterval = time.Second * 10
+	// maxBars is the max number of the blob progress bars rendered, the
+	// remaining blobs are summarized in one line.
+	maxBars = 10
+	// barWidth is the width of the progress bar of the blob.
+	barWidth = 25
+	// labelWidth is the max width of the image name of the blob.
+	labelWidth = 40
+)
+
+// Reporter aggregates the blob download/upload progress of the image
+// copies across the workers, and renders the interactive progress bars
+// or the periodic line-based progress logs.
+type Reporter struct {
+	// interactive renders the progress bars into the terminal
+	interactive bool
+	out         io.Writer
+	width       int
+
+	mu sync.Mutex
+	// blobs is the blobs in flight in the order of the copy started
+	blobs []*blob
+	// total is the size of the blobs started, the unknown sizes are
+	// not included
+	total       int64
+	transferred int64
+	completed   int
+	skipped     int
+	startTime   time.Time
+	// lines is the number of the lines of the drawn progress bars
+	lines int
+	// logged is the transferred size of the last progress log
+	logged int64
+
+	nextID int
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// blob is the blob in flight.
+type blob struct {
+	tracker int
+	image   string
+	digest  digest.Digest
+	// size is -1 if unknown
+	size   int64
+	offset int64
+}
+
+// New creates and starts the progress reporter of the mode, returns nil
+// if the progress output is disabled. The interactive progress bars are
+// rendered in auto mode if the stderr is terminal, the progress output is
+// disabled in auto mode otherwise since the logs of the copies are enough
+// for the CI jobs and the redirected output.
+func New(mode string) (*Reporter, error) {
+	switch mode {
+	case ModeNone:
+		return nil, nil
+	case ModePlain:
+		return newReporter(false, os.Stderr, 0), nil
+	case ModeAuto, "":
+		if !term.IsTerminal(uintptr(syscall.Stderr)) {
+			return nil, nil
+		}
+		width := 80
+		if ws, err := term.GetWinsize(uintptr(syscall.Stderr)); err == nil && ws.Width > 0 {
+			width = int(ws.Width)
+		}
+		return newReporter(true, os.Stderr, width), nil
+	default:
+		return nil, fmt.Errorf("invalid progress mode %q, available: %s, %s, %s",
+			mode, ModeAuto, ModePlain, ModeNone)
+	}
+}
+
+func newReporter(interactive bool, out io.Writer, width int) *Reporter {
+	r := &Reporter{
+		interactive: interactive,
+		out:         out,
+		width:       width,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *Reporter) run() {
+	defer close(r.done)
+	interval := plainInterval
+	if r.interactive {
+		interval = barInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			if r.interactive {
+				r.mu.Lock()
+				r.clear()
+				r.draw()
+				r.mu.Unlock()
+			} else {
+				r.log()
+			}
+		}
+	}
+}
+
+// Writer returns the writer of the log output, the progress bars are
+// cleared before the logs written and redrawn on the next refresh.
+func (r *Reporter) Writer(w io.Writer) io.Writer {
+	if r == nil || !r.interactive {
+		return w
+	}
+	return &logWriter{r: r, w: w}
+}
+
+type logWriter struct {
+	r *Reporter
+	w io.Writer
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.r.mu.Lock()
+	defer w.r.mu.Unlock()
+	w.r.clear()
+	return w.w.Write(p)
+}
+
+// Track returns the progress channel of the image copy and the function
+// to be called after the copy finished, the channel is nil if the
+// reporter is nil.
+func (r *Reporter) Track(image string) (chan types.ProgressProperties, func()) {
+	if r == nil {
+		return nil, func() {}
+	}
+	r.mu.Lock()
+	r.nextID++
+	id := r.nextID
+	r.mu.Unlock()
+
+	ch := make(chan types.ProgressProperties)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for p := range ch {
+			r.update(id, image, p)
+		}
+	}()
+	return ch, func() {
+		close(ch)
+		<-done
+		// Remove the blobs not finished of the failed copy.
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.remove(id, "")
+	}
+}
+
+func (r *Reporter) update(id int, image string, p types.ProgressProperties) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.startTime.IsZero() {
+		r.startTime = time.Now()
+	}
+	switch p.Event {
+	case types.ProgressEventNewArtifact:
+		r.blobs = append(r.blobs, &blob{
+			tracker: id,
+			image:   image,
+			digest:  p.Artifact.Digest,
+			size:    p.Artifact.Size,
+		})
+		if p.Artifact.Size > 0 {
+			r.total += p.Artifact.Size
+		}
+	case types.ProgressEventRead:
+		if b := r.find(id, p.Artifact.Digest); b != nil {
+			b.offset += int64(p.OffsetUpdate)
+		}
+		r.transferred += int64(p.OffsetUpdate)
+	case types.ProgressEventDone:
+		r.transferred += int64(p.OffsetUpdate)
+		r.remove(id, p.Artifact.Digest)
+		r.completed++
+	case types.ProgressEventSkipped:
+		r.remove(id, p.Artifact.Digest)
+		r.skipped++
+	}
+}
+
+func (r *Reporter) find(id int, dig digest.Digest) *blob {
+	for _, b := range r.blobs {
+		if b.tracker == id && b.digest == dig {
+			return b
+		}
+	}
+	return nil
+}
+
+// remove removes the blob of the tracker, all the blobs of the tracker
+// are removed if the digest is empty.
+func (r *Reporter) remove(id int, dig digest.Digest) {
+	blobs := r.blobs[:0]
+	for _, b := range r.blobs {
+		if b.tracker == id && (dig == "" || b.digest == dig) {
+			continue
+		}
+		blobs = append(blobs, b)
+	}
+	r.blobs = blobs
+}
+
+// summary returns the line of the total progress, should be called with
+// the lock held.
+func (r *Reporter) summary() string {
+	var rate float64
+	if !r.startTime.IsZero() {
+		if elapsed := time.Since(r.startTime).Seconds(); elapsed > 0 {
+			rate = float64(r.transferred) / elapsed
+		}
+	}
+	var remaining int64
+	for _, b := range r.blobs {
+		if b.size > b.offset {
+			remaining += b.size - b.offset
+		}
+	}
+	eta := "-"
+	if rate > 0 {
+		eta = time.Duration(float64(remaining) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+	return fmt.Sprintf("Total %s / %s, %s/s, %d blobs in flight, %d done, %d skipped, ETA %s",
+		utils.FormatSize(r.transferred), utils.FormatSize(r.total),
+		utils.FormatSize(int64(rate)), len(r.blobs), r.completed, r.skipped, eta)
+}
+
+// bar returns the progress bar line of the blob.
+func (r *Reporter) bar(b *blob) string {
+	label := b.image
+	if len(label) > labelWidth {
+		label = "..." + label[len(label)-labelWidth+3:]
+	}
+	name := b.digest.String()
+	if _, encoded, ok := strings.Cut(name, ":"); ok {
+		name = encoded
+	}
+	if len(name) > 12 {
+		name = name[:12]
+	}
+	if b.size <= 0 {
+		return fmt.Sprintf("%-*s %s %s", labelWidth, label, name,
+			utils.FormatSize(b.offset))
+	}
+	filled := int(b.offset * barWidth / b.size)
+	if filled > barWidth {
+		filled = barWidth
+	}
+	return fmt.Sprintf("%-*s %s [%s%s] %s / %s", labelWidth, label, name,
+		strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled),
+		utils.FormatSize(b.offset), utils.FormatSize(b.size))
+}
+
+// draw renders the progress bars of the blobs in flight, should be called
+// with the lock held.
+func (r *Reporter) draw() {
+	if len(r.blobs) == 0 {
+		return
+	}
+	var lines []string
+	for i, b := range r.blobs {
+		if i == maxBars {
+			lines = append(lines, fmt.Sprintf("... and %d more blobs", len(r.blobs)-maxBars))
+			break
+		}
+		lines = append(lines, r.bar(b))
+	}
+	lines = append(lines, r.summary())
+	b := strings.Builder{}
+	for _, l := range lines {
+		// Truncate the line to avoid wrapping, which breaks the line
+		// number to be cleared.
+		if r.width > 0 && len(l) >= r.width {
+			l = l[:r.width-1]
+		}
+		b.WriteString(l)
+		b.WriteString("\n")
+	}
+	fmt.Fprint(r.out, b.String())
+	r.lines = len(lines)
+}
+
+// clear erases the drawn progress bars, should be called with the lock
+// held.
+func (r *Reporter) clear() {
+	if r.lines == 0 {
+		return
+	}
+	fmt.Fprintf(r.out, "\x1b[%dA\x1b[J", r.lines)
+	r.lines = 0
+}
+
+// log outputs the progress log if the blobs are in flight or transferred
+// since the last log.
+func (r *Reporter) log() {
+	r.mu.Lock()
+	if len(r.blobs) == 0 && r.transferred == r.logged {
+		r.mu.Unlock()
+		return
+	}
+	r.logged = r.transferred
+	s := r.summary()
+	r.mu.Unlock()
+	logrus.Infof("Progress: %s", s)
+}
+
+// Close stops rendering the progress and clears the progress bars.
+func (r *Reporter) Close() error {
+	if r == nil {
+		return nil
+	}
+	close(r.stop)
+	<-r.done
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clear()
+	return nil
+}
+
+var defaultReporter *Reporter
+
+// SetDefault sets the default progress reporter used by Track.
+func SetDefault(r *Reporter) {
+	defaultReporter = r
+}
+
+// Track returns the progress channel of the image copy by the default
+// progress reporter, the channel is nil if the default reporter is not
+// set.
+func Track(image string) (chan types.ProgressProperties, func()) {
+	return defaultReporter.Track(image)
+}
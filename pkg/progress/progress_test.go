@@ -0,0 +1,106 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/moby/term"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_New(t *testing.T) {
+	r, err := New(ModeNone)
+	assert.Nil(t, err)
+	assert.Nil(t, r)
+	// Nil reporter should be no-op.
+	ch, finish := r.Track("nginx")
+	assert.Nil(t, ch)
+	finish()
+	assert.Nil(t, r.Close())
+
+	if !term.IsTerminal(uintptr(syscall.Stderr)) {
+		// The progress output is disabled in auto mode if the stderr
+		// is not terminal.
+		r, err = New(ModeAuto)
+		assert.Nil(t, err)
+		assert.Nil(t, r)
+	}
+
+	_, err = New("foo")
+	assert.NotNil(t, err)
+}
+
+func Test_Reporter(t *testing.T) {
+	r := newReporter(false, &bytes.Buffer{}, 0)
+	defer r.Close()
+
+	layer1 := types.BlobInfo{Digest: digest.FromString("layer1"), Size: 100}
+	layer2 := types.BlobInfo{Digest: digest.FromString("layer2"), Size: 200}
+	layer3 := types.BlobInfo{Digest: digest.FromString("layer3"), Size: 300}
+
+	ch, finish := r.Track("docker.io/library/nginx:latest")
+	ch <- types.ProgressProperties{Event: types.ProgressEventNewArtifact, Artifact: layer1}
+	ch <- types.ProgressProperties{Event: types.ProgressEventNewArtifact, Artifact: layer2}
+	ch <- types.ProgressProperties{Event: types.ProgressEventNewArtifact, Artifact: layer3}
+	ch <- types.ProgressProperties{Event: types.ProgressEventRead, Artifact: layer1, OffsetUpdate: 60}
+	ch <- types.ProgressProperties{Event: types.ProgressEventDone, Artifact: layer1, OffsetUpdate: 40}
+	ch <- types.ProgressProperties{Event: types.ProgressEventSkipped, Artifact: layer2}
+	ch <- types.ProgressProperties{Event: types.ProgressEventRead, Artifact: layer3, OffsetUpdate: 150}
+
+	// The events sent are consumed once the next event received.
+	ch <- types.ProgressProperties{Event: types.ProgressEventRead}
+	r.mu.Lock()
+	assert.Equal(t, 1, len(r.blobs))
+	assert.Equal(t, int64(600), r.total)
+	assert.Equal(t, int64(250), r.transferred)
+	assert.Equal(t, 1, r.completed)
+	assert.Equal(t, 1, r.skipped)
+	assert.True(t, strings.HasPrefix(r.summary(),
+		"Total 250.00 B / 600.00 B"))
+	assert.Equal(t, "docker.io/library/nginx:latest           "+
+		layer3.Digest.Encoded()[:12]+" [============             ] 150.00 B / 300.00 B",
+		r.bar(r.blobs[0]))
+	r.mu.Unlock()
+
+	// The blobs not finished are removed after the copy finished.
+	finish()
+	r.mu.Lock()
+	assert.Equal(t, 0, len(r.blobs))
+	r.mu.Unlock()
+}
+
+func Test_Reporter_Draw(t *testing.T) {
+	out := &bytes.Buffer{}
+	r := newReporter(false, out, 60)
+	defer r.Close()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.draw()
+	assert.Equal(t, "", out.String())
+
+	for i := 0; i < maxBars+2; i++ {
+		r.blobs = append(r.blobs, &blob{
+			image:  "nginx",
+			digest: digest.FromString("layer"),
+			size:   -1,
+		})
+	}
+	r.draw()
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Equal(t, maxBars+2, len(lines))
+	assert.Equal(t, maxBars+2, r.lines)
+	assert.Equal(t, "... and 2 more blobs", lines[maxBars])
+	for _, l := range lines {
+		assert.True(t, len(l) < 60)
+	}
+
+	out.Reset()
+	r.clear()
+	assert.Equal(t, "\x1b[12A\x1b[J", out.String())
+	assert.Equal(t, 0, r.lines)
+}
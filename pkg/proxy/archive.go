@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// WriteArchive writes the images pulled through the proxy into the hangar
+// archive, only the platform images pulled completely (the manifest, config
+// and all layers) are written. Returns the number of the written images.
+func (p *Proxy) WriteArchive(name string) (int, error) {
+	p.mu.Lock()
+	var refs []string
+	pulled := map[string]digest.Digest{}
+	for repository, tags := range p.tags {
+		for tag, d := range tags {
+			ref := repository + ":" + tag
+			refs = append(refs, ref)
+			pulled[ref] = d
+		}
+	}
+	p.mu.Unlock()
+	sort.Strings(refs)
+
+	index := archive.NewIndex()
+	for _, ref := range refs {
+		i := strings.LastIndex(ref, ":")
+		image, err := p.archiveImage(ref[:i], ref[i+1:], pulled[ref])
+		if err != nil {
+			logrus.Warnf("Skip [%v/%v]: %v", p.upstream, ref, err)
+			continue
+		}
+		index.Append(image)
+	}
+	if len(index.List) == 0 {
+		return 0, fmt.Errorf("no images pulled through the proxy completely")
+	}
+
+	aw, err := archive.NewMultiWriter(archive.LayoutArchive, nil, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create archive: %w", err)
+	}
+	if err := aw.Write(filepath.Join(p.cacheDir, layoutDir)); err != nil {
+		aw.Close()
+		return 0, err
+	}
+	if err := aw.WriteIndex(index); err != nil {
+		aw.Close()
+		return 0, err
+	}
+	if err := aw.Close(); err != nil {
+		return 0, err
+	}
+	return len(index.List), nil
+}
+
+// archiveImage returns the archive image of the pulled tag, the platform
+// images of the manifest index not pulled are skipped.
+func (p *Proxy) archiveImage(repository, tag string, d digest.Digest) (*archive.Image, error) {
+	b, ok := p.readManifest(d)
+	if !ok {
+		return nil, fmt.Errorf("manifest %v not cached", d)
+	}
+	p.mu.Lock()
+	mediaType := p.manifests[d]
+	p.mu.Unlock()
+
+	image := &archive.Image{
+		Source: p.upstream + "/" + repository,
+		Tag:    tag,
+	}
+	var platforms []*archive.ImageSpec
+	switch mediaType {
+	case imgspecv1.MediaTypeImageIndex,
+		"application/vnd.docker.distribution.manifest.list.v2+json":
+		index := imgspecv1.Index{}
+		if err := json.Unmarshal(b, &index); err != nil {
+			return nil, fmt.Errorf("failed to decode manifest index: %w", err)
+		}
+		for _, desc := range index.Manifests {
+			if desc.Platform != nil && desc.Platform.OS == "unknown" {
+				// Attestation manifest.
+				continue
+			}
+			spec, err := p.platformSpec(desc.Digest, desc.MediaType, desc.Platform)
+			if err != nil {
+				logrus.Debugf("Skip platform of [%v:%v]: %v", repository, tag, err)
+				continue
+			}
+			platforms = append(platforms, spec)
+		}
+	default:
+		spec, err := p.platformSpec(d, mediaType, nil)
+		if err != nil {
+			return nil, err
+		}
+		platforms = append(platforms, spec)
+	}
+	if len(platforms) == 0 {
+		return nil, fmt.Errorf("no platform images pulled completely")
+	}
+
+	archSet, osSet := map[string]bool{}, map[string]bool{}
+	for _, spec := range platforms {
+		image.Images = append(image.Images, *spec)
+		if !archSet[spec.Arch] {
+			archSet[spec.Arch] = true
+			image.ArchList = append(image.ArchList, spec.Arch)
+		}
+		if !osSet[spec.OS] {
+			osSet[spec.OS] = true
+			image.OsList = append(image.OsList, spec.OS)
+		}
+	}
+	return image, nil
+}
+
+// platformSpec writes the OCI image layout of the platform image into the
+// archive layout and returns its image spec, returns error if the image
+// is not pulled completely.
+func (p *Proxy) platformSpec(
+	d digest.Digest, mediaType string, platform *imgspecv1.Platform,
+) (*archive.ImageSpec, error) {
+	b, ok := p.readManifest(d)
+	if !ok {
+		return nil, fmt.Errorf("manifest %v not pulled", d)
+	}
+	m := imgspecv1.Manifest{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest %v: %w", d, err)
+	}
+	if m.Config.Digest == "" {
+		return nil, fmt.Errorf("unsupported manifest %v", d)
+	}
+	spec := &archive.ImageSpec{
+		MediaType: mediaType,
+		Config:    m.Config.Digest,
+		Digest:    d,
+	}
+	for _, layer := range m.Layers {
+		if len(layer.URLs) != 0 {
+			// The foreign layer is not saved.
+			continue
+		}
+		if _, err := os.Stat(p.blobPath(layer.Digest)); err != nil {
+			return nil, fmt.Errorf("layer %v not pulled", layer.Digest)
+		}
+		spec.Layers = append(spec.Layers, layer.Digest)
+	}
+	config, err := os.ReadFile(p.blobPath(m.Config.Digest))
+	if err != nil {
+		return nil, fmt.Errorf("config %v not pulled", m.Config.Digest)
+	}
+	if platform == nil {
+		platform = &imgspecv1.Platform{}
+		if err := json.Unmarshal(config, platform); err != nil {
+			return nil, fmt.Errorf("failed to decode config %v: %w", m.Config.Digest, err)
+		}
+	}
+	spec.Arch = platform.Architecture
+	spec.OS = platform.OS
+	spec.OSVersion = platform.OSVersion
+	spec.OSFeatures = platform.OSFeatures
+	spec.Variant = platform.Variant
+
+	// The OCI image layout of the platform image, the blobs are stored in
+	// the shared blob dir of the archive.
+	dir := filepath.Join(p.cacheDir, layoutDir, d.Encoded())
+	layout, _ := json.Marshal(imgspecv1.ImageLayout{Version: imgspecv1.ImageLayoutVersion})
+	if err := writeFile(filepath.Join(dir, imgspecv1.ImageLayoutFile), layout); err != nil {
+		return nil, err
+	}
+	index, _ := json.Marshal(imgspecv1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{{
+			MediaType: mediaType,
+			Digest:    d,
+			Size:      int64(len(b)),
+		}},
+	})
+	if err := writeFile(filepath.Join(dir, archive.IndexFileName), index); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
@@ -0,0 +1,386 @@
+// Package proxy implements the read-through caching pull-through registry,
+// the manifests and blobs pulled through the proxy are cached locally and
+// persisted into the hangar archive, so a normal online install produces
+// the air-gap bundle for the later offline installs.
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cnrancher/hangar/pkg/extension"
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// layoutDir is the directory of the archive layout in the cache dir,
+// the shared blobs are stored in 'layout/share/ALGORITHM/ENCODED'.
+const layoutDir = "layout"
+
+// indexFile is the index of the cached manifests and the pulled tags in
+// the cache dir, loaded by the next run of the proxy.
+const indexFile = "index.json"
+
+// Options is the options of the caching proxy.
+type Options struct {
+	// Upstream is the upstream registry, e.g. 'docker.io'.
+	Upstream string
+	// CacheDir is the directory to cache the pulled manifests and blobs.
+	CacheDir string
+	// SystemContext is used to get the credential of the upstream.
+	SystemContext *types.SystemContext
+}
+
+// Proxy is the read-through caching pull-through registry.
+type Proxy struct {
+	upstream string
+	cacheDir string
+	client   *extension.Client
+	// blobClient is the client without the total timeout for streaming
+	// the blobs from upstream.
+	blobClient *extension.Client
+
+	mu sync.Mutex
+	// manifests is the media type of the cached manifests.
+	manifests map[digest.Digest]string
+	// tags is the manifest digest of the pulled tags, map[repository]map[tag]digest
+	tags map[string]map[string]digest.Digest
+}
+
+// cacheIndex is the persisted index of the cache dir.
+type cacheIndex struct {
+	Manifests map[digest.Digest]string            `json:"manifests"`
+	Tags      map[string]map[string]digest.Digest `json:"tags"`
+}
+
+// New creates the caching proxy of the upstream registry.
+func New(o *Options) (*Proxy, error) {
+	if o.Upstream == "" {
+		return nil, fmt.Errorf("upstream registry not provided")
+	}
+	if err := os.MkdirAll(filepath.Join(o.CacheDir, layoutDir, archive.SharedBlobDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	p := &Proxy{
+		upstream:   o.Upstream,
+		cacheDir:   o.CacheDir,
+		client:     extension.NewClient(o.SystemContext, o.Upstream),
+		blobClient: extension.NewStreamClient(o.SystemContext, o.Upstream),
+		manifests:  make(map[digest.Digest]string),
+		tags:       make(map[string]map[string]digest.Digest),
+	}
+	if err := p.loadIndex(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// loadIndex loads the index of the manifests and tags cached by the
+// previous run.
+func (p *Proxy) loadIndex() error {
+	b, err := os.ReadFile(filepath.Join(p.cacheDir, indexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read cache index: %w", err)
+	}
+	index := cacheIndex{}
+	if err := json.Unmarshal(b, &index); err != nil {
+		return fmt.Errorf("failed to parse cache index %q: %w",
+			filepath.Join(p.cacheDir, indexFile), err)
+	}
+	for d, mediaType := range index.Manifests {
+		p.manifests[d] = mediaType
+	}
+	for repository, tags := range index.Tags {
+		p.tags[repository] = tags
+	}
+	logrus.Infof("Loaded %d cached tags from %q", len(index.Tags), p.cacheDir)
+	return nil
+}
+
+// saveIndex persists the index of the cached manifests and tags, should be
+// called with the lock held.
+func (p *Proxy) saveIndex() error {
+	b, err := json.Marshal(cacheIndex{
+		Manifests: p.manifests,
+		Tags:      p.tags,
+	})
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(p.cacheDir, indexFile), b)
+}
+
+// ServeHTTP serves the pull requests of the distribution API.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "the caching proxy is read-only")
+		return
+	}
+	if r.URL.Path == "/v2/" || r.URL.Path == "/v2" {
+		w.Write([]byte("{}"))
+		return
+	}
+	repository, kind, ref, ok := parsePath(r.URL.Path)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return
+	}
+	logrus.Debugf("proxy: %v %v", r.Method, r.URL.Path)
+	switch kind {
+	case "manifests":
+		p.serveManifest(w, r, repository, ref)
+	case "blobs":
+		p.serveBlob(w, r, repository, ref)
+	}
+}
+
+// parsePath parses the repository, the kind ('manifests' or 'blobs') and
+// the reference of the request path.
+//
+//	Example:
+//		/v2/library/nginx/manifests/1.25 => library/nginx, manifests, 1.25
+func parsePath(p string) (string, string, string, bool) {
+	p = strings.TrimPrefix(p, "/v2/")
+	for _, kind := range []string{"manifests", "blobs"} {
+		i := strings.LastIndex(p, "/"+kind+"/")
+		if i <= 0 {
+			continue
+		}
+		ref := p[i+len(kind)+2:]
+		if ref == "" || strings.Contains(ref, "/") {
+			return "", "", "", false
+		}
+		return p[:i], kind, ref, true
+	}
+	return "", "", "", false
+}
+
+func (p *Proxy) serveManifest(w http.ResponseWriter, r *http.Request, repository, ref string) {
+	// The manifest pulled by digest is verified against the requested
+	// digest before cached and served.
+	algorithm := digest.Canonical
+	requested, err := digest.Parse(ref)
+	if err == nil {
+		algorithm = requested.Algorithm()
+		p.mu.Lock()
+		mediaType, ok := p.manifests[requested]
+		p.mu.Unlock()
+		if ok {
+			if b, ok := p.readManifest(requested); ok {
+				writeContent(w, r, requested, mediaType, b)
+				return
+			}
+		}
+	}
+
+	resp, err := p.client.Do(r.Context(), http.MethodGet,
+		fmt.Sprintf("/v2/%s/manifests/%s", repository, ref),
+		http.Header{"Accept": r.Header.Values("Accept")}, nil)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "UNKNOWN", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		forward(w, resp)
+		return
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "UNKNOWN", err.Error())
+		return
+	}
+	d := algorithm.FromBytes(b)
+	if requested != "" && d != requested {
+		writeError(w, http.StatusBadGateway, "MANIFEST_INVALID", fmt.Sprintf(
+			"upstream manifest digest %v mismatch with the requested %v", d, requested))
+		return
+	}
+	mediaType := resp.Header.Get("Content-Type")
+	if err := p.cacheManifest(repository, ref, d, mediaType, b); err != nil {
+		logrus.Warnf("proxy: failed to cache manifest [%v@%v]: %v", repository, d, err)
+	}
+	writeContent(w, r, d, mediaType, b)
+}
+
+// cacheManifest stores the manifest into the cache and records the tag.
+func (p *Proxy) cacheManifest(repository, ref string, d digest.Digest, mediaType string, b []byte) error {
+	if err := writeFile(p.blobPath(d), b); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.manifests[d] = mediaType
+	if _, err := digest.Parse(ref); err != nil {
+		if p.tags[repository] == nil {
+			p.tags[repository] = make(map[string]digest.Digest)
+		}
+		p.tags[repository][ref] = d
+	}
+	return p.saveIndex()
+}
+
+func (p *Proxy) serveBlob(w http.ResponseWriter, r *http.Request, repository, ref string) {
+	d, err := digest.Parse(ref)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", err.Error())
+		return
+	}
+	if f, err := os.Open(p.blobPath(d)); err == nil {
+		defer f.Close()
+		if fi, err := f.Stat(); err == nil {
+			w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Docker-Content-Digest", d.String())
+		if r.Method == http.MethodGet {
+			io.Copy(w, f)
+		}
+		return
+	}
+
+	// The HEAD request is answered by the upstream HEAD request, the blob
+	// is only fetched and cached by the GET request.
+	resp, err := p.blobClient.Do(r.Context(), r.Method,
+		fmt.Sprintf("/v2/%s/blobs/%s", repository, d), nil, nil)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "UNKNOWN", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		forward(w, resp)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", d.String())
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	// Stream the blob to the client and store it into the cache at the
+	// same time, the blob is cached only if the digest matches.
+	if err := p.cacheBlob(d, io.TeeReader(resp.Body, w)); err != nil {
+		logrus.Warnf("proxy: failed to cache blob [%v@%v]: %v", repository, d, err)
+	}
+}
+
+// cacheBlob stores the blob into the cache after the digest verified.
+func (p *Proxy) cacheBlob(d digest.Digest, r io.Reader) error {
+	dir := filepath.Dir(p.blobPath(d))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".blob-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	verifier := d.Verifier()
+	if _, err := io.Copy(f, io.TeeReader(r, verifier)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("digest mismatch")
+	}
+	return os.Rename(f.Name(), p.blobPath(d))
+}
+
+// blobPath returns the path of the cached blob in the archive layout.
+func (p *Proxy) blobPath(d digest.Digest) string {
+	return filepath.Join(p.cacheDir, layoutDir, archive.SharedBlobDir,
+		d.Algorithm().String(), d.Encoded())
+}
+
+func writeFile(name string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func writeContent(w http.ResponseWriter, r *http.Request, d digest.Digest, mediaType string, b []byte) {
+	if mediaType != "" {
+		w.Header().Set("Content-Type", mediaType)
+	}
+	w.Header().Set("Docker-Content-Digest", d.String())
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	if r.Method == http.MethodGet {
+		w.Write(b)
+	}
+}
+
+// forward writes the upstream error response to the client.
+func forward(w http.ResponseWriter, resp *http.Response) {
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	b, _ := json.Marshal(map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// Serve serves the proxy on the listen address until the context
+// canceled.
+func (p *Proxy) Serve(ctx context.Context, listen string) error {
+	server := &http.Server{
+		Addr:    listen,
+		Handler: p,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+	logrus.Infof("Caching proxy of [%v] listening on %v", p.upstream, listen)
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	if err := server.Shutdown(context.Background()); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// readManifest reads the cached manifest.
+func (p *Proxy) readManifest(d digest.Digest) ([]byte, bool) {
+	b, err := os.ReadFile(p.blobPath(d))
+	if err != nil || d.Algorithm().FromBytes(b) != d {
+		return nil, false
+	}
+	return b, true
+}
@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parsePath(t *testing.T) {
+	for _, c := range []struct {
+		path       string
+		repository string
+		kind       string
+		ref        string
+		ok         bool
+	}{
+		{"/v2/library/nginx/manifests/1.25", "library/nginx", "manifests", "1.25", true},
+		{"/v2/a/b/c/blobs/sha256:abc", "a/b/c", "blobs", "sha256:abc", true},
+		{"/v2/library/nginx/manifests/", "", "", "", false},
+		{"/v2/library/nginx/tags/list", "", "", "", false},
+		{"/v2/manifests/1.25", "", "", "", false},
+	} {
+		repository, kind, ref, ok := parsePath(c.path)
+		assert.Equal(t, c.ok, ok, c.path)
+		assert.Equal(t, c.repository, repository, c.path)
+		assert.Equal(t, c.kind, kind, c.path)
+		assert.Equal(t, c.ref, ref, c.path)
+	}
+}
+
+func Test_Proxy_WriteArchive(t *testing.T) {
+	p, err := New(&Options{
+		Upstream: "docker.io",
+		CacheDir: t.TempDir(),
+	})
+	assert.Nil(t, err)
+
+	layer := []byte("layer")
+	config, _ := json.Marshal(imgspecv1.Image{
+		Platform: imgspecv1.Platform{Architecture: "amd64", OS: "linux"},
+	})
+	m, _ := json.Marshal(imgspecv1.Manifest{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config: imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageConfig,
+			Digest:    digest.FromBytes(config),
+			Size:      int64(len(config)),
+		},
+		Layers: []imgspecv1.Descriptor{{
+			MediaType: imgspecv1.MediaTypeImageLayerGzip,
+			Digest:    digest.FromBytes(layer),
+			Size:      int64(len(layer)),
+		}},
+	})
+	d := digest.FromBytes(m)
+	assert.Nil(t, p.cacheManifest("library/nginx", "1.25", d, imgspecv1.MediaTypeImageManifest, m))
+
+	// Layer not pulled yet.
+	_, err = p.WriteArchive(filepath.Join(t.TempDir(), "a.zip"))
+	assert.NotNil(t, err)
+
+	assert.NotNil(t, p.cacheBlob(digest.FromBytes(layer), bytes.NewReader([]byte("invalid"))))
+	assert.Nil(t, p.cacheBlob(digest.FromBytes(layer), bytes.NewReader(layer)))
+	assert.Nil(t, p.cacheBlob(digest.FromBytes(config), bytes.NewReader(config)))
+
+	name := filepath.Join(t.TempDir(), "b.zip")
+	n, err := p.WriteArchive(name)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	r, err := archive.NewReader(name)
+	assert.Nil(t, err)
+	defer r.Close()
+	b, err := r.Index()
+	assert.Nil(t, err)
+	index := archive.NewIndex()
+	assert.Nil(t, index.Unmarshal(b))
+	assert.Equal(t, 1, len(index.List))
+	image := index.List[0]
+	assert.Equal(t, "docker.io/library/nginx", image.Source)
+	assert.Equal(t, "1.25", image.Tag)
+	assert.Equal(t, []string{"amd64"}, image.ArchList)
+	assert.Equal(t, d, image.Images[0].Digest)
+	assert.Equal(t, []digest.Digest{digest.FromBytes(layer)}, image.Images[0].Layers)
+}
+
+func Test_Proxy_loadIndex(t *testing.T) {
+	dir := t.TempDir()
+	p, err := New(&Options{
+		Upstream: "docker.io",
+		CacheDir: dir,
+	})
+	assert.Nil(t, err)
+	m := []byte(`{"schemaVersion":2}`)
+	d := digest.FromBytes(m)
+	assert.Nil(t, p.cacheManifest("library/nginx", "1.25", d, imgspecv1.MediaTypeImageManifest, m))
+	assert.Nil(t, p.cacheManifest("library/nginx", d.String(), d, imgspecv1.MediaTypeImageManifest, m))
+
+	// The cached manifests and tags are reused by the next run.
+	p, err = New(&Options{
+		Upstream: "docker.io",
+		CacheDir: dir,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[digest.Digest]string{d: imgspecv1.MediaTypeImageManifest}, p.manifests)
+	assert.Equal(t, map[string]map[string]digest.Digest{
+		"library/nginx": {"1.25": d},
+	}, p.tags)
+
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, indexFile), []byte("invalid"), 0644))
+	_, err = New(&Options{
+		Upstream: "docker.io",
+		CacheDir: dir,
+	})
+	assert.NotNil(t, err)
+}
+
+func Test_Proxy_ServeHTTP(t *testing.T) {
+	layer := []byte("layer")
+	m := []byte(`{"schemaVersion":2}`)
+	var (
+		mu      sync.Mutex
+		methods = map[string][]string{}
+	)
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods[r.URL.Path] = append(methods[r.URL.Path], r.Method)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/v2/":
+		case "/v2/library/nginx/blobs/" + digest.FromBytes(layer).String():
+			w.Header().Set("Content-Length", strconv.Itoa(len(layer)))
+			if r.Method == http.MethodGet {
+				w.Write(layer)
+			}
+		case "/v2/library/nginx/manifests/1.25",
+			"/v2/library/nginx/manifests/" + digest.FromBytes(m).String():
+			w.Header().Set("Content-Type", imgspecv1.MediaTypeImageManifest)
+			w.Write(m)
+		case "/v2/library/nginx/manifests/" + digest.FromString("other").String():
+			// The upstream responds the manifest mismatch with the digest.
+			w.Header().Set("Content-Type", imgspecv1.MediaTypeImageManifest)
+			w.Write(m)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+	p, err := New(&Options{
+		Upstream: strings.TrimPrefix(upstream.URL, "https://"),
+		CacheDir: t.TempDir(),
+		SystemContext: &types.SystemContext{
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		},
+	})
+	assert.Nil(t, err)
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	called := func(path string) []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return methods[path]
+	}
+
+	t.Run("blob head", func(t *testing.T) {
+		path := "/v2/library/nginx/blobs/" + digest.FromBytes(layer).String()
+		w := serve(http.MethodHead, path)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, strconv.Itoa(len(layer)), w.Header().Get("Content-Length"))
+		assert.Equal(t, digest.FromBytes(layer).String(), w.Header().Get("Docker-Content-Digest"))
+		assert.Empty(t, w.Body.Bytes())
+		// The blob is not fetched nor cached by the HEAD request.
+		assert.Equal(t, []string{http.MethodHead}, called(path))
+		_, err := os.Stat(p.blobPath(digest.FromBytes(layer)))
+		assert.True(t, os.IsNotExist(err))
+
+		w = serve(http.MethodGet, path)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, layer, w.Body.Bytes())
+		w = serve(http.MethodHead, path)
+		assert.Equal(t, http.StatusOK, w.Code)
+		// Served from the cache.
+		assert.Equal(t, []string{http.MethodHead, http.MethodGet}, called(path))
+	})
+
+	t.Run("manifest by digest", func(t *testing.T) {
+		d := digest.FromBytes(m)
+		path := "/v2/library/nginx/manifests/" + d.String()
+		w := serve(http.MethodGet, path)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, m, w.Body.Bytes())
+		assert.Equal(t, d.String(), w.Header().Get("Docker-Content-Digest"))
+		w = serve(http.MethodGet, path)
+		assert.Equal(t, m, w.Body.Bytes())
+		// Served from the cache.
+		assert.Len(t, called(path), 1)
+	})
+
+	t.Run("manifest digest mismatch", func(t *testing.T) {
+		d := digest.FromString("other")
+		w := serve(http.MethodGet, "/v2/library/nginx/manifests/"+d.String())
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+		assert.Contains(t, w.Body.String(), "MANIFEST_INVALID")
+		p.mu.Lock()
+		_, ok := p.manifests[d]
+		p.mu.Unlock()
+		assert.False(t, ok)
+		_, err := os.Stat(p.blobPath(d))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("manifest by tag", func(t *testing.T) {
+		w := serve(http.MethodGet, "/v2/library/nginx/manifests/1.25")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, m, w.Body.Bytes())
+		p.mu.Lock()
+		assert.Equal(t, digest.FromBytes(m), p.tags["library/nginx"]["1.25"])
+		p.mu.Unlock()
+	})
+}
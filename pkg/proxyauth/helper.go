@@ -0,0 +1,84 @@
+package proxyauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// helperTimeout is the timeout of each execution of the helper command.
+const helperTimeout = time.Second * 30
+
+// helper is the authenticator getting the tokens from the external helper
+// command, the schemes requiring the system libraries (e.g. Kerberos by
+// GSSAPI or Windows SSPI) are implemented by the helper command.
+//
+// The helper command is executed for each request of the handshake with
+// the scheme and the proxy host as the arguments:
+//
+//	HELPER_COMMAND SCHEME PROXY_HOST
+//
+// The base64 encoded challenge of the proxy is written into the stdin of
+// the helper (empty for the first request), the helper should output the
+// base64 encoded token into the stdout.
+type helper struct {
+	scheme  string
+	command []string
+}
+
+// NewHelper creates the authenticator of the scheme (e.g. 'Negotiate')
+// getting the tokens from the helper command.
+func NewHelper(scheme, command string) (Authenticator, error) {
+	c := strings.Fields(command)
+	if len(c) == 0 {
+		return nil, fmt.Errorf("proxy auth helper command not provided")
+	}
+	return &helper{
+		scheme:  scheme,
+		command: c,
+	}, nil
+}
+
+func (h *helper) Scheme() string {
+	return h.scheme
+}
+
+func (h *helper) NewSession(proxyHost string) (Session, error) {
+	return &helperSession{
+		helper:    h,
+		proxyHost: proxyHost,
+	}, nil
+}
+
+type helperSession struct {
+	*helper
+	proxyHost string
+}
+
+func (s *helperSession) Next(challenge []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), helperTimeout)
+	defer cancel()
+
+	args := append(append([]string{}, s.command[1:]...), s.scheme, s.proxyHost)
+	cmd := exec.CommandContext(ctx, s.command[0], args...)
+	cmd.Stdin = strings.NewReader(base64.StdEncoding.EncodeToString(challenge))
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("proxy auth helper %q: %w: %s",
+			s.command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	token, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, fmt.Errorf("proxy auth helper %q: invalid token: %w", s.command[0], err)
+	}
+	if len(token) == 0 {
+		return nil, fmt.Errorf("proxy auth helper %q: empty token", s.command[0])
+	}
+	return token, nil
+}
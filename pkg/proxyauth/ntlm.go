@@ -0,0 +1,54 @@
+package proxyauth
+
+import (
+	"github.com/Azure/go-ntlmssp"
+)
+
+// ntlm is the NTLMv2 authenticator, the messages are encoded by the
+// go-ntlmssp library.
+type ntlm struct {
+	domain string
+	user   string
+	// domainNeeded is false if the username is in the 'USER@DOMAIN'
+	// format (UPN).
+	domainNeeded bool
+	password     string
+}
+
+// NewNTLM creates the NTLMv2 authenticator, the domain of the user can be
+// specified in the username in 'DOMAIN\USER' format.
+func NewNTLM(username, password string) Authenticator {
+	user, domain, domainNeeded := ntlmssp.GetDomain(username)
+	return &ntlm{
+		domain:       domain,
+		user:         user,
+		domainNeeded: domainNeeded,
+		password:     password,
+	}
+}
+
+func (n *ntlm) Scheme() string {
+	return "NTLM"
+}
+
+func (n *ntlm) NewSession(string) (Session, error) {
+	return &ntlmSession{ntlm: n}, nil
+}
+
+// ntlmSession sends the negotiate message and the authenticate message
+// by the challenge message of the proxy.
+type ntlmSession struct {
+	*ntlm
+	negotiated bool
+}
+
+func (s *ntlmSession) Next(challenge []byte) ([]byte, error) {
+	if !s.negotiated {
+		s.negotiated = true
+		return ntlmssp.NewNegotiateMessage(s.domain, "")
+	}
+	if challenge == nil {
+		return nil, ErrAuthFailed
+	}
+	return ntlmssp.ProcessChallenge(challenge, s.user, s.password, s.domainNeeded)
+}
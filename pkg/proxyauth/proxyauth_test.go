@@ -0,0 +1,250 @@
+package proxyauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testAuth is the two-leg scheme of the test proxy.
+type testAuth struct{}
+
+func (testAuth) Scheme() string { return "Test" }
+
+func (testAuth) NewSession(string) (Session, error) { return &testSession{}, nil }
+
+type testSession struct{}
+
+func (*testSession) Next(challenge []byte) ([]byte, error) {
+	if challenge == nil {
+		return []byte("hello"), nil
+	}
+	return append([]byte("response:"), challenge...), nil
+}
+
+// newTestProxy creates the proxy requiring the 'Test' scheme, the
+// CONNECT requests are tunneled after authenticated.
+func newTestProxy(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		switch r.Header.Get("Proxy-Authorization") {
+		case "Test " + base64.StdEncoding.EncodeToString([]byte("hello")):
+			w.Header().Set("Proxy-Authenticate",
+				"Test "+base64.StdEncoding.EncodeToString([]byte("challenge")))
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		case "Test " + base64.StdEncoding.EncodeToString([]byte("response:challenge")):
+		default:
+			w.Header().Add("Proxy-Authenticate", "Basic")
+			w.Header().Add("Proxy-Authenticate", "Test")
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if !assert.NoError(t, err) {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		client, buf, err := w.(http.Hijacker).Hijack()
+		if !assert.NoError(t, err) {
+			target.Close()
+			return
+		}
+		client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		pipe(client, buf.Reader, target)
+	}))
+}
+
+func Test_Connector(t *testing.T) {
+	proxy := newTestProxy(t)
+	defer proxy.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plain"))
+	}))
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tls"))
+	}))
+	defer tlsServer.Close()
+
+	c, err := New(&Options{
+		Upstream:      proxy.URL,
+		Authenticator: testAuth{},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	c.Start()
+	defer c.Close()
+
+	u, _ := url.Parse(c.URL())
+	transport := tlsServer.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(u)
+	client := &http.Client{Transport: transport}
+	for url, expected := range map[string]string{
+		server.URL:    "plain",
+		tlsServer.URL: "tls",
+	} {
+		resp, err := client.Get(url)
+		if !assert.NoError(t, err) {
+			return
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, expected, string(b))
+	}
+}
+
+func Test_Connector_AuthFailed(t *testing.T) {
+	proxy := newTestProxy(t)
+	defer proxy.Close()
+	c, err := New(&Options{
+		Upstream:      proxy.URL,
+		Authenticator: NewNTLM(`DOMAIN\user`, "password"),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.listener.Close()
+	_, err = c.connect(context.Background(), "example.com:443")
+	assert.ErrorIs(t, err, ErrAuthFailed)
+	assert.ErrorContains(t, err, `scheme "NTLM" not supported by proxy, supported: [Basic Test]`)
+}
+
+func Test_Connector_Unauthorized(t *testing.T) {
+	c, err := New(&Options{
+		Upstream:      "http://proxy:3128",
+		Authenticator: testAuth{},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	c.Start()
+	defer c.Close()
+
+	// The connector cannot be used without the credential in the URL.
+	u, _ := url.Parse(c.URL())
+	assert.NotNil(t, u.User)
+	u.User = nil
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}
+	resp, err := client.Get("http://example.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusProxyAuthRequired, resp.StatusCode)
+}
+
+func Test_Connector_ConnectionClosed(t *testing.T) {
+	// The proxy closes the connection after the challenge.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "close")
+		w.Header().Set("Proxy-Authenticate",
+			"Test "+base64.StdEncoding.EncodeToString([]byte("challenge")))
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	}))
+	defer proxy.Close()
+	c, err := New(&Options{
+		Upstream:      proxy.URL,
+		Authenticator: testAuth{},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.listener.Close()
+	_, err = c.connect(context.Background(), "example.com:443")
+	assert.ErrorIs(t, err, ErrAuthFailed)
+}
+
+func Test_New(t *testing.T) {
+	_, err := New(&Options{Authenticator: testAuth{}})
+	assert.Error(t, err)
+	_, err = New(&Options{Upstream: "https://proxy:8443", Authenticator: testAuth{}})
+	assert.Error(t, err)
+	c, err := New(&Options{Upstream: "http://proxy", Authenticator: testAuth{}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.listener.Close()
+	assert.Equal(t, "proxy:80", c.upstream.Host)
+}
+
+// Test_ntlm verifies the messages of the NTLM handshake.
+func Test_ntlm(t *testing.T) {
+	n := NewNTLM(`Domain\User`, "Password").(*ntlm)
+	assert.Equal(t, "Domain", n.domain)
+	assert.Equal(t, "User", n.user)
+	assert.True(t, n.domainNeeded)
+	n = NewNTLM("user@domain.local", "Password").(*ntlm)
+	assert.Equal(t, "", n.domain)
+	assert.False(t, n.domainNeeded)
+
+	n = NewNTLM(`Domain\User`, "Password").(*ntlm)
+	s, err := n.NewSession("proxy")
+	if !assert.NoError(t, err) {
+		return
+	}
+	b, err := s.Next(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "NTLMSSP\x00", string(b[:8]))
+	assert.Equal(t, uint32(1), binary.LittleEndian.Uint32(b[8:]))
+	_, err = s.Next(nil)
+	assert.ErrorIs(t, err, ErrAuthFailed)
+	_, err = s.Next([]byte("invalid"))
+	assert.Error(t, err)
+
+	// The CHALLENGE_MESSAGE of the target 'Domain' with the NTLM,
+	// extended session security, target info and unicode flags.
+	targetName := utf16le("Domain")
+	targetInfo := binary.LittleEndian.AppendUint16(nil, 2)
+	targetInfo = binary.LittleEndian.AppendUint16(targetInfo, uint16(len(targetName)))
+	targetInfo = append(targetInfo, targetName...)
+	targetInfo = append(targetInfo, 0, 0, 0, 0)
+	msg := make([]byte, 48)
+	copy(msg, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint16(msg[12:], uint16(len(targetName)))
+	binary.LittleEndian.PutUint16(msg[14:], uint16(len(targetName)))
+	binary.LittleEndian.PutUint32(msg[16:], 48)
+	binary.LittleEndian.PutUint32(msg[20:], 0x00880201)
+	serverChallenge, _ := hex.DecodeString("0123456789abcdef")
+	copy(msg[24:], serverChallenge)
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint32(msg[44:], uint32(48+len(targetName)))
+	msg = append(msg, targetName...)
+	msg = append(msg, targetInfo...)
+	b, err = s.Next(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "NTLMSSP\x00", string(b[:8]))
+	assert.Equal(t, uint32(3), binary.LittleEndian.Uint32(b[8:]))
+	assert.True(t, bytes.Contains(b, utf16le("User")))
+}
+
+func utf16le(s string) []byte {
+	b := []byte{}
+	for _, v := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, v)
+	}
+	return b
+}
@@ -0,0 +1,133 @@
+package chartimages
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	u "github.com/cnrancher/hangar/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// DefaultCacheDir returns the default directory to cache the chart
+// image extraction results.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "hangar", "chart-images")
+}
+
+// cacheEntry is the cached image extraction result of a chart version.
+type cacheEntry struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Digest  string `json:"digest"`
+	OS      string `json:"os"`
+	// Images is map[image][]subchart
+	Images map[string][]string `json:"images"`
+}
+
+// chartDigest returns the digest of the chart version, the digest in index
+// file is used if provided, otherwise calculate the digest of the chart
+// tarball or directory.
+func chartDigest(version *repo.ChartVersion, path string, isDir bool) (string, error) {
+	if version.Digest != "" {
+		return version.Digest, nil
+	}
+	h := sha256.New()
+	if !isDir {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%x", h.Sum(nil)), nil
+	}
+
+	var files []string
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+	for _, p := range files {
+		rel, _ := filepath.Rel(path, p)
+		h.Write([]byte(filepath.ToSlash(rel)))
+		h.Write([]byte{0})
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return "", err
+		}
+		h.Write(b)
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func (c *Chart) cachePath(digest string) string {
+	digest = strings.TrimPrefix(digest, "sha256:")
+	return filepath.Join(c.CacheDir, fmt.Sprintf("%s-%s.json",
+		digest, strings.ToLower(c.OS.String())))
+}
+
+// loadCache loads the cached images of the chart digest, returns false if
+// cache not found.
+func (c *Chart) loadCache(digest string) (map[string][]string, bool) {
+	if c.CacheDir == "" || digest == "" {
+		return nil, false
+	}
+	b, err := os.ReadFile(c.cachePath(digest))
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil || entry.Images == nil {
+		logrus.Debugf("failed to decode chart cache %q: %v",
+			c.cachePath(digest), err)
+		return nil, false
+	}
+	return entry.Images, true
+}
+
+// saveCache saves the extracted images of the chart digest into cache dir.
+func (c *Chart) saveCache(
+	version *repo.ChartVersion, digest string, images map[string][]string,
+) {
+	if c.CacheDir == "" || digest == "" {
+		return
+	}
+	if err := os.MkdirAll(c.CacheDir, 0755); err != nil {
+		logrus.Warnf("failed to create chart cache dir: %v", err)
+		return
+	}
+	entry := cacheEntry{
+		Name:    version.Name,
+		Version: version.Version,
+		Digest:  digest,
+		OS:      c.OS.String(),
+		Images:  images,
+	}
+	if err := u.SaveJSON(entry, c.cachePath(digest)); err != nil {
+		logrus.Warnf("failed to save chart cache: %v", err)
+	}
+}
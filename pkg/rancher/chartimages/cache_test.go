@@ -0,0 +1,52 @@
+package chartimages
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+func Test_chartCache(t *testing.T) {
+	dir := t.TempDir()
+	chartDir := filepath.Join(dir, "chart")
+	assert.Nil(t, os.MkdirAll(chartDir, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(chartDir, "values.yaml"),
+		[]byte("image:\n  repository: rancher/test\n  tag: v1.0.0\n"), 0644))
+
+	version := &repo.ChartVersion{}
+	version.Name = "test"
+	version.Version = "1.0.0"
+	digest, err := chartDigest(version, chartDir, true)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, digest)
+
+	c := Chart{
+		OS:       Linux,
+		CacheDir: filepath.Join(dir, "cache"),
+	}
+	_, ok := c.loadCache(digest)
+	assert.False(t, ok)
+	c.saveCache(version, digest, map[string][]string{
+		"rancher/test:v1.0.0": {""},
+	})
+	images, ok := c.loadCache(digest)
+	assert.True(t, ok)
+	assert.Equal(t, map[string][]string{"rancher/test:v1.0.0": {""}}, images)
+
+	// Digest changes when the chart content changes.
+	assert.Nil(t, os.WriteFile(filepath.Join(chartDir, "values.yaml"),
+		[]byte("image:\n  repository: rancher/test\n  tag: v1.0.1\n"), 0644))
+	newDigest, err := chartDigest(version, chartDir, true)
+	assert.Nil(t, err)
+	assert.NotEqual(t, digest, newDigest)
+}
+
+func Test_valuesFile_subchart(t *testing.T) {
+	assert.Equal(t, "", (&valuesFile{name: "values.yaml"}).subchart())
+	assert.Equal(t, "", (&valuesFile{name: "rancher/values.yaml"}).subchart())
+	assert.Equal(t, "etcd", (&valuesFile{name: "rancher/charts/etcd/values.yaml"}).subchart())
+	assert.Equal(t, "sub", (&valuesFile{name: "charts/etcd/charts/sub/values.yaml"}).subchart())
+}
@@ -10,7 +10,9 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/Masterminds/semver/v3"
 	u "github.com/cnrancher/hangar/pkg/utils"
@@ -85,8 +87,13 @@ type Chart struct {
 	URL            string
 	CloneBaseDir   string // directory to clone
 	Branch         string // git branch if in URL mode
+	CacheDir       string // directory to cache the extraction results, disabled if empty
+	Workers        int    // number of chart versions to process in parallel
 
 	ImageSet map[string]map[string]bool // map[image]map[source]
+	// Origins are the origin paths of the images, the origin path is
+	// [repo, chart:version] or [repo, chart:version, subchart].
+	Origins map[string][][]string // map[image][]origin
 }
 
 type Questions struct {
@@ -98,6 +105,9 @@ func (c *Chart) FetchImages(ctx context.Context) error {
 	if c.ImageSet == nil {
 		c.ImageSet = make(map[string]map[string]bool)
 	}
+	if c.Origins == nil {
+		c.Origins = make(map[string][][]string)
+	}
 	switch {
 	case c.Path != "":
 		return c.fetchChartsFromPath()
@@ -165,37 +175,101 @@ func (c *Chart) fetchChartsFromPath() error {
 	}
 
 	// Find values.yaml files of each chart, and check for images
+	var (
+		wg      = sync.WaitGroup{}
+		mu      = sync.Mutex{}
+		workers = make(chan struct{}, max(c.Workers, 1))
+		errs    []error
+	)
 	for _, version := range filteredVersions {
-		path := filepath.Join(c.Path, version.URLs[0])
-		info, err := os.Stat(path)
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(version *repo.ChartVersion) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			chartSource := fmt.Sprintf("[%s;%s:%s]",
+				c.Path, version.Name, version.Version)
+			images, err := c.fetchChartVersionImages(version, chartSource)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			for image, subcharts := range images {
+				u.AddSourceToImage(c.ImageSet, image, chartSource)
+				for _, subchart := range subcharts {
+					origin := []string{c.Path, version.Name + ":" + version.Version}
+					if subchart != "" {
+						origin = append(origin, subchart)
+					}
+					c.Origins[image] = append(c.Origins[image], origin)
+				}
+			}
+		}(version)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	logrus.Infof("finished fetching %q image from %q", c.OS.String(), c.Path)
+	return nil
+}
+
+// fetchChartVersionImages returns the images of the chart version from
+// cache or the values.yaml files, map[image][]subchart. The subchart is
+// empty string if the image belongs to the parent chart.
+func (c *Chart) fetchChartVersionImages(
+	version *repo.ChartVersion, chartSource string,
+) (map[string][]string, error) {
+	path := filepath.Join(c.Path, version.URLs[0])
+	info, err := os.Stat(path)
+	if err != nil {
+		logrus.Warn(err)
+		return nil, nil
+	}
+	var digest string
+	if c.CacheDir != "" {
+		digest, err = chartDigest(version, path, info.IsDir())
 		if err != nil {
-			logrus.Warn(err)
-			continue
-		}
-		var versionValues []map[interface{}]interface{}
-		if info.IsDir() {
-			versionValues, err = DecodeValuesInDir(path)
-		} else {
-			versionValues, err = DecodeValuesInTgz(path)
+			logrus.Warnf("failed to get digest of %q: %v", path, err)
 		}
+	}
+	if images, ok := c.loadCache(digest); ok {
+		logrus.Debugf("use cached images of chart %q:%q",
+			version.Name, version.Version)
+		return images, nil
+	}
+	var files []valuesFile
+	if info.IsDir() {
+		files, err = decodeValuesFilesInDir(path)
+	} else {
+		files, err = decodeValuesFilesInTgz(path)
+	}
+	if err != nil {
+		logrus.Warnf("failed to get values from %q: %v",
+			path, err)
+		return nil, nil
+	}
+	images := make(map[string][]string)
+	for _, f := range files {
+		imageSet := make(map[string]map[string]bool)
+		err := PickImagesFromValuesMap(
+			imageSet, f.values, chartSource, c.OS)
 		if err != nil {
-			logrus.Warnf("failed to get values from %q: %v",
-				path, err)
-			continue
+			return nil, err
 		}
-		// chartRepoName := filepath.Base(c.Path)
-		chartSource := fmt.Sprintf("[%s;%s:%s]",
-			c.Path, version.Name, version.Version)
-		for _, values := range versionValues {
-			err := PickImagesFromValuesMap(
-				c.ImageSet, values, chartSource, c.OS)
-			if err != nil {
-				return err
+		subchart := f.subchart()
+		for image := range imageSet {
+			if !slices.Contains(images[image], subchart) {
+				images[image] = append(images[image], subchart)
 			}
 		}
 	}
-	logrus.Infof("finished fetching %q image from %q", c.OS.String(), c.Path)
-	return nil
+	c.saveCache(version, digest, images)
+	return images, nil
 }
 
 // fetchChartsFromURL clones the chart git repo into current dir and generate
@@ -453,9 +527,37 @@ func walkMap(inputMap interface{}, cb func(map[any]any)) {
 	}
 }
 
+// valuesFile is the decoded values.yaml file of the chart.
+type valuesFile struct {
+	// name is the file path relative to the chart directory or the
+	// file name in the chart tarball.
+	name   string
+	values map[interface{}]interface{}
+}
+
+// subchart returns the subchart name of the values file, returns empty
+// string if the values file belongs to the parent chart.
+func (v *valuesFile) subchart() string {
+	spec := strings.Split(filepath.ToSlash(v.name), "/")
+	for i := len(spec) - 3; i >= 0; i-- {
+		if spec[i] == "charts" {
+			return spec[i+1]
+		}
+	}
+	return ""
+}
+
 // DecodeValuesInTgz reads tarball and returns a slice of values
 // corresponding to values.yaml files found inside of it.
 func DecodeValuesInTgz(path string) ([]map[interface{}]interface{}, error) {
+	files, err := decodeValuesFilesInTgz(path)
+	if err != nil {
+		return nil, err
+	}
+	return valuesOfFiles(files), nil
+}
+
+func decodeValuesFilesInTgz(path string) ([]valuesFile, error) {
 	tgz, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -467,12 +569,12 @@ func DecodeValuesInTgz(path string) ([]map[interface{}]interface{}, error) {
 	}
 	defer gzr.Close()
 	tr := tar.NewReader(gzr)
-	var valuesSlice []map[interface{}]interface{}
+	var files []valuesFile
 	for {
 		header, err := tr.Next()
 		switch {
 		case err == io.EOF:
-			return valuesSlice, nil
+			return files, nil
 		case err != nil:
 			return nil, err
 		case header.Typeflag == tar.TypeReg && isValuesFile(header.Name):
@@ -480,7 +582,10 @@ func DecodeValuesInTgz(path string) ([]map[interface{}]interface{}, error) {
 			if err := decodeYAMLFile(tr, &values); err != nil {
 				return nil, fmt.Errorf("DecodeValuesInTgz: %w", err)
 			}
-			valuesSlice = append(valuesSlice, values)
+			files = append(files, valuesFile{
+				name:   header.Name,
+				values: values,
+			})
 		default:
 			continue
 		}
@@ -490,11 +595,19 @@ func DecodeValuesInTgz(path string) ([]map[interface{}]interface{}, error) {
 // DecodeValuesInDir reads directory and returns a slice of values
 // corresponding to values.yaml files found inside of it.
 func DecodeValuesInDir(dir string) ([]map[interface{}]interface{}, error) {
+	files, err := decodeValuesFilesInDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return valuesOfFiles(files), nil
+}
+
+func decodeValuesFilesInDir(dir string) ([]valuesFile, error) {
 	_, err := os.Stat(dir)
 	if err != nil {
 		return nil, err
 	}
-	var valuesSlice []map[interface{}]interface{}
+	var files []valuesFile
 	err = filepath.Walk(dir, func(p string, i fs.FileInfo, err error) error {
 		if err != nil {
 			logrus.Warn(err)
@@ -510,17 +623,30 @@ func DecodeValuesInDir(dir string) ([]map[interface{}]interface{}, error) {
 				logrus.Warn(err)
 				return nil
 			}
+			defer f.Close()
 			if err := decodeYAMLFile(f, &values); err != nil {
 				return err
 			}
-			valuesSlice = append(valuesSlice, values)
+			rel, _ := filepath.Rel(dir, p)
+			files = append(files, valuesFile{
+				name:   rel,
+				values: values,
+			})
 		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	return valuesSlice, nil
+	return files, nil
+}
+
+func valuesOfFiles(files []valuesFile) []map[interface{}]interface{} {
+	var valuesSlice []map[interface{}]interface{}
+	for _, f := range files {
+		valuesSlice = append(valuesSlice, f.values)
+	}
+	return valuesSlice
 }
 
 func isValuesFile(path string) bool {
@@ -0,0 +1,88 @@
+package kdmimages
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/mod/semver"
+)
+
+// AirgapImages gets the official airgap image list published in the
+// RKE2/K3S GitHub release of the specified version.
+type AirgapImages struct {
+	Source  string // RKE2 or K3S
+	Version string // release version, e.g. v1.28.9+rke2r1, v1.28.9+k3s1
+}
+
+// Validate checks the source and the release version.
+func (a *AirgapImages) Validate() error {
+	if a.Source != K3S && a.Source != RKE2 {
+		return fmt.Errorf("invalid source provided: %v", a.Source)
+	}
+	if !strings.HasPrefix(a.Version, "v") {
+		a.Version = "v" + a.Version
+	}
+	if !semver.IsValid(a.Version) {
+		return fmt.Errorf("%q is not a valid %s version", a.Version, a.Source)
+	}
+	if !strings.Contains(semver.Build(a.Version), a.Source) {
+		return fmt.Errorf("%q is not a valid %s version, "+
+			"should have '+%s' build suffix", a.Version, a.Source, a.Source)
+	}
+	return nil
+}
+
+// SourceName returns the image source name of the airgap image list,
+// example: [rke2-airgap(v1.28.9+rke2r1)]
+func (a *AirgapImages) SourceName() string {
+	return fmt.Sprintf("[%s-airgap(%s)]", a.Source, a.Version)
+}
+
+// GetImages returns the linux and windows images of the airgap image list.
+// The windows image list is only provided by RKE2.
+func (a *AirgapImages) GetImages() (linux []string, windows []string, err error) {
+	if err := a.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	logrus.Infof("get %s %s airgap images...", a.Source, a.Version)
+	switch a.Source {
+	case RKE2:
+		linux, err = getImageListFromURL(fmt.Sprintf(RKE2ImageLinux, a.Version))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get %s %s linux image list: %w",
+				a.Source, a.Version, err)
+		}
+		windows, err = getImageListFromURL(fmt.Sprintf(RKE2ImageWindows, a.Version))
+		if err != nil {
+			// Windows image list is not provided in old RKE2 releases.
+			logrus.Warnf("failed to get %s %s windows image list: %v",
+				a.Source, a.Version, err)
+			windows = nil
+		}
+	case K3S:
+		linux, err = getImageListFromURL(fmt.Sprintf(K3SImageURL, a.Version))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get %s %s image list: %w",
+				a.Source, a.Version, err)
+		}
+	}
+	linux = trimAirgapImages(linux)
+	windows = trimAirgapImages(windows)
+	return linux, windows, nil
+}
+
+// trimAirgapImages removes the default 'docker.io/' registry prefix
+// to keep the image format same as the Rancher image list.
+func trimAirgapImages(images []string) []string {
+	var result = make([]string, 0, len(images))
+	for _, image := range images {
+		image = strings.TrimSpace(image)
+		if image == "" || strings.HasPrefix(image, "#") {
+			continue
+		}
+		result = append(result, strings.TrimPrefix(image, "docker.io/"))
+	}
+	return result
+}
@@ -0,0 +1,31 @@
+package kdmimages_test
+
+import (
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/rancher/kdmimages"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AirgapImages_Validate(t *testing.T) {
+	a := kdmimages.AirgapImages{
+		Source:  kdmimages.RKE2,
+		Version: "1.28.9+rke2r1",
+	}
+	assert.Nil(t, a.Validate())
+	assert.Equal(t, "v1.28.9+rke2r1", a.Version)
+	assert.Equal(t, "[rke2-airgap(v1.28.9+rke2r1)]", a.SourceName())
+
+	a = kdmimages.AirgapImages{
+		Source:  kdmimages.K3S,
+		Version: "v1.28.9+k3s1",
+	}
+	assert.Nil(t, a.Validate())
+
+	a.Version = "v1.28.9+rke2r1"
+	assert.NotNil(t, a.Validate())
+	a.Version = "v1.28.9"
+	assert.NotNil(t, a.Validate())
+	a.Source = "rke"
+	assert.NotNil(t, a.Validate())
+}
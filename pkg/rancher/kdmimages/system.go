@@ -22,6 +22,11 @@ type SystemImages struct {
 	// map[image][source]bool
 	LinuxImageSet   map[string]map[string]bool
 	WindowsImageSet map[string]map[string]bool
+
+	// Origins of the images, the origin is [k8sVersion, component],
+	// map[image][]origin
+	LinuxOrigins   map[string][][]string
+	WindowsOrigins map[string][][]string
 }
 
 func (s *SystemImages) GetImages() error {
@@ -38,17 +43,23 @@ func (s *SystemImages) GetImages() error {
 	if s.WindowsImageSet == nil {
 		s.WindowsImageSet = make(map[string]map[string]bool)
 	}
+	if s.LinuxOrigins == nil {
+		s.LinuxOrigins = make(map[string][][]string)
+	}
+	if s.WindowsOrigins == nil {
+		s.WindowsOrigins = make(map[string][][]string)
+	}
 
 	if err := s.getK8sVersionInfo(); err != nil {
 		return err
 	}
 
 	logrus.Infof("generating KDM system images...")
-	if err := fetchImages(s.LinuxInfo, s.LinuxImageSet); err != nil {
+	if err := fetchImages(s.LinuxInfo, s.LinuxImageSet, s.LinuxOrigins); err != nil {
 		return err
 	}
 
-	if err := fetchImages(s.WindowsInfo, s.WindowsImageSet); err != nil {
+	if err := fetchImages(s.WindowsInfo, s.WindowsImageSet, s.WindowsOrigins); err != nil {
 		return err
 	}
 	// Remove images begins with noiro
@@ -56,12 +67,14 @@ func (s *SystemImages) GetImages() error {
 		if discardImage(image) {
 			logrus.Debugf("Discard %q system image", image)
 			delete(s.LinuxImageSet, image)
+			delete(s.LinuxOrigins, image)
 		}
 	}
 	for image := range s.WindowsImageSet {
 		if discardImage(image) {
 			logrus.Debugf("Discard %q system image", image)
 			delete(s.WindowsImageSet, image)
+			delete(s.WindowsOrigins, image)
 		}
 	}
 	logrus.Infof("finished generating KDM system images")
@@ -81,32 +94,35 @@ func discardImage(image string) bool {
 func fetchImages(
 	versionInfo *VersionInfo,
 	imageSet map[string]map[string]bool,
+	origins map[string][][]string,
 ) error {
 	if versionInfo == nil || len(versionInfo.RKESystemImages) <= 0 {
 		return nil
 	}
-	collectionImagesList := []interface{}{versionInfo.RKESystemImages}
-	images, err := flatImagesFromCollections(collectionImagesList...)
-	if err != nil {
-		return fmt.Errorf("fetchImages: %w", err)
-	}
-	for _, image := range images {
-		u.AddSourceToImage(imageSet, image, "system")
-	}
-	return nil
-}
-
-func flatImagesFromCollections(
-	cols ...interface{},
-) (images []string, err error) {
-	for _, col := range cols {
+	for k8sVersion, sysImages := range versionInfo.RKESystemImages {
 		colObj := map[string]interface{}{}
-		if err := u.ToObj(col, &colObj); err != nil {
-			return []string{}, err
+		if err := u.ToObj(sysImages, &colObj); err != nil {
+			return fmt.Errorf("fetchImages: %w", err)
+		}
+		for component, v := range colObj {
+			var images []string
+			switch t := v.(type) {
+			case string:
+				images = []string{t}
+			case map[string]interface{}:
+				images = fetchImagesFromCollection(t)
+			}
+			for _, image := range images {
+				if image == "" {
+					continue
+				}
+				u.AddSourceToImage(imageSet, image, "system")
+				origins[image] = append(origins[image],
+					[]string{k8sVersion, component})
+			}
 		}
-		images = append(images, fetchImagesFromCollection(colObj)...)
 	}
-	return images, nil
+	return nil
 }
 
 func fetchImagesFromCollection(obj map[string]interface{}) (images []string) {
@@ -0,0 +1,24 @@
+// Package listgenerator generates the Rancher image list from the chart
+// repositories, KDM data, rancher-backup workloads, RKE2/K3s airgap lists
+// and co-deployed products.
+//
+// Example:
+//
+//	g, err := listgenerator.NewGenerator(&listgenerator.GeneratorOpts{
+//		RancherVersion: "v2.8.0",
+//		KDMURL:         "https://releases.rancher.com/kontainer-driver-metadata/release-v2.8/data.json",
+//		Progress: func(e listgenerator.ProgressEvent) {
+//			log.Printf("%s done: %v", e.Stage, e.Done)
+//		},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	result, err := g.Generate(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	for _, image := range result.LinuxImages {
+//		fmt.Println(image.Name, image.Sources)
+//	}
+package listgenerator
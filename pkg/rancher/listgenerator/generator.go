@@ -3,179 +3,278 @@ package listgenerator
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cnrancher/hangar/pkg/cmdconfig"
 	"github.com/cnrancher/hangar/pkg/rancher/chartimages"
 	"github.com/cnrancher/hangar/pkg/rancher/kdmimages"
+	"github.com/cnrancher/hangar/pkg/rancher/productimages"
+	"github.com/cnrancher/hangar/pkg/rancher/workloadimages"
 	u "github.com/cnrancher/hangar/pkg/utils"
 	"github.com/rancher/rke/types/kdm"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/mod/semver"
 )
 
-// Generator is a generator to generate image list from charts, KDM data, etc.
-type Generator struct {
+// ChartURL is the chart git repository to clone.
+type ChartURL struct {
+	Type   chartimages.ChartRepoType
+	Branch string // git branch, use default branch if empty
+}
+
+// GeneratorOpts is the options to create the Generator.
+type GeneratorOpts struct {
 	RancherVersion string // rancher version, should be va.b.c
 	MinKubeVersion string // minimum kube verision, should be va.b.c
 
-	ChartsPaths map[string]chartimages.ChartRepoType // map[url]type
-	ChartURLs   map[string]struct {
-		Type   chartimages.ChartRepoType
-		Branch string
-	}
+	ChartsPaths map[string]chartimages.ChartRepoType // map[path]type
+	ChartURLs   map[string]ChartURL                  // map[url]ChartURL
+
+	// ChartCacheDir is the directory to cache the chart image extraction
+	// results keyed by chart digest, cache is disabled if empty.
+	ChartCacheDir string
 
 	KDMPath string // the path of KDM data.json file
 	KDMURL  string // the remote URL of KDM data.json
 
+	// WorkloadPaths are the rancher-backup tarballs or kubernetes manifest
+	// files/directories to get the images of deployed workloads.
+	WorkloadPaths []string
+	// WorkloadAnnotation selects the workload resources to include in
+	// format KEY[=VALUE], all workloads are included if empty.
+	WorkloadAnnotation string
+
+	// RKE2Versions and K3sVersions are the RKE2/K3s release versions to
+	// include the official airgap image lists published upstream.
+	RKE2Versions []string
+	K3sVersions  []string
+
+	// Products are the co-deployed products (Longhorn, Harvester, etc.)
+	// to include the images at pinned versions.
+	Products []productimages.Product
+
 	WindowsImageArguments []string
 	LinuxImageArguments   []string
 
+	// Workers is the max number of parallel jobs to process the chart
+	// versions and KDM components (default 5).
+	Workers int
+
+	// Progress is called when a generate stage starts and finishes,
+	// it may be called concurrently from multiple goroutines. Optional.
+	Progress ProgressFunc
+}
+
+// Generator is a generator to generate image list from charts, KDM data, etc.
+type Generator struct {
+	opts GeneratorOpts
+
 	// generated images, map[image]map[source]true
-	GeneratedLinuxImages   map[string]map[string]bool
-	GeneratedWindowsImages map[string]map[string]bool
+	linuxImages   map[string]map[string]bool
+	windowsImages map[string]map[string]bool
+	// origin paths of the generated images, map[image][]origin
+	linuxOrigins   map[string][][]string
+	windowsOrigins map[string][][]string
+
+	mu sync.Mutex
 }
 
-func (g *Generator) init() {
-	if g.GeneratedLinuxImages == nil {
-		g.GeneratedLinuxImages = make(map[string]map[string]bool)
+const (
+	// DefaultWorkers is the default number of parallel jobs.
+	DefaultWorkers = 5
+)
+
+// NewGenerator creates a new Generator from the options.
+func NewGenerator(o *GeneratorOpts) (*Generator, error) {
+	if o == nil {
+		return nil, fmt.Errorf("NewGenerator: options is nil")
+	}
+	g := &Generator{
+		opts: *o,
 	}
-	if g.GeneratedWindowsImages == nil {
-		g.GeneratedWindowsImages = make(map[string]map[string]bool)
+	if err := g.selfCheck(); err != nil {
+		return nil, fmt.Errorf("NewGenerator: %w", err)
 	}
+	return g, nil
+}
+
+func (g *Generator) init() {
+	g.linuxImages = make(map[string]map[string]bool)
+	g.windowsImages = make(map[string]map[string]bool)
+	g.linuxOrigins = make(map[string][][]string)
+	g.windowsOrigins = make(map[string][][]string)
 }
 
 func (g *Generator) selfCheck() error {
-	if g.RancherVersion == "" {
+	if g.opts.RancherVersion == "" {
 		return fmt.Errorf("RancherVersion is empty")
 	}
-	if !strings.HasPrefix(g.RancherVersion, "v") {
-		g.RancherVersion = "v" + g.RancherVersion
+	if !strings.HasPrefix(g.opts.RancherVersion, "v") {
+		g.opts.RancherVersion = "v" + g.opts.RancherVersion
 	}
-	if !semver.IsValid(g.RancherVersion) {
-		return fmt.Errorf("%q is not a valid Rancher version", g.RancherVersion)
+	if !semver.IsValid(g.opts.RancherVersion) {
+		return fmt.Errorf("%q is not a valid Rancher version", g.opts.RancherVersion)
 	}
-	if g.ChartURLs == nil && g.ChartsPaths == nil &&
-		g.KDMPath == "" && g.KDMURL == "" {
+	if len(g.opts.ChartURLs) == 0 && len(g.opts.ChartsPaths) == 0 &&
+		g.opts.KDMPath == "" && g.opts.KDMURL == "" &&
+		len(g.opts.WorkloadPaths) == 0 &&
+		len(g.opts.RKE2Versions) == 0 && len(g.opts.K3sVersions) == 0 &&
+		len(g.opts.Products) == 0 {
 		return fmt.Errorf("no input source provided")
 	}
 
 	return nil
 }
 
-func (g *Generator) Generate(ctx context.Context) error {
-	if err := g.selfCheck(); err != nil {
-		return err
-	}
+// Generate generates the image list from the input sources.
+// It can be called multiple times, each call returns a new Result.
+func (g *Generator) Generate(ctx context.Context) (*Result, error) {
+	g.mu.Lock()
 	g.init()
+	g.mu.Unlock()
 
-	if err := g.generateFromChartPaths(ctx); err != nil {
-		return err
+	err := runParallel(ctx, g.workers(),
+		g.stage(StageChartPaths, g.generateFromChartPaths),
+		g.stage(StageChartURLs, g.generateFromChartURLs),
+		g.stage(StageKDMPath, g.generateFromKDMPath),
+		g.stage(StageKDMURL, g.generateFromKDMURL),
+		g.stage(StageWorkloads, g.generateFromWorkloadPaths),
+		g.stage(StageAirgapLists, g.generateFromAirgapLists),
+		g.stage(StageProducts, g.generateFromProducts),
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := g.generateFromChartURLs(ctx); err != nil {
-		return err
+	if err := g.handleImageArguments(ctx); err != nil {
+		return nil, err
 	}
 
-	if err := g.generateFromKDMPath(ctx); err != nil {
-		return err
-	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return newResult(g.linuxImages, g.windowsImages,
+		g.linuxOrigins, g.windowsOrigins), nil
+}
 
-	if err := g.generateFromKDMURL(ctx); err != nil {
-		return err
+func (g *Generator) workers() int {
+	if g.opts.Workers <= 0 {
+		return DefaultWorkers
 	}
+	return g.opts.Workers
+}
 
-	if err := g.handleImageArguments(ctx); err != nil {
-		return err
-	}
+// addLinuxImage adds the linux image with its source and origin paths,
+// the origin path is [source] if no origins provided.
+func (g *Generator) addLinuxImage(image, source string, origins ...[]string) {
+	g.mu.Lock()
+	addImage(g.linuxImages, g.linuxOrigins, image, source, origins)
+	g.mu.Unlock()
+}
 
-	return nil
+// addWindowsImage adds the windows image with its source and origin paths,
+// the origin path is [source] if no origins provided.
+func (g *Generator) addWindowsImage(image, source string, origins ...[]string) {
+	g.mu.Lock()
+	addImage(g.windowsImages, g.windowsOrigins, image, source, origins)
+	g.mu.Unlock()
 }
 
-func (g *Generator) generateFromChartPaths(ctx context.Context) error {
-	if g.ChartsPaths == nil || len(g.ChartsPaths) == 0 {
-		return nil
-	}
-	for path := range g.ChartsPaths {
-		c := chartimages.Chart{
-			RancherVersion: g.RancherVersion,
-			OS:             chartimages.Linux,
-			Type:           g.ChartsPaths[path],
-			Path:           path,
-		}
-		if err := c.FetchImages(ctx); err != nil {
-			return err
-		}
-		for image := range c.ImageSet {
-			for source := range c.ImageSet[image] {
-				u.AddSourceToImage(g.GeneratedLinuxImages, image, source)
-			}
-		}
-		// fetch windows images
-		c.OS = chartimages.Windows
+func addImage(
+	imageSet map[string]map[string]bool,
+	originSet map[string][][]string,
+	image, source string,
+	origins [][]string,
+) {
+	if image == "" {
+		return
+	}
+	u.AddSourceToImage(imageSet, image, source)
+	if len(origins) == 0 {
+		origins = [][]string{{source}}
+	}
+	originSet[image] = append(originSet[image], origins...)
+}
+
+// generateFromChart fetches the linux and windows images of the chart.
+func (g *Generator) generateFromChart(ctx context.Context, c chartimages.Chart) error {
+	for _, osType := range []chartimages.OsType{chartimages.Linux, chartimages.Windows} {
+		c.OS = osType
 		c.ImageSet = make(map[string]map[string]bool)
 		if err := c.FetchImages(ctx); err != nil {
 			return err
 		}
+		add := g.addLinuxImage
+		if osType == chartimages.Windows {
+			add = g.addWindowsImage
+		}
 		for image := range c.ImageSet {
 			for source := range c.ImageSet[image] {
-				u.AddSourceToImage(g.GeneratedWindowsImages, image, source)
+				add(image, source, c.Origins[image]...)
 			}
 		}
 	}
 	return nil
 }
 
+func (g *Generator) generateFromChartPaths(ctx context.Context) error {
+	if len(g.opts.ChartsPaths) == 0 {
+		return nil
+	}
+	jobs := make([]job, 0, len(g.opts.ChartsPaths))
+	for path := range g.opts.ChartsPaths {
+		c := chartimages.Chart{
+			RancherVersion: g.opts.RancherVersion,
+			Type:           g.opts.ChartsPaths[path],
+			Path:           path,
+			CacheDir:       g.opts.ChartCacheDir,
+			Workers:        g.workers(),
+		}
+		jobs = append(jobs, func(ctx context.Context) error {
+			return g.generateFromChart(ctx, c)
+		})
+	}
+	return runParallel(ctx, g.workers(), jobs...)
+}
+
 func (g *Generator) generateFromChartURLs(ctx context.Context) error {
-	if g.ChartURLs == nil || len(g.ChartURLs) == 0 {
+	if len(g.opts.ChartURLs) == 0 {
 		return nil
 	}
-	for url := range g.ChartURLs {
+	jobs := make([]job, 0, len(g.opts.ChartURLs))
+	for url := range g.opts.ChartURLs {
 		c := chartimages.Chart{
-			RancherVersion: g.RancherVersion,
-			OS:             chartimages.Linux,
-			Type:           g.ChartURLs[url].Type,
-			Branch:         g.ChartURLs[url].Branch,
+			RancherVersion: g.opts.RancherVersion,
+			Type:           g.opts.ChartURLs[url].Type,
+			Branch:         g.opts.ChartURLs[url].Branch,
 			URL:            url,
+			CacheDir:       g.opts.ChartCacheDir,
+			Workers:        g.workers(),
 		}
-		if err := c.FetchImages(ctx); err != nil {
-			return err
-		}
-		for image := range c.ImageSet {
-			for source := range c.ImageSet[image] {
-				u.AddSourceToImage(g.GeneratedLinuxImages, image, source)
-			}
-		}
-		// fetch windows images
-		c.OS = chartimages.Windows
-		c.ImageSet = make(map[string]map[string]bool)
-		if err := c.FetchImages(ctx); err != nil {
-			return err
-		}
-		for image := range c.ImageSet {
-			for source := range c.ImageSet[image] {
-				u.AddSourceToImage(g.GeneratedWindowsImages, image, source)
-			}
-		}
-		// Delete cloned chart path after generated images
-		logrus.Debugf("Delete %q", u.CacheCloneRepoDirectory)
-		if err := u.DeleteIfExist(u.CacheCloneRepoDirectory); err != nil {
-			return err
-		}
+		jobs = append(jobs, func(ctx context.Context) error {
+			return g.generateFromChart(ctx, c)
+		})
 	}
-	return nil
+	err := runParallel(ctx, g.workers(), jobs...)
+	// Delete cloned chart path after generated images
+	logrus.Debugf("Delete %q", u.CacheCloneRepoDirectory)
+	if e := u.DeleteIfExist(u.CacheCloneRepoDirectory); e != nil {
+		return errors.Join(err, e)
+	}
+	return err
 }
 
 func (g *Generator) generateFromKDMPath(ctx context.Context) error {
-	if g.KDMPath == "" {
+	if g.opts.KDMPath == "" {
 		return nil
 	}
-	b, err := os.ReadFile(g.KDMPath)
+	b, err := os.ReadFile(g.opts.KDMPath)
 	if err != nil {
 		return err
 	}
@@ -183,16 +282,16 @@ func (g *Generator) generateFromKDMPath(ctx context.Context) error {
 }
 
 func (g *Generator) generateFromKDMURL(ctx context.Context) error {
-	if g.KDMURL == "" {
+	if g.opts.KDMURL == "" {
 		return nil
 	}
-	logrus.Infof("get KDM data from URL: %q", g.KDMURL)
-	b, err := getHTTPData(ctx, g.KDMURL, time.Second*30)
+	logrus.Infof("get KDM data from URL: %q", g.opts.KDMURL)
+	b, err := getHTTPData(ctx, g.opts.KDMURL, time.Second*30)
 	if err != nil {
 		// re-try get data from KDM url
 		logrus.Warn(err)
 		logrus.Warnf("failed to get KDM data, retrying...")
-		b, err = getHTTPData(ctx, g.KDMURL, time.Second*30)
+		b, err = getHTTPData(ctx, g.opts.KDMURL, time.Second*30)
 		if err != nil {
 			return fmt.Errorf("generateFromKDMURL: %w", err)
 		}
@@ -200,99 +299,162 @@ func (g *Generator) generateFromKDMURL(ctx context.Context) error {
 	return g.generateFromKDMData(ctx, b)
 }
 
-func (g *Generator) generateFromKDMData(_ context.Context, b []byte) error {
+func (g *Generator) generateFromKDMData(ctx context.Context, b []byte) error {
 	data, err := kdm.FromData(b)
 	if err != nil {
 		return fmt.Errorf("generateFromKDMData: %w", err)
 	}
 	// get release images
-	r := kdmimages.ReleaseImages{
-		Source: kdmimages.K3S,
-		Data:   data.K3S,
+	releaseJob := func(source string, d map[string]any, imageSource string) job {
+		return func(_ context.Context) error {
+			r := kdmimages.ReleaseImages{
+				Source: source,
+				Data:   d,
+			}
+			images, err := r.GetImages()
+			if err != nil {
+				return fmt.Errorf("generateFromKDMData: %w", err)
+			}
+			for _, image := range images {
+				g.addLinuxImage(image, imageSource)
+			}
+			return nil
+		}
 	}
-	k3sReleaseImages, err := r.GetImages()
-	if err != nil {
-		return fmt.Errorf("generateFromKDMData: %w", err)
+	// get system-images
+	systemJob := func(_ context.Context) error {
+		s := kdmimages.SystemImages{
+			RancherVersion:    g.opts.RancherVersion,
+			RkeSysImages:      data.K8sVersionRKESystemImages,
+			LinuxSvcOptions:   data.K8sVersionServiceOptions,
+			WindowsSvcOptions: data.K8sVersionWindowsServiceOptions,
+			RancherVersions:   data.K8sVersionInfo,
+		}
+		if err := s.GetImages(); err != nil {
+			return fmt.Errorf("generateFromKDMData: %w", err)
+		}
+		// clone generated system-images
+		for image := range s.LinuxImageSet {
+			for source := range s.LinuxImageSet[image] {
+				g.addLinuxImage(image, source, kdmOrigins(s.LinuxOrigins[image])...)
+			}
+		}
+		for image := range s.WindowsImageSet {
+			for source := range s.WindowsImageSet[image] {
+				g.addLinuxImage(image, source, kdmOrigins(s.WindowsOrigins[image])...)
+			}
+		}
+		return nil
 	}
-	for _, image := range k3sReleaseImages {
-		if g.GeneratedLinuxImages[image] == nil {
-			g.GeneratedLinuxImages[image] = make(map[string]bool)
+	// get k3s/rke2 upgrade images
+	upgradeJob := func(source string, d map[string]any, imageSource string) job {
+		return func(_ context.Context) error {
+			upgrade := kdmimages.UpgradeImages{
+				Source:         source,
+				RancherVersion: g.opts.RancherVersion,
+				MinKubeVersion: g.opts.MinKubeVersion,
+				Data:           d,
+			}
+			images, err := upgrade.GetImages()
+			if err != nil {
+				return fmt.Errorf("generateFromKDMData: %w", err)
+			}
+			for _, image := range images {
+				g.addLinuxImage(image, imageSource)
+			}
+			return nil
 		}
-		g.GeneratedLinuxImages[image]["[k3s-release(rancher)]"] = true
 	}
 
-	r.Source = kdmimages.RKE2
-	r.Data = data.RKE2
-	rke2ReleaseImages, err := r.GetImages()
-	if err != nil {
-		return fmt.Errorf("generateFromKDMData: %w", err)
+	jobs := []job{
+		releaseJob(kdmimages.K3S, data.K3S, "[k3s-release(rancher)]"),
+		releaseJob(kdmimages.RKE2, data.RKE2, "[rke2-release(rancher)]"),
+		systemJob,
+		upgradeJob(kdmimages.K3S, data.K3S, "k3sUpgrade"),
 	}
-	for _, image := range rke2ReleaseImages {
-		if g.GeneratedLinuxImages[image] == nil {
-			g.GeneratedLinuxImages[image] = make(map[string]bool)
-		}
-		g.GeneratedLinuxImages[image]["[rke2-release(rancher)]"] = true
+	// 2.5.X does not have RKE2 system images to generate, skip
+	if !u.SemverMajorMinorEqual(g.opts.RancherVersion, "v2.5") {
+		jobs = append(jobs, upgradeJob(kdmimages.RKE2, data.RKE2, "rke2All"))
 	}
+	return runParallel(ctx, g.workers(), jobs...)
+}
 
-	// get system-images
-	s := kdmimages.SystemImages{
-		RancherVersion:    g.RancherVersion,
-		RkeSysImages:      data.K8sVersionRKESystemImages,
-		LinuxSvcOptions:   data.K8sVersionServiceOptions,
-		WindowsSvcOptions: data.K8sVersionWindowsServiceOptions,
-		RancherVersions:   data.K8sVersionInfo,
-	}
-	err = s.GetImages()
-	if err != nil {
-		return fmt.Errorf("generateFromKDMData: %w", err)
+// kdmOrigins adds the 'KDM' prefix to the system image origins.
+func kdmOrigins(origins [][]string) [][]string {
+	result := make([][]string, 0, len(origins))
+	for _, o := range origins {
+		result = append(result, append([]string{"KDM"}, o...))
 	}
-	// clone generated system-images
-	for image := range s.LinuxImageSet {
-		for source := range s.LinuxImageSet[image] {
-			u.AddSourceToImage(g.GeneratedLinuxImages, image, source)
+	return result
+}
+
+func (g *Generator) generateFromWorkloadPaths(ctx context.Context) error {
+	for _, path := range g.opts.WorkloadPaths {
+		logrus.Infof("get workload images from %q", path)
+		w := workloadimages.Workload{
+			Path:       path,
+			Annotation: g.opts.WorkloadAnnotation,
 		}
-	}
-	for image := range s.WindowsImageSet {
-		for source := range s.WindowsImageSet[image] {
-			u.AddSourceToImage(g.GeneratedLinuxImages, image, source)
+		if err := w.FetchImages(ctx); err != nil {
+			return fmt.Errorf("generateFromWorkloadPaths: %w", err)
+		}
+		for image := range w.LinuxImageSet {
+			for source := range w.LinuxImageSet[image] {
+				g.addLinuxImage(image, source)
+			}
+		}
+		for image := range w.WindowsImageSet {
+			for source := range w.WindowsImageSet[image] {
+				g.addWindowsImage(image, source)
+			}
 		}
 	}
+	return nil
+}
 
-	// get k3s/rke2 upgrade images
-	upgrade := kdmimages.UpgradeImages{
-		Source:         kdmimages.K3S,
-		RancherVersion: g.RancherVersion,
-		MinKubeVersion: g.MinKubeVersion,
-		Data:           data.K3S,
-	}
-	k3sUpgradeImages, err := upgrade.GetImages()
-	if err != nil {
-		return fmt.Errorf("generateFromKDMData: %w", err)
-	}
-
-	for _, image := range k3sUpgradeImages {
-		if g.GeneratedLinuxImages[image] == nil {
-			g.GeneratedLinuxImages[image] = make(map[string]bool)
+func (g *Generator) generateFromAirgapLists(_ context.Context) error {
+	airgaps := make([]kdmimages.AirgapImages, 0,
+		len(g.opts.RKE2Versions)+len(g.opts.K3sVersions))
+	for _, v := range g.opts.RKE2Versions {
+		airgaps = append(airgaps, kdmimages.AirgapImages{
+			Source:  kdmimages.RKE2,
+			Version: v,
+		})
+	}
+	for _, v := range g.opts.K3sVersions {
+		airgaps = append(airgaps, kdmimages.AirgapImages{
+			Source:  kdmimages.K3S,
+			Version: v,
+		})
+	}
+	for _, a := range airgaps {
+		linux, windows, err := a.GetImages()
+		if err != nil {
+			return fmt.Errorf("generateFromAirgapLists: %w", err)
+		}
+		for _, image := range linux {
+			g.addLinuxImage(image, a.SourceName())
+		}
+		for _, image := range windows {
+			g.addWindowsImage(image, a.SourceName())
 		}
-		g.GeneratedLinuxImages[image]["k3sUpgrade"] = true
 	}
+	return nil
+}
 
-	// 2.5.X does not have RKE2 system images to generate, skip
-	if !u.SemverMajorMinorEqual(g.RancherVersion, "v2.5") {
-		upgrade.Source = kdmimages.RKE2
-		upgrade.Data = data.RKE2
-		rke2UpgradeImages, err := upgrade.GetImages()
+func (g *Generator) generateFromProducts(ctx context.Context) error {
+	for _, p := range g.opts.Products {
+		linux, windows, err := p.GetImages(ctx)
 		if err != nil {
-			return fmt.Errorf("generateFromKDMData: %w", err)
+			return fmt.Errorf("generateFromProducts: %w", err)
 		}
-		for _, image := range rke2UpgradeImages {
-			if g.GeneratedLinuxImages[image] == nil {
-				g.GeneratedLinuxImages[image] = make(map[string]bool)
-			}
-			g.GeneratedLinuxImages[image]["rke2All"] = true
+		for _, image := range linux {
+			g.addLinuxImage(image, p.SourceName())
+		}
+		for _, image := range windows {
+			g.addWindowsImage(image, p.SourceName())
 		}
 	}
-
 	return nil
 }
 
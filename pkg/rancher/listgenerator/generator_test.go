@@ -8,6 +8,7 @@ import (
 
 	"github.com/rancher/rke/types/kdm"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 )
 
 func init() {
@@ -45,8 +46,10 @@ func Test_DataJson(t *testing.T) {
 
 func Test_generateFromKDMPath(t *testing.T) {
 	g := Generator{
-		RancherVersion: "v2.8.0",
-		KDMPath:        "test/data.json",
+		opts: GeneratorOpts{
+			RancherVersion: "v2.8.0",
+			KDMPath:        "test/data.json",
+		},
 	}
 	g.init()
 	err := g.generateFromKDMPath(context.TODO())
@@ -56,7 +59,7 @@ func Test_generateFromKDMPath(t *testing.T) {
 		}
 		t.Error(err)
 	}
-	for source, imageMap := range g.GeneratedLinuxImages {
+	for source, imageMap := range g.linuxImages {
 		for k := range imageMap {
 			t.Logf("[%v] %s", source, k)
 		}
@@ -65,17 +68,53 @@ func Test_generateFromKDMPath(t *testing.T) {
 
 func Test_generateFromKDMURL(t *testing.T) {
 	g := Generator{
-		RancherVersion: "v2.8.0",
-		KDMURL:         "",
+		opts: GeneratorOpts{
+			RancherVersion: "v2.8.0",
+			KDMURL:         "",
+		},
 	}
 	g.init()
 	err := g.generateFromKDMURL(context.TODO())
 	if err != nil {
 		t.Error(err)
 	}
-	for source, imageMap := range g.GeneratedLinuxImages {
+	for source, imageMap := range g.linuxImages {
 		for k := range imageMap {
 			t.Logf("[%v] %s", source, k)
 		}
 	}
 }
+
+func Test_NewGenerator(t *testing.T) {
+	_, err := NewGenerator(&GeneratorOpts{
+		RancherVersion: "v2.8.0",
+	})
+	assert.NotNil(t, err)
+
+	_, err = NewGenerator(&GeneratorOpts{
+		RancherVersion: "invalid",
+		KDMPath:        "test/data.json",
+	})
+	assert.NotNil(t, err)
+
+	g, err := NewGenerator(&GeneratorOpts{
+		RancherVersion: "2.8.0",
+		KDMPath:        "test/data.json",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "v2.8.0", g.opts.RancherVersion)
+}
+
+func Test_newResult(t *testing.T) {
+	r := newResult(map[string]map[string]bool{
+		"rancher/b:v1": {"s2": true, "s1": true},
+		"rancher/a:v1": {"s1": true},
+	}, map[string]map[string]bool{
+		"rancher/a:v1": {"s3": true},
+	}, nil, nil)
+	assert.Equal(t, []Image{
+		{Name: "rancher/a:v1", Sources: []string{"s1"}},
+		{Name: "rancher/b:v1", Sources: []string{"s1", "s2"}},
+	}, r.LinuxImages)
+	assert.Equal(t, []string{"rancher/a:v1", "rancher/b:v1"}, r.Images())
+}
@@ -0,0 +1,154 @@
+package listgenerator
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// GraphFormat is the output format of the image origin graph.
+type GraphFormat string
+
+const (
+	GraphFormatDOT  GraphFormat = "dot"
+	GraphFormatJSON GraphFormat = "json"
+)
+
+// NodeType is the type of the graph node.
+type NodeType string
+
+const (
+	NodeTypeOrigin NodeType = "origin"
+	NodeTypeImage  NodeType = "image"
+)
+
+// GraphNode is the node of the image origin graph.
+type GraphNode struct {
+	ID    string   `json:"id"`
+	Label string   `json:"label"`
+	Type  NodeType `json:"type"`
+	// OS is the image OS (linux, windows), only set for image node.
+	OS string `json:"os,omitempty"`
+}
+
+// GraphEdge is the edge of the image origin graph, from parent to child.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Graph is the image origin graph, example:
+//
+//	chart-repo -> chart:version -> subchart -> image
+//	KDM -> k8s-version -> component -> image
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// Graph builds the image origin graph of the result.
+func (r *Result) Graph() *Graph {
+	nodes := map[string]GraphNode{}
+	edges := map[GraphEdge]bool{}
+	add := func(images []Image, os string) {
+		for _, image := range images {
+			imageID := "image:" + image.Name
+			if n, ok := nodes[imageID]; ok && n.OS != os {
+				n.OS = "linux,windows"
+				nodes[imageID] = n
+			} else {
+				nodes[imageID] = GraphNode{
+					ID:    imageID,
+					Label: image.Name,
+					Type:  NodeTypeImage,
+					OS:    os,
+				}
+			}
+			for _, origin := range image.Origins {
+				parent := ""
+				for i := range origin {
+					id := "origin:" + strings.Join(origin[:i+1], "/")
+					if _, ok := nodes[id]; !ok {
+						nodes[id] = GraphNode{
+							ID:    id,
+							Label: origin[i],
+							Type:  NodeTypeOrigin,
+						}
+					}
+					if parent != "" {
+						edges[GraphEdge{From: parent, To: id}] = true
+					}
+					parent = id
+				}
+				if parent != "" {
+					edges[GraphEdge{From: parent, To: imageID}] = true
+				}
+			}
+		}
+	}
+	add(r.LinuxImages, "linux")
+	add(r.WindowsImages, "windows")
+
+	g := &Graph{
+		Nodes: make([]GraphNode, 0, len(nodes)),
+		Edges: make([]GraphEdge, 0, len(edges)),
+	}
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	for e := range edges {
+		g.Edges = append(g.Edges, e)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g
+}
+
+// Write writes the graph in the specified format.
+func (g *Graph) Write(w io.Writer, format GraphFormat) error {
+	switch format {
+	case GraphFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(g)
+	case GraphFormatDOT, "":
+		return g.writeDOT(w)
+	default:
+		return fmt.Errorf("unsupported graph format %q", format)
+	}
+}
+
+func (g *Graph) writeDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph images {")
+	fmt.Fprintln(bw, "  rankdir=LR;")
+	for _, n := range g.Nodes {
+		shape := "box"
+		if n.Type == NodeTypeImage {
+			shape = "ellipse"
+		}
+		fmt.Fprintf(bw, "  %s [label=%s, shape=%s];\n",
+			dotQuote(n.ID), dotQuote(n.Label), shape)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(bw, "  %s -> %s;\n", dotQuote(e.From), dotQuote(e.To))
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,37 @@
+package listgenerator
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Graph(t *testing.T) {
+	r := newResult(map[string]map[string]bool{
+		"rancher/a:v1": {"[repo;rancher:1.0.0]": true},
+		"rancher/b:v1": {"system": true},
+	}, nil, map[string][][]string{
+		"rancher/a:v1": {
+			{"repo", "rancher:1.0.0", "sub"},
+			{"repo", "rancher:1.0.0", "sub"},
+		},
+		"rancher/b:v1": {{"KDM", "v1.27.8-rancher1-1", "etcd"}},
+	}, nil)
+	g := r.Graph()
+	assert.Equal(t, 8, len(g.Nodes))
+	assert.Equal(t, 6, len(g.Edges))
+	assert.Contains(t, g.Edges, GraphEdge{
+		From: "origin:repo/rancher:1.0.0/sub",
+		To:   "image:rancher/a:v1",
+	})
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, g.Write(buf, GraphFormatDOT))
+	assert.Contains(t, buf.String(),
+		`"origin:KDM/v1.27.8-rancher1-1/etcd" -> "image:rancher/b:v1";`)
+	buf.Reset()
+	assert.Nil(t, g.Write(buf, GraphFormatJSON))
+	assert.Contains(t, buf.String(), `"type": "image"`)
+	assert.NotNil(t, g.Write(buf, "yaml"))
+}
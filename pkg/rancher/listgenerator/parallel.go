@@ -0,0 +1,54 @@
+package listgenerator
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type job func(ctx context.Context) error
+
+// runParallel runs the jobs with at most workers goroutines, waits for
+// all the started jobs to finish and returns the joined errors.
+func runParallel(ctx context.Context, workers int, jobs ...job) error {
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		wg   = sync.WaitGroup{}
+		mu   = sync.Mutex{}
+		sem  = make(chan struct{}, workers)
+		errs []error
+	)
+	appendErr := func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+
+loop:
+	for _, j := range jobs {
+		if err := ctx.Err(); err != nil {
+			appendErr(err)
+			break
+		}
+		select {
+		case <-ctx.Done():
+			appendErr(ctx.Err())
+			break loop
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(j job) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := j(ctx); err != nil {
+				appendErr(err)
+			}
+		}(j)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,47 @@
+package listgenerator
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_runParallel(t *testing.T) {
+	var (
+		count   atomic.Int32
+		running atomic.Int32
+		max     atomic.Int32
+	)
+	errTest := errors.New("test")
+	jobs := make([]job, 0, 10)
+	for i := 0; i < 10; i++ {
+		i := i
+		jobs = append(jobs, func(_ context.Context) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := max.Load()
+				if n <= m || max.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			count.Add(1)
+			if i%5 == 0 {
+				return errTest
+			}
+			return nil
+		})
+	}
+	err := runParallel(context.TODO(), 3, jobs...)
+	assert.ErrorIs(t, err, errTest)
+	assert.Equal(t, int32(10), count.Load())
+	assert.LessOrEqual(t, max.Load(), int32(3))
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	err = runParallel(ctx, 3, jobs...)
+	assert.ErrorIs(t, err, context.Canceled)
+}
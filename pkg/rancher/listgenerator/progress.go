@@ -0,0 +1,55 @@
+package listgenerator
+
+import (
+	"context"
+	"time"
+)
+
+// Stage is the image source stage of the generator.
+type Stage string
+
+const (
+	StageChartPaths  Stage = "chart-paths"
+	StageChartURLs   Stage = "chart-urls"
+	StageKDMPath     Stage = "kdm-path"
+	StageKDMURL      Stage = "kdm-url"
+	StageWorkloads   Stage = "workloads"
+	StageAirgapLists Stage = "airgap-lists"
+	StageProducts    Stage = "products"
+)
+
+// ProgressEvent is the event sent to the ProgressFunc when a stage
+// starts or finishes.
+type ProgressEvent struct {
+	Stage Stage
+	// Done is false when the stage starts and true when the stage finishes.
+	Done bool
+	// Elapsed is the time spent by the stage, only set when Done.
+	Elapsed time.Duration
+	// Err is the error of the finished stage.
+	Err error
+}
+
+// ProgressFunc is the callback function to receive the progress events.
+type ProgressFunc func(ProgressEvent)
+
+// stage wraps the job to send progress events to the ProgressFunc.
+func (g *Generator) stage(s Stage, j job) job {
+	if g.opts.Progress == nil {
+		return j
+	}
+	return func(ctx context.Context) error {
+		begin := time.Now()
+		g.opts.Progress(ProgressEvent{
+			Stage: s,
+		})
+		err := j(ctx)
+		g.opts.Progress(ProgressEvent{
+			Stage:   s,
+			Done:    true,
+			Elapsed: time.Since(begin),
+			Err:     err,
+		})
+		return err
+	}
+}
@@ -0,0 +1,99 @@
+package listgenerator
+
+import (
+	"sort"
+	"strings"
+)
+
+// Image is a generated image with the origins where it is referenced.
+type Image struct {
+	// Name is the image reference, example: rancher/rancher:v2.8.0
+	Name string `json:"name"`
+	// Sources are the sorted origins of the image, example:
+	// chart, KDM data, workload, etc.
+	Sources []string `json:"sources"`
+	// Origins are the sorted origin paths of the image, example:
+	// [chart-repo, chart:version, subchart], [KDM, k8s-version, component]
+	Origins [][]string `json:"origins,omitempty"`
+}
+
+// Result is the typed result of the generated image list.
+type Result struct {
+	// LinuxImages are the sorted linux images.
+	LinuxImages []Image `json:"linux"`
+	// WindowsImages are the sorted windows images.
+	WindowsImages []Image `json:"windows"`
+}
+
+func newResult(
+	linux, windows map[string]map[string]bool,
+	linuxOrigins, windowsOrigins map[string][][]string,
+) *Result {
+	return &Result{
+		LinuxImages:   imageSetToList(linux, linuxOrigins),
+		WindowsImages: imageSetToList(windows, windowsOrigins),
+	}
+}
+
+func imageSetToList(
+	set map[string]map[string]bool, origins map[string][][]string,
+) []Image {
+	images := make([]Image, 0, len(set))
+	for name, sources := range set {
+		image := Image{
+			Name:    name,
+			Sources: make([]string, 0, len(sources)),
+			Origins: uniqueOrigins(origins[name]),
+		}
+		for source := range sources {
+			image.Sources = append(image.Sources, source)
+		}
+		sort.Strings(image.Sources)
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Name < images[j].Name
+	})
+	return images
+}
+
+// Images returns the sorted and deduplicated names of the linux and
+// windows images.
+func (r *Result) Images() []string {
+	set := make(map[string]bool, len(r.LinuxImages)+len(r.WindowsImages))
+	for _, image := range r.LinuxImages {
+		set[image.Name] = true
+	}
+	for _, image := range r.WindowsImages {
+		set[image.Name] = true
+	}
+	images := make([]string, 0, len(set))
+	for name := range set {
+		images = append(images, name)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// uniqueOrigins removes the duplicated origin paths and sorts them.
+func uniqueOrigins(origins [][]string) [][]string {
+	if len(origins) == 0 {
+		return nil
+	}
+	set := make(map[string][]string, len(origins))
+	keys := make([]string, 0, len(origins))
+	for _, o := range origins {
+		key := strings.Join(o, "\x00")
+		if _, ok := set[key]; ok {
+			continue
+		}
+		set[key] = o
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, set[key])
+	}
+	return result
+}
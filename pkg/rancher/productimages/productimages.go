@@ -0,0 +1,299 @@
+package productimages
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/rancher/chartimages"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// VersionPlaceholder is replaced by the product version in the
+	// image list URL.
+	VersionPlaceholder = "{version}"
+
+	// Built-in product names.
+	Longhorn  = "longhorn"
+	Harvester = "harvester"
+)
+
+// Provider gets the image list of a product at the specified version.
+type Provider interface {
+	// Name is the product name of the provider.
+	Name() string
+	// GetImages returns the linux and windows images of the product.
+	GetImages(ctx context.Context, version string) (linux, windows []string, err error)
+}
+
+var (
+	providers   = map[string]Provider{}
+	providersMu = sync.RWMutex{}
+)
+
+func init() {
+	Register(&listProvider{
+		name:     Longhorn,
+		linuxURL: "https://raw.githubusercontent.com/longhorn/longhorn/{version}/deploy/longhorn-images.txt",
+	})
+	Register(&listProvider{
+		name:     Harvester,
+		linuxURL: "https://github.com/harvester/harvester/releases/download/{version}/harvester-images-list-amd64.txt",
+	})
+}
+
+// Register registers the product list provider, the provider registered
+// with the same name will be replaced.
+func Register(p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[strings.ToLower(p.Name())] = p
+}
+
+// Providers returns the sorted names of the registered providers.
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getProvider(name string) (Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, ok := providers[strings.ToLower(name)]
+	return p, ok
+}
+
+// Product is the config-declared product to include in the image list.
+type Product struct {
+	// Name is the product name, the built-in provider is used if
+	// both URL and Chart are empty.
+	Name string `json:"name"`
+	// Version is the pinned product version.
+	Version string `json:"version"`
+	// URL is the remote image list URL of the product,
+	// the '{version}' in URL is replaced by the product version.
+	URL string `json:"url,omitempty"`
+	// WindowsURL is the remote windows image list URL of the product.
+	WindowsURL string `json:"windowsURL,omitempty"`
+	// Chart is the local chart directory or tarball (.tgz) of the product.
+	Chart string `json:"chart,omitempty"`
+}
+
+// Config is the product list config file format.
+type Config struct {
+	Products []Product `json:"products"`
+}
+
+// LoadConfig loads the products from the YAML/JSON config file.
+func LoadConfig(path string) ([]Product, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("LoadConfig: %w", err)
+	}
+	var c Config
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("LoadConfig: failed to decode %q: %w", path, err)
+	}
+	for _, p := range c.Products {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("LoadConfig: %w", err)
+		}
+	}
+	return c.Products, nil
+}
+
+// Parse parses the product from the 'NAME=VERSION' format string.
+func Parse(s string) (Product, error) {
+	name, version, ok := strings.Cut(s, "=")
+	p := Product{
+		Name:    strings.TrimSpace(name),
+		Version: strings.TrimSpace(version),
+	}
+	if !ok {
+		return p, fmt.Errorf("invalid product %q, should be 'NAME=VERSION'", s)
+	}
+	return p, p.Validate()
+}
+
+// Validate checks the product name & version and the provider.
+func (p *Product) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("product name is empty")
+	}
+	if p.Version == "" {
+		return fmt.Errorf("version of product %q is empty", p.Name)
+	}
+	if p.URL != "" && p.Chart != "" {
+		return fmt.Errorf("product %q: url and chart are mutually exclusive", p.Name)
+	}
+	if _, err := p.Provider(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Provider returns the image list provider of the product.
+func (p *Product) Provider() (Provider, error) {
+	switch {
+	case p.URL != "":
+		return &listProvider{
+			name:       p.Name,
+			linuxURL:   p.URL,
+			windowsURL: p.WindowsURL,
+		}, nil
+	case p.Chart != "":
+		return &chartProvider{
+			name: p.Name,
+			path: p.Chart,
+		}, nil
+	}
+	provider, ok := getProvider(p.Name)
+	if !ok {
+		return nil, fmt.Errorf("no provider found for product %q, "+
+			"available providers: %v", p.Name, Providers())
+	}
+	return provider, nil
+}
+
+// SourceName returns the image source name of the product,
+// example: [longhorn(v1.5.3)]
+func (p *Product) SourceName() string {
+	return fmt.Sprintf("[%s(%s)]", strings.ToLower(p.Name), p.Version)
+}
+
+// GetImages returns the linux and windows images of the product.
+func (p *Product) GetImages(ctx context.Context) (linux, windows []string, err error) {
+	provider, err := p.Provider()
+	if err != nil {
+		return nil, nil, err
+	}
+	logrus.Infof("get %s %s images...", p.Name, p.Version)
+	return provider.GetImages(ctx, p.Version)
+}
+
+// listProvider gets the images from the plain text image list URL.
+type listProvider struct {
+	name       string
+	linuxURL   string
+	windowsURL string
+}
+
+func (p *listProvider) Name() string {
+	return p.name
+}
+
+func (p *listProvider) GetImages(
+	ctx context.Context, version string,
+) (linux, windows []string, err error) {
+	linux, err = getImageList(ctx, strings.ReplaceAll(p.linuxURL, VersionPlaceholder, version))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get %s %s image list: %w",
+			p.name, version, err)
+	}
+	if p.windowsURL == "" {
+		return linux, nil, nil
+	}
+	windows, err = getImageList(ctx, strings.ReplaceAll(p.windowsURL, VersionPlaceholder, version))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get %s %s windows image list: %w",
+			p.name, version, err)
+	}
+	return linux, windows, nil
+}
+
+// chartProvider gets the images from the values.yaml of the local chart.
+type chartProvider struct {
+	name string
+	path string
+}
+
+func (p *chartProvider) Name() string {
+	return p.name
+}
+
+func (p *chartProvider) GetImages(
+	_ context.Context, version string,
+) (linux, windows []string, err error) {
+	var values []map[any]any
+	if strings.HasSuffix(p.path, ".tgz") || strings.HasSuffix(p.path, ".tar.gz") {
+		values, err = chartimages.DecodeValuesInTgz(p.path)
+	} else {
+		values, err = chartimages.DecodeValuesInDir(p.path)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode %s %s chart values: %w",
+			p.name, version, err)
+	}
+	linuxSet := map[string]map[string]bool{}
+	windowsSet := map[string]map[string]bool{}
+	for _, v := range values {
+		chartimages.PickImagesFromValuesMap(linuxSet, v, p.name, chartimages.Linux)
+		chartimages.PickImagesFromValuesMap(windowsSet, v, p.name, chartimages.Windows)
+	}
+	return setToList(linuxSet), setToList(windowsSet), nil
+}
+
+func setToList(set map[string]map[string]bool) []string {
+	list := make([]string, 0, len(set))
+	for image := range set {
+		list = append(list, image)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func getImageList(ctx context.Context, url string) ([]string, error) {
+	logrus.Debugf("getImageList: %q", url)
+	client := http.Client{
+		Timeout: 30 * time.Second,
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get url %q: %v", url, resp.Status)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseImageList(b), nil
+}
+
+// parseImageList parses the plain text image list, the empty lines and
+// comments are ignored.
+func parseImageList(b []byte) []string {
+	list := []string{}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Split(bufio.ScanLines)
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		list = append(list, strings.TrimPrefix(l, "docker.io/"))
+	}
+	return list
+}
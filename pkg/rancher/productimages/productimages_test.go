@@ -0,0 +1,50 @@
+package productimages
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Parse(t *testing.T) {
+	p, err := Parse("longhorn=v1.5.3")
+	assert.Nil(t, err)
+	assert.Equal(t, "longhorn", p.Name)
+	assert.Equal(t, "v1.5.3", p.Version)
+	assert.Equal(t, "[longhorn(v1.5.3)]", p.SourceName())
+
+	_, err = Parse("longhorn")
+	assert.NotNil(t, err)
+	_, err = Parse("unknown=v1.0.0")
+	assert.NotNil(t, err)
+}
+
+func Test_listProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1.0.0/images.txt" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte("# comment\ndocker.io/example/a:v1.0.0\n\nexample/b:v1.0.0\n"))
+		}))
+	defer server.Close()
+
+	p := Product{
+		Name:    "example",
+		Version: "v1.0.0",
+		URL:     server.URL + "/{version}/images.txt",
+	}
+	assert.Nil(t, p.Validate())
+	linux, windows, err := p.GetImages(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"example/a:v1.0.0", "example/b:v1.0.0"}, linux)
+	assert.Nil(t, windows)
+
+	p.Version = "v2.0.0"
+	_, _, err = p.GetImages(context.TODO())
+	assert.NotNil(t, err)
+}
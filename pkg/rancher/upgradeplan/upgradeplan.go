@@ -0,0 +1,131 @@
+package upgradeplan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/cnrancher/hangar/pkg/destination"
+	"github.com/cnrancher/hangar/pkg/types"
+	u "github.com/cnrancher/hangar/pkg/utils"
+	imagetypes "github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Options is the options to compute the upgrade plan.
+type Options struct {
+	// CurrentImages are the images required by the current Rancher version.
+	CurrentImages []string
+	// TargetImages are the images required by the target Rancher version.
+	TargetImages []string
+	// Registry is the destination registry to query the existing images.
+	Registry string
+	// SystemContext is used to query the destination registry.
+	SystemContext *imagetypes.SystemContext
+	// Workers is the number of images to query in parallel.
+	Workers int
+}
+
+// Plan is the image delta for upgrading Rancher.
+type Plan struct {
+	// Required is the sorted union of the current and target images.
+	Required []string `json:"required"`
+	// Added are the images only required by the target version.
+	Added []string `json:"added"`
+	// Present are the required images already in the destination registry.
+	Present []string `json:"present"`
+	// Missing are the required images not in the destination registry,
+	// which need to be added for the upgrade.
+	Missing []string `json:"missing"`
+}
+
+// imageExists checks the image exists in the registry or not.
+var imageExists = func(
+	ctx context.Context, image, registry string, sysCtx *imagetypes.SystemContext,
+) (bool, error) {
+	dest, err := destination.NewDestination(&destination.Option{
+		Type:          types.TypeDocker,
+		Registry:      registry,
+		Project:       u.GetProjectName(image),
+		Name:          u.GetImageName(image),
+		Tag:           u.GetImageTag(image),
+		SystemContext: sysCtx,
+	})
+	if err != nil {
+		return false, err
+	}
+	if err := dest.Init(ctx); err != nil {
+		return false, err
+	}
+	return dest.Exists(), nil
+}
+
+// Compute queries the destination registry and computes the upgrade plan.
+func Compute(ctx context.Context, o *Options) (*Plan, error) {
+	if o.Registry == "" {
+		return nil, fmt.Errorf("Compute: registry is empty")
+	}
+	required := map[string]bool{}
+	current := map[string]bool{}
+	for _, image := range o.CurrentImages {
+		current[image] = true
+		required[image] = true
+	}
+	plan := &Plan{}
+	for _, image := range o.TargetImages {
+		if !current[image] && !required[image] {
+			plan.Added = append(plan.Added, image)
+		}
+		required[image] = true
+	}
+	for image := range required {
+		plan.Required = append(plan.Required, image)
+	}
+	sort.Strings(plan.Required)
+	sort.Strings(plan.Added)
+
+	var (
+		wg      = sync.WaitGroup{}
+		mu      = sync.Mutex{}
+		workers = make(chan struct{}, max(o.Workers, 1))
+		errs    []error
+	)
+	for _, image := range plan.Required {
+		if ctx.Err() != nil {
+			break
+		}
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(image string) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			exists, err := imageExists(ctx, image, o.Registry, o.SystemContext)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to query %q: %w", image, err))
+				return
+			}
+			if exists {
+				logrus.WithFields(logrus.Fields{"IMG": image}).
+					Debugf("image already exists in %q", o.Registry)
+				plan.Present = append(plan.Present, image)
+			} else {
+				plan.Missing = append(plan.Missing, image)
+			}
+		}(image)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("Compute: %w", err)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("Compute: %w", errs[0])
+	}
+	sort.Strings(plan.Present)
+	sort.Strings(plan.Missing)
+	return plan, nil
+}
@@ -0,0 +1,40 @@
+package upgradeplan
+
+import (
+	"context"
+	"testing"
+
+	imagetypes "github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Compute(t *testing.T) {
+	existing := map[string]bool{
+		"rancher/rancher:v2.7.9": true,
+		"rancher/shell:v0.1.21":  true,
+	}
+	imageExists = func(
+		_ context.Context, image, _ string, _ *imagetypes.SystemContext,
+	) (bool, error) {
+		return existing[image], nil
+	}
+
+	plan, err := Compute(context.TODO(), &Options{
+		CurrentImages: []string{"rancher/rancher:v2.7.9", "rancher/shell:v0.1.21"},
+		TargetImages:  []string{"rancher/rancher:v2.8.0", "rancher/shell:v0.1.21"},
+		Registry:      "registry.example.io",
+		Workers:       2,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"rancher/rancher:v2.7.9",
+		"rancher/rancher:v2.8.0",
+		"rancher/shell:v0.1.21",
+	}, plan.Required)
+	assert.Equal(t, []string{"rancher/rancher:v2.8.0"}, plan.Added)
+	assert.Equal(t, []string{"rancher/rancher:v2.8.0"}, plan.Missing)
+	assert.Equal(t, []string{"rancher/rancher:v2.7.9", "rancher/shell:v0.1.21"}, plan.Present)
+
+	_, err = Compute(context.TODO(), &Options{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,281 @@
+package workloadimages
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	u "github.com/cnrancher/hangar/pkg/utils"
+	"github.com/klauspost/pgzip"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	// OSLabel is the node selector label to specify the OS of the workload.
+	OSLabel = "kubernetes.io/os"
+	// SelectAnnotation is the example annotation to mark the resources
+	// to include in the image list.
+	SelectAnnotation = "hangar.cattle.io/mirror"
+)
+
+var (
+	// containerKeys are the keys of pod spec contains container list.
+	containerKeys = []string{"containers", "initContainers", "ephemeralContainers"}
+)
+
+// Workload gets the images of deployed workloads from the rancher-backup
+// tarball or kubernetes manifest files.
+type Workload struct {
+	// Path is the rancher-backup tarball (.tar.gz), manifest file
+	// (.yaml, .yml, .json) or a directory contains manifest files.
+	Path string
+	// Annotation selects the resources to include in format KEY[=VALUE],
+	// only the resources annotated with the KEY (and the VALUE if specified)
+	// are included if not empty.
+	Annotation string
+
+	// LinuxImageSet stores the linux images, map[image]map[source]true
+	LinuxImageSet map[string]map[string]bool
+	// WindowsImageSet stores the windows images, map[image]map[source]true
+	WindowsImageSet map[string]map[string]bool
+}
+
+// FetchImages walks the backup tarball or manifest files and records the
+// container images of the workloads.
+func (w *Workload) FetchImages(ctx context.Context) error {
+	if w.Path == "" {
+		return fmt.Errorf("FetchImages: path is empty")
+	}
+	if w.LinuxImageSet == nil {
+		w.LinuxImageSet = make(map[string]map[string]bool)
+	}
+	if w.WindowsImageSet == nil {
+		w.WindowsImageSet = make(map[string]map[string]bool)
+	}
+	info, err := os.Stat(w.Path)
+	if err != nil {
+		return fmt.Errorf("FetchImages: %w", err)
+	}
+	if info.IsDir() {
+		return w.fetchImagesFromDir(ctx)
+	}
+	if isTarball(w.Path) {
+		return w.fetchImagesFromTarball(ctx)
+	}
+	b, err := os.ReadFile(w.Path)
+	if err != nil {
+		return fmt.Errorf("FetchImages: %w", err)
+	}
+	return w.fetchImagesFromData(b, filepath.Base(w.Path))
+}
+
+func (w *Workload) fetchImagesFromDir(ctx context.Context) error {
+	return filepath.WalkDir(w.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() || !isManifest(p) {
+			return nil
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("fetchImagesFromDir: %w", err)
+		}
+		rel, _ := filepath.Rel(w.Path, p)
+		return w.fetchImagesFromData(b, rel)
+	})
+}
+
+func (w *Workload) fetchImagesFromTarball(ctx context.Context) error {
+	f, err := os.Open(w.Path)
+	if err != nil {
+		return fmt.Errorf("fetchImagesFromTarball: %w", err)
+	}
+	defer f.Close()
+
+	gzr, err := pgzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("fetchImagesFromTarball: %q is not a valid gzip file "+
+			"(encrypted backup is not supported): %w", w.Path, err)
+	}
+	defer gzr.Close()
+
+	tr := tar.NewReader(gzr)
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		header, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("fetchImagesFromTarball: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg || !isManifest(header.Name) {
+			continue
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("fetchImagesFromTarball: %w", err)
+		}
+		if err := w.fetchImagesFromData(b, header.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Workload) fetchImagesFromData(b []byte, name string) error {
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(b), 4096)
+	for {
+		var obj any
+		if err := decoder.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			// Ignore the file which is not a valid kubernetes resource.
+			logrus.Debugf("skip decode %q: %v", name, err)
+			return nil
+		}
+		for _, o := range resources(obj) {
+			if !w.selected(o) {
+				continue
+			}
+			w.walk(o, resourceName(o, name))
+		}
+	}
+	return nil
+}
+
+// resources returns the items of the List resource, or the object itself.
+func resources(obj any) []any {
+	m, ok := obj.(map[string]any)
+	if !ok {
+		return []any{obj}
+	}
+	kind, _ := m["kind"].(string)
+	items, ok := m["items"].([]any)
+	if !ok || !strings.HasSuffix(kind, "List") {
+		return []any{obj}
+	}
+	return items
+}
+
+// selected returns true if the resource matches the selection annotation.
+func (w *Workload) selected(obj any) bool {
+	if w.Annotation == "" {
+		return true
+	}
+	m, ok := obj.(map[string]any)
+	if !ok {
+		return false
+	}
+	metadata, _ := m["metadata"].(map[string]any)
+	annotations, _ := metadata["annotations"].(map[string]any)
+	key, value, hasValue := strings.Cut(w.Annotation, "=")
+	v, ok := annotations[strings.TrimSpace(key)]
+	if !ok {
+		return false
+	}
+	if !hasValue {
+		return true
+	}
+	s, _ := v.(string)
+	return s == strings.TrimSpace(value)
+}
+
+// walk finds the pod specs in the object recursively and records the images.
+func (w *Workload) walk(obj any, source string) {
+	switch v := obj.(type) {
+	case map[string]any:
+		if isPodSpec(v) {
+			w.addPodSpecImages(v, source)
+		}
+		for _, child := range v {
+			w.walk(child, source)
+		}
+	case []any:
+		for _, child := range v {
+			w.walk(child, source)
+		}
+	}
+}
+
+func (w *Workload) addPodSpecImages(spec map[string]any, source string) {
+	imageSet := w.LinuxImageSet
+	if selector, ok := spec["nodeSelector"].(map[string]any); ok {
+		if osType, _ := selector[OSLabel].(string); osType == "windows" {
+			imageSet = w.WindowsImageSet
+		}
+	}
+	for _, key := range containerKeys {
+		containers, ok := spec[key].([]any)
+		if !ok {
+			continue
+		}
+		for _, c := range containers {
+			container, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			image, ok := container["image"].(string)
+			if !ok || image == "" {
+				continue
+			}
+			u.AddSourceToImage(imageSet, strings.TrimSpace(image), source)
+		}
+	}
+}
+
+func isPodSpec(m map[string]any) bool {
+	containers, ok := m["containers"].([]any)
+	if !ok || len(containers) == 0 {
+		return false
+	}
+	_, ok = containers[0].(map[string]any)
+	return ok
+}
+
+// resourceName returns the source name of the resource, example:
+// workload(Deployment/cattle-system/rancher)
+func resourceName(obj any, fileName string) string {
+	m, ok := obj.(map[string]any)
+	if !ok {
+		return fmt.Sprintf("workload(%s)", fileName)
+	}
+	kind, _ := m["kind"].(string)
+	metadata, _ := m["metadata"].(map[string]any)
+	name, _ := metadata["name"].(string)
+	namespace, _ := metadata["namespace"].(string)
+	if kind == "" || name == "" {
+		return fmt.Sprintf("workload(%s)", fileName)
+	}
+	if namespace == "" {
+		return fmt.Sprintf("workload(%s/%s)", kind, name)
+	}
+	return fmt.Sprintf("workload(%s/%s/%s)", kind, namespace, name)
+}
+
+func isTarball(name string) bool {
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+func isManifest(name string) bool {
+	switch filepath.Ext(name) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
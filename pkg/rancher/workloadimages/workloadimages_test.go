@@ -0,0 +1,134 @@
+package workloadimages
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testManifest = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: rancher
+  namespace: cattle-system
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: rancher/shell:v0.1.22
+      containers:
+      - name: rancher
+        image: rancher/rancher:v2.8.0
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: windows-job
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          nodeSelector:
+            kubernetes.io/os: windows
+          containers:
+          - name: job
+            image: rancher/windows-job:v1.0.0
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  image: rancher/not-an-image:v1.0.0
+`
+
+func Test_fetchImagesFromData(t *testing.T) {
+	w := &Workload{
+		LinuxImageSet:   make(map[string]map[string]bool),
+		WindowsImageSet: make(map[string]map[string]bool),
+	}
+	err := w.fetchImagesFromData([]byte(testManifest), "test.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(w.LinuxImageSet))
+	assert.True(t, w.LinuxImageSet["rancher/rancher:v2.8.0"]["workload(Deployment/cattle-system/rancher)"])
+	assert.True(t, w.LinuxImageSet["rancher/shell:v0.1.22"]["workload(Deployment/cattle-system/rancher)"])
+	assert.Equal(t, 1, len(w.WindowsImageSet))
+	assert.True(t, w.WindowsImageSet["rancher/windows-job:v1.0.0"]["workload(CronJob/windows-job)"])
+}
+
+const testAnnotatedManifest = `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: selected
+    namespace: default
+    annotations:
+      hangar.cattle.io/mirror: "true"
+  spec:
+    template:
+      spec:
+        containers:
+        - name: app
+          image: example/selected:v1.0.0
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: disabled
+    namespace: default
+    annotations:
+      hangar.cattle.io/mirror: "false"
+  spec:
+    template:
+      spec:
+        containers:
+        - name: app
+          image: example/disabled:v1.0.0
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: unannotated
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: example/unannotated:v1.0.0
+`
+
+func Test_fetchImagesFromData_Annotation(t *testing.T) {
+	w := &Workload{
+		Annotation:      SelectAnnotation + "=true",
+		LinuxImageSet:   make(map[string]map[string]bool),
+		WindowsImageSet: make(map[string]map[string]bool),
+	}
+	err := w.fetchImagesFromData([]byte(testAnnotatedManifest), "test.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(w.LinuxImageSet))
+	assert.True(t, w.LinuxImageSet["example/selected:v1.0.0"]["workload(Deployment/default/selected)"])
+
+	w = &Workload{
+		Annotation:      SelectAnnotation,
+		LinuxImageSet:   make(map[string]map[string]bool),
+		WindowsImageSet: make(map[string]map[string]bool),
+	}
+	err = w.fetchImagesFromData([]byte(testAnnotatedManifest), "test.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(w.LinuxImageSet))
+	_, ok := w.LinuxImageSet["example/unannotated:v1.0.0"]
+	assert.False(t, ok)
+
+	w = &Workload{
+		LinuxImageSet:   make(map[string]map[string]bool),
+		WindowsImageSet: make(map[string]map[string]bool),
+	}
+	err = w.fetchImagesFromData([]byte(testAnnotatedManifest), "test.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(w.LinuxImageSet))
+}
@@ -0,0 +1,7 @@
+//go:build cgo
+
+package rundb
+
+// cgoEnabled is true if hangar is built with cgo, the SQLite driver
+// requires cgo.
+const cgoEnabled = true
@@ -0,0 +1,7 @@
+//go:build !cgo
+
+package rundb
+
+// cgoEnabled is false if hangar is built without cgo (CGO_ENABLED=0),
+// the SQLite driver is a stub failing at runtime.
+const cgoEnabled = false
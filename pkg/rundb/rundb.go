@@ -0,0 +1,237 @@
+// Package rundb exports the data of the finished hangar run into the
+// SQLite database for the ad-hoc SQL querying after the run.
+package rundb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cnrancher/hangar/pkg/hangar"
+
+	// Register the 'sqlite3' database driver.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrCgoRequired = errors.New(
+		"exporting into SQLite database requires hangar built with cgo enabled (CGO_ENABLED=1)")
+)
+
+const (
+	StatusSucceeded       = "succeeded"
+	StatusFailed          = "failed"
+	StatusSkippedOptional = "skipped-optional"
+)
+
+// schema is the normalized tables of the runs, the rows are keyed by the
+// run ID so the runs exported into the same database can be compared.
+const schema = `
+CREATE TABLE IF NOT EXISTS runs (
+	run_id      TEXT PRIMARY KEY,
+	command     TEXT NOT NULL,
+	result      TEXT NOT NULL,
+	start_time  TEXT NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	total       INTEGER NOT NULL,
+	succeeded   INTEGER NOT NULL,
+	failed      INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS images (
+	run_id TEXT NOT NULL,
+	image  TEXT NOT NULL,
+	status TEXT NOT NULL,
+	PRIMARY KEY (run_id, image)
+);
+CREATE TABLE IF NOT EXISTS platforms (
+	run_id     TEXT NOT NULL,
+	image      TEXT NOT NULL,
+	os         TEXT,
+	arch       TEXT,
+	variant    TEXT,
+	os_version TEXT,
+	media_type TEXT,
+	digest     TEXT NOT NULL,
+	config     TEXT
+);
+CREATE TABLE IF NOT EXISTS layers (
+	run_id          TEXT NOT NULL,
+	image           TEXT NOT NULL,
+	platform_digest TEXT NOT NULL,
+	position        INTEGER NOT NULL,
+	digest          TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS failures (
+	run_id TEXT NOT NULL,
+	image  TEXT NOT NULL,
+	reason TEXT
+);
+CREATE TABLE IF NOT EXISTS timings (
+	run_id      TEXT NOT NULL,
+	image       TEXT NOT NULL,
+	phase       TEXT NOT NULL,
+	duration_ms INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS layers_digest ON layers (digest);
+`
+
+// tables is the tables of the run rows deleted before re-exporting the run.
+var tables = []string{"runs", "images", "platforms", "layers", "failures", "timings"}
+
+// Check returns ErrCgoRequired if the SQLite driver is not available in
+// the hangar built without cgo, used for failing the export flag before
+// the job started.
+func Check() error {
+	if !cgoEnabled {
+		return ErrCgoRequired
+	}
+	return nil
+}
+
+// Export writes the summary of the run into the SQLite database, the
+// database is created if not exists and the rows of the same run ID are
+// replaced.
+func Export(name, command, result string, s *hangar.Summary) error {
+	if err := Check(); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", name)
+	if err != nil {
+		return fmt.Errorf("failed to open database %q: %w", name, err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(schema); err != nil {
+		return fmt.Errorf("failed to create tables of database %q: %w", name, err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := export(tx, command, result, s); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to export run into database %q: %w", name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func export(tx *sql.Tx, command, result string, s *hangar.Summary) error {
+	for _, t := range tables {
+		if _, err := tx.Exec("DELETE FROM "+t+" WHERE run_id = ?", s.RunID); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`INSERT INTO runs VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.RunID, command, result, s.StartTime.Format(time.RFC3339),
+		s.Duration.Milliseconds(), s.Total, s.Succeeded, s.Failed)
+	if err != nil {
+		return err
+	}
+
+	status := imageStatus(s)
+	images := make([]string, 0, len(status))
+	for image := range status {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	for _, image := range images {
+		_, err := tx.Exec(`INSERT INTO images VALUES (?, ?, ?)`,
+			s.RunID, image, status[image])
+		if err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(s.CopiedImages))
+	for name := range s.CopiedImages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, spec := range s.CopiedImages[name].Images {
+			_, err := tx.Exec(`INSERT INTO platforms VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				s.RunID, name, spec.OS, spec.Arch, spec.Variant, spec.OSVersion,
+				spec.MediaType, spec.Digest.String(), spec.Config.String())
+			if err != nil {
+				return err
+			}
+			for i, layer := range spec.Layers {
+				_, err := tx.Exec(`INSERT INTO layers VALUES (?, ?, ?, ?, ?)`,
+					s.RunID, name, spec.Digest.String(), i, layer.String())
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, image := range s.FailedImages {
+		_, err := tx.Exec(`INSERT INTO failures VALUES (?, ?, ?)`,
+			s.RunID, image, failureReason(image, s.Errors))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, t := range s.Timings {
+		_, err := tx.Exec(`INSERT INTO timings VALUES (?, ?, ?, ?)`,
+			s.RunID, t.Image, "total", t.Duration.Milliseconds())
+		if err != nil {
+			return err
+		}
+		phases := make([]string, 0, len(t.Phases))
+		for p := range t.Phases {
+			phases = append(phases, p)
+		}
+		sort.Strings(phases)
+		for _, p := range phases {
+			_, err := tx.Exec(`INSERT INTO timings VALUES (?, ?, ?, ?)`,
+				s.RunID, t.Image, p, t.Phases[p].Milliseconds())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// imageStatus returns the status of the images of the run,
+// map[image]status.
+func imageStatus(s *hangar.Summary) map[string]string {
+	status := make(map[string]string, len(s.Images))
+	for _, image := range s.Images {
+		status[image] = StatusSucceeded
+	}
+	for _, o := range s.SkippedOptional {
+		status[o.Image] = StatusSkippedOptional
+	}
+	for _, image := range s.FailedImages {
+		status[image] = StatusFailed
+	}
+	return status
+}
+
+// failureReason returns the first error message of the failed image,
+// the error messages quote the image name in square brackets.
+//
+//	Example:
+//		error occurred when copy [docker.io/library/nginx:latest] to [...]: ...
+func failureReason(image string, errs []string) string {
+	for _, e := range errs {
+		if strings.Contains(e, "["+image+"]") {
+			return e
+		}
+	}
+	for _, e := range errs {
+		if strings.Contains(e, image) {
+			return e
+		}
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package rundb
+
+import (
+	"testing"
+
+	"github.com/cnrancher/hangar/pkg/hangar"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_imageStatus(t *testing.T) {
+	s := &hangar.Summary{
+		Images:       []string{"nginx:1", "busybox:1", "alpine:1"},
+		FailedImages: []string{"busybox:1"},
+		SkippedOptional: []hangar.SkippedOptional{
+			{Image: "alpine:1", Reason: "not found"},
+		},
+	}
+	assert.Equal(t, map[string]string{
+		"nginx:1":   StatusSucceeded,
+		"busybox:1": StatusFailed,
+		"alpine:1":  StatusSkippedOptional,
+	}, imageStatus(s))
+}
+
+func Test_failureReason(t *testing.T) {
+	errs := []string{
+		"error occurred when copy [docker.io/library/nginx:1.2] to [x]: timeout",
+		"error occurred when copy [docker.io/library/nginx:1] to [x]: not found",
+		"failed to init docker.io/library/busybox:1: denied",
+	}
+	assert.Equal(t, errs[1], failureReason("docker.io/library/nginx:1", errs))
+	assert.Equal(t, errs[2], failureReason("docker.io/library/busybox:1", errs))
+	assert.Equal(t, "", failureReason("docker.io/library/alpine:1", errs))
+}
+
+func Test_Check(t *testing.T) {
+	if cgoEnabled {
+		assert.Nil(t, Check())
+	} else {
+		assert.ErrorIs(t, Check(), ErrCgoRequired)
+		assert.ErrorIs(t, Export("run.sqlite", "mirror", "succeeded", &hangar.Summary{}), ErrCgoRequired)
+	}
+}
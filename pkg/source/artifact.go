@@ -0,0 +1,211 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/cnrancher/hangar/pkg/destination"
+	"github.com/cnrancher/hangar/pkg/extension"
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/cnrancher/hangar/pkg/logger"
+	"github.com/cnrancher/hangar/pkg/manifest"
+	"github.com/cnrancher/hangar/pkg/types"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports/alltransports"
+	imagetypes "github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// signatureArtifactTypes is the artifact type prefixes of the signature
+// referrers, other referrers (in-toto attestations, SPDX and CycloneDX
+// SBOMs, etc.) are regarded as attestations.
+var signatureArtifactTypes = []string{
+	"application/vnd.dev.cosign.artifact.sig",
+	"application/vnd.dev.sigstore.bundle",
+	"application/vnd.cncf.notary.signature",
+}
+
+// IsSignatureArtifact returns true if the artifact type of the OCI
+// referrer is the signature.
+func IsSignatureArtifact(artifactType string) bool {
+	for _, t := range signatureArtifactTypes {
+		if strings.HasPrefix(artifactType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveArtifacts copies the signatures and attestations of the copied
+// images into the OCI directory destination, returns the artifacts saved.
+//
+// The artifacts are discovered by the cosign tag-based convention (.sig,
+// .att, .sbom tags) and the OCI referrers of the images, the referrers are
+// listed by the referrers API or the referrers tag schema (<alg>-<hex>)
+// if the referrers API is not supported by the source registry.
+func (s *Source) SaveArtifacts(
+	ctx context.Context,
+	dest *destination.Destination,
+	signatures bool,
+	attestations bool,
+	policy *signature.Policy,
+) ([]archive.Artifact, error) {
+	if s.imageType != types.TypeDocker || !signatures && !attestations {
+		return nil, nil
+	}
+	log := logger.FromContext(ctx)
+	suffixes := []string{}
+	if signatures {
+		suffixes = append(suffixes, ".sig")
+	}
+	if attestations {
+		suffixes = append(suffixes, ".att", ".sbom")
+	}
+	repository := path.Join(s.project, s.name)
+	client := extension.For(ctx, s.systemCtx, s.registry)
+
+	var (
+		artifacts []archive.Artifact
+		errs      []error
+		saved     = map[digest.Digest]bool{}
+	)
+	save := func(refName string, a *archive.Artifact) {
+		err := s.saveArtifact(ctx, dest, refName, a, policy)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to save artifact [%v]: %w", refName, err))
+			return
+		}
+		if saved[a.Digest] {
+			return
+		}
+		saved[a.Digest] = true
+		artifacts = append(artifacts, *a)
+		log.Debugf("saved artifact [%v] of %v", refName, a.Subject)
+	}
+	for _, subject := range s.artifactSubjects(ctx) {
+		for _, suffix := range suffixes {
+			tag := CosignTag(subject, suffix)
+			ok, err := s.tagExists(ctx, tag)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to inspect %q: %w", tag, err))
+				continue
+			}
+			if !ok {
+				continue
+			}
+			save(fmt.Sprintf("%s%s/%s:%s", s.imageType.Transport(), s.registry, repository, tag),
+				&archive.Artifact{
+					Subject: subject,
+					Tag:     tag,
+				})
+		}
+
+		referrers, err := client.Referrers(ctx, repository, subject)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list referrers of %v: %w", subject, err))
+			continue
+		}
+		for _, r := range referrers {
+			if IsSignatureArtifact(r.ArtifactType) && !signatures ||
+				!IsSignatureArtifact(r.ArtifactType) && !attestations {
+				continue
+			}
+			if saved[r.Digest] {
+				continue
+			}
+			save(fmt.Sprintf("%s%s/%s@%s", s.imageType.Transport(), s.registry, repository, r.Digest),
+				&archive.Artifact{
+					Subject:      subject,
+					ArtifactType: r.ArtifactType,
+				})
+		}
+	}
+	if len(errs) > 0 {
+		return artifacts, fmt.Errorf("error occurred when save artifacts of [%v]: %v",
+			s.referenceName, errs)
+	}
+	return artifacts, nil
+}
+
+// saveArtifact copies the artifact manifest into the OCI directory of its
+// digest without mutation, and records the manifest into the artifact.
+func (s *Source) saveArtifact(
+	ctx context.Context,
+	dest *destination.Destination,
+	refName string,
+	a *archive.Artifact,
+	policy *signature.Policy,
+) error {
+	inspector, err := manifest.NewInspector(ctx, &manifest.InspectorOption{
+		ReferenceName: refName,
+		SystemContext: s.systemCtx,
+	})
+	if err != nil {
+		return err
+	}
+	defer inspector.Close()
+	b, mime, err := inspector.Raw(ctx)
+	if err != nil {
+		return err
+	}
+	if mime != imgspecv1.MediaTypeImageManifest {
+		return fmt.Errorf("unsupported artifact MIME %q", mime)
+	}
+	m := &imgspecv1.Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	d, err := manifest.Digest(b, digest.Canonical)
+	if err != nil {
+		return err
+	}
+	sourceRef, err := alltransports.ParseImageName(refName)
+	if err != nil {
+		return err
+	}
+	destRef, err := dest.ReferenceMultiArch("", "", "", "", d.Encoded())
+	if err != nil {
+		return err
+	}
+	err = copyImage(
+		ctx, sourceRef, destRef, s.systemCtx, dest.SystemContext(),
+		policy, mime, nil, nil, s.contentStore, s.blobConcurrency,
+		s.memoryLimiter, true)
+	if err != nil {
+		return err
+	}
+
+	a.ImageSpec = archive.ImageSpec{
+		MediaType:   mime,
+		Digest:      d,
+		Annotations: m.Annotations,
+	}
+	a.Size = int64(len(b))
+	updateSpecImageManifest(&a.ImageSpec, m)
+	if a.ArtifactType == "" {
+		a.ArtifactType = m.ArtifactType
+	}
+	return nil
+}
+
+// CopyArtifact copies the artifact saved in the archive into the
+// destination reference without mutation to keep its digest.
+func (s *Source) CopyArtifact(
+	ctx context.Context,
+	destRef imagetypes.ImageReference,
+	destCtx *imagetypes.SystemContext,
+	policy *signature.Policy,
+) error {
+	sourceRef, err := alltransports.ParseImageName(s.referenceName)
+	if err != nil {
+		return err
+	}
+	return copyImage(
+		ctx, sourceRef, destRef, s.systemCtx, destCtx,
+		policy, s.mime, nil, nil, s.contentStore, s.blobConcurrency,
+		s.memoryLimiter, true)
+}
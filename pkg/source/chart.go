@@ -0,0 +1,63 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cnrancher/hangar/pkg/destination"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports/alltransports"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// HelmChartConfigMediaType is the config media type of the Helm chart
+// pushed into the OCI registry.
+const HelmChartConfigMediaType = "application/vnd.cncf.helm.config.v1+json"
+
+// IsHelmChart returns true if the source manifest is the Helm chart,
+// should be called after Init.
+func (s *Source) IsHelmChart() bool {
+	return s.mime == imgspecv1.MediaTypeImageManifest && s.ociManifest != nil &&
+		s.ociManifest.Config.MediaType == HelmChartConfigMediaType
+}
+
+// ChartSize returns the size of the config and layers of the Helm chart.
+func (s *Source) ChartSize() int64 {
+	if !s.IsHelmChart() {
+		return 0
+	}
+	size := s.ociManifest.Config.Size
+	for _, l := range s.ociManifest.Layers {
+		size += l.Size
+	}
+	return size
+}
+
+// CopyChart copies the Helm chart into the destination by the artifact
+// copy path, the chart manifest is copied without mutation to keep its
+// digest and is not filtered by the platforms.
+func (s *Source) CopyChart(
+	ctx context.Context,
+	dest *destination.Destination,
+	policy *signature.Policy,
+) error {
+	if !s.IsHelmChart() {
+		return fmt.Errorf("[%v] is not a Helm chart: unsupported MIME %q",
+			s.referenceName, s.mime)
+	}
+	if err := s.verifySigstore(ctx); err != nil {
+		return err
+	}
+	sourceRef, err := alltransports.ParseImageName(s.referenceName)
+	if err != nil {
+		return err
+	}
+	destRef, err := dest.Reference()
+	if err != nil {
+		return err
+	}
+	return copyImage(
+		ctx, sourceRef, destRef, s.systemCtx, dest.SystemContext(),
+		policy, s.mime, nil, nil, s.contentStore, s.blobConcurrency,
+		s.memoryLimiter, true)
+}
@@ -0,0 +1,74 @@
+package source
+
+import (
+	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/cnrancher/hangar/pkg/manifest"
+	imagemanifest "github.com/containers/image/v5/manifest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// deprecatedLayerMediaTypes is the deprecated layer media types, the
+// non-distributable (foreign) layers are deprecated by the OCI image
+// spec v1.1 and may be rejected by the registries.
+var deprecatedLayerMediaTypes = map[string]bool{
+	imagemanifest.DockerV2Schema2ForeignLayerMediaType:     true,
+	imagemanifest.DockerV2Schema2ForeignLayerMediaTypeGzip: true,
+	imgspecv1.MediaTypeImageLayerNonDistributable:          true,
+	imgspecv1.MediaTypeImageLayerNonDistributableGzip:      true,
+	imgspecv1.MediaTypeImageLayerNonDistributableZstd:      true,
+}
+
+// DeprecatedMediaType is the deprecated manifest media type (Docker
+// schema1) or layer media type found in the copied image.
+type DeprecatedMediaType struct {
+	// Platform is the platform of the image in 'os/arch[/variant]' format.
+	Platform string
+	// MediaType is the deprecated media type of the source image.
+	MediaType string
+	// ConvertedTo is the media type of the copied image, same as the
+	// MediaType if kept as-is.
+	ConvertedTo string
+}
+
+// checkDeprecated records the deprecated manifest media type and layer
+// media types of the copied image.
+func (s *Source) checkDeprecated(
+	spec *archive.ImageSpec, sourceMIME, destMIME string, layerMediaTypes []string,
+) {
+	platform := platformString(spec.OS, spec.Arch, spec.Variant)
+	if manifest.IsSchema1(sourceMIME) {
+		s.deprecated = append(s.deprecated, DeprecatedMediaType{
+			Platform:    platform,
+			MediaType:   sourceMIME,
+			ConvertedTo: destMIME,
+		})
+	}
+	seen := map[string]bool{}
+	for _, mt := range layerMediaTypes {
+		if !deprecatedLayerMediaTypes[mt] || seen[mt] {
+			continue
+		}
+		seen[mt] = true
+		s.deprecated = append(s.deprecated, DeprecatedMediaType{
+			Platform:    platform,
+			MediaType:   mt,
+			ConvertedTo: mt,
+		})
+	}
+}
+
+func schema2LayerMediaTypes(schema2 *imagemanifest.Schema2) []string {
+	mediaTypes := make([]string, 0, len(schema2.LayersDescriptors))
+	for _, layer := range schema2.LayersDescriptors {
+		mediaTypes = append(mediaTypes, layer.MediaType)
+	}
+	return mediaTypes
+}
+
+func ociLayerMediaTypes(ociManifest *imgspecv1.Manifest) []string {
+	mediaTypes := make([]string, 0, len(ociManifest.Layers))
+	for _, layer := range ociManifest.Layers {
+		mediaTypes = append(mediaTypes, layer.MediaType)
+	}
+	return mediaTypes
+}
@@ -3,6 +3,7 @@ package source
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -12,19 +13,221 @@ import (
 	"github.com/cnrancher/hangar/pkg/copy"
 	"github.com/cnrancher/hangar/pkg/destination"
 	"github.com/cnrancher/hangar/pkg/hangar/archive"
+	"github.com/cnrancher/hangar/pkg/logger"
 	"github.com/cnrancher/hangar/pkg/manifest"
+	"github.com/cnrancher/hangar/pkg/progress"
 	"github.com/cnrancher/hangar/pkg/types"
 	"github.com/cnrancher/hangar/pkg/utils"
 	"github.com/containers/common/pkg/retry"
 	imagecopy "github.com/containers/image/v5/copy"
+	dockerarchive "github.com/containers/image/v5/docker/archive"
 	imagemanifest "github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/transports/alltransports"
 	imagetypes "github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
 )
 
+// DefaultPlatformConcurrency is the default number of the platform images
+// of a single multi-arch image copied in parallel.
+const DefaultPlatformConcurrency = 2
+
+// platformTask is the platform image of the manifest list or the image
+// index to be copied.
+type platformTask struct {
+	osInfo     string
+	osVersion  string
+	osFeatures []string
+	arch       string
+	variant    string
+	dig        digest.Digest
+	mime       string
+	destRef    imagetypes.ImageReference
+
+	// manifest is the raw manifest of the copied destination image
+	manifest     []byte
+	manifestMIME string
+	err          error
+}
+
+func (s *Source) newPlatformTask(
+	dest *destination.Destination, osInfo, osVersion string, osFeatures []string,
+	arch, variant string, dig digest.Digest, mime string,
+) (*platformTask, error) {
+	destRef, err := dest.ReferenceMultiArch(
+		osInfo, osVersion, arch, variant, dig.Encoded())
+	if err != nil {
+		return nil, err
+	}
+	return &platformTask{
+		osInfo:     osInfo,
+		osVersion:  osVersion,
+		osFeatures: osFeatures,
+		arch:       arch,
+		variant:    variant,
+		dig:        dig,
+		mime:       mime,
+		destRef:    destRef,
+	}, nil
+}
+
+// copyPlatformTasks copies the platform images in parallel, the copy
+// errors are recorded in the tasks without canceling other copies.
+func (s *Source) copyPlatformTasks(
+	ctx context.Context,
+	dest *destination.Destination,
+	policy *signature.Policy,
+	tasks []*platformTask,
+) {
+	concurrency := s.platformConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultPlatformConcurrency
+	}
+	runPlatformTasks(tasks, concurrency, func(t *platformTask) ([]byte, string, error) {
+		return s.copyPlatformTask(ctx, dest, policy, t)
+	})
+}
+
+// runPlatformTasks runs the copy function of the tasks with the limited
+// concurrency, the copied manifest and the error are recorded in each task.
+func runPlatformTasks(
+	tasks []*platformTask,
+	concurrency int,
+	copyFunc func(t *platformTask) ([]byte, string, error),
+) {
+	g := errgroup.Group{}
+	g.SetLimit(concurrency)
+	for _, t := range tasks {
+		t := t
+		g.Go(func() error {
+			t.manifest, t.manifestMIME, t.err = copyFunc(t)
+			return nil
+		})
+	}
+	_ = g.Wait()
+}
+
+// recordPlatformTasks records the copied platform images in the order of
+// the tasks, returns the number of the images copied and the errors of the
+// failed tasks.
+func (s *Source) recordPlatformTasks(
+	dest *destination.Destination, tasks []*platformTask,
+) (int, []error) {
+	var (
+		copiedNum int
+		errs      []error
+	)
+	for _, t := range tasks {
+		if t.err != nil {
+			errs = append(errs, t.err)
+			continue
+		}
+		if err := s.recordPlatformTask(dest, t); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		copiedNum++
+	}
+	return copiedNum, errs
+}
+
+func (s *Source) copyPlatformTask(
+	ctx context.Context,
+	dest *destination.Destination,
+	policy *signature.Policy,
+	t *platformTask,
+) ([]byte, string, error) {
+	sourceRef, err := alltransports.ParseImageName(fmt.Sprintf(
+		"%s%s/%s/%s@%s",
+		s.imageType.Transport(), s.registry, s.project, s.name, t.dig))
+	if err != nil {
+		return nil, "", err
+	}
+	err = s.copyPlatformImage(
+		ctx, sourceRef, t.destRef, dest.SystemContext(), policy, t.mime)
+	if err != nil {
+		return nil, "", err
+	}
+
+	inspector, err := manifest.NewInspector(ctx, &manifest.InspectorOption{
+		Reference:     t.destRef,
+		SystemContext: dest.SystemContext(),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("newInspector failed: %w", err)
+	}
+	defer inspector.Close()
+
+	b, imageMIME, err := inspector.Raw(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("inspector.Raw failed: %w", err)
+	}
+	return b, imageMIME, nil
+}
+
+// recordPlatformTask records the copied platform image, the tasks are
+// recorded in the order of the manifest list after copied in parallel.
+func (s *Source) recordPlatformTask(
+	dest *destination.Destination, t *platformTask,
+) error {
+	manifestDigest, err := manifest.Digest(t.manifest, t.dig.Algorithm())
+	if err != nil {
+		return fmt.Errorf("failed to get digest: %w", err)
+	}
+	drifted := false
+	if s.rewritten() {
+		s.mutatedDigests[t.dig] = manifestDigest
+		if err := renameCopiedDir(dest, t.dig, manifestDigest); err != nil {
+			return err
+		}
+	} else if !manifest.IsSchema1(t.mime) {
+		drifted = s.recordDrift(t.dig, manifestDigest)
+	}
+	spec := archive.ImageSpec{
+		Arch:       t.arch,
+		OS:         t.osInfo,
+		OSVersion:  t.osVersion,
+		OSFeatures: t.osFeatures,
+		Variant:    t.variant,
+		MediaType:  t.mime,
+		Layers:     nil,
+		Config:     "",
+		Digest:     manifestDigest,
+	}
+	if drifted {
+		spec.SourceDigest = t.dig
+	}
+	switch t.manifestMIME {
+	case imagemanifest.DockerV2Schema2MediaType:
+		schema2, err := imagemanifest.Schema2FromManifest(t.manifest)
+		if err != nil {
+			return err
+		}
+		updateSpecDockerV2Schema2(&spec, schema2)
+		s.checkDeprecated(&spec, t.mime, t.manifestMIME, schema2LayerMediaTypes(schema2))
+	// case imagemanifest.DockerV2Schema1MediaType,
+	// 	imagemanifest.DockerV2Schema1SignedMediaType:
+	// 	schema1, err := imagemanifest.Schema1FromManifest(t.manifest)
+	// 	if err != nil {
+	// 		return err
+	// 	}
+	// 	updateSpecDockerV2Schema1(&spec, schema1)
+	case imgspecv1.MediaTypeImageManifest:
+		ociManifest := new(imgspecv1.Manifest)
+		if err = json.Unmarshal(t.manifest, ociManifest); err != nil {
+			return err
+		}
+		updateSpecImageManifest(&spec, ociManifest)
+		s.checkDeprecated(&spec, t.mime, t.manifestMIME, ociLayerMediaTypes(ociManifest))
+	default:
+		return fmt.Errorf("copied image mime unknow: %v", t.manifestMIME)
+	}
+	return s.recordCopiedImage(spec)
+}
+
 func (s *Source) copyDockerV2ListMediaType(
 	ctx context.Context,
 	dest *destination.Destination,
@@ -33,14 +236,11 @@ func (s *Source) copyDockerV2ListMediaType(
 ) (int, error) {
 	var copiedNum int
 	var errs []error
+	var tasks []*platformTask
 	for _, m := range s.schema2List.Manifests {
 		arch := m.Platform.Architecture
 		osInfo := m.Platform.OS
-		osVersion := m.Platform.OSVersion
-		osFeatures := m.Platform.OSFeatures
 		variant := m.Platform.Variant
-		dig := m.Digest
-		mime := m.MediaType
 
 		// skip image
 		if len(sets["os"]) != 0 && osInfo != "" && !sets["os"][osInfo] {
@@ -53,99 +253,31 @@ func (s *Source) copyDockerV2ListMediaType(
 			continue
 		}
 		if dest.HaveDigest(m.Digest) {
-			logrus.Debugf("dest already have digest %v, skip copy", m.Digest)
+			logger.FromContext(ctx).Debugf("dest already have digest %v, skip copy", m.Digest)
 			copiedNum++
 			continue
 		}
-
-		sourceRef, err := alltransports.ParseImageName(fmt.Sprintf(
-			"%s%s/%s/%s@%s",
-			s.imageType.Transport(), s.registry, s.project, s.name, dig))
-		if err != nil {
-			errs = append(errs, err)
-			continue
-		}
-		destRef, err := dest.ReferenceMultiArch(
-			osInfo, osVersion, arch, variant, dig.Encoded())
-		if err != nil {
-			errs = append(errs, err)
-			continue
-		}
-
-		err = copyImage(
-			ctx, sourceRef, destRef, s.systemCtx, dest.SystemContext(),
-			policy, mime)
-		if err != nil {
-			errs = append(errs, err)
-			continue
-		}
-
-		inspector, err := manifest.NewInspector(ctx, &manifest.InspectorOption{
-			Reference:     destRef,
-			SystemContext: dest.SystemContext(),
-		})
-		if err != nil {
-			errs = append(errs, fmt.Errorf("newInspector failed: %w", err))
+		if s.missingPlatformsOnly && dest.HavePlatform(osInfo, arch, variant) {
+			logger.FromContext(ctx).Debugf("dest already have platform %v, skip copy",
+				platformString(osInfo, arch, variant))
+			copiedNum++
 			continue
 		}
-		defer inspector.Close()
 
-		b, imageMIME, err := inspector.Raw(ctx)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("inspector.Raw failed: %w", err))
-			continue
-		}
-		manifestDigest, err := imagemanifest.Digest(b)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to get digest: %w", err))
-			continue
-		}
-		spec := archive.ImageSpec{
-			Arch:       arch,
-			OS:         osInfo,
-			OSVersion:  osVersion,
-			OSFeatures: osFeatures,
-			Variant:    variant,
-			MediaType:  mime,
-			Layers:     nil,
-			Config:     "",
-			Digest:     manifestDigest,
-		}
-		switch imageMIME {
-		case imagemanifest.DockerV2Schema2MediaType:
-			schema2, err := imagemanifest.Schema2FromManifest(b)
-			if err != nil {
-				errs = append(errs, err)
-				continue
-			}
-			updateSpecDockerV2Schema2(&spec, schema2)
-		// case imagemanifest.DockerV2Schema1MediaType,
-		// 	imagemanifest.DockerV2Schema1SignedMediaType:
-		// 	schema1, err := imagemanifest.Schema1FromManifest(b)
-		// 	if err != nil {
-		// 		errs = append(errs, err)
-		// 		continue
-		// 	}
-		// 	updateSpecDockerV2Schema1(&spec, schema1)
-		case imgspecv1.MediaTypeImageManifest:
-			ociManifest := new(imgspecv1.Manifest)
-			if err = json.Unmarshal(b, ociManifest); err != nil {
-				errs = append(errs, err)
-				continue
-			}
-			updateSpecImageManifest(&spec, ociManifest)
-		default:
-			errs = append(errs, fmt.Errorf("copied image mime unknow: %v", imageMIME))
-			continue
-		}
-		err = s.recordCopiedImage(spec)
+		t, err := s.newPlatformTask(dest, osInfo, m.Platform.OSVersion,
+			m.Platform.OSFeatures, arch, variant, m.Digest, m.MediaType)
 		if err != nil {
 			errs = append(errs, err)
 			continue
 		}
-		copiedNum++
+		tasks = append(tasks, t)
 	}
 
+	s.copyPlatformTasks(ctx, dest, policy, tasks)
+	n, taskErrs := s.recordPlatformTasks(dest, tasks)
+	copiedNum += n
+	errs = append(errs, taskErrs...)
+
 	if len(errs) > 0 {
 		return copiedNum, fmt.Errorf(
 			"error occurred when copy image [%v] => [%v]: %v",
@@ -163,12 +295,17 @@ func (s *Source) copyMediaTypeImageIndex(
 ) (int, error) {
 	var copiedNum int
 	var errs []error
+	var tasks []*platformTask
+	var attestations []imgspecv1.Descriptor
+	// selected is the digests of the images matched the platform filter.
+	selected := map[digest.Digest]bool{}
 	for _, m := range s.ociIndex.Manifests {
-		mime := m.MediaType
+		if manifest.IsAttestation(m.Annotations) {
+			attestations = append(attestations, m)
+			continue
+		}
 		arch := m.Platform.Architecture
 		osInfo := m.Platform.OS
-		osVersion := m.Platform.OSVersion
-		osFeatures := m.Platform.OSFeatures
 		variant := m.Platform.Variant
 		dig := m.Digest
 
@@ -182,34 +319,110 @@ func (s *Source) copyMediaTypeImageIndex(
 		if len(sets["variant"]) != 0 && variant != "" && !sets["variant"][variant] {
 			continue
 		}
+		selected[dig] = true
 		if dest.HaveDigest(m.Digest) {
-			logrus.Debugf("dest already have digest %v, skip copy", m.Digest)
+			logger.FromContext(ctx).Debugf("dest already have digest %v, skip copy", m.Digest)
+			copiedNum++
+			continue
+		}
+		if s.missingPlatformsOnly && dest.HavePlatform(osInfo, arch, variant) {
+			logger.FromContext(ctx).Debugf("dest already have platform %v, skip copy",
+				platformString(osInfo, arch, variant))
 			copiedNum++
 			continue
 		}
 
+		t, err := s.newPlatformTask(dest, osInfo, m.Platform.OSVersion,
+			m.Platform.OSFeatures, arch, variant, dig, m.MediaType)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+
+	s.copyPlatformTasks(ctx, dest, policy, tasks)
+	n, taskErrs := s.recordPlatformTasks(dest, tasks)
+	copiedNum += n
+	errs = append(errs, taskErrs...)
+	errs = append(errs, s.copyAttestations(ctx, dest, attestations, selected, policy)...)
+	if len(errs) > 0 {
+		b := strings.Builder{}
+		for _, e := range errs {
+			b.WriteString(fmt.Sprintf("%v\n", e))
+		}
+		return copiedNum, fmt.Errorf(
+			"error occurred when copy image [%v] => [%v]: \n%s",
+			s.referenceName, dest.ReferenceName(), b.String(),
+		)
+	}
+	return copiedNum, nil
+}
+
+// copyAttestations copies the attestation manifests of the selected images
+// if enabled, the subject digest annotations are kept in the copied image
+// specs to rebuild the destination index.
+func (s *Source) copyAttestations(
+	ctx context.Context,
+	dest *destination.Destination,
+	attestations []imgspecv1.Descriptor,
+	selected map[digest.Digest]bool,
+	policy *signature.Policy,
+) []error {
+	var errs []error
+	for _, m := range attestations {
+		subject := digest.Digest(m.Annotations[manifest.AnnotationReferenceDigest])
+		if !selected[subject] {
+			continue
+		}
+		if !s.includeAttestations {
+			s.excludedAttestations++
+			continue
+		}
+		if dest.HaveDigest(m.Digest) {
+			logger.FromContext(ctx).Debugf("dest already have attestation %v, skip copy", m.Digest)
+			continue
+		}
 		sourceRef, err := alltransports.ParseImageName(fmt.Sprintf(
 			"%s%s/%s/%s@%s",
-			s.imageType.Transport(), s.registry, s.project, s.name, dig))
+			s.imageType.Transport(), s.registry, s.project, s.name, m.Digest))
 		if err != nil {
 			errs = append(errs, err)
 			continue
 		}
-		destRef, err := dest.ReferenceMultiArch(
-			osInfo, osVersion, arch, variant, dig.Encoded())
+		destRef, err := dest.ReferenceAttestation(subject, m.Digest.Encoded())
 		if err != nil {
 			errs = append(errs, err)
 			continue
 		}
-
+		// The attestation manifest is copied without mutation and
+		// re-compression to keep its digest.
 		err = copyImage(
 			ctx, sourceRef, destRef, s.systemCtx, dest.SystemContext(),
-			policy, mime)
+			policy, m.MediaType, nil, nil, s.contentStore, s.blobConcurrency,
+			s.memoryLimiter, true)
 		if err != nil {
-			errs = append(errs, err)
+			errs = append(errs, fmt.Errorf("failed to copy attestation %v: %w", m.Digest, err))
 			continue
 		}
 
+		annotations := make(map[string]string, len(m.Annotations))
+		for k, v := range m.Annotations {
+			annotations[k] = v
+		}
+		if d, ok := s.mutatedDigests[subject]; ok {
+			// The subject image was mutated during copy.
+			annotations[manifest.AnnotationReferenceDigest] = d.String()
+		}
+		spec := archive.ImageSpec{
+			MediaType:   m.MediaType,
+			Digest:      m.Digest,
+			Annotations: annotations,
+		}
+		if m.Platform != nil {
+			spec.Arch = m.Platform.Architecture
+			spec.OS = m.Platform.OS
+		}
 		inspector, err := manifest.NewInspector(ctx, &manifest.InspectorOption{
 			Reference:     destRef,
 			SystemContext: dest.SystemContext(),
@@ -218,74 +431,25 @@ func (s *Source) copyMediaTypeImageIndex(
 			errs = append(errs, fmt.Errorf("newInspector failed: %w", err))
 			continue
 		}
-		defer inspector.Close()
-
-		b, imageMIME, err := inspector.Raw(ctx)
+		b, _, err := inspector.Raw(ctx)
+		inspector.Close()
 		if err != nil {
 			errs = append(errs, fmt.Errorf("inspector.Raw failed: %w", err))
 			continue
 		}
-		manifestDigest, err := imagemanifest.Digest(b)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("imagemanifest.Digest failed: %w", err))
-			continue
-		}
-		spec := archive.ImageSpec{
-			Arch:       arch,
-			OS:         osInfo,
-			OSVersion:  osVersion,
-			OSFeatures: osFeatures,
-			Variant:    variant,
-			MediaType:  mime,
-			Layers:     nil,
-			Config:     "",
-			Digest:     manifestDigest,
-		}
-		switch imageMIME {
-		case imagemanifest.DockerV2Schema2MediaType:
-			schema2, err := imagemanifest.Schema2FromManifest(b)
-			if err != nil {
-				errs = append(errs, err)
-				continue
-			}
-			updateSpecDockerV2Schema2(&spec, schema2)
-		// case imagemanifest.DockerV2Schema1MediaType,
-		// 	imagemanifest.DockerV2Schema1SignedMediaType:
-		// 	schema1, err := imagemanifest.Schema1FromManifest(b)
-		// 	if err != nil {
-		// 		errs = append(errs, err)
-		// 		continue
-		// 	}
-		// 	updateSpecDockerV2Schema1(&spec, schema1)
-		case imgspecv1.MediaTypeImageManifest:
-			ociManifest := new(imgspecv1.Manifest)
-			if err = json.Unmarshal(b, ociManifest); err != nil {
-				errs = append(errs, err)
-				continue
-			}
-			updateSpecImageManifest(&spec, ociManifest)
-		default:
-			errs = append(errs, fmt.Errorf("copied image mime unknow: %v", imageMIME))
+		ociManifest := new(imgspecv1.Manifest)
+		if err = json.Unmarshal(b, ociManifest); err != nil {
+			errs = append(errs, err)
 			continue
 		}
-		err = s.recordCopiedImage(spec)
-		if err != nil {
+		updateSpecImageManifest(&spec, ociManifest)
+		if err = s.recordCopiedImage(spec); err != nil {
 			errs = append(errs, err)
 			continue
 		}
-		copiedNum++
+		logger.FromContext(ctx).Debugf("copied attestation %v of %v", m.Digest, subject)
 	}
-	if len(errs) > 0 {
-		b := strings.Builder{}
-		for _, e := range errs {
-			b.WriteString(fmt.Sprintf("%v\n", e))
-		}
-		return copiedNum, fmt.Errorf(
-			"error occurred when copy image [%v] => [%v]: \n%s",
-			s.referenceName, dest.ReferenceName(), b.String(),
-		)
-	}
-	return copiedNum, nil
+	return errs
 }
 
 func (s *Source) copyDockerV2Schema2MediaType(
@@ -311,7 +475,7 @@ func (s *Source) copyDockerV2Schema2MediaType(
 		return nil
 	}
 	if dest.HaveDigest(s.manifestDigest) {
-		logrus.Debugf("dest already have digest %v, skip copy", s.manifestDigest)
+		logger.FromContext(ctx).Debugf("dest already have digest %v, skip copy", s.manifestDigest)
 		return nil
 	}
 
@@ -324,9 +488,8 @@ func (s *Source) copyDockerV2Schema2MediaType(
 	if err != nil {
 		return err
 	}
-	err = copyImage(
-		ctx, sourceRef, destRef, s.systemCtx, dest.SystemContext(),
-		policy, s.mime)
+	err = s.copyPlatformImage(
+		ctx, sourceRef, destRef, dest.SystemContext(), policy, s.mime)
 	if err != nil {
 		return err
 	}
@@ -341,7 +504,16 @@ func (s *Source) copyDockerV2Schema2MediaType(
 		Config:     s.schema2.ConfigDescriptor.Digest,
 		Digest:     s.manifestDigest,
 	}
+	if s.rewritten() || dest.Type() == types.TypeDocker {
+		// Re-inspect the destination image to detect the mutated digest
+		// or the manifest rewritten by the registry.
+		if err := s.inspectCopiedSpec(ctx, destRef, dest, &spec); err != nil {
+			return err
+		}
+		return s.recordCopiedImage(spec)
+	}
 	updateSpecDockerV2Schema2(&spec, s.schema2)
+	s.checkDeprecated(&spec, s.mime, s.mime, schema2LayerMediaTypes(s.schema2))
 	return s.recordCopiedImage(spec)
 }
 
@@ -382,9 +554,8 @@ func (s *Source) copyDockerV2Schema1MediaType(
 	if err != nil {
 		return err
 	}
-	err = copyImage(
-		ctx, sourceRef, destRef, s.systemCtx, dest.SystemContext(),
-		policy, s.mime)
+	err = s.copyPlatformImage(
+		ctx, sourceRef, destRef, dest.SystemContext(), policy, s.mime)
 	if err != nil {
 		return err
 	}
@@ -423,6 +594,7 @@ func (s *Source) copyDockerV2Schema1MediaType(
 		Digest:    manifestDigest,
 	}
 	updateSpecDockerV2Schema2(&spec, schema2)
+	s.checkDeprecated(&spec, s.mime, mime, schema2LayerMediaTypes(schema2))
 	if dest.Type() == types.TypeOci {
 		o := path.Join(dest.Directory(), "UNKNOW")
 		n := path.Join(dest.Directory(), manifestDigest.Encoded())
@@ -467,9 +639,8 @@ func (s *Source) copyMediaTypeImageManifest(
 	if err != nil {
 		return err
 	}
-	err = copyImage(
-		ctx, sourceRef, destRef, s.systemCtx, dest.SystemContext(),
-		policy, s.mime)
+	err = s.copyPlatformImage(
+		ctx, sourceRef, destRef, dest.SystemContext(), policy, s.mime)
 	if err != nil {
 		return err
 	}
@@ -484,12 +655,92 @@ func (s *Source) copyMediaTypeImageManifest(
 		Config:     s.ociManifest.Config.Digest,
 		Digest:     s.manifestDigest,
 	}
+	if s.rewritten() || dest.Type() == types.TypeDocker {
+		// Re-inspect the destination image to detect the mutated digest
+		// or the manifest rewritten by the registry.
+		if err := s.inspectCopiedSpec(ctx, destRef, dest, &spec); err != nil {
+			return err
+		}
+		return s.recordCopiedImage(spec)
+	}
 	updateSpecImageManifest(&spec, s.ociManifest)
+	s.checkDeprecated(&spec, s.mime, s.mime, ociLayerMediaTypes(s.ociManifest))
 	return s.recordCopiedImage(spec)
 }
 
+// inspectCopiedSpec re-inspects the copied destination image to update
+// the digest, config and layers of the spec since the image may be
+// mutated during copy, or rewritten by the destination registry on push.
+func (s *Source) inspectCopiedSpec(
+	ctx context.Context,
+	destRef imagetypes.ImageReference,
+	dest *destination.Destination,
+	spec *archive.ImageSpec,
+) error {
+	inspector, err := manifest.NewInspector(ctx, &manifest.InspectorOption{
+		Reference:     destRef,
+		SystemContext: dest.SystemContext(),
+	})
+	if err != nil {
+		return fmt.Errorf("newInspector failed: %w", err)
+	}
+	defer inspector.Close()
+
+	b, mime, err := inspector.Raw(ctx)
+	if err != nil {
+		return fmt.Errorf("inspector.Raw failed: %w", err)
+	}
+	manifestDigest, err := manifest.Digest(b, spec.Digest.Algorithm())
+	if err != nil {
+		return fmt.Errorf("failed to get digest: %w", err)
+	}
+	switch mime {
+	case imagemanifest.DockerV2Schema2MediaType:
+		schema2, err := imagemanifest.Schema2FromManifest(b)
+		if err != nil {
+			return err
+		}
+		updateSpecDockerV2Schema2(spec, schema2)
+		s.checkDeprecated(spec, spec.MediaType, mime, schema2LayerMediaTypes(schema2))
+	case imgspecv1.MediaTypeImageManifest:
+		ociManifest := new(imgspecv1.Manifest)
+		if err := json.Unmarshal(b, ociManifest); err != nil {
+			return err
+		}
+		updateSpecImageManifest(spec, ociManifest)
+		s.checkDeprecated(spec, spec.MediaType, mime, ociLayerMediaTypes(ociManifest))
+	default:
+		return fmt.Errorf("copied image mime unknow: %v", mime)
+	}
+	if s.rewritten() {
+		s.mutatedDigests[spec.Digest] = manifestDigest
+		if err := renameCopiedDir(dest, spec.Digest, manifestDigest); err != nil {
+			return err
+		}
+	} else if s.recordDrift(spec.Digest, manifestDigest) {
+		spec.SourceDigest = spec.Digest
+	}
+	spec.Digest = manifestDigest
+	spec.MediaType = mime
+	return nil
+}
+
+// recordDrift records the source manifest digest rewritten by the
+// destination registry, returns true if the digest got after the copy is
+// different from the source digest.
+func (s *Source) recordDrift(src, got digest.Digest) bool {
+	if got == src {
+		return false
+	}
+	s.driftedDigests[src] = got
+	return true
+}
+
 func (s *Source) recordCopiedImage(image archive.ImageSpec) error {
 	s.copiedList = append(s.copiedList, image)
+	if manifest.IsAttestation(image.Annotations) {
+		return nil
+	}
 	s.copiedArch[image.Arch] = true
 	s.copiedOS[image.OS] = true
 	return nil
@@ -516,6 +767,53 @@ func (s *Source) GetCopiedImage() *archive.Image {
 	return list
 }
 
+// copyPlatformImage copies the platform image with the config mutation
+// and the layer re-compression of the source, the image is copied again
+// with the digest preservation disabled if the manifest is rejected by the
+// destination registry and the digest change on conflict is allowed, the
+// changed digest is recorded as the digest drift after the copy.
+func (s *Source) copyPlatformImage(
+	ctx context.Context,
+	sourceRef imagetypes.ImageReference,
+	destRef imagetypes.ImageReference,
+	destCtx *imagetypes.SystemContext,
+	policy *signature.Policy,
+	sourceMIME string,
+) error {
+	err := copyImage(
+		ctx, sourceRef, destRef, s.systemCtx, destCtx,
+		policy, sourceMIME, s.mutation, s.compression, s.contentStore,
+		s.blobConcurrency, s.memoryLimiter, true)
+	if err == nil || !s.allowDigestChange || !isDigestConflict(err) {
+		return err
+	}
+	logger.FromContext(ctx).Warnf("Failed to copy [%v] with digest preserved: %v",
+		sourceRef.StringWithinTransport(), err)
+	logger.FromContext(ctx).Warnf("Retry copying [%v] with digest change allowed",
+		sourceRef.StringWithinTransport())
+	return copyImage(
+		ctx, sourceRef, destRef, s.systemCtx, destCtx,
+		policy, sourceMIME, s.mutation, s.compression, s.contentStore,
+		s.blobConcurrency, s.memoryLimiter, false)
+}
+
+// isDigestConflict checks whether the copy error is caused by the digest
+// preservation: the manifest type rejected by the destination registry, or
+// the layer compression incompatible with the manifest type, which both
+// require the manifest conversion that changes the digest.
+// Other push failures (e.g. the manifest rejected by the policy) are not
+// retried.
+func isDigestConflict(err error) bool {
+	var (
+		rejected     imagetypes.ManifestTypeRejectedError
+		incompatible imagemanifest.ManifestLayerCompressionIncompatibilityError
+	)
+	return errors.As(err, &rejected) || errors.As(err, &incompatible)
+}
+
+// copyImage copies the image by containers/image, the source blobs are
+// fetched by the shared registry client to reuse the TLS connections and
+// the tokens across the workers.
 func copyImage(
 	ctx context.Context,
 	sourceRef imagetypes.ImageReference,
@@ -524,16 +822,35 @@ func copyImage(
 	destCtx *imagetypes.SystemContext,
 	policy *signature.Policy,
 	sourceMIME string,
+	mutation *copy.ConfigMutation,
+	compressionFormat *compression.Algorithm,
+	store *copy.ContentStore,
+	blobConcurrency int,
+	limiter *copy.MemoryLimiter,
+	preserveDigests bool,
 ) error {
 	copyOpts := &imagecopy.Options{
 		// TODO: Add sign here if needed.
-		ReportWriter:         nil,
-		SourceCtx:            utils.CopySystemContext(sourceCtx),
-		DestinationCtx:       utils.CopySystemContext(destCtx),
-		ProgressInterval:     time.Second,
-		PreserveDigests:      true,
-		MaxParallelDownloads: 3,
+		ReportWriter:     nil,
+		SourceCtx:        utils.CopySystemContext(sourceCtx),
+		DestinationCtx:   utils.CopySystemContext(destCtx),
+		ProgressInterval: time.Second,
+		PreserveDigests:  preserveDigests,
+	}
+	if sourceRef.Transport().Name() == dockerarchive.Transport.Name() {
+		// The uncompressed layers of the tarball created by 'docker save'
+		// are compressed, and the manifest may be converted during copy.
+		copyOpts.PreserveDigests = false
+	}
+	if blobConcurrency <= 0 {
+		blobConcurrency = copy.DefaultBlobConcurrency
 	}
+	// Fetch the blobs by the shared registry client.
+	sourceRef = copy.NewSharedReference(sourceRef, sourceCtx)
+	// Read the blobs from the local content store if available.
+	sourceRef = copy.NewCachedReference(sourceRef, store)
+	// Serialize the very large blobs if the memory limited.
+	sourceRef = copy.NewLimitedReference(sourceRef, limiter)
 	switch sourceMIME {
 	case imagemanifest.DockerV2Schema1MediaType,
 		imagemanifest.DockerV2Schema1SignedMediaType:
@@ -541,8 +858,30 @@ func copyImage(
 		copyOpts.PreserveDigests = false
 		// Convert image mediaType to DockerV2Schema2
 		copyOpts.ForceManifestMIMEType = imagemanifest.DockerV2Schema2MediaType
+		if !mutation.Empty() {
+			logger.FromContext(ctx).Warnf("Skip mutating config of schema1 image [%v]",
+				sourceRef.StringWithinTransport())
+		}
+	default:
+		if !mutation.Empty() {
+			// The config & manifest digest will be changed after mutation.
+			sourceRef = copy.NewMutatedReference(sourceRef, mutation)
+			copyOpts.PreserveDigests = false
+		}
+	}
+	if compressionFormat != nil {
+		// Re-compress the layers into the specified algorithm, the layer
+		// & manifest digests will be changed.
+		copyOpts.DestinationCtx.CompressionFormat = compressionFormat
+		copyOpts.ForceCompressionFormat = true
+		copyOpts.PreserveDigests = false
 	}
 
+	// Report the blob progress if the progress output is enabled.
+	progressCh, finish := progress.Track(destRef.StringWithinTransport())
+	defer finish()
+	copyOpts.Progress = progressCh
+
 	var err error
 	copier := copy.NewCopier(&copy.CopierOption{
 		Options: copyOpts,
@@ -551,9 +890,10 @@ func copyImage(
 			Delay:    time.Millisecond * 100,
 		},
 
-		SourceRef: sourceRef,
-		DestRef:   destRef,
-		Policy:    policy,
+		SourceRef:       sourceRef,
+		DestRef:         destRef,
+		Policy:          policy,
+		BlobConcurrency: blobConcurrency,
 	})
 	_, err = copier.Copy(ctx)
 	return err
@@ -597,3 +937,25 @@ func updateSpecImageManifest(
 		spec.Layers = append(spec.Layers, layer.Digest)
 	}
 }
+
+// renameCopiedDir renames the OCI image directory named by the source
+// digest to the digest of the copied image rewritten during copy.
+func renameCopiedDir(dest *destination.Destination, from, to digest.Digest) error {
+	if dest.Type() != types.TypeOci || from == to {
+		return nil
+	}
+	o := path.Join(dest.Directory(), from.Encoded())
+	n := path.Join(dest.Directory(), to.Encoded())
+	if err := os.Rename(o, n); err != nil {
+		return fmt.Errorf("failed to rename [%v] to [%v]: %w", o, n, err)
+	}
+	return nil
+}
+
+// platformString returns the platform in 'os/arch[/variant]' format.
+func platformString(os, arch, variant string) string {
+	if variant == "" {
+		return os + "/" + arch
+	}
+	return os + "/" + arch + "/" + variant
+}
@@ -0,0 +1,133 @@
+package source
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	imagemanifest "github.com/containers/image/v5/manifest"
+	imagetypes "github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_runPlatformTasks(t *testing.T) {
+	tasks := []*platformTask{
+		{arch: "amd64"}, {arch: "arm64"}, {arch: "arm"}, {arch: "s390x"},
+	}
+	var (
+		mu       sync.Mutex
+		running  int
+		maxInUse int
+	)
+	runPlatformTasks(tasks, 2, func(task *platformTask) ([]byte, string, error) {
+		mu.Lock()
+		running++
+		if running > maxInUse {
+			maxInUse = running
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		// The tasks started earlier finish later.
+		switch task.arch {
+		case "amd64":
+			time.Sleep(time.Millisecond * 40)
+		case "arm64":
+			time.Sleep(time.Millisecond * 20)
+		case "arm":
+			return nil, "", errors.New("arm failed")
+		}
+		return []byte(task.arch), imgspecv1.MediaTypeImageManifest, nil
+	})
+	assert.Equal(t, 2, maxInUse)
+	assert.Equal(t, "amd64", string(tasks[0].manifest))
+	assert.Equal(t, "arm64", string(tasks[1].manifest))
+	assert.Nil(t, tasks[2].manifest)
+	assert.EqualError(t, tasks[2].err, "arm failed")
+	assert.Equal(t, "s390x", string(tasks[3].manifest))
+	assert.Nil(t, tasks[3].err)
+}
+
+func Test_recordPlatformTasks(t *testing.T) {
+	newTask := func(arch string) *platformTask {
+		b, _ := json.Marshal(&imgspecv1.Manifest{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Config: imgspecv1.Descriptor{
+				MediaType: imgspecv1.MediaTypeImageConfig,
+				Digest:    digest.FromString("config-" + arch),
+			},
+		})
+		return &platformTask{
+			osInfo:       "linux",
+			arch:         arch,
+			dig:          digest.FromBytes(b),
+			mime:         imgspecv1.MediaTypeImageManifest,
+			manifest:     b,
+			manifestMIME: imgspecv1.MediaTypeImageManifest,
+		}
+	}
+	s := &Source{
+		copiedArch:     make(map[string]bool),
+		copiedOS:       make(map[string]bool),
+		mutatedDigests: make(map[digest.Digest]digest.Digest),
+		driftedDigests: make(map[digest.Digest]digest.Digest),
+	}
+	failed := newTask("arm")
+	failed.err = errors.New("arm failed")
+	tasks := []*platformTask{newTask("amd64"), failed, newTask("arm64")}
+
+	copied, errs := s.recordPlatformTasks(nil, tasks)
+	assert.Equal(t, 2, copied)
+	assert.Equal(t, []error{failed.err}, errs)
+	// The copied images are recorded in the order of the tasks.
+	assert.Equal(t, 2, len(s.copiedList))
+	assert.Equal(t, "amd64", s.copiedList[0].Arch)
+	assert.Equal(t, tasks[0].dig, s.copiedList[0].Digest)
+	assert.Equal(t, "arm64", s.copiedList[1].Arch)
+	assert.Equal(t, 0, len(s.driftedDigests))
+}
+
+func Test_isDigestConflict(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "manifest type rejected",
+			err: fmt.Errorf("writing manifest failed and we cannot try conversions: %w",
+				imagetypes.ManifestTypeRejectedError{Err: errors.New("manifest invalid")}),
+			want: true,
+		},
+		{
+			name: "compression incompatible",
+			err:  fmt.Errorf("copy: %w", imagemanifest.ManifestLayerCompressionIncompatibilityError{}),
+			want: true,
+		},
+		{
+			name: "manifest rejected by policy",
+			err:  errors.New("uploading manifest latest: denied: manifest invalid: blocked by policy"),
+			want: false,
+		},
+		{
+			name: "unsupported media type text",
+			err:  errors.New("unsupported media type application/vnd.example"),
+			want: false,
+		},
+		{
+			name: "blob upload failed",
+			err:  errors.New("writing blob: unexpected EOF"),
+			want: false,
+		},
+	} {
+		assert.Equal(t, c.want, isDigestConflict(c.err), c.name)
+	}
+}
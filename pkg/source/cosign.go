@@ -0,0 +1,176 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cnrancher/hangar/pkg/copy"
+	"github.com/cnrancher/hangar/pkg/destination"
+	"github.com/cnrancher/hangar/pkg/logger"
+	"github.com/cnrancher/hangar/pkg/manifest"
+	"github.com/cnrancher/hangar/pkg/types"
+	"github.com/cnrancher/hangar/pkg/utils"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/opencontainers/go-digest"
+)
+
+// CosignSuffixes are the tag suffixes of the cosign signature, attestation
+// and SBOM artifacts stored by the tag-based convention.
+var CosignSuffixes = []string{".sig", ".att", ".sbom"}
+
+// CosignTag returns the tag of the cosign artifact of the manifest digest.
+//
+//	Example: sha256-<encoded-digest>.sig
+func CosignTag(d digest.Digest, suffix string) string {
+	return fmt.Sprintf("%s-%s%s", d.Algorithm(), d.Encoded(), suffix)
+}
+
+// CopyCosignArtifacts copies the cosign tag-based artifacts (.sig, .att,
+// .sbom) of the copied images from the source repository into the
+// destination repository, returns the number of the artifacts copied.
+//
+// Only the artifacts of the images whose digests are kept in destination
+// are copied, the images mutated during copy and the manifest index
+// re-created in destination are skipped since their signatures are no
+// longer valid.
+func (s *Source) CopyCosignArtifacts(
+	ctx context.Context,
+	dest *destination.Destination,
+	policy *signature.Policy,
+) (int, error) {
+	if s.imageType != types.TypeDocker || dest.Type() != types.TypeDocker {
+		return 0, nil
+	}
+	log := logger.FromContext(ctx)
+	subjects := s.artifactSubjects(ctx)
+
+	var (
+		num  int
+		errs []error
+	)
+	for _, subject := range subjects {
+		for _, suffix := range CosignSuffixes {
+			tag := CosignTag(subject, suffix)
+			ok, err := s.tagExists(ctx, tag)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to inspect %q: %w", tag, err))
+				continue
+			}
+			if !ok {
+				continue
+			}
+			sourceRef, err := alltransports.ParseImageName(fmt.Sprintf(
+				"%s%s/%s/%s:%s",
+				s.imageType.Transport(), s.registry, s.project, s.name, tag))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			destRef, err := dest.ReferenceTag(tag)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			// The cosign artifact is copied without mutation to keep
+			// its digest.
+			err = copyImage(
+				ctx, sourceRef, destRef, s.systemCtx, dest.SystemContext(),
+				policy, "", nil, nil, s.contentStore, s.blobConcurrency,
+				s.memoryLimiter, true)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to copy cosign artifact %q: %w", tag, err))
+				continue
+			}
+			log.Debugf("copied cosign artifact %q of %v", tag, subject)
+			num++
+		}
+	}
+	if len(errs) > 0 {
+		return num, fmt.Errorf("error occurred when copy cosign artifacts of [%v]: %v",
+			s.referenceName, errs)
+	}
+	return num, nil
+}
+
+// artifactSubjects returns the digests of the copied images whose digests
+// are kept in destination, the artifacts of the mutated images and the
+// manifest index re-created in destination are no longer valid.
+func (s *Source) artifactSubjects(ctx context.Context) []digest.Digest {
+	mutated := make(map[digest.Digest]bool, len(s.mutatedDigests))
+	for _, d := range s.mutatedDigests {
+		mutated[d] = true
+	}
+	subjects := []digest.Digest{}
+	copied := map[digest.Digest]bool{}
+	for _, spec := range s.copiedList {
+		if mutated[spec.Digest] || copied[spec.Digest] {
+			continue
+		}
+		copied[spec.Digest] = true
+		subjects = append(subjects, spec.Digest)
+	}
+	if !copied[s.manifestDigest] {
+		// The manifest index is re-created in destination with a
+		// different digest, its artifacts cannot be verified.
+		for _, suffix := range CosignSuffixes {
+			if ok, _ := s.tagExists(ctx, CosignTag(s.manifestDigest, suffix)); ok {
+				logger.FromContext(ctx).Warnf("Skip copying cosign artifact %q of [%v]: "+
+					"manifest index digest is changed in destination, "+
+					"sign the platform images (cosign sign --recursive) to keep the signatures",
+					CosignTag(s.manifestDigest, suffix), s.ReferenceNameWithoutTransport())
+			}
+		}
+	}
+	return subjects
+}
+
+// verifySigstore verifies the sigstore signature of the manifest digest
+// against the public key of the verifier, the verification failure is
+// only logged in the warn mode. The images of the non-registry sources are
+// not verified since their signatures are unavailable.
+func (s *Source) verifySigstore(ctx context.Context) error {
+	if s.sigstoreVerifier == nil {
+		return nil
+	}
+	log := logger.FromContext(ctx)
+	if s.imageType != types.TypeDocker {
+		log.Debugf("Skip verifying sigstore signature of [%v]: not a registry image",
+			s.referenceName)
+		return nil
+	}
+	sigRef, err := alltransports.ParseImageName(fmt.Sprintf(
+		"%s%s/%s/%s:%s",
+		s.imageType.Transport(), s.registry, s.project, s.name,
+		CosignTag(s.manifestDigest, ".sig")))
+	if err != nil {
+		return err
+	}
+	err = s.sigstoreVerifier.Verify(ctx, sigRef, s.systemCtx, s.manifestDigest)
+	if err == nil {
+		log.Infof("Verified sigstore signature of [%v]", s.ReferenceNameWithoutTransport())
+		return nil
+	}
+	if s.sigstoreVerifier.Mode() == copy.VerifyModeWarn {
+		log.Warnf("Failed to verify [%v]: %v", s.ReferenceNameWithoutTransport(), err)
+		return nil
+	}
+	return err
+}
+
+// tagExists checks whether the tag exists in the source repository.
+func (s *Source) tagExists(ctx context.Context, tag string) (bool, error) {
+	inspector, err := manifest.NewInspector(ctx, &manifest.InspectorOption{
+		ReferenceName: fmt.Sprintf("%s%s/%s/%s:%s",
+			s.imageType.Transport(), s.registry, s.project, s.name, tag),
+		SystemContext: s.systemCtx,
+	})
+	if err != nil {
+		if utils.IsManifestUnknown(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	inspector.Close()
+	return true, nil
+}
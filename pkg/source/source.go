@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/cnrancher/hangar/pkg/copy"
 	"github.com/cnrancher/hangar/pkg/destination"
 	"github.com/cnrancher/hangar/pkg/hangar/archive"
 	"github.com/cnrancher/hangar/pkg/manifest"
 	"github.com/cnrancher/hangar/pkg/types"
 	"github.com/cnrancher/hangar/pkg/utils"
 	imagemanifest "github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/transports/alltransports"
 	imagetypes "github.com/containers/image/v5/types"
@@ -80,6 +82,52 @@ type Source struct {
 
 	// copied OS list
 	copiedOS map[string]bool
+
+	// mutation is the config transformations applied during copy
+	mutation *copy.ConfigMutation
+	// contentStore is the local containerd content store to read the
+	// blobs before falling back to the network
+	contentStore *copy.ContentStore
+	// compression is the algorithm to re-compress the layers during copy,
+	// the layers are copied as-is if nil
+	compression *compression.Algorithm
+	// blobConcurrency is the number of the blobs copied in parallel
+	blobConcurrency int
+	// memoryLimiter limits the size of the large blobs copied in parallel
+	// by all the workers, not limited if nil
+	memoryLimiter *copy.MemoryLimiter
+	// platformConcurrency is the number of the platform images of the
+	// multi-arch image copied in parallel
+	platformConcurrency int
+	// sigstoreVerifier verifies the sigstore signature of the image
+	// before copy, not verified if nil
+	sigstoreVerifier *copy.SigstoreVerifier
+	// allowDigestChange copies the image again without the digest
+	// preservation if the manifest is rejected by the destination
+	allowDigestChange bool
+
+	// mutatedDigests is map[source digest]copied digest of the
+	// images mutated or re-compressed during copy
+	mutatedDigests map[digest.Digest]digest.Digest
+	// driftedDigests is map[source digest]destination digest of the
+	// images whose manifest was rewritten by the destination registry
+	// on push
+	driftedDigests map[digest.Digest]digest.Digest
+
+	// missingPlatformsOnly only copies the platforms not exists in the
+	// destination manifest list
+	missingPlatformsOnly bool
+
+	// includeAttestations copies the attestation manifests
+	// (unknown/unknown platform) of the copied images
+	includeAttestations bool
+	// excludedAttestations is the number of the attestation manifests
+	// excluded from the copied images
+	excludedAttestations int
+
+	// deprecated is the deprecated manifest & layer media types found in
+	// the copied images
+	deprecated []DeprecatedMediaType
 }
 
 // Option is used for create the Source object.
@@ -142,6 +190,8 @@ func NewSource(o *Option) (*Source, error) {
 	}
 	s.copiedArch = make(map[string]bool)
 	s.copiedOS = make(map[string]bool)
+	s.mutatedDigests = make(map[digest.Digest]digest.Digest)
+	s.driftedDigests = make(map[digest.Digest]digest.Digest)
 
 	return s, nil
 }
@@ -179,6 +229,11 @@ func (s *Source) Tag() string {
 	return s.tag
 }
 
+// Digest returns the manifest digest of the source image.
+func (s *Source) Digest() digest.Digest {
+	return s.manifestDigest
+}
+
 // ReferenceName returns the reference with transport of the source image.
 //
 //	Example:
@@ -237,12 +292,112 @@ func (s *Source) SystemContext() *imagetypes.SystemContext {
 	return s.systemCtx
 }
 
+// SetConfigMutation sets the transformations applied to the image config
+// during copy, the digest of the copied images will be changed.
+func (s *Source) SetConfigMutation(m *copy.ConfigMutation) {
+	s.mutation = m
+}
+
+// SetContentStore sets the local containerd content store to read the
+// blobs when the digests match before falling back to the network.
+func (s *Source) SetContentStore(c *copy.ContentStore) {
+	s.contentStore = c
+}
+
+// SetCompression sets the algorithm to re-compress the layers during copy
+// (e.g. transcode the gzip layers to zstd), the digest of the copied
+// images will be changed.
+func (s *Source) SetCompression(a *compression.Algorithm) {
+	s.compression = a
+}
+
+// SetBlobConcurrency sets the number of the blobs of the image copied in
+// parallel, the default concurrency is used if not positive.
+func (s *Source) SetBlobConcurrency(n int) {
+	s.blobConcurrency = n
+}
+
+// SetPlatformConcurrency sets the number of the platform images of the
+// multi-arch image copied in parallel, the default concurrency is used if
+// not positive.
+func (s *Source) SetPlatformConcurrency(n int) {
+	s.platformConcurrency = n
+}
+
+// SetMemoryLimiter sets the limiter shared by the workers to serialize
+// copying the very large blobs.
+func (s *Source) SetMemoryLimiter(l *copy.MemoryLimiter) {
+	s.memoryLimiter = l
+}
+
+// SetSigstoreVerifier sets the verifier to verify the sigstore signature
+// of the image against the public key before copy.
+func (s *Source) SetSigstoreVerifier(v *copy.SigstoreVerifier) {
+	s.sigstoreVerifier = v
+}
+
+// SetAllowDigestChange sets to copy the platform image again with the
+// digest preservation disabled if the push failed with the digest
+// preserved, instead of failing the image.
+func (s *Source) SetAllowDigestChange(b bool) {
+	s.allowDigestChange = b
+}
+
+// rewritten returns true if the manifests of the copied images are
+// rewritten by the config mutation or the layer re-compression, the
+// uncompressed layers of the docker-archive tarball are always compressed
+// during copy.
+func (s *Source) rewritten() bool {
+	return !s.mutation.Empty() || s.compression != nil ||
+		s.imageType == types.TypeDockerArhive
+}
+
+// SetMissingPlatformsOnly sets to only copy the platforms which are not
+// exist in the destination manifest list, the platform images already
+// exist in destination are kept even if their digests are different.
+func (s *Source) SetMissingPlatformsOnly(b bool) {
+	s.missingPlatformsOnly = b
+}
+
+// SetIncludeAttestations sets to copy the attestation manifests of the
+// copied images, the attestation manifests are excluded by default.
+func (s *Source) SetIncludeAttestations(b bool) {
+	s.includeAttestations = b
+}
+
+// ExcludedAttestations returns the number of the attestation manifests
+// excluded from the copied images.
+func (s *Source) ExcludedAttestations() int {
+	return s.excludedAttestations
+}
+
+// DeprecatedMediaTypes returns the deprecated manifest media type (Docker
+// schema1) and layer media types found in the copied images.
+func (s *Source) DeprecatedMediaTypes() []DeprecatedMediaType {
+	return s.deprecated
+}
+
+// MutatedDigests returns the map[source digest]copied digest of the images
+// mutated or re-compressed during copy.
+func (s *Source) MutatedDigests() map[digest.Digest]digest.Digest {
+	return s.mutatedDigests
+}
+
+// DriftedDigests returns the map[source digest]destination digest of the
+// images whose manifest was rewritten by the destination registry on push.
+func (s *Source) DriftedDigests() map[digest.Digest]digest.Digest {
+	return s.driftedDigests
+}
+
 func (s *Source) Copy(
 	ctx context.Context,
 	dest *destination.Destination,
 	sets map[string]map[string]bool,
 	policy *signature.Policy,
 ) error {
+	if err := s.verifySigstore(ctx); err != nil {
+		return err
+	}
 	switch s.mime {
 	case imagemanifest.DockerV2ListMediaType:
 		// manifest is docker image list
@@ -452,7 +607,8 @@ func (s *Source) initManifest(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	s.manifestDigest, err = imagemanifest.Digest(b)
+	s.manifestDigest, err = manifest.Digest(
+		b, manifest.ReferenceAlgorithm(s.referenceName))
 	if err != nil {
 		return err
 	}
@@ -554,7 +710,10 @@ func (s *Source) ImageBySet(set map[string]map[string]bool) *archive.Image {
 			archSet[arch] = true
 			osSet[osInfo] = true
 			image.Images = append(image.Images, archive.ImageSpec{
-				Digest: m.Digest,
+				Arch:    arch,
+				OS:      osInfo,
+				Variant: m.Platform.Variant,
+				Digest:  m.Digest,
 			})
 		}
 	case imagemanifest.DockerV2Schema2MediaType:
@@ -586,6 +745,9 @@ func (s *Source) ImageBySet(set map[string]map[string]bool) *archive.Image {
 		})
 	case imgspecv1.MediaTypeImageIndex:
 		for _, m := range s.ociIndex.Manifests {
+			if manifest.IsAttestation(m.Annotations) {
+				continue
+			}
 			p := m.Platform
 			if len(set["arch"]) != 0 && !set["arch"][p.Architecture] {
 				continue
@@ -596,7 +758,10 @@ func (s *Source) ImageBySet(set map[string]map[string]bool) *archive.Image {
 			archSet[p.Architecture] = true
 			osSet[p.OS] = true
 			image.Images = append(image.Images, archive.ImageSpec{
-				Digest: m.Digest,
+				Arch:    p.Architecture,
+				OS:      p.OS,
+				Variant: p.Variant,
+				Digest:  m.Digest,
 			})
 		}
 	case imgspecv1.MediaTypeImageManifest:
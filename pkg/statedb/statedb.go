@@ -0,0 +1,145 @@
+// Package statedb implements the state DB of hangar persisted across the
+// runs in the user config dir, including the run history (history.jsonl),
+// the source digests of the images copied successfully (state.json) and
+// the trust-on-first-use digests of the source images.
+package statedb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// EnvDir is the environment variable overriding the state DB directory.
+const EnvDir = "HANGAR_STATE_DIR"
+
+// DefaultDir returns the default state DB directory, the HANGAR_STATE_DIR
+// environment variable overrides the default directory.
+func DefaultDir() string {
+	if d := os.Getenv(EnvDir); d != "" {
+		return d
+	}
+	d, err := os.UserConfigDir()
+	if err != nil {
+		d = os.TempDir()
+	}
+	return filepath.Join(d, "hangar")
+}
+
+// Path returns the path of the file in the default state DB directory.
+func Path(name string) string {
+	return filepath.Join(DefaultDir(), name)
+}
+
+// WriteFile writes the data into the file atomically, the data is written
+// into a temp file in the same directory and renamed to the file, so the
+// readers and the interrupted writers never see a partially written file.
+func WriteFile(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// WriteJSON encodes the value in indented JSON and writes it into the file
+// atomically.
+func WriteJSON(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, b)
+}
+
+// ReadJSON decodes the JSON file into the value, returns false if the
+// file does not exist.
+func ReadJSON(path string, v any) (bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Store is the versioned JSON file of the records of the images, shared by
+// the state DB files recording the per-image data.
+type Store[R any] struct {
+	Version int           `json:"version"`
+	Images  map[string]*R `json:"images"`
+
+	// name is the name of the store in the error messages
+	name string
+	path string
+	mu   sync.Mutex
+}
+
+// Open loads the store from the file path, an empty store is created if
+// the file does not exist.
+func Open[R any](name, path string, version int) (*Store[R], error) {
+	s := &Store[R]{
+		Version: version,
+		Images:  make(map[string]*R),
+		name:    name,
+		path:    path,
+	}
+	if _, err := ReadJSON(path, s); err != nil {
+		return nil, fmt.Errorf("failed to load %v %q: %w", name, path, err)
+	}
+	if s.Version != version {
+		return nil, fmt.Errorf("unsupported %v version %d", name, s.Version)
+	}
+	if s.Images == nil {
+		s.Images = make(map[string]*R)
+	}
+	return s, nil
+}
+
+// Lock locks the store for reading and writing the records.
+func (s *Store[R]) Lock() {
+	s.mu.Lock()
+}
+
+// Unlock unlocks the store.
+func (s *Store[R]) Unlock() {
+	s.mu.Unlock()
+}
+
+// Path returns the file path of the store.
+func (s *Store[R]) Path() string {
+	return s.path
+}
+
+// Save writes the store into file.
+func (s *Store[R]) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := WriteJSON(s.path, s); err != nil {
+		return fmt.Errorf("failed to write %v: %w", s.name, err)
+	}
+	return nil
+}
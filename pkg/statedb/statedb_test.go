@@ -0,0 +1,61 @@
+package statedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DefaultDir(t *testing.T) {
+	t.Setenv(EnvDir, "/tmp/hangar-state")
+	assert.Equal(t, "/tmp/hangar-state", DefaultDir())
+	assert.Equal(t, filepath.Join("/tmp/hangar-state", "state.json"), Path("state.json"))
+}
+
+func Test_WriteJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a", "b.json")
+	assert.Nil(t, WriteJSON(path, map[string]int{"a": 1}))
+	assert.Nil(t, WriteJSON(path, map[string]int{"b": 2}))
+
+	m := map[string]int{}
+	ok, err := ReadJSON(path, &m)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]int{"b": 2}, m)
+	// The temp files are removed.
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	assert.Equal(t, 1, len(entries))
+
+	ok, err = ReadJSON(filepath.Join(dir, "not-exist.json"), &m)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, os.WriteFile(path, []byte("invalid"), 0644))
+	_, err = ReadJSON(path, &m)
+	assert.NotNil(t, err)
+}
+
+func Test_Store(t *testing.T) {
+	type record struct {
+		Value string `json:"value"`
+	}
+	path := filepath.Join(t.TempDir(), "store.json")
+	s, err := Open[record]("test store", path, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(s.Images))
+	assert.Equal(t, path, s.Path())
+
+	s.Lock()
+	s.Images["nginx"] = &record{Value: "a"}
+	s.Unlock()
+	assert.Nil(t, s.Save())
+
+	s, err = Open[record]("test store", path, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", s.Images["nginx"].Value)
+
+	_, err = Open[record]("test store", path, 2)
+	assert.ErrorContains(t, err, "unsupported test store version 1")
+}
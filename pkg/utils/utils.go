@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/types"
 	"golang.org/x/mod/semver"
@@ -438,6 +439,28 @@ func SemverMajorMinorEqual(a, b string) bool {
 	return true
 }
 
+// IsManifestUnknown checks whether the error returned by registry is
+// the manifest unknown (not found) error.
+func IsManifestUnknown(err error) bool {
+	if err == nil {
+		return false
+	}
+	s := strings.ToLower(err.Error())
+	return strings.Contains(s, "manifest unknown") ||
+		strings.Contains(s, "not found")
+}
+
+// FormatSize formats the size in bytes into human readable format.
+func FormatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	s := float64(size)
+	i := 0
+	for ; s >= 1024 && i < len(units)-1; i++ {
+		s /= 1024
+	}
+	return fmt.Sprintf("%.2f %s", s, units[i])
+}
+
 func ToObj(data interface{}, into interface{}) error {
 	bytes, err := json.Marshal(data)
 	if err != nil {
@@ -501,6 +524,26 @@ func SystemContextWithTLSVerify(sysctx *types.SystemContext, tlsVerify bool) *ty
 	return n
 }
 
+// InsecureRegistry checks whether the TLS verification of the registry is
+// disabled, either globally by the system context or per registry by the
+// registries.conf of the system context.
+func InsecureRegistry(sysctx *types.SystemContext, registry string) bool {
+	if sysctx == nil {
+		return false
+	}
+	switch sysctx.DockerInsecureSkipTLSVerify {
+	case types.OptionalBoolTrue:
+		return true
+	case types.OptionalBoolFalse:
+		return false
+	}
+	reg, err := sysregistriesv2.FindRegistry(sysctx, registry)
+	if err != nil || reg == nil {
+		return false
+	}
+	return reg.Insecure
+}
+
 func SystemContextWithSharedBlobDir(sysctx *types.SystemContext, dir string) *types.SystemContext {
 	n := CopySystemContext(sysctx)
 	n.OCISharedBlobDirPath = dir
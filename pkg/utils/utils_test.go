@@ -1,11 +1,14 @@
 package utils
 
 import (
+	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/containers/image/v5/types"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -208,3 +211,53 @@ func Test_GetImageName(t *testing.T) {
 	assert.Equal(t, GetImageName("docker.io/library/nginx"), "nginx")
 	assert.Equal(t, GetImageName("docker.io/library/nginx:latest"), "nginx")
 }
+
+func Test_InsecureRegistry(t *testing.T) {
+	conf := filepath.Join(t.TempDir(), "registries.conf")
+	assert.Nil(t, os.WriteFile(conf, []byte(`
+[[registry]]
+location = "10.0.0.5:5000"
+insecure = true
+`), 0644))
+	sysctx := &types.SystemContext{
+		SystemRegistriesConfPath:    conf,
+		SystemRegistriesConfDirPath: t.TempDir(),
+	}
+	assert.True(t, InsecureRegistry(sysctx, "10.0.0.5:5000"))
+	assert.False(t, InsecureRegistry(sysctx, "docker.io"))
+	assert.False(t, InsecureRegistry(nil, "10.0.0.5:5000"))
+
+	sysctx.DockerInsecureSkipTLSVerify = types.OptionalBoolFalse
+	assert.False(t, InsecureRegistry(sysctx, "10.0.0.5:5000"))
+	sysctx.DockerInsecureSkipTLSVerify = types.OptionalBoolTrue
+	assert.True(t, InsecureRegistry(sysctx, "docker.io"))
+}
+
+func Test_IsManifestUnknown(t *testing.T) {
+	assert.False(t, IsManifestUnknown(nil))
+	assert.False(t, IsManifestUnknown(errors.New("unauthorized")))
+	assert.True(t, IsManifestUnknown(errors.New("reading manifest 1.2.3: manifest unknown")))
+}
+
+func Test_VariantRules(t *testing.T) {
+	r, err := ParseVariantRules(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "v8", r.Normalize("arm64", ""))
+	assert.Equal(t, "v7", r.Normalize("arm", ""))
+	assert.Equal(t, "v6", r.Normalize("arm", "v6"))
+	assert.Equal(t, "", r.Normalize("amd64", ""))
+	assert.Equal(t, r.Platform("linux", "arm64", ""), r.Platform("linux", "arm64", "v8"))
+
+	r, err = ParseVariantRules([]string{"arm=v6", "arm64=", "amd64=v2"})
+	assert.Nil(t, err)
+	assert.Equal(t, "v6", r.Normalize("arm", ""))
+	assert.Equal(t, "", r.Normalize("arm64", ""))
+	assert.Equal(t, "v2", r.Normalize("amd64", ""))
+	// The default rules are not modified.
+	assert.Equal(t, "v8", DefaultVariantRules.Normalize("arm64", ""))
+
+	_, err = ParseVariantRules([]string{"arm64"})
+	assert.NotNil(t, err)
+	_, err = ParseVariantRules([]string{"=v8"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VariantRules is the default variant of the architectures, used for
+// normalizing the empty (implicit) variants when matching the platforms
+// of the source and destination images, e.g. 'arm64' equals 'arm64/v8'.
+type VariantRules map[string]string
+
+// DefaultVariantRules is the default variants of the architectures
+// following the OCI image index specification.
+var DefaultVariantRules = VariantRules{
+	"arm":   "v7",
+	"arm64": "v8",
+}
+
+// ParseVariantRules parses the 'ARCH=VARIANT' rules which override the
+// default variant rules, the empty VARIANT disables the rule of the ARCH.
+func ParseVariantRules(rules []string) (VariantRules, error) {
+	r := make(VariantRules, len(DefaultVariantRules)+len(rules))
+	for arch, variant := range DefaultVariantRules {
+		r[arch] = variant
+	}
+	for _, rule := range rules {
+		arch, variant, ok := strings.Cut(rule, "=")
+		arch, variant = strings.TrimSpace(arch), strings.TrimSpace(variant)
+		if !ok || arch == "" {
+			return nil, fmt.Errorf("invalid variant rule %q: should be 'ARCH=VARIANT' format", rule)
+		}
+		if variant == "" {
+			delete(r, arch)
+			continue
+		}
+		r[arch] = variant
+	}
+	return r, nil
+}
+
+// Normalize returns the variant of the architecture, the default variant
+// is returned if the variant is empty.
+func (r VariantRules) Normalize(arch, variant string) string {
+	if variant != "" {
+		return variant
+	}
+	return r[arch]
+}
+
+// Platform returns the platform in 'os/arch/variant' format with the
+// normalized variant, used as the key to match the platforms.
+func (r VariantRules) Platform(os, arch, variant string) string {
+	return os + "/" + arch + "/" + r.Normalize(arch, variant)
+}